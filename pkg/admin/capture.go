@@ -0,0 +1,44 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+var frameCaptures func() interface{}
+
+// SetFrameCaptures sets the source of the captured frames served by the admin api, nil means no capture is kept
+func SetFrameCaptures(f func() interface{}) {
+	frameCaptures = f
+}
+
+func getFrameCaptures(ctx *fasthttp.RequestCtx) {
+	f := frameCaptures
+	if f == nil {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "frame capture is not enabled" }`))
+		return
+	}
+	if buf, err := json.Marshal(f()); err == nil {
+		ctx.Write(buf)
+	} else {
+		ctx.SetStatusCode(500)
+		ctx.Write([]byte(`{ error: "internal error" }`))
+	}
+}
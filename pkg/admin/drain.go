@@ -0,0 +1,38 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"github.com/alipay/sofa-mosn/pkg/log"
+)
+
+var drainers []func()
+
+// AddDrainer registers the callback to drain the downstream connections,
+// a draining connection rejects new requests and is closed once the in-flight ones finish
+func AddDrainer(f func()) {
+	drainers = append(drainers, f)
+}
+
+// Drain calls all the registered drainers
+func Drain() {
+	log.DefaultLogger.Infof("drain downstream connections")
+	for _, f := range drainers {
+		f()
+	}
+}
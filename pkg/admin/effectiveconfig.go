@@ -18,6 +18,9 @@
 package admin
 
 import (
+	"bytes"
+	"net/url"
+	"strings"
 	"sync"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
@@ -80,10 +83,94 @@ func SetHosts(clusterName string, hostConfigs []v2.Host) {
 	mutex.Unlock()
 }
 
+// redacted is the placeholder of the sensitive config values in the dump
+const redacted = "[redacted]"
+
+var (
+	// sensitiveKeys are the config keys whose values are always redacted
+	sensitiveKeys = map[string]bool{
+		"private_key": true,
+		"ticket":      true,
+	}
+	// sensitiveKeyWords are redacted if the config key contains any of them
+	sensitiveKeyWords = []string{"password", "secret", "credential", "token"}
+)
+
+// pemPrivateKey marks an inline private key, e.g. in the extend verify config of the TLS
+const pemPrivateKey = "PRIVATE KEY-----"
+
 // Dump
-// Dump all config
+// Dump all config, the sensitive values such as private keys and credentials are redacted,
+// the keys are matched case insensitively in the listener, cluster and mosn config, e.g. the registry password
 func Dump() ([]byte, error) {
+	// the snapshot is taken under lock, so that a concurrent reload is never partially dumped
 	mutex.RLock()
-	defer mutex.RUnlock()
-	return json.Marshal(conf)
+	b, err := json.Marshal(conf)
+	mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(redact(v))
+}
+
+func redact(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if isSensitiveKey(key) {
+				if s, ok := item.(string); !ok || s != "" {
+					value[key] = redacted
+				}
+				continue
+			}
+			value[key] = redact(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redact(item)
+		}
+	case string:
+		return redactValue(value)
+	}
+	return v
+}
+
+// redactValue redacts the secrets under the keys not known as sensitive: the inline private keys,
+// and the passwords of the urls, e.g. the registry address with the credentials
+func redactValue(s string) string {
+	if strings.Contains(s, pemPrivateKey) {
+		return redacted
+	}
+	if !strings.Contains(s, "@") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	return strings.Replace(s, u.User.String(), u.User.Username()+":"+redacted, 1)
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, word := range sensitiveKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
 }
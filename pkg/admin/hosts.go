@@ -0,0 +1,52 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+var hostsStatus func(clusterName string) (interface{}, bool)
+
+// SetHostsStatus sets the source of the upstream hosts status served by the admin api, the empty cluster name
+// means all the clusters, false is returned if the cluster is not found
+func SetHostsStatus(f func(clusterName string) (interface{}, bool)) {
+	hostsStatus = f
+}
+
+// getHostsStatus dumps the host sets of the cluster in query args, or of all the clusters
+func getHostsStatus(ctx *fasthttp.RequestCtx) {
+	f := hostsStatus
+	if f == nil {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "no cluster manager" }`))
+		return
+	}
+	status, ok := f(string(ctx.QueryArgs().Peek("cluster")))
+	if !ok {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "unknown cluster" }`))
+		return
+	}
+	if buf, err := json.Marshal(status); err == nil {
+		ctx.Write(buf)
+	} else {
+		ctx.SetStatusCode(500)
+		ctx.Write([]byte(`{ error: "internal error" }`))
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package admin
+
+import (
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/valyala/fasthttp"
+)
+
+var outlierOverride func(clusterName string, addr string, eject bool, window time.Duration) error
+
+// SetOutlierOverride sets the manual override of the outlier detection served by the admin api, the host
+// of the cluster is forced ejected or included for the window. It should be called during initialization
+func SetOutlierOverride(f func(clusterName string, addr string, eject bool, window time.Duration) error) {
+	outlierOverride = f
+}
+
+// overrideOutlier forces the host in query args ejected or included, e.g.
+// POST /api/v1/outlier/override?cluster=c&host=10.0.0.1:12200&action=include&window=5m
+func overrideOutlier(ctx *fasthttp.RequestCtx) {
+	f := outlierOverride
+	if f == nil {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "no cluster manager" }`))
+		return
+	}
+	args := ctx.QueryArgs()
+	clusterName := string(args.Peek("cluster"))
+	addr := string(args.Peek("host"))
+	if clusterName == "" || addr == "" {
+		ctx.SetStatusCode(400)
+		ctx.Write([]byte(`{ error: "cluster and host are required" }`))
+		return
+	}
+	action := string(args.Peek("action"))
+	var eject bool
+	switch action {
+	case "eject":
+		eject = true
+	case "include":
+	default:
+		ctx.SetStatusCode(400)
+		ctx.Write([]byte(`{ error: "action should be include or eject" }`))
+		return
+	}
+	window, err := time.ParseDuration(string(args.Peek("window")))
+	if err != nil || window <= 0 {
+		ctx.SetStatusCode(400)
+		ctx.Write([]byte(`{ error: "invalid window" }`))
+		return
+	}
+
+	if err := f(clusterName, addr, eject, window); err != nil {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "` + err.Error() + `" }`))
+		return
+	}
+	log.DefaultLogger.Infof("Admin API: outlier host %s in cluster %s is overridden, action %s, window %s",
+		addr, clusterName, action, window)
+}
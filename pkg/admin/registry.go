@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/valyala/fasthttp"
+)
+
+// registryReadInterval is the minimal interval between two reads of the registry,
+// the reads bypass the cache of the discovery and hit the registry directly
+const registryReadInterval = time.Second
+
+var (
+	registryChildren func(path string) ([]string, error)
+
+	registryReadMux  sync.Mutex
+	registryLastRead time.Time
+)
+
+// SetRegistryChildren sets the fresh read of the children of a registry path served by the admin api,
+// e.g. GetChildren of the zookeeper client. It should be called during initialization
+func SetRegistryChildren(f func(path string) ([]string, error)) {
+	registryChildren = f
+}
+
+// registryChildrenResult is the response of reading a registry path, the error is the one of the
+// registry client as is, with its type to tell e.g. a missing node from a lost connection
+type registryChildrenResult struct {
+	Path      string   `json:"path"`
+	Children  []string `json:"children"`
+	Error     string   `json:"error,omitempty"`
+	ErrorType string   `json:"error_type,omitempty"`
+}
+
+// allowRegistryRead returns false if the registry has been read within registryReadInterval
+func allowRegistryRead(now time.Time) bool {
+	registryReadMux.Lock()
+	defer registryReadMux.Unlock()
+	if now.Sub(registryLastRead) < registryReadInterval {
+		return false
+	}
+	registryLastRead = now
+	return true
+}
+
+// getRegistryChildren reads the children of the path in query args from the registry,
+// to compare with the hosts the clusters have
+func getRegistryChildren(ctx *fasthttp.RequestCtx) {
+	f := registryChildren
+	if f == nil {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "no registry client" }`))
+		return
+	}
+	path := string(ctx.QueryArgs().Peek("path"))
+	if path == "" {
+		ctx.SetStatusCode(400)
+		ctx.Write([]byte(`{ error: "path is required" }`))
+		return
+	}
+	if !allowRegistryRead(time.Now()) {
+		ctx.SetStatusCode(429)
+		ctx.Write([]byte(`{ error: "too many registry reads" }`))
+		return
+	}
+
+	children, err := f(path)
+	result := registryChildrenResult{
+		Path:     path,
+		Children: children,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorType = fmt.Sprintf("%T", err)
+	}
+	log.DefaultLogger.Infof("Admin API: read registry path %s, %d children, error %v", path, len(children), err)
+	if buf, err := json.Marshal(result); err == nil {
+		ctx.Write(buf)
+	} else {
+		ctx.SetStatusCode(500)
+		ctx.Write([]byte(`{ error: "internal error" }`))
+	}
+}
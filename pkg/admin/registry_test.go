@@ -0,0 +1,97 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type mockNoNodeError struct{}
+
+func (e *mockNoNodeError) Error() string {
+	return "node does not exist"
+}
+
+func readRegistryChildren(path string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/api/v1/registry/children" + path)
+	requestHandler(ctx)
+	return ctx
+}
+
+func TestRegistryChildren(t *testing.T) {
+	defer SetRegistryChildren(nil)
+
+	SetRegistryChildren(nil)
+	if ctx := readRegistryChildren("?path=/a"); ctx.Response.StatusCode() != 404 {
+		t.Errorf("expect 404 without registry client, got %d", ctx.Response.StatusCode())
+	}
+
+	var paths []string
+	SetRegistryChildren(func(path string) ([]string, error) {
+		paths = append(paths, path)
+		if path == "/missing" {
+			return nil, &mockNoNodeError{}
+		}
+		return []string{"10.0.0.1:12200", "10.0.0.2:12200"}, nil
+	})
+	if ctx := readRegistryChildren(""); ctx.Response.StatusCode() != 400 {
+		t.Errorf("expect 400 without path, got %d", ctx.Response.StatusCode())
+	}
+
+	registryLastRead = time.Time{}
+	ctx := readRegistryChildren("?path=/providers")
+	if ctx.Response.StatusCode() != 200 {
+		t.Fatalf("read registry failed, status %d", ctx.Response.StatusCode())
+	}
+	if body := string(ctx.Response.Body()); body != `{"path":"/providers","children":["10.0.0.1:12200","10.0.0.2:12200"]}` {
+		t.Errorf("unexpected children: %s", body)
+	}
+
+	// the registry is read at most once within the interval
+	if ctx := readRegistryChildren("?path=/providers"); ctx.Response.StatusCode() != 429 {
+		t.Errorf("expect 429 within the read interval, got %d", ctx.Response.StatusCode())
+	}
+	if len(paths) != 1 {
+		t.Errorf("expect registry read once, got %v", paths)
+	}
+
+	// the error of the registry client is returned as is
+	registryLastRead = time.Time{}
+	ctx = readRegistryChildren("?path=/missing")
+	if body := string(ctx.Response.Body()); body != `{"path":"/missing","children":null,"error":"node does not exist","error_type":"*admin.mockNoNodeError"}` {
+		t.Errorf("unexpected error result: %s", body)
+	}
+}
+
+func TestAllowRegistryRead(t *testing.T) {
+	registryLastRead = time.Time{}
+	now := time.Now()
+	if !allowRegistryRead(now) {
+		t.Error("first read should be allowed")
+	}
+	if allowRegistryRead(now.Add(registryReadInterval / 2)) {
+		t.Error("read within the interval should be rejected")
+	}
+	if !allowRegistryRead(now.Add(registryReadInterval)) {
+		t.Error("read after the interval should be allowed")
+	}
+}
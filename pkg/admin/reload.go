@@ -0,0 +1,38 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"github.com/alipay/sofa-mosn/pkg/log"
+)
+
+var certReloaders []func()
+
+// AddCertReloader registers the callback to reload the certificates from the files,
+// the reloaded certificates are used by the new connections only
+func AddCertReloader(f func()) {
+	certReloaders = append(certReloaders, f)
+}
+
+// ReloadCerts calls all the registered certificate reloaders
+func ReloadCerts() {
+	log.DefaultLogger.Infof("reload certificates")
+	for _, f := range certReloaders {
+		f()
+	}
+}
@@ -52,15 +52,56 @@ var levelMap = map[string]log.Level{
 	"TRACE": log.TRACE,
 }
 
+// logLevels is the response of getting the log levels, the modules not set are empty
+type logLevels struct {
+	Global  string            `json:"global"`
+	Modules map[string]string `json:"modules"`
+}
+
+func getLogLevel(ctx *fasthttp.RequestCtx) {
+	levels := logLevels{
+		Global:  log.DefaultLogger.GetLevel().String(),
+		Modules: log.ModuleLevels(),
+	}
+	if buf, err := json.Marshal(levels); err == nil {
+		ctx.Write(buf)
+	} else {
+		ctx.SetStatusCode(500)
+		ctx.Write([]byte(`{ error: "internal error" }`))
+	}
+}
+
+// setLogLevel sets the level in body to the DefaultLogger, or to the module in query args
 func setLogLevel(ctx *fasthttp.RequestCtx) {
 	body := string(ctx.Request.Body())
-	if level, ok := levelMap[body]; ok {
-		log.DefaultLogger.Level = level
-		log.DefaultLogger.Infof("DefaultLogger level has been changed to %s", body)
-	} else {
+	level, ok := levelMap[body]
+	if !ok {
 		ctx.SetStatusCode(500)
 		ctx.Write([]byte(`{ error: "unknown log level" }`))
+		return
+	}
+	if module := string(ctx.QueryArgs().Peek("module")); module != "" {
+		if err := log.SetModuleLevel(module, level); err != nil {
+			ctx.SetStatusCode(404)
+			ctx.Write([]byte(`{ error: "unknown log module" }`))
+			return
+		}
+		log.DefaultLogger.Infof("log module %s level has been changed to %s", module, body)
+		return
+	}
+	log.DefaultLogger.SetLevel(level)
+	log.DefaultLogger.Infof("DefaultLogger level has been changed to %s", body)
+}
+
+// resetLogLevel makes the module in query args follow the DefaultLogger again
+func resetLogLevel(ctx *fasthttp.RequestCtx) {
+	module := string(ctx.QueryArgs().Peek("module"))
+	if err := log.ResetModuleLevel(module); err != nil {
+		ctx.SetStatusCode(404)
+		ctx.Write([]byte(`{ error: "unknown log module" }`))
+		return
 	}
+	log.DefaultLogger.Infof("log module %s level has been reset", module)
 }
 
 func requestHandler(ctx *fasthttp.RequestCtx) {
@@ -68,10 +109,26 @@ func requestHandler(ctx *fasthttp.RequestCtx) {
 	method := string(ctx.Method())
 
 	switch {
-	case path == "/api/v1/config_dump" && method == "GET":
+	case (path == "/api/v1/config_dump" || path == "/config_dump") && method == "GET":
 		configDump(ctx)
+	case path == "/api/v1/logging" && method == "GET":
+		getLogLevel(ctx)
 	case path == "/api/v1/logging" && method == "POST":
 		setLogLevel(ctx)
+	case path == "/api/v1/logging" && method == "DELETE":
+		resetLogLevel(ctx)
+	case path == "/api/v1/drain" && method == "POST":
+		Drain()
+	case path == "/api/v1/certs/reload" && method == "POST":
+		ReloadCerts()
+	case path == "/api/v1/frame_captures" && method == "GET":
+		getFrameCaptures(ctx)
+	case path == "/api/v1/hosts" && method == "GET":
+		getHostsStatus(ctx)
+	case path == "/api/v1/registry/children" && method == "GET":
+		getRegistryChildren(ctx)
+	case path == "/api/v1/outlier/override" && method == "POST":
+		overrideOutlier(ctx)
 	default:
 		ctx.SetStatusCode(404)
 	}
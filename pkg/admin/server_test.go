@@ -22,8 +22,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
 )
@@ -87,3 +89,53 @@ func TestDumpConfig(t *testing.T) {
 	}
 	Reset()
 }
+
+func TestLogLevel(t *testing.T) {
+	server := Server{}
+	config := &mockMOSNConfig{
+		Name: "mock",
+		Port: 8890,
+	}
+	server.Start(config)
+	defer server.Close()
+	defer Reset()
+
+	level := log.DefaultLogger.GetLevel()
+	defer log.DefaultLogger.SetLevel(level)
+	log.ModuleLogger("admin_test")
+
+	url := fmt.Sprintf("http://localhost:%d/api/v1/logging", config.Port)
+	post := func(url, body string) int {
+		resp, err := http.Post(url, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post(url, "DEBUG"); code != http.StatusOK || log.DefaultLogger.GetLevel() != log.DEBUG {
+		t.Errorf("set default level failed, status %d, level %v", code, log.DefaultLogger.GetLevel())
+	}
+	if code := post(url+"?module=admin_test", "ERROR"); code != http.StatusOK {
+		t.Errorf("set module level failed, status %d", code)
+	}
+	if code := post(url+"?module=not_registered", "ERROR"); code != http.StatusNotFound {
+		t.Errorf("set level of unknown module should fail, status %d", code)
+	}
+	if code := post(url, "VERBOSE"); code == http.StatusOK {
+		t.Error("set unknown level should fail")
+	}
+
+	if levels := log.ModuleLevels(); levels["admin_test"] != "ERROR" {
+		t.Errorf("unexpected module levels: %v", levels)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, url+"?module=admin_test", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("reset module level failed: %v", err)
+	}
+	if log.ModuleLevels()["admin_test"] != "" {
+		t.Errorf("module level should be reset, got %v", log.ModuleLevels())
+	}
+}
@@ -26,6 +26,8 @@ type HealthCheckConfig struct {
 	UnhealthyThreshold   uint32         `json:"unhealthy_threshold"`
 	CheckPath            string         `json:"check_path,omitempty"`
 	ServiceName          string         `json:"service_name,omitempty"`
+	CheckService         string         `json:"check_service,omitempty"` // service pinged by the sofarpc check instead of the heartbeat
+	CheckMethod          string         `json:"check_method,omitempty"`  // method of the check service, a no-op taking no arguments
 }
 
 type HostConfig struct {
@@ -43,17 +45,86 @@ const EGRESS ListenerType = "egress"
 const INGRESS ListenerType = "ingress"
 
 type ListenerConfig struct {
-	Name                                  string        `json:"name"`
-	Type                                  ListenerType  `json:"type"`
-	AddrConfig                            string        `json:"address"`
-	BindToPort                            bool          `json:"bind_port"`
-	HandOffRestoredDestinationConnections bool          `json:"handoff_restoreddestination"`
-	LogPath                               string        `json:"log_path,omitempty"`
-	LogLevelConfig                        string        `json:"log_level,omitempty"`
-	AccessLogs                            []AccessLog   `json:"access_logs,omitempty"`
-	FilterChains                          []FilterChain `json:"filter_chains"` // only one filterchains at this time
-	StreamFilters                         []Filter      `json:"stream_filters,omitempty"`
-	Inspector                             bool          `json:"inspector,omitempty"`
+	Name                                  string         `json:"name"`
+	Type                                  ListenerType   `json:"type"`
+	AddrConfig                            string         `json:"address"`
+	BindToPort                            bool           `json:"bind_port"`
+	HandOffRestoredDestinationConnections bool           `json:"handoff_restoreddestination"`
+	LogPath                               string         `json:"log_path,omitempty"`
+	LogLevelConfig                        string         `json:"log_level,omitempty"`
+	AccessLogs                            []AccessLog    `json:"access_logs,omitempty"`
+	FilterChains                          []FilterChain  `json:"filter_chains"` // only one filterchains at this time
+	StreamFilters                         []Filter       `json:"stream_filters,omitempty"`
+	Inspector                             bool           `json:"inspector,omitempty"`
+	ReadBufferSize                        uint32         `json:"read_buffer_size,omitempty"`            // bytes of the connection read buffer, 0 means default
+	WriteBufferSize                       uint32         `json:"write_buffer_size,omitempty"`           // bytes of the socket send buffer, 0 means default
+	WriteBufferHighWatermark              uint32         `json:"write_buffer_high_watermark,omitempty"` // bytes pending write to pause reading from upstreams, 0 means disabled
+	WriteBufferLowWatermark               uint32         `json:"write_buffer_low_watermark,omitempty"`  // bytes pending write to resume reading, 0 means half of the high watermark
+	StreamingDecode                       bool           `json:"streaming_decode,omitempty"`            // stream the large request content through without buffering the whole frame, sofarpc only
+	StreamingDecodeThreshold              uint32         `json:"streaming_decode_threshold,omitempty"`  // min content length of the request streamed, 0 means the default 64KB, sofarpc only
+	IdleTimeout                           DurationConfig `json:"idle_timeout,omitempty"`                // close the connection receiving no frame in the timeout, 0 means disabled, sofarpc only
+	LifecycleHooks                        []Filter       `json:"lifecycle_hooks,omitempty"`             // hooks of the connection and stream lifecycle by the registered type, sofarpc only
+	ProtocolDetection                     *DetectConfig  `json:"protocol_detection,omitempty"`          // detect the protocol of each connection to share the port, sofarpc only
+	MaxRequestPayload                     uint64         `json:"max_request_payload,omitempty"`         // bytes of the request payload, 0 means the default 32MB, sofarpc only
+	HijackReasons                         map[int]string `json:"hijack_reasons,omitempty"`              // error message of the responses made by MOSN by the status code, empty means no message, sofarpc only
+	GracefulCodecReset                    bool           `json:"graceful_codec_reset,omitempty"`        // a codec error of a single frame only resets the stream instead of closing the connection, sofarpc only
+	MaxConcurrentStreams                  uint32         `json:"max_concurrent_streams,omitempty"`      // server streams of a single connection, the exceeding requests are rejected, 0 means no limit, sofarpc only
+	FrameRateLimit                        *FrameRate     `json:"frame_rate_limit,omitempty"`            // frames decoded per second on a single connection, nil means no limit, sofarpc only
+	RequestWorkers                        *WorkerPool    `json:"request_workers,omitempty"`             // pool of the listener processing the decoded requests, nil means the read goroutine of each connection, sofarpc only
+	QoS                                   *QoSConfig     `json:"qos,omitempty"`                         // request priority classes shed under overload, nil means never shed, sofarpc only
+	StreamAccessLog                       *AccessLog     `json:"stream_access_log,omitempty"`           // one line of each server stream on completion, nil means disabled, sofarpc only
+	FrameCapture                          *FrameCapture  `json:"frame_capture,omitempty"`               // raw frames of the sampled requests and their responses for debugging, nil means disabled, sofarpc only
+}
+
+// DetectConfig detects the protocol of each connection by its first bytes, so that the clients of
+// different protocols share the listener port, e.g. bolt and boltv2 of sofarpc
+type DetectConfig struct {
+	Protocols []string       `json:"protocols"`          // candidates, e.g. bolt and boltv2
+	Timeout   DurationConfig `json:"timeout,omitempty"`  // waiting for the first bytes, 0 means the default
+	Fallback  string         `json:"fallback,omitempty"` // protocol of the connection not detected, empty means closed
+}
+
+// FrameRate limits the frames decoded on a single downstream connection, so that a connection flooding
+// tiny frames can't spike the cpu of the codec. The connection exceeding the limit stops reading for the pause,
+// the frames read already are still handled, or it is closed if configured
+type FrameRate struct {
+	FramesPerSecond     int            `json:"frames_per_second"`               // sustained rate, 0 disables the limit
+	Burst               int            `json:"burst,omitempty"`                 // frames allowed at once above the rate, 0 means the rate
+	HeartbeatsPerSecond int            `json:"heartbeats_per_second,omitempty"` // heartbeats limited in their own bucket, 0 counts them as the requests
+	Close               bool           `json:"close,omitempty"`                 // close the connection instead of pausing the read
+	Pause               DurationConfig `json:"pause,omitempty"`                 // read stopped on exceeding the limit, 0 means 1s
+}
+
+// WorkerPool is the bounded pool of the workers processing the decoded requests of a listener
+type WorkerPool struct {
+	Workers   int `json:"workers"`              // worker goroutines, 0 disables the pool
+	QueueSize int `json:"queue_size,omitempty"` // requests waiting for the workers, split evenly among the workers
+}
+
+// QoSConfig classifies the requests by the priority header, the classes are shed by the active requests of the instance
+type QoSConfig struct {
+	Header       string     `json:"header"`                  // priority header in the request header map
+	DefaultClass string     `json:"default_class,omitempty"` // class of the requests without the header or with an unknown value, empty means never shed
+	Classes      []QoSClass `json:"classes"`
+}
+
+// QoSClass is a priority class of the requests
+type QoSClass struct {
+	Name      string   `json:"name"`
+	Values    []string `json:"values"`               // values of the priority header in the class
+	MaxActive int64    `json:"max_active,omitempty"` // the class is rejected while the active requests exceed it, 0 means never
+}
+
+// FrameCapture captures the raw frames of the sampled downstream requests and their responses, the values of
+// the sensitive headers are redacted
+type FrameCapture struct {
+	SampleRate    float64  `json:"sample_rate,omitempty"`    // ratio of the requests captured, 0 ~ 1
+	DebugHeader   string   `json:"debug_header,omitempty"`   // requests carrying the header are always captured
+	RedactHeaders []string `json:"redact_headers,omitempty"` // keys of the sensitive headers, case insensitive
+	MaxBytes      int      `json:"max_bytes,omitempty"`      // bytes kept of a frame, 0 means 4096
+	Sink          string   `json:"sink"`                     // ring kept in memory and served by the admin api, or log written to the log path
+	RingSize      int      `json:"ring_size,omitempty"`      // frames kept by the ring, 0 means 1024
+	LogPath       string   `json:"log_path,omitempty"`
 }
 
 type TCPRouteConfig struct {
@@ -96,12 +167,20 @@ type RouterActionConfig struct {
 	MetadataConfig          MetadataConfig       `json:"metadata_match"`
 	TimeoutConfig           DurationConfig       `json:"timeout"`
 	RetryPolicy             *RetryPolicy         `json:"retry_policy"`
+	TimeoutOverride         *TimeoutOverride     `json:"timeout_override,omitempty"`
+	HostExclusionConfig     DurationConfig       `json:"host_exclusion_window"`
+	Deduplication           *DeduplicationConfig `json:"deduplication,omitempty"`
+	MirrorPolicy            *MirrorPolicy        `json:"mirror_policy,omitempty"`
+	RequestBufferPolicy     *RequestBufferPolicy `json:"request_buffer_policy,omitempty"` // overrides the cluster's, nil means not overridden
 	PrefixRewrite           string               `json:"prefix_rewrite"`
 	HostRewrite             string               `json:"host_rewrite"`
 	AutoHostRewrite         bool                 `json:"auto_host_rewrite"`
 	RequestHeadersToAdd     []*HeaderValueOption `json:"request_headers_to_add"`
+	RequestHeadersToRemove  []string             `json:"request_headers_to_remove,omitempty"`
+	RequestHeadersToRename  []*HeaderRename      `json:"request_headers_to_rename,omitempty"`
 	ResponseHeadersToAdd    []*HeaderValueOption `json:"response_headers_to_add"`
 	ResponseHeadersToRemove []string             `json:"response_headers_to_remove"`
+	ResponseHeadersToRename []*HeaderRename      `json:"response_headers_to_rename,omitempty"`
 }
 
 type ClusterWeightConfig struct {
@@ -110,8 +189,35 @@ type ClusterWeightConfig struct {
 	MetadataConfig MetadataConfig `json:"metadata_match"`
 }
 
+// DeduplicationConfig enables the response cache of the route by the request id on the downstream connection,
+// only for the requests that are idempotent at the proxy
+type DeduplicationConfig struct {
+	TTLConfig  DurationConfig `json:"ttl"`
+	MaxEntries int            `json:"max_entries"`
+}
+
+// MirrorPolicy mirrors the requests of the route to the shadow cluster, the shadow responses are discarded.
+// Percent is the percentage of requests mirrored, sampled by the request id, 0 means all requests
+type MirrorPolicy struct {
+	ClusterName string `json:"cluster_name"`
+	Percent     uint32 `json:"percent,omitempty"`
+}
+
+// TimeoutOverrideConfig is the route level timeouts take precedence over the timeouts in the request headers.
+// The precedence is: route override > client header > route default (timeout and retry_timeout), 0 means not overridden
+type TimeoutOverrideConfig struct {
+	TryTimeoutConfig    DurationConfig `json:"try_timeout"`
+	GlobalTimeoutConfig DurationConfig `json:"global_timeout"`
+}
+
 type RetryPolicyConfig struct {
 	RetryOn            bool           `json:"retry_on"`
 	RetryTimeoutConfig DurationConfig `json:"retry_timeout"`
 	NumRetries         uint32         `json:"num_retries"`
+	// MaxAttempts caps the upstream attempts of one downstream request, counting the first
+	// request and the retries, 0 means only NumRetries applies
+	MaxAttempts uint32 `json:"max_attempts,omitempty"`
+	// RetryOnStatus is the retryable status codes, in the proxy's error codes, e.g. 404 for the sofarpc
+	// no processor response and 502 for no healthy upstream. Empty means retry on 5xx and connection failure
+	RetryOnStatus []int `json:"retry_on_status,omitempty"`
 }
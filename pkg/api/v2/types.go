@@ -41,8 +41,10 @@ const (
 
 // Stream Filter's Type
 const (
-	MIXER       = "mixer"
-	FaultStream = "fault"
+	MIXER               = "mixer"
+	FaultStream         = "fault"
+	ServiceLimitStream  = "service_limit"
+	ResponseCacheStream = "response_cache"
 )
 
 // ClusterType
@@ -63,8 +65,123 @@ type LbType string
 const (
 	LB_RANDOM     LbType = "LB_RANDOM"
 	LB_ROUNDROBIN LbType = "LB_ROUNDROBIN"
+	LB_WRR        LbType = "LB_WRR"
+
+	LB_CONSISTENT_HASH LbType = "LB_CONSISTENT_HASH"
+	LB_WEIGHTED_RANDOM LbType = "LB_WEIGHTED_RANDOM"
+)
+
+// RequestBufferMode controls how the request body is buffered for retry
+type RequestBufferMode string
+
+// Group of request buffer mode
+const (
+	BUFFER_ALWAYS RequestBufferMode = "ALWAYS" // buffer the whole body for retry
+	BUFFER_NEVER  RequestBufferMode = "NEVER"  // stream the body, requests with body can not be retried
+	BUFFER_LIMIT  RequestBufferMode = "LIMIT"  // buffer up to LimitBytes, then stream
 )
 
+// RequestBufferPolicy is the request body buffering policy of a cluster, which is overridden by the route's
+// empty mode buffers the whole body
+type RequestBufferPolicy struct {
+	Mode       RequestBufferMode `json:"mode,omitempty"`
+	LimitBytes uint32            `json:"limit_bytes,omitempty"`
+}
+
+// ConsistentHashConfig is the config of the consistent hash load balancer
+type ConsistentHashConfig struct {
+	// HeaderKey is the request header hashed onto the ring, requests without it are balanced by round robin
+	HeaderKey string `json:"header_key"`
+	// LoadFactor bounds the active requests of a host to LoadFactor times the average, default 1.25
+	LoadFactor float64 `json:"load_factor,omitempty"`
+	// VirtualNodes is the number of ring points of each host, default 160
+	VirtualNodes int `json:"virtual_nodes,omitempty"`
+	// HashFunction is the name of the hash function registered in the cluster package, default "default"
+	HashFunction string `json:"hash_function,omitempty"`
+}
+
+// SlowStartConfig ramps up the weight of a host added by the discovery linearly during the window
+type SlowStartConfig struct {
+	// Window is the ramp duration, zero means disabled
+	Window DurationConfig `json:"window,omitempty"`
+	// MinWeightPercent is the weight percent when the host added, default 10
+	MinWeightPercent uint32 `json:"min_weight_percent,omitempty"`
+}
+
+// ConnPoolConfig is the upstream connection recycling of a cluster
+type ConnPoolConfig struct {
+	// MaxIdleTime closes the connection without streams for the duration, zero means never
+	MaxIdleTime DurationConfig `json:"max_idle_time,omitempty"`
+	// MaxLifetime recycles the connection established for the duration, it is closed after the streams drained.
+	// zero means never
+	MaxLifetime DurationConfig `json:"max_lifetime,omitempty"`
+	// Preconnect warms up the connection pools of the hosts added to the cluster
+	Preconnect PreconnectConfig `json:"preconnect,omitempty"`
+}
+
+// PreconnectConfig establishes the upstream connections of the new hosts before the requests arrive
+type PreconnectConfig struct {
+	// Protocol is the protocol of the connection pool to warm up, empty means disabled
+	Protocol string `json:"protocol,omitempty"`
+	// Rate is the max hosts preconnected per second, zero means 10
+	Rate uint32 `json:"rate,omitempty"`
+}
+
+// LocalityLBConfig prefers the hosts in the same zone as the local MOSN, which is the zone of the service registry
+// application. The zone of a host is its metadata label ZoneKey, e.g. parsed from the zone of the registered dubbo URL.
+// The requests spill to the remote zones only if the local healthy hosts are not enough.
+// Enabled if ZoneKey and the local zone are set, not used by the subset and consistent hash load balancers
+type LocalityLBConfig struct {
+	// ZoneKey is the host metadata key of the zone, empty means disabled
+	ZoneKey string `json:"zone_key,omitempty"`
+	// LocalPercent is the percent of the requests routed to the local zone, zero means 100
+	LocalPercent uint32 `json:"local_percent,omitempty"`
+	// MinHealthyPercent is the healthy percent of the local hosts below which the local percent is scaled
+	// down in proportion, zero means 70
+	MinHealthyPercent uint32 `json:"min_healthy_percent,omitempty"`
+}
+
+// HostDrainConfig drains the upstream host signaling it's shutting down in the response from the load balancer,
+// e.g. a draining MOSN answers RESPONSE_STATUS_SERVER_THREADPOOL_BUSY. Enabled if Statuses or Header is set.
+// The drained host is eligible again after the cooldown, or once it is removed and added again by the discovery
+type HostDrainConfig struct {
+	// Statuses are the response status codes signaling the shutdown, in the proxy's error codes, e.g. 503
+	Statuses []int `json:"statuses,omitempty"`
+	// Header is the response header signaling the shutdown if present
+	Header string `json:"header,omitempty"`
+	// Cooldown is the duration the host is drained, zero means 30s
+	Cooldown DurationConfig `json:"cooldown,omitempty"`
+}
+
+// ReresolveConfig forces a discovery read once a host fails to connect repeatedly, its address may be stale
+// while the registry is not updated yet. The host is ejected at once if the outlier detection is enabled
+type ReresolveConfig struct {
+	// ConnectFailures is the consecutive connect failures of a host forcing the read, zero means disabled
+	ConnectFailures uint32 `json:"connect_failures,omitempty"`
+	// MinInterval is the min interval between the forced reads of the cluster, zero means 10s
+	MinInterval DurationConfig `json:"min_interval,omitempty"`
+}
+
+// LiveWeightConfig updates the lb weight of each host from the data of its registration node, e.g. the zk
+// ephemeral node updated by the backend, without removing and adding the host again. The data is parsed as
+// url query parameters, e.g. "weight=10", the same as the parameters of the dubbo provider url. The dubbo
+// "enabled" flag in the data, or "dynamic" without "enabled", takes the host out of the lb while it is false
+type LiveWeightConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Field is the parameter holding the weight, empty means "weight"
+	Field string `json:"field,omitempty"`
+}
+
+// ConnectBackoffConfig delays the next connect to a host after it failed to connect, the delay is doubled on
+// each failure in a row up to MaxInterval and reset once a connect succeeds. The host is out of the lb during
+// the delay, so the requests go to the other hosts instead of connecting it again and again
+type ConnectBackoffConfig struct {
+	// BaseInterval is the delay after the first failure, zero means disabled
+	BaseInterval DurationConfig `json:"base_interval,omitempty"`
+	// MaxInterval caps the delay, zero means 30s
+	MaxInterval DurationConfig `json:"max_interval,omitempty"`
+}
+
 // RoutingPriority
 type RoutingPriority string
 
@@ -76,19 +193,39 @@ const (
 
 // Cluster represents a cluster's information
 type Cluster struct {
-	Name                 string           `json:"name"`
-	ClusterType          ClusterType      `json:"type"`
-	SubType              string           `json:"sub_type"` //not used yet
-	LbType               LbType           `json:"lb_type"`
-	MaxRequestPerConn    uint32           `json:"max_request_per_conn"`
-	ConnBufferLimitBytes uint32           `json:"conn_buffer_limit_bytes"`
-	CirBreThresholds     CircuitBreakers  `json:"circuit_breakers,omitempty"`
-	OutlierDetection     OutlierDetection `json:"outlier_detection,omitempty"` //not used yet
-	HealthCheck          HealthCheck      `json:"health_check,omitempty"`
-	Spec                 ClusterSpecInfo  `json:"spec,omitempty"`
-	LBSubSetConfig       LBSubsetConfig   `json:"lb_subset_config,omitempty"`
-	TLS                  TLSConfig        `json:"tls_context,omitempty"`
-	Hosts                []Host           `json:"hosts"`
+	Name                 string               `json:"name"`
+	ClusterType          ClusterType          `json:"type"`
+	SubType              string               `json:"sub_type"` //not used yet
+	LbType               LbType               `json:"lb_type"`
+	HostSelector         string               `json:"host_selector,omitempty"` // name of the custom host selector registered in the cluster package, overrides lb_type
+	MaxRequestPerConn    uint32               `json:"max_request_per_conn"`
+	ConnBufferLimitBytes uint32               `json:"conn_buffer_limit_bytes"`
+	ConnectTimeout       DurationConfig       `json:"connect_timeout,omitempty"` // bounds establishing the upstream connection apart from the request timeout, zero means no limit
+	CirBreThresholds     CircuitBreakers      `json:"circuit_breakers,omitempty"`
+	OutlierDetection     OutlierDetection     `json:"outlier_detection,omitempty"` //not used yet
+	HealthCheck          HealthCheck          `json:"health_check,omitempty"`
+	Spec                 ClusterSpecInfo      `json:"spec,omitempty"`
+	LBSubSetConfig       LBSubsetConfig       `json:"lb_subset_config,omitempty"`
+	TLS                  TLSConfig            `json:"tls_context,omitempty"`
+	FrameCompress        string               `json:"frame_compress,omitempty"`       // frame compression offered to upstream MOSN, gzip or deflate, empty means disabled
+	HeartbeatInterval    DurationConfig       `json:"heartbeat_interval,omitempty"`   // heartbeat on idle upstream connections, zero means disabled
+	MaxResponsePayload   uint64               `json:"max_response_payload,omitempty"` // bytes of the sofarpc response payload, zero means the default 32MB
+	RequestBufferPolicy  RequestBufferPolicy  `json:"request_buffer_policy,omitempty"`
+	ConsistentHash       ConsistentHashConfig `json:"consistent_hash,omitempty"`
+	SlowStart            SlowStartConfig      `json:"slow_start,omitempty"`
+	ConnPool             ConnPoolConfig       `json:"conn_pool,omitempty"`
+	HostDrain            HostDrainConfig      `json:"host_drain,omitempty"`
+	LocalityLB           LocalityLBConfig     `json:"locality_lb,omitempty"`
+	DiscoveryDebounce    DurationConfig       `json:"discovery_debounce,omitempty"` // coalesces the discovered hosts updates within the window, zero means disabled
+	Reresolve            ReresolveConfig      `json:"reresolve,omitempty"`
+	LiveWeight           LiveWeightConfig     `json:"live_weight,omitempty"`
+	ConnectBackoff       ConnectBackoffConfig `json:"connect_backoff,omitempty"`
+	Hosts                []Host               `json:"hosts"`
+	SeedHosts            []Host               `json:"seed_hosts,omitempty"` // used while the discovery returns no hosts
+	// Registry is the registry the hosts are discovered from, e.g. the zk namespace of the blue or the green
+	// deploy, so the same interface in two registries is two clusters selected by the routes. Empty means
+	// the default registry
+	Registry string `json:"registry,omitempty"`
 }
 
 // HealthCheck is a configuration of health check
@@ -156,6 +293,30 @@ type StreamFaultInject struct {
 	Headers         []HeaderMatcher `json:"headers"`
 }
 
+// StreamServiceLimit limits the requests rate by the sofarpc service
+type StreamServiceLimit struct {
+	Services map[string]ServiceLimit `json:"services"`
+}
+
+// ServiceLimit is a token bucket filled with QPS tokens per second, holds Burst tokens at most
+type ServiceLimit struct {
+	QPS   int64 `json:"qps"`
+	Burst int64 `json:"burst,omitempty"`
+}
+
+// StreamResponseCache caches the sofarpc responses of the idempotent methods,
+// a route overrides the TTL by the per filter config
+type StreamResponseCache struct {
+	MaxEntries int                 `json:"max_entries"`
+	TTL        DurationConfig      `json:"ttl"`
+	Methods    map[string][]string `json:"methods"` // service -> the idempotent methods, only these are cached
+}
+
+// ResponseCacheRoute is the route level config of the response cache, zero TTL keeps the filter's
+type ResponseCacheRoute struct {
+	TTL DurationConfig `json:"ttl"`
+}
+
 type DelayInject struct {
 	DelayInjectConfig
 	Delay time.Duration `json:"-"`
@@ -181,6 +342,8 @@ type RouteAction struct {
 	RouterActionConfig
 	MetadataMatch Metadata      `json:"-"`
 	Timeout       time.Duration `json:"-"`
+	// HostExclusionWindow is the duration a failed host is deprioritized on the route, 0 means disabled
+	HostExclusionWindow time.Duration `json:"-"`
 }
 
 // Decorator
@@ -200,6 +363,13 @@ type RetryPolicy struct {
 	RetryTimeout time.Duration `json:"-"`
 }
 
+// TimeoutOverride represents the route level timeouts override the request headers
+type TimeoutOverride struct {
+	TimeoutOverrideConfig
+	TryTimeout    time.Duration `json:"-"`
+	GlobalTimeout time.Duration `json:"-"`
+}
+
 // CircuitBreakers is a configuration of circuit breakers
 // CircuitBreakers implements json.Marshaler and json.Unmarshaler
 type CircuitBreakers struct {
@@ -214,11 +384,15 @@ type Thresholds struct {
 	MaxRetries         uint32          `json:"max_retries"`
 }
 
-// OutlierDetection not used yet
+// OutlierDetection is the passive health check of the cluster, enabled if Consecutive5xx is not 0.
+// A host is ejected after Consecutive5xx consecutive errors, for BaseEjectionTime doubled on each
+// ejection in a row and capped at MaxEjectionTime. Only Consecutive5xx, BaseEjectionTime, MaxEjectionTime
+// and MaxEjectionPercent are used yet
 type OutlierDetection struct {
 	Consecutive5xx                     uint32
 	Interval                           time.Duration
 	BaseEjectionTime                   time.Duration
+	MaxEjectionTime                    time.Duration
 	MaxEjectionPercent                 uint32
 	ConsecutiveGatewayFailure          uint32
 	EnforcingConsecutive5xx            uint32
@@ -311,6 +485,8 @@ type Proxy struct {
 	UpstreamProtocol   string                 `json:"upstream_protocol"`
 	RouterConfigName   string                 `json:"router_config_name"`
 	ValidateClusters   bool                   `json:"validate_clusters"`
+	TrustedSources     []string               `json:"trusted_sources,omitempty"`     // ip or cidr allowed to choose cluster by header
+	AllowHostOverride  bool                   `json:"allow_host_override,omitempty"` // honors the upstream host header, for debugging only
 	ExtendConfig       map[string]interface{} `json:"extend_config"`
 }
 
@@ -326,6 +502,12 @@ type HeaderValue struct {
 	Value string `json:"value"`
 }
 
+// HeaderRename renames the header From to To, the value is kept
+type HeaderRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
 // RouterConfiguration is a filter for routers
 // Filter type is:  "CONNECTION_MANAGER"
 type RouterConfiguration struct {
@@ -124,6 +124,7 @@ func (r *RouteAction) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	r.Timeout = r.RouterActionConfig.TimeoutConfig.Duration
+	r.HostExclusionWindow = r.RouterActionConfig.HostExclusionConfig.Duration
 	r.MetadataMatch = parseMetaData(r.MetadataConfig)
 	return nil
 }
@@ -144,6 +145,15 @@ func (rp *RetryPolicy) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (to *TimeoutOverride) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &to.TimeoutOverrideConfig); err != nil {
+		return err
+	}
+	to.TryTimeout = to.TryTimeoutConfig.Duration
+	to.GlobalTimeout = to.GlobalTimeoutConfig.Duration
+	return nil
+}
+
 // PublishInfo's implements json.Marshaler and json.Unmarshaler
 func (pb PublishInfo) MarshalJSON() (b []byte, err error) {
 	return json.Marshal(pb.Pub)
@@ -274,6 +274,10 @@ func TestRouterConfigUmaeshal(t *testing.T) {
 								"retry_on": true,
 								"retry_timeout": "1m",
 								"num_retries":10
+							},
+							"timeout_override": {
+								"try_timeout": "2s",
+								"global_timeout": "5s"
 							}
 						},
 						"redirect":{
@@ -334,6 +338,8 @@ func TestRouterConfigUmaeshal(t *testing.T) {
 				router.Route.RetryPolicy.RetryTimeout == time.Minute &&
 				router.Route.RetryPolicy.RetryOn == true &&
 				router.Route.RetryPolicy.NumRetries == 10 &&
+				router.Route.TimeoutOverride.TryTimeout == 2*time.Second &&
+				router.Route.TimeoutOverride.GlobalTimeout == 5*time.Second &&
 				reflect.DeepEqual(meta, router.Metadata) &&
 				router.Decorator == "test") {
 				t.Error("virtual host failed")
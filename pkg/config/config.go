@@ -46,6 +46,8 @@ type ServerConfig struct {
 	UseNetpollMode bool `json:"use_netpoll_mode,omitempty"`
 	//graceful shutdown config
 	GracefulTimeout v2.DurationConfig `json:"graceful_timeout"`
+	//wait for the in-flight streams on shutdown before closing the upstreams
+	ShutdownGracePeriod v2.DurationConfig `json:"shutdown_grace_period,omitempty"`
 
 	//go processor number
 	Processor int `json:"processor"`
@@ -76,6 +78,25 @@ type MOSNConfig struct {
 	RawStaticResources  jsoniter.RawMessage `json:"static_resources,omitempty"`  //static_resources raw message
 	RawAdmin            jsoniter.RawMessage `json:"admin,omitempty"`             // admin raw message
 	Debug               PProfConfig         `json:"pprof,omitempty"`
+	//cluster stats published to the registry
+	StatsPublisher StatsPublisherConfig `json:"stats_publisher,omitempty"`
+	//zookeeper registry
+	Registry RegistryConfig `json:"registry,omitempty"`
+}
+
+// RegistryConfig is the zookeeper registry used by the discovery, the stats publisher and the admin api
+type RegistryConfig struct {
+	Address  []string          `json:"address,omitempty"`   // the zk ensemble, empty disables the registry
+	Timeout  v2.DurationConfig `json:"timeout,omitempty"`   // the requested session timeout, default 1s
+	LogLevel string            `json:"log_level,omitempty"` // the level of the zk client logs, default info
+	Root     string            `json:"root,omitempty"`      // the root of the dubbo services, default /dubbo
+	Clusters []string          `json:"clusters,omitempty"`  // the clusters discovered from <root>/<cluster>/providers
+}
+
+// StatsPublisherConfig is used to publish the cluster stats to the registry set by stats.SetRegistryPublisher
+type StatsPublisherConfig struct {
+	Path     string            `json:"path,omitempty"`     // the ephemeral node published to, empty disables the publishing
+	Interval v2.DurationConfig `json:"interval,omitempty"` // If interval is 0, will use 30s as default
 }
 
 // PProfConfig is used to start a pprof server for debug
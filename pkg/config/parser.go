@@ -269,6 +269,32 @@ func ParseStreamFaultInjectFilter(cfg map[string]interface{}) (*v2.StreamFaultIn
 	return filterConfig, nil
 }
 
+// ParseStreamServiceLimitFilter
+func ParseStreamServiceLimitFilter(cfg map[string]interface{}) (*v2.StreamServiceLimit, error) {
+	filterConfig := &v2.StreamServiceLimit{}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, filterConfig); err != nil {
+		return nil, err
+	}
+	return filterConfig, nil
+}
+
+// ParseStreamResponseCacheFilter
+func ParseStreamResponseCacheFilter(cfg map[string]interface{}) (*v2.StreamResponseCache, error) {
+	filterConfig := &v2.StreamResponseCache{}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, filterConfig); err != nil {
+		return nil, err
+	}
+	return filterConfig, nil
+}
+
 // ParseMixerFilter
 func ParseMixerFilter(cfg map[string]interface{}) *v2.Mixer {
 	mixerFilter := &v2.Mixer{}
@@ -324,12 +350,13 @@ func ParseServiceRegistry(src v2.ServiceRegistryInfo) {
 // ParseServerConfig
 func ParseServerConfig(c *ServerConfig) *server.Config {
 	sc := &server.Config{
-		ServerName:      c.ServerName,
-		LogPath:         c.DefaultLogPath,
-		LogLevel:        parseLogLevel(c.DefaultLogLevel),
-		GracefulTimeout: c.GracefulTimeout.Duration,
-		Processor:       c.Processor,
-		UseNetpollMode:  c.UseNetpollMode,
+		ServerName:          c.ServerName,
+		LogPath:             c.DefaultLogPath,
+		LogLevel:            parseLogLevel(c.DefaultLogLevel),
+		GracefulTimeout:     c.GracefulTimeout.Duration,
+		ShutdownGracePeriod: c.ShutdownGracePeriod.Duration,
+		Processor:           c.Processor,
+		UseNetpollMode:      c.UseNetpollMode,
 	}
 
 	return sc
@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// cacheKey is the service, the method and the hash of the request body
+type cacheKey struct {
+	service string
+	method  string
+	body    [sha1.Size]byte
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	headers types.HeaderMap // the response headers without the data
+	data    []byte
+	expire  time.Time
+}
+
+// responseCache is a LRU cache bounded by the number of entries, it is safe for concurrent use
+type responseCache struct {
+	mux        sync.Mutex
+	maxEntries int
+	ll         *list.List
+	entries    map[cacheKey]*list.Element
+}
+
+func newResponseCache(maxEntries int) *responseCache {
+	return &responseCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// get returns the unexpired entry of the key, the expired one is removed
+func (c *responseCache) get(key cacheKey, now time.Time) (*cacheEntry, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !now.Before(entry.expire) {
+		c.ll.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+
+	return entry, true
+}
+
+// put adds or replaces the entry, the least recently used ones are evicted beyond the max entries
+func (c *responseCache) put(entry *cacheEntry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if e, ok := c.entries[entry.key]; ok {
+		e.Value = entry
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.entries[entry.key] = c.ll.PushFront(entry)
+
+	for c.ll.Len() > c.maxEntries {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.entries, e.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *responseCache) len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.ll.Len()
+}
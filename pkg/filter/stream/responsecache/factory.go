@@ -0,0 +1,83 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/config"
+	"github.com/alipay/sofa-mosn/pkg/filter"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func init() {
+	filter.RegisterStream(v2.ResponseCacheStream, CreateResponseCacheFilterFactory)
+}
+
+// FilterConfigFactory holds the cache, which is shared by the filters of all connections
+type FilterConfigFactory struct {
+	cache    *responseCache
+	ttl      time.Duration
+	services map[string]*serviceCache
+}
+
+func (f *FilterConfigFactory) CreateFilterChain(context context.Context, callbacks types.StreamFilterChainFactoryCallbacks) {
+	filter := newResponseCacheFilter(context, f.cache, f.ttl, f.services)
+	callbacks.AddStreamReceiverFilter(filter)
+	callbacks.AddStreamSenderFilter(filter)
+}
+
+func CreateResponseCacheFilterFactory(conf map[string]interface{}) (types.StreamFilterChainFactory, error) {
+	log.DefaultLogger.Debugf("create response cache stream filter factory")
+	cfg, err := config.ParseStreamResponseCacheFilter(conf)
+	if err != nil {
+		return nil, err
+	}
+	return newFilterConfigFactory(cfg)
+}
+
+func newFilterConfigFactory(cfg *v2.StreamResponseCache) (*FilterConfigFactory, error) {
+	if cfg.MaxEntries <= 0 {
+		return nil, fmt.Errorf("invalid max entries %d of response cache", cfg.MaxEntries)
+	}
+
+	services := make(map[string]*serviceCache, len(cfg.Methods))
+	for service, methods := range cfg.Methods {
+		s := stats.NewResponseCacheStats(service)
+		sc := &serviceCache{
+			methods: make(map[string]struct{}, len(methods)),
+			hit:     s.Counter(stats.ResponseCacheHit),
+			miss:    s.Counter(stats.ResponseCacheMiss),
+		}
+		for _, method := range methods {
+			sc.methods[method] = struct{}{}
+		}
+		services[service] = sc
+	}
+
+	return &FilterConfigFactory{
+		cache:    newResponseCache(cfg.MaxEntries),
+		ttl:      cfg.TTL.Duration,
+		services: services,
+	}, nil
+}
@@ -0,0 +1,228 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"context"
+	"crypto/sha1"
+	"hash"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rcrowley/go-metrics"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// serviceCache is the idempotent methods of a service with the cache stats
+type serviceCache struct {
+	methods map[string]struct{}
+	hit     metrics.Counter
+	miss    metrics.Counter
+}
+
+// responseCacheFilter is an implement of types.StreamReceiverFilter and types.StreamSenderFilter.
+// The request of an idempotent method is held until the body is hashed, a hit is replied from the cache
+// without the upstream, the successful response of a miss is cached for the ttl
+type responseCacheFilter struct {
+	cache    *responseCache
+	ttl      time.Duration
+	services map[string]*serviceCache
+
+	receiveHandler types.StreamReceiverFilterHandler
+	sendHandler    types.StreamSenderFilterHandler
+
+	service     *serviceCache
+	key         cacheKey
+	hash        hash.Hash // hashes the request body, nil if the request is not cacheable
+	missed      bool      // the response should be cached
+	served      bool      // the response is replied from the cache
+	respHeaders types.HeaderMap
+	respData    []byte
+}
+
+func newResponseCacheFilter(ctx context.Context, cache *responseCache, ttl time.Duration, services map[string]*serviceCache) *responseCacheFilter {
+	return &responseCacheFilter{
+		cache:    cache,
+		ttl:      ttl,
+		services: services,
+	}
+}
+
+// readPerRouteTTL returns the ttl of the route to override the filter's, zero if not configured
+func readPerRouteTTL(cfg map[string]interface{}) time.Duration {
+	c, ok := cfg[v2.ResponseCacheStream]
+	if !ok {
+		return 0
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		log.DefaultLogger.Errorf("response cache route config is not a json, %v", err)
+		return 0
+	}
+	routeConfig := &v2.ResponseCacheRoute{}
+	if err := json.Unmarshal(b, routeConfig); err != nil {
+		log.DefaultLogger.Errorf("config is not response cache route config, %v", err)
+		return 0
+	}
+	return routeConfig.TTL.Duration
+}
+
+func (f *responseCacheFilter) SetReceiveFilterHandler(handler types.StreamReceiverFilterHandler) {
+	f.receiveHandler = handler
+}
+
+func (f *responseCacheFilter) SetSenderFilterHandler(handler types.StreamSenderFilterHandler) {
+	f.sendHandler = handler
+}
+
+func (f *responseCacheFilter) OnReceiveHeaders(headers types.HeaderMap, endStream bool) types.StreamHeadersFilterStatus {
+	service, _ := headers.Get(models.SERVICE_KEY)
+	method, _ := headers.Get(models.TARGET_METHOD)
+	sc, ok := f.services[service]
+	if !ok {
+		return types.StreamHeadersFilterContinue
+	}
+	if _, ok := sc.methods[method]; !ok {
+		return types.StreamHeadersFilterContinue
+	}
+	if route := f.receiveHandler.Route(); route != nil {
+		if ttl := readPerRouteTTL(route.RouteRule().PerFilterConfig()); ttl > 0 {
+			f.ttl = ttl
+		}
+	}
+	if f.ttl <= 0 {
+		return types.StreamHeadersFilterContinue
+	}
+
+	f.service = sc
+	f.key = cacheKey{service: service, method: method}
+	f.hash = sha1.New()
+	if endStream && f.lookup() {
+		return types.StreamHeadersFilterStop
+	}
+	if endStream {
+		return types.StreamHeadersFilterContinue
+	}
+	// held until the body is hashed
+	return types.StreamHeadersFilterStop
+}
+
+func (f *responseCacheFilter) OnReceiveData(buf types.IoBuffer, endStream bool) types.StreamDataFilterStatus {
+	if f.hash == nil {
+		return types.StreamDataFilterContinue
+	}
+	if !endStream {
+		// the body in pieces can not be held, e.g. the sofarpc streaming decode, it is not cached
+		f.hash = nil
+		return types.StreamDataFilterContinue
+	}
+
+	f.hash.Write(buf.Bytes())
+	if f.lookup() {
+		return types.StreamDataFilterStop
+	}
+	return types.StreamDataFilterContinue
+}
+
+func (f *responseCacheFilter) OnReceiveTrailers(trailers types.HeaderMap) types.StreamTrailersFilterStatus {
+	return types.StreamTrailersFilterContinue
+}
+
+// lookup replies the cached response and returns true on a hit
+func (f *responseCacheFilter) lookup() bool {
+	copy(f.key.body[:], f.hash.Sum(nil))
+	f.hash = nil
+
+	entry, ok := f.cache.get(f.key, time.Now())
+	if !ok {
+		f.service.miss.Inc(1)
+		f.missed = true
+		return false
+	}
+	f.service.hit.Inc(1)
+	f.served = true
+	log.DefaultLogger.Debugf("reply the cached response of %s.%s", f.key.service, f.key.method)
+
+	headers := entry.headers.Clone()
+	if len(entry.data) == 0 {
+		f.receiveHandler.AppendHeaders(headers, true)
+		return true
+	}
+	f.receiveHandler.AppendHeaders(headers, false)
+	f.receiveHandler.AppendData(buffer.NewIoBufferBytes(append([]byte(nil), entry.data...)), true)
+	return true
+}
+
+func (f *responseCacheFilter) AppendHeaders(headers types.HeaderMap, endStream bool) types.StreamHeadersFilterStatus {
+	if !f.missed || f.served {
+		return types.StreamHeadersFilterContinue
+	}
+	f.missed = false
+	if status, ok := headers.(rpc.RespStatus); !ok || status.RespStatus() != uint32(sofarpc.RESPONSE_STATUS_SUCCESS) {
+		return types.StreamHeadersFilterContinue
+	}
+
+	// the data buffer may be reused after the response is sent
+	f.respHeaders = headers.Clone()
+	if cmd, ok := f.respHeaders.(rpc.RpcCmd); ok {
+		cmd.SetData(nil)
+	}
+	if endStream {
+		f.store()
+	}
+	return types.StreamHeadersFilterContinue
+}
+
+func (f *responseCacheFilter) AppendData(buf types.IoBuffer, endStream bool) types.StreamDataFilterStatus {
+	if f.respHeaders == nil {
+		return types.StreamDataFilterContinue
+	}
+	f.respData = append(f.respData, buf.Bytes()...)
+	if endStream {
+		f.store()
+	}
+	return types.StreamDataFilterContinue
+}
+
+func (f *responseCacheFilter) AppendTrailers(trailers types.HeaderMap) types.StreamTrailersFilterStatus {
+	// trailers are not cached
+	f.respHeaders = nil
+	f.respData = nil
+	return types.StreamTrailersFilterContinue
+}
+
+func (f *responseCacheFilter) store() {
+	f.cache.put(&cacheEntry{
+		key:     f.key,
+		headers: f.respHeaders,
+		data:    f.respData,
+		expire:  time.Now().Add(f.ttl),
+	})
+	f.respHeaders = nil
+	f.respData = nil
+}
+
+func (f *responseCacheFilter) OnDestroy() {}
@@ -0,0 +1,145 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type mockStreamReceiverFilterHandler struct {
+	types.StreamReceiverFilterHandler
+	headers   types.HeaderMap
+	data      string
+	endStream bool
+}
+
+func (cb *mockStreamReceiverFilterHandler) Route() types.Route {
+	return nil
+}
+
+func (cb *mockStreamReceiverFilterHandler) AppendHeaders(headers types.HeaderMap, endStream bool) {
+	cb.headers = headers
+	cb.endStream = endStream
+}
+
+func (cb *mockStreamReceiverFilterHandler) AppendData(buf types.IoBuffer, endStream bool) {
+	cb.data = buf.String()
+	cb.endStream = endStream
+}
+
+func init() {
+	log.InitDefaultLogger("", log.DEBUG)
+}
+
+func TestResponseCacheLRU(t *testing.T) {
+	c := newResponseCache(2)
+	now := time.Now()
+	keys := []cacheKey{{service: "s1"}, {service: "s2"}, {service: "s3"}}
+
+	c.put(&cacheEntry{key: keys[0], expire: now.Add(time.Second)})
+	c.put(&cacheEntry{key: keys[1], expire: now.Add(time.Second)})
+	// s1 is used recently, s2 is evicted
+	c.get(keys[0], now)
+	c.put(&cacheEntry{key: keys[2], expire: now.Add(time.Second)})
+	if _, ok := c.get(keys[1], now); ok || c.len() != 2 {
+		t.Errorf("expect the least recently used entry evicted, got %d entries", c.len())
+	}
+	if _, ok := c.get(keys[0], now); !ok {
+		t.Error("expect the recently used entry kept")
+	}
+
+	// expired entries are removed on get
+	if _, ok := c.get(keys[2], now.Add(time.Second)); ok || c.len() != 1 {
+		t.Errorf("expect the expired entry removed, got %d entries", c.len())
+	}
+}
+
+func TestResponseCacheFilter(t *testing.T) {
+	f, err := newFilterConfigFactory(&v2.StreamResponseCache{
+		MaxEntries: 10,
+		TTL:        v2.DurationConfig{Duration: time.Minute},
+		Methods:    map[string][]string{"config.service": {"get"}},
+	})
+	if err != nil {
+		t.Fatalf("create factory failed: %v", err)
+	}
+	sc := f.services["config.service"]
+	hitBase, missBase := sc.hit.Count(), sc.miss.Count()
+
+	request := func(method, body string) (*responseCacheFilter, *mockStreamReceiverFilterHandler, bool) {
+		handler := &mockStreamReceiverFilterHandler{}
+		filter := newResponseCacheFilter(nil, f.cache, f.ttl, f.services)
+		filter.SetReceiveFilterHandler(handler)
+		headers := protocol.CommonHeader{models.SERVICE_KEY: "config.service", models.TARGET_METHOD: method}
+		if filter.OnReceiveHeaders(headers, false) == types.StreamHeadersFilterContinue {
+			return filter, handler, false
+		}
+		return filter, handler, filter.OnReceiveData(buffer.NewIoBufferString(body), true) == types.StreamDataFilterStop
+	}
+	respond := func(filter *responseCacheFilter, status int16, body string) {
+		resp := &sofarpc.BoltResponse{
+			ResponseStatus: status,
+			ResponseHeader: map[string]string{"result": "ok"},
+		}
+		filter.AppendHeaders(resp, false)
+		filter.AppendData(buffer.NewIoBufferString(body), true)
+	}
+
+	// the failed response is not cached
+	filter, _, served := request("get", "key1")
+	if served {
+		t.Fatal("expect a miss on the empty cache")
+	}
+	respond(filter, sofarpc.RESPONSE_STATUS_SERVER_EXCEPTION, "error")
+	if f.cache.len() != 0 {
+		t.Fatal("expect the failed response not cached")
+	}
+
+	filter, _, _ = request("get", "key1")
+	respond(filter, sofarpc.RESPONSE_STATUS_SUCCESS, "value1")
+
+	_, handler, served := request("get", "key1")
+	if !served || handler.data != "value1" || !handler.endStream {
+		t.Fatalf("expect the cached response replied, got %q, end %v", handler.data, handler.endStream)
+	}
+	if v, _ := handler.headers.Get("result"); v != "ok" {
+		t.Errorf("expect the cached headers replied, got %v", handler.headers)
+	}
+
+	// the request body is in the key
+	if _, _, served := request("get", "key2"); served {
+		t.Error("expect a miss on a different body")
+	}
+	// only the idempotent methods are cached
+	if filter, _, _ := request("set", "key1"); filter.hash != nil || filter.missed {
+		t.Error("expect the non-idempotent method not cached")
+	}
+
+	if hits, misses := sc.hit.Count()-hitBase, sc.miss.Count()-missBase; hits != 1 || misses != 3 {
+		t.Errorf("expect 1 hit and 3 misses, got %d hits, %d misses", hits, misses)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servicelimit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/filter/stream/commonrule/limit"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	"github.com/rcrowley/go-metrics"
+)
+
+// serviceLimiter is the token bucket of a service
+type serviceLimiter struct {
+	limiter   *limit.RateLimiter
+	allowed   metrics.Counter
+	throttled metrics.Counter
+}
+
+func makeServiceLimiters(cfg *v2.StreamServiceLimit) (map[string]*serviceLimiter, error) {
+	limiters := make(map[string]*serviceLimiter, len(cfg.Services))
+	for service, c := range cfg.Services {
+		if c.QPS <= 0 {
+			return nil, fmt.Errorf("invalid qps %d of service %s", c.QPS, service)
+		}
+		// burst defaults to qps, at least one request is allowed in a burst
+		burstRatio := 1.0
+		if c.Burst > 0 {
+			burstRatio = float64(c.Burst) / float64(c.QPS)
+		}
+		limiter, err := limit.NewRateLimiter(c.QPS, 1000, burstRatio)
+		if err != nil {
+			return nil, err
+		}
+		s := stats.NewServiceLimitStats(service)
+		limiters[service] = &serviceLimiter{
+			limiter:   limiter,
+			allowed:   s.Counter(stats.ServiceLimitAllowed),
+			throttled: s.Counter(stats.ServiceLimitThrottled),
+		}
+	}
+	return limiters, nil
+}
+
+// tryAcquire is safe for concurrent use, the rate limiter is locked
+func (l *serviceLimiter) tryAcquire() bool {
+	if l.limiter.TryAcquire() {
+		l.allowed.Inc(1)
+		return true
+	}
+	l.throttled.Inc(1)
+	return false
+}
+
+// serviceLimitFilter is an implement of types.StreamReceiverFilter
+type serviceLimitFilter struct {
+	handler  types.StreamReceiverFilterHandler
+	limiters map[string]*serviceLimiter
+}
+
+func NewFilter(ctx context.Context, limiters map[string]*serviceLimiter) types.StreamReceiverFilter {
+	return &serviceLimitFilter{
+		limiters: limiters,
+	}
+}
+
+func (f *serviceLimitFilter) SetReceiveFilterHandler(handler types.StreamReceiverFilterHandler) {
+	f.handler = handler
+}
+
+func (f *serviceLimitFilter) OnReceiveHeaders(headers types.HeaderMap, endStream bool) types.StreamHeadersFilterStatus {
+	service, ok := headers.Get(models.SERVICE_KEY)
+	if !ok {
+		return types.StreamHeadersFilterContinue
+	}
+	l, ok := f.limiters[service]
+	if !ok || l.tryAcquire() {
+		return types.StreamHeadersFilterContinue
+	}
+	log.DefaultLogger.Debugf("request of service %s is throttled", service)
+	f.handler.RequestInfo().SetResponseFlag(types.RateLimited)
+	f.handler.SendHijackReply(types.ServiceLimitedCode, headers)
+	return types.StreamHeadersFilterStop
+}
+
+func (f *serviceLimitFilter) OnReceiveData(buf types.IoBuffer, endStream bool) types.StreamDataFilterStatus {
+	return types.StreamDataFilterContinue
+}
+
+func (f *serviceLimitFilter) OnReceiveTrailers(trailers types.HeaderMap) types.StreamTrailersFilterStatus {
+	return types.StreamTrailersFilterContinue
+}
+
+func (f *serviceLimitFilter) OnDestroy() {}
@@ -0,0 +1,141 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servicelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type mockStreamReceiverFilterHandler struct {
+	types.StreamReceiverFilterHandler
+	info       *mockRequestInfo
+	hijackCode int
+}
+
+func (cb *mockStreamReceiverFilterHandler) RequestInfo() types.RequestInfo {
+	return cb.info
+}
+
+func (cb *mockStreamReceiverFilterHandler) SendHijackReply(code int, headers types.HeaderMap) {
+	cb.hijackCode = code
+}
+
+type mockRequestInfo struct {
+	types.RequestInfo
+	flag types.ResponseFlag
+}
+
+func (info *mockRequestInfo) SetResponseFlag(flag types.ResponseFlag) {
+	info.flag = flag
+}
+
+func init() {
+	log.InitDefaultLogger("", log.DEBUG)
+}
+
+func TestServiceLimit(t *testing.T) {
+	limiters, err := makeServiceLimiters(&v2.StreamServiceLimit{
+		Services: map[string]v2.ServiceLimit{
+			"limited.service": {QPS: 1, Burst: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("make service limiters failed: %v", err)
+	}
+	allowedBase := limiters["limited.service"].allowed.Count()
+	throttledBase := limiters["limited.service"].throttled.Count()
+
+	// filters of different connections share the limiter
+	receive := func(service string) (types.StreamHeadersFilterStatus, *mockStreamReceiverFilterHandler) {
+		handler := &mockStreamReceiverFilterHandler{info: &mockRequestInfo{}}
+		f := NewFilter(nil, limiters)
+		f.SetReceiveFilterHandler(handler)
+		return f.OnReceiveHeaders(protocol.CommonHeader{models.SERVICE_KEY: service}, false), handler
+	}
+
+	if status, _ := receive("limited.service"); status != types.StreamHeadersFilterContinue {
+		t.Fatal("the first request should be allowed")
+	}
+	status, handler := receive("limited.service")
+	if status != types.StreamHeadersFilterStop || handler.hijackCode != types.ServiceLimitedCode || handler.info.flag != types.RateLimited {
+		t.Errorf("the second request should be throttled, status %v, code %d", status, handler.hijackCode)
+	}
+	// other services are not limited
+	for i := 0; i < 10; i++ {
+		if status, _ := receive("other.service"); status != types.StreamHeadersFilterContinue {
+			t.Fatal("service not in config should not be limited")
+		}
+	}
+
+	l := limiters["limited.service"]
+	if l.allowed.Count()-allowedBase != 1 || l.throttled.Count()-throttledBase != 1 {
+		t.Errorf("unexpected stats, allowed %d, throttled %d", l.allowed.Count(), l.throttled.Count())
+	}
+}
+
+func TestServiceLimitConcurrency(t *testing.T) {
+	limiters, err := makeServiceLimiters(&v2.StreamServiceLimit{
+		Services: map[string]v2.ServiceLimit{
+			"concurrent.service": {QPS: 10},
+		},
+	})
+	if err != nil {
+		t.Fatalf("make service limiters failed: %v", err)
+	}
+	l := limiters["concurrent.service"]
+	// stats are kept globally, counts from the delta
+	allowedBase, throttledBase := l.allowed.Count(), l.throttled.Count()
+
+	var allowed int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.tryAcquire() {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	// the bucket is empty at start, only a few requests can pass in such a short time
+	if allowed < 1 || allowed > 10 {
+		t.Errorf("unexpected allowed requests: %d", allowed)
+	}
+	if l.allowed.Count()-allowedBase != allowed || l.throttled.Count()-throttledBase != 100-allowed {
+		t.Errorf("unexpected stats, allowed %d, throttled %d", l.allowed.Count(), l.throttled.Count())
+	}
+}
+
+func TestInvalidServiceLimit(t *testing.T) {
+	if _, err := makeServiceLimiters(&v2.StreamServiceLimit{
+		Services: map[string]v2.ServiceLimit{
+			"invalid.service": {QPS: 0},
+		},
+	}); err == nil {
+		t.Error("zero qps should be invalid")
+	}
+}
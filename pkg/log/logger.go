@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/alipay/sofa-mosn/pkg/types"
 	"github.com/hashicorp/go-syslog"
@@ -53,7 +54,7 @@ func init() {
 	//use console  as start logger
 	StartLogger = &logger{
 		Output:  "",
-		Level:   INFO,
+		level:   uint32(INFO),
 		Roller:  DefaultRoller(),
 		fileMux: new(sync.RWMutex),
 	}
@@ -68,7 +69,7 @@ type logger struct {
 	*log.Logger
 
 	Output  string
-	Level   Level
+	level   uint32 // accessed atomically, so that it can be changed at runtime
 	Roller  *Roller
 	writer  io.Writer
 	fileMux *sync.RWMutex
@@ -79,7 +80,7 @@ type logger struct {
 func InitDefaultLogger(output string, level Level) error {
 	DefaultLogger = &logger{
 		Output:  output,
-		Level:   level,
+		level:   uint32(level),
 		Roller:  DefaultRoller(),
 		fileMux: new(sync.RWMutex),
 	}
@@ -109,7 +110,7 @@ func ByContext(ctx context.Context) Logger {
 // get logger instance which has the same 'output' and 'level'
 func GetLoggerInstance(output string, level Level) (Logger, error) {
 	for _, logger := range loggers {
-		if logger.Output == output && logger.Level == level {
+		if logger.Output == output && logger.GetLevel() == level {
 			return logger, nil
 		}
 	}
@@ -121,7 +122,7 @@ func GetLoggerInstance(output string, level Level) (Logger, error) {
 func NewLogger(output string, level Level) (Logger, error) {
 	logger := &logger{
 		Output:  output,
-		Level:   level,
+		level:   uint32(level),
 		Roller:  DefaultRoller(),
 		fileMux: new(sync.RWMutex),
 	}
@@ -182,6 +183,16 @@ selectwriter:
 	return nil
 }
 
+// GetLevel returns the current level of the logger
+func (l *logger) GetLevel() Level {
+	return Level(atomic.LoadUint32(&l.level))
+}
+
+// SetLevel changes the level of the logger, it takes effect on the running goroutines immediately
+func (l *logger) SetLevel(level Level) {
+	atomic.StoreUint32(&l.level, uint32(level))
+}
+
 func (l *logger) Println(args ...interface{}) {
 	l.fileMux.RLock()
 	l.Logger.Println(args...)
@@ -201,37 +212,37 @@ func (l *logger) SetFlags(flag int) {
 }
 
 func (l *logger) Infof(format string, args ...interface{}) {
-	if l.Level >= INFO {
+	if l.GetLevel() >= INFO {
 		l.Printf(InfoPre+format, args...)
 	}
 }
 
 func (l *logger) Debugf(format string, args ...interface{}) {
-	if l.Level >= DEBUG {
+	if l.GetLevel() >= DEBUG {
 		l.Printf(DebugPre+format, args...)
 	}
 }
 
 func (l *logger) Warnf(format string, args ...interface{}) {
-	if l.Level >= WARN {
+	if l.GetLevel() >= WARN {
 		l.Printf(WarnPre+format, args...)
 	}
 }
 
 func (l *logger) Errorf(format string, args ...interface{}) {
-	if l.Level >= ERROR {
+	if l.GetLevel() >= ERROR {
 		l.Printf(ErrorPre+format, args...)
 	}
 }
 
 func (l *logger) Tracef(format string, args ...interface{}) {
-	if l.Level >= TRACE {
+	if l.GetLevel() >= TRACE {
 		l.Printf(TracePre+format, args...)
 	}
 }
 
 func (l *logger) Fatalf(format string, args ...interface{}) {
-	if l.Level >= FATAL {
+	if l.GetLevel() >= FATAL {
 		l.Printf(FatalPre+format, args...)
 	}
 }
@@ -0,0 +1,249 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package log
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// ErrUnknownModule is returned when the level of an unregistered module is changed
+var ErrUnknownModule = errors.New("unknown log module")
+
+// followDefault is the module level that follows the level of the DefaultLogger
+const followDefault = -1
+
+// modules are the loggers that can be adjusted separately from the DefaultLogger
+var modules = struct {
+	sync.RWMutex
+	loggers  map[string]*moduleLogger
+	external map[string]*externalModule
+}{
+	loggers:  make(map[string]*moduleLogger),
+	external: make(map[string]*externalModule),
+}
+
+// externalModule is a module logged by a library with its own logger
+type externalModule struct {
+	setter func(level string)
+	level  string
+}
+
+// ModuleLogger returns the logger of the module, the logs are written to the DefaultLogger.
+// The level follows the DefaultLogger until it is set by SetModuleLevel
+func ModuleLogger(name string) Logger {
+	modules.RLock()
+	l, ok := modules.loggers[name]
+	modules.RUnlock()
+	if ok {
+		return l
+	}
+
+	modules.Lock()
+	defer modules.Unlock()
+
+	if l, ok := modules.loggers[name]; ok {
+		return l
+	}
+	l = &moduleLogger{
+		module: &module{
+			name:  name,
+			level: followDefault,
+		},
+	}
+	modules.loggers[name] = l
+	return l
+}
+
+// ModuleByContext returns the logger of the module writing to the logger in the context, e.g. the
+// listener logger, the level follows that logger until it is set by SetModuleLevel.
+// The DefaultLogger is written if there is no logger in the context
+func ModuleByContext(ctx context.Context, name string) Logger {
+	l := ModuleLogger(name).(*moduleLogger)
+	if ctx != nil {
+		if base, ok := ctx.Value(types.ContextKeyLogger).(Logger); ok {
+			return &moduleLogger{
+				module: l.module,
+				base:   base,
+			}
+		}
+	}
+	return l
+}
+
+// RegisterModule registers a module logged by a library, setter is called with the level name
+// when the module level is changed, and with an empty name when it is reset, e.g.
+// log.RegisterModule("zk", zk.SetLogLevel)
+func RegisterModule(name string, setter func(level string)) {
+	modules.Lock()
+	defer modules.Unlock()
+
+	modules.external[name] = &externalModule{
+		setter: setter,
+	}
+}
+
+// SetModuleLevel changes the level of the module at runtime
+func SetModuleLevel(name string, level Level) error {
+	modules.Lock()
+	defer modules.Unlock()
+
+	if l, ok := modules.loggers[name]; ok {
+		atomic.StoreInt32(&l.level, int32(level))
+		return nil
+	}
+	if m, ok := modules.external[name]; ok {
+		m.level = level.String()
+		m.setter(m.level)
+		return nil
+	}
+	return ErrUnknownModule
+}
+
+// ResetModuleLevel makes the module level follow the DefaultLogger again,
+// the external module restores its own configured level
+func ResetModuleLevel(name string) error {
+	modules.Lock()
+	defer modules.Unlock()
+
+	if l, ok := modules.loggers[name]; ok {
+		atomic.StoreInt32(&l.level, followDefault)
+		return nil
+	}
+	if m, ok := modules.external[name]; ok {
+		m.level = ""
+		m.setter("")
+		return nil
+	}
+	return ErrUnknownModule
+}
+
+// ModuleLevels returns the level names set to the modules, empty name means the level is not set
+func ModuleLevels() map[string]string {
+	modules.RLock()
+	defer modules.RUnlock()
+
+	levels := make(map[string]string, len(modules.loggers)+len(modules.external))
+	for name, l := range modules.loggers {
+		if level := atomic.LoadInt32(&l.level); level != followDefault {
+			levels[name] = Level(level).String()
+		} else {
+			levels[name] = ""
+		}
+	}
+	for name, m := range modules.external {
+		levels[name] = m.level
+	}
+	return levels
+}
+
+// exit is replaced in tests
+var exit = os.Exit
+
+// module is the level shared by the loggers of a module
+type module struct {
+	name  string
+	level int32 // accessed atomically, followDefault or a Level
+}
+
+// moduleLogger writes to the base logger with the module level, nil base is the DefaultLogger
+type moduleLogger struct {
+	*module
+	base Logger
+}
+
+func (l *moduleLogger) out() Logger {
+	if l.base != nil {
+		return l.base
+	}
+	return DefaultLogger
+}
+
+func (l *moduleLogger) enabled(level Level) bool {
+	if moduleLevel := atomic.LoadInt32(&l.level); moduleLevel != followDefault {
+		return Level(moduleLevel) >= level
+	}
+	if base, ok := l.out().(interface {
+		GetLevel() Level
+	}); ok {
+		return base.GetLevel() >= level
+	}
+	return true
+}
+
+func (l *moduleLogger) Println(args ...interface{}) {
+	l.out().Println(args...)
+}
+
+func (l *moduleLogger) Printf(format string, args ...interface{}) {
+	l.out().Printf(format, args...)
+}
+
+func (l *moduleLogger) Infof(format string, args ...interface{}) {
+	if l.enabled(INFO) {
+		l.Printf(InfoPre+format, args...)
+	}
+}
+
+func (l *moduleLogger) Debugf(format string, args ...interface{}) {
+	if l.enabled(DEBUG) {
+		l.Printf(DebugPre+format, args...)
+	}
+}
+
+func (l *moduleLogger) Warnf(format string, args ...interface{}) {
+	if l.enabled(WARN) {
+		l.Printf(WarnPre+format, args...)
+	}
+}
+
+func (l *moduleLogger) Errorf(format string, args ...interface{}) {
+	if l.enabled(ERROR) {
+		l.Printf(ErrorPre+format, args...)
+	}
+}
+
+func (l *moduleLogger) Tracef(format string, args ...interface{}) {
+	if l.enabled(TRACE) {
+		l.Printf(TracePre+format, args...)
+	}
+}
+
+// Fatalf writes the log regardless of the level and exits, as the Fatal logs of the standard logger do
+func (l *moduleLogger) Fatalf(format string, args ...interface{}) {
+	l.Printf(FatalPre+format, args...)
+	exit(1)
+}
+
+// Close and Reopen are done by the DefaultLogger
+func (l *moduleLogger) Close() error {
+	return nil
+}
+
+func (l *moduleLogger) Reopen() error {
+	return nil
+}
+
+func (l *moduleLogger) SetFlags(flag int) {
+	l.out().SetFlags(flag)
+}
@@ -0,0 +1,156 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func newBufferLogger(level Level) (*logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	return &logger{
+		Logger:  log.New(buf, "", 0),
+		level:   uint32(level),
+		fileMux: new(sync.RWMutex),
+	}, buf
+}
+
+func TestModuleLogger(t *testing.T) {
+	defaultLogger := DefaultLogger
+	defer func() {
+		DefaultLogger = defaultLogger
+	}()
+	l, buf := newBufferLogger(INFO)
+	DefaultLogger = l
+
+	zk := ModuleLogger("test_zk")
+	if ModuleLogger("test_zk") != zk {
+		t.Fatal("module logger should be shared")
+	}
+
+	// follows the default logger
+	zk.Debugf("zk event")
+	if buf.Len() != 0 {
+		t.Errorf("debug log should be dropped, got %s", buf.String())
+	}
+	DefaultLogger.SetLevel(DEBUG)
+	zk.Debugf("zk event")
+	if !strings.Contains(buf.String(), DebugPre+"zk event") {
+		t.Errorf("debug log should be written after default level changed, got %s", buf.String())
+	}
+
+	// module level overrides the default one
+	buf.Reset()
+	if err := SetModuleLevel("test_zk", ERROR); err != nil {
+		t.Fatal(err)
+	}
+	zk.Warnf("zk warn")
+	DefaultLogger.Warnf("default warn")
+	if strings.Contains(buf.String(), "zk warn") || !strings.Contains(buf.String(), "default warn") {
+		t.Errorf("only the module level should be changed, got %s", buf.String())
+	}
+	if levels := ModuleLevels(); levels["test_zk"] != "ERROR" {
+		t.Errorf("unexpected module levels: %v", levels)
+	}
+
+	buf.Reset()
+	if err := ResetModuleLevel("test_zk"); err != nil {
+		t.Fatal(err)
+	}
+	zk.Warnf("zk warn")
+	if !strings.Contains(buf.String(), "zk warn") {
+		t.Errorf("module level should follow the default one after reset, got %s", buf.String())
+	}
+
+	if err := SetModuleLevel("not_registered", DEBUG); err != ErrUnknownModule {
+		t.Errorf("expect ErrUnknownModule, got %v", err)
+	}
+}
+
+func TestExternalModule(t *testing.T) {
+	var levels []string
+	RegisterModule("test_external", func(level string) {
+		levels = append(levels, level)
+	})
+
+	SetModuleLevel("test_external", DEBUG)
+	if ModuleLevels()["test_external"] != "DEBUG" {
+		t.Errorf("unexpected module levels: %v", ModuleLevels())
+	}
+	ResetModuleLevel("test_external")
+	if len(levels) != 2 || levels[0] != "DEBUG" || levels[1] != "" {
+		t.Errorf("unexpected levels set to the external module: %v", levels)
+	}
+}
+
+func TestModuleByContext(t *testing.T) {
+	defaultLogger := DefaultLogger
+	defer func() {
+		DefaultLogger = defaultLogger
+		ResetModuleLevel("test_stream")
+	}()
+	l, buf := newBufferLogger(INFO)
+	DefaultLogger = l
+	listenerLogger, listenerBuf := newBufferLogger(DEBUG)
+
+	stream := ModuleByContext(context.WithValue(context.Background(), types.ContextKeyLogger, listenerLogger), "test_stream")
+	stream.Debugf("stream recv")
+	if buf.Len() != 0 || !strings.Contains(listenerBuf.String(), DebugPre+"stream recv") {
+		t.Errorf("module log should be written to the logger in the context with its level, got %q and %q",
+			buf.String(), listenerBuf.String())
+	}
+
+	// the module level is shared with the module logger
+	listenerBuf.Reset()
+	SetModuleLevel("test_stream", INFO)
+	stream.Debugf("stream recv")
+	if listenerBuf.Len() != 0 {
+		t.Errorf("debug log should be dropped by the module level, got %s", listenerBuf.String())
+	}
+
+	if ModuleByContext(context.Background(), "test_stream") != ModuleLogger("test_stream") {
+		t.Error("module logger should be returned without a logger in the context")
+	}
+}
+
+func TestModuleLoggerFatalf(t *testing.T) {
+	defaultLogger := DefaultLogger
+	defer func() {
+		DefaultLogger = defaultLogger
+		exit = os.Exit
+	}()
+	l, buf := newBufferLogger(INFO)
+	DefaultLogger = l
+	code := -1
+	exit = func(c int) {
+		code = c
+	}
+
+	ModuleLogger("test_fatal").Fatalf("zk fatal")
+	if code != 1 || !strings.Contains(buf.String(), FatalPre+"zk fatal") {
+		t.Errorf("fatal log should be written and exit, got code %d, log %s", code, buf.String())
+	}
+}
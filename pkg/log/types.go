@@ -28,6 +28,22 @@ const (
 	TRACE
 )
 
+var levelNames = map[Level]string{
+	FATAL: "FATAL",
+	ERROR: "ERROR",
+	WARN:  "WARN",
+	INFO:  "INFO",
+	DEBUG: "DEBUG",
+	TRACE: "TRACE",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
 const (
 	InfoPre  string = "[INFO]"
 	DebugPre string = "[DEBUG]"
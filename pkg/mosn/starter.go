@@ -25,24 +25,35 @@ import (
 
 	"github.com/alipay/sofa-mosn/pkg/trace"
 
+	"github.com/alipay/sofa-mosn/pkg/admin"
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/config"
 	_ "github.com/alipay/sofa-mosn/pkg/filter/network/connectionmanager"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/network"
+	"github.com/alipay/sofa-mosn/pkg/registry"
 	"github.com/alipay/sofa-mosn/pkg/router"
 	"github.com/alipay/sofa-mosn/pkg/server"
 	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/stream/sofarpc"
 	"github.com/alipay/sofa-mosn/pkg/types"
 	"github.com/alipay/sofa-mosn/pkg/upstream/cluster"
 	"github.com/alipay/sofa-mosn/pkg/xds"
 )
 
+func init() {
+	// drain the sofarpc connections on the admin drain, the hot upgrade and the shutdown
+	admin.AddDrainer(sofarpc.StartDrain)
+}
+
 // Mosn class which wrapper server
 type Mosn struct {
 	servers        []server.Server
 	clustermanager types.ClusterManager
 	routerManager  types.RouterManager
+	runtimeSampler *stats.RuntimeSampler
+	statsPublisher *stats.Publisher
+	registry       *registry.Registry
 }
 
 // NewMosn
@@ -81,6 +92,8 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 	//cluster manager filter
 	cmf := &clusterManagerFilter{}
 
+	// the zone preferred by the locality load balancer
+	cluster.SetLocalZone(c.ServiceRegistry.ServiceAppInfo.Zone)
 	// parse cluster all in one
 	clusters, clusterMap := config.ParseClusterConfig(c.ClusterManager.Clusters)
 	// create cluster manager
@@ -89,6 +102,19 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 	} else {
 		m.clustermanager = cluster.NewClusterManager(nil, clusters, clusterMap, c.ClusterManager.AutoDiscovery, c.ClusterManager.RegistryUseHealthCheck)
 	}
+	// the upstream connections are closed after the downstream connections are drained
+	server.OnShutdownStage(server.ShutdownCloseUpstream, m.clustermanager.Shutdown)
+
+	// the registry is installed before the features depending on it
+	if len(c.Registry.Address) > 0 {
+		reg, err := registry.New(c.Registry, m.clustermanager)
+		if err != nil {
+			log.StartLogger.Fatalln("connect registry", c.Registry.Address, "error:", err)
+		}
+		m.registry = reg
+		server.OnShutdownStage(server.ShutdownCloseRegistry, reg.Close)
+	}
+	m.statsPublisher = stats.NewRegistryPublisher(c.StatsPublisher.Path, c.StatsPublisher.Interval.Duration)
 
 	// initialize the routerManager
 	m.routerManager = router.NewRouterManager()
@@ -165,6 +191,12 @@ func NewMosn(c *config.MOSNConfig) *Mosn {
 
 // Start mosn's server
 func (m *Mosn) Start() {
+	m.runtimeSampler = stats.NewRuntimeSampler(stats.DefaultRuntimeSampleInterval)
+	m.runtimeSampler.Start()
+	if m.statsPublisher != nil {
+		m.statsPublisher.Start()
+	}
+
 	for _, srv := range m.servers {
 		go srv.Start()
 	}
@@ -175,6 +207,15 @@ func (m *Mosn) Close() {
 	for _, srv := range m.servers {
 		srv.Close()
 	}
+	if m.runtimeSampler != nil {
+		m.runtimeSampler.Stop()
+	}
+	if m.statsPublisher != nil {
+		m.statsPublisher.Stop()
+	}
+	if m.registry != nil {
+		m.registry.Close()
+	}
 	m.clustermanager.Destory()
 }
 
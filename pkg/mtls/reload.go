@@ -0,0 +1,182 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mtls
+
+import (
+	"crypto/x509"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/admin"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/mtls/crypto/tls"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/rcrowley/go-metrics"
+)
+
+// CertWatchInterval is the interval to check the modification of the client certificate files
+var CertWatchInterval = time.Minute
+
+func init() {
+	admin.AddCertReloader(ReloadCertificates)
+}
+
+// certReloader serves the client certificate loaded from the cert/key files, the certificate
+// is reloaded once the files are modified. The new certificate is used by the subsequent handshakes,
+// the established connections keep the old one until they are closed
+type certReloader struct {
+	hooks     ConfigHooks
+	certIndex string
+	keyIndex  string
+
+	cert    atomic.Value // *tls.Certificate
+	mutex   sync.Mutex
+	modTime time.Time
+
+	expiry     metrics.Gauge
+	reloadFail metrics.Counter
+}
+
+// the reloaders are shared by the clusters with the same cert/key files
+var reloaders = struct {
+	mutex     sync.Mutex
+	watchOnce sync.Once
+	files     map[[2]string]*certReloader
+}{
+	files: make(map[[2]string]*certReloader),
+}
+
+// getCertReloader returns the reloader of the cert/key files, nil if the certificate is configured as pem string
+func getCertReloader(hooks ConfigHooks, certIndex, keyIndex string, cert tls.Certificate) *certReloader {
+	if strings.Contains(certIndex, "-----BEGIN") {
+		return nil
+	}
+
+	reloaders.mutex.Lock()
+	defer reloaders.mutex.Unlock()
+
+	key := [2]string{certIndex, keyIndex}
+	if r, ok := reloaders.files[key]; ok {
+		return r
+	}
+
+	s := stats.NewClientCertStats(certIndex)
+	r := &certReloader{
+		hooks:      hooks,
+		certIndex:  certIndex,
+		keyIndex:   keyIndex,
+		modTime:    lastModTime(certIndex, keyIndex),
+		expiry:     s.Gauge(stats.CertExpiryTime),
+		reloadFail: s.Counter(stats.CertReloadFail),
+	}
+	r.store(&cert)
+	reloaders.files[key] = r
+	reloaders.watchOnce.Do(func() {
+		go watchCertificates()
+	})
+
+	return r
+}
+
+// ReloadCertificates reloads all the client certificates from the files
+func ReloadCertificates() {
+	for _, r := range allReloaders() {
+		r.reload()
+	}
+}
+
+func allReloaders() []*certReloader {
+	reloaders.mutex.Lock()
+	defer reloaders.mutex.Unlock()
+
+	all := make([]*certReloader, 0, len(reloaders.files))
+	for _, r := range reloaders.files {
+		all = append(all, r)
+	}
+	return all
+}
+
+func watchCertificates() {
+	ticker := time.NewTicker(CertWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, r := range allReloaders() {
+			r.reloadIfModified()
+		}
+	}
+}
+
+// GetClientCertificate is the tls.Config.GetClientCertificate callback
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load().(*tls.Certificate), nil
+}
+
+func (r *certReloader) reloadIfModified() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if lastModTime(r.certIndex, r.keyIndex).After(r.modTime) {
+		r.doReload()
+	}
+}
+
+func (r *certReloader) reload() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.doReload()
+}
+
+// doReload loads the certificate from the files, the current one is kept if the files are invalid
+func (r *certReloader) doReload() {
+	modTime := lastModTime(r.certIndex, r.keyIndex)
+	cert, err := r.hooks.GetCertificate(r.certIndex, r.keyIndex)
+	if err != nil {
+		// the files may be half written, retry on next modification or reload signal
+		log.DefaultLogger.Errorf("reload client certificate %s failed: %v", r.certIndex, err)
+		r.reloadFail.Inc(1)
+		return
+	}
+	r.modTime = modTime
+	r.store(&cert)
+	log.DefaultLogger.Infof("client certificate %s reloaded", r.certIndex)
+}
+
+func (r *certReloader) store(cert *tls.Certificate) {
+	r.cert.Store(cert)
+	if len(cert.Certificate) == 0 {
+		return
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		r.expiry.Update(leaf.NotAfter.Unix())
+	}
+}
+
+// lastModTime returns the latest modification time of the files
+func lastModTime(files ...string) time.Time {
+	var modTime time.Time
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
@@ -0,0 +1,95 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mtls
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+)
+
+func TestClientCertificateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mosn_cert_reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeCert := func(commonName string) []byte {
+		info := &certInfo{
+			CommonName: commonName,
+			Curve:      "P256",
+		}
+		cfg, err := info.CreateCertConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(certFile, []byte(cfg.CertChain), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(keyFile, []byte(cfg.PrivateKey), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := DefaultConfigHooks().GetCertificate(certFile, keyFile)
+		return cert.Certificate[0]
+	}
+
+	first := writeCert("first")
+	mgr, err := NewTLSClientContextManager(&v2.TLSConfig{
+		Status:       true,
+		CertChain:    certFile,
+		PrivateKey:   keyFile,
+		InsecureSkip: true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("create client context manager failed %v", err)
+	}
+	getCert := mgr.Config().GetClientCertificate
+	if getCert == nil {
+		t.Fatal("client certificate in files should be reloadable")
+	}
+	if cert, _ := getCert(nil); !bytes.Equal(cert.Certificate[0], first) {
+		t.Error("expect the loaded certificate")
+	}
+	r := reloaders.files[[2]string{certFile, keyFile}]
+	if r.expiry.Value() <= 0 {
+		t.Error("expect the certificate expiry exposed")
+	}
+
+	second := writeCert("second")
+	ReloadCertificates()
+	if cert, _ := getCert(nil); !bytes.Equal(cert.Certificate[0], second) {
+		t.Error("expect the rotated certificate after reload")
+	}
+
+	// broken files keep the current certificate
+	ioutil.WriteFile(keyFile, []byte("broken"), 0644)
+	ReloadCertificates()
+	if cert, _ := getCert(nil); !bytes.Equal(cert.Certificate[0], second) {
+		t.Error("expect the current certificate kept")
+	}
+	if r.reloadFail.Count() != 1 {
+		t.Errorf("expect 1 reload failure, got %d", r.reloadFail.Count())
+	}
+}
@@ -182,6 +182,12 @@ func (mgr *contextManager) newTLSConfig(c *v2.TLSConfig) (*tls.Config, error) {
 		}
 	case nil:
 		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+		// the client certificate in files can be rotated without restart
+		if mgr.isClient {
+			if reloader := getCertReloader(hooks, c.CertChain, c.PrivateKey, cert); reloader != nil {
+				tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+			}
+		}
 	default: //other error
 		return nil, ErrorGetCertificateFailed
 	}
@@ -195,6 +201,8 @@ func (mgr *contextManager) newTLSConfig(c *v2.TLSConfig) (*tls.Config, error) {
 	if mgr.isClient {
 		tlsConfig.ServerName = c.ServerName
 		tlsConfig.RootCAs = pool
+		// the sessions are resumed on reconnecting to the same host, without a full handshake
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
 		verify := hooks.VerifyPeerCertificate()
 		if verify != nil {
 			// use self verify, skip normal verify
@@ -307,7 +315,14 @@ func (mgr *contextManager) Conn(c net.Conn) net.Conn {
 		return c
 	}
 	if mgr.isClient {
-		return getTLSConn(c, mgr.Config(), mgr.isClient)
+		config := mgr.Config()
+		// no server name configured, the SNI and the verification use the upstream host
+		if config.ServerName == "" {
+			if host, _, err := net.SplitHostPort(c.RemoteAddr().String()); err == nil {
+				config.ServerName = host
+			}
+		}
+		return getTLSConn(c, config, mgr.isClient)
 	}
 	if !mgr.inspector {
 		return getTLSConn(c, mgr.Config(), mgr.isClient)
@@ -339,6 +339,62 @@ func TestVerifyClient(t *testing.T) {
 
 }
 
+// TestClientSessionResumption tests the client verifies the upstream host without server name configured,
+// and resumes the session on reconnecting
+func TestClientSessionResumption(t *testing.T) {
+	info := &certInfo{
+		CommonName: "test",
+		Curve:      "P256",
+	}
+	cfg, err := info.CreateCertConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := &v2.Listener{}
+	lc.FilterChains = []v2.FilterChain{
+		{
+			TLS: *cfg,
+		},
+	}
+	ctxMng, err := NewTLSServerContextManager(lc, nil, log.StartLogger)
+	if err != nil {
+		t.Fatalf("create context manager failed %v", err)
+	}
+	server := MockServer{
+		Mng: ctxMng,
+		t:   t,
+	}
+	server.GoListenAndServe(t)
+	defer server.Close()
+	time.Sleep(time.Second) //wait server start
+
+	cltMng, err := NewTLSClientContextManager(&v2.TLSConfig{
+		Status: true,
+		CACert: cfg.CACert,
+	}, nil)
+	if err != nil {
+		t.Fatalf("create client context manager failed %v", err)
+	}
+	handshake := func() bool {
+		c, err := net.Dial("tcp", server.Addr)
+		if err != nil {
+			t.Fatalf("request server error %v", err)
+		}
+		defer c.Close()
+		tlsConn := cltMng.Conn(c).(*TLSConn)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Fatalf("request tls handshake error %v", err)
+		}
+		return tlsConn.ConnectionState().DidResume
+	}
+	if handshake() {
+		t.Error("the first handshake should not be resumed")
+	}
+	if !handshake() {
+		t.Error("the session should be resumed on reconnecting")
+	}
+}
+
 // TestInspector tests context manager support both tls and non-tls
 func TestInspector(t *testing.T) {
 	info := &certInfo{
@@ -28,6 +28,7 @@ import (
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/buffer"
@@ -56,6 +57,7 @@ type connection struct {
 	readEnabled          bool
 	readEnabledChan      chan bool
 	readDisableCount     int
+	readDisableMux       sync.Mutex
 	localAddressRestored bool
 	bufferLimit          uint32 // todo: support soft buffer limit
 	rawConnection        net.Conn
@@ -69,6 +71,7 @@ type connection struct {
 	stopChan           chan struct{}
 	curWriteBufferData []types.IoBuffer
 	readBuffer         types.IoBuffer
+	readBufferSize     int
 	writeBuffers       net.Buffers
 	ioBuffers          []types.IoBuffer
 	writeBufferChan    chan *[]types.IoBuffer
@@ -84,6 +87,13 @@ type connection struct {
 	lastBytesSizeRead  int64
 	lastWriteSizeWrite int64
 
+	// watermarks of the bytes pending write, zero high watermark disables the watermark events
+	writeHighWatermark int64
+	writeLowWatermark  int64
+	pendingWriteBytes  int64
+	aboveHighWatermark bool
+	watermarkMux       sync.Mutex
+
 	closed    uint32
 	startOnce sync.Once
 	eventLoop *eventLoop
@@ -170,17 +180,19 @@ func (c *connection) attachEventLoop(lctx context.Context) {
 					if te, ok := err.(net.Error); ok && te.Timeout() {
 						if c.readBuffer != nil && c.readBuffer.Len() == 0 {
 							c.readBuffer.Free()
-							c.readBuffer.Alloc(DefaultBufferReadCapacity)
+							c.readBuffer.Alloc(c.readBufferCapacity())
 						}
 						return true
 					}
 
-					if err == io.EOF {
+					if isPeerClosed(err) {
 						c.Close(types.NoFlush, types.RemoteClose)
-					} else {
-						c.Close(types.NoFlush, types.OnReadErrClose)
+						c.logger.Debugf("Closed by peer on read. Connection = %d, Remote Address = %s, err = %s",
+							c.id, c.RemoteAddr().String(), err)
+						return false
 					}
 
+					c.Close(types.NoFlush, types.OnReadErrClose)
 					c.logger.Errorf("Error on read. Connection = %d, Remote Address = %s, err = %s",
 						c.id, c.RemoteAddr().String(), err)
 
@@ -317,16 +329,18 @@ func (c *connection) startReadLoop() {
 					if te, ok := err.(net.Error); ok && te.Timeout() {
 						if c.readBuffer != nil && c.readBuffer.Len() == 0 {
 							c.readBuffer.Free()
-							c.readBuffer.Alloc(DefaultBufferReadCapacity)
+							c.readBuffer.Alloc(c.readBufferCapacity())
 						}
 						continue
 					}
-					if err == io.EOF {
+					if isPeerClosed(err) {
 						c.Close(types.NoFlush, types.RemoteClose)
-					} else {
-						c.Close(types.NoFlush, types.OnReadErrClose)
+						c.logger.Debugf("Closed by peer on read. Connection = %d, Local Address = %s, Remote Address = %s, err = %s",
+							c.id, c.rawConnection.LocalAddr().String(), c.RemoteAddr().String(), err)
+						return
 					}
 
+					c.Close(types.NoFlush, types.OnReadErrClose)
 					c.logger.Errorf("Error on read. Connection = %d, Local Address = %s, Remote Address = %s, err = %s",
 						c.id, c.rawConnection.LocalAddr().String(), c.RemoteAddr().String(), err)
 
@@ -349,9 +363,23 @@ transfer:
 	c.transferChan <- id
 }
 
+// isPeerClosed returns true if the read error means the peer has closed or reset the connection,
+// e.g. a client behind NAT going away, which is a normal disconnect rather than a read error
+func isPeerClosed(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.ECONNRESET || sysErr.Err == syscall.EPIPE
+		}
+	}
+	return false
+}
+
 func (c *connection) doRead() (err error) {
 	if c.readBuffer == nil {
-		c.readBuffer = buffer.GetIoBuffer(DefaultBufferReadCapacity)
+		c.readBuffer = buffer.GetIoBuffer(c.readBufferCapacity())
 	}
 
 	var bytesRead int64
@@ -419,6 +447,8 @@ func (c *connection) Write(buffers ...types.IoBuffer) error {
 		return nil
 	}
 
+	c.addPendingWriteBytes(buffers)
+
 	if c.internalLoopStarted {
 		c.writeBufferChan <- &buffers
 	} else {
@@ -548,6 +578,9 @@ func (c *connection) doWrite() (int64, error) {
 	bytesSent, err := c.doWriteIo()
 
 	c.updateWriteBuffStats(bytesSent, int64(c.writeBufLen()))
+	if bytesSent > 0 {
+		c.updatePendingWriteBytes(-bytesSent)
+	}
 
 	for _, cb := range c.bytesSendCallbacks {
 		cb(uint64(bytesSent))
@@ -594,6 +627,49 @@ func (c *connection) updateWriteBuffStats(bytesWrite int64, bytesBufSize int64)
 	}
 }
 
+func (c *connection) addPendingWriteBytes(buffers []types.IoBuffer) {
+	if c.writeHighWatermark == 0 {
+		return
+	}
+
+	var size int64
+	for _, buf := range buffers {
+		if buf != nil {
+			size += int64(buf.Len())
+		}
+	}
+	c.updatePendingWriteBytes(size)
+}
+
+// updatePendingWriteBytes raises the watermark events to the connection event listeners when the bytes
+// pending write cross the watermarks. The listeners are called with the watermark lock held, so they
+// should not write to this connection
+func (c *connection) updatePendingWriteBytes(delta int64) {
+	if c.writeHighWatermark == 0 {
+		return
+	}
+
+	c.watermarkMux.Lock()
+	defer c.watermarkMux.Unlock()
+
+	c.pendingWriteBytes += delta
+	var event types.ConnectionEvent
+	if !c.aboveHighWatermark && c.pendingWriteBytes > c.writeHighWatermark {
+		c.aboveHighWatermark = true
+		event = types.WriteBufferAboveHighWatermark
+	} else if c.aboveHighWatermark && c.pendingWriteBytes <= c.writeLowWatermark {
+		c.aboveHighWatermark = false
+		event = types.WriteBufferBelowLowWatermark
+	} else {
+		return
+	}
+
+	c.logger.Debugf("connection %d bytes pending write %d, event %s", c.id, c.pendingWriteBytes, event)
+	for _, cb := range c.connCallbacks {
+		cb.OnEvent(event)
+	}
+}
+
 func (c *connection) writeBufLen() (bufLen int) {
 	for _, buf := range c.writeBuffers {
 		bufLen += len(buf)
@@ -704,6 +780,10 @@ func (c *connection) SetNoDelay(enable bool) {
 }
 
 func (c *connection) SetReadDisable(disable bool) {
+	// read may be disabled by the other connections' goroutines, such as the flow control of the proxy
+	c.readDisableMux.Lock()
+	defer c.readDisableMux.Unlock()
+
 	if disable {
 		if !c.readEnabled {
 			c.readDisableCount++
@@ -719,7 +799,10 @@ func (c *connection) SetReadDisable(disable bool) {
 
 		c.readEnabled = true
 		// only on read disable status, we need to trigger chan to wake read loop up
-		c.readEnabledChan <- true
+		select {
+		case c.readEnabledChan <- true:
+		default:
+		}
 	}
 }
 
@@ -741,6 +824,47 @@ func (c *connection) BufferLimit() uint32 {
 	return c.bufferLimit
 }
 
+func (c *connection) SetReadBufferSize(size uint32) {
+	if size == 0 {
+		return
+	}
+	c.readBufferSize = int(size)
+
+	if tcpConn, ok := c.rawConnection.(*net.TCPConn); ok {
+		if err := tcpConn.SetReadBuffer(int(size)); err != nil {
+			c.logger.Errorf("connection %d set socket receive buffer %d error: %v", c.id, size, err)
+		}
+	}
+}
+
+func (c *connection) SetWriteBufferSize(size uint32) {
+	if size == 0 {
+		return
+	}
+
+	if tcpConn, ok := c.rawConnection.(*net.TCPConn); ok {
+		if err := tcpConn.SetWriteBuffer(int(size)); err != nil {
+			c.logger.Errorf("connection %d set socket send buffer %d error: %v", c.id, size, err)
+		}
+	}
+}
+
+func (c *connection) SetWriteBufferWatermark(high, low uint32) {
+	if low == 0 || low >= high {
+		low = high / 2
+	}
+
+	c.writeHighWatermark = int64(high)
+	c.writeLowWatermark = int64(low)
+}
+
+func (c *connection) readBufferCapacity() int {
+	if c.readBufferSize > 0 {
+		return c.readBufferSize
+	}
+	return DefaultBufferReadCapacity
+}
+
 func (c *connection) SetLocalAddress(localAddress net.Addr, restored bool) {
 	// TODO
 	c.localAddressRestored = restored
@@ -774,7 +898,8 @@ func (c *connection) RawConn() net.Conn {
 type clientConnection struct {
 	connection
 
-	connectOnce sync.Once
+	connectOnce    sync.Once
+	connectTimeout time.Duration
 }
 
 // NewClientConnection new client-side connection
@@ -809,18 +934,22 @@ func NewClientConnection(sourceAddr net.Addr, tlsMng types.TLSContextManager, re
 	return conn
 }
 
+func (cc *clientConnection) SetConnectTimeout(timeout time.Duration) {
+	cc.connectTimeout = timeout
+}
+
 func (cc *clientConnection) Connect(ioEnabled bool) (err error) {
 	cc.connectOnce.Do(func() {
-		var localTCPAddr *net.TCPAddr
+		dialer := net.Dialer{Timeout: cc.connectTimeout}
 
 		if cc.localAddr != nil {
-			localTCPAddr, err = net.ResolveTCPAddr("tcp", cc.localAddr.String())
+			var localTCPAddr *net.TCPAddr
+			if localTCPAddr, err = net.ResolveTCPAddr("tcp", cc.localAddr.String()); err == nil {
+				dialer.LocalAddr = localTCPAddr
+			}
 		}
 
-		var remoteTCPAddr *net.TCPAddr
-		remoteTCPAddr, err = net.ResolveTCPAddr("tcp", cc.remoteAddr.String())
-
-		cc.rawConnection, err = net.DialTCP("tcp", localTCPAddr, remoteTCPAddr)
+		cc.rawConnection, err = dialer.Dial("tcp", cc.remoteAddr.String())
 		var event types.ConnectionEvent
 
 		if err != nil {
@@ -18,9 +18,17 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/buffer"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
@@ -115,3 +123,179 @@ func TestAddBytesSendListener(t *testing.T) {
 		})
 	}
 }
+
+func TestSetReadBufferSize(t *testing.T) {
+	c := &connection{}
+	c.SetReadBufferSize(0)
+	if c.readBufferCapacity() != DefaultBufferReadCapacity {
+		t.Errorf("expect default read buffer capacity, got %d", c.readBufferCapacity())
+	}
+	c.SetReadBufferSize(256 * 1024)
+	if c.readBufferCapacity() != 256*1024 {
+		t.Errorf("expect configured read buffer capacity, got %d", c.readBufferCapacity())
+	}
+}
+
+func TestIsPeerClosed(t *testing.T) {
+	testCases := []struct {
+		err    error
+		closed bool
+	}{
+		{io.EOF, true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.EBADF)}, false},
+		{errors.New("malformed"), false},
+	}
+	for i, tc := range testCases {
+		if closed := isPeerClosed(tc.err); closed != tc.closed {
+			t.Errorf("#%d expect %v for %v, got %v", i, tc.closed, tc.err, closed)
+		}
+	}
+}
+
+type watermarkListener struct {
+	events []types.ConnectionEvent
+}
+
+func (l *watermarkListener) OnEvent(event types.ConnectionEvent) {
+	l.events = append(l.events, event)
+}
+
+func TestWriteBufferWatermark(t *testing.T) {
+	listener := &watermarkListener{}
+	c := &connection{logger: log.DefaultLogger}
+	c.AddConnectionEventListener(listener)
+
+	// disabled by default
+	c.addPendingWriteBytes([]types.IoBuffer{buffer.NewIoBufferBytes(make([]byte, 1024))})
+	if len(listener.events) != 0 {
+		t.Fatalf("expect no events while disabled, got %v", listener.events)
+	}
+
+	c.SetWriteBufferWatermark(100, 0)
+	c.addPendingWriteBytes([]types.IoBuffer{buffer.NewIoBufferBytes(make([]byte, 60)), nil})
+	c.addPendingWriteBytes([]types.IoBuffer{buffer.NewIoBufferBytes(make([]byte, 60))})
+	c.addPendingWriteBytes([]types.IoBuffer{buffer.NewIoBufferBytes(make([]byte, 60))})
+	c.updatePendingWriteBytes(-100)
+	c.updatePendingWriteBytes(-30)
+	c.updatePendingWriteBytes(-30)
+
+	expected := []types.ConnectionEvent{types.WriteBufferAboveHighWatermark, types.WriteBufferBelowLowWatermark}
+	if len(listener.events) != len(expected) {
+		t.Fatalf("expect events %v, got %v", expected, listener.events)
+	}
+	for i := range expected {
+		if listener.events[i] != expected[i] {
+			t.Errorf("expect events %v, got %v", expected, listener.events)
+		}
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// a listener with a full accept queue never answers the handshake
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, _ := syscall.Getsockname(fd)
+	addr := fmt.Sprintf("127.0.0.1:%d", sa.(*syscall.SockaddrInet4).Port)
+	queued, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queued.Close()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	c := NewClientConnection(nil, nil, remoteAddr, nil, log.DefaultLogger)
+	listener := &watermarkListener{}
+	c.AddConnectionEventListener(listener)
+	c.SetConnectTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	c.Connect(false)
+	if len(listener.events) != 1 || listener.events[0] != types.ConnectTimeout {
+		t.Fatalf("expect connect timeout, got %v", listener.events)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("connect is not bounded by the timeout, took %v", elapsed)
+	}
+}
+
+// countingConn counts the reads on the raw connection
+type countingConn struct {
+	net.Conn
+	reads int
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	c.reads++
+	return c.Conn.Read(b)
+}
+
+// benchmarkReadLargeFrames streams 256KB frames through a loopback connection,
+// reads/frame shows how many read syscalls are needed to get a whole frame
+func benchmarkReadLargeFrames(b *testing.B, readBufferSize uint32) {
+	const frameSize = 256 * 1024
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		frame := make([]byte, frameSize)
+		for i := 0; i < b.N; i++ {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	rawc, err := ln.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := NewServerConnection(context.Background(), rawc, nil, log.DefaultLogger).(*connection)
+	defer rawc.Close()
+	c.SetReadBufferSize(readBufferSize)
+	c.SetWriteBufferSize(readBufferSize)
+	counting := &countingConn{Conn: rawc}
+	c.rawConnection = counting
+
+	b.SetBytes(frameSize)
+	b.ResetTimer()
+	for received := 0; received < b.N*frameSize; {
+		if err := c.doRead(); err != nil {
+			if te, ok := err.(net.Error); ok && te.Timeout() {
+				continue
+			}
+			b.Fatal(err)
+		}
+		// consume the whole frames as the codec does
+		frames := c.readBuffer.Len() / frameSize * frameSize
+		c.readBuffer.Drain(frames)
+		received += frames
+	}
+	b.ReportMetric(float64(counting.reads)/float64(b.N), "reads/frame")
+}
+
+func BenchmarkReadLargeFramesDefaultBuffer(b *testing.B) {
+	benchmarkReadLargeFrames(b, 0)
+}
+
+func BenchmarkReadLargeFrames256KBuffer(b *testing.B) {
+	benchmarkReadLargeFrames(b, 256*1024)
+}
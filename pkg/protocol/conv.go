@@ -82,8 +82,22 @@ func RegisterCommonConv(protocol types.Protocol, from, to ProtocolConv) {
 	RegisterConv(protocol, common, to)
 }
 
-// ConvertHeader convert header from source protocol format to destination protocol format
+// ConvertHeader convert header from source protocol format to destination protocol format,
+// header values exceeding the registered HeaderValueLimit are handled by the limit's policy
 func ConvertHeader(ctx context.Context, src, dst types.Protocol, srcHeader types.HeaderMap) (types.HeaderMap, error) {
+	dstHeader, err := convertHeader(ctx, src, dst, srcHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyHeaderValueLimit(src, dst, dstHeader); err != nil {
+		return nil, err
+	}
+
+	return dstHeader, nil
+}
+
+func convertHeader(ctx context.Context, src, dst types.Protocol, srcHeader types.HeaderMap) (types.HeaderMap, error) {
 	// 1. try direct path
 	if sub, subOk := protoConvFactory[src]; subOk {
 		if f, ok := sub[dst]; ok {
@@ -93,8 +107,8 @@ func ConvertHeader(ctx context.Context, src, dst types.Protocol, srcHeader types
 
 	// 2. try common path
 	if src != common && dst != common {
-		if src2Common, serr := ConvertHeader(ctx, src, common, srcHeader); serr == nil {
-			if common2dst, derr := ConvertHeader(ctx, common, dst, src2Common); derr == nil {
+		if src2Common, serr := convertHeader(ctx, src, common, srcHeader); serr == nil {
+			if common2dst, derr := convertHeader(ctx, common, dst, src2Common); derr == nil {
 				return common2dst, derr
 			} else {
 				return nil, derr
@@ -0,0 +1,154 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package protocol
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// HeaderValuePolicy defines how to handle the header value exceeding the destination protocol's limit
+type HeaderValuePolicy int
+
+// header value policy definition
+const (
+	HeaderValueDrop     HeaderValuePolicy = iota // drop the header
+	HeaderValueTruncate                          // truncate the value and append TruncatedMarker
+	HeaderValueReject                            // fail the conversion with ErrHeaderValueTooLarge
+)
+
+// TruncatedMarker is appended to the truncated header value, counted in the limit
+const TruncatedMarker = "...[truncated]"
+
+// default header value limits of the destination protocols
+const (
+	// a header line of the http1 servers is commonly limited to 8KB, e.g. LimitRequestFieldSize of apache
+	DefaultHTTP1HeaderValueLimit = 8190
+	// http2 peers limit the whole header list to 1MB by default, the same as net/http
+	DefaultHTTP2HeaderValueLimit = 1 << 20
+)
+
+var (
+	ErrHeaderValueTooLarge = errors.New("header value exceeds the destination protocol's limit")
+
+	headerValueLimits = make(map[types.Protocol]map[types.Protocol]HeaderValueLimit)
+)
+
+func init() {
+	// the oversized value is rejected by the peer anyway, reject it before forwarding
+	for _, src := range []types.Protocol{SofaRPC, HTTP2} {
+		RegisterHeaderValueLimit(src, HTTP1, HeaderValueLimit{MaxLength: DefaultHTTP1HeaderValueLimit, Policy: HeaderValueReject})
+	}
+	RegisterHeaderValueLimit(SofaRPC, HTTP2, HeaderValueLimit{MaxLength: DefaultHTTP2HeaderValueLimit, Policy: HeaderValueReject})
+}
+
+// HeaderValueLimit is the header value limit while converting from source protocol to destination protocol
+type HeaderValueLimit struct {
+	// MaxLength is the max bytes of a header value, 0 means no limit
+	MaxLength int
+	Policy    HeaderValuePolicy
+}
+
+// RegisterHeaderValueLimit registers header value limit for the conversion from src to dst, it overrides the default.
+// The limit is per direction, src -> dst and dst -> src can be different
+func RegisterHeaderValueLimit(src, dst types.Protocol, limit HeaderValueLimit) {
+	if _, ok := headerValueLimits[src]; !ok {
+		headerValueLimits[src] = make(map[types.Protocol]HeaderValueLimit)
+	}
+
+	headerValueLimits[src][dst] = limit
+}
+
+// GetHeaderValueLimit returns the header value limit for the conversion from src to dst
+func GetHeaderValueLimit(src, dst types.Protocol) (HeaderValueLimit, bool) {
+	limit, ok := headerValueLimits[src][dst]
+	return limit, ok && limit.MaxLength > 0
+}
+
+// CheckHeaderValues returns ErrHeaderValueTooLarge if any header value exceeds the limit from src to dst
+// and the policy is HeaderValueReject
+func CheckHeaderValues(src, dst types.Protocol, headers types.HeaderMap) error {
+	limit, ok := GetHeaderValueLimit(src, dst)
+	if !ok || limit.Policy != HeaderValueReject || headers == nil {
+		return nil
+	}
+
+	var err error
+	headers.Range(func(key, value string) bool {
+		if len(value) > limit.MaxLength {
+			err = ErrHeaderValueTooLarge
+			return false
+		}
+		return true
+	})
+
+	return err
+}
+
+// applyHeaderValueLimit handles the oversized header values in the converted headers
+func applyHeaderValueLimit(src, dst types.Protocol, headers types.HeaderMap) error {
+	limit, ok := GetHeaderValueLimit(src, dst)
+	if !ok || headers == nil {
+		return nil
+	}
+
+	// collect first, header map should not be modified in range
+	var oversized []string
+	headers.Range(func(key, value string) bool {
+		if len(value) > limit.MaxLength {
+			oversized = append(oversized, key)
+		}
+		return true
+	})
+	if len(oversized) == 0 {
+		return nil
+	}
+
+	switch limit.Policy {
+	case HeaderValueReject:
+		return ErrHeaderValueTooLarge
+	case HeaderValueTruncate:
+		for _, key := range oversized {
+			value, _ := headers.Get(key)
+			headers.Set(key, truncateHeaderValue(value, limit.MaxLength))
+		}
+	default:
+		for _, key := range oversized {
+			headers.Del(key)
+		}
+	}
+
+	return nil
+}
+
+// truncateHeaderValue keeps the value valid utf-8 if it is, a rune is never split
+func truncateHeaderValue(value string, maxLength int) string {
+	marker := TruncatedMarker
+	if maxLength <= len(marker) {
+		marker = ""
+	}
+
+	n := maxLength - len(marker)
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+
+	return value[:n] + marker
+}
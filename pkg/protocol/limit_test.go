@@ -0,0 +1,153 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package protocol
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// copyConv copies the header as the conversion result
+type copyConv struct{}
+
+func (c *copyConv) ConvHeader(ctx context.Context, headerMap types.HeaderMap) (types.HeaderMap, error) {
+	return headerMap.Clone(), nil
+}
+
+func (c *copyConv) ConvData(ctx context.Context, buffer types.IoBuffer) (types.IoBuffer, error) {
+	return buffer, nil
+}
+
+func (c *copyConv) ConvTrailer(ctx context.Context, headerMap types.HeaderMap) (types.HeaderMap, error) {
+	return headerMap, nil
+}
+
+func TestConvertOversizedHeaderValue(t *testing.T) {
+	src := types.Protocol("limit-src")
+	dst := types.Protocol("limit-dst")
+	RegisterCommonConv(src, &copyConv{}, &copyConv{})
+	RegisterCommonConv(dst, &copyConv{}, &copyConv{})
+
+	oversized := strings.Repeat("a", 64)
+	newHeaders := func() types.HeaderMap {
+		return CommonHeader{"small": "value", "large": oversized}
+	}
+
+	testCases := []struct {
+		policy HeaderValuePolicy
+		check  func(t *testing.T, headers types.HeaderMap, err error)
+	}{
+		{
+			policy: HeaderValueDrop,
+			check: func(t *testing.T, headers types.HeaderMap, err error) {
+				if err != nil {
+					t.Fatalf("drop policy should not fail: %v", err)
+				}
+				if _, ok := headers.Get("large"); ok {
+					t.Error("oversized header should be dropped")
+				}
+				if v, _ := headers.Get("small"); v != "value" {
+					t.Error("small header should be kept")
+				}
+			},
+		},
+		{
+			policy: HeaderValueTruncate,
+			check: func(t *testing.T, headers types.HeaderMap, err error) {
+				if err != nil {
+					t.Fatalf("truncate policy should not fail: %v", err)
+				}
+				v, _ := headers.Get("large")
+				if len(v) != 32 || !strings.HasSuffix(v, TruncatedMarker) {
+					t.Errorf("unexpected truncated value: %s", v)
+				}
+			},
+		},
+		{
+			policy: HeaderValueReject,
+			check: func(t *testing.T, headers types.HeaderMap, err error) {
+				if err != ErrHeaderValueTooLarge {
+					t.Errorf("expect ErrHeaderValueTooLarge, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		RegisterHeaderValueLimit(src, dst, HeaderValueLimit{MaxLength: 32, Policy: tc.policy})
+		headers, err := ConvertHeader(context.Background(), src, dst, newHeaders())
+		tc.check(t, headers, err)
+
+		// limit is per direction
+		headers, err = ConvertHeader(context.Background(), dst, src, newHeaders())
+		if v, _ := headers.Get("large"); err != nil || v != oversized {
+			t.Errorf("reverse direction should not be limited, got %v, %v", headers, err)
+		}
+	}
+
+	if err := CheckHeaderValues(src, dst, newHeaders()); err != ErrHeaderValueTooLarge {
+		t.Errorf("expect ErrHeaderValueTooLarge, got %v", err)
+	}
+	if err := CheckHeaderValues(dst, src, newHeaders()); err != nil {
+		t.Errorf("expect no error for reverse direction, got %v", err)
+	}
+}
+
+func TestTruncateHeaderValue(t *testing.T) {
+	testCases := []struct {
+		value     string
+		maxLength int
+		expected  string
+	}{
+		{strings.Repeat("a", 20), 16, "aa" + TruncatedMarker},
+		// the rune crossing the limit is dropped as a whole
+		{"a中文" + strings.Repeat("a", 20), len(TruncatedMarker) + 3, "a" + TruncatedMarker},
+		{"a中文" + strings.Repeat("a", 20), len(TruncatedMarker) + 4, "a中" + TruncatedMarker},
+		// no room for the marker
+		{"中文", 4, "中"},
+		{"中文", 2, ""},
+	}
+	for i, tc := range testCases {
+		v := truncateHeaderValue(tc.value, tc.maxLength)
+		if v != tc.expected {
+			t.Errorf("#%d expect %q, got %q", i, tc.expected, v)
+		}
+		if !utf8.ValidString(v) {
+			t.Errorf("#%d invalid utf-8 %q", i, v)
+		}
+	}
+}
+
+func TestDefaultHeaderValueLimit(t *testing.T) {
+	large := CommonHeader{"large": strings.Repeat("a", DefaultHTTP1HeaderValueLimit+1)}
+	for _, src := range []types.Protocol{SofaRPC, HTTP2} {
+		if err := CheckHeaderValues(src, HTTP1, large); err != ErrHeaderValueTooLarge {
+			t.Errorf("%s -> %s: expect ErrHeaderValueTooLarge, got %v", src, HTTP1, err)
+		}
+	}
+	if err := CheckHeaderValues(SofaRPC, HTTP2, large); err != nil {
+		t.Errorf("expect the value under the http2 limit passed, got %v", err)
+	}
+	if _, ok := GetHeaderValueLimit(HTTP1, SofaRPC); ok {
+		t.Error("sofarpc should not be limited")
+	}
+}
@@ -44,6 +44,7 @@ func (ctx SofaProtocolBufferCtx) Reset(i interface{}) {
 	buf.BoltRsp = BoltResponse{}
 	buf.BoltEncodeReq = BoltRequest{}
 	buf.BoltEncodeRsp = BoltResponse{}
+	buf.captured = false
 }
 
 type SofaProtocolBuffers struct {
@@ -51,6 +52,8 @@ type SofaProtocolBuffers struct {
 	BoltRsp       BoltResponse
 	BoltEncodeReq BoltRequest
 	BoltEncodeRsp BoltResponse
+
+	captured bool // the request is captured, so is the response, see CaptureRequestFrame
 }
 
 func SofaProtocolBuffersByContext(ctx context.Context) *SofaProtocolBuffers {
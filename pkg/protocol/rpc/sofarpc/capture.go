@@ -0,0 +1,331 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/admin"
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// DefaultCaptureMaxBytes is the max bytes kept of a captured frame if not configured
+const DefaultCaptureMaxBytes = 4096
+
+// capture directions
+const (
+	CaptureRequest  = "request"
+	CaptureResponse = "response"
+)
+
+// CapturedFrame is a raw frame captured for debugging, the values of the sensitive headers are
+// overwritten by '*' so that the frame still decodes
+type CapturedFrame struct {
+	Time      time.Time `json:"time"`
+	RequestID uint32    `json:"request_id"`
+	Direction string    `json:"direction"`
+	Length    int       `json:"length"` // length of the whole frame, the captured bytes may be truncated
+	Frame     []byte    `json:"frame"`
+}
+
+// FrameCaptureSink receives the captured frames, it's called in the codec so it should not block
+type FrameCaptureSink interface {
+	Write(frame *CapturedFrame)
+}
+
+// frame capture sinks
+const (
+	CaptureSinkRing = "ring" // kept in memory and served by the admin api
+	CaptureSinkLog  = "log"  // written to the log path
+)
+
+// DefaultCaptureRingSize is the frames kept by the ring sink if not configured
+const DefaultCaptureRingSize = 1024
+
+// FrameCapture captures the raw frames of the sampled downstream requests of a listener and their responses
+type FrameCapture struct {
+	config      *v2.FrameCapture
+	sampleRate  float64
+	debugHeader string
+	redact      map[string]bool
+	maxBytes    int
+	sink        FrameCaptureSink
+}
+
+// frameCaptures are the frame captures of the listeners by the listener name, built by the first connection
+var frameCaptures = struct {
+	sync.Mutex
+	captures map[string]*FrameCapture
+}{captures: make(map[string]*FrameCapture)}
+
+// GetFrameCapture returns the frame capture of the listener, the frames are captured by the codec with the
+// context returned by WithFrameCapture. The capture is rebuilt if the config of the listener is updated
+func GetFrameCapture(listenerName string, config *v2.FrameCapture) (*FrameCapture, error) {
+	frameCaptures.Lock()
+	defer frameCaptures.Unlock()
+
+	if c, ok := frameCaptures.captures[listenerName]; ok && c.config == config {
+		return c, nil
+	}
+
+	var sink FrameCaptureSink
+	switch config.Sink {
+	case CaptureSinkRing:
+		size := config.RingSize
+		if size <= 0 {
+			size = DefaultCaptureRingSize
+		}
+		sink = NewFrameCaptureRing(size)
+	case CaptureSinkLog:
+		var err error
+		if sink, err = NewFrameCaptureLog(config.LogPath); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown frame capture sink %q", config.Sink)
+	}
+
+	c := &FrameCapture{
+		config:      config,
+		sampleRate:  config.SampleRate,
+		debugHeader: config.DebugHeader,
+		redact:      make(map[string]bool, len(config.RedactHeaders)),
+		maxBytes:    config.MaxBytes,
+		sink:        sink,
+	}
+	for _, key := range config.RedactHeaders {
+		c.redact[strings.ToLower(key)] = true
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = DefaultCaptureMaxBytes
+	}
+
+	frameCaptures.captures[listenerName] = c
+	if _, ok := sink.(*FrameCaptureRing); ok {
+		admin.SetFrameCaptures(func() interface{} {
+			return RingCaptures()
+		})
+	}
+	return c, nil
+}
+
+// RingCaptures returns the frames kept by the ring sinks by the listener name, which are served by the admin api
+func RingCaptures() map[string][]*CapturedFrame {
+	frameCaptures.Lock()
+	defer frameCaptures.Unlock()
+
+	captures := make(map[string][]*CapturedFrame, len(frameCaptures.captures))
+	for name, c := range frameCaptures.captures {
+		if ring, ok := c.sink.(*FrameCaptureRing); ok {
+			captures[name] = ring.Captures()
+		}
+	}
+	return captures
+}
+
+type frameCaptureKey struct{}
+
+// WithFrameCapture returns the context of the connection, whose frames are captured by c
+func WithFrameCapture(ctx context.Context, c *FrameCapture) context.Context {
+	return context.WithValue(ctx, frameCaptureKey{}, c)
+}
+
+// frameCaptureByContext returns the frame capture of the connection, nil means the capture is disabled
+func frameCaptureByContext(ctx context.Context) *FrameCapture {
+	c, _ := ctx.Value(frameCaptureKey{}).(*FrameCapture)
+	return c
+}
+
+// sampled returns true if the request should be captured
+func (c *FrameCapture) sampled(cmd SofaRpcCmd) bool {
+	if c.debugHeader != "" && cmd.Header() != nil {
+		if _, ok := cmd.Get(c.debugHeader); ok {
+			return true
+		}
+	}
+	return c.sampleRate > 0 && rand.Float64() < c.sampleRate
+}
+
+// capture copies the frame parts, redacts the serialized headers starting at headerOffset and writes it to the sink
+func (c *FrameCapture) capture(requestID uint32, direction string, headerOffset, headerLen int, parts ...[]byte) {
+	length := 0
+	for _, part := range parts {
+		length += len(part)
+	}
+	size := length
+	if size > c.maxBytes {
+		size = c.maxBytes
+	}
+
+	frame := make([]byte, 0, size)
+	for _, part := range parts {
+		if left := size - len(frame); left < len(part) {
+			part = part[:left]
+		}
+		frame = append(frame, part...)
+	}
+	if headerOffset < len(frame) {
+		end := headerOffset + headerLen
+		if end > len(frame) {
+			end = len(frame)
+		}
+		c.redactHeaders(frame[headerOffset:end], headerLen)
+	}
+
+	c.sink.Write(&CapturedFrame{
+		Time:      time.Now(),
+		RequestID: requestID,
+		Direction: direction,
+		Length:    length,
+		Frame:     frame,
+	})
+}
+
+// redactHeaders overwrites the values of the sensitive headers in the serialized header map, which is
+// a sequence of length prefixed keys and values. The header may be truncated, headerLen is the whole length
+func (c *FrameCapture) redactHeaders(header []byte, headerLen int) {
+	if len(c.redact) == 0 {
+		return
+	}
+
+	for index := 0; index+4 <= len(header); {
+		keyLen := int(int32(binary.BigEndian.Uint32(header[index:])))
+		index += 4
+		if keyLen < 0 || index+keyLen+4 > len(header) {
+			return
+		}
+		key := string(header[index : index+keyLen])
+		index += keyLen
+
+		valueLen := int(int32(binary.BigEndian.Uint32(header[index:])))
+		index += 4
+		if valueLen < 0 {
+			valueLen = 0
+		}
+		if index+valueLen > headerLen {
+			return
+		}
+		if c.redact[strings.ToLower(key)] {
+			for i := index; i < index+valueLen && i < len(header); i++ {
+				header[i] = '*'
+			}
+		}
+		index += valueLen
+	}
+}
+
+// CaptureRequestFrame captures the decoded request if sampled, the response of the request is captured
+// by CaptureResponseFrame with the same context. The serialized headers of the frame start at headerOffset
+func CaptureRequestFrame(ctx context.Context, cmd SofaRpcCmd, frame []byte, headerOffset, headerLen int) {
+	c := frameCaptureByContext(ctx)
+	if c == nil || cmd.CommandType() == RESPONSE || cmd.CommandCode() == HEARTBEAT || !c.sampled(cmd) {
+		return
+	}
+
+	SofaProtocolBuffersByContext(ctx).captured = true
+	c.capture(uint32(cmd.RequestID()), CaptureRequest, headerOffset, headerLen, frame)
+}
+
+// CaptureResponseFrame captures the encoded response if its request is captured,
+// the frame is the encoded header buffer followed by the content
+func CaptureResponseFrame(ctx context.Context, cmd SofaRpcCmd, header types.IoBuffer, headerOffset, headerLen int) {
+	c := frameCaptureByContext(ctx)
+	if c == nil || header == nil {
+		return
+	}
+	buffers := SofaProtocolBuffersByContext(ctx)
+	if !buffers.captured {
+		return
+	}
+	buffers.captured = false
+
+	var content []byte
+	if data := cmd.Data(); data != nil {
+		content = data.Bytes()
+	}
+	c.capture(uint32(cmd.RequestID()), CaptureResponse, headerOffset, headerLen, header.Bytes(), content)
+}
+
+// FrameCaptureRing keeps the latest captured frames in memory
+type FrameCaptureRing struct {
+	mutex  sync.Mutex
+	frames []*CapturedFrame
+	next   int
+	full   bool
+}
+
+// NewFrameCaptureRing returns a ring keeping the latest size frames
+func NewFrameCaptureRing(size int) *FrameCaptureRing {
+	if size <= 0 {
+		size = 1
+	}
+	return &FrameCaptureRing{
+		frames: make([]*CapturedFrame, size),
+	}
+}
+
+func (r *FrameCaptureRing) Write(frame *CapturedFrame) {
+	r.mutex.Lock()
+	r.frames[r.next] = frame
+	r.next++
+	if r.next == len(r.frames) {
+		r.next = 0
+		r.full = true
+	}
+	r.mutex.Unlock()
+}
+
+// Captures returns the kept frames, the oldest first
+func (r *FrameCaptureRing) Captures() []*CapturedFrame {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]*CapturedFrame(nil), r.frames[:r.next]...)
+	}
+	captures := make([]*CapturedFrame, 0, len(r.frames))
+	captures = append(captures, r.frames[r.next:]...)
+	return append(captures, r.frames[:r.next]...)
+}
+
+type frameCaptureLog struct {
+	logger log.Logger
+}
+
+// NewFrameCaptureLog returns a sink writing a line for each frame to the output, the frame is hex encoded
+func NewFrameCaptureLog(output string) (FrameCaptureSink, error) {
+	logger, err := log.GetLoggerInstance(output, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &frameCaptureLog{logger: logger}, nil
+}
+
+func (l *frameCaptureLog) Write(frame *CapturedFrame) {
+	l.logger.Printf("%s %d %s %d %s", frame.Time.Format("2006-01-02 15:04:05.999"), frame.RequestID,
+		frame.Direction, frame.Length, hex.EncodeToString(frame.Frame))
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
@@ -44,6 +45,7 @@ func init() {
 	sofarpc.RegisterProtocol(sofarpc.PROTOCOL_CODE_V1, BoltCodec, BoltCodec, &BoltV1SpanBuilder{})
 	sofarpc.RegisterResponseBuilder(sofarpc.PROTOCOL_CODE_V1, BoltCodec)
 	sofarpc.RegisterHeartbeatBuilder(sofarpc.PROTOCOL_CODE_V1, BoltCodec)
+	sofarpc.RegisterStreamingDecoder(sofarpc.PROTOCOL_CODE_V1, BoltCodec)
 }
 
 // ~~ types.Encoder
@@ -57,7 +59,7 @@ func (c *boltCodec) Encode(ctx context.Context, model interface{}) (types.IoBuff
 	case *sofarpc.BoltResponse:
 		return encodeResponse(ctx, cmd)
 	default:
-		log.ByContext(ctx).Errorf("unknown model : %+v", model)
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("unknown model : %+v", model)
 		return nil, rpc.ErrUnknownType
 	}
 }
@@ -178,6 +180,8 @@ func encodeResponse(ctx context.Context, cmd *sofarpc.BoltResponse) (types.IoBuf
 	if cmd.HeaderLen > 0 {
 		buf.Write(cmd.HeaderMap)
 	}
+
+	sofarpc.CaptureResponseFrame(ctx, cmd, buf, sofarpc.RESPONSE_HEADER_LEN_V1+int(cmd.ClassLen), int(cmd.HeaderLen))
 	return buf, nil
 }
 
@@ -203,6 +207,23 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 				headerLen := binary.BigEndian.Uint16(bytes[16:18])
 				contentLen := binary.BigEndian.Uint32(bytes[18:22])
 
+				// validate the length before waiting for the whole frame
+				if err := sofarpc.CheckPayloadSize(ctx, cmdType, uint64(classLen), uint64(headerLen), uint64(contentLen)); err != nil {
+					log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("BoltV1 DECODE Request, request id = %d, payload length %d exceeds the limit",
+						requestID, int(classLen)+int(headerLen)+int(contentLen))
+					// returns the request header for the exception response
+					return &sofarpc.BoltRequest{
+						Protocol:      sofarpc.PROTOCOL_CODE_V1,
+						CmdType:       cmdType,
+						CmdCode:       int16(cmdCode),
+						Version:       ver2,
+						ReqID:         requestID,
+						Codec:         codec,
+						Timeout:       int(timeout),
+						RequestHeader: make(map[string]string),
+					}, err
+				}
+
 				read = sofarpc.REQUEST_HEADER_LEN_V1
 				var class, header, content []byte
 
@@ -224,7 +245,7 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 
 				} else { // not enough data
 
-					log.ByContext(ctx).Debugf("BoltV1 DECODE Request, no enough data for fully decode")
+					log.ModuleByContext(ctx, sofarpc.CodecLogModule).Debugf("BoltV1 DECODE Request, no enough data for fully decode")
 					return cmd, nil
 				}
 
@@ -244,7 +265,11 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 				request.ClassName = class
 				request.HeaderMap = header
 				request.Content = buffer.NewIoBufferBytes(content)
-				sofarpc.DeserializeBoltRequest(ctx, request)
+				if err := sofarpc.DeserializeBoltRequest(ctx, request); err != nil {
+					// frame is consumed, return the request for the exception response
+					return request, err
+				}
+				sofarpc.CaptureRequestFrame(ctx, request, bytes[:read], sofarpc.REQUEST_HEADER_LEN_V1+int(classLen), int(headerLen))
 
 				cmd = request
 			}
@@ -261,6 +286,12 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 				headerLen := binary.BigEndian.Uint16(bytes[14:16])
 				contentLen := binary.BigEndian.Uint32(bytes[16:20])
 
+				if err := sofarpc.CheckPayloadSize(ctx, cmdType, uint64(classLen), uint64(headerLen), uint64(contentLen)); err != nil {
+					log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("BoltV1 DECODE RESPONSE, request id = %d, payload length %d exceeds the limit",
+						requestID, int(classLen)+int(headerLen)+int(contentLen))
+					return nil, err
+				}
+
 				read = sofarpc.RESPONSE_HEADER_LEN_V1
 				var class, header, content []byte
 
@@ -281,7 +312,7 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 					data.Drain(read)
 				} else {
 					// not enough data
-					log.ByContext(ctx).Debugf("BoltV1 DECODE RESPONSE: no enough data for fully decode")
+					log.ModuleByContext(ctx, sofarpc.CodecLogModule).Debugf("BoltV1 DECODE RESPONSE: no enough data for fully decode")
 
 					return cmd, nil
 				}
@@ -304,7 +335,9 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 				response.Content = buffer.NewIoBufferBytes(content)
 
 				response.ResponseTimeMillis = time.Now().UnixNano() / int64(time.Millisecond)
-				sofarpc.DeserializeBoltResponse(ctx, response)
+				if err := sofarpc.DeserializeBoltResponse(ctx, response); err != nil {
+					return response, err
+				}
 
 				cmd = response
 			}
@@ -317,6 +350,55 @@ func (c *boltCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{
 	return cmd, nil
 }
 
+// ~ StreamingDecoder
+func (c *boltCodec) DecodeHeader(ctx context.Context, data types.IoBuffer, minContentLen int) (sofarpc.SofaRpcCmd, int, error) {
+	bytes := data.Bytes()
+	if len(bytes) < sofarpc.REQUEST_HEADER_LEN_V1 || (bytes[1] != sofarpc.REQUEST && bytes[1] != sofarpc.REQUEST_ONEWAY) {
+		return nil, 0, nil
+	}
+
+	cmdType := bytes[1]
+	classLen := binary.BigEndian.Uint16(bytes[14:16])
+	headerLen := binary.BigEndian.Uint16(bytes[16:18])
+	contentLen := binary.BigEndian.Uint32(bytes[18:22])
+	read := sofarpc.REQUEST_HEADER_LEN_V1 + int(classLen) + int(headerLen)
+
+	// the oversized frame is rejected by Decode
+	if int(contentLen) < minContentLen || len(bytes) < read || len(bytes) >= read+int(contentLen) ||
+		sofarpc.CheckPayloadSize(ctx, cmdType, uint64(classLen), uint64(headerLen), uint64(contentLen)) != nil {
+		return nil, 0, nil
+	}
+
+	// copy the class and header, the read buffer is reused while the content is streamed
+	header := make([]byte, int(classLen)+int(headerLen))
+	copy(header, bytes[sofarpc.REQUEST_HEADER_LEN_V1:read])
+
+	buffers := sofarpc.SofaProtocolBuffersByContext(ctx)
+	request := &buffers.BoltReq
+	request.Protocol = sofarpc.PROTOCOL_CODE_V1
+	request.CmdType = cmdType
+	request.CmdCode = int16(binary.BigEndian.Uint16(bytes[2:4]))
+	request.Version = bytes[4]
+	request.ReqID = binary.BigEndian.Uint32(bytes[5:9])
+	request.Codec = bytes[9]
+	request.Timeout = int(binary.BigEndian.Uint32(bytes[10:14]))
+	request.ClassLen = int16(classLen)
+	request.HeaderLen = int16(headerLen)
+	request.ContentLen = int(contentLen)
+	request.ClassName = header[:classLen]
+	request.HeaderMap = header[classLen:]
+	data.Drain(read)
+
+	log.ModuleByContext(ctx, sofarpc.CodecLogModule).Debugf("BoltV1 DECODE Request header, request id = %d, streaming content length %d",
+		request.ReqID, contentLen)
+	if err := sofarpc.DeserializeBoltRequest(ctx, request); err != nil {
+		// header is consumed, return the request for the exception response
+		return request, int(contentLen), err
+	}
+
+	return request, int(contentLen), nil
+}
+
 // ~ HeartbeatBuilder
 func (c *boltCodec) Trigger() sofarpc.SofaRpcCmd {
 	return &sofarpc.BoltRequest{
@@ -406,6 +488,7 @@ func (sb *BoltV1SpanBuilder) BuildSpan(args ...interface{}) types.Span {
 	span.SetTag(trace.SPAN_TYPE, string(lType.(v2.ListenerType)))
 	span.SetTag(trace.METHOD_NAME, request.RequestHeader[models.TARGET_METHOD])
 	span.SetTag(trace.PROTOCOL, "bolt")
+	span.SetTag(trace.REQUEST_ID, strconv.FormatUint(uint64(request.ReqID), 10))
 	span.SetTag(trace.SERVICE_NAME, request.RequestHeader[models.SERVICE_KEY])
 	span.SetTag(trace.BAGGAGE_DATA, request.RequestHeader[models.SOFA_TRACE_BAGGAGE_DATA])
 	return span
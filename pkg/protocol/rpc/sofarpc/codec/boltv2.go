@@ -41,6 +41,7 @@ func init() {
 	sofarpc.RegisterResponseBuilder(sofarpc.PROTOCOL_CODE_V2, BoltCodecV2)
 	// the heartbeat processing is same with boltV1
 	sofarpc.RegisterHeartbeatBuilder(sofarpc.PROTOCOL_CODE_V2, BoltCodec)
+	sofarpc.RegisterProtocolVersion(sofarpc.PROTOCOL_CODE_V2, sofarpc.PROTOCOL_VERSION_1, sofarpc.PROTOCOL_VERSION_2)
 }
 
 // ~~ types.Encoder
@@ -54,7 +55,7 @@ func (c *boltCodecV2) Encode(ctx context.Context, model interface{}) (types.IoBu
 	case *sofarpc.BoltResponseV2:
 		return encodeResponseV2(ctx, cmd)
 	default:
-		log.ByContext(ctx).Errorf("unknown model : %+v", model)
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("unknown model : %+v", model)
 		return nil, rpc.ErrUnknownType
 	}
 }
@@ -181,6 +182,8 @@ func encodeResponseV2(ctx context.Context, cmd *sofarpc.BoltResponseV2) (types.I
 		buf.Write(cmd.HeaderMap)
 	}
 
+	sofarpc.CaptureResponseFrame(ctx, cmd, buf, sofarpc.RESPONSE_HEADER_LEN_V2+int(cmd.ClassLen), int(cmd.HeaderLen))
+
 	return buf, nil
 }
 
@@ -188,7 +191,7 @@ func (c *boltCodecV2) Decode(ctx context.Context, data types.IoBuffer) (interfac
 	readableBytes := data.Len()
 	read := 0
 	var cmd interface{}
-	logger := log.ByContext(ctx)
+	logger := log.ModuleByContext(ctx, sofarpc.CodecLogModule)
 
 	if readableBytes >= sofarpc.LESS_LEN_V2 {
 		bytes := data.Bytes()
@@ -197,6 +200,25 @@ func (c *boltCodecV2) Decode(ctx context.Context, data types.IoBuffer) (interfac
 
 		cmdType := bytes[2]
 
+		if !sofarpc.IsVersionSupported(sofarpc.PROTOCOL_CODE_V2, ver1) {
+			logger.Errorf("[BOLTV2 Decoder]unknown protocol version %d", ver1)
+			if cmdType == sofarpc.REQUEST || cmdType == sofarpc.REQUEST_ONEWAY {
+				// the request id is kept by the layout of all versions, returns it for the exception response
+				return &sofarpc.BoltRequestV2{
+					BoltRequest: sofarpc.BoltRequest{
+						Protocol:      sofarpc.PROTOCOL_CODE_V2,
+						CmdType:       cmdType,
+						CmdCode:       int16(binary.BigEndian.Uint16(bytes[3:5])),
+						ReqID:         binary.BigEndian.Uint32(bytes[6:10]),
+						Codec:         bytes[10],
+						RequestHeader: make(map[string]string),
+					},
+					Version1: ver1,
+				}, sofarpc.ErrUnknownProtocolVersion
+			}
+			return nil, sofarpc.ErrUnknownProtocolVersion
+		}
+
 		//1. request
 		if cmdType == sofarpc.REQUEST || cmdType == sofarpc.REQUEST_ONEWAY {
 			if readableBytes >= sofarpc.REQUEST_HEADER_LEN_V2 {
@@ -213,6 +235,27 @@ func (c *boltCodecV2) Decode(ctx context.Context, data types.IoBuffer) (interfac
 				headerLen := binary.BigEndian.Uint16(bytes[18:20])
 				contentLen := binary.BigEndian.Uint32(bytes[20:24])
 
+				// validate the length before waiting for the whole frame
+				if err := sofarpc.CheckPayloadSize(ctx, cmdType, uint64(classLen), uint64(headerLen), uint64(contentLen)); err != nil {
+					logger.Errorf("[BOLTV2 Decoder]request id = %d, payload length %d exceeds the limit",
+						requestID, int(classLen)+int(headerLen)+int(contentLen))
+					// returns the request header for the exception response
+					return &sofarpc.BoltRequestV2{
+						BoltRequest: sofarpc.BoltRequest{
+							Protocol:      sofarpc.PROTOCOL_CODE_V2,
+							CmdType:       cmdType,
+							CmdCode:       int16(cmdCode),
+							Version:       ver2,
+							ReqID:         requestID,
+							Codec:         codec,
+							Timeout:       int(timeout),
+							RequestHeader: make(map[string]string),
+						},
+						Version1:   ver1,
+						SwitchCode: switchCode,
+					}, err
+				}
+
 				read = sofarpc.REQUEST_HEADER_LEN_V2
 				var class, header, content []byte
 
@@ -257,7 +300,11 @@ func (c *boltCodecV2) Decode(ctx context.Context, data types.IoBuffer) (interfac
 					SwitchCode: switchCode,
 				}
 
-				sofarpc.DeserializeBoltRequest(ctx, &request.BoltRequest)
+				if err := sofarpc.DeserializeBoltRequest(ctx, &request.BoltRequest); err != nil {
+					// frame is consumed, return the request for the exception response
+					return request, err
+				}
+				sofarpc.CaptureRequestFrame(ctx, request, bytes[:read], sofarpc.REQUEST_HEADER_LEN_V2+int(classLen), int(headerLen))
 
 				logger.Debugf("[Decoder]bolt v2 decode request:%+v", request)
 
@@ -278,6 +325,12 @@ func (c *boltCodecV2) Decode(ctx context.Context, data types.IoBuffer) (interfac
 				headerLen := binary.BigEndian.Uint16(bytes[16:18])
 				contentLen := binary.BigEndian.Uint32(bytes[18:22])
 
+				if err := sofarpc.CheckPayloadSize(ctx, cmdType, uint64(classLen), uint64(headerLen), uint64(contentLen)); err != nil {
+					logger.Errorf("[BOLTV2 Decoder]response request id = %d, payload length %d exceeds the limit",
+						requestID, int(classLen)+int(headerLen)+int(contentLen))
+					return nil, err
+				}
+
 				read = sofarpc.RESPONSE_HEADER_LEN_V2
 				var class, header, content []byte
 
@@ -322,7 +375,9 @@ func (c *boltCodecV2) Decode(ctx context.Context, data types.IoBuffer) (interfac
 					SwitchCode: switchCode,
 				}
 
-				sofarpc.DeserializeBoltResponse(ctx, &response.BoltResponse)
+				if err := sofarpc.DeserializeBoltResponse(ctx, &response.BoltResponse); err != nil {
+					return response, err
+				}
 
 				logger.Debugf("[Decoder]bolt v2 decode bolt.ResponseV2:%+v\n", response)
 				cmd = response
@@ -0,0 +1,198 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codec
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func newCaptureRequestFrame(t *testing.T, id uint32, headers map[string]string) types.IoBuffer {
+	content := []byte("capture content")
+	req := &sofarpc.BoltRequest{
+		Protocol:      sofarpc.PROTOCOL_CODE_V1,
+		CmdType:       sofarpc.REQUEST,
+		CmdCode:       sofarpc.RPC_REQUEST,
+		Version:       1,
+		ReqID:         id,
+		Codec:         sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:       3000,
+		RequestClass:  "com.alipay.sofa.rpc.core.request.SofaRequest",
+		RequestHeader: headers,
+		ContentLen:    len(content),
+		Content:       buffer.NewIoBufferBytes(content),
+	}
+	headerBuf, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+	frame := buffer.NewIoBuffer(headerBuf.Len() + len(content))
+	frame.Write(headerBuf.Bytes())
+	frame.Write(content)
+	return frame
+}
+
+// exchange decodes the request frame and encodes the response as a server stream of the listener does
+func exchange(t *testing.T, capture *sofarpc.FrameCapture, frame types.IoBuffer) {
+	ctx := buffer.NewBufferPoolContext(sofarpc.WithFrameCapture(context.Background(), capture))
+	cmd, err := sofarpc.Engine().Decode(ctx, frame)
+	if err != nil || cmd == nil {
+		t.Fatalf("decode request failed: %v", err)
+	}
+	req := cmd.(*sofarpc.BoltRequest)
+	resp := sofarpc.NewResponseWithBody(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS, []byte("capture response"))
+	resp.SetRequestID(req.RequestID())
+	if _, err := sofarpc.Engine().Encode(ctx, resp); err != nil {
+		t.Fatalf("encode response failed: %v", err)
+	}
+}
+
+func TestFrameCapture(t *testing.T) {
+	capture, err := sofarpc.GetFrameCapture("capture_test", &v2.FrameCapture{
+		DebugHeader:   "mosn-debug-capture",
+		RedactHeaders: []string{"Password"},
+		Sink:          sofarpc.CaptureSinkRing,
+		RingSize:      8,
+	})
+	if err != nil {
+		t.Fatalf("get frame capture failed: %v", err)
+	}
+
+	// not sampled
+	exchange(t, capture, newCaptureRequestFrame(t, 1, map[string]string{"service": "com.alipay.test.TestService:1.0"}))
+	if captures := sofarpc.RingCaptures()["capture_test"]; len(captures) != 0 {
+		t.Fatalf("expect no capture without the debug header, got %d", len(captures))
+	}
+
+	frame := newCaptureRequestFrame(t, 2, map[string]string{
+		"service":            "com.alipay.test.TestService:1.0",
+		"password":           "secret",
+		"mosn-debug-capture": "1",
+	})
+	length := frame.Len()
+	exchange(t, capture, frame)
+	captures := sofarpc.RingCaptures()["capture_test"]
+	if len(captures) != 2 || captures[0].Direction != sofarpc.CaptureRequest || captures[1].Direction != sofarpc.CaptureResponse {
+		t.Fatalf("expect the request and the response captured, got %v", captures)
+	}
+	for _, c := range captures {
+		if c.RequestID != 2 {
+			t.Errorf("expect request id 2, got %d", c.RequestID)
+		}
+	}
+
+	request := captures[0]
+	if request.Length != length || len(request.Frame) != length {
+		t.Errorf("expect the whole frame of %d bytes, got %d of %d", length, len(request.Frame), request.Length)
+	}
+	if bytes.Contains(request.Frame, []byte("secret")) {
+		t.Error("the sensitive header should be redacted")
+	}
+	// the redacted frame still decodes
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), buffer.NewIoBufferBytes(request.Frame))
+	if err != nil || cmd == nil {
+		t.Fatalf("decode captured frame failed: %v", err)
+	}
+	if password, _ := cmd.(*sofarpc.BoltRequest).Get("password"); password != "******" {
+		t.Errorf("expect the password redacted, got %q", password)
+	}
+	if !bytes.HasSuffix(captures[1].Frame, []byte("capture response")) {
+		t.Errorf("expect the response content captured, got %q", captures[1].Frame)
+	}
+}
+
+func TestFrameCaptureMaxBytes(t *testing.T) {
+	capture, err := sofarpc.GetFrameCapture("capture_max_bytes_test", &v2.FrameCapture{
+		SampleRate:    1,
+		RedactHeaders: []string{"password"},
+		MaxBytes:      sofarpc.REQUEST_HEADER_LEN_V1 + 8,
+		Sink:          sofarpc.CaptureSinkRing,
+		RingSize:      2,
+	})
+	if err != nil {
+		t.Fatalf("get frame capture failed: %v", err)
+	}
+
+	for id := uint32(1); id <= 3; id++ {
+		exchange(t, capture, newCaptureRequestFrame(t, id, map[string]string{"password": "secret"}))
+	}
+	// only the latest frames are kept
+	captures := sofarpc.RingCaptures()["capture_max_bytes_test"]
+	if len(captures) != 2 || captures[0].RequestID != 3 || captures[1].RequestID != 3 {
+		t.Fatalf("expect the frames of the latest request, got %v", captures)
+	}
+	for _, c := range captures {
+		if len(c.Frame) != sofarpc.REQUEST_HEADER_LEN_V1+8 || c.Length <= len(c.Frame) {
+			t.Errorf("expect the frame truncated, got %d of %d bytes", len(c.Frame), c.Length)
+		}
+	}
+}
+
+func TestFrameCaptureConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frame_capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &v2.FrameCapture{SampleRate: 1, Sink: sofarpc.CaptureSinkLog, LogPath: filepath.Join(dir, "capture.log")}
+	capture, err := sofarpc.GetFrameCapture("capture_log_test", config)
+	if err != nil {
+		t.Fatalf("get frame capture failed: %v", err)
+	}
+	// the connections of the listener share the capture until the config is updated
+	if c, _ := sofarpc.GetFrameCapture("capture_log_test", config); c != capture {
+		t.Error("expect the capture shared by the listener")
+	}
+	updated := *config
+	if c, _ := sofarpc.GetFrameCapture("capture_log_test", &updated); c == capture {
+		t.Error("expect the capture rebuilt by the updated config")
+	}
+	// the log sink is not served by the admin api
+	if _, ok := sofarpc.RingCaptures()["capture_log_test"]; ok {
+		t.Error("expect no ring of the log sink")
+	}
+
+	// the frames are written to the log
+	exchange(t, capture, newCaptureRequestFrame(t, 1, nil))
+	var data []byte
+	for i := 0; i < 50 && !bytes.Contains(data, []byte(sofarpc.CaptureResponse)); i++ {
+		time.Sleep(20 * time.Millisecond)
+		data, _ = ioutil.ReadFile(config.LogPath)
+	}
+	if !bytes.Contains(data, []byte(" 1 "+sofarpc.CaptureRequest+" ")) || !bytes.Contains(data, []byte(" 1 "+sofarpc.CaptureResponse+" ")) {
+		t.Errorf("expect the request and the response logged, got %q", data)
+	}
+
+	// the frames of a connection without the capture are not captured
+	exchange(t, nil, newCaptureRequestFrame(t, 2, nil))
+
+	if _, err := sofarpc.GetFrameCapture("capture_unknown_test", &v2.FrameCapture{Sink: "unknown"}); err == nil {
+		t.Error("expect the unknown sink failed")
+	}
+}
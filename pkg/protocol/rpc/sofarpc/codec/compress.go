@@ -0,0 +1,99 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+var (
+	CompressCodec = &compressCodec{}
+)
+
+func init() {
+	sofarpc.RegisterProtocol(sofarpc.PROTOCOL_CODE_COMPRESS, CompressCodec, CompressCodec, nil)
+}
+
+// ~~ types.Encoder
+// ~~ types.Decoder
+// compressCodec unwraps the compressed frame and decodes the inner sofarpc frame with the sofarpc engine.
+// Encoding is done by sofarpc.EncodeCompressedFrame at the stream layer, because the inner commands keep their own protocol code.
+type compressCodec struct{}
+
+func (c *compressCodec) Encode(ctx context.Context, model interface{}) (types.IoBuffer, error) {
+	log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("compressed frame should be built by sofarpc.EncodeCompressedFrame, model : %+v", model)
+	return nil, rpc.ErrUnknownType
+}
+
+func (c *compressCodec) Decode(ctx context.Context, data types.IoBuffer) (interface{}, error) {
+	readableBytes := data.Len()
+	if readableBytes < sofarpc.COMPRESS_HEADER_LEN {
+		return nil, nil
+	}
+
+	bytes := data.Bytes()
+	compressor := sofarpc.GetFrameCompressorByID(bytes[1])
+	if compressor == nil {
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("unknown frame compressor id = %d", bytes[1])
+		return nil, rpc.ErrUnrecognizedCode
+	}
+
+	// validate the length before waiting for the whole frame, the frame is not consumed
+	maxFrame := sofarpc.MaxFrameSize(ctx)
+	payloadLen := uint64(binary.BigEndian.Uint32(bytes[2:6]))
+	if payloadLen > maxFrame {
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("compressed frame length %d exceeds the limit %d", payloadLen, maxFrame)
+		return nil, sofarpc.ErrPayloadTooLarge
+	}
+	read := sofarpc.COMPRESS_HEADER_LEN + int(payloadLen)
+	if readableBytes < read {
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Debugf("Compressed frame DECODE: no enough data for fully decode")
+		return nil, nil
+	}
+
+	frame, err := compressor.Decompress(bytes[sofarpc.COMPRESS_HEADER_LEN:read], maxFrame)
+	data.Drain(read)
+	if err == sofarpc.ErrPayloadTooLarge {
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("decompressed frame exceeds the limit %d", maxFrame)
+		return nil, types.ErrCodecException
+	}
+	if err != nil {
+		log.ModuleByContext(ctx, sofarpc.CodecLogModule).Errorf("decompress frame with %s failed: %v", compressor.Name(), err)
+		return nil, types.ErrCodecException
+	}
+
+	// nested compressed frame is not allowed
+	if len(frame) == 0 || frame[0] == sofarpc.PROTOCOL_CODE_COMPRESS {
+		return nil, types.ErrCodecException
+	}
+
+	cmd, err := sofarpc.Engine().Decode(ctx, buffer.NewIoBufferBytes(frame))
+	if cmd == nil && err == nil {
+		// the inner frame must be complete
+		return nil, types.ErrCodecException
+	}
+
+	return cmd, err
+}
@@ -0,0 +1,204 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codec
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestCompressedFrameRoundTrip(t *testing.T) {
+	ctx := buffer.NewBufferPoolContext(context.Background())
+	content := []byte("compressed frame content compressed frame content")
+	req := &sofarpc.BoltRequest{
+		Protocol:      sofarpc.PROTOCOL_CODE_V1,
+		CmdType:       sofarpc.REQUEST,
+		CmdCode:       sofarpc.RPC_REQUEST,
+		Version:       1,
+		ReqID:         101,
+		Codec:         sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:       3000,
+		RequestClass:  "com.alipay.sofa.rpc.core.request.SofaRequest",
+		RequestHeader: map[string]string{"service": "com.alipay.test.TestService:1.0"},
+		ContentLen:    len(content),
+		Content:       buffer.NewIoBufferBytes(content),
+	}
+
+	headerBuf, err := sofarpc.Engine().Encode(ctx, req)
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+
+	compressor := sofarpc.GetFrameCompressor("gzip")
+	if compressor == nil {
+		t.Fatal("gzip frame compressor is not registered")
+	}
+	frame, err := sofarpc.EncodeCompressedFrame(compressor, headerBuf, req.Content)
+	if err != nil {
+		t.Fatalf("compress frame failed: %v", err)
+	}
+
+	// two frames in one read, the second one arrives in pieces
+	data := buffer.NewIoBuffer(frame.Len() * 2)
+	data.Write(frame.Bytes())
+	data.Write(frame.Bytes()[:sofarpc.COMPRESS_HEADER_LEN+1])
+
+	for i := 0; i < 2; i++ {
+		cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), data)
+		if i == 1 {
+			if cmd != nil || err != nil {
+				t.Fatalf("expect waiting for more data, got %v, %v", cmd, err)
+			}
+			data.Write(frame.Bytes()[sofarpc.COMPRESS_HEADER_LEN+1:])
+			cmd, err = sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), data)
+		}
+		if err != nil {
+			t.Fatalf("#%d decode compressed frame failed: %v", i, err)
+		}
+
+		got, ok := cmd.(*sofarpc.BoltRequest)
+		if !ok {
+			t.Fatalf("#%d expect bolt request, got %T", i, cmd)
+		}
+		if got.ReqID != req.ReqID || got.RequestClass != req.RequestClass || got.Timeout != req.Timeout {
+			t.Errorf("#%d unexpected request: %+v", i, got)
+		}
+		if got.RequestHeader["service"] != req.RequestHeader["service"] {
+			t.Errorf("#%d unexpected header: %v", i, got.RequestHeader)
+		}
+		if got.Content == nil || got.Content.String() != string(content) {
+			t.Errorf("#%d unexpected content: %v", i, got.Content)
+		}
+	}
+
+	if data.Len() != 0 {
+		t.Errorf("expect all data drained, %d bytes left", data.Len())
+	}
+}
+
+func TestCompressedFrameDecodeError(t *testing.T) {
+	ctx := buffer.NewBufferPoolContext(context.Background())
+
+	// unknown algorithm
+	data := buffer.NewIoBufferBytes([]byte{sofarpc.PROTOCOL_CODE_COMPRESS, 0xff, 0, 0, 0, 1, 0})
+	if _, err := sofarpc.Engine().Decode(ctx, data); err != rpc.ErrUnrecognizedCode {
+		t.Errorf("expect ErrUnrecognizedCode, got %v", err)
+	}
+
+	// broken payload
+	data = buffer.NewIoBufferBytes([]byte{sofarpc.PROTOCOL_CODE_COMPRESS, sofarpc.GZIP_COMPRESS, 0, 0, 0, 2, 1, 2})
+	if _, err := sofarpc.Engine().Decode(ctx, data); err != types.ErrCodecException {
+		t.Errorf("expect ErrCodecException, got %v", err)
+	}
+}
+
+func TestFrameCompressors(t *testing.T) {
+	src := []byte(strings.Repeat("com.alipay.test.TestService:1.0 ", 64))
+	for _, name := range []string{"gzip", "deflate"} {
+		compressor := sofarpc.GetFrameCompressor(name)
+		if compressor == nil || sofarpc.GetFrameCompressorByID(compressor.ID()) != compressor {
+			t.Fatalf("%s frame compressor is not registered", name)
+		}
+		compressed, err := compressor.Compress(src)
+		if err != nil {
+			t.Fatalf("%s compress failed: %v", name, err)
+		}
+		if len(compressed) >= len(src) {
+			t.Errorf("%s: expect compressed, %d bytes to %d", name, len(src), len(compressed))
+		}
+		got, err := compressor.Decompress(compressed, uint64(len(src)))
+		if err != nil || !bytes.Equal(got, src) {
+			t.Errorf("%s: unexpected decompressed %d bytes, error: %v", name, len(got), err)
+		}
+		// the decompression stops at the limit
+		if _, err := compressor.Decompress(compressed, uint64(len(src)-1)); err != sofarpc.ErrPayloadTooLarge {
+			t.Errorf("%s: expect ErrPayloadTooLarge over the limit, got %v", name, err)
+		}
+	}
+}
+
+// benchmarkPayload is a hessian2 like sofarpc request content, the class names and the field names
+// are repeated as in the real traffic
+func benchmarkPayload() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 16*1024; i++ {
+		buf.WriteString("C0\x2ccom.alipay.sofa.rpc.core.request.SofaRequest\x95\x0dtargetAppName\x0amethodName")
+		buf.WriteString("\x17targetServiceUniqueName\x0crequestProps\x0dmethodArgSigs")
+		buf.WriteString("com.alipay.test.TestService:1.0\x07orderId" + strconv.Itoa(1000000+i*7919))
+	}
+	return buf.Bytes()
+}
+
+// benchmarkCompress reports the cpu cost by ns/op and MB/s of the raw frame,
+// and the bandwidth by the ratio of the compressed frame to the raw one
+func benchmarkCompress(b *testing.B, name string) {
+	compressor := sofarpc.GetFrameCompressor(name)
+	src := benchmarkPayload()
+	var compressed []byte
+
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if compressed, err = compressor.Compress(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(compressed))/float64(len(src)), "ratio")
+}
+
+func benchmarkDecompress(b *testing.B, name string) {
+	compressor := sofarpc.GetFrameCompressor(name)
+	src := benchmarkPayload()
+	compressed, err := compressor.Compress(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := compressor.Decompress(compressed, uint64(len(src))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompressGzip(b *testing.B) {
+	benchmarkCompress(b, "gzip")
+}
+
+func BenchmarkCompressDeflate(b *testing.B) {
+	benchmarkCompress(b, "deflate")
+}
+
+func BenchmarkDecompressGzip(b *testing.B) {
+	benchmarkDecompress(b, "gzip")
+}
+
+func BenchmarkDecompressDeflate(b *testing.B) {
+	benchmarkDecompress(b, "deflate")
+}
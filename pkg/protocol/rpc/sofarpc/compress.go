@@ -0,0 +1,205 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	"github.com/klauspost/compress/flate"
+)
+
+/**
+ * Compressed frame, only exchanged between two MOSN peers
+ * 0     1     2           4           6
+ * +-----+-----+-----+-----+-----+-----+
+ * |proto|algo |   payloadLen          |
+ * +-----------+-----------+-----------+
+ * |   compressed sofarpc frame bytes  |
+ * +-----------------------------------+
+ *
+ * proto: PROTOCOL_CODE_COMPRESS
+ * algo: id of the FrameCompressor
+ * payloadLen: length of the compressed payload
+ *
+ * Negotiation: the client side offers an algorithm by setting HeaderFrameCompress on its requests,
+ * a MOSN server supporting the algorithm echoes it back on the response. Only after the echo both sides
+ * send compressed frames, so a peer that doesn't know the header just keeps receiving plain frames.
+ */
+const (
+	// HeaderFrameCompress is the negotiation header, it never leaves the MOSN hop
+	HeaderFrameCompress string = "mosn-frame-compress"
+
+	PROTOCOL_CODE_COMPRESS byte = 0x10 // protocol code of the compressed frame
+
+	COMPRESS_HEADER_LEN int = 6
+
+	GZIP_COMPRESS    byte = 1 // algorithm id
+	DEFLATE_COMPRESS byte = 2
+)
+
+// FrameCompressor compresses whole sofarpc frames
+type FrameCompressor interface {
+	// Name returns the algorithm name used in negotiation
+	Name() string
+
+	// ID returns the algorithm id written into the compressed frame
+	ID() byte
+
+	Compress(src []byte) ([]byte, error)
+
+	// Decompress returns ErrPayloadTooLarge if the decompressed bytes exceed max,
+	// without decompressing the rest
+	Decompress(src []byte, max uint64) ([]byte, error)
+}
+
+var (
+	frameCompressors     = make(map[string]FrameCompressor)
+	frameCompressorsByID = make(map[byte]FrameCompressor)
+)
+
+func init() {
+	RegisterFrameCompressor(&gzipCompressor{})
+	RegisterFrameCompressor(&deflateCompressor{})
+}
+
+// RegisterFrameCompressor registers a frame compressor, the later one overrides the former with the same name
+func RegisterFrameCompressor(compressor FrameCompressor) {
+	frameCompressors[compressor.Name()] = compressor
+	frameCompressorsByID[compressor.ID()] = compressor
+}
+
+// GetFrameCompressor returns the frame compressor registered with the name, nil if not found
+func GetFrameCompressor(name string) FrameCompressor {
+	return frameCompressors[name]
+}
+
+// GetFrameCompressorByID returns the frame compressor registered with the id, nil if not found
+func GetFrameCompressorByID(id byte) FrameCompressor {
+	return frameCompressorsByID[id]
+}
+
+// EncodeCompressedFrame compresses the encoded frame buffers into a single compressed frame
+func EncodeCompressedFrame(compressor FrameCompressor, frame ...types.IoBuffer) (types.IoBuffer, error) {
+	var raw bytes.Buffer
+	for _, buf := range frame {
+		if buf != nil {
+			raw.Write(buf.Bytes())
+		}
+	}
+
+	payload, err := compressor.Compress(raw.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var b [4]byte
+	buf := buffer.NewIoBuffer(COMPRESS_HEADER_LEN + len(payload))
+
+	b[0] = PROTOCOL_CODE_COMPRESS
+	b[1] = compressor.ID()
+	buf.Write(b[0:2])
+
+	binary.BigEndian.PutUint32(b[0:], uint32(len(payload)))
+	buf.Write(b[0:4])
+
+	buf.Write(payload)
+	return buf, nil
+}
+
+type gzipCompressor struct{}
+
+func (c *gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c *gzipCompressor) ID() byte {
+	return GZIP_COMPRESS
+}
+
+func (c *gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCompressor) Decompress(src []byte, max uint64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readAtMost(r, max)
+}
+
+// deflateCompressor is the fastest level of deflate, it trades the compression ratio for much less cpu than gzip
+type deflateCompressor struct{}
+
+func (c *deflateCompressor) Name() string {
+	return "deflate"
+}
+
+func (c *deflateCompressor) ID() byte {
+	return DEFLATE_COMPRESS
+}
+
+func (c *deflateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *deflateCompressor) Decompress(src []byte, max uint64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+
+	return readAtMost(r, max)
+}
+
+// readAtMost reads the decompressed bytes up to max, a small frame may expand to gigabytes
+func readAtMost(r io.Reader, max uint64) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(b)) > max {
+		return nil, ErrPayloadTooLarge
+	}
+	return b, nil
+}
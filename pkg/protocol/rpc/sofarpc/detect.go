@@ -0,0 +1,81 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+// protocolMagic tells the protocol by the first bytes of a connection, only the protocols with a codec
+// registered are detected
+type protocolMagic struct {
+	name  string
+	size  int // bytes needed by match
+	match func(b []byte) bool
+}
+
+func isCmdType(b byte) bool {
+	return b == RESPONSE || b == REQUEST || b == REQUEST_ONEWAY
+}
+
+/**
+ * the first bytes of each protocol
+ * bolt:   proto(1) type(1)
+ * boltv2: proto(1) ver1(1) type(1)
+ */
+var protocolMagics = map[byte]protocolMagic{
+	PROTOCOL_CODE_V1: {"bolt", 2, func(b []byte) bool {
+		return isCmdType(b[1])
+	}},
+	PROTOCOL_CODE_V2: {"boltv2", 3, func(b []byte) bool {
+		return IsVersionSupported(PROTOCOL_CODE_V2, b[1]) && isCmdType(b[2])
+	}},
+}
+
+// ProtocolCodeByName returns the protocol code of the name, e.g. bolt or boltv2,
+// false if the protocol can't be detected
+func ProtocolCodeByName(name string) (byte, bool) {
+	for code, magic := range protocolMagics {
+		if magic.name == name {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// ProtocolName returns the name of the protocol code, empty if unknown
+func ProtocolName(code byte) string {
+	return protocolMagics[code].name
+}
+
+// DetectProtocol tells the protocol of the first bytes of a connection among the protocol codes.
+// more is true if the bytes are too few to tell yet, ok is false if no protocol matches
+func DetectProtocol(data []byte, codes []byte) (code byte, ok bool, more bool) {
+	if len(data) == 0 {
+		return 0, false, true
+	}
+	for _, code := range codes {
+		magic, exists := protocolMagics[code]
+		if !exists || data[0] != code {
+			continue
+		}
+		if len(data) < magic.size {
+			more = true
+			continue
+		}
+		if magic.match(data) {
+			return code, true, false
+		}
+	}
+	return 0, false, more
+}
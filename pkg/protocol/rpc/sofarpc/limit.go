@@ -0,0 +1,71 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// ErrPayloadTooLarge is returned by the codec if the payload length claimed by the frame header
+// exceeds the limit. The frame is not consumed, so the connection can't be used anymore
+var ErrPayloadTooLarge = errors.New("payload size exceeds the limit")
+
+// DefaultMaxPayloadSize is the max bytes of the payload if the listener or the cluster doesn't configure one
+const DefaultMaxPayloadSize uint64 = 32 * 1024 * 1024
+
+// MaxPayloadSize returns the max bytes of the payload of the command type, the request limit is set by the
+// listener config in types.ContextKeyListenerConfig and the response limit by the cluster in
+// types.ContextKeyMaxResponsePayload
+func MaxPayloadSize(ctx context.Context, cmdType byte) uint64 {
+	if ctx != nil {
+		var limit uint64
+		if cmdType == RESPONSE {
+			limit, _ = ctx.Value(types.ContextKeyMaxResponsePayload).(uint64)
+		} else if config, ok := ctx.Value(types.ContextKeyListenerConfig).(*v2.ListenerConfig); ok && config != nil {
+			limit = config.MaxRequestPayload
+		}
+		if limit > 0 {
+			return limit
+		}
+	}
+	return DefaultMaxPayloadSize
+}
+
+// MaxFrameSize returns the max bytes of a whole frame of either command type, e.g. the frame in a
+// compressed frame before it's decoded
+func MaxFrameSize(ctx context.Context) uint64 {
+	limit := MaxPayloadSize(ctx, REQUEST)
+	if response := MaxPayloadSize(ctx, RESPONSE); response > limit {
+		limit = response
+	}
+	return limit + uint64(REQUEST_HEADER_LEN_V2)
+}
+
+// CheckPayloadSize returns ErrPayloadTooLarge if the payload length of the command type exceeds the limit,
+// the payload is the sum of class name, header and content length.
+// It should be called with the lengths in the frame header, before waiting for the whole frame
+func CheckPayloadSize(ctx context.Context, cmdType byte, classLen, headerLen, contentLen uint64) error {
+	if classLen+headerLen+contentLen > MaxPayloadSize(ctx, cmdType) {
+		return ErrPayloadTooLarge
+	}
+	return nil
+}
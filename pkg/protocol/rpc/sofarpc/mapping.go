@@ -44,6 +44,9 @@ func (m *sofaMapping) MappingHeaderStatusCode(headers types.HeaderMap) (int, err
 		return http.StatusOK, nil
 	case RESPONSE_STATUS_SERVER_THREADPOOL_BUSY:
 		return http.StatusServiceUnavailable, nil
+	case RESPONSE_STATUS_NO_PROCESSOR:
+		// the service is not found on the host, same as types.RouterUnavailableCode
+		return http.StatusNotFound, nil
 	case RESPONSE_STATUS_TIMEOUT:
 		return http.StatusGatewayTimeout, nil
 		//case RESPONSE_STATUS_CLIENT_SEND_ERROR: // CLIENT_SEND_ERROR maybe triggered by network problem, 404 is not match
@@ -64,16 +67,21 @@ func MappingFromHttpStatus(code int) int16 {
 		return RESPONSE_STATUS_NO_PROCESSOR
 	case types.NoHealthUpstreamCode:
 		return RESPONSE_STATUS_CONNECTION_CLOSED
-	case types.UpstreamOverFlowCode:
+	case types.UpstreamOverFlowCode, types.DrainingCode, types.ConnectionOverflowCode:
 		return RESPONSE_STATUS_SERVER_THREADPOOL_BUSY
+	case types.RateLimitedCode:
+		//Throttled, the client backs off as the server is busy
+		return RESPONSE_STATUS_SERVER_THREADPOOL_BUSY
+	case types.ServiceLimitedCode:
+		return RESPONSE_STATUS_SERVER_EXCEPTION
 	case types.CodecExceptionCode:
 		//Decode or Encode Error
 		return RESPONSE_STATUS_CODEC_EXCEPTION
 	case types.DeserialExceptionCode:
 		//Hessian Exception
 		return RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION
-	case types.TimeoutExceptionCode:
-		//Response Timeout
+	case types.TimeoutExceptionCode, types.TryTimeoutExceptionCode:
+		//Response Timeout, the try timeout is distinguished by the hijack reason
 		return RESPONSE_STATUS_TIMEOUT
 	default:
 		return RESPONSE_STATUS_UNKNOWN
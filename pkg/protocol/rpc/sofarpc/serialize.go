@@ -0,0 +1,132 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"github.com/alipay/sofa-mosn/pkg/protocol/serialize"
+)
+
+// SerializeType is the serialization of the content of the frames with the codec byte, e.g. hessian2 or protobuf.
+// The class name and header map are always in the bolt key-value format, EncodeError is used to build the content
+// of the error responses made by MOSN itself, so that the client can decode them as the responses of its peer
+type SerializeType struct {
+	Name        string
+	EncodeError func(resp *BoltResponse, reason string)
+}
+
+const (
+	// SofaResponseClass is the response class of SofaRPC, the hessian2 content of the responses is an instance of it
+	SofaResponseClass = "com.alipay.sofa.rpc.core.response.SofaResponse"
+	// HeaderResponseError marks the error response of SofaRPC in protobuf, the content is the error message
+	HeaderResponseError = "sofa_head_response_error"
+)
+
+// serializeTypes are the serialization types accepted by the codec, indexed by the codec byte
+var serializeTypes = map[byte]SerializeType{
+	HESSIAN2_SERIALIZE: {Name: "hessian2", EncodeError: encodeHessian2Error},
+	PROTOBUF_SERIALIZE: {Name: "protobuf", EncodeError: encodeProtobufError},
+}
+
+// RegisterSerializeType registers the serialization type of the codec byte, a nil EncodeError means the
+// error responses made by MOSN have no body. The builtin types can be replaced too
+func RegisterSerializeType(codec byte, t SerializeType) {
+	serializeTypes[codec] = t
+}
+
+// encodeHessian2Error sets the content to a SofaResponse with the error message, as the SofaRPC server does
+func encodeHessian2Error(resp *BoltResponse, reason string) {
+	resp.ResponseClass = SofaResponseClass
+	setResponseContent(resp, serialize.EncodeHessian2Object(SofaResponseClass,
+		[]string{"isError", "errorMsg"}, []interface{}{true, reason}))
+}
+
+// encodeProtobufError sets the error message as the content with the error mark, the SofaRPC protobuf
+// serialization has no message of the error
+func encodeProtobufError(resp *BoltResponse, reason string) {
+	if resp.ResponseHeader == nil {
+		resp.ResponseHeader = make(map[string]string)
+	}
+	resp.ResponseHeader[HeaderResponseError] = "true"
+	setResponseContent(resp, []byte(reason))
+}
+
+// GetSerializeType returns the serialization type of the codec byte, false if it's not registered
+func GetSerializeType(codec byte) (SerializeType, bool) {
+	t, ok := serializeTypes[codec]
+	return t, ok
+}
+
+// checkSerializeType returns false if the codec byte of the rpc frame is not registered,
+// the heartbeats have no content, so any codec is accepted
+func checkSerializeType(cmdCode int16, codec byte) bool {
+	if cmdCode == HEARTBEAT {
+		return true
+	}
+	_, ok := serializeTypes[codec]
+	return ok
+}
+
+// SerializeCodec returns the codec byte of the cmd, false if the cmd is not a bolt cmd
+func SerializeCodec(cmd SofaRpcCmd) (byte, bool) {
+	switch c := cmd.(type) {
+	case *BoltRequest:
+		return c.Codec, true
+	case *BoltRequestV2:
+		return c.Codec, true
+	case *BoltResponse:
+		return c.Codec, true
+	case *BoltResponseV2:
+		return c.Codec, true
+	}
+	return 0, false
+}
+
+// SetSerializeCodec sets the codec byte of the cmd
+func SetSerializeCodec(cmd SofaRpcCmd, codec byte) {
+	switch c := cmd.(type) {
+	case *BoltRequest:
+		c.Codec = codec
+	case *BoltRequestV2:
+		c.Codec = codec
+	case *BoltResponse:
+		c.Codec = codec
+	case *BoltResponseV2:
+		c.Codec = codec
+	}
+}
+
+// SetErrorContent sets the reason as the error of the response made by MOSN in the serialization of the response,
+// in the format the SofaRPC client decodes. Nothing is set for an empty reason or a serialization without EncodeError
+func SetErrorContent(cmd SofaRpcCmd, reason string) {
+	if reason == "" {
+		return
+	}
+
+	var resp *BoltResponse
+	switch c := cmd.(type) {
+	case *BoltResponse:
+		resp = c
+	case *BoltResponseV2:
+		resp = &c.BoltResponse
+	default:
+		return
+	}
+	if t, ok := serializeTypes[resp.Codec]; ok && t.EncodeError != nil {
+		t.EncodeError(resp, reason)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// HeaderStreamingContent is set by the server stream on the request whose content is streamed, the value is
+// the content length. The client stream writes such content through in pieces instead of buffering the whole
+// frame. It never leaves the MOSN hop
+const HeaderStreamingContent string = "mosn-streaming-content"
+
+// StreamingDecoder decodes the request header ahead of the content, so that a large content can be streamed
+// through to the upstream without buffering the whole frame
+type StreamingDecoder interface {
+	// DecodeHeader decodes the request up to the content, the content of contentLen bytes is left in data.
+	// It returns nil cmd and nil error if the frame should be decoded as a whole by the Decoder: it's not a request,
+	// the header is not received completely, the content is less than minContentLen or is received already.
+	// The error is the same as the Decoder's, the header is consumed with a non-nil cmd
+	DecodeHeader(ctx context.Context, data types.IoBuffer, minContentLen int) (cmd SofaRpcCmd, contentLen int, err error)
+}
+
+var streamingDecoders = make(map[byte]StreamingDecoder)
+
+// RegisterStreamingDecoder registers the streaming decoder of the protocol. It should be called during initialization
+func RegisterStreamingDecoder(protocolCode byte, decoder StreamingDecoder) {
+	streamingDecoders[protocolCode] = decoder
+}
+
+// GetStreamingDecoder returns the streaming decoder of the protocol, nil if the protocol does not support it
+func GetStreamingDecoder(protocolCode byte) StreamingDecoder {
+	return streamingDecoders[protocolCode]
+}
@@ -96,6 +96,7 @@ const (
 	RPC_RESPONSE int16 = 2
 
 	HESSIAN2_SERIALIZE byte = 1 // serialize
+	PROTOBUF_SERIALIZE byte = 11
 
 	RESPONSE_STATUS_SUCCESS                   int16 = 0  // 0x00 response status
 	RESPONSE_STATUS_ERROR                     int16 = 1  // 0x01
@@ -19,12 +19,22 @@ package sofarpc
 
 import (
 	"context"
+	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/buffer"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/protocol"
 	"github.com/alipay/sofa-mosn/pkg/protocol/serialize"
+	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
+// CodecLogModule is the log module of the sofarpc codecs, its level can be changed by the admin api
+const CodecLogModule = "codec"
+
+func init() {
+	log.ModuleLogger(CodecLogModule)
+}
+
 // NewResponse build sofa response msg according to given protocol code and respStatus
 func NewResponse(protocolCode byte, respStatus int16) SofaRpcCmd {
 	if builder, ok := responseFactory[protocolCode]; ok {
@@ -33,6 +43,68 @@ func NewResponse(protocolCode byte, respStatus int16) SofaRpcCmd {
 	return nil
 }
 
+// NewResponseWithBody build sofa response msg with the body as content, the body
+// should be serialized by the codec of the response, which is hessian2 by default
+func NewResponseWithBody(protocolCode byte, respStatus int16, body []byte) SofaRpcCmd {
+	resp := NewResponse(protocolCode, respStatus)
+	if len(body) == 0 {
+		return resp
+	}
+
+	switch r := resp.(type) {
+	case *BoltResponse:
+		setResponseContent(r, body)
+	case *BoltResponseV2:
+		setResponseContent(&r.BoltResponse, body)
+	}
+	return resp
+}
+
+// NewResponseForRequest builds the response of the request with the body, in the protocol, version and
+// serialization of the request, the body should be serialized by the codec of the request
+func NewResponseForRequest(request SofaRpcCmd, respStatus int16, body []byte) SofaRpcCmd {
+	resp := NewResponseWithBody(request.ProtocolCode(), respStatus, body)
+	if resp != nil {
+		if version, ok := ProtocolVersion(request); ok {
+			SetProtocolVersion(resp, version)
+		}
+		if codec, ok := SerializeCodec(request); ok {
+			SetSerializeCodec(resp, codec)
+		}
+	}
+	return resp
+}
+
+// NewErrorResponse builds the response of the request in the protocol, version and serialization of the request,
+// the reason is carried in the format the SofaRPC client decodes, see SetErrorContent
+func NewErrorResponse(request SofaRpcCmd, respStatus int16, reason string) SofaRpcCmd {
+	resp := NewResponseForRequest(request, respStatus, nil)
+	if resp != nil {
+		SetErrorContent(resp, reason)
+	}
+	return resp
+}
+
+// RequestTimeout returns the timeout the client set on the request, false if the cmd is not a request or has no timeout
+func RequestTimeout(cmd SofaRpcCmd) (time.Duration, bool) {
+	var timeout int
+	switch c := cmd.(type) {
+	case *BoltRequest:
+		timeout = c.Timeout
+	case *BoltRequestV2:
+		timeout = c.Timeout
+	}
+	if timeout <= 0 {
+		return 0, false
+	}
+	return time.Duration(timeout) * time.Millisecond, true
+}
+
+func setResponseContent(resp *BoltResponse, body []byte) {
+	resp.Content = buffer.NewIoBufferBytes(body)
+	resp.ContentLen = len(body)
+}
+
 // NewHeartbeat
 // New Heartbeat for given protocol, requestID should be specified by caller's own logic
 func NewHeartbeat(protocolCode byte) SofaRpcCmd {
@@ -51,7 +123,10 @@ func NewHeartbeatAck(protocolCode byte) SofaRpcCmd {
 	return nil
 }
 
-func DeserializeBoltRequest(ctx context.Context, request *BoltRequest) {
+// DeserializeBoltRequest deserializes the header and class name of the request,
+// returns types.ErrDeserializeException if the bytes are malformed,
+// or types.ErrCodecException if the serialization type is not registered
+func DeserializeBoltRequest(ctx context.Context, request *BoltRequest) error {
 	//get instance
 	serializeIns := serialize.Instance
 
@@ -61,23 +136,44 @@ func DeserializeBoltRequest(ctx context.Context, request *BoltRequest) {
 	//request.RequestHeader = make(map[string]string, 8)
 
 	//logger
-	logger := log.ByContext(ctx)
+	logger := log.ModuleByContext(ctx, CodecLogModule)
+
+	if !checkSerializeType(request.CmdCode, request.Codec) {
+		logger.Errorf("Unknown serialization type %d of request, request id = %d", request.Codec, request.ReqID)
+		return types.ErrCodecException
+	}
 
 	//deserialize header
-	serializeIns.DeSerialize(request.HeaderMap, &request.RequestHeader)
+	if _, err := serializeIns.DeSerialize(request.HeaderMap, &request.RequestHeader); err != nil {
+		logger.Errorf("Deserialize request header map failed, request id = %d, error = %v", request.ReqID, err)
+		return types.ErrDeserializeException
+	}
 	logger.Debugf("Deserialize request header map:%v", request.RequestHeader)
 
 	//deserialize class name
-	serializeIns.DeSerialize(request.ClassName, &request.RequestClass)
+	if _, err := serializeIns.DeSerialize(request.ClassName, &request.RequestClass); err != nil {
+		logger.Errorf("Deserialize request class name failed, request id = %d, error = %v", request.ReqID, err)
+		return types.ErrDeserializeException
+	}
 	logger.Debugf("Request class name is:%s", request.RequestClass)
+
+	return nil
 }
 
-func DeserializeBoltResponse(ctx context.Context, response *BoltResponse) {
+// DeserializeBoltResponse deserializes the header and class name of the response,
+// returns types.ErrDeserializeException if the bytes are malformed,
+// or types.ErrCodecException if the serialization type is not registered
+func DeserializeBoltResponse(ctx context.Context, response *BoltResponse) error {
 	//get instance
 	serializeIns := serialize.Instance
 
 	//logger
-	logger := log.ByContext(ctx)
+	logger := log.ModuleByContext(ctx, CodecLogModule)
+
+	if !checkSerializeType(response.CmdCode, response.Codec) {
+		logger.Errorf("Unknown serialization type %d of response, request id = %d", response.Codec, response.ReqID)
+		return types.ErrCodecException
+	}
 
 	protocolCtx := protocol.ProtocolBuffersByContext(ctx)
 	response.ResponseHeader = protocolCtx.GetRspHeaders()
@@ -85,10 +181,18 @@ func DeserializeBoltResponse(ctx context.Context, response *BoltResponse) {
 	//response.ResponseHeader = make(map[string]string, 8)
 
 	//deserialize header
-	serializeIns.DeSerialize(response.HeaderMap, &response.ResponseHeader)
+	if _, err := serializeIns.DeSerialize(response.HeaderMap, &response.ResponseHeader); err != nil {
+		logger.Errorf("Deserialize response header map failed, request id = %d, error = %v", response.ReqID, err)
+		return types.ErrDeserializeException
+	}
 	logger.Debugf("Deserialize response header map: %+v", response.ResponseHeader)
 
 	//deserialize class name
-	serializeIns.DeSerialize(response.ClassName, &response.ResponseClass)
+	if _, err := serializeIns.DeSerialize(response.ClassName, &response.ResponseClass); err != nil {
+		logger.Errorf("Deserialize response class name failed, request id = %d, error = %v", response.ReqID, err)
+		return types.ErrDeserializeException
+	}
 	logger.Debugf("Response ClassName is: %s", response.ResponseClass)
+
+	return nil
 }
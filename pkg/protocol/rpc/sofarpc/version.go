@@ -0,0 +1,84 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"errors"
+	"strconv"
+)
+
+// HeaderProtocolVersion carries the protocol version of the request to the router, so that the routes can
+// match on it, e.g. route the bolt v2 frames of a new version away from the backends not supporting it.
+// It's set by the stream on the decoded request and never leaves the MOSN hop
+const HeaderProtocolVersion string = "mosn-protocol-version"
+
+// ErrUnknownProtocolVersion is returned by the codec if the version of the frame is not registered.
+// The frame is not consumed, since the layout of an unknown version can't be trusted
+var ErrUnknownProtocolVersion = errors.New("unknown protocol version")
+
+// protocolVersions are the versions supported by protocol code, the protocols without the version byte
+// in the frame, like bolt v1, are not registered
+var protocolVersions = make(map[byte]map[byte]bool)
+
+// RegisterProtocolVersion registers the versions supported by the protocol. It should be called during initialization
+func RegisterProtocolVersion(protocolCode byte, versions ...byte) {
+	if _, ok := protocolVersions[protocolCode]; !ok {
+		protocolVersions[protocolCode] = make(map[byte]bool)
+	}
+	for _, version := range versions {
+		protocolVersions[protocolCode][version] = true
+	}
+}
+
+// IsVersionSupported returns true if the version is registered for the protocol,
+// or the protocol has no versions registered
+func IsVersionSupported(protocolCode byte, version byte) bool {
+	versions, ok := protocolVersions[protocolCode]
+	return !ok || versions[version]
+}
+
+// ProtocolVersion returns the version of the cmd, false if the protocol has no version byte
+func ProtocolVersion(cmd SofaRpcCmd) (byte, bool) {
+	switch c := cmd.(type) {
+	case *BoltRequestV2:
+		return c.Version1, true
+	case *BoltResponseV2:
+		return c.Version1, true
+	}
+	return 0, false
+}
+
+// SetProtocolVersion sets the version of the cmd if the version is registered for the protocol of the cmd
+func SetProtocolVersion(cmd SofaRpcCmd, version byte) {
+	if versions, ok := protocolVersions[cmd.ProtocolCode()]; !ok || !versions[version] {
+		return
+	}
+	switch c := cmd.(type) {
+	case *BoltRequestV2:
+		c.Version1 = version
+	case *BoltResponseV2:
+		c.Version1 = version
+	}
+}
+
+// SetVersionHeader sets HeaderProtocolVersion on the request for routing
+func SetVersionHeader(cmd SofaRpcCmd) {
+	if version, ok := ProtocolVersion(cmd); ok && cmd.Header() != nil {
+		cmd.Set(HeaderProtocolVersion, strconv.Itoa(int(version)))
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serialize
+
+import (
+	"unicode/utf8"
+)
+
+// max length of a hessian2 string chunk, in utf-16 code units
+const hessian2MaxStringLen = 0xffff
+
+// EncodeHessian2String encodes a string as a hessian2 string object, so that
+// a hessian2 peer can deserialize it. The length of hessian2 string is counted
+// in utf-16 code units, a string longer than one chunk is truncated
+func EncodeHessian2String(v string) []byte {
+	length := 0
+	end := 0
+	for i, r := range v {
+		units := 1
+		if r >= 0x10000 {
+			units = 2
+		}
+		if length+units > hessian2MaxStringLen {
+			break
+		}
+		length += units
+		end = i + utf8.RuneLen(r)
+	}
+	v = v[:end]
+
+	buf := make([]byte, 0, len(v)+3)
+	switch {
+	case length <= 0x1f:
+		// compact short string
+		buf = append(buf, byte(length))
+	case length <= 0x3ff:
+		// compact medium string
+		buf = append(buf, byte(0x30+(length>>8)), byte(length))
+	default:
+		// final chunk
+		buf = append(buf, 'S', byte(length>>8), byte(length))
+	}
+
+	return append(buf, v...)
+}
+
+// EncodeHessian2Object encodes an object of the java class with the fields as the single object of a hessian2
+// stream, the class definition goes first. The values can be bool, string or nil, the missing fields of the
+// class are left default by the hessian2 deserializer, the order of the fields doesn't matter
+func EncodeHessian2Object(class string, names []string, values []interface{}) []byte {
+	buf := append([]byte{'C'}, EncodeHessian2String(class)...)
+	buf = append(buf, encodeHessian2Int(len(names))...)
+	for _, name := range names {
+		buf = append(buf, EncodeHessian2String(name)...)
+	}
+
+	// compact object of the class definition 0
+	buf = append(buf, 0x60)
+	for _, value := range values {
+		switch v := value.(type) {
+		case bool:
+			if v {
+				buf = append(buf, 'T')
+			} else {
+				buf = append(buf, 'F')
+			}
+		case string:
+			buf = append(buf, EncodeHessian2String(v)...)
+		default:
+			buf = append(buf, 'N')
+		}
+	}
+
+	return buf
+}
+
+// encodeHessian2Int encodes the small non-negative int of the field count
+func encodeHessian2Int(v int) []byte {
+	if v <= 47 {
+		// compact single octet int
+		return []byte{byte(0x90 + v)}
+	}
+	return []byte{'I', byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
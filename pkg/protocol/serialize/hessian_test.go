@@ -0,0 +1,62 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serialize
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeHessian2String(t *testing.T) {
+	testCases := []struct {
+		value  string
+		header []byte
+	}{
+		{"", []byte{0x00}},
+		{"hello", []byte{0x05}},
+		{"中文", []byte{0x02}},
+		{strings.Repeat("a", 32), []byte{0x30, 0x20}},
+		{strings.Repeat("a", 1024), []byte{'S', 0x04, 0x00}},
+	}
+	for i, tc := range testCases {
+		b := EncodeHessian2String(tc.value)
+		if !bytes.Equal(b, append(tc.header, tc.value...)) {
+			t.Errorf("#%d unexpected encoded bytes %v", i, b[:len(tc.header)])
+		}
+	}
+
+	// truncated to one chunk
+	b := EncodeHessian2String(strings.Repeat("a", 0x10000))
+	if !bytes.Equal(b[:3], []byte{'S', 0xff, 0xff}) || len(b) != 3+0xffff {
+		t.Errorf("expect truncated to 0xffff, got length %d", len(b))
+	}
+}
+
+func TestEncodeHessian2Object(t *testing.T) {
+	b := EncodeHessian2Object("a.B", []string{"ok", "msg"}, []interface{}{true, "hi"})
+	expected := []byte{'C', 0x03, 'a', '.', 'B', 0x92, 0x02, 'o', 'k', 0x03, 'm', 's', 'g', 0x60, 'T', 0x02, 'h', 'i'}
+	if !bytes.Equal(b, expected) {
+		t.Errorf("unexpected encoded bytes %v", b)
+	}
+
+	b = EncodeHessian2Object("a.B", []string{"ok", "value"}, []interface{}{false, nil})
+	if !bytes.HasSuffix(b, []byte{0x60, 'F', 'N'}) {
+		t.Errorf("unexpected encoded bytes %v", b)
+	}
+}
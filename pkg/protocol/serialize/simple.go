@@ -29,6 +29,8 @@ import (
 // singleton of simpleSerialization
 var Instance = simpleSerialization{}
 
+var errMalformedMap = errors.New("malformed map bytes")
+
 type simpleSerialization struct {
 }
 
@@ -118,9 +120,7 @@ func readInt32(b []byte) (int, error) {
 		return 0, errors.New("no enough bytes")
 	}
 
-	ba := b[:4]
-
-	return int(int8(ba[0])<<24 | int8(ba[1])<<16 | int8(ba[2])<<8 | int8(ba[3])), nil
+	return int(int32(binary.BigEndian.Uint32(b[:4]))), nil
 }
 
 func decodeString(b []byte, result *string) (int, error) {
@@ -143,6 +143,9 @@ func decodeMap(b []byte, result *map[string]string) error {
 		}
 		index += 4
 
+		if length < 0 || index+length > totalLen {
+			return errMalformedMap
+		}
 		key := b[index : index+length]
 		index += length
 
@@ -155,6 +158,9 @@ func decodeMap(b []byte, result *map[string]string) error {
 		}
 		index += 4
 
+		if index+length > totalLen {
+			return errMalformedMap
+		}
 		value := b[index : index+length]
 		index += length
 
@@ -108,3 +108,26 @@ func BenchmarkDeSerializeString(b *testing.B) {
 		Instance.DeSerialize(buf, &class)
 	}
 }
+
+func TestDeSerializeMalformedMap(t *testing.T) {
+	headers := map[string]string{
+		"service": "com.alipay.test.TestService:1.0",
+	}
+	buf, _ := Instance.Serialize(headers)
+
+	result := make(map[string]string)
+	if _, err := Instance.DeSerialize(buf, &result); err != nil || result["service"] != headers["service"] {
+		t.Fatalf("deserialize map failed: %v, %v", result, err)
+	}
+
+	// truncated value
+	result = make(map[string]string)
+	if _, err := Instance.DeSerialize(buf[:len(buf)-1], &result); err == nil {
+		t.Error("expect error for truncated map")
+	}
+
+	// negative key length
+	if _, err := Instance.DeSerialize([]byte{255, 255, 255, 254, 0, 0, 0, 0}, &result); err == nil {
+		t.Error("expect error for negative key length")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"reflect"
 	"strconv"
 	"sync"
@@ -79,6 +80,14 @@ type downStream struct {
 	downstreamRecvDone bool
 	// upstream req sent
 	upstreamRequestSent bool
+	requestSentTime     time.Time
+	// hosts of the failed attempts, avoided by the retries
+	triedHosts []types.Host
+	// host pinned by the upstream host header, bypasses the load balancer
+	overrideHost string
+	// request body received, and whether it is dropped by the cluster's request buffer policy
+	requestBodyLen        int
+	requestBodyUnbuffered bool
 	// 1. at the end of upstream response 2. by a upstream reset due to exceptions, such as no healthy upstream, connection close, etc.
 	upstreamProcessDone bool
 
@@ -102,6 +111,12 @@ type downStream struct {
 	logger           log.Logger
 
 	snapshot types.ClusterSnapshot
+
+	// ~~~ upstream response to cache, set if the route enables deduplication
+	responseCache        *responseCache
+	responseCacheKey     uint64
+	responseCacheHeaders types.HeaderMap
+	responseCacheData    []byte
 }
 
 func newActiveStream(ctx context.Context, proxy *proxy, responseSender types.StreamSender, spanBuilder types.SpanBuilder) *downStream {
@@ -122,7 +137,7 @@ func newActiveStream(ctx context.Context, proxy *proxy, responseSender types.Str
 	stream.requestInfo.SetStartTime()
 	stream.responseSender = responseSender
 	stream.responseSender.GetStream().AddEventListener(stream)
-	stream.context = ctx
+	stream.context = context.WithValue(ctx, types.ContextKeyRequestInfo, stream.requestInfo)
 
 	stream.logger = log.ByContext(proxy.context)
 
@@ -213,6 +228,8 @@ func (s *downStream) cleanStream() {
 	s.stopEventProcess()
 	// delete stream
 	s.proxy.deleteActiveStream(s)
+	// resume the upstream reading paused by this stream
+	s.proxy.onStreamDone(s)
 }
 
 // note: added before countdown metrics
@@ -270,25 +287,41 @@ func (s *downStream) ReceiveHeaders(headers types.HeaderMap, endStream bool) {
 
 func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, headers types.HeaderMap, endStream bool) {
 	log.DefaultLogger.Tracef("before active stream route")
+	var (
+		clusterSnapshot types.ClusterSnapshot
+		route           types.Route
+	)
 	if s.proxy.routersWrapper == nil || s.proxy.routersWrapper.GetRouters() == nil {
 		log.DefaultLogger.Errorf("doReceiveHeaders error: routersWrapper or routers in routersWrapper is nil")
-		s.requestInfo.SetResponseFlag(types.NoRouteFound)
-		s.sendHijackReply(types.RouterUnavailableCode, headers)
-		return
+	} else {
+		// get router instance and do routing
+		routers := s.proxy.routersWrapper.GetRouters()
+		// do handler chain
+		handlerChain := router.CallMakeHandlerChain(headers, routers, s.proxy.clusterManager)
+		// handlerChain should never be nil
+		if handlerChain == nil {
+			log.DefaultLogger.Errorf("no route to make handler chain, headers = %v", headers)
+		} else {
+			clusterSnapshot, route = handlerChain.DoNextHandler()
+		}
 	}
-
-	// get router instance and do routing
-	routers := s.proxy.routersWrapper.GetRouters()
-	// do handler chain
-	handlerChain := router.CallMakeHandlerChain(headers, routers, s.proxy.clusterManager)
-	// handlerChain should never be nil
-	if handlerChain == nil {
-		log.DefaultLogger.Errorf("no route to make handler chain, headers = %v", headers)
-		s.requestInfo.SetResponseFlag(types.NoRouteFound)
-		s.sendHijackReply(types.RouterUnavailableCode, headers)
-		return
+	// explicit cluster from trusted source overrides the route's cluster, other route policies are kept.
+	// it doesn't depend on the route, the default policies are used if no route matches
+	if clusterName := s.explicitCluster(headers); clusterName != "" {
+		if snapshot := s.proxy.clusterManager.GetClusterSnapshot(context.Background(), clusterName); snapshot != nil && !reflect.ValueOf(snapshot).IsNil() {
+			log.DefaultLogger.Debugf("use explicit cluster %s for stream, id = %d", clusterName, s.ID)
+			if clusterSnapshot != nil && !reflect.ValueOf(clusterSnapshot).IsNil() {
+				s.proxy.clusterManager.PutClusterSnapshot(clusterSnapshot)
+			}
+			clusterSnapshot = snapshot
+			if route == nil || reflect.ValueOf(route).IsNil() {
+				route = router.NewClusterRoute(clusterName)
+			}
+		} else {
+			log.DefaultLogger.Warnf("explicit cluster %s not found, use route cluster", clusterName)
+		}
 	}
-	clusterSnapshot, route := handlerChain.DoNextHandler()
+	s.overrideHost = s.upstreamHostOverride(headers)
 	s.route = route
 	// run stream filters after route is choosed
 	// the route maybe nil, but the stream filter should also be run
@@ -339,6 +372,20 @@ func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, header
 
 	s.cluster = clusterSnapshot.ClusterInfo()
 
+	// the duplicated request is answered with the cached response, never forwarded
+	if s.replayCachedResponse(route.RouteRule()) {
+		return
+	}
+
+	// the request is not forwarded if any header value can't be converted to upstream protocol
+	if dp, up := s.proxy.convertProtocol(); dp != up {
+		if err := protocol.CheckHeaderValues(dp, up, headers); err != nil {
+			log.DefaultLogger.Errorf("convert header from %s to %s failed, %v", dp, up, err)
+			s.sendHijackReply(types.CodecExceptionCode, headers)
+			return
+		}
+	}
+
 	s.requestInfo.SetRouteEntry(route.RouteRule())
 	s.requestInfo.SetDownstreamLocalAddress(s.proxy.readCallbacks.Connection().LocalAddr())
 	// todo: detect remote addr
@@ -380,12 +427,56 @@ func (s *downStream) doReceiveHeaders(filter *activeStreamReceiverFilter, header
 
 	if endStream {
 		s.onUpstreamRequestSent()
+		s.mirrorRequest()
+	}
+}
+
+// explicitCluster returns the cluster name in HeaderCluster if the downstream is a trusted source.
+// The header is always removed so that it won't be passed to upstream
+func (s *downStream) explicitCluster(headers types.HeaderMap) string {
+	if headers == nil {
+		return ""
+	}
+
+	clusterName, ok := headers.Get(types.HeaderCluster)
+	if !ok {
+		return ""
 	}
+	headers.Del(types.HeaderCluster)
+
+	if !isTrustedSource(s.proxy.trustedSources, s.proxy.readCallbacks.Connection().RemoteAddr()) {
+		log.DefaultLogger.Warnf("ignore %s from untrusted source %v", types.HeaderCluster, s.proxy.readCallbacks.Connection().RemoteAddr())
+		return ""
+	}
+
+	return clusterName
+}
+
+// upstreamHostOverride returns the host in HeaderUpstreamHost if the proxy allows host override.
+// The header is always removed so that it won't be passed to upstream
+func (s *downStream) upstreamHostOverride(headers types.HeaderMap) string {
+	if headers == nil {
+		return ""
+	}
+
+	host, ok := headers.Get(types.HeaderUpstreamHost)
+	if !ok {
+		return ""
+	}
+	headers.Del(types.HeaderUpstreamHost)
+
+	if !s.proxy.config.AllowHostOverride {
+		log.DefaultLogger.Debugf("ignore %s, host override is not allowed", types.HeaderUpstreamHost)
+		return ""
+	}
+
+	return host
 }
 
 func (s *downStream) OnReceiveData(context context.Context, data types.IoBuffer, endStream bool) {
+	// the data refers to the read buffer of the connection, which is reused once drained. The copy is
+	// passed to the worker, it is taken by the upstream request unless the buffer policy keeps it for retry
 	s.downstreamReqDataBuf = data.Clone()
-	s.downstreamReqDataBuf.Count(1)
 	data.Drain(data.Len())
 
 	workerPool.Offer(&receiveDataEvent{
@@ -423,6 +514,18 @@ func (s *downStream) doReceiveData(filter *activeStreamReceiverFilter, data type
 		s.onUpstreamRequestSent()
 	}
 
+	// only the last piece is kept, the body coming in pieces (e.g. the sofarpc streaming decode) can not be replayed
+	if !endStream {
+		s.requestBodyUnbuffered = true
+	}
+	if s.bufferRequestData(data) {
+		// the upstream request releases its reference once sent, the body is kept for retry
+		data.Count(1)
+	}
+	// copy the request before the data is taken by upstream
+	if endStream {
+		s.mirrorRequest()
+	}
 	s.upstreamRequest.appendData(data, endStream)
 
 	// if upstream process done in the middle of receiving data, just end stream
@@ -480,6 +583,7 @@ func (s *downStream) doReceiveTrailers(filter *activeStreamReceiverFilter, trail
 
 	s.downstreamReqTrailers = trailers
 	s.onUpstreamRequestSent()
+	s.mirrorRequest()
 	s.upstreamRequest.appendTrailers(trailers)
 
 	// if upstream process done in the middle of receiving trailers, just end stream
@@ -490,19 +594,20 @@ func (s *downStream) doReceiveTrailers(filter *activeStreamReceiverFilter, trail
 
 func (s *downStream) onUpstreamRequestSent() {
 	s.upstreamRequestSent = true
-	s.requestInfo.SetRequestReceivedDuration(time.Now())
+	s.requestSentTime = time.Now()
+	s.requestInfo.SetRequestReceivedDuration(s.requestSentTime)
 
 	if s.upstreamRequest != nil {
 		// setup per req timeout timer
 		s.setupPerReqTimeout()
 
-		// setup global timeout timer
-		if s.timeout.GlobalTimeout > 0 {
+		// setup global timeout timer, bounded by the deadline of the downstream request
+		if timeout, ok := s.remainingTimeout(); ok {
 			if s.responseTimer != nil {
 				s.responseTimer.stop()
 			}
 
-			s.responseTimer = newTimer(s.onResponseTimeout, s.timeout.GlobalTimeout)
+			s.responseTimer = newTimer(s.onResponseTimeout, timeout)
 			s.responseTimer.start()
 		}
 	}
@@ -524,19 +629,56 @@ func (s *downStream) onResponseTimeout() {
 	s.onUpstreamReset(UpstreamGlobalTimeout, types.StreamLocalReset)
 }
 
-func (s *downStream) setupPerReqTimeout() {
-	timeout := s.timeout
+// remainingTimeout returns the time left of the global timeout or of the deadline the downstream
+// request carries in the context, whichever comes first. Returns false if neither is set
+func (s *downStream) remainingTimeout() (time.Duration, bool) {
+	var remaining time.Duration
+	ok := false
+	if s.timeout.GlobalTimeout > 0 && !s.requestSentTime.IsZero() {
+		remaining, ok = s.timeout.GlobalTimeout-time.Since(s.requestSentTime), true
+	}
+	if s.context == nil {
+		return remaining, ok
+	}
+	if deadline, has := s.context.Deadline(); has {
+		if left := time.Until(deadline); !ok || left < remaining {
+			remaining, ok = left, true
+		}
+	}
+
+	return remaining, ok
+}
 
-	if timeout.TryTimeout > 0 {
+func (s *downStream) setupPerReqTimeout() {
+	if timeout, _ := s.tryTimeout(); timeout > 0 {
 		if s.perRetryTimer != nil {
 			s.perRetryTimer.stop()
 		}
 
-		s.perRetryTimer = newTimer(s.onPerReqTimeout, timeout.TryTimeout*time.Second)
+		s.perRetryTimer = newTimer(s.onPerReqTimeout, timeout)
 		s.perRetryTimer.start()
 	}
 }
 
+// tryTimeout returns the timeout of an upstream try, budgeted against the rest of the global timeout.
+// Returns false if the global timeout is used up, no more retry should be attempted
+func (s *downStream) tryTimeout() (time.Duration, bool) {
+	timeout := s.timeout.TryTimeout
+	remaining, ok := s.remainingTimeout()
+	if !ok {
+		return timeout, true
+	}
+
+	if remaining <= 0 {
+		return 0, false
+	}
+	if timeout > remaining {
+		timeout = remaining
+	}
+
+	return timeout, true
+}
+
 // Note: per-try-timer MUST be stopped before active stream got recycled, otherwise resetting stream's properties will cause panic here
 func (s *downStream) onPerReqTimeout() {
 	if !s.downstreamResponseStarted {
@@ -690,10 +832,16 @@ func (s *downStream) onUpstreamReset(urtype UpstreamResetType, reason types.Stre
 	// todo: update stats
 	log.DefaultLogger.Tracef("on upstream reset invoked")
 
+	// overflow is a local limit, not a failure of the host
+	if reason != types.StreamOverflow && s.upstreamRequest != nil {
+		s.excludeHost(s.upstreamRequest.host)
+		s.putOutlierTimeout()
+	}
+
 	// see if we need a retry
 	if urtype != UpstreamGlobalTimeout &&
-		!s.downstreamResponseStarted && s.retryState != nil {
-		retryCheck := s.retryState.retry(nil, reason, s.doRetry)
+		!s.downstreamResponseStarted && s.retryState != nil && s.retryBudget() {
+		retryCheck := s.retryState.retryWithStatus(nil, reason, upstreamResetStatus(urtype), s.doRetry)
 
 		if retryCheck == types.ShouldRetry && s.setupRetry(true) {
 			// setup retry timer and return
@@ -725,26 +873,46 @@ func (s *downStream) onUpstreamReset(urtype UpstreamResetType, reason types.Stre
 		s.resetStream()
 	} else {
 		// send err response if response not started
-		var code int
-
-		if urtype == UpstreamGlobalTimeout || urtype == UpstreamPerTryTimeout {
+		switch urtype {
+		case UpstreamGlobalTimeout, UpstreamPerTryTimeout:
 			s.requestInfo.SetResponseFlag(types.UpstreamRequestTimeout)
-			code = types.TimeoutExceptionCode
-		} else {
+		default:
 			reasonFlag := s.proxy.streamResetReasonToResponseFlag(reason)
 			s.requestInfo.SetResponseFlag(reasonFlag)
-			code = types.NoHealthUpstreamCode
 		}
 
-		s.sendHijackReply(code, s.downstreamReqHeaders)
+		s.sendHijackReply(upstreamResetStatus(urtype), s.downstreamReqHeaders)
+	}
+}
+
+// upstreamResetStatus returns the status code replied to downstream on the upstream reset
+func upstreamResetStatus(urtype UpstreamResetType) int {
+	switch urtype {
+	case UpstreamGlobalTimeout:
+		return types.TimeoutExceptionCode
+	case UpstreamPerTryTimeout:
+		return types.TryTimeoutExceptionCode
+	default:
+		return types.NoHealthUpstreamCode
+	}
+}
+
+// retryBudget returns true if the global timeout is not used up for a retry
+func (s *downStream) retryBudget() bool {
+	if s.timeout == nil {
+		return true
 	}
+	_, ok := s.tryTimeout()
+	return ok
 }
 
 func (s *downStream) onUpstreamHeaders(headers types.HeaderMap, endStream bool) {
 	s.downstreamRespHeaders = headers
+	s.putOutlierResult(headers, true)
+	s.drainUpstreamHost(headers)
 
 	// check retry
-	if s.retryState != nil {
+	if s.retryState != nil && s.retryBudget() {
 		retryCheck := s.retryState.retry(headers, "", s.doRetry)
 
 		if retryCheck == types.ShouldRetry && s.setupRetry(endStream) {
@@ -761,6 +929,7 @@ func (s *downStream) onUpstreamHeaders(headers types.HeaderMap, endStream bool)
 	s.downstreamResponseStarted = true
 
 	s.route.RouteRule().FinalizeResponseHeaders(headers, s.requestInfo)
+	s.cacheUpstreamResponse(headers, nil, endStream)
 	if endStream {
 		s.onUpstreamResponseRecvFinished()
 	}
@@ -770,6 +939,7 @@ func (s *downStream) onUpstreamHeaders(headers types.HeaderMap, endStream bool)
 }
 
 func (s *downStream) onUpstreamData(data types.IoBuffer, endStream bool) {
+	s.cacheUpstreamResponse(nil, data, endStream)
 	if endStream {
 		s.onUpstreamResponseRecvFinished()
 	}
@@ -823,11 +993,45 @@ func (s *downStream) onUpstreamResponseRecvFinished() {
 	s.finishTracing()
 }
 
+// bufferRequestData returns true if the request body is kept for retry by the request buffer policy of the route,
+// or the cluster's if the route doesn't override it. The request can not be retried once the body is not buffered,
+// the body is streamed to the upstream then
+func (s *downStream) bufferRequestData(data types.IoBuffer) bool {
+	s.requestBodyLen += data.Len()
+	if !s.requestBodyUnbuffered {
+		if policy, ok := s.requestBufferPolicy(); !ok || requestBodyBuffered(policy, s.requestBodyLen) {
+			return true
+		}
+	}
+
+	s.requestBodyUnbuffered = true
+	s.downstreamReqDataBuf = nil
+	return false
+}
+
+// requestBufferPolicy returns the request buffer policy of the stream, false if no cluster is chosen
+func (s *downStream) requestBufferPolicy() (v2.RequestBufferPolicy, bool) {
+	if s.route != nil {
+		if rule := s.route.RouteRule(); rule != nil && !reflect.ValueOf(rule).IsNil() && rule.Policy() != nil {
+			if policy := rule.Policy().RequestBufferPolicy(); policy != nil {
+				return *policy, true
+			}
+		}
+	}
+	if s.cluster == nil {
+		return v2.RequestBufferPolicy{}, false
+	}
+	return s.cluster.RequestBufferPolicy(), true
+}
+
 func (s *downStream) setupRetry(endStream bool) bool {
-	if !s.upstreamRequestSent {
+	if !s.upstreamRequestSent || s.requestBodyUnbuffered {
 		return false
 	}
 	s.upstreamRequest.setupRetry = true
+	if s.upstreamRequest.host != nil {
+		s.triedHosts = append(s.triedHosts, s.upstreamRequest.host)
+	}
 
 	if !endStream {
 		s.upstreamRequest.resetStream()
@@ -985,9 +1189,18 @@ func (s *downStream) reset() {
 	s.downstreamRespHeaders = nil
 	s.downstreamReqDataBuf = nil
 	s.downstreamReqTrailers = nil
+	s.requestBodyLen = 0
+	s.requestBodyUnbuffered = false
+	s.requestSentTime = time.Time{}
+	s.triedHosts = s.triedHosts[:0]
+	s.overrideHost = ""
 	s.downstreamRespHeaders = nil
 	s.downstreamRespDataBuf = nil
 	s.downstreamRespTrailers = nil
+	s.responseCache = nil
+	s.responseCacheKey = 0
+	s.responseCacheHeaders = nil
+	s.responseCacheData = nil
 	s.senderFilters = s.senderFilters[:0]
 	s.receiverFilters = s.receiverFilters[:0]
 }
@@ -1015,6 +1228,90 @@ func (s *downStream) DownstreamHeaders() types.HeaderMap {
 	return s.downstreamReqHeaders
 }
 
+// types.HostOverrideContext
+func (s *downStream) OverrideHost() string {
+	return s.overrideHost
+}
+
+// types.HostExclusionContext
+// the hosts failed in the previous attempts are excluded, so that the retry goes to another host
+func (s *downStream) IsHostExcluded(host types.Host) bool {
+	for _, tried := range s.triedHosts {
+		if tried.AddressString() == host.AddressString() {
+			return true
+		}
+	}
+	if policy := s.hostExclusionPolicy(); policy != nil {
+		return policy.IsExcluded(host)
+	}
+
+	return false
+}
+
+// excludeHost puts the failed host into the route's exclusion window if configured
+func (s *downStream) excludeHost(host types.Host) {
+	if host == nil {
+		return
+	}
+	if policy := s.hostExclusionPolicy(); policy != nil {
+		policy.Exclude(host)
+	}
+}
+
+// putOutlierResult reports the result of the upstream request to the cluster's outlier detector if enabled,
+// the response with a 5xx mapped status code is an error
+func (s *downStream) putOutlierResult(headers types.HeaderMap, success bool) {
+	if s.cluster == nil || s.upstreamRequest == nil || s.upstreamRequest.host == nil {
+		return
+	}
+	detector := s.cluster.OutlierDetector()
+	if detector == nil {
+		return
+	}
+	if headers != nil {
+		_, up := s.proxy.convertProtocol()
+		if code, err := protocol.MappingHeaderStatusCode(up, headers); err == nil && code >= http.StatusInternalServerError {
+			success = false
+		}
+	}
+
+	detector.PutResult(s.upstreamRequest.host, success)
+}
+
+// putOutlierTimeout reports the timeout or the reset of the upstream request to the cluster's outlier
+// detector if enabled
+func (s *downStream) putOutlierTimeout() {
+	if s.cluster == nil || s.upstreamRequest == nil || s.upstreamRequest.host == nil {
+		return
+	}
+	if detector := s.cluster.OutlierDetector(); detector != nil {
+		detector.PutTimeout(s.upstreamRequest.host)
+	}
+}
+
+// drainUpstreamHost stops routing new requests to the upstream host if its response signals it's shutting down
+func (s *downStream) drainUpstreamHost(headers types.HeaderMap) {
+	if s.cluster == nil || s.upstreamRequest == nil || s.upstreamRequest.host == nil || headers == nil {
+		return
+	}
+	drainer := s.cluster.HostDrainer()
+	if drainer == nil {
+		return
+	}
+	_, up := s.proxy.convertProtocol()
+	code, _ := protocol.MappingHeaderStatusCode(up, headers)
+
+	drainer.OnResponse(s.upstreamRequest.host, code, headers)
+}
+
+func (s *downStream) hostExclusionPolicy() types.HostExclusionPolicy {
+	if route := s.requestInfo.RouteEntry(); route != nil && route.Policy() != nil {
+		return route.Policy().HostExclusionPolicy()
+	}
+
+	return nil
+}
+
 func (s *downStream) GiveStream() {
 	if s.snapshot != nil {
 		s.proxy.clusterManager.PutClusterSnapshot(s.snapshot)
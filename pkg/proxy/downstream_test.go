@@ -19,14 +19,20 @@ package proxy
 
 import (
 	"context"
+	"net"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/network"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/router"
 	"github.com/alipay/sofa-mosn/pkg/trace"
 	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 func TestDownstream_FinishTracing_NotEnable(t *testing.T) {
@@ -139,3 +145,500 @@ func TestDirectResponse(t *testing.T) {
 		tc.check(t, tc.client)
 	}
 }
+
+func TestUpstreamTimeoutStatus(t *testing.T) {
+	testCases := []struct {
+		urtype UpstreamResetType
+		code   int
+	}{
+		{UpstreamGlobalTimeout, types.TimeoutExceptionCode},
+		{UpstreamPerTryTimeout, types.TryTimeoutExceptionCode},
+		{UpstreamReset, types.NoHealthUpstreamCode},
+	}
+	for _, tc := range testCases {
+		client := &mockResponseSender{}
+		s := &downStream{
+			proxy: &proxy{
+				config:         &v2.Proxy{},
+				routersWrapper: &mockRouterWrapper{},
+				clusterManager: &mockClusterManager{},
+				readCallbacks:  &mockReadFilterCallbacks{},
+			},
+			logger:               log.DefaultLogger,
+			responseSender:       client,
+			requestInfo:          &network.RequestInfo{},
+			downstreamReqHeaders: protocol.CommonHeader{},
+		}
+		s.onUpstreamReset(tc.urtype, types.StreamLocalReset)
+
+		if client.headers == nil {
+			t.Fatalf("%s: want to receive a hijack response", tc.urtype)
+		}
+		if code, _ := client.headers.Get(types.HeaderStatus); code != strconv.Itoa(tc.code) {
+			t.Errorf("%s: expect status %d, got %s", tc.urtype, tc.code, code)
+		}
+	}
+}
+
+func TestExplicitCluster(t *testing.T) {
+	trusted := parseTrustedSources([]string{"10.0.0.0/8", "127.0.0.1", "invalid"})
+	if len(trusted) != 2 {
+		t.Fatalf("expect 2 trusted sources, got %d", len(trusted))
+	}
+
+	testCases := []struct {
+		remoteAddr net.Addr
+		expected   string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12200}, "explicit"},
+		{&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 12200}, "explicit"},
+		{&net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 12200}, ""},
+		{nil, ""},
+	}
+	for i, tc := range testCases {
+		s := &downStream{
+			proxy: &proxy{
+				config:         &v2.Proxy{},
+				trustedSources: trusted,
+				readCallbacks: &mockReadFilterCallbacks{
+					conn: &mockConnection{remoteAddr: tc.remoteAddr},
+				},
+			},
+		}
+		headers := protocol.CommonHeader{types.HeaderCluster: "explicit"}
+		if cluster := s.explicitCluster(headers); cluster != tc.expected {
+			t.Errorf("#%d expect cluster %q, got %q", i, tc.expected, cluster)
+		}
+		if _, ok := headers.Get(types.HeaderCluster); ok {
+			t.Errorf("#%d explicit cluster header should be removed", i)
+		}
+	}
+
+	// no trusted sources configured, always ignored
+	s := &downStream{
+		proxy: &proxy{
+			config: &v2.Proxy{},
+			readCallbacks: &mockReadFilterCallbacks{
+				conn: &mockConnection{remoteAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}},
+			},
+		},
+	}
+	if cluster := s.explicitCluster(protocol.CommonHeader{types.HeaderCluster: "explicit"}); cluster != "" {
+		t.Errorf("expect explicit cluster ignored, got %q", cluster)
+	}
+}
+
+// routeClusterManager has the clusters of the names, and records the cluster of the upstream connection pool
+type routeClusterManager struct {
+	types.ClusterManager
+	clusters []string
+	pooled   string
+}
+
+func (m *routeClusterManager) GetClusterSnapshot(ctx context.Context, name string) types.ClusterSnapshot {
+	for _, cluster := range m.clusters {
+		if cluster == name {
+			return &namedClusterSnapshot{info: &namedClusterInfo{name: name}}
+		}
+	}
+	return nil
+}
+
+func (m *routeClusterManager) PutClusterSnapshot(snapshot types.ClusterSnapshot) {}
+
+func (m *routeClusterManager) ConnPoolForCluster(balancerContext types.LoadBalancerContext, snapshot types.ClusterSnapshot, protocol types.Protocol) types.ConnectionPool {
+	m.pooled = snapshot.ClusterInfo().Name()
+	return nil
+}
+
+type namedClusterSnapshot struct {
+	types.ClusterSnapshot
+	info types.ClusterInfo
+}
+
+func (s *namedClusterSnapshot) ClusterInfo() types.ClusterInfo {
+	return s.info
+}
+
+type namedClusterInfo struct {
+	types.ClusterInfo
+	name string
+}
+
+func (ci *namedClusterInfo) Name() string {
+	return ci.name
+}
+
+// routeRouters matches the route if not nil
+type routeRouters struct {
+	types.Routers
+	route types.Route
+}
+
+func (r *routeRouters) Route(types.HeaderMap, uint64) types.Route {
+	if r.route == nil {
+		return nil
+	}
+	return r.route
+}
+
+func TestExplicitClusterUpstream(t *testing.T) {
+	testCases := []struct {
+		route    types.Route
+		explicit string
+		pooled   string
+	}{
+		{router.NewClusterRoute("matched"), "", "matched"},
+		{router.NewClusterRoute("matched"), "explicit", "explicit"},
+		{router.NewClusterRoute("matched"), "unknown", "matched"},
+		// no route matches, the explicit cluster is used with the default policies
+		{nil, "explicit", "explicit"},
+		{nil, "unknown", ""},
+	}
+	for i, tc := range testCases {
+		client := &mockResponseSender{}
+		cm := &routeClusterManager{clusters: []string{"matched", "explicit"}}
+		s := &downStream{
+			proxy: &proxy{
+				config:         &v2.Proxy{},
+				routersWrapper: &mockRouterWrapper{routers: &routeRouters{route: tc.route}},
+				clusterManager: cm,
+				trustedSources: parseTrustedSources([]string{"127.0.0.1"}),
+				readCallbacks: &mockReadFilterCallbacks{
+					conn: &mockConnection{remoteAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}},
+				},
+			},
+			logger:         log.DefaultLogger,
+			responseSender: client,
+			requestInfo:    &network.RequestInfo{},
+		}
+		headers := protocol.CommonHeader{}
+		if tc.explicit != "" {
+			headers.Set(types.HeaderCluster, tc.explicit)
+		}
+		s.ReceiveHeaders(headers, false)
+
+		if cm.pooled != tc.pooled {
+			t.Errorf("#%d expect upstream cluster %q, got %q", i, tc.pooled, cm.pooled)
+		}
+		if tc.pooled == "" {
+			if code, _ := client.headers.Get(types.HeaderStatus); code != strconv.Itoa(types.RouterUnavailableCode) {
+				t.Errorf("#%d expect route unavailable, got %s", i, code)
+			}
+		}
+	}
+}
+
+func TestUpstreamHostOverride(t *testing.T) {
+	for _, allowed := range []bool{false, true} {
+		s := &downStream{
+			proxy: &proxy{
+				config: &v2.Proxy{AllowHostOverride: allowed},
+			},
+		}
+		headers := protocol.CommonHeader{types.HeaderUpstreamHost: "10.0.0.1:12200"}
+		expected := ""
+		if allowed {
+			expected = "10.0.0.1:12200"
+		}
+		if host := s.upstreamHostOverride(headers); host != expected {
+			t.Errorf("allowed %t: expect host %q, got %q", allowed, expected, host)
+		}
+		if _, ok := headers.Get(types.HeaderUpstreamHost); ok {
+			t.Errorf("allowed %t: upstream host header should be removed", allowed)
+		}
+	}
+}
+
+type bufferPolicyClusterInfo struct {
+	types.ClusterInfo
+	policy v2.RequestBufferPolicy
+}
+
+func (ci *bufferPolicyClusterInfo) RequestBufferPolicy() v2.RequestBufferPolicy {
+	return ci.policy
+}
+
+func TestRequestBufferPolicy(t *testing.T) {
+	testCases := []struct {
+		policy    v2.RequestBufferPolicy
+		bodies    []string
+		buffered  bool
+		retryable bool
+	}{
+		// route default, always buffer
+		{v2.RequestBufferPolicy{}, []string{"12345678"}, true, true},
+		{v2.RequestBufferPolicy{Mode: v2.BUFFER_ALWAYS}, []string{"12345678"}, true, true},
+		{v2.RequestBufferPolicy{Mode: v2.BUFFER_NEVER}, []string{"12345678"}, false, false},
+		{v2.RequestBufferPolicy{Mode: v2.BUFFER_LIMIT, LimitBytes: 8}, []string{"12345678"}, true, true},
+		{v2.RequestBufferPolicy{Mode: v2.BUFFER_LIMIT, LimitBytes: 8}, []string{"1234", "56789"}, false, false},
+		// no body
+		{v2.RequestBufferPolicy{Mode: v2.BUFFER_NEVER}, nil, false, true},
+	}
+
+	for i, tc := range testCases {
+		s := &downStream{
+			cluster:             &bufferPolicyClusterInfo{policy: tc.policy},
+			upstreamRequest:     &upstreamRequest{},
+			upstreamRequestSent: true,
+		}
+		for _, body := range tc.bodies {
+			s.downstreamReqDataBuf = buffer.NewIoBufferString(body)
+			s.bufferRequestData(s.downstreamReqDataBuf)
+		}
+		if buffered := s.downstreamReqDataBuf != nil; buffered != tc.buffered {
+			t.Errorf("#%d expect body buffered %v, got %v", i, tc.buffered, buffered)
+		}
+		if retryable := s.setupRetry(true); retryable != tc.retryable {
+			t.Errorf("#%d expect retryable %v, got %v", i, tc.retryable, retryable)
+		}
+	}
+}
+
+type bufferPolicy struct {
+	types.Policy
+	policy *v2.RequestBufferPolicy
+}
+
+func (p *bufferPolicy) RequestBufferPolicy() *v2.RequestBufferPolicy {
+	return p.policy
+}
+
+func TestRequestBufferPolicyRouteOverride(t *testing.T) {
+	testCases := []struct {
+		route    *v2.RequestBufferPolicy
+		cluster  v2.RequestBufferPolicy
+		buffered bool
+	}{
+		// the route overrides the cluster's
+		{&v2.RequestBufferPolicy{Mode: v2.BUFFER_ALWAYS}, v2.RequestBufferPolicy{Mode: v2.BUFFER_NEVER}, true},
+		{&v2.RequestBufferPolicy{Mode: v2.BUFFER_NEVER}, v2.RequestBufferPolicy{Mode: v2.BUFFER_ALWAYS}, false},
+		{&v2.RequestBufferPolicy{Mode: v2.BUFFER_LIMIT, LimitBytes: 4}, v2.RequestBufferPolicy{}, false},
+		// not overridden, the cluster's is used
+		{nil, v2.RequestBufferPolicy{Mode: v2.BUFFER_NEVER}, false},
+		{nil, v2.RequestBufferPolicy{Mode: v2.BUFFER_ALWAYS}, true},
+	}
+
+	for i, tc := range testCases {
+		s := &downStream{
+			cluster: &bufferPolicyClusterInfo{policy: tc.cluster},
+			route: &mockRoute{
+				rule: &mirrorRouteRule{policy: &bufferPolicy{policy: tc.route}},
+			},
+		}
+		data := buffer.NewIoBufferString("12345678")
+		s.downstreamReqDataBuf = data
+		if buffered := s.bufferRequestData(data); buffered != tc.buffered {
+			t.Errorf("#%d expect body buffered %v, got %v", i, tc.buffered, buffered)
+		}
+		if kept := s.downstreamReqDataBuf != nil; kept != tc.buffered {
+			t.Errorf("#%d expect body kept %v, got %v", i, tc.buffered, kept)
+		}
+	}
+}
+
+func TestRequestBodyUnbufferedReleased(t *testing.T) {
+	s := &downStream{
+		cluster:             &bufferPolicyClusterInfo{policy: v2.RequestBufferPolicy{Mode: v2.BUFFER_LIMIT, LimitBytes: 4}},
+		upstreamRequest:     &upstreamRequest{},
+		upstreamRequestSent: true,
+	}
+	data := buffer.NewIoBufferString("12345678")
+	s.downstreamReqDataBuf = data
+	if s.bufferRequestData(data) {
+		t.Fatal("body over the limit should not be buffered")
+	}
+	// streamed straight to the upstream, the upstream request holds the only reference
+	if s.downstreamReqDataBuf != nil {
+		t.Error("unbuffered body should not be kept")
+	}
+	if data.Count(-1) != 0 {
+		t.Error("unbuffered body should not be retained")
+	}
+	// once unbuffered, the following pieces are never kept
+	if s.bufferRequestData(buffer.NewIoBufferString("1")) {
+		t.Error("body should not be buffered after it's unbuffered")
+	}
+	if s.setupRetry(true) {
+		t.Error("unbuffered request should not be retried")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	s := &downStream{
+		timeout:         &Timeout{GlobalTimeout: 100 * time.Millisecond, TryTimeout: 80 * time.Millisecond},
+		requestSentTime: time.Now().Add(-50 * time.Millisecond),
+	}
+	// the per try timeout is cut by the rest of the global timeout
+	if timeout, ok := s.tryTimeout(); !ok || timeout > 50*time.Millisecond || timeout <= 0 {
+		t.Errorf("unexpected try timeout %v, %v", timeout, ok)
+	}
+
+	s.requestSentTime = time.Now().Add(-200 * time.Millisecond)
+	if s.retryBudget() {
+		t.Error("retry should not be attempted after the global timeout")
+	}
+
+	s.timeout = &Timeout{TryTimeout: 80 * time.Millisecond}
+	if timeout, ok := s.tryTimeout(); !ok || timeout != 80*time.Millisecond {
+		t.Errorf("expect the per try timeout without global timeout, got %v, %v", timeout, ok)
+	}
+}
+
+type addrHost struct {
+	types.Host
+	addr string
+}
+
+func (h *addrHost) AddressString() string {
+	return h.addr
+}
+
+func TestRetryExcludesTriedHost(t *testing.T) {
+	tried := &addrHost{addr: "127.0.0.1:12200"}
+	s := &downStream{
+		cluster:             &bufferPolicyClusterInfo{},
+		requestInfo:         &network.RequestInfo{},
+		upstreamRequest:     &upstreamRequest{host: tried},
+		upstreamRequestSent: true,
+	}
+	if s.IsHostExcluded(tried) {
+		t.Fatal("host should not be excluded before retry")
+	}
+	if !s.setupRetry(true) {
+		t.Fatal("request should be retryable")
+	}
+	if !s.IsHostExcluded(&addrHost{addr: "127.0.0.1:12200"}) {
+		t.Error("the tried host should be excluded by the retry")
+	}
+	if s.IsHostExcluded(&addrHost{addr: "127.0.0.2:12200"}) {
+		t.Error("other host should not be excluded")
+	}
+}
+
+// stalledStream never responds, records the reset
+type stalledStream struct {
+	mockStream
+	reset chan types.StreamResetReason
+}
+
+func (s *stalledStream) ResetStream(reason types.StreamResetReason) {
+	s.reset <- reason
+}
+
+type stalledSender struct {
+	mockResponseSender
+	stream *stalledStream
+}
+
+func (s *stalledSender) GetStream() types.Stream {
+	return s.stream
+}
+
+// hijackSender signals the response replied to downstream
+type hijackSender struct {
+	mockResponseSender
+	replied chan types.HeaderMap
+}
+
+func (s *hijackSender) AppendHeaders(ctx context.Context, headers types.HeaderMap, endStream bool) error {
+	s.replied <- headers
+	return nil
+}
+
+type outlierClusterInfo struct {
+	types.ClusterInfo
+	stats    types.ClusterStats
+	detector types.OutlierDetector
+}
+
+func (ci *outlierClusterInfo) Stats() types.ClusterStats {
+	return ci.stats
+}
+
+func (ci *outlierClusterInfo) OutlierDetector() types.OutlierDetector {
+	return ci.detector
+}
+
+type resultDetector struct {
+	results chan string
+}
+
+func (d *resultDetector) PutResult(host types.Host, success bool) {
+	if success {
+		d.results <- "success"
+	} else {
+		d.results <- "error"
+	}
+}
+
+func (d *resultDetector) PutTimeout(host types.Host) {
+	d.results <- "timeout"
+}
+
+type statsHost struct {
+	addrHost
+	stats types.HostStats
+}
+
+func (h *statsHost) HostStats() types.HostStats {
+	return h.stats
+}
+
+func TestDeadlineCancelsStalledUpstream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	stream := &stalledStream{reset: make(chan types.StreamResetReason, 1)}
+	host := &statsHost{stats: types.HostStats{UpstreamRequestTimeout: metrics.NewCounter()}}
+	detector := &resultDetector{results: make(chan string, 1)}
+	client := &hijackSender{replied: make(chan types.HeaderMap, 1)}
+	s := &downStream{
+		context: ctx,
+		proxy: &proxy{
+			config:         &v2.Proxy{},
+			routersWrapper: &mockRouterWrapper{},
+			clusterManager: &mockClusterManager{},
+			readCallbacks:  &mockReadFilterCallbacks{},
+		},
+		cluster: &outlierClusterInfo{
+			stats:    types.ClusterStats{UpstreamRequestTimeout: metrics.NewCounter()},
+			detector: detector,
+		},
+		// no timeout configured on the route, the request deadline bounds the upstream
+		timeout:              &Timeout{},
+		logger:               log.DefaultLogger,
+		responseSender:       client,
+		requestInfo:          &network.RequestInfo{},
+		downstreamReqHeaders: protocol.CommonHeader{},
+	}
+	s.upstreamRequest = &upstreamRequest{
+		downStream:    s,
+		host:          host,
+		requestSender: &stalledSender{stream: stream},
+	}
+	start := time.Now()
+	s.onUpstreamRequestSent()
+
+	select {
+	case reason := <-stream.reset:
+		if reason != types.StreamLocalReset {
+			t.Errorf("expect local reset, got %v", reason)
+		}
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > time.Second {
+			t.Errorf("expect the upstream canceled at the deadline, took %v", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the stalled upstream is not canceled")
+	}
+	if result := <-detector.results; result != "timeout" {
+		t.Errorf("expect the timeout reported to the outlier detector, got %s", result)
+	}
+	headers := <-client.replied
+	if code, _ := headers.Get(types.HeaderStatus); code != strconv.Itoa(types.TimeoutExceptionCode) {
+		t.Errorf("expect timeout status, got %s", code)
+	}
+	if count := host.stats.UpstreamRequestTimeout.Count(); count != 1 {
+		t.Errorf("expect the host timeout counted, got %d", count)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"sync"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// readDisabler is implemented by the streams supporting disable the read of the underlying connection
+type readDisabler interface {
+	ReadDisable(disable bool)
+}
+
+// flowControl tracks the upstream streams of a downstream connection. While the bytes pending write of
+// the downstream connection are above the high watermark, reading from the upstreams is paused, so the
+// responses of a slow client are not buffered without limit. Notice the upstream connection may be shared
+// by other downstreams, they are paused too until the slow client drains below the low watermark.
+type flowControl struct {
+	mux   sync.Mutex
+	above bool
+	// upstream stream of the active downstream streams
+	upstreams map[*downStream]readDisabler
+	// upstream streams with read disabled by the flow control
+	paused map[*downStream]readDisabler
+}
+
+func (p *proxy) onAboveWriteBufferHighWatermark() {
+	fc := &p.flowControl
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+
+	if fc.above {
+		return
+	}
+	fc.above = true
+
+	for ds, stream := range fc.upstreams {
+		p.pauseUpstreamReading(ds, stream)
+	}
+	p.stats.DownstreamFlowControlPausedReading.Inc(1)
+	p.listenerStats.DownstreamFlowControlPausedReading.Inc(1)
+}
+
+func (p *proxy) onBelowWriteBufferLowWatermark() {
+	fc := &p.flowControl
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+
+	if !fc.above {
+		return
+	}
+	fc.above = false
+
+	for ds, stream := range fc.paused {
+		stream.ReadDisable(false)
+		delete(fc.paused, ds)
+	}
+	p.stats.DownstreamFlowControlResumedReading.Inc(1)
+	p.listenerStats.DownstreamFlowControlResumedReading.Inc(1)
+}
+
+// onUpstreamReady records the upstream stream of the downstream stream, the stream is paused at once
+// if the downstream connection is above the high watermark
+func (p *proxy) onUpstreamReady(ds *downStream, upstream types.Stream) {
+	stream, ok := upstream.(readDisabler)
+	if !ok {
+		return
+	}
+
+	fc := &p.flowControl
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+
+	// the previous upstream stream is replaced on retry
+	p.resumeUpstreamReading(ds)
+
+	if fc.upstreams == nil {
+		fc.upstreams = make(map[*downStream]readDisabler)
+	}
+	fc.upstreams[ds] = stream
+
+	if fc.above {
+		p.pauseUpstreamReading(ds, stream)
+	}
+}
+
+// onStreamDone forgets the upstream stream of the downstream stream, resumes it if paused
+func (p *proxy) onStreamDone(ds *downStream) {
+	fc := &p.flowControl
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+
+	p.resumeUpstreamReading(ds)
+	delete(fc.upstreams, ds)
+}
+
+// pauseUpstreamReading and resumeUpstreamReading should be called with the flow control lock held
+func (p *proxy) pauseUpstreamReading(ds *downStream, stream readDisabler) {
+	fc := &p.flowControl
+	if _, ok := fc.paused[ds]; ok {
+		return
+	}
+
+	if fc.paused == nil {
+		fc.paused = make(map[*downStream]readDisabler)
+	}
+	stream.ReadDisable(true)
+	fc.paused[ds] = stream
+}
+
+func (p *proxy) resumeUpstreamReading(ds *downStream) {
+	fc := &p.flowControl
+	if stream, ok := fc.paused[ds]; ok {
+		stream.ReadDisable(false)
+		delete(fc.paused, ds)
+	}
+}
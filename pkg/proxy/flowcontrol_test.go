@@ -0,0 +1,85 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// readDisableStream records the read disable count of the upstream connection
+type readDisableStream struct {
+	mockStream
+	disabled int
+}
+
+func (s *readDisableStream) ReadDisable(disable bool) {
+	if disable {
+		s.disabled++
+	} else {
+		s.disabled--
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	p := &proxy{
+		stats:         newProxyStats("test_flow_control"),
+		listenerStats: newListenerStats("test_flow_control"),
+	}
+	ds1, ds2 := &downStream{}, &downStream{}
+	up1, up2 := &readDisableStream{}, &readDisableStream{}
+
+	p.onUpstreamReady(ds1, up1)
+	p.onDownstreamEvent(types.WriteBufferAboveHighWatermark)
+	p.onDownstreamEvent(types.WriteBufferAboveHighWatermark)
+	if up1.disabled != 1 {
+		t.Errorf("expect upstream paused once, got %d", up1.disabled)
+	}
+
+	// upstream ready while above the high watermark is paused at once
+	p.onUpstreamReady(ds2, up2)
+	if up2.disabled != 1 {
+		t.Errorf("expect new upstream paused, got %d", up2.disabled)
+	}
+
+	// stream done resumes its upstream
+	p.onStreamDone(ds2)
+	if up2.disabled != 0 {
+		t.Errorf("expect upstream resumed on stream done, got %d", up2.disabled)
+	}
+
+	p.onDownstreamEvent(types.WriteBufferBelowLowWatermark)
+	p.onDownstreamEvent(types.WriteBufferBelowLowWatermark)
+	if up1.disabled != 0 || up2.disabled != 0 {
+		t.Errorf("expect upstreams resumed, got %d, %d", up1.disabled, up2.disabled)
+	}
+	if paused := p.stats.DownstreamFlowControlPausedReading.Count(); paused != 1 {
+		t.Errorf("expect 1 paused, got %d", paused)
+	}
+	if resumed := p.stats.DownstreamFlowControlResumedReading.Count(); resumed != 1 {
+		t.Errorf("expect 1 resumed, got %d", resumed)
+	}
+
+	// upstream ready below the watermark is not paused
+	up3 := &readDisableStream{}
+	p.onUpstreamReady(ds1, up3)
+	if up3.disabled != 0 {
+		t.Errorf("expect upstream not paused, got %d", up3.disabled)
+	}
+}
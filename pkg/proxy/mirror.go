@@ -0,0 +1,268 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// maxMirrorInflight is the max mirrored requests waiting for the shadow responses,
+// new mirrors are dropped rather than queued once it's reached
+const maxMirrorInflight = 1024
+
+var mirrorInflight int32
+
+// mirrorRequest is a copy of the downstream request sent to the shadow cluster,
+// the shadow response is discarded and never reaches the downstream
+// types.StreamReceiveListener
+// types.StreamEventListener
+// types.PoolEventListener
+// types.LoadBalancerContext
+type mirrorRequest struct {
+	context  context.Context
+	headers  types.HeaderMap
+	data     types.IoBuffer
+	trailers types.HeaderMap
+	timer    *time.Timer
+	done     int32
+
+	mux    sync.Mutex
+	sender types.StreamSender
+}
+
+// mirrorRequest sends a copy of the request to the shadow cluster of the route if the request is sampled.
+// It's best-effort and never blocks the downstream: the copy is dropped if it can't be built,
+// the shadow cluster is not found or too many mirrors are in flight
+func (s *downStream) mirrorRequest() {
+	if s.route == nil || s.requestBodyUnbuffered || s.downstreamReqHeaders == nil {
+		return
+	}
+	rule := s.route.RouteRule()
+	if rule == nil || reflect.ValueOf(rule).IsNil() {
+		return
+	}
+	policy := rule.Policy().ShadowPolicy()
+	if policy == nil || !mirrorSampled(s.mirrorKey(), policy.Percent()) {
+		return
+	}
+
+	if atomic.AddInt32(&mirrorInflight, 1) > maxMirrorInflight {
+		atomic.AddInt32(&mirrorInflight, -1)
+		log.DefaultLogger.Debugf("too many mirrored requests in flight, drop the mirror to %s", policy.ClusterName())
+		return
+	}
+
+	m, err := s.newMirrorRequest()
+	if err != nil {
+		atomic.AddInt32(&mirrorInflight, -1)
+		log.DefaultLogger.Warnf("build mirror request to %s failed, %v", policy.ClusterName(), err)
+		return
+	}
+
+	timeout := rule.GlobalTimeout()
+	if timeout <= 0 {
+		timeout = types.DefaultRouteTimeout
+	}
+	_, up := s.proxy.convertProtocol()
+	go m.send(s.proxy.clusterManager, policy.ClusterName(), up, timeout)
+}
+
+// mirrorKey is the request id of the downstream request, 0 if unknown
+func (s *downStream) mirrorKey() uint64 {
+	if s.responseSender == nil {
+		return 0
+	}
+	return uint64(s.responseSender.GetStream().ID())
+}
+
+// mirrorSampled samples the request by the request id, so that the retried request with the same id
+// is mirrored or not consistently. The requests without id are sampled randomly
+func mirrorSampled(key uint64, percent uint32) bool {
+	if percent >= 100 {
+		return true
+	}
+	if key == 0 {
+		return uint32(rand.Intn(100)) < percent
+	}
+	return key%100 < uint64(percent)
+}
+
+// newMirrorRequest copies the request and marks it as shadow, converted to the upstream protocol
+func (s *downStream) newMirrorRequest() (*mirrorRequest, error) {
+	dp, up := s.proxy.convertProtocol()
+
+	headers := s.downstreamReqHeaders.Clone()
+	headers.Set(types.HeaderShadow, "true")
+	if dp != up {
+		convHeader, err := protocol.ConvertHeader(s.context, dp, up, headers)
+		if err != nil {
+			return nil, err
+		}
+		headers = convHeader
+	}
+
+	m := &mirrorRequest{
+		context: s.proxy.context,
+		headers: headers,
+	}
+
+	if s.downstreamReqDataBuf != nil {
+		m.data = s.downstreamReqDataBuf.Clone()
+		if dp != up {
+			convData, err := protocol.ConvertData(s.context, dp, up, m.data)
+			if err != nil {
+				return nil, err
+			}
+			m.data = convData
+		}
+	}
+
+	if s.downstreamReqTrailers != nil {
+		m.trailers = s.downstreamReqTrailers.Clone()
+		if dp != up {
+			convTrailer, err := protocol.ConvertTrailer(s.context, dp, up, m.trailers)
+			if err != nil {
+				return nil, err
+			}
+			m.trailers = convTrailer
+		}
+	}
+
+	return m, nil
+}
+
+func (m *mirrorRequest) send(clusterManager types.ClusterManager, clusterName string, prot types.Protocol, timeout time.Duration) {
+	snapshot := clusterManager.GetClusterSnapshot(context.Background(), clusterName)
+	if snapshot == nil || reflect.ValueOf(snapshot).IsNil() {
+		log.DefaultLogger.Warnf("shadow cluster %s not found, drop the mirror", clusterName)
+		m.finish()
+		return
+	}
+	defer clusterManager.PutClusterSnapshot(snapshot)
+
+	pool := clusterManager.ConnPoolForCluster(m, snapshot, prot)
+	if pool == nil {
+		log.DefaultLogger.Debugf("no healthy upstream in shadow cluster %s, drop the mirror", clusterName)
+		m.finish()
+		return
+	}
+
+	m.timer = time.AfterFunc(timeout, m.onTimeout)
+	pool.NewStream(m.context, m, m)
+}
+
+// finish releases the in flight mirror, called once
+func (m *mirrorRequest) finish() {
+	if !atomic.CompareAndSwapInt32(&m.done, 0, 1) {
+		return
+	}
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	atomic.AddInt32(&mirrorInflight, -1)
+}
+
+func (m *mirrorRequest) onTimeout() {
+	m.mux.Lock()
+	sender := m.sender
+	m.mux.Unlock()
+
+	if sender != nil {
+		sender.GetStream().RemoveEventListener(m)
+		sender.GetStream().ResetStream(types.StreamLocalReset)
+	}
+	m.finish()
+}
+
+// types.PoolEventListener
+func (m *mirrorRequest) OnFailure(reason types.PoolFailureReason, host types.Host) {
+	log.DefaultLogger.Debugf("mirror request failed, reason %v", reason)
+	m.finish()
+}
+
+func (m *mirrorRequest) OnReady(sender types.StreamSender, host types.Host) {
+	m.mux.Lock()
+	m.sender = sender
+	m.mux.Unlock()
+
+	sender.GetStream().AddEventListener(m)
+
+	sender.AppendHeaders(m.context, m.headers, m.data == nil && m.trailers == nil)
+	if m.data != nil {
+		sender.AppendData(m.context, m.data, m.trailers == nil)
+	}
+	if m.trailers != nil {
+		sender.AppendTrailers(m.context, m.trailers)
+	}
+}
+
+// types.StreamReceiveListener, the shadow response is discarded
+func (m *mirrorRequest) OnReceiveHeaders(context context.Context, headers types.HeaderMap, endStream bool) {
+	if endStream {
+		m.finish()
+	}
+}
+
+func (m *mirrorRequest) OnReceiveData(context context.Context, data types.IoBuffer, endStream bool) {
+	data.Drain(data.Len())
+	if endStream {
+		m.finish()
+	}
+}
+
+func (m *mirrorRequest) OnReceiveTrailers(context context.Context, trailers types.HeaderMap) {
+	m.finish()
+}
+
+func (m *mirrorRequest) OnDecodeError(context context.Context, err error, headers types.HeaderMap) {
+	m.finish()
+}
+
+// types.StreamEventListener
+func (m *mirrorRequest) OnResetStream(reason types.StreamResetReason) {
+	m.finish()
+}
+
+func (m *mirrorRequest) OnDestroyStream() {}
+
+// types.LoadBalancerContext
+func (m *mirrorRequest) ComputeHashKey() types.HashedValue {
+	return ""
+}
+
+func (m *mirrorRequest) MetadataMatchCriteria() types.MetadataMatchCriteria {
+	return nil
+}
+
+func (m *mirrorRequest) DownstreamConnection() net.Conn {
+	return nil
+}
+
+func (m *mirrorRequest) DownstreamHeaders() types.HeaderMap {
+	return m.headers
+}
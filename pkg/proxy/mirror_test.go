@@ -0,0 +1,172 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type mockShadowPolicy struct {
+	types.Policy
+	cluster string
+	percent uint32
+}
+
+func (p *mockShadowPolicy) ShadowPolicy() types.ShadowPolicy {
+	return p
+}
+
+func (p *mockShadowPolicy) ClusterName() string {
+	return p.cluster
+}
+
+func (p *mockShadowPolicy) RuntimeKey() string {
+	return ""
+}
+
+func (p *mockShadowPolicy) Percent() uint32 {
+	return p.percent
+}
+
+type mirrorRouteRule struct {
+	mockRouteRule
+	policy types.Policy
+}
+
+func (r *mirrorRouteRule) Policy() types.Policy {
+	return r.policy
+}
+
+func (r *mirrorRouteRule) GlobalTimeout() time.Duration {
+	return time.Second
+}
+
+func (r *mirrorRouteRule) TimeoutOverride() (time.Duration, time.Duration) {
+	return 0, 0
+}
+
+// mirrorClusterManager returns the pool of the shadow cluster
+type mirrorClusterManager struct {
+	mockClusterManager
+	pool *mirrorConnPool
+}
+
+func (m *mirrorClusterManager) ConnPoolForCluster(balancerContext types.LoadBalancerContext, snapshot types.ClusterSnapshot, protocol types.Protocol) types.ConnectionPool {
+	return m.pool
+}
+
+// mirrorConnPool records the request sent on the stream
+type mirrorConnPool struct {
+	types.ConnectionPool
+	sent chan *mockResponseSender
+}
+
+func (p *mirrorConnPool) NewStream(ctx context.Context, receiver types.StreamReceiveListener, listener types.PoolEventListener) {
+	sender := &mockResponseSender{}
+	listener.OnReady(sender, nil)
+	p.sent <- sender
+	// the shadow response is discarded
+	receiver.OnReceiveHeaders(ctx, protocol.CommonHeader{"status": "ok"}, true)
+}
+
+func TestMirrorSampled(t *testing.T) {
+	sampled := 0
+	for id := uint64(1); id <= 1000; id++ {
+		if mirrorSampled(id, 30) {
+			sampled++
+		}
+		if mirrorSampled(id, 30) != mirrorSampled(id, 30) {
+			t.Fatalf("request %d is not sampled deterministically", id)
+		}
+		if !mirrorSampled(id, 100) {
+			t.Fatalf("request %d should be sampled on 100 percent", id)
+		}
+	}
+	if sampled != 300 {
+		t.Errorf("expect 300 requests sampled, got %d", sampled)
+	}
+}
+
+func TestMirrorRequest(t *testing.T) {
+	pool := &mirrorConnPool{sent: make(chan *mockResponseSender, 1)}
+	p := &proxy{
+		config:         &v2.Proxy{DownstreamProtocol: "Http1", UpstreamProtocol: "Http1"},
+		clusterManager: &mirrorClusterManager{pool: pool},
+		readCallbacks:  &mockReadFilterCallbacks{},
+		context:        context.Background(),
+	}
+	newStream := func(rule types.RouteRule) *downStream {
+		return &downStream{
+			proxy:                p,
+			responseSender:       &mockResponseSender{streamID: 1},
+			route:                &mockRoute{rule: rule},
+			downstreamReqHeaders: protocol.CommonHeader{"service": "test"},
+			downstreamReqDataBuf: buffer.NewIoBufferString("hello"),
+		}
+	}
+
+	s := newStream(&mirrorRouteRule{policy: &mockShadowPolicy{cluster: "shadow", percent: 100}})
+	s.mirrorRequest()
+	select {
+	case sender := <-pool.sent:
+		if v, _ := sender.headers.Get(types.HeaderShadow); v != "true" {
+			t.Errorf("mirrored request should be marked as shadow: %v", sender.headers)
+		}
+		if v, _ := sender.headers.Get("service"); v != "test" {
+			t.Errorf("unexpected mirrored headers: %v", sender.headers)
+		}
+		if sender.data == nil || sender.data.String() != "hello" {
+			t.Errorf("unexpected mirrored data: %v", sender.data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request is not mirrored")
+	}
+	// the downstream request is not changed
+	if _, ok := s.downstreamReqHeaders.Get(types.HeaderShadow); ok {
+		t.Error("downstream request should not be marked as shadow")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&mirrorInflight); n != 0 {
+		t.Errorf("expect no mirror in flight after the shadow response, got %d", n)
+	}
+
+	// request not sampled and route without mirror policy
+	newStream(&mirrorRouteRule{policy: &mockShadowPolicy{cluster: "shadow", percent: 1}}).mirrorRequest()
+	newStream(&mirrorRouteRule{policy: &mockNoShadowPolicy{}}).mirrorRequest()
+	select {
+	case <-pool.sent:
+		t.Error("request should not be mirrored")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type mockNoShadowPolicy struct {
+	types.Policy
+}
+
+func (p *mockNoShadowPolicy) ShadowPolicy() types.ShadowPolicy {
+	return nil
+}
@@ -19,6 +19,7 @@ package proxy
 
 import (
 	"context"
+	"net"
 
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
@@ -108,6 +109,7 @@ type mockResponseSender struct {
 	headers  types.HeaderMap
 	data     types.IoBuffer
 	trailers types.HeaderMap
+	streamID uint64
 }
 
 func (s *mockResponseSender) AppendHeaders(ctx context.Context, headers types.HeaderMap, endStream bool) error {
@@ -126,29 +128,53 @@ func (s *mockResponseSender) AppendTrailers(ctx context.Context, trailers types.
 }
 
 func (s *mockResponseSender) GetStream() types.Stream {
-	return &mockStream{}
+	return &mockStream{id: s.streamID}
 }
 
 type mockStream struct {
 	types.Stream
+	id uint64
+}
+
+func (s *mockStream) ID() uint64 {
+	return s.id
 }
 
 func (s *mockStream) ResetStream(reason types.StreamResetReason) {
 	// do nothing
 }
 
+func (s *mockStream) AddEventListener(listener types.StreamEventListener) {
+}
+
+func (s *mockStream) RemoveEventListener(listener types.StreamEventListener) {
+}
+
 type mockReadFilterCallbacks struct {
 	types.ReadFilterCallbacks
+	conn types.Connection
 }
 
 func (cb *mockReadFilterCallbacks) Connection() types.Connection {
+	if cb.conn != nil {
+		return cb.conn
+	}
 	return &mockConnection{}
 }
 
 type mockConnection struct {
 	types.Connection
+	remoteAddr net.Addr
 }
 
 func (c *mockConnection) ID() uint64 {
 	return 0
 }
+
+func (c *mockConnection) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *mockConnection) LocalAddr() net.Addr {
+	return nil
+}
@@ -20,6 +20,7 @@ package proxy
 import (
 	"container/list"
 	"context"
+	"net"
 	"runtime"
 	"sync"
 
@@ -73,6 +74,14 @@ type proxy struct {
 	stats              *Stats
 	listenerStats      *Stats
 	accessLogs         []types.AccessLog
+	trustedSources     []*net.IPNet
+
+	// response caches of the routes with deduplication policy
+	responseCaches    map[types.DeduplicationPolicy]*responseCache
+	responseCachesMux sync.Mutex
+
+	// pauses reading from the upstreams while the downstream connection writes slowly
+	flowControl flowControl
 }
 
 // NewProxy create proxy instance for given v2.Proxy config
@@ -97,6 +106,8 @@ func NewProxy(ctx context.Context, config *v2.Proxy, clusterManager types.Cluste
 		log.DefaultLogger.Errorf("get proxy extend config fail = %v", err)
 	}
 
+	proxy.trustedSources = parseTrustedSources(proxy.config.TrustedSources)
+
 	listenerName := ctx.Value(types.ContextKeyListenerName).(string)
 	proxy.listenerStats = newListenerStats(listenerName)
 
@@ -163,6 +174,14 @@ func (p *proxy) onDownstreamEvent(event types.ConnectionEvent) {
 		for _, ds := range downStreams {
 			ds.OnResetStream(types.StreamConnectionTermination)
 		}
+		return
+	}
+
+	switch event {
+	case types.WriteBufferAboveHighWatermark:
+		p.onAboveWriteBufferHighWatermark()
+	case types.WriteBufferBelowLowWatermark:
+		p.onBelowWriteBufferLowWatermark()
 	}
 }
 
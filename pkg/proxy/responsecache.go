@@ -0,0 +1,166 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// cachedResponse is an upstream response kept by the request id
+type cachedResponse struct {
+	key     uint64
+	headers types.HeaderMap
+	data    []byte
+	expire  time.Time
+}
+
+// responseCache is a LRU cache with TTL of the upstream responses on a downstream connection,
+// used by the route with DeduplicationPolicy
+type responseCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mux     sync.Mutex
+	lru     *list.List // front is the most recently used
+	entries map[uint64]*list.Element
+}
+
+func newResponseCache(policy types.DeduplicationPolicy) *responseCache {
+	return &responseCache{
+		ttl:        policy.TTL(),
+		maxEntries: policy.MaxEntries(),
+		lru:        list.New(),
+		entries:    make(map[uint64]*list.Element),
+	}
+}
+
+func (c *responseCache) get(key uint64) (*cachedResponse, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ele, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	resp := ele.Value.(*cachedResponse)
+	if time.Now().After(resp.expire) {
+		c.lru.Remove(ele)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(ele)
+
+	return resp, true
+}
+
+func (c *responseCache) put(key uint64, headers types.HeaderMap, data []byte) {
+	resp := &cachedResponse{
+		key:     key,
+		headers: headers,
+		data:    data,
+		expire:  time.Now().Add(c.ttl),
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if ele, ok := c.entries[key]; ok {
+		ele.Value = resp
+		c.lru.MoveToFront(ele)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(resp)
+
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// responseCache returns the response cache of the route policy on the downstream connection
+func (p *proxy) responseCache(policy types.DeduplicationPolicy) *responseCache {
+	p.responseCachesMux.Lock()
+	defer p.responseCachesMux.Unlock()
+
+	if p.responseCaches == nil {
+		p.responseCaches = make(map[types.DeduplicationPolicy]*responseCache)
+	}
+	cache, ok := p.responseCaches[policy]
+	if !ok {
+		cache = newResponseCache(policy)
+		p.responseCaches[policy] = cache
+	}
+
+	return cache
+}
+
+// replayCachedResponse answers the duplicated request with the cached response if the route enables deduplication.
+// Otherwise the stream is marked to cache the upstream response, returns false.
+// A duplicated request arriving before the first response is received is still forwarded
+func (s *downStream) replayCachedResponse(rule types.RouteRule) bool {
+	if rule.Policy() == nil {
+		return false
+	}
+	policy := rule.Policy().DeduplicationPolicy()
+	if policy == nil {
+		return false
+	}
+
+	cache := s.proxy.responseCache(policy)
+	key := s.responseSender.GetStream().ID()
+	resp, ok := cache.get(key)
+	if !ok {
+		s.responseCache = cache
+		s.responseCacheKey = key
+		return false
+	}
+
+	s.logger.Debugf("replay cached response for duplicated request, id = %d", key)
+	s.downstreamResponseStarted = true
+	if resp.data == nil {
+		s.appendHeaders(resp.headers.Clone(), true)
+		return true
+	}
+	s.appendHeaders(resp.headers.Clone(), false)
+	s.appendData(buffer.NewIoBufferBytes(append([]byte(nil), resp.data...)), true)
+
+	return true
+}
+
+// cacheUpstreamResponse copies the upstream response headers and data, the response is cached on the end of stream
+func (s *downStream) cacheUpstreamResponse(headers types.HeaderMap, data types.IoBuffer, endStream bool) {
+	if s.responseCache == nil {
+		return
+	}
+	if headers != nil {
+		s.responseCacheHeaders = headers.Clone()
+	}
+	if data != nil {
+		s.responseCacheData = append(s.responseCacheData, data.Bytes()...)
+	}
+	if endStream && s.responseCacheHeaders != nil {
+		s.responseCache.put(s.responseCacheKey, s.responseCacheHeaders, s.responseCacheData)
+		s.responseCache = nil
+	}
+}
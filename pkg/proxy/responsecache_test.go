@@ -0,0 +1,132 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/network"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type mockDeduplicationPolicy struct {
+	types.Policy
+	ttl        time.Duration
+	maxEntries int
+}
+
+func (p *mockDeduplicationPolicy) DeduplicationPolicy() types.DeduplicationPolicy {
+	return p
+}
+
+func (p *mockDeduplicationPolicy) TTL() time.Duration {
+	return p.ttl
+}
+
+func (p *mockDeduplicationPolicy) MaxEntries() int {
+	return p.maxEntries
+}
+
+type deduplicationRouteRule struct {
+	mockRouteRule
+	policy types.Policy
+}
+
+func (r *deduplicationRouteRule) Policy() types.Policy {
+	return r.policy
+}
+
+func TestResponseCache(t *testing.T) {
+	cache := newResponseCache(&mockDeduplicationPolicy{ttl: 50 * time.Millisecond, maxEntries: 2})
+	headers := protocol.CommonHeader{"k": "v"}
+
+	cache.put(1, headers, nil)
+	cache.put(2, headers, []byte("2"))
+	// 1 is used recently, 2 is evicted
+	if _, ok := cache.get(1); !ok {
+		t.Fatal("expect response 1 cached")
+	}
+	cache.put(3, headers, []byte("3"))
+	if _, ok := cache.get(2); ok {
+		t.Error("expect the least recently used response 2 evicted")
+	}
+	if resp, ok := cache.get(3); !ok || string(resp.data) != "3" {
+		t.Errorf("unexpected response 3: %v", resp)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.get(1); ok {
+		t.Error("expect response 1 expired")
+	}
+	if len(cache.entries) != 1 || cache.lru.Len() != 1 {
+		t.Errorf("expect expired entry removed, got %d entries", len(cache.entries))
+	}
+}
+
+func TestReplayCachedResponse(t *testing.T) {
+	p := &proxy{
+		config:         &v2.Proxy{},
+		routersWrapper: &mockRouterWrapper{},
+		clusterManager: &mockClusterManager{},
+		readCallbacks:  &mockReadFilterCallbacks{},
+	}
+	rule := &deduplicationRouteRule{policy: &mockDeduplicationPolicy{ttl: time.Minute, maxEntries: 8}}
+	newStream := func(client *mockResponseSender) *downStream {
+		return &downStream{
+			proxy:          p,
+			logger:         log.DefaultLogger,
+			responseSender: client,
+			requestInfo:    &network.RequestInfo{},
+		}
+	}
+
+	// the first request is forwarded, the response is cached on the end of stream
+	s := newStream(&mockResponseSender{streamID: 7})
+	if s.replayCachedResponse(rule) {
+		t.Fatal("the first request should not be replayed")
+	}
+	s.cacheUpstreamResponse(protocol.CommonHeader{"status": "ok"}, nil, false)
+	s.cacheUpstreamResponse(nil, buffer.NewIoBufferString("hello "), false)
+	s.cacheUpstreamResponse(nil, buffer.NewIoBufferString("world"), true)
+
+	// the duplicated request is answered with the cached response
+	client := &mockResponseSender{streamID: 7}
+	if !newStream(client).replayCachedResponse(rule) {
+		t.Fatal("the duplicated request should be replayed")
+	}
+	if v, _ := client.headers.Get("status"); v != "ok" {
+		t.Errorf("unexpected replayed headers: %v", client.headers)
+	}
+	if client.data == nil || client.data.String() != "hello world" {
+		t.Errorf("unexpected replayed data: %v", client.data)
+	}
+
+	// other request id is forwarded
+	if newStream(&mockResponseSender{streamID: 8}).replayCachedResponse(rule) {
+		t.Error("request 8 should not be replayed")
+	}
+	// route without deduplication
+	if newStream(&mockResponseSender{streamID: 7}).replayCachedResponse(&deduplicationRouteRule{}) {
+		t.Error("route without deduplication should not be replayed")
+	}
+}
@@ -34,6 +34,11 @@ type retryState struct {
 	retryFunc        func()
 	retryTimer       *timer
 	upstreamProtocol types.Protocol
+	// upstream attempts of the request, the first request and the retries
+	attempts    uint32
+	maxAttempts uint32
+	// retryable status codes, empty means the default policy
+	retryOnStatus []int
 }
 
 func newRetryState(retryPolicy types.RetryPolicy,
@@ -45,9 +50,12 @@ func newRetryState(retryPolicy types.RetryPolicy,
 		retryOn:          retryPolicy.RetryOn(),
 		retiesRemaining:  3,
 		upstreamProtocol: proto,
+		attempts:         1, // the first request
+		maxAttempts:      retryPolicy.MaxAttempts(),
+		retryOnStatus:    retryPolicy.RetryOnStatus(),
 	}
 
-	if retryPolicy.NumRetries() > rs.retiesRemaining {
+	if retryPolicy.NumRetries() > 0 {
 		rs.retiesRemaining = retryPolicy.NumRetries()
 	}
 
@@ -55,9 +63,15 @@ func newRetryState(retryPolicy types.RetryPolicy,
 }
 
 func (r *retryState) retry(headers types.HeaderMap, reason types.StreamResetReason, doRetry func()) types.RetryCheckStatus {
+	return r.retryWithStatus(headers, reason, 0, doRetry)
+}
+
+// retryWithStatus is retry with the status code replied to downstream if the upstream request is reset,
+// e.g. types.NoHealthUpstreamCode, checked against the retryable status codes of the policy
+func (r *retryState) retryWithStatus(headers types.HeaderMap, reason types.StreamResetReason, resetStatus int, doRetry func()) types.RetryCheckStatus {
 	r.reset()
 
-	check := r.shouldRetry(headers, reason)
+	check := r.shouldRetry(headers, reason, resetStatus)
 
 	if check != 0 {
 		return check
@@ -68,14 +82,14 @@ func (r *retryState) retry(headers types.HeaderMap, reason types.StreamResetReas
 	return 0
 }
 
-func (r *retryState) shouldRetry(headers types.HeaderMap, reason types.StreamResetReason) types.RetryCheckStatus {
+func (r *retryState) shouldRetry(headers types.HeaderMap, reason types.StreamResetReason, resetStatus int) types.RetryCheckStatus {
 	if r.retiesRemaining == 0 {
 		return types.NoRetry
 	}
 
 	r.retiesRemaining--
 
-	if !r.doRetryCheck(headers, reason) {
+	if !r.doRetryCheck(headers, reason, resetStatus) {
 		return types.NoRetry
 	}
 
@@ -85,6 +99,11 @@ func (r *retryState) shouldRetry(headers types.HeaderMap, reason types.StreamRes
 		return types.RetryOverflow
 	}
 
+	if r.maxAttempts > 0 && r.attempts >= r.maxAttempts {
+		return types.NoRetry
+	}
+	r.attempts++
+
 	return types.ShouldRetry
 }
 
@@ -101,11 +120,15 @@ func (r *retryState) scheduleRetry(doRetry func()) *timer {
 	return timer
 }
 
-func (r *retryState) doRetryCheck(headers types.HeaderMap, reason types.StreamResetReason) bool {
+func (r *retryState) doRetryCheck(headers types.HeaderMap, reason types.StreamResetReason, resetStatus int) bool {
 	if reason == types.StreamOverflow {
 		return false
 	}
 
+	if r.retryOn && len(r.retryOnStatus) > 0 {
+		return r.retryableStatus(headers, resetStatus)
+	}
+
 	if r.retryOn {
 		// TODO: add retry policy to decide retry or not. use default policy now
 		if headers != nil {
@@ -125,6 +148,26 @@ func (r *retryState) doRetryCheck(headers types.HeaderMap, reason types.StreamRe
 	return false
 }
 
+// retryableStatus returns true if the status of the response, or the reset status if no response, is retryable
+func (r *retryState) retryableStatus(headers types.HeaderMap, resetStatus int) bool {
+	status := resetStatus
+	if headers != nil {
+		code, err := protocol.MappingHeaderStatusCode(r.upstreamProtocol, headers)
+		if err != nil {
+			return false
+		}
+		status = code
+	}
+
+	for _, code := range r.retryOnStatus {
+		if code == status {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (r *retryState) reset() {
 	if r.retryFunc != nil {
 		r.cluster.ResourceManager().Retries().Decrease()
@@ -100,3 +100,75 @@ func TestRetryState(t *testing.T) {
 		}
 	}
 }
+
+func TestRetryStateMaxAttempts(t *testing.T) {
+	rcfg := &v2.Router{}
+	rcfg.Route.RetryPolicy = &v2.RetryPolicy{
+		RetryPolicyConfig: v2.RetryPolicyConfig{
+			RetryOn:     true,
+			NumRetries:  10,
+			MaxAttempts: 3,
+		},
+	}
+	r, _ := router.NewRouteRuleImplBase(nil, rcfg)
+	clusterInfo := &fakeClusterInfo{
+		mgr: &fakeResourceManager{},
+	}
+	rs := newRetryState(r.Policy().RetryPolicy(), nil, clusterInfo, protocol.HTTP1)
+
+	// the first request and two retries
+	for i := 0; i < 2; i++ {
+		if rs.retry(nil, types.StreamConnectionFailed, doNothing) != types.ShouldRetry {
+			t.Fatalf("#%d retry should be allowed within the max attempts", i)
+		}
+	}
+	if rs.retry(nil, types.StreamConnectionFailed, doNothing) != types.NoRetry {
+		t.Error("retry should be rejected by the max attempts before the num retries")
+	}
+	rs.reset()
+}
+
+func TestRetryStateOnStatus(t *testing.T) {
+	rcfg := &v2.Router{}
+	rcfg.Route.RetryPolicy = &v2.RetryPolicy{
+		RetryPolicyConfig: v2.RetryPolicyConfig{
+			RetryOn:       true,
+			NumRetries:    10,
+			RetryOnStatus: []int{types.RouterUnavailableCode, types.NoHealthUpstreamCode},
+		},
+	}
+	r, _ := router.NewRouteRuleImplBase(nil, rcfg)
+	clusterInfo := &fakeClusterInfo{
+		mgr: &fakeResourceManager{},
+	}
+	rs := newRetryState(r.Policy().RetryPolicy(), nil, clusterInfo, protocol.HTTP1)
+
+	testcases := []struct {
+		Header      types.HeaderMap
+		ResetStatus int
+		Expected    types.RetryCheckStatus
+	}{
+		{protocol.CommonHeader{types.HeaderStatus: "404"}, 0, types.ShouldRetry},
+		{protocol.CommonHeader{types.HeaderStatus: "500"}, 0, types.NoRetry},
+		{nil, types.NoHealthUpstreamCode, types.ShouldRetry},
+		{nil, types.TryTimeoutExceptionCode, types.NoRetry},
+	}
+	for i, tc := range testcases {
+		if rs.retryWithStatus(tc.Header, types.StreamConnectionFailed, tc.ResetStatus, doNothing) != tc.Expected {
+			t.Errorf("#%d retry state failed", i)
+		}
+	}
+	rs.reset()
+
+	// the max retry count is honored
+	rcfg.Route.RetryPolicy.NumRetries = 1
+	r, _ = router.NewRouteRuleImplBase(nil, rcfg)
+	rs = newRetryState(r.Policy().RetryPolicy(), nil, clusterInfo, protocol.HTTP1)
+	if rs.retryWithStatus(nil, types.StreamConnectionFailed, types.NoHealthUpstreamCode, doNothing) != types.ShouldRetry {
+		t.Error("the first retry should be allowed")
+	}
+	if rs.retryWithStatus(nil, types.StreamConnectionFailed, types.NoHealthUpstreamCode, doNothing) != types.NoRetry {
+		t.Error("retry should be rejected by the max retry count")
+	}
+	rs.reset()
+}
@@ -33,6 +33,9 @@ type Stats struct {
 	DownstreamRequestActive     metrics.Counter
 	DownstreamRequestReset      metrics.Counter
 	DownstreamRequestTime       metrics.Histogram
+
+	DownstreamFlowControlPausedReading  metrics.Counter
+	DownstreamFlowControlResumedReading metrics.Counter
 }
 
 func newListenerStats(listenerName string) *Stats {
@@ -55,5 +58,8 @@ func newStats(s types.Metrics) *Stats {
 		DownstreamRequestActive:     s.Counter(stats.DownstreamRequestActive),
 		DownstreamRequestReset:      s.Counter(stats.DownstreamRequestReset),
 		DownstreamRequestTime:       s.Histogram(stats.DownstreamRequestTime),
+
+		DownstreamFlowControlPausedReading:  s.Counter(stats.DownstreamFlowControlPausedReading),
+		DownstreamFlowControlResumedReading: s.Counter(stats.DownstreamFlowControlResumedReading),
 	}
 }
@@ -340,16 +340,20 @@ func (f *activeStreamReceiverFilter) handleBufferData(buf types.IoBuffer) {
 	}
 }
 
+// the response appended by the filter ends the stream without the upstream, the same as the hijack reply
 func (f *activeStreamReceiverFilter) AppendHeaders(headers types.HeaderMap, endStream bool) {
+	f.activeStream.upstreamProcessDone = endStream
 	f.activeStream.downstreamRespHeaders = headers
 	f.activeStream.doAppendHeaders(nil, headers, endStream)
 }
 
 func (f *activeStreamReceiverFilter) AppendData(buf types.IoBuffer, endStream bool) {
+	f.activeStream.upstreamProcessDone = endStream
 	f.activeStream.doAppendData(nil, buf, endStream)
 }
 
 func (f *activeStreamReceiverFilter) AppendTrailers(trailers types.HeaderMap) {
+	f.activeStream.upstreamProcessDone = true
 	f.activeStream.downstreamRespTrailers = trailers
 	f.activeStream.doAppendTrailers(nil, trailers)
 }
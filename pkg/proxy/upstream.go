@@ -223,6 +223,7 @@ func (r *upstreamRequest) convertTrailer(trailers types.HeaderMap) types.HeaderM
 // types.PoolEventListener
 func (r *upstreamRequest) OnFailure(reason types.PoolFailureReason, host types.Host) {
 	var resetReason types.StreamResetReason
+	r.host = host
 
 	switch reason {
 	case types.Overflow:
@@ -236,7 +237,9 @@ func (r *upstreamRequest) OnFailure(reason types.PoolFailureReason, host types.H
 
 func (r *upstreamRequest) OnReady(sender types.StreamSender, host types.Host) {
 	r.requestSender = sender
+	r.host = host
 	r.requestSender.GetStream().AddEventListener(r)
+	r.proxy.onUpstreamReady(r.downStream, r.requestSender.GetStream())
 
 	endStream := r.sendComplete && !r.dataSent && !r.trailerSent
 	r.requestSender.AppendHeaders(r.downStream.context, r.convertHeader(r.downStream.downstreamReqHeaders), endStream)
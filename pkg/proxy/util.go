@@ -18,41 +18,111 @@
 package proxy
 
 import (
+	"net"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
 var bitSize64 = 1 << 6
 
+// parseProxyTimeout returns the timeouts the proxy enforces on the request. The precedence is:
+// route override > client header (in seconds) > route default, clients often send overly generous timeouts
 func parseProxyTimeout(route types.Route, headers types.HeaderMap) *Timeout {
 	timeout := &Timeout{}
 	timeout.GlobalTimeout = route.RouteRule().GlobalTimeout()
+	// the per try timeout of the retry policy
 	timeout.TryTimeout = route.RouteRule().Policy().RetryPolicy().TryTimeout()
 
-	// todo: check global timeout in request headers
-	// todo: check per try timeout in request headers
-
 	if tto, ok := headers.Get(types.HeaderTryTimeout); ok {
 		if trytimeout, err := strconv.ParseInt(tto, 10, bitSize64); err == nil {
-			timeout.TryTimeout = time.Duration(trytimeout)
+			timeout.TryTimeout = time.Duration(trytimeout) * time.Second
 		}
 	}
 
 	if gto, ok := headers.Get(types.HeaderGlobalTimeout); ok {
 		if globaltimeout, err := strconv.ParseInt(gto, 10, bitSize64); err == nil {
-			timeout.GlobalTimeout = time.Duration(globaltimeout)
+			timeout.GlobalTimeout = time.Duration(globaltimeout) * time.Second
 		}
 	}
 
-	if timeout.TryTimeout >= timeout.GlobalTimeout {
+	tryOverride, globalOverride := route.RouteRule().TimeoutOverride()
+	if tryOverride > 0 {
+		timeout.TryTimeout = tryOverride
+	}
+	if globalOverride > 0 {
+		timeout.GlobalTimeout = globalOverride
+	}
+
+	if timeout.GlobalTimeout > 0 && timeout.TryTimeout >= timeout.GlobalTimeout {
 		timeout.TryTimeout = 0
 	}
 
 	return timeout
 }
 
+// parseTrustedSources parses ip or cidr strings, invalid ones are ignored
+func parseTrustedSources(sources []string) []*net.IPNet {
+	var trusted []*net.IPNet
+	for _, source := range sources {
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil {
+				if ip.To4() != nil {
+					source += "/32"
+				} else {
+					source += "/128"
+				}
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			log.DefaultLogger.Errorf("invalid proxy trusted source %s: %v", source, err)
+			continue
+		}
+		trusted = append(trusted, ipNet)
+	}
+
+	return trusted
+}
+
+func isTrustedSource(trusted []*net.IPNet, addr net.Addr) bool {
+	if len(trusted) == 0 || addr == nil {
+		return false
+	}
+
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return false
+		}
+		ip = net.ParseIP(host)
+	}
+
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type timer struct {
 	callback func()
 	interval time.Duration
@@ -87,3 +157,15 @@ func (t *timer) stop() {
 
 	t.stopChan <- true
 }
+
+// requestBodyBuffered returns true if the request body of bodyLen bytes should be buffered for retry
+func requestBodyBuffered(policy v2.RequestBufferPolicy, bodyLen int) bool {
+	switch policy.Mode {
+	case v2.BUFFER_NEVER:
+		return bodyLen == 0
+	case v2.BUFFER_LIMIT:
+		return bodyLen <= int(policy.LimitBytes)
+	default:
+		return true
+	}
+}
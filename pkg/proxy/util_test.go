@@ -0,0 +1,101 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/router"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type timeoutRoute struct {
+	types.Route
+	rule types.RouteRule
+}
+
+func (r *timeoutRoute) RouteRule() types.RouteRule {
+	return r.rule
+}
+
+func TestParseProxyTimeoutPrecedence(t *testing.T) {
+	newRoute := func(override *v2.TimeoutOverride) types.Route {
+		rcfg := &v2.Router{}
+		rcfg.Route.Timeout = 10 * time.Second
+		rcfg.Route.RetryPolicy = &v2.RetryPolicy{RetryTimeout: 3 * time.Second}
+		rcfg.Route.TimeoutOverride = override
+		rule, _ := router.NewRouteRuleImplBase(nil, rcfg)
+		return &timeoutRoute{rule: rule}
+	}
+	clientHeaders := protocol.CommonHeader{
+		types.HeaderTryTimeout:    "4",
+		types.HeaderGlobalTimeout: "20",
+	}
+
+	testCases := []struct {
+		name     string
+		override *v2.TimeoutOverride
+		headers  types.HeaderMap
+		expected Timeout
+	}{
+		{
+			name:     "route default",
+			headers:  protocol.CommonHeader{},
+			expected: Timeout{GlobalTimeout: 10 * time.Second, TryTimeout: 3 * time.Second},
+		},
+		{
+			name:     "client header",
+			headers:  clientHeaders,
+			expected: Timeout{GlobalTimeout: 20 * time.Second, TryTimeout: 4 * time.Second},
+		},
+		{
+			name:     "route override",
+			override: &v2.TimeoutOverride{TryTimeout: time.Second, GlobalTimeout: 2 * time.Second},
+			headers:  clientHeaders,
+			expected: Timeout{GlobalTimeout: 2 * time.Second, TryTimeout: time.Second},
+		},
+		{
+			name:     "partial override",
+			override: &v2.TimeoutOverride{GlobalTimeout: 5 * time.Second},
+			headers:  clientHeaders,
+			expected: Timeout{GlobalTimeout: 5 * time.Second, TryTimeout: 4 * time.Second},
+		},
+		{
+			name:     "override without header",
+			override: &v2.TimeoutOverride{TryTimeout: time.Second},
+			headers:  protocol.CommonHeader{},
+			expected: Timeout{GlobalTimeout: 10 * time.Second, TryTimeout: time.Second},
+		},
+		{
+			name:     "try timeout not less than global timeout",
+			override: &v2.TimeoutOverride{GlobalTimeout: 4 * time.Second},
+			headers:  clientHeaders,
+			expected: Timeout{GlobalTimeout: 4 * time.Second},
+		},
+	}
+
+	for _, tc := range testCases {
+		timeout := parseProxyTimeout(newRoute(tc.override), tc.headers)
+		if *timeout != tc.expected {
+			t.Errorf("%s: expect %+v, got %+v", tc.name, tc.expected, *timeout)
+		}
+	}
+}
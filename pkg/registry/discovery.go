@@ -0,0 +1,287 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registry
+
+import (
+	"net"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/config"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	zookeeper "github.com/alipay/sofa-mosn/pkg/registry/zk"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	"github.com/alipay/sofa-mosn/pkg/upstream/cluster"
+	jerrors "github.com/juju/errors"
+)
+
+// DefaultRoot is the root of the dubbo services in the registry
+const DefaultRoot = "/dubbo"
+
+// discovery watches the providers of the clusters in the registry and updates the hosts of the clusters,
+// the providers of a cluster are the children of <root>/<cluster>/providers, i.e. the cluster is named
+// after the dubbo interface. The watches are moved to the new client once the registry is reconnected
+type discovery struct {
+	registry *Registry
+	root     string
+	update   func(clusterName string, priority uint32, hosts []v2.Host) error
+
+	// updateMux serializes the updates of the watches and the refreshes
+	updateMux sync.Mutex
+	clusters  map[string]bool
+
+	mux   sync.Mutex
+	nodes map[string]*providerNodes // by cluster name
+}
+
+// providerNodes are the provider nodes of a cluster by host address
+type providerNodes struct {
+	nodes   map[string]string
+	changed chan struct{} // closed once the nodes are replaced
+}
+
+// discover starts watching the providers of the clusters, the discovery refresher and the watch of the
+// provider node data are installed by cluster.SetDiscoveryRefresher and cluster.SetHostDataWatcher
+func (r *Registry) discover(root string, clusters []string, update func(string, uint32, []v2.Host) error) {
+	d := &discovery{
+		registry: r,
+		root:     root,
+		update:   update,
+		clusters: make(map[string]bool, len(clusters)),
+		nodes:    make(map[string]*providerNodes, len(clusters)),
+	}
+	for _, name := range clusters {
+		d.clusters[name] = true
+		d.nodes[name] = &providerNodes{changed: make(chan struct{})}
+	}
+	cluster.SetDiscoveryRefresher(d.refresh)
+	cluster.SetHostDataWatcher(d.watchHostData)
+
+	for name := range d.clusters {
+		r.wait.Add(1)
+		go d.watchProviders(name)
+	}
+}
+
+func (d *discovery) providersPath(clusterName string) string {
+	return path.Join(d.root, clusterName, "providers")
+}
+
+// watchProviders updates the hosts of the cluster on every change of the providers until the registry is closed,
+// the hosts are kept while the registry is reconnecting
+func (d *discovery) watchProviders(clusterName string) {
+	defer d.registry.wait.Done()
+
+	zkPath := d.providersPath(clusterName)
+	for {
+		client, changed := d.registry.current()
+		if client != nil {
+			children, stop := client.WatchChildrenDurable(zkPath)
+			for watching := true; watching; {
+				select {
+				case <-d.registry.done:
+					stop()
+					return
+				case c, ok := <-children:
+					if !ok {
+						// the client is closed
+						watching = false
+						break
+					}
+					d.setProviders(clusterName, c)
+				}
+			}
+			stop()
+		}
+
+		select {
+		case <-d.registry.done:
+			return
+		case <-changed:
+		}
+	}
+}
+
+// refresh reads the providers of the cluster again, e.g. the host failed to connect repeatedly
+func (d *discovery) refresh(clusterName string) {
+	if !d.clusters[clusterName] {
+		return
+	}
+	client := d.registry.Client()
+	if client == nil {
+		log.DefaultLogger.Warnf("registry is reconnecting, cluster %s is not refreshed", clusterName)
+		return
+	}
+	children, err := client.GetChildren(d.providersPath(clusterName))
+	if err != nil && jerrors.Cause(err) != zookeeper.ErrNodeNotExist {
+		log.DefaultLogger.Errorf("refresh cluster %s from the registry failed: %v", clusterName, err)
+		return
+	}
+	d.setProviders(clusterName, children)
+}
+
+// setProviders updates the hosts of the cluster to the enabled providers, the provider disabled in its url
+// is not a host, while the one disabled in its node data is kept as the host disabled by the live weight
+func (d *discovery) setProviders(clusterName string, children []string) {
+	d.updateMux.Lock()
+	defer d.updateMux.Unlock()
+
+	providers := zookeeper.EnabledProviders(zookeeper.ParseProviderURLs(children))
+	hosts := make([]v2.Host, 0, len(providers))
+	nodes := make(map[string]string, len(providers))
+	for _, p := range providers {
+		addr := net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+		hosts = append(hosts, v2.Host{
+			HostConfig: v2.HostConfig{
+				Address: addr,
+				Weight:  providerWeight(p.Weight),
+			},
+		})
+		nodes[addr] = p.Node
+	}
+	d.setNodes(clusterName, nodes)
+
+	log.DefaultLogger.Infof("cluster %s discovered %d hosts from the registry", clusterName, len(hosts))
+	if err := d.update(clusterName, 0, hosts); err != nil {
+		log.DefaultLogger.Errorf("update the hosts of cluster %s failed: %v", clusterName, err)
+	}
+}
+
+// providerWeight bounds the dubbo weight of the provider, 100 by default, to the host weight
+func providerWeight(weight int32) uint32 {
+	if weight < int32(config.MinHostWeight) {
+		return config.MinHostWeight
+	}
+	if weight > int32(config.MaxHostWeight) {
+		return config.MaxHostWeight
+	}
+	return uint32(weight)
+}
+
+func (d *discovery) setNodes(clusterName string, nodes map[string]string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	close(d.nodes[clusterName].changed)
+	d.nodes[clusterName] = &providerNodes{
+		nodes:   nodes,
+		changed: make(chan struct{}),
+	}
+}
+
+// node returns the provider node of the host with the channel closed once the nodes of the cluster change,
+// false if the host is not discovered
+func (d *discovery) node(clusterName string, addr string) (string, <-chan struct{}, bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes := d.nodes[clusterName]
+	node, ok := nodes.nodes[addr]
+	return node, nodes.changed, ok
+}
+
+// watchHostData watches the data of the provider node of the host, the watch is moved to the new node
+// once the provider registers again, and to the new client once the registry is reconnected
+func (d *discovery) watchHostData(clusterName string, host types.Host) (<-chan []byte, func()) {
+	var (
+		once sync.Once
+		quit = make(chan struct{})
+		ch   = make(chan []byte, 1)
+	)
+
+	if !d.clusters[clusterName] {
+		close(ch)
+	} else {
+		go d.forwardHostData(clusterName, host.AddressString(), ch, quit)
+	}
+
+	return ch, func() {
+		once.Do(func() {
+			close(quit)
+		})
+	}
+}
+
+func (d *discovery) forwardHostData(clusterName string, addr string, ch chan []byte, quit chan struct{}) {
+	defer close(ch)
+
+	for {
+		client, clientChanged := d.registry.current()
+		node, nodesChanged, ok := d.node(clusterName, addr)
+		if client == nil || !ok {
+			// wait for the reconnection or the registration of the host
+			select {
+			case <-quit:
+				return
+			case <-d.registry.done:
+				return
+			case <-clientChanged:
+			case <-nodesChanged:
+			}
+			continue
+		}
+
+		data, stop := client.WatchDataDurable(path.Join(d.providersPath(clusterName), node))
+		for watching := true; watching; {
+			select {
+			case <-quit:
+				stop()
+				return
+			case <-d.registry.done:
+				stop()
+				return
+			case <-nodesChanged:
+				var current string
+				current, nodesChanged, _ = d.node(clusterName, addr)
+				watching = current == node
+			case b, ok := <-data:
+				if !ok {
+					// the client is closed, wait for the new one
+					select {
+					case <-quit:
+						return
+					case <-d.registry.done:
+						return
+					case <-clientChanged:
+					}
+					watching = false
+					break
+				}
+				sendLatestData(ch, b)
+			}
+		}
+		stop()
+	}
+}
+
+// sendLatestData replaces the unread data in ch
+func sendLatestData(ch chan []byte, data []byte) {
+	for {
+		select {
+		case ch <- data:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registry
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	zookeeper "github.com/alipay/sofa-mosn/pkg/registry/zk"
+	"github.com/alipay/sofa-mosn/pkg/registry/zk/zktest"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	"github.com/alipay/sofa-mosn/pkg/upstream/cluster"
+)
+
+const testInterface = "com.alipay.Echo"
+
+// providerNode returns the node name of the dubbo provider registered at addr with the parameters
+func providerNode(addr string, params string) string {
+	u := "dubbo://" + addr + "/" + testInterface + "?interface=" + testInterface
+	if params != "" {
+		u += "&" + params
+	}
+	return url.QueryEscape(u)
+}
+
+// registerProvider registers the ephemeral provider node by the client of the provider
+func registerProvider(t *testing.T, client zookeeper.Client, node string) {
+	providers := DefaultRoot + "/" + testInterface + "/providers"
+	if err := client.Create(providers); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RegisterTemp(providers, node); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestClusterManager(t *testing.T, config v2.Cluster) types.ClusterManager {
+	config.Name = testInterface
+	config.ClusterType = v2.SIMPLE_CLUSTER
+	config.LbType = v2.LB_RANDOM
+	return cluster.NewClusterManager(nil, []v2.Cluster{config}, nil, true, false)
+}
+
+func clusterHosts(cm types.ClusterManager) []types.Host {
+	snapshot := cm.GetClusterSnapshot(context.Background(), testInterface)
+	if snapshot == nil {
+		return nil
+	}
+	defer cm.PutClusterSnapshot(snapshot)
+	return snapshot.PrioritySet().HostSetsByPriority()[0].Hosts()
+}
+
+// waitHosts waits for the addresses of the cluster hosts
+func waitHosts(t *testing.T, cm types.ClusterManager, addrs ...string) []types.Host {
+	sort.Strings(addrs)
+	var got []string
+	for i := 0; i < 100; i++ {
+		hosts := clusterHosts(cm)
+		got = got[:0]
+		for _, host := range hosts {
+			got = append(got, host.AddressString())
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") == strings.Join(addrs, ",") {
+			return hosts
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect the hosts %v discovered, got %v", addrs, got)
+	return nil
+}
+
+// closedAddress returns a local address refusing the connections
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestDiscovery(t *testing.T) {
+	delay := reconnectDelay
+	reconnectDelay = 10 * time.Millisecond
+	defer func() {
+		reconnectDelay = delay
+	}()
+
+	cm := newTestClusterManager(t, v2.Cluster{})
+	defer cm.Destory()
+
+	server := zktest.NewServer()
+	provider := server.NewClient()
+	defer provider.Close()
+	registerProvider(t, provider, providerNode("10.0.0.1:20880", "weight=3"))
+	registerProvider(t, provider, providerNode("10.0.0.2:20880", "weight=1000"))
+	registerProvider(t, provider, "malformed")
+
+	r := newTestRegistry(t, server, nil)
+	defer r.Close()
+	r.discover(DefaultRoot, []string{testInterface}, cm.UpdateClusterHosts)
+
+	for _, host := range waitHosts(t, cm, "10.0.0.1:20880", "10.0.0.2:20880") {
+		if weight := map[string]uint32{"10.0.0.1:20880": 3, "10.0.0.2:20880": 128}[host.AddressString()]; host.Weight() != weight {
+			t.Errorf("expect weight %d of host %s, got %d", weight, host.AddressString(), host.Weight())
+		}
+	}
+
+	// the providers are watched
+	registerProvider(t, provider, providerNode("10.0.0.3:20880", ""))
+	waitHosts(t, cm, "10.0.0.1:20880", "10.0.0.2:20880", "10.0.0.3:20880")
+
+	// the hosts are kept while reconnecting, and watched on the new client
+	client := r.Client()
+	client.Close()
+	for i := 0; i < 100 && (r.Client() == nil || r.Client() == client); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitHosts(t, cm, "10.0.0.1:20880", "10.0.0.2:20880", "10.0.0.3:20880")
+	provider.Close()
+	waitHosts(t, cm)
+}
+
+// refreshClient signals the fresh reads of the providers
+type refreshClient struct {
+	zookeeper.Client
+	refreshed chan string
+}
+
+func (c *refreshClient) GetChildren(zkPath string) ([]string, error) {
+	c.refreshed <- zkPath
+	return c.Client.GetChildren(zkPath)
+}
+
+func TestDiscoveryRefresh(t *testing.T) {
+	cm := newTestClusterManager(t, v2.Cluster{
+		Reresolve: v2.ReresolveConfig{
+			ConnectFailures: 1,
+		},
+	})
+	defer cm.Destory()
+
+	server := zktest.NewServer()
+	provider := server.NewClient()
+	defer provider.Close()
+	addr := closedAddress(t)
+	registerProvider(t, provider, providerNode(addr, ""))
+
+	refreshed := make(chan string, 1)
+	r, err := newRegistry(func() (zookeeper.Client, error) {
+		return &refreshClient{Client: server.NewClient(), refreshed: refreshed}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.discover(DefaultRoot, []string{testInterface}, cm.UpdateClusterHosts)
+	hosts := waitHosts(t, cm, addr)
+
+	// the host failing to connect forces a fresh read of the providers
+	hosts[0].CreateConnection(nil).Connection.Connect(false)
+	select {
+	case zkPath := <-refreshed:
+		if zkPath != DefaultRoot+"/"+testInterface+"/providers" {
+			t.Errorf("expect the providers of the cluster read, got %s", zkPath)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect the discovery refreshed")
+	}
+}
+
+// waitWeight waits for the weight of the discovered host
+func waitWeight(t *testing.T, cm types.ClusterManager, addr string, weight uint32) {
+	var got uint32
+	for i := 0; i < 100; i++ {
+		for _, host := range clusterHosts(cm) {
+			if host.AddressString() == addr {
+				got = host.Weight()
+			}
+		}
+		if got == weight {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect weight %d of host %s, got %d", weight, addr, got)
+}
+
+func TestDiscoveryLiveWeight(t *testing.T) {
+	delay := reconnectDelay
+	reconnectDelay = 10 * time.Millisecond
+	defer func() {
+		reconnectDelay = delay
+	}()
+
+	cm := newTestClusterManager(t, v2.Cluster{
+		LiveWeight: v2.LiveWeightConfig{
+			Enabled: true,
+		},
+	})
+	defer cm.Destory()
+
+	server := zktest.NewServer()
+	provider := server.NewClient()
+	defer provider.Close()
+	providers := DefaultRoot + "/" + testInterface + "/providers/"
+	node := providerNode("10.0.0.1:20880", "weight=3")
+	registerProvider(t, provider, node)
+
+	r := newTestRegistry(t, server, nil)
+	defer r.Close()
+	r.discover(DefaultRoot, []string{testInterface}, cm.UpdateClusterHosts)
+	waitHosts(t, cm, "10.0.0.1:20880")
+	waitWeight(t, cm, "10.0.0.1:20880", 3)
+
+	// the provider advertises its weight in the node data
+	if err := provider.UpdateTempData(providers+node, []byte("weight=7")); err != nil {
+		t.Fatal(err)
+	}
+	waitWeight(t, cm, "10.0.0.1:20880", 7)
+
+	// the node data is watched on the reconnected registry
+	client := r.Client()
+	client.Close()
+	for i := 0; i < 100 && (r.Client() == nil || r.Client() == client); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := provider.UpdateTempData(providers+node, []byte("weight=9")); err != nil {
+		t.Fatal(err)
+	}
+	waitWeight(t, cm, "10.0.0.1:20880", 9)
+
+	// the provider registers again with another node
+	if err := provider.Delete(providers + node); err != nil {
+		t.Fatal(err)
+	}
+	node = providerNode("10.0.0.1:20880", "weight=3&timestamp=2")
+	registerProvider(t, provider, node)
+	if err := provider.UpdateTempData(providers+node, []byte("weight=11")); err != nil {
+		t.Fatal(err)
+	}
+	waitWeight(t, cm, "10.0.0.1:20880", 11)
+}
+
+func TestDiscoveryDisabledProviders(t *testing.T) {
+	cm := newTestClusterManager(t, v2.Cluster{
+		LiveWeight: v2.LiveWeightConfig{
+			Enabled: true,
+		},
+	})
+	defer cm.Destory()
+
+	server := zktest.NewServer()
+	provider := server.NewClient()
+	defer provider.Close()
+	providers := DefaultRoot + "/" + testInterface + "/providers/"
+	node := providerNode("10.0.0.1:20880", "")
+	registerProvider(t, provider, node)
+	registerProvider(t, provider, providerNode("10.0.0.2:20880", "enabled=false"))
+	registerProvider(t, provider, providerNode("10.0.0.3:20880", "dynamic=false"))
+	registerProvider(t, provider, providerNode("10.0.0.4:20880", "dynamic=false&enabled=true"))
+
+	r := newTestRegistry(t, server, nil)
+	defer r.Close()
+	r.discover(DefaultRoot, []string{testInterface}, cm.UpdateClusterHosts)
+	waitHosts(t, cm, "10.0.0.1:20880", "10.0.0.4:20880")
+
+	healthy := func() []string {
+		snapshot := cm.GetClusterSnapshot(context.Background(), testInterface)
+		defer cm.PutClusterSnapshot(snapshot)
+
+		var addrs []string
+		for _, host := range snapshot.PrioritySet().HostSetsByPriority()[0].HealthyHosts() {
+			addrs = append(addrs, host.AddressString())
+		}
+		sort.Strings(addrs)
+		return addrs
+	}
+	waitHealthy := func(addrs ...string) {
+		for i := 0; i < 100 && strings.Join(healthy(), ",") != strings.Join(addrs, ","); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := healthy(); strings.Join(got, ",") != strings.Join(addrs, ",") {
+			t.Fatalf("expect the healthy hosts %v, got %v", addrs, got)
+		}
+	}
+
+	// the operator disables the provider by the node data, and enables it again
+	if err := provider.UpdateTempData(providers+node, []byte("enabled=false")); err != nil {
+		t.Fatal(err)
+	}
+	waitHealthy("10.0.0.4:20880")
+	if err := provider.UpdateTempData(providers+node, []byte("enabled=true")); err != nil {
+		t.Fatal(err)
+	}
+	waitHealthy("10.0.0.1:20880", "10.0.0.4:20880")
+}
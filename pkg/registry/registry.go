@@ -0,0 +1,224 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/admin"
+	"github.com/alipay/sofa-mosn/pkg/config"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	zookeeper "github.com/alipay/sofa-mosn/pkg/registry/zk"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	jerrors "github.com/juju/errors"
+)
+
+// ClientName is the name of the zk client of the registry in the logs
+const ClientName = "mosn registry"
+
+// LogModule is the log module of the zk clients, its level can be changed by the admin api
+const LogModule = "zk"
+
+func init() {
+	log.RegisterModule(LogModule, zookeeper.SetLogLevel)
+}
+
+// bounds of the delay between the reconnections of the closed client, replaced in the tests
+var (
+	reconnectDelay    = time.Second
+	maxReconnectDelay = 15 * time.Second
+)
+
+// ErrClosed is returned by the operations after the registry is closed
+var ErrClosed = errors.New("registry is closed")
+
+// Registry is the zookeeper registry shared by the features depending on the registry, such as the discovery,
+// the stats publisher and the registry reads of the admin api. The zk client is closed with its expired session, the registry connects a new one to continue
+type Registry struct {
+	connect func() (zookeeper.Client, error)
+
+	mux     sync.Mutex
+	client  zookeeper.Client
+	changed chan struct{} // closed once the client is replaced
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wait      sync.WaitGroup
+}
+
+// New connects to the registry and installs it, e.g. the stats are published by stats.SetRegistryPublisher,
+// and the admin api reads the registry by admin.SetRegistryChildren. The hosts of the clusters in the config
+// are discovered from the registry and updated to the cluster manager
+func New(conf config.RegistryConfig, cm types.ClusterManager) (*Registry, error) {
+	clientConf := zookeeper.ClientConfig{
+		LogLevel: conf.LogLevel,
+	}
+	clientConf.Address = conf.Address
+	// the zk client timeout is in seconds
+	clientConf.Timeout = int((conf.Timeout.Duration + time.Second - 1) / time.Second)
+
+	r, err := newRegistry(func() (zookeeper.Client, error) {
+		return zookeeper.NewClient(ClientName, clientConf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.Clusters) > 0 {
+		root := conf.Root
+		if root == "" {
+			root = DefaultRoot
+		}
+		r.discover(root, conf.Clusters, cm.UpdateClusterHosts)
+	}
+
+	return r, nil
+}
+
+func newRegistry(connect func() (zookeeper.Client, error)) (*Registry, error) {
+	client, err := connect()
+	if err != nil {
+		return nil, jerrors.Annotate(err, "connect registry")
+	}
+
+	r := &Registry{
+		connect: connect,
+		client:  client,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.wait.Add(1)
+	go r.handleRestart()
+
+	stats.SetRegistryPublisher(r.publish)
+	admin.SetRegistryChildren(r.children)
+
+	return r, nil
+}
+
+// Client returns the current zk client, nil if the registry is closed or reconnecting
+func (r *Registry) Client() zookeeper.Client {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.client
+}
+
+// current returns the current client with the channel closed once it is replaced, e.g. by nil while
+// reconnecting, or the registry is closed
+func (r *Registry) current() (zookeeper.Client, <-chan struct{}) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.client, r.changed
+}
+
+// Close uninstalls the registry and closes the client, the ephemeral nodes are deleted
+func (r *Registry) Close() error {
+	r.closeOnce.Do(func() {
+		stats.SetRegistryPublisher(nil)
+
+		close(r.done)
+		r.wait.Wait()
+
+		client := r.Client()
+		r.setClient(nil)
+		if client != nil {
+			client.Close()
+		}
+	})
+	return nil
+}
+
+// handleRestart connects a new client once the client is closed, e.g. the session expired
+func (r *Registry) handleRestart() {
+	defer r.wait.Done()
+
+	for {
+		client := r.Client()
+		select {
+		case <-r.done:
+			return
+		case <-client.Done():
+		}
+
+		log.DefaultLogger.Warnf("registry client is closed, reconnect the registry")
+		r.setClient(nil)
+		client.Close()
+
+		for delay := reconnectDelay; ; {
+			select {
+			case <-r.done:
+				return
+			case <-time.After(delay):
+			}
+			client, err := r.connect()
+			if err == nil {
+				log.DefaultLogger.Infof("registry is reconnected")
+				r.setClient(client)
+				break
+			}
+			log.DefaultLogger.Errorf("reconnect registry failed: %v, retry in %s", err, delay)
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+	}
+}
+
+func (r *Registry) setClient(client zookeeper.Client) {
+	r.mux.Lock()
+	r.client = client
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.mux.Unlock()
+}
+
+// publish creates or updates the ephemeral node zkPath with data, the node is created again in the new
+// session of the reconnected client
+func (r *Registry) publish(zkPath string, data []byte) error {
+	client := r.Client()
+	if client == nil {
+		return ErrClosed
+	}
+
+	err := client.UpdateTempData(zkPath, data)
+	if jerrors.Cause(err) != zookeeper.ErrNodeNotExist {
+		return err
+	}
+	dir, node := path.Split(zkPath)
+	if err := client.Create(path.Clean(dir)); err != nil {
+		return err
+	}
+	if _, err := client.RegisterTemp(dir, node); err != nil {
+		return err
+	}
+	return client.UpdateTempData(zkPath, data)
+}
+
+// children reads the children of zkPath from the registry, it fails with ErrClosed while reconnecting
+func (r *Registry) children(zkPath string) ([]string, error) {
+	client := r.Client()
+	if client == nil {
+		return nil, ErrClosed
+	}
+	return client.GetChildren(zkPath)
+}
@@ -0,0 +1,211 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/admin"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	zookeeper "github.com/alipay/sofa-mosn/pkg/registry/zk"
+	"github.com/alipay/sofa-mosn/pkg/registry/zk/zktest"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+)
+
+// newTestRegistry creates the registry of the in-memory zookeeper, connect fails while fail is 1
+func newTestRegistry(t *testing.T, server *zktest.Server, fail *int32) *Registry {
+	r, err := newRegistry(func() (zookeeper.Client, error) {
+		if fail != nil && atomic.LoadInt32(fail) == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return server.NewClient(), nil
+	})
+	if err != nil {
+		t.Fatalf("create registry failed: %v", err)
+	}
+	return r
+}
+
+// waitNode waits for the data of zkPath in the server
+func waitNode(t *testing.T, server *zktest.Server, zkPath string) []byte {
+	for i := 0; i < 100; i++ {
+		if data, ok := server.Get(zkPath); ok && len(data) > 0 {
+			return data
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("node %s is not published", zkPath)
+	return nil
+}
+
+func TestPublishStats(t *testing.T) {
+	server := zktest.NewServer()
+	r := newTestRegistry(t, server, nil)
+	defer r.Close()
+
+	stats.NewClusterStats("registry_test").Counter(stats.UpstreamRequestTotal).Inc(1)
+	p := stats.NewRegistryPublisher("/mosn/stats/host1", 10*time.Millisecond)
+	if p == nil {
+		t.Fatal("expect the stats publisher installed by the registry")
+	}
+	p.Start()
+	defer p.Stop()
+
+	res := map[string]stats.ClusterStatsData{}
+	if err := json.Unmarshal(waitNode(t, server, "/mosn/stats/host1"), &res); err != nil {
+		t.Fatalf("unmarshal published stats failed: %v", err)
+	}
+	if _, ok := res["registry_test"]; !ok {
+		t.Errorf("expect the stats of the cluster published, got %v", res)
+	}
+
+	r.Close()
+	if p := stats.NewRegistryPublisher("/mosn/stats/host1", time.Second); p != nil {
+		t.Error("expect no stats publisher after the registry is closed")
+	}
+	if _, ok := server.Get("/mosn/stats/host1"); ok {
+		t.Error("expect the ephemeral stats node deleted with the session")
+	}
+}
+
+func TestRegistryReconnect(t *testing.T) {
+	delay := reconnectDelay
+	reconnectDelay = 10 * time.Millisecond
+	defer func() {
+		reconnectDelay = delay
+	}()
+
+	server := zktest.NewServer()
+	var fail int32
+	r := newTestRegistry(t, server, &fail)
+	defer r.Close()
+
+	if err := r.publish("/mosn/stats/host1", []byte("1")); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	// the session expires, the client is closed with the ephemeral node
+	atomic.StoreInt32(&fail, 1)
+	client := r.Client()
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+	if err := r.publish("/mosn/stats/host1", []byte("2")); err != ErrClosed {
+		t.Errorf("expect publish failed during the reconnection, got %v", err)
+	}
+
+	atomic.StoreInt32(&fail, 0)
+	for i := 0; i < 100 && (r.Client() == nil || r.Client() == client); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.Client() == nil || r.Client() == client {
+		t.Fatal("expect the registry reconnected")
+	}
+	// the node is created again in the new session
+	if err := r.publish("/mosn/stats/host1", []byte("3")); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if data, _ := server.Get("/mosn/stats/host1"); string(data) != "3" {
+		t.Errorf("expect the node published again, got %q", data)
+	}
+}
+
+func TestLogModule(t *testing.T) {
+	if _, ok := log.ModuleLevels()[LogModule]; !ok {
+		t.Fatalf("zk log module is not registered: %v", log.ModuleLevels())
+	}
+	if err := log.SetModuleLevel(LogModule, log.DEBUG); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.ResetModuleLevel(LogModule); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type adminConfig struct {
+	port uint32
+}
+
+func (c *adminConfig) GetAdmin() *v2.Admin {
+	return &v2.Admin{
+		Address: core.Address{
+			Address: &core.Address_SocketAddress{
+				SocketAddress: &core.SocketAddress{
+					PortSpecifier: &core.SocketAddress_PortValue{
+						PortValue: c.port,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestAdminRegistryChildren(t *testing.T) {
+	server := zktest.NewServer()
+	r := newTestRegistry(t, server, nil)
+	defer r.Close()
+
+	client := r.Client()
+	if err := client.Create("/dubbo/com.alipay.Echo/providers"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RegisterTemp("/dubbo/com.alipay.Echo/providers", "provider1"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &adminConfig{port: 8891}
+	adminServer := admin.Server{}
+	adminServer.Start(config)
+	defer adminServer.Close()
+
+	var resp *http.Response
+	var err error
+	// wait for the admin server to listen, and the rate limit of the registry reads
+	for i := 0; i < 200; i++ {
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d/api/v1/registry/children?path=/dubbo/com.alipay.Echo/providers", config.port))
+		if err == nil && resp.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("read registry by admin api failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		Path     string   `json:"path"`
+		Children []string `json:"children"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("decode registry children failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(res.Children) != 1 || res.Children[0] != "provider1" {
+		t.Errorf("unexpected registry children, status %d, %+v", resp.StatusCode, res)
+	}
+}
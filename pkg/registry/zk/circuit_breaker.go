@@ -0,0 +1,152 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/go-zookeeper/zk"
+)
+
+// ErrCircuitOpen is returned without calling zk while the circuit breaker of the client is open
+var ErrCircuitOpen = errors.New("zookeeperclient circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker fails the zk operations fast during the ensemble outage.
+// It opens after threshold consecutive connection failures or once the conn is disconnected,
+// and allows one probe after the cooldown or as soon as the client resumes the session,
+// the probe closes the breaker on success and reopens it on failure.
+// The breaker lives with the client, which is kept across the disconnections.
+// A nil breaker is disabled.
+type circuitBreaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	state     breakerState
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns ErrCircuitOpen if the operation should fail fast
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// done records the result of the allowed operation
+func (b *circuitBreaker) done(err error) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+	if !isZkConnError(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+// trip opens the breaker immediately, it is called on the lost connection
+func (b *circuitBreaker) trip() {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	b.open()
+	b.Unlock()
+}
+
+// probe allows a probe at once, it is called on the re-established session
+func (b *circuitBreaker) probe() {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	if b.state == breakerOpen {
+		b.state = breakerHalfOpen
+		b.probing = false
+	}
+	b.Unlock()
+}
+
+func (b *circuitBreaker) open() {
+	b.state = breakerOpen
+	b.openUntil = time.Now().Add(b.cooldown)
+	b.probing = false
+}
+
+// isZkConnError returns true if the error is caused by the connection instead of the request
+func isZkConnError(err error) bool {
+	switch err {
+	case zk.ErrNoServer, zk.ErrConnectionClosed, zk.ErrSessionExpired, zk.ErrClosing, ZK_CLIENT_CONN_NIL_ERR:
+		return true
+	}
+	return false
+}
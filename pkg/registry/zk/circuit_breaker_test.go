@@ -0,0 +1,158 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(2, 50*time.Millisecond)
+
+	// request errors are not counted
+	for i := 0; i < 3; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("closed breaker should allow, got %v", err)
+		}
+		b.done(zk.ErrNoNode)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("closed breaker should allow, got %v", err)
+		}
+		b.done(zk.ErrNoServer)
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expect ErrCircuitOpen after consecutive failures, got %v", err)
+	}
+
+	// one probe after the cooldown, the failed probe reopens the breaker
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expect a probe after the cooldown, got %v", err)
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expect only one probe, got %v", err)
+	}
+	b.done(zk.ErrConnectionClosed)
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expect ErrCircuitOpen after the failed probe, got %v", err)
+	}
+
+	// the succeeded probe closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expect a probe after the cooldown, got %v", err)
+	}
+	b.done(nil)
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("breaker should be closed after the succeeded probe, got %v", err)
+		}
+		b.done(nil)
+	}
+}
+
+func TestCircuitBreakerSessionState(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+		breaker:       newCircuitBreaker(3, time.Hour),
+	}
+
+	session := make(chan zk.Event, 2)
+	z.wait.Add(1)
+	go z.handleZkEvent(session)
+	defer func() {
+		close(z.exit)
+		z.wait.Wait()
+	}()
+
+	// opens at once on the lost connection without waiting for the failures
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateDisconnected}
+	waitFor(t, func() bool { return z.breaker.allow() == ErrCircuitOpen })
+	if _, err := z.getChildren("/dubbo"); jerrors.Cause(err) != ErrCircuitOpen {
+		t.Errorf("expect ErrCircuitOpen, got %v", err)
+	}
+
+	// the connected session allows a probe at once
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	waitFor(t, func() bool {
+		z.breaker.Lock()
+		defer z.breaker.Unlock()
+		return z.breaker.state == breakerHalfOpen
+	})
+	// no conn, the probe fails
+	if _, err := z.getChildren("/dubbo"); jerrors.Cause(err) != ZK_CLIENT_CONN_NIL_ERR {
+		t.Errorf("expect the probe to call zk, got %v", err)
+	}
+	if err := z.breaker.allow(); err != ErrCircuitOpen {
+		t.Errorf("expect ErrCircuitOpen after the failed probe, got %v", err)
+	}
+
+	// the same client reconnects after another failover, the probe succeeds
+	z.Lock()
+	z.conn = &zk.Conn{}
+	z.Unlock()
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateDisconnected}
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	waitFor(t, func() bool {
+		z.breaker.Lock()
+		defer z.breaker.Unlock()
+		return z.breaker.state == breakerHalfOpen
+	})
+	if err := z.withConn(func(conn *zk.Conn) error { return nil }); err != nil {
+		t.Fatalf("expect the probe to succeed, got %v", err)
+	}
+	if err := z.breaker.allow(); err != nil {
+		t.Errorf("expect the breaker closed after the successful probe, got %v", err)
+	}
+	z.breaker.done(nil)
+	if !z.zkConnValid() {
+		t.Error("client should survive the disconnections")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Second)
+	for i := 0; i < 10; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("disabled breaker should allow, got %v", err)
+		}
+		b.done(zk.ErrNoServer)
+	}
+	b.trip()
+	if err := b.allow(); err != nil {
+		t.Fatalf("disabled breaker should allow, got %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition is not met")
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+// Client is the zookeeper operations the registration and discovery depend on, it is implemented by the
+// zk client. The code depending on Client can be tested without a real ensemble by the in-memory
+// implementation of the zktest package
+type Client interface {
+	// Create creates basePath and all its missing parents as persistent nodes
+	Create(basePath string) error
+	// Delete deletes the node basePath, it fails if the node has children
+	Delete(basePath string) error
+	// DeleteTree deletes basePath and all its descendants
+	DeleteTree(basePath string) error
+	// ListTree returns basePath and all its descendants in the deletion order, the leaves first
+	ListTree(basePath string) ([]string, error)
+	// GetChildren returns the children names of zkPath, ErrNodeNotExist if zkPath is missing
+	GetChildren(zkPath string) ([]string, error)
+	// GetChildrenBatch returns the children or the error of each path, a failed path doesn't fail the others
+	GetChildrenBatch(paths []string) (map[string]ChildrenResult, error)
+	// WatchChildrenDurable sends the full children set of zkPath on every change until stop is called
+	WatchChildrenDurable(zkPath string) (children <-chan []string, stop func())
+	// WatchDataDurable sends the data of zkPath on every change until stop is called, nil if zkPath is missing
+	WatchDataDurable(zkPath string) (data <-chan []byte, stop func())
+	// RegisterTemp creates the ephemeral node basePath/node, the parent must exist
+	RegisterTemp(basePath string, node string) (string, error)
+	// RegisterTempSeq creates an ephemeral sequential node under basePath with data
+	RegisterTempSeq(basePath string, data []byte) (string, error)
+	// UpdateTempData sets the data of the ephemeral node, ErrNodeNotExist if the node is gone
+	UpdateTempData(zkPath string, data []byte) error
+	// IsReadOnly returns true if the write operations fail with ErrReadOnly
+	IsReadOnly() bool
+	// Done is closed once the client is closed, e.g. its session expired, a new client should be created
+	// to continue, the ephemeral nodes and the watches are gone with the client
+	Done() <-chan struct{}
+	// Close releases the session, the ephemeral nodes are deleted and the watches stop
+	Close()
+}
+
+// NewClient connects to the zk addresses of the config, the client is closed once the session expires
+func NewClient(name string, conf ClientConfig) (Client, error) {
+	if conf.Timeout == 0 {
+		conf.Timeout = DEFAULT_REGISTRY_TIMEOUT
+	}
+	return newRegistryZookeeperClient(name, conf.Address, conf)
+}
+
+var _ Client = (*zookeeperClient)(nil)
@@ -0,0 +1,83 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"context"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+// ClientConfig is the registry config with the options of the zk client
+type ClientConfig struct {
+	registry.RegistryConfig
+	// KeepAlive enables the background session keepalive besides the zk library's heartbeat
+	KeepAlive bool
+	// LogLevel is the verbosity of the zk client logs: debug, info, warn or error, default info
+	LogLevel string
+	// CircuitBreakerThreshold is the consecutive connection failures to open the circuit breaker, 0 disables it
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is the time the open circuit breaker fails fast before a probe, unit: second
+	CircuitBreakerCooldown int `default:"3"`
+	// WatchJitterMin and WatchJitterMax bound the random delay before re-reading the watched children on a change,
+	// so that the instances notified at the same time don't hit zk together. unit: millisecond,
+	// WatchJitterMax 0 means the default 50-500ms, negative disables the delay
+	WatchJitterMin int
+	WatchJitterMax int
+	// ConnectRetryTimes is the max retries of the initial connection during the boot, 0 disables the retry.
+	// ConnectRetryBackoff is the first backoff doubled on each retry, unit: millisecond, default 100ms,
+	// ConnectRetryMaxDuration bounds the total retry time, unit: second, 0 means no bound
+	ConnectRetryTimes       int
+	ConnectRetryBackoff     int
+	ConnectRetryMaxDuration int
+	// ChildrenWarnThreshold logs a warning if a path has more children, e.g. leaked registrations.
+	// ChildrenErrorThreshold fails the read of the children above it to prevent the pathological host set rebuild,
+	// 0 means no limit
+	ChildrenWarnThreshold  int
+	ChildrenErrorThreshold int
+	// TempNodeExists is the policy of RegisterTemp if the node exists, e.g. the node of the previous session
+	// is not reaped yet after a fast restart. Empty fails with zk.ErrNodeExists, "verify" succeeds if the node
+	// is ours, "overwrite" also replaces the node of another session
+	TempNodeExists string
+}
+
+type clientConfigKey struct{}
+
+// ClientConf sets the registry config with the zk client options, it overrides the config of
+// registry.RegistryConf. The client options are carried by the context of the registry options
+func ClientConf(conf ClientConfig) registry.Option {
+	return func(o *registry.Options) {
+		o.RegistryConfig = conf.RegistryConfig
+		ctx := o.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		o.Context = context.WithValue(ctx, clientConfigKey{}, conf)
+	}
+}
+
+// clientConfig returns the client options set by ClientConf with the registry config of opts,
+// the zero options if ClientConf is not used
+func clientConfig(opts registry.Options) ClientConfig {
+	var conf ClientConfig
+	if opts.Context != nil {
+		conf, _ = opts.Context.Value(clientConfigKey{}).(ClientConfig)
+	}
+	conf.RegistryConfig = opts.RegistryConfig
+
+	return conf
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	defaultConnectBackoff = 100 * time.Millisecond
+	maxConnectBackoff     = 5 * time.Second
+)
+
+// zkConnect is replaced in the tests
+var zkConnect = func(zkAddrs []string, timeout time.Duration, dialer zk.Dialer) (*zk.Conn, <-chan zk.Event, error) {
+	return zk.Connect(zkAddrs, timeout, zk.WithDialer(dialer))
+}
+
+// connectRetry retries the initial connection during the boot, e.g. the zk addresses are not resolvable yet.
+// The backoff is doubled on each retry up to maxConnectBackoff, the retries stop after times retries or
+// once maxDuration elapses. The zero value connects only once
+type connectRetry struct {
+	times       int
+	backoff     time.Duration
+	maxDuration time.Duration
+}
+
+func newConnectRetry(times int, backoff time.Duration, maxDuration time.Duration) connectRetry {
+	if backoff <= 0 {
+		backoff = defaultConnectBackoff
+	}
+
+	return connectRetry{
+		times:       times,
+		backoff:     backoff,
+		maxDuration: maxDuration,
+	}
+}
+
+// connect returns the error of the last attempt if the retries are exhausted, the connections to the servers
+// are created by dialer
+func (r connectRetry) connect(zkAddrs []string, timeout time.Duration, dialer zk.Dialer) (*zk.Conn, <-chan zk.Event, error) {
+	var (
+		start   = time.Now()
+		backoff = r.backoff
+	)
+
+	for attempt := 0; ; attempt++ {
+		conn, event, err := zkConnect(zkAddrs, timeout, dialer)
+		if err == nil {
+			return conn, event, nil
+		}
+		if attempt >= r.times {
+			return nil, nil, jerrors.Annotatef(err, "zk.Connect(zkAddrs:%+v) failed after %d attempts", zkAddrs, attempt+1)
+		}
+		if r.maxDuration > 0 {
+			remaining := r.maxDuration - time.Since(start)
+			if remaining <= 0 {
+				return nil, nil, jerrors.Annotatef(err, "zk.Connect(zkAddrs:%+v) failed in %s", zkAddrs, r.maxDuration)
+			}
+			if backoff > remaining {
+				backoff = remaining
+			}
+		}
+
+		log.Warn("zk.Connect(zkAddrs:%+v) = error{%v}, retry %d/%d in %s", zkAddrs, err, attempt+1, r.times, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
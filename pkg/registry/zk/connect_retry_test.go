@@ -0,0 +1,76 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+func TestConnectRetry(t *testing.T) {
+	errResolve := errors.New("lookup zk: no such host")
+	connect := zkConnect
+	defer func() {
+		zkConnect = connect
+	}()
+	mockConnect := func(failures int, attempts *int) {
+		zkConnect = func(zkAddrs []string, timeout time.Duration, dialer zk.Dialer) (*zk.Conn, <-chan zk.Event, error) {
+			*attempts++
+			if *attempts <= failures {
+				return nil, nil, errResolve
+			}
+			return &zk.Conn{}, make(chan zk.Event), nil
+		}
+	}
+
+	testCases := []struct {
+		retry    connectRetry
+		failures int
+		attempts int
+		success  bool
+	}{
+		// connect once by default
+		{connectRetry{}, 1, 1, false},
+		{newConnectRetry(3, time.Millisecond, 0), 2, 3, true},
+		{newConnectRetry(3, time.Millisecond, 0), 5, 4, false},
+		// bounded by the max duration
+		{newConnectRetry(100, 20*time.Millisecond, 50*time.Millisecond), 100, 3, false},
+	}
+
+	for i, tc := range testCases {
+		attempts := 0
+		mockConnect(tc.failures, &attempts)
+		conn, _, err := tc.retry.connect([]string{"zk:2181"}, time.Second, net.DialTimeout)
+		if tc.success != (err == nil && conn != nil) || attempts != tc.attempts {
+			t.Errorf("#%d expect success %v in %d attempts, got %v in %d attempts", i, tc.success, tc.attempts, err, attempts)
+		}
+		if !tc.success && jerrors.Cause(err) != errResolve {
+			t.Errorf("#%d expect the error of the last attempt, got %v", i, err)
+		}
+	}
+}
+
+func TestConnectRetryBackoff(t *testing.T) {
+	if retry := newConnectRetry(1, 0, 0); retry.backoff != defaultConnectBackoff {
+		t.Errorf("expect default backoff, got %s", retry.backoff)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"strconv"
+	"strings"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+// DefaultProviderWeight is the weight of the provider without weight parameter, same as dubbo
+const DefaultProviderWeight = 100
+
+// ProviderURL is the structured provider url registered as the node name under the providers directory
+type ProviderURL struct {
+	Protocol  string
+	Host      string
+	Port      int
+	Interface string
+	Methods   []string
+	Weight    int32
+	Group     string
+	Version   string
+	// Enabled is false if the provider should not receive traffic, i.e. enabled=false,
+	// or dynamic=false without enabled=true as the static provider is disabled until enabled manually
+	Enabled bool
+	// URL keeps all the parameters of the provider
+	URL *registry.ServiceURL
+	// Node is the node name the provider is parsed from
+	Node string
+}
+
+// ParseProviderURL url-decodes and parses a child node name of the providers directory
+func ParseProviderURL(node string) (*ProviderURL, error) {
+	serviceURL, err := registry.NewServiceURL(node)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	p := &ProviderURL{
+		Protocol:  serviceURL.Protocol,
+		Host:      serviceURL.Ip,
+		Interface: serviceURL.Query.Get("interface"),
+		Weight:    DefaultProviderWeight,
+		Enabled:   true,
+		Group:     serviceURL.Group,
+		Version:   serviceURL.Version,
+		URL:       serviceURL,
+		Node:      node,
+	}
+	if p.Protocol == "" || p.Host == "" {
+		return nil, jerrors.Errorf("provider url{%s} has no protocol or host", node)
+	}
+	if p.Port, err = strconv.Atoi(serviceURL.Port); err != nil || p.Port <= 0 || p.Port > 65535 {
+		return nil, jerrors.Errorf("provider url{%s} has invalid port{%s}", node, serviceURL.Port)
+	}
+	if p.Interface == "" {
+		p.Interface = strings.TrimPrefix(serviceURL.Path, "/")
+	}
+	if p.Interface == "" {
+		return nil, jerrors.Errorf("provider url{%s} has no interface", node)
+	}
+	if methods := serviceURL.Query.Get("methods"); methods != "" {
+		p.Methods = strings.Split(methods, ",")
+	}
+	if weight := serviceURL.Query.Get("weight"); weight != "" {
+		w, err := strconv.ParseInt(weight, 10, 32)
+		if err != nil || w < 0 {
+			return nil, jerrors.Errorf("provider url{%s} has invalid weight{%s}", node, weight)
+		}
+		p.Weight = int32(w)
+	}
+	for _, key := range []string{"enabled", "dynamic"} {
+		if flag := serviceURL.Query.Get(key); flag != "" {
+			if p.Enabled, err = strconv.ParseBool(flag); err != nil {
+				return nil, jerrors.Errorf("provider url{%s} has invalid %s{%s}", node, key, flag)
+			}
+			break
+		}
+	}
+
+	return p, nil
+}
+
+// ParseProviderURLs parses the children of the providers directory returned by getChildren,
+// the malformed nodes, e.g. half-written registrations, are skipped instead of failing the batch
+func ParseProviderURLs(children []string) []*ProviderURL {
+	providers := make([]*ProviderURL, 0, len(children))
+	for _, node := range children {
+		p, err := ParseProviderURL(node)
+		if err != nil {
+			log.Warn("skip malformed provider node{%s}, error{%v}", node, err)
+			continue
+		}
+		providers = append(providers, p)
+	}
+
+	return providers
+}
+
+// EnabledProviders returns the providers receiving traffic, the disabled ones are kept in the registry
+// for the operator to enable again, so they are not the hosts of the cluster
+func EnabledProviders(providers []*ProviderURL) []*ProviderURL {
+	enabled := make([]*ProviderURL, 0, len(providers))
+	for _, p := range providers {
+		if !p.Enabled {
+			log.Info("skip disabled provider{%s:%d}", p.Host, p.Port)
+			continue
+		}
+		enabled = append(enabled, p)
+	}
+
+	return enabled
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseProviderURL(t *testing.T) {
+	raw := "dubbo://116.211.15.190:20880/com.test.IService?anyhost=true&interface=com.test.IService" +
+		"&methods=sayHello,exists&version=1.0.0&group=g1&weight=200&side=provider"
+
+	p, err := ParseProviderURL(url.QueryEscape(raw))
+	if err != nil {
+		t.Fatalf("parse provider url failed: %v", err)
+	}
+	if p.Protocol != "dubbo" || p.Host != "116.211.15.190" || p.Port != 20880 || p.Interface != "com.test.IService" ||
+		p.Weight != 200 || p.Group != "g1" || p.Version != "1.0.0" {
+		t.Errorf("unexpected provider url %+v", p)
+	}
+	if !reflect.DeepEqual(p.Methods, []string{"sayHello", "exists"}) {
+		t.Errorf("unexpected methods %v", p.Methods)
+	}
+	if p.URL.Query.Get("side") != "provider" {
+		t.Errorf("parameters should be kept, got %v", p.URL.Query)
+	}
+
+	// default weight and interface from path
+	p, err = ParseProviderURL("dubbo://10.0.0.1:12200/com.test.IService")
+	if err != nil {
+		t.Fatalf("parse provider url failed: %v", err)
+	}
+	if p.Weight != DefaultProviderWeight || p.Interface != "com.test.IService" || p.Methods != nil {
+		t.Errorf("unexpected provider url %+v", p)
+	}
+}
+
+func TestParseProviderURLs(t *testing.T) {
+	children := []string{
+		url.QueryEscape("dubbo://10.0.0.1:12200/com.test.IService?interface=com.test.IService&weight=3"),
+		// half-written registrations
+		"dubbo%3A%2F%2F10.0.0.2%3A122",
+		"dubbo%3A%2F%2F10.0.0.3",
+		"%zz",
+		url.QueryEscape("dubbo://10.0.0.4:12200/com.test.IService?weight=abc"),
+		url.QueryEscape("dubbo://10.0.0.5:12200/"),
+		url.QueryEscape("dubbo://10.0.0.6:12200/com.test.IService"),
+	}
+
+	providers := ParseProviderURLs(children)
+	if len(providers) != 2 {
+		t.Fatalf("expect 2 providers, got %d", len(providers))
+	}
+	if providers[0].Host != "10.0.0.1" || providers[0].Weight != 3 || providers[1].Host != "10.0.0.6" {
+		t.Errorf("unexpected providers %+v, %+v", providers[0], providers[1])
+	}
+}
+
+func TestEnabledProviders(t *testing.T) {
+	children := []string{
+		url.QueryEscape("dubbo://10.0.0.1:12200/com.test.IService?enabled=false"),
+		url.QueryEscape("dubbo://10.0.0.2:12200/com.test.IService?dynamic=false"),
+		url.QueryEscape("dubbo://10.0.0.3:12200/com.test.IService?dynamic=false&enabled=true"),
+		url.QueryEscape("dubbo://10.0.0.4:12200/com.test.IService?dynamic=true"),
+		url.QueryEscape("dubbo://10.0.0.5:12200/com.test.IService?enabled=abc"),
+		url.QueryEscape("dubbo://10.0.0.6:12200/com.test.IService"),
+	}
+
+	providers := ParseProviderURLs(children)
+	if len(providers) != 5 || providers[0].Enabled || providers[1].Enabled || !providers[2].Enabled {
+		t.Fatalf("unexpected providers %+v", providers)
+	}
+	enabled := EnabledProviders(providers)
+	if len(enabled) != 3 || enabled[0].Host != "10.0.0.3" || enabled[1].Host != "10.0.0.4" || enabled[2].Host != "10.0.0.6" {
+		t.Errorf("unexpected enabled providers %+v", enabled)
+	}
+}
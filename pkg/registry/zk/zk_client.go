@@ -0,0 +1,1541 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+var (
+	ZK_CLIENT_CONN_NIL_ERR = errors.New("zookeeperclient{conn} is nil")
+	// ErrReadOnly is returned by the write methods while the client is connected read-only
+	ErrReadOnly = errors.New("zookeeperclient is connected read-only")
+	// ErrNodeNotExist is returned by UpdateTempData and GetChildren if the node is gone, e.g. the session expired
+	ErrNodeNotExist = errors.New("zookeeperclient node does not exist")
+	// ErrConnectionLost is returned if the conn is closed during the rpc, it is retryable after reconnection
+	ErrConnectionLost = errors.New("zookeeperclient connection lost")
+	// ErrTreeTooDeep is returned by DeleteTree and ListTree if the tree is deeper than maxTreeDepth
+	ErrTreeTooDeep = errors.New("zookeeperclient tree is too deep")
+	// ErrTTLNotSupported is returned by RegisterTTL if the ensemble does not support TTL nodes
+	ErrTTLNotSupported = errors.New("zookeeperclient TTL node is not supported")
+	// ErrTooManyChildren is returned by the children reads if the children exceed the error threshold
+	ErrTooManyChildren = errors.New("zookeeperclient path has too many children")
+)
+
+type zookeeperClient struct {
+	name          string
+	zkAddrs       []string
+	sync.Mutex                   // for conn, only guard the conn pointer, never hold it during zk rpc
+	conn          *zk.Conn       // 这个conn不能被close两次，否则会收到 “panic: close of closed channel”
+	rpcWait       sync.WaitGroup // in-flight zk rpc on conn
+	timeout       int
+	negotiated    int64 // the negotiated session timeout in nanoseconds, accessed atomically, see sessionConn
+	exit          chan struct{}
+	wait          sync.WaitGroup
+	eventRegistry map[string][]*chan struct{}
+	sessionEvents []*chan struct{} // notified when the session is (re)established
+	readOnly      int32            // 1 if connected read-only, fed by the event loop
+	logLevel      log.Level        // debug, info and warn logs below the level are dropped, errors are always logged
+	breaker       *circuitBreaker  // nil if disabled
+	jitterMin     time.Duration    // bounds of the delay before re-reading the watched children, see watchJitter
+	jitterMax     time.Duration
+	tempNodes     map[string]struct{} // ephemeral nodes registered in the current session, guarded by the Mutex
+	childrenWarn  int                 // thresholds of the children count, see checkChildren
+	childrenError int
+	tempExists    string // policy of RegisterTemp on an existing node, see ClientConfig.TempNodeExists
+}
+
+// ClientSnapshot is a copy of the zk client state for introspection, such as an admin page
+type ClientSnapshot struct {
+	Name         string   `json:"name"`
+	ZkAddrs      []string `json:"zk_addrs"`
+	State        string   `json:"state"`
+	SessionID    int64    `json:"session_id"`
+	ReadOnly     bool     `json:"read_only"`
+	WatchedPaths []string `json:"watched_paths"`
+	TempNodes    []string `json:"temp_nodes"`
+}
+
+func stateToString(state zk.State) string {
+	switch state {
+	case zk.StateDisconnected:
+		return "zookeeper disconnected"
+	case zk.StateConnecting:
+		return "zookeeper connecting"
+	case zk.StateAuthFailed:
+		return "zookeeper auth failed"
+	case zk.StateConnectedReadOnly:
+		return "zookeeper connect readonly"
+	case zk.StateSaslAuthenticated:
+		return "zookeeper sasl authenticaed"
+	case zk.StateExpired:
+		return "zookeeper connection expired"
+	case zk.StateConnected:
+		return "zookeeper conneced"
+	case zk.StateHasSession:
+		return "zookeeper has session"
+	case zk.StateUnknown:
+		return "zookeeper unknown state"
+	case zk.State(zk.EventNodeDeleted):
+		return "zookeeper node deleted"
+	case zk.State(zk.EventNodeDataChanged):
+		return "zookeeper node data changed"
+	default:
+		return state.String()
+	}
+}
+
+// newZookeeperClient connects to zk, if keepalive is true, a background goroutine touches the session
+// periodically to keep the idle session from expiring.
+// logger is set to the zk conn, nil means the conn logs are written as info logs of the client,
+// logLevel is the verbosity of the client logs, breaker fails the operations fast during the outage,
+// retry retries the initial connection failed during the boot.
+func newZookeeperClient(name string, zkAddrs []string, timeout int, keepalive bool,
+	logger zk.Logger, logLevel log.Level, breaker *circuitBreaker, retry connectRetry) (*zookeeperClient, error) {
+	var (
+		err   error
+		event <-chan zk.Event
+		z     *zookeeperClient
+	)
+
+	z = &zookeeperClient{
+		name:          name,
+		zkAddrs:       zkAddrs,
+		timeout:       timeout,
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+		logLevel:      logLevel,
+		breaker:       breaker,
+	}
+	if logger == nil {
+		logger = zkConnLogger{z}
+	}
+	// connect to zookeeper
+	z.conn, event, err = retry.connect(zkAddrs, common.TimeSecondDuration(timeout), z.dial)
+	if err != nil {
+		return nil, err
+	}
+	z.conn.SetLogger(logger)
+
+	z.wait.Add(1)
+	go z.handleZkEvent(event)
+
+	if keepalive && timeout > 0 {
+		z.wait.Add(1)
+		go z.keepalive()
+	}
+
+	return z, nil
+}
+
+// newRegistryZookeeperClient creates the zk client with the options in the registry config
+func newRegistryZookeeperClient(name string, zkAddrs []string, conf ClientConfig) (*zookeeperClient, error) {
+	z, err := newZookeeperClient(name, zkAddrs, conf.Timeout, conf.KeepAlive, nil, parseLogLevel(conf.LogLevel),
+		newCircuitBreaker(conf.CircuitBreakerThreshold, common.TimeSecondDuration(conf.CircuitBreakerCooldown)),
+		newConnectRetry(conf.ConnectRetryTimes, time.Duration(conf.ConnectRetryBackoff)*time.Millisecond,
+			common.TimeSecondDuration(conf.ConnectRetryMaxDuration)))
+	if err != nil {
+		return nil, err
+	}
+	z.jitterMin = time.Duration(conf.WatchJitterMin) * time.Millisecond
+	z.jitterMax = time.Duration(conf.WatchJitterMax) * time.Millisecond
+	z.childrenWarn = conf.ChildrenWarnThreshold
+	z.childrenError = conf.ChildrenErrorThreshold
+	z.tempExists = conf.TempNodeExists
+	return z, nil
+}
+
+// parseLogLevel parses the log level of the zk client, which is one of debug, info, warn and error,
+// trace and fatal levels of MOSN are taken as debug and error. Unknown or empty level is taken as info
+func parseLogLevel(level string) log.Level {
+	switch strings.ToLower(level) {
+	case "debug", "trace":
+		return log.DEBUG
+	case "warn", "warning":
+		return log.WARNING
+	case "error", "fatal":
+		return log.ERROR
+	default:
+		return log.INFO
+	}
+}
+
+// logLevelOverride overrides the log level of all the clients at runtime, negative means not set
+var logLevelOverride int32 = -1
+
+// SetLogLevel changes the log level of all the clients at runtime, the running event loops included.
+// Empty level restores the level configured in each client
+func SetLogLevel(level string) {
+	if level == "" {
+		atomic.StoreInt32(&logLevelOverride, -1)
+		return
+	}
+	atomic.StoreInt32(&logLevelOverride, int32(parseLogLevel(level)))
+}
+
+func (z *zookeeperClient) level() log.Level {
+	if level := atomic.LoadInt32(&logLevelOverride); level >= 0 {
+		return log.Level(level)
+	}
+	return z.logLevel
+}
+
+func (z *zookeeperClient) logDebug(format string, args ...interface{}) {
+	if z.level() <= log.DEBUG {
+		log.Debug(format, args...)
+	}
+}
+
+func (z *zookeeperClient) logInfo(format string, args ...interface{}) {
+	if z.level() <= log.INFO {
+		log.Info(format, args...)
+	}
+}
+
+func (z *zookeeperClient) logWarn(format string, args ...interface{}) {
+	if z.level() <= log.WARNING {
+		log.Warn(format, args...)
+	}
+}
+
+// zkConnLogger writes the zk conn logs as the info logs of the client
+type zkConnLogger struct {
+	z *zookeeperClient
+}
+
+func (l zkConnLogger) Printf(format string, args ...interface{}) {
+	l.z.logInfo("zkClient{%s} conn: "+format, append([]interface{}{l.z.name}, args...)...)
+}
+
+// keepalive issues a cheap Exists("/") every timeout/3 with jitter until the client exits.
+// it complements the heartbeat of go-zookeeper, which may not keep the session warm behind some load balancers
+func (z *zookeeperClient) keepalive() {
+	defer func() {
+		z.wait.Done()
+		z.logInfo("zk{path:%v, name:%s} keepalive goroutine game over.", z.zkAddrs, z.name)
+	}()
+
+	interval := common.TimeSecondDuration(z.timeout) / 3
+	for {
+		// jitter in [interval*3/4, interval*5/4)
+		jitter := interval*3/4 + time.Duration(rand.Int63n(int64(interval/2)+1))
+		select {
+		case <-z.exit:
+			return
+		case <-time.After(jitter):
+		}
+
+		if conn := z.acquireConn(); conn != nil {
+			_, _, err := conn.Exists("/")
+			z.releaseConn()
+			if err != nil {
+				z.logWarn("zkClient{%s} keepalive conn.Exists(\"/\") = error{%v}", z.name, err)
+			}
+		}
+	}
+}
+
+func (z *zookeeperClient) handleZkEvent(session <-chan zk.Event) {
+	var event zk.Event
+
+	defer func() {
+		z.wait.Done()
+		z.logInfo("zk{path:%v, name:%s} connection goroutine game over.", z.zkAddrs, z.name)
+	}()
+
+LOOP:
+	for {
+		select {
+		case <-z.exit:
+			break LOOP
+		case event = <-session:
+			z.logDebug("client{%s} get a zookeeper event{type:%s, server:%s, path:%s, state:%d-%s, err:%v}",
+				z.name, event.Type, event.Server, event.Path, event.State, stateToString(event.State), event.Err)
+			z.updateReadOnly(event.State)
+			if event.Type == zk.EventSession {
+				switch event.State {
+				case zk.StateHasSession:
+					z.logInfo("zkClient{%s} session is established, session id:%#x, session timeout:%s, requested:%s",
+						z.name, z.SessionID(), z.SessionTimeout(), z.RequestedSessionTimeout())
+					z.breaker.probe()
+					z.notifySessionEvent()
+				case zk.StateDisconnected, zk.StateExpired:
+					// fail fast instead of waiting for the operation timeouts
+					z.breaker.trip()
+				}
+				if event.State == zk.StateExpired {
+					// the ephemeral nodes are gone with the session
+					z.clearTempNodes()
+				}
+			}
+			if event.Type == zk.EventNodeDeleted {
+				// the state of a node event is the session state, handle it by the event type
+				// so that the deletion is never taken as a data change
+				z.logInfo("zkClient{%s} get zk node deleted event{path:%s}", z.name, event.Path)
+				z.notifyPathEvent(event.Path)
+				continue
+			}
+			if event.Type == zk.EventNodeDataChanged || event.Type == zk.EventNodeChildrenChanged {
+				// same as the deletion, the state is the session state and never matches the event type
+				z.logInfo("zkClient{%s} get zk node changed event{path:%s}", z.name, event.Path)
+				z.notifyPathEvent(event.Path)
+				continue
+			}
+			switch event.State {
+			case zk.StateDisconnected:
+				// the conn reconnects by itself and resumes the session if it is not expired yet,
+				// the durable watches re-read on the re-established session
+				z.logWarn("zk{addr:%s} state is StateDisconnected, the zk client{name:%s} is reconnecting.", z.zkAddrs, z.name)
+			case zk.StateExpired:
+				// the ephemeral nodes are gone, the registry recreates the client to register them again
+				z.logWarn("zk{addr:%s} session is expired, so close the zk client{name:%s}.", z.zkAddrs, z.name)
+				z.stop()
+				z.closeConn()
+				break LOOP
+			}
+		}
+	}
+}
+
+// notifyPathEvent notifies the watchers of zkPath and its descendants
+func (z *zookeeperClient) notifyPathEvent(zkPath string) {
+	z.Lock()
+	for p := range z.eventRegistry {
+		if isZkSubPath(p, zkPath) {
+			z.logInfo("send event{Path:%s} notify event to path{%s} related watcher", zkPath, p)
+			z.notifyEvent(p)
+		}
+	}
+	z.Unlock()
+}
+
+// isZkSubPath returns true if path is parent or descendant of parent, the match is on segment
+// boundary, so /dubbo/foo is not a sub path of /dubbo/fo
+func isZkSubPath(path string, parent string) bool {
+	if parent == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+	parent = strings.TrimSuffix(parent, "/")
+	return path == parent || strings.HasPrefix(path, parent+"/")
+}
+
+// SessionID returns the current session id, 0 if there is no session
+func (z *zookeeperClient) SessionID() int64 {
+	z.Lock()
+	defer z.Unlock()
+	if z.conn == nil {
+		return 0
+	}
+	return z.conn.SessionID()
+}
+
+// SessionTimeout returns the session timeout negotiated with the server, the requested one bounded by the
+// min and max session timeout of the server. 0 if no session is established yet
+func (z *zookeeperClient) SessionTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&z.negotiated))
+}
+
+// RequestedSessionTimeout returns the session timeout the client asked for
+func (z *zookeeperClient) RequestedSessionTimeout() time.Duration {
+	z.Lock()
+	defer z.Unlock()
+	return common.TimeSecondDuration(z.timeout)
+}
+
+// connectResponseHead is the bytes of the connect response up to the session timeout:
+// the frame length, the protocol version and the timeout in milliseconds
+const connectResponseHead = 12
+
+// dial connects to a zk server, the connection captures the negotiated session timeout
+func (z *zookeeperClient) dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionConn{Conn: conn, z: z}, nil
+}
+
+// sessionConn reads the session timeout of the connect response, the first frame the server sends on a new
+// connection. go-zookeeper keeps the negotiated timeout unexported, and the connect response is read before
+// the StateHasSession event is sent
+type sessionConn struct {
+	net.Conn
+	z    *zookeeperClient
+	head []byte // the first bytes read until the session timeout, only read by the receiving goroutine
+}
+
+func (c *sessionConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if missing := connectResponseHead - len(c.head); missing > 0 && n > 0 {
+		if missing > n {
+			missing = n
+		}
+		c.head = append(c.head, b[:missing]...)
+		if len(c.head) == connectResponseHead {
+			// the server answers an expired session with timeout 0
+			if ms := int32(binary.BigEndian.Uint32(c.head[8:])); ms > 0 {
+				atomic.StoreInt64(&c.z.negotiated, int64(time.Duration(ms)*time.Millisecond))
+			}
+		}
+	}
+	return n, err
+}
+
+// updateReadOnly tracks the read-only mode by the session state
+func (z *zookeeperClient) updateReadOnly(state zk.State) {
+	switch state {
+	case zk.StateConnectedReadOnly:
+		if atomic.SwapInt32(&z.readOnly, 1) == 0 {
+			z.logWarn("zkClient{%s} is connected read-only, write operations will be rejected", z.name)
+		}
+	case zk.StateConnected, zk.StateHasSession, zk.StateDisconnected, zk.StateExpired:
+		if atomic.SwapInt32(&z.readOnly, 0) == 1 {
+			z.logInfo("zkClient{%s} leaves read-only mode, state:%s", z.name, stateToString(state))
+		}
+	}
+}
+
+// IsReadOnly returns true if the client is connected read-only, the reads such as
+// getChildren and existW still work while Create/Delete/RegisterTemp return ErrReadOnly
+func (z *zookeeperClient) IsReadOnly() bool {
+	return atomic.LoadInt32(&z.readOnly) == 1
+}
+
+// Snapshot returns a copy of the watched paths, the registered ephemeral nodes and the connection state,
+// it is safe to call concurrently with the event loop
+func (z *zookeeperClient) Snapshot() ClientSnapshot {
+	snapshot := ClientSnapshot{
+		Name:     z.name,
+		ZkAddrs:  append([]string{}, z.zkAddrs...),
+		State:    stateToString(zk.StateDisconnected),
+		ReadOnly: z.IsReadOnly(),
+	}
+
+	z.Lock()
+	if z.conn != nil {
+		snapshot.State = stateToString(z.conn.State())
+		snapshot.SessionID = z.conn.SessionID()
+	}
+	snapshot.WatchedPaths = make([]string, 0, len(z.eventRegistry))
+	for zkPath := range z.eventRegistry {
+		snapshot.WatchedPaths = append(snapshot.WatchedPaths, zkPath)
+	}
+	snapshot.TempNodes = make([]string, 0, len(z.tempNodes))
+	for zkPath := range z.tempNodes {
+		snapshot.TempNodes = append(snapshot.TempNodes, zkPath)
+	}
+	z.Unlock()
+
+	sort.Strings(snapshot.WatchedPaths)
+	sort.Strings(snapshot.TempNodes)
+
+	return snapshot
+}
+
+func (z *zookeeperClient) addTempNode(zkPath string) {
+	z.Lock()
+	if z.tempNodes == nil {
+		z.tempNodes = make(map[string]struct{})
+	}
+	z.tempNodes[zkPath] = struct{}{}
+	z.Unlock()
+}
+
+func (z *zookeeperClient) removeTempNode(zkPath string) {
+	z.Lock()
+	delete(z.tempNodes, zkPath)
+	z.Unlock()
+}
+
+func (z *zookeeperClient) clearTempNodes() {
+	z.Lock()
+	z.tempNodes = nil
+	z.Unlock()
+}
+
+// notifyEvent notifies the watchers of zkPath without blocking, must be called with z.Lock held.
+// A full channel already has a pending notification. The channels are closed by closeEvent under
+// the same lock, so a registered channel is never closed
+func (z *zookeeperClient) notifyEvent(zkPath string) {
+	for _, e := range z.eventRegistry[zkPath] {
+		sendEvent(*e)
+	}
+}
+
+func sendEvent(event chan struct{}) {
+	select {
+	case event <- struct{}{}:
+	default:
+	}
+}
+
+// eventToken unregisters the event on Close, it is safe to call Close more than once
+type eventToken struct {
+	z      *zookeeperClient
+	zkPath string
+	event  *chan struct{}
+	once   sync.Once
+}
+
+func (t *eventToken) Close() {
+	if t == nil {
+		return
+	}
+
+	t.once.Do(func() {
+		t.z.unregisterEvent(t.zkPath, t.event)
+	})
+}
+
+// registerEvent registers the event, the returned token must be closed after the event is no longer used
+func (z *zookeeperClient) registerEvent(zkPath string, event *chan struct{}) *eventToken {
+	if zkPath == "" || event == nil {
+		return nil
+	}
+
+	z.Lock()
+	a := z.eventRegistry[zkPath]
+	a = append(a, event)
+	z.eventRegistry[zkPath] = a
+	z.logDebug("zkClient{%s} register event{path:%s, ptr:%p}", z.name, zkPath, event)
+	z.Unlock()
+
+	return &eventToken{z: z, zkPath: zkPath, event: event}
+}
+
+// registerSessionEvent registers the event notified when the session is (re)established
+func (z *zookeeperClient) registerSessionEvent(event *chan struct{}) {
+	z.Lock()
+	z.sessionEvents = append(z.sessionEvents, event)
+	z.Unlock()
+}
+
+func (z *zookeeperClient) unregisterSessionEvent(event *chan struct{}) {
+	z.Lock()
+	for i, e := range z.sessionEvents {
+		if e == event {
+			z.sessionEvents = append(z.sessionEvents[:i], z.sessionEvents[i+1:]...)
+			break
+		}
+	}
+	z.Unlock()
+}
+
+func (z *zookeeperClient) notifySessionEvent() {
+	z.Lock()
+	for _, e := range z.sessionEvents {
+		sendEvent(*e)
+	}
+	z.Unlock()
+}
+
+// LenWatches returns the number of registered events, for leak diagnostics
+func (z *zookeeperClient) LenWatches() int {
+	z.Lock()
+	defer z.Unlock()
+
+	n := 0
+	for _, a := range z.eventRegistry {
+		n += len(a)
+	}
+
+	return n
+}
+
+func (z *zookeeperClient) unregisterEvent(zkPath string, event *chan struct{}) {
+	if zkPath == "" {
+		return
+	}
+
+	z.Lock()
+	for {
+		a, ok := z.eventRegistry[zkPath]
+		if !ok {
+			break
+		}
+		for i, e := range a {
+			if e == event {
+				arr := a
+				a = append(arr[:i], arr[i+1:]...)
+				z.logDebug("zkClient{%s} unregister event{path:%s, event:%p}", z.name, zkPath, event)
+			}
+		}
+		z.logDebug("after zkClient{%s} unregister event{path:%s, event:%p}, array length %d",
+			z.name, zkPath, event, len(a))
+		if len(a) == 0 {
+			delete(z.eventRegistry, zkPath)
+		} else {
+			z.eventRegistry[zkPath] = a
+		}
+		break
+	}
+	z.Unlock()
+}
+
+// closeEvent removes the event from the registry then closes it under the lock, so that no notification
+// is sent to the closed channel even if the watcher never unregistered it. The registered channels must be
+// closed by closeEvent only
+func (z *zookeeperClient) closeEvent(event *chan struct{}) {
+	z.Lock()
+	for zkPath, a := range z.eventRegistry {
+		alive := a[:0]
+		for _, e := range a {
+			if e != event {
+				alive = append(alive, e)
+			}
+		}
+		for i := len(alive); i < len(a); i++ {
+			a[i] = nil
+		}
+		if len(alive) == 0 {
+			delete(z.eventRegistry, zkPath)
+		} else {
+			z.eventRegistry[zkPath] = alive
+		}
+	}
+	for i, e := range z.sessionEvents {
+		if e == event {
+			z.sessionEvents = append(z.sessionEvents[:i], z.sessionEvents[i+1:]...)
+			break
+		}
+	}
+	close(*event)
+	z.Unlock()
+}
+
+func (z *zookeeperClient) done() <-chan struct{} {
+	return z.exit
+}
+
+// Done is closed once the client is closed
+func (z *zookeeperClient) Done() <-chan struct{} {
+	return z.done()
+}
+
+func (z *zookeeperClient) stop() bool {
+	select {
+	case <-z.exit:
+		return true
+	default:
+		close(z.exit)
+	}
+
+	return false
+}
+
+func (z *zookeeperClient) zkConnValid() bool {
+	select {
+	case <-z.exit:
+		return false
+	default:
+	}
+
+	valid := true
+	z.Lock()
+	if z.conn == nil {
+		valid = false
+	}
+	z.Unlock()
+
+	return valid
+}
+
+// acquireConn returns the current conn, every non-nil conn must be released by releaseConn after the rpc
+func (z *zookeeperClient) acquireConn() *zk.Conn {
+	z.Lock()
+	conn := z.conn
+	if conn != nil {
+		z.rpcWait.Add(1)
+	}
+	z.Unlock()
+
+	return conn
+}
+
+func (z *zookeeperClient) releaseConn() {
+	z.rpcWait.Done()
+}
+
+// withConn runs fn on the current conn guarded by the circuit breaker, fn is not called if the conn is nil.
+// The conn may be closed during fn by the event loop, zk.ErrConnectionClosed and zk.ErrClosing are
+// returned as ErrConnectionLost so that the callers can retry uniformly
+func (z *zookeeperClient) withConn(fn func(conn *zk.Conn) error) error {
+	if err := z.breaker.allow(); err != nil {
+		return err
+	}
+
+	conn := z.acquireConn()
+	if conn == nil {
+		z.breaker.done(ZK_CLIENT_CONN_NIL_ERR)
+		return ZK_CLIENT_CONN_NIL_ERR
+	}
+	err := fn(conn)
+	z.releaseConn()
+	z.breaker.done(err)
+
+	switch err {
+	case zk.ErrConnectionClosed, zk.ErrClosing:
+		return ErrConnectionLost
+	}
+	return err
+}
+
+// closeConn detaches the conn so that no new rpc can get it and closes it, the in-flight rpc fail fast
+// with zk.ErrClosing instead of blocking the event loop, and closeConn returns after all of them returned
+func (z *zookeeperClient) closeConn() {
+	z.Lock()
+	conn := z.conn
+	z.conn = nil
+	z.Unlock()
+
+	if conn != nil {
+		conn.Close()
+		z.rpcWait.Wait()
+	}
+}
+
+func (z *zookeeperClient) Close() {
+	z.stop()
+	z.wait.Wait()
+	z.closeConn() // 等着所有的goroutine退出后，再关闭连接
+	z.logWarn("zkClient{name:%s, zk addr:%s} exit now.", z.name, z.zkAddrs)
+}
+
+// zkPathNodes returns every node from the root to the absolute basePath, e.g. "/a/b/" -> ["/a", "/a/b"].
+// duplicated and trailing slashes are ignored, the root "/" has no node to create.
+func zkPathNodes(basePath string) ([]string, error) {
+	if !strings.HasPrefix(basePath, "/") {
+		return nil, jerrors.Errorf("zk path{%q} is not an absolute path", basePath)
+	}
+
+	var (
+		nodes   []string
+		tmpPath string
+	)
+	for _, str := range strings.Split(path.Clean(basePath), "/")[1:] {
+		if str == "" {
+			continue
+		}
+		tmpPath = tmpPath + "/" + str
+		nodes = append(nodes, tmpPath)
+	}
+
+	return nodes, nil
+}
+
+// 节点须逐级创建
+func (z *zookeeperClient) Create(basePath string) error {
+	var (
+		err   error
+		nodes []string
+	)
+
+	z.logDebug("zookeeperClient.Create(basePath{%s})", basePath)
+	if z.IsReadOnly() {
+		return ErrReadOnly
+	}
+	if nodes, err = zkPathNodes(basePath); err != nil {
+		return jerrors.Annotatef(err, "zk.Create(path:%s)", basePath)
+	}
+	for _, tmpPath := range nodes {
+		// log.Debug("create zookeeper path: \"%s\"\n", tmpPath)
+		err = z.withConn(func(conn *zk.Conn) error {
+			_, err := conn.Create(tmpPath, []byte(""), 0, zk.WorldACL(zk.PermAll))
+			return err
+		})
+		if err != nil {
+			if err == zk.ErrNodeExists {
+				log.Error("zk.create(\"%s\") exists\n", tmpPath)
+			} else {
+				log.Error("zk.create(\"%s\") error(%v)\n", tmpPath, jerrors.ErrorStack(err))
+				return jerrors.Annotatef(err, "zk.Create(path:%s)", basePath)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 像创建一样，删除节点的时候也只能从叶子节点逐级回退删除
+// 当节点还有子节点的时候，删除是不会成功的
+func (z *zookeeperClient) Delete(basePath string) error {
+	if z.IsReadOnly() {
+		return ErrReadOnly
+	}
+	err := z.withConn(func(conn *zk.Conn) error {
+		return conn.Delete(basePath, -1)
+	})
+	if err == nil || err == zk.ErrNoNode {
+		z.removeTempNode(basePath)
+	}
+
+	return jerrors.Annotatef(err, "Delete(basePath:%s)", basePath)
+}
+
+// maxTreeDepth guards the recursion of DeleteTree and ListTree
+const maxTreeDepth = 32
+
+// DeleteTree deletes basePath and all its descendants, the leaves first. The nodes deleted concurrently
+// are taken as deleted, a node created concurrently under a deleting parent fails the deletion.
+// Use ListTree to check the nodes to delete before
+func (z *zookeeperClient) DeleteTree(basePath string) error {
+	if z.IsReadOnly() {
+		return ErrReadOnly
+	}
+	nodes, err := z.ListTree(basePath)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		err = z.withConn(func(conn *zk.Conn) error {
+			return conn.Delete(node, -1)
+		})
+		if err != nil && err != zk.ErrNoNode {
+			log.Error("zkClient{%s} conn.Delete(\"%s\") error(%v)\n", z.name, node, err)
+			return jerrors.Annotatef(err, "DeleteTree(basePath:%s, node:%s)", basePath, node)
+		}
+		z.removeTempNode(node)
+	}
+	z.logInfo("zkClient{%s} delete zookeeper tree:%s, %d nodes", z.name, basePath, len(nodes))
+
+	return nil
+}
+
+// ListTree returns basePath and all its descendants in the deletion order of DeleteTree, the leaves first,
+// it is the dry run of DeleteTree. A missing basePath has no node
+func (z *zookeeperClient) ListTree(basePath string) ([]string, error) {
+	if !strings.HasPrefix(basePath, "/") || path.Clean(basePath) == "/" {
+		return nil, jerrors.Errorf("zk path{%q} is not an absolute path or is the root", basePath)
+	}
+
+	nodes, err := zkTreeNodes(path.Clean(basePath), maxTreeDepth, func(zkPath string) (children []string, err error) {
+		err = z.withConn(func(conn *zk.Conn) (err error) {
+			children, _, err = conn.Children(zkPath)
+			return err
+		})
+		return children, err
+	})
+	if err != nil {
+		return nil, jerrors.Annotatef(err, "ListTree(basePath:%s)", basePath)
+	}
+
+	return nodes, nil
+}
+
+// zkTreeNodes lists zkPath and its descendants in post order by children, the node gone while listing
+// (zk.ErrNoNode) is skipped. It returns ErrTreeTooDeep if the tree is deeper than maxDepth
+func zkTreeNodes(zkPath string, maxDepth int, children func(zkPath string) ([]string, error)) ([]string, error) {
+	if maxDepth <= 0 {
+		return nil, ErrTreeTooDeep
+	}
+
+	names, err := children(zkPath)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	for _, name := range names {
+		descendants, err := zkTreeNodes(path.Join(zkPath, name), maxDepth-1, children)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, descendants...)
+	}
+
+	return append(nodes, zkPath), nil
+}
+
+func (z *zookeeperClient) RegisterTemp(basePath string, node string) (string, error) {
+	var (
+		err     error
+		data    []byte
+		zkPath  string
+		tmpPath string
+	)
+
+	if z.IsReadOnly() {
+		return "", ErrReadOnly
+	}
+	data = []byte("")
+	zkPath = path.Join(basePath) + "/" + node
+	err = z.withConn(func(conn *zk.Conn) (err error) {
+		tmpPath, err = conn.Create(zkPath, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+		if err == zk.ErrNodeExists && z.tempExists != TempNodeExistsFail {
+			tmpPath, err = z.registerExistingTemp(conn, zkPath, data)
+		}
+		return err
+	})
+	if err != nil {
+		log.Error("conn.Create(\"%s\", zk.FlagEphemeral) = error(%v)\n", zkPath, jerrors.ErrorStack(err))
+		return "", jerrors.Annotatef(err, "zk.Create(path:%s, zk.FlagEphemeral)", basePath)
+	}
+	z.logDebug("zkClient{%s} create a temp zookeeper node:%s\n", z.name, tmpPath)
+	z.addTempNode(tmpPath)
+
+	return tmpPath, nil
+}
+
+// Policies of RegisterTemp if the node exists, see ClientConfig.TempNodeExists
+const (
+	TempNodeExistsFail      = ""
+	TempNodeExistsVerify    = "verify"
+	TempNodeExistsOverwrite = "overwrite"
+)
+
+// existingTempAction is how RegisterTemp handles the existing node
+type existingTempAction int
+
+const (
+	existingTempFail existingTempAction = iota
+	existingTempKeep
+	existingTempReplace
+)
+
+// existingTempNodeAction decides by the policy how to handle the existing node owned by the session owner.
+// The node is kept if it is an ephemeral node of the current session with the same data, it is replaced
+// only by the overwrite policy, otherwise RegisterTemp fails as the node exists
+func existingTempNodeAction(policy string, session int64, owner int64, data []byte, existing []byte) existingTempAction {
+	switch {
+	case policy == TempNodeExistsFail:
+		return existingTempFail
+	case session != 0 && owner == session && bytes.Equal(data, existing):
+		return existingTempKeep
+	case policy == TempNodeExistsOverwrite:
+		return existingTempReplace
+	default:
+		return existingTempFail
+	}
+}
+
+// registerExistingTemp handles zk.ErrNodeExists of RegisterTemp by the tempExists policy
+func (z *zookeeperClient) registerExistingTemp(conn *zk.Conn, zkPath string, data []byte) (string, error) {
+	existing, stat, err := conn.Get(zkPath)
+	if err == zk.ErrNoNode {
+		// reaped in the meantime
+		return conn.Create(zkPath, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch existingTempNodeAction(z.tempExists, conn.SessionID(), stat.EphemeralOwner, data, existing) {
+	case existingTempKeep:
+		z.logInfo("zkClient{%s} temp zookeeper node:%s exists in the current session\n", z.name, zkPath)
+		return zkPath, nil
+	case existingTempReplace:
+		z.logWarn("zkClient{%s} replace the temp zookeeper node:%s of session:%#x\n", z.name, zkPath, stat.EphemeralOwner)
+		// the version fails the delete if the node is replaced by others in the meantime
+		if err = conn.Delete(zkPath, stat.Version); err != nil && err != zk.ErrNoNode {
+			return "", err
+		}
+		return conn.Create(zkPath, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	default:
+		return "", zk.ErrNodeExists
+	}
+}
+
+// maxTTL is the max ttl of a TTL node, the ttl is stored in the lower 40 bits of the ephemeral owner
+const maxTTL = time.Duration(0xFFFFFFFFFF) * time.Millisecond
+
+// createTTL creates a persistent node with ttl (CreateMode.PERSISTENT_WITH_TTL) by the createTTL request
+// (opcode 21) of zookeeper 3.5.3+, it is replaced in the tests
+var createTTL = func(conn *zk.Conn, zkPath string, data []byte, ttl time.Duration) (string, error) {
+	return conn.CreateTTL(zkPath, data, zk.FlagTTL, zk.WorldACL(zk.PermAll), ttl)
+}
+
+// errUnimplemented is the error of the server code ZUNIMPLEMENTED (-6), which the ensemble older than 3.5.3
+// or without extended types enabled (zookeeper.extendedTypesEnabled) replies to the TTL node creation.
+// go-zookeeper exports no sentinel of the code and formats a new error for each reply, so the reply is
+// matched by the error formatted the same way from the library's ErrCode
+var errUnimplemented = fmt.Errorf("unknown error: %v", zk.ErrCode(-6))
+
+func isUnimplemented(err error) bool {
+	return err != nil && err.Error() == errUnimplemented.Error()
+}
+
+// RegisterTTL creates node under basePath as a TTL node. Unlike the ephemeral node of RegisterTemp, it
+// survives the session, e.g. a brief restart of the client, and is deleted by the ensemble once it has
+// no children and is not modified within ttl. Refresh it by UpdateTempData before it expires.
+// It returns ErrTTLNotSupported if the ensemble does not support TTL nodes, the caller may fall back to RegisterTemp
+func (z *zookeeperClient) RegisterTTL(basePath, node string, ttl time.Duration) (string, error) {
+	var (
+		err     error
+		zkPath  string
+		ttlPath string
+	)
+
+	if ttl < time.Millisecond || ttl > maxTTL {
+		return "", jerrors.Errorf("zk.RegisterTTL(path:%s, node:%s) invalid ttl %v", basePath, node, ttl)
+	}
+	if z.IsReadOnly() {
+		return "", ErrReadOnly
+	}
+	zkPath = path.Join(basePath) + "/" + node
+	err = z.withConn(func(conn *zk.Conn) (err error) {
+		ttlPath, err = createTTL(conn, zkPath, []byte(""), ttl)
+		return err
+	})
+	if err != nil {
+		if isUnimplemented(err) {
+			return "", ErrTTLNotSupported
+		}
+		log.Error("zkClient{%s} createTTL(\"%s\", ttl:%v) error(%v)\n", z.name, zkPath, ttl, jerrors.ErrorStack(err))
+		return "", jerrors.Annotatef(err, "zk.CreateTTL(path:%s, ttl:%v)", zkPath, ttl)
+	}
+	z.logDebug("zkClient{%s} create a ttl zookeeper node:%s, ttl:%v\n", z.name, ttlPath, ttl)
+
+	return ttlPath, nil
+}
+
+func (z *zookeeperClient) RegisterTempSeq(basePath string, data []byte) (string, error) {
+	var (
+		err     error
+		tmpPath string
+	)
+
+	if z.IsReadOnly() {
+		return "", ErrReadOnly
+	}
+	err = z.withConn(func(conn *zk.Conn) (err error) {
+		tmpPath, err = conn.Create(path.Join(basePath)+"/", data, zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+		return err
+	})
+	z.logDebug("zookeeperClient.RegisterTempSeq(basePath{%s}) = tempPath{%s}", basePath, tmpPath)
+	if err != nil {
+		log.Error("zkClient{%s} conn.Create(\"%s\", \"%s\", zk.FlagEphemeral|zk.FlagSequence) error(%v)\n",
+			z.name, basePath, string(data), err)
+		// if err != zk.ErrNodeExists {
+		return "", jerrors.Annotatef(err, "zk.Create(path:%s, zk.FlagEphemeral|zk.FlagSequence)", basePath)
+		// }
+	}
+	z.logDebug("zkClient{%s} create a temp zookeeper node:%s\n", z.name, tmpPath)
+	z.addTempNode(tmpPath)
+
+	return tmpPath, nil
+}
+
+// UpdateTempData sets the data of the ephemeral node created by RegisterTemp or RegisterTempSeq in place,
+// the node keeps bound to the session and the data watchers are notified with zk.EventNodeDataChanged.
+// It returns ErrNodeNotExist if the node is gone, the caller should register it again
+func (z *zookeeperClient) UpdateTempData(zkPath string, data []byte) error {
+	if z.IsReadOnly() {
+		return ErrReadOnly
+	}
+	err := z.withConn(func(conn *zk.Conn) error {
+		_, err := conn.Set(zkPath, data, -1)
+		return err
+	})
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return ErrNodeNotExist
+		}
+		log.Error("zkClient{%s} conn.Set(\"%s\") error(%v)\n", z.name, zkPath, jerrors.ErrorStack(err))
+		return jerrors.Annotatef(err, "zk.Set(path:%s)", zkPath)
+	}
+	z.logDebug("zkClient{%s} update the data of temp zookeeper node:%s\n", z.name, zkPath)
+
+	return nil
+}
+
+func (z *zookeeperClient) getChildrenW(path string) ([]string, <-chan zk.Event, error) {
+	var (
+		err      error
+		children []string
+		stat     *zk.Stat
+		watch    <-chan zk.Event
+	)
+
+	err = z.withConn(func(conn *zk.Conn) (err error) {
+		children, stat, watch, err = conn.ChildrenW(path)
+		return err
+	})
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil, jerrors.Errorf("path{%s} has none children", path)
+		}
+		log.Error("zk.ChildrenW(path{%s}) = error(%v)", path, err)
+		return nil, nil, jerrors.Annotatef(err, "zk.ChildrenW(path:%s)", path)
+	}
+	if stat == nil {
+		return nil, nil, jerrors.Errorf("path{%s} has none children", path)
+	}
+	if len(children) == 0 {
+		return nil, nil, jerrors.Errorf("path{%s} has none children", path)
+	}
+	if err = z.checkChildren(path, len(children)); err != nil {
+		return nil, nil, err
+	}
+
+	return children, watch, nil
+}
+
+// WatchChildrenDurable watches the children of zkPath until stop is called or the client exits.
+// The full current children set is sent on every notification so that the caller can diff, a missing
+// zkPath is sent as an empty set. The one-shot zk watch is re-armed after each event, and the children
+// are re-read as soon as the session is re-established, so the changes during the disconnection are not lost.
+// The client survives the disconnection, the watch stops only if the session expires, as the client is closed.
+// Only the latest set is kept for a slow receiver, the channel is closed after the watch stops.
+func (z *zookeeperClient) WatchChildrenDurable(zkPath string) (<-chan []string, func()) {
+	var (
+		once    sync.Once
+		quit    = make(chan struct{})
+		ch      = make(chan []string, 1)
+		session = make(chan struct{}, 1)
+	)
+
+	z.registerSessionEvent(&session)
+	go func() {
+		defer func() {
+			z.unregisterSessionEvent(&session)
+			close(ch)
+		}()
+
+		for {
+			var retry <-chan time.Time
+			children, watch, err := z.childrenDurableW(zkPath)
+			if err != nil {
+				z.logWarn("zkClient{%s} watch children of path{%s} = error{%v}, retry later", z.name, zkPath, err)
+				retry = time.After(common.TimeSecondDuration(registry.REGISTRY_CONN_DELAY))
+			} else {
+				sendLatestChildren(ch, children)
+			}
+
+			select {
+			case <-watch:
+			case <-retry:
+				continue
+			case <-session:
+				z.logInfo("zkClient{%s} session is re-established, re-read children of path{%s}", z.name, zkPath)
+			case <-quit:
+				return
+			case <-z.done():
+				return
+			}
+			if !z.waitWatchJitter(session, quit) {
+				return
+			}
+		}
+	}()
+
+	return ch, func() {
+		once.Do(func() {
+			close(quit)
+		})
+	}
+}
+
+// WatchDataDurable watches the data of zkPath, e.g. the ephemeral node updated by UpdateTempData, the same
+// as WatchChildrenDurable the watch is re-armed on every event and the session recovery. Only the latest
+// data is kept for a slow receiver, nil is sent while zkPath is missing. The channel is closed once stop is
+// called or the client is closed
+func (z *zookeeperClient) WatchDataDurable(zkPath string) (<-chan []byte, func()) {
+	var (
+		once    sync.Once
+		quit    = make(chan struct{})
+		ch      = make(chan []byte, 1)
+		session = make(chan struct{}, 1)
+	)
+
+	z.registerSessionEvent(&session)
+	go func() {
+		defer func() {
+			z.unregisterSessionEvent(&session)
+			close(ch)
+		}()
+
+		for {
+			var retry <-chan time.Time
+			data, watch, err := z.dataDurableW(zkPath)
+			if err != nil {
+				z.logWarn("zkClient{%s} watch data of path{%s} = error{%v}, retry later", z.name, zkPath, err)
+				retry = time.After(common.TimeSecondDuration(registry.REGISTRY_CONN_DELAY))
+			} else {
+				sendLatestData(ch, data)
+			}
+
+			select {
+			case <-watch:
+			case <-retry:
+				continue
+			case <-session:
+				z.logInfo("zkClient{%s} session is re-established, re-read data of path{%s}", z.name, zkPath)
+			case <-quit:
+				return
+			case <-z.done():
+				return
+			}
+			if !z.waitWatchJitter(session, quit) {
+				return
+			}
+		}
+	}()
+
+	return ch, func() {
+		once.Do(func() {
+			close(quit)
+		})
+	}
+}
+
+// dataDurableW returns the data of zkPath with the watch of it, if zkPath is missing,
+// nil is returned with the watch of its creation
+func (z *zookeeperClient) dataDurableW(zkPath string) (data []byte, watch <-chan zk.Event, err error) {
+	err = z.withConn(func(conn *zk.Conn) error {
+		var err error
+		data, _, watch, err = zkGetW(conn, zkPath)
+		if err != zk.ErrNoNode {
+			return err
+		}
+
+		exist, _, existWatch, err := conn.ExistsW(zkPath)
+		if err != nil {
+			return err
+		}
+		if exist {
+			// created after the GetW
+			data, _, watch, err = zkGetW(conn, zkPath)
+			return err
+		}
+
+		data, watch = nil, existWatch
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, watch, nil
+}
+
+// sendLatestData replaces the unread data in ch, ch must have only one sender
+func sendLatestData(ch chan []byte, data []byte) {
+	for {
+		select {
+		case ch <- data:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
+
+// default bounds of the delay before re-reading the watched children
+const (
+	defaultWatchJitterMin = 50 * time.Millisecond
+	defaultWatchJitterMax = 500 * time.Millisecond
+)
+
+// watchJitter returns a random delay in [jitterMin, jitterMax), zero if disabled
+func (z *zookeeperClient) watchJitter() time.Duration {
+	min, max := z.jitterMin, z.jitterMax
+	if max < 0 {
+		return 0
+	}
+	if max == 0 {
+		min, max = defaultWatchJitterMin, defaultWatchJitterMax
+	}
+	if min < 0 {
+		min = 0
+	}
+	if min >= max {
+		return max
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
+
+// waitWatchJitter delays the re-read after a change. All the instances watching the path are notified at
+// the same time on a mass change, so the re-reads are spread by the jitter. The session events during the
+// delay are coalesced into the re-read, the zk watch is one-shot and never fires again before re-armed.
+// It returns false if the watch stops
+func (z *zookeeperClient) waitWatchJitter(session chan struct{}, quit chan struct{}) bool {
+	if jitter := z.watchJitter(); jitter > 0 {
+		select {
+		case <-time.After(jitter):
+		case <-quit:
+			return false
+		case <-z.done():
+			return false
+		}
+	}
+
+	select {
+	case <-session:
+	default:
+	}
+	return true
+}
+
+// zkChildrenW and zkGetW are the watched reads of the durable watches, they are replaced in the tests
+var (
+	zkChildrenW = func(conn *zk.Conn, zkPath string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+		return conn.ChildrenW(zkPath)
+	}
+	zkGetW = func(conn *zk.Conn, zkPath string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+		return conn.GetW(zkPath)
+	}
+)
+
+// childrenDurableW returns the children of zkPath with the watch of them, if zkPath is missing,
+// an empty set is returned with the watch of its creation
+func (z *zookeeperClient) childrenDurableW(zkPath string) (children []string, watch <-chan zk.Event, err error) {
+	err = z.withConn(func(conn *zk.Conn) error {
+		var err error
+		children, _, watch, err = zkChildrenW(conn, zkPath)
+		if err != zk.ErrNoNode {
+			return err
+		}
+
+		exist, _, existWatch, err := conn.ExistsW(zkPath)
+		if err != nil {
+			return err
+		}
+		if exist {
+			// created after the ChildrenW
+			children, _, watch, err = zkChildrenW(conn, zkPath)
+			return err
+		}
+
+		children, watch = []string{}, existWatch
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = z.checkChildren(zkPath, len(children)); err != nil {
+		return nil, nil, err
+	}
+
+	return children, watch, nil
+}
+
+// sendLatestChildren replaces the unread children set in ch, ch must have only one sender
+func sendLatestChildren(ch chan []string, children []string) {
+	for {
+		select {
+		case ch <- children:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
+
+func (z *zookeeperClient) getChildren(path string) ([]string, error) {
+	var (
+		err      error
+		children []string
+		stat     *zk.Stat
+	)
+
+	err = z.withConn(func(conn *zk.Conn) (err error) {
+		children, stat, err = conn.Children(path)
+		return err
+	})
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, jerrors.Errorf("path{%s} has none children", path)
+		}
+		log.Error("zk.Children(path{%s}) = error(%v)", path, jerrors.ErrorStack(err))
+		return nil, jerrors.Annotatef(err, "zk.Children(path:%s)", path)
+	}
+	if stat == nil {
+		return nil, jerrors.Errorf("path{%s} has none children", path)
+	}
+	if len(children) == 0 {
+		return nil, jerrors.Errorf("path{%s} has none children", path)
+	}
+	if err = z.checkChildren(path, len(children)); err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
+
+// checkChildren warns of the children count of path above the warn threshold, which is usually leaked
+// registrations, and returns ErrTooManyChildren above the error threshold. Zero threshold means no limit
+func (z *zookeeperClient) checkChildren(path string, count int) error {
+	if z.childrenError > 0 && count > z.childrenError {
+		log.Error("zkClient{%s} path{%s} has %d children, more than the error threshold %d",
+			z.name, path, count, z.childrenError)
+		return jerrors.Annotatef(ErrTooManyChildren, "path{%s} has %d children", path, count)
+	}
+	if z.childrenWarn > 0 && count > z.childrenWarn {
+		z.logWarn("zkClient{%s} path{%s} has %d children, more than the warn threshold %d, are the registrations leaked?",
+			z.name, path, count, z.childrenWarn)
+	}
+
+	return nil
+}
+
+// GetChildren returns the children names of zkPath, an empty zkPath has no children.
+// It returns ErrNodeNotExist if zkPath is missing
+func (z *zookeeperClient) GetChildren(zkPath string) ([]string, error) {
+	var children []string
+
+	err := z.withConn(func(conn *zk.Conn) (err error) {
+		children, _, err = conn.Children(zkPath)
+		return err
+	})
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, ErrNodeNotExist
+		}
+		log.Error("zkClient{%s} conn.Children(\"%s\") error(%v)\n", z.name, zkPath, jerrors.ErrorStack(err))
+		return nil, jerrors.Annotatef(err, "zk.Children(path:%s)", zkPath)
+	}
+	if err = z.checkChildren(zkPath, len(children)); err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
+
+// ChildrenResult is the children of a path fetched by GetChildrenBatch, or the error of the path
+type ChildrenResult struct {
+	Children []string
+	Err      error
+}
+
+// GetChildrenBatch returns the children of each path, or the error of the path, e.g. ErrNodeNotExist
+// if it is missing, so that a failed path doesn't fail the others. The conn is acquired once, and the
+// requests are pipelined on it instead of waiting for the round-trips one by one.
+// An error is returned only if no request can be sent, e.g. the conn is nil
+func (z *zookeeperClient) GetChildrenBatch(paths []string) (map[string]ChildrenResult, error) {
+	unique := make(map[string]struct{}, len(paths))
+	results := make(map[string]ChildrenResult, len(paths))
+	err := z.withConn(func(conn *zk.Conn) error {
+		var (
+			wg      sync.WaitGroup
+			mux     sync.Mutex
+			connErr error
+		)
+		for _, zkPath := range paths {
+			if _, ok := unique[zkPath]; ok {
+				continue
+			}
+			unique[zkPath] = struct{}{}
+
+			wg.Add(1)
+			go func(zkPath string) {
+				defer wg.Done()
+				children, _, err := conn.Children(zkPath)
+				result := z.childrenResult(zkPath, children, err)
+
+				mux.Lock()
+				results[zkPath] = result
+				if connErr == nil && isZkConnError(err) {
+					connErr = err
+				}
+				mux.Unlock()
+			}(zkPath)
+		}
+		wg.Wait()
+
+		// reported to the circuit breaker, the results of the paths are returned anyway
+		return connErr
+	})
+	if err != nil && len(results) == 0 {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// childrenResult converts the result of conn.Children in the same way as GetChildren
+func (z *zookeeperClient) childrenResult(zkPath string, children []string, err error) ChildrenResult {
+	switch err {
+	case nil:
+	case zk.ErrNoNode:
+		return ChildrenResult{Err: ErrNodeNotExist}
+	case zk.ErrConnectionClosed, zk.ErrClosing:
+		return ChildrenResult{Err: ErrConnectionLost}
+	default:
+		log.Error("zkClient{%s} conn.Children(\"%s\") error(%v)\n", z.name, zkPath, jerrors.ErrorStack(err))
+		return ChildrenResult{Err: jerrors.Annotatef(err, "zk.Children(path:%s)", zkPath)}
+	}
+	if err = z.checkChildren(zkPath, len(children)); err != nil {
+		return ChildrenResult{Err: err}
+	}
+
+	return ChildrenResult{Children: children}
+}
+
+// ExistsWatch arms a watch on zkPath whether it exists or not, a non-existent path is not an error,
+// the watch will be notified with zk.EventNodeCreated when the node is created
+func (z *zookeeperClient) ExistsWatch(zkPath string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	var (
+		exist bool
+		err   error
+		stat  *zk.Stat
+		watch <-chan zk.Event
+	)
+
+	err = z.withConn(func(conn *zk.Conn) (err error) {
+		exist, stat, watch, err = conn.ExistsW(zkPath)
+		return err
+	})
+	if err != nil {
+		log.Error("zkClient{%s}.ExistsW(path{%s}) = error{%v}.", z.name, zkPath, jerrors.ErrorStack(err))
+		return false, nil, nil, jerrors.Annotatef(err, "zk.ExistsW(path:%s)", zkPath)
+	}
+
+	return exist, stat, watch, nil
+}
+
+func (z *zookeeperClient) existW(zkPath string) (<-chan zk.Event, error) {
+	exist, _, watch, err := z.ExistsWatch(zkPath)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		z.logWarn("zkClient{%s}'s App zk path{%s} does not exist.", z.name, zkPath)
+		return nil, jerrors.Errorf("zkClient{%s} App zk path{%s} does not exist.", z.name, zkPath)
+	}
+
+	return watch, nil
+}
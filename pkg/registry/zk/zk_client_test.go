@@ -0,0 +1,827 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zookeeper
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+func TestZkPathNodes(t *testing.T) {
+	testCases := []struct {
+		path  string
+		nodes []string
+		err   bool
+	}{
+		{"", nil, true},
+		{"/", nil, false},
+		{"no-leading-slash", nil, true},
+		{"relative/path", nil, true},
+		{"/trailing/", []string{"/trailing"}, false},
+		{"/dubbo//com.test.Service/providers/", []string{"/dubbo", "/dubbo/com.test.Service", "/dubbo/com.test.Service/providers"}, false},
+	}
+
+	for _, tc := range testCases {
+		nodes, err := zkPathNodes(tc.path)
+		if (err != nil) != tc.err {
+			t.Errorf("zkPathNodes(%q) error = %v, expect error %v", tc.path, err, tc.err)
+		}
+		if !reflect.DeepEqual(nodes, tc.nodes) {
+			t.Errorf("zkPathNodes(%q) = %v, expect %v", tc.path, nodes, tc.nodes)
+		}
+	}
+}
+
+func TestZkTreeNodes(t *testing.T) {
+	tree := map[string][]string{
+		"/dubbo":                            {"com.test.Service", "gone"},
+		"/dubbo/com.test.Service":           {"providers", "consumers"},
+		"/dubbo/com.test.Service/providers": {"node1"},
+	}
+	children := func(zkPath string) ([]string, error) {
+		if zkPath == "/dubbo/gone" {
+			// deleted concurrently
+			return nil, zk.ErrNoNode
+		}
+		return tree[zkPath], nil
+	}
+
+	nodes, err := zkTreeNodes("/dubbo", maxTreeDepth, children)
+	expected := []string{
+		"/dubbo/com.test.Service/providers/node1",
+		"/dubbo/com.test.Service/providers",
+		"/dubbo/com.test.Service/consumers",
+		"/dubbo/com.test.Service",
+		"/dubbo",
+	}
+	if err != nil || !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expect %v, got %v, %v", expected, nodes, err)
+	}
+
+	if _, err := zkTreeNodes("/dubbo", 3, children); err != ErrTreeTooDeep {
+		t.Errorf("expect ErrTreeTooDeep, got %v", err)
+	}
+	if nodes, err := zkTreeNodes("/dubbo/gone", maxTreeDepth, children); err != nil || len(nodes) != 0 {
+		t.Errorf("expect no nodes of missing path, got %v, %v", nodes, err)
+	}
+	if _, err := zkTreeNodes("/dubbo", maxTreeDepth, func(string) ([]string, error) {
+		return nil, ErrConnectionLost
+	}); err != ErrConnectionLost {
+		t.Errorf("expect ErrConnectionLost, got %v", err)
+	}
+}
+
+func TestDeleteTreeWithoutConn(t *testing.T) {
+	z := &zookeeperClient{name: "test"}
+	for _, basePath := range []string{"", "/", "relative/path"} {
+		if _, err := z.ListTree(basePath); err == nil {
+			t.Errorf("expect error for path %q", basePath)
+		}
+	}
+	if err := z.DeleteTree("/dubbo"); jerrors.Cause(err) != ZK_CLIENT_CONN_NIL_ERR {
+		t.Errorf("expect ZK_CLIENT_CONN_NIL_ERR, got %v", err)
+	}
+
+	z.readOnly = 1
+	if err := z.DeleteTree("/dubbo"); err != ErrReadOnly {
+		t.Errorf("expect ErrReadOnly, got %v", err)
+	}
+}
+
+func TestIsZkSubPath(t *testing.T) {
+	testCases := []struct {
+		path   string
+		parent string
+		expect bool
+	}{
+		{"/dubbo/foo", "/dubbo/foo", true},
+		{"/dubbo/foo/providers", "/dubbo/foo", true},
+		{"/dubbo/foo/providers", "/dubbo/foo/", true},
+		{"/dubbo/foobar", "/dubbo/foo", false},
+		{"/dubbo", "/dubbo/foo", false},
+		{"/dubbo", "/", true},
+	}
+
+	for _, tc := range testCases {
+		if got := isZkSubPath(tc.path, tc.parent); got != tc.expect {
+			t.Errorf("isZkSubPath(%q, %q) = %v, expect %v", tc.path, tc.parent, got, tc.expect)
+		}
+	}
+}
+
+func TestHandleZkEventNodeDeleted(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+	}
+	providers := make(chan struct{}, 1)
+	sibling := make(chan struct{}, 1)
+	z.registerEvent("/dubbo/com.test.Service/providers", &providers)
+	z.registerEvent("/dubbo/com.test.ServiceV2/providers", &sibling)
+
+	session := make(chan zk.Event, 1)
+	z.wait.Add(1)
+	go z.handleZkEvent(session)
+	defer func() {
+		close(z.exit)
+		z.wait.Wait()
+	}()
+
+	// the whole service directory is removed during namespace teardown
+	session <- zk.Event{Type: zk.EventNodeDeleted, State: zk.StateHasSession, Path: "/dubbo/com.test.Service"}
+	select {
+	case <-providers:
+	case <-time.After(time.Second):
+		t.Fatal("watcher of the deleted path is not notified")
+	}
+	select {
+	case <-sibling:
+		t.Error("watcher of the sibling path should not be notified")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHandleZkEventNodeDataChanged(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+	}
+	// the watcher is still busy with the previous notification
+	watcher := make(chan struct{}, 1)
+	watcher <- struct{}{}
+	z.registerEvent("/mosn/stats/host1", &watcher)
+
+	session := make(chan zk.Event, 2)
+	z.wait.Add(1)
+	go z.handleZkEvent(session)
+	defer func() {
+		close(z.exit)
+		z.wait.Wait()
+	}()
+
+	session <- zk.Event{Type: zk.EventNodeDataChanged, State: zk.StateHasSession, Path: "/mosn/stats/host1"}
+	session <- zk.Event{Type: zk.EventNodeDataChanged, State: zk.StateHasSession, Path: "/mosn/stats/host1"}
+	<-watcher
+	select {
+	case <-watcher:
+	case <-time.After(time.Second):
+		t.Fatal("watcher of the updated node is not notified")
+	}
+}
+
+func TestUpdateTempDataWithoutConn(t *testing.T) {
+	z := &zookeeperClient{name: "test"}
+	if err := z.UpdateTempData("/mosn/stats/host1", []byte("load")); jerrors.Cause(err) != ZK_CLIENT_CONN_NIL_ERR {
+		t.Errorf("expect ZK_CLIENT_CONN_NIL_ERR, got %v", err)
+	}
+
+	z.readOnly = 1
+	if err := z.UpdateTempData("/mosn/stats/host1", []byte("load")); err != ErrReadOnly {
+		t.Errorf("expect ErrReadOnly, got %v", err)
+	}
+}
+
+func TestWithConn(t *testing.T) {
+	z := &zookeeperClient{name: "test"}
+	called := false
+	if err := z.withConn(func(conn *zk.Conn) error {
+		called = true
+		return nil
+	}); err != ZK_CLIENT_CONN_NIL_ERR || called {
+		t.Errorf("expect ZK_CLIENT_CONN_NIL_ERR without calling, got %v, called %v", err, called)
+	}
+
+	z.conn = &zk.Conn{}
+	testCases := []struct {
+		err      error
+		expected error
+	}{
+		{nil, nil},
+		{zk.ErrConnectionClosed, ErrConnectionLost},
+		{zk.ErrClosing, ErrConnectionLost},
+		{zk.ErrNoNode, zk.ErrNoNode},
+	}
+	for _, tc := range testCases {
+		if err := z.withConn(func(conn *zk.Conn) error {
+			return tc.err
+		}); err != tc.expected {
+			t.Errorf("expect %v for %v, got %v", tc.expected, tc.err, err)
+		}
+	}
+
+	// every rpc is released, the conn can be closed
+	released := make(chan struct{})
+	go func() {
+		z.rpcWait.Wait()
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Error("conn is not released")
+	}
+}
+
+func TestHandleZkEventExpiredInFlight(t *testing.T) {
+	// the server never accepts, the rpc is queued until the conn is closed
+	conn, _, err := zk.Connect([]string{"127.0.0.1:2181"}, time.Second,
+		zk.WithDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+			return nil, errors.New("refused")
+		}),
+		zk.WithLogger(zkConnLogger{&zookeeperClient{name: "test", logLevel: log.ERROR}}))
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	z := &zookeeperClient{
+		name:          "test",
+		conn:          conn,
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+	}
+	// wait for the retry backoff of the dialer, or the rpc fails with zk.ErrNoServer at once
+	time.Sleep(100 * time.Millisecond)
+
+	rpc := make(chan error, 1)
+	go func() {
+		rpc <- z.withConn(func(conn *zk.Conn) error {
+			_, _, err := conn.Get("/mosn")
+			return err
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	session := make(chan zk.Event, 1)
+	z.wait.Add(1)
+	go z.handleZkEvent(session)
+	start := time.Now()
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateExpired}
+	z.wait.Wait()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the event loop is blocked by the in-flight rpc for %s", elapsed)
+	}
+
+	select {
+	case err := <-rpc:
+		if err != ErrConnectionLost {
+			t.Errorf("expect ErrConnectionLost, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight rpc does not fail fast")
+	}
+	if z.zkConnValid() {
+		t.Error("conn should be detached")
+	}
+}
+
+func TestWatchDurableSessionRecovery(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		children = []string{"p1"}
+		data     = []byte("w=100")
+	)
+	childrenW, getW := zkChildrenW, zkGetW
+	defer func() {
+		zkChildrenW, zkGetW = childrenW, getW
+	}()
+	// the one-shot watches never fire, the changes during the disconnection are lost with them
+	zkChildrenW = func(conn *zk.Conn, zkPath string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]string{}, children...), &zk.Stat{}, make(chan zk.Event), nil
+	}
+	zkGetW = func(conn *zk.Conn, zkPath string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]byte{}, data...), &zk.Stat{}, make(chan zk.Event), nil
+	}
+
+	z := &zookeeperClient{
+		name:          "test",
+		conn:          &zk.Conn{},
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+		jitterMin:     time.Millisecond,
+		jitterMax:     2 * time.Millisecond,
+	}
+	session := make(chan zk.Event, 2)
+	z.wait.Add(1)
+	go z.handleZkEvent(session)
+	defer func() {
+		close(z.exit)
+		z.wait.Wait()
+	}()
+
+	childrenCh, stopChildren := z.WatchChildrenDurable("/dubbo/com.test.Service/providers")
+	defer stopChildren()
+	dataCh, stopData := z.WatchDataDurable("/dubbo/com.test.Service/providers/p1")
+	defer stopData()
+	if got := receiveChildren(t, childrenCh); !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Fatalf("expect the initial children [p1], got %v", got)
+	}
+	if got := receiveData(t, dataCh); string(got) != "w=100" {
+		t.Fatalf("expect the initial data w=100, got %q", got)
+	}
+
+	// a brief failover
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateDisconnected}
+	mux.Lock()
+	children = []string{"p1", "p2", "p3"}
+	data = []byte("w=50")
+	mux.Unlock()
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+
+	if got := receiveChildren(t, childrenCh); !reflect.DeepEqual(got, []string{"p1", "p2", "p3"}) {
+		t.Errorf("expect the full children set [p1 p2 p3] re-emitted, got %v", got)
+	}
+	if got := receiveData(t, dataCh); string(got) != "w=50" {
+		t.Errorf("expect the data w=50 re-emitted, got %q", got)
+	}
+	if !z.zkConnValid() {
+		t.Error("client should survive the disconnection")
+	}
+}
+
+func receiveChildren(t *testing.T, ch <-chan []string) []string {
+	select {
+	case children, ok := <-ch:
+		if !ok {
+			t.Fatal("watch is stopped")
+		}
+		return children
+	case <-time.After(time.Second):
+		t.Fatal("children are not sent")
+	}
+	return nil
+}
+
+func receiveData(t *testing.T, ch <-chan []byte) []byte {
+	select {
+	case data, ok := <-ch:
+		if !ok {
+			t.Fatal("watch is stopped")
+		}
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("data is not sent")
+	}
+	return nil
+}
+
+func TestNotifyEventAfterClose(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		eventRegistry: make(map[string][]*chan struct{}),
+	}
+	zkPath := "/dubbo/com.test.Service/providers"
+
+	// unregistered then closed
+	event := make(chan struct{}, 1)
+	z.registerEvent(zkPath, &event).Close()
+	z.closeEvent(&event)
+	z.notifyPathEvent(zkPath)
+
+	// closed without unregistering, e.g. the watcher panics
+	leaked := make(chan struct{}, 1)
+	z.registerEvent(zkPath, &leaked)
+	z.registerEvent("/dubbo/com.test.ServiceV2/providers", &leaked)
+	z.registerSessionEvent(&leaked)
+	z.closeEvent(&leaked)
+	z.notifyPathEvent(zkPath)
+	z.notifySessionEvent()
+	if n := z.LenWatches(); n != 0 || len(z.sessionEvents) != 0 {
+		t.Errorf("expect the closed events removed, got %d watches, %d session events", n, len(z.sessionEvents))
+	}
+
+	// notifications race with the watchers closing their events
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			z.notifyPathEvent(zkPath)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		event := make(chan struct{}, 1)
+		z.registerEvent(zkPath, &event)
+		z.closeEvent(&event)
+	}
+	<-done
+	if n := z.LenWatches(); n != 0 {
+		t.Errorf("expect no watch left, got %d", n)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	testCases := map[string]log.Level{
+		"":        log.INFO,
+		"debug":   log.DEBUG,
+		"INFO":    log.INFO,
+		"warn":    log.WARNING,
+		"warning": log.WARNING,
+		"error":   log.ERROR,
+		"TRACE":   log.DEBUG,
+		"FATAL":   log.ERROR,
+		"unknown": log.INFO,
+	}
+
+	for level, expect := range testCases {
+		if got := parseLogLevel(level); got != expect {
+			t.Errorf("parseLogLevel(%q) = %v, expect %v", level, got, expect)
+		}
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	z := &zookeeperClient{logLevel: log.WARNING}
+	defer SetLogLevel("")
+
+	SetLogLevel("DEBUG")
+	if z.level() != log.DEBUG {
+		t.Errorf("expect level overridden to debug, got %v", z.level())
+	}
+	SetLogLevel("")
+	if z.level() != log.WARNING {
+		t.Errorf("expect configured level restored, got %v", z.level())
+	}
+}
+
+func TestWatchChildrenDurableStop(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+	}
+
+	// no conn, nothing is sent until stopped
+	ch, stop := z.WatchChildrenDurable("/dubbo/com.test.Service/providers")
+	select {
+	case children := <-ch:
+		t.Fatalf("unexpected children %v without conn", children)
+	case <-time.After(50 * time.Millisecond):
+	}
+	stop()
+	stop()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("channel should be closed after stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch is not stopped")
+	}
+
+	// the client exits
+	ch, _ = z.WatchChildrenDurable("/dubbo/com.test.Service/providers")
+	close(z.exit)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("watch is not stopped after the client exits")
+	}
+	z.Lock()
+	defer z.Unlock()
+	if len(z.sessionEvents) != 0 {
+		t.Errorf("session events leaked: %d", len(z.sessionEvents))
+	}
+}
+
+func TestWatchJitter(t *testing.T) {
+	testCases := []struct {
+		min, max time.Duration
+		from, to time.Duration
+	}{
+		{0, 0, defaultWatchJitterMin, defaultWatchJitterMax},
+		{10 * time.Millisecond, 20 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+		{30 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond},
+		{10 * time.Millisecond, -1, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		z := &zookeeperClient{jitterMin: tc.min, jitterMax: tc.max}
+		for i := 0; i < 100; i++ {
+			if jitter := z.watchJitter(); jitter < tc.from || jitter > tc.to || (jitter == tc.to && tc.from != tc.to) {
+				t.Fatalf("jitter [%s, %s): unexpected %s", tc.min, tc.max, jitter)
+			}
+		}
+	}
+}
+
+func TestWaitWatchJitter(t *testing.T) {
+	z := &zookeeperClient{
+		name:      "test",
+		exit:      make(chan struct{}),
+		jitterMin: 50 * time.Millisecond,
+		jitterMax: 60 * time.Millisecond,
+	}
+	session := make(chan struct{}, 1)
+	quit := make(chan struct{})
+
+	// the session event during the delay is coalesced
+	start := time.Now()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		session <- struct{}{}
+	}()
+	if !z.waitWatchJitter(session, quit) {
+		t.Fatal("wait should not be stopped")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("re-read too early: %s", elapsed)
+	}
+	select {
+	case <-session:
+		t.Error("session event during the delay should be coalesced")
+	default:
+	}
+
+	close(quit)
+	if z.waitWatchJitter(session, quit) {
+		t.Error("wait should be stopped")
+	}
+}
+
+func TestSessionEvent(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		exit:          make(chan struct{}),
+		eventRegistry: make(map[string][]*chan struct{}),
+	}
+	event := make(chan struct{}, 1)
+	z.registerSessionEvent(&event)
+
+	session := make(chan zk.Event, 2)
+	z.wait.Add(1)
+	go z.handleZkEvent(session)
+	defer func() {
+		close(z.exit)
+		z.wait.Wait()
+	}()
+
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateConnecting}
+	session <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	select {
+	case <-event:
+	case <-time.After(time.Second):
+		t.Fatal("session event is not notified")
+	}
+	select {
+	case <-event:
+		t.Fatal("session event should be notified only once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSendLatestChildren(t *testing.T) {
+	ch := make(chan []string, 1)
+	sendLatestChildren(ch, []string{"a"})
+	sendLatestChildren(ch, []string{"a", "b"})
+	if children := <-ch; !reflect.DeepEqual(children, []string{"a", "b"}) {
+		t.Errorf("expect the latest children, got %v", children)
+	}
+}
+
+func TestSessionAccessors(t *testing.T) {
+	z := &zookeeperClient{
+		name:    "test",
+		timeout: 5,
+	}
+	if id := z.SessionID(); id != 0 {
+		t.Errorf("expect no session without conn, got %d", id)
+	}
+	if timeout := z.RequestedSessionTimeout(); timeout != 5*time.Second {
+		t.Errorf("expect requested session timeout 5s, got %s", timeout)
+	}
+	if timeout := z.SessionTimeout(); timeout != 0 {
+		t.Errorf("expect no negotiated session timeout without session, got %s", timeout)
+	}
+}
+
+func TestSessionTimeoutNegotiated(t *testing.T) {
+	z := &zookeeperClient{
+		name:    "test",
+		timeout: 30,
+	}
+	server, client := net.Pipe()
+	defer server.Close()
+	conn := &sessionConn{Conn: client, z: z}
+
+	// the connect response: length, protocol version, timeout 4000ms, session id, password, then a reply
+	response := []byte{0, 0, 0, 36, 0, 0, 0, 0, 0, 0, 0x0f, 0xa0, 0, 0, 0, 0, 0, 0, 0, 7}
+	go func() {
+		for _, b := range response {
+			server.Write([]byte{b})
+		}
+		server.Write([]byte{0, 0, 0x3a, 0x98})
+	}()
+
+	buf := make([]byte, len(response))
+	for read := 0; read < len(response); {
+		n, err := conn.Read(buf[read:])
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		read += n
+	}
+	if timeout := z.SessionTimeout(); timeout != 4*time.Second {
+		t.Errorf("expect negotiated session timeout 4s, got %s", timeout)
+	}
+	// only the connect response is parsed
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if timeout := z.SessionTimeout(); timeout != 4*time.Second {
+		t.Errorf("expect negotiated session timeout kept, got %s", timeout)
+	}
+	if timeout := z.RequestedSessionTimeout(); timeout != 30*time.Second {
+		t.Errorf("expect requested session timeout 30s, got %s", timeout)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	z := &zookeeperClient{
+		name:          "test",
+		zkAddrs:       []string{"127.0.0.1:2181"},
+		eventRegistry: make(map[string][]*chan struct{}),
+		readOnly:      1,
+	}
+	event := make(chan struct{}, 1)
+	token := z.registerEvent("/dubbo/b", &event)
+	z.registerEvent("/dubbo/a", &event)
+	z.addTempNode("/dubbo/a/providers/node2")
+	z.addTempNode("/dubbo/a/providers/node1")
+
+	snapshot := z.Snapshot()
+	expected := ClientSnapshot{
+		Name:         "test",
+		ZkAddrs:      []string{"127.0.0.1:2181"},
+		State:        stateToString(zk.StateDisconnected),
+		ReadOnly:     true,
+		WatchedPaths: []string{"/dubbo/a", "/dubbo/b"},
+		TempNodes:    []string{"/dubbo/a/providers/node1", "/dubbo/a/providers/node2"},
+	}
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Fatalf("expect snapshot %+v, got %+v", expected, snapshot)
+	}
+
+	// the snapshot is a copy
+	snapshot.ZkAddrs[0] = "changed"
+	token.Close()
+	z.removeTempNode("/dubbo/a/providers/node1")
+	if z.zkAddrs[0] != "127.0.0.1:2181" {
+		t.Error("snapshot should not share the zk addrs")
+	}
+	snapshot = z.Snapshot()
+	if !reflect.DeepEqual(snapshot.WatchedPaths, []string{"/dubbo/a"}) ||
+		!reflect.DeepEqual(snapshot.TempNodes, []string{"/dubbo/a/providers/node2"}) {
+		t.Errorf("unexpected snapshot after unregister: %+v", snapshot)
+	}
+
+	// the ephemeral nodes are gone with the expired session
+	z.clearTempNodes()
+	if snapshot = z.Snapshot(); len(snapshot.TempNodes) != 0 {
+		t.Errorf("expect no temp nodes, got %v", snapshot.TempNodes)
+	}
+}
+
+func TestRegisterTTL(t *testing.T) {
+	z := &zookeeperClient{name: "test"}
+	for _, ttl := range []time.Duration{0, time.Microsecond, maxTTL + time.Millisecond} {
+		if _, err := z.RegisterTTL("/mosn", "host1", ttl); err == nil {
+			t.Errorf("expect error for ttl %v", ttl)
+		}
+	}
+	if _, err := z.RegisterTTL("/mosn", "host1", time.Minute); jerrors.Cause(err) != ZK_CLIENT_CONN_NIL_ERR {
+		t.Errorf("expect ZK_CLIENT_CONN_NIL_ERR, got %v", err)
+	}
+
+	z.conn = &zk.Conn{}
+	defer func(f func(*zk.Conn, string, []byte, time.Duration) (string, error)) {
+		createTTL = f
+	}(createTTL)
+	errTimeout := fmt.Errorf("unknown error: %v", zk.ErrCode(-7))
+	testCases := []struct {
+		err      error
+		expected error
+	}{
+		// the library formats a new error for each reply
+		{fmt.Errorf("unknown error: %v", zk.ErrCode(-6)), ErrTTLNotSupported},
+		{errTimeout, errTimeout},
+		{zk.ErrNodeExists, zk.ErrNodeExists},
+		{nil, nil},
+	}
+	for _, tc := range testCases {
+		createTTL = func(conn *zk.Conn, zkPath string, data []byte, ttl time.Duration) (string, error) {
+			if zkPath != "/mosn/host1" || ttl != time.Minute {
+				t.Errorf("unexpected path %s, ttl %v", zkPath, ttl)
+			}
+			return zkPath, tc.err
+		}
+		zkPath, err := z.RegisterTTL("/mosn", "host1", time.Minute)
+		if jerrors.Cause(err) != tc.expected {
+			t.Errorf("expect %v, got %v", tc.expected, err)
+		}
+		if err == nil && zkPath != "/mosn/host1" {
+			t.Errorf("unexpected path %s", zkPath)
+		}
+	}
+
+	z.readOnly = 1
+	if _, err := z.RegisterTTL("/mosn", "host1", time.Minute); err != ErrReadOnly {
+		t.Errorf("expect ErrReadOnly, got %v", err)
+	}
+}
+
+func TestCheckChildren(t *testing.T) {
+	testCases := []struct {
+		warn, limit int
+		count       int
+		expected    error
+	}{
+		{0, 0, 100000, nil},
+		{10, 0, 11, nil},
+		{10, 20, 20, nil},
+		{10, 20, 21, ErrTooManyChildren},
+		{0, 20, 21, ErrTooManyChildren},
+	}
+	for _, tc := range testCases {
+		z := &zookeeperClient{name: "test", childrenWarn: tc.warn, childrenError: tc.limit}
+		if err := z.checkChildren("/mosn", tc.count); jerrors.Cause(err) != tc.expected {
+			t.Errorf("thresholds %d/%d, %d children: expect %v, got %v", tc.warn, tc.limit, tc.count, tc.expected, err)
+		}
+	}
+}
+
+func TestGetChildrenBatch(t *testing.T) {
+	z := &zookeeperClient{name: "test", childrenError: 2}
+	if _, err := z.GetChildrenBatch([]string{"/dubbo"}); err != ZK_CLIENT_CONN_NIL_ERR {
+		t.Errorf("expect ZK_CLIENT_CONN_NIL_ERR, got %v", err)
+	}
+
+	testCases := []struct {
+		children []string
+		err      error
+		expected ChildrenResult
+	}{
+		{[]string{"p1"}, nil, ChildrenResult{Children: []string{"p1"}}},
+		{nil, zk.ErrNoNode, ChildrenResult{Err: ErrNodeNotExist}},
+		{nil, zk.ErrConnectionClosed, ChildrenResult{Err: ErrConnectionLost}},
+		{[]string{"p1", "p2", "p3"}, nil, ChildrenResult{Err: ErrTooManyChildren}},
+	}
+	for _, tc := range testCases {
+		result := z.childrenResult("/dubbo", tc.children, tc.err)
+		if jerrors.Cause(result.Err) != tc.expected.Err || !reflect.DeepEqual(result.Children, tc.expected.Children) {
+			t.Errorf("children %v, error %v: expect %+v, got %+v", tc.children, tc.err, tc.expected, result)
+		}
+	}
+}
+
+func TestExistingTempNodeAction(t *testing.T) {
+	testCases := []struct {
+		policy         string
+		session, owner int64
+		data, existing string
+		expected       existingTempAction
+	}{
+		{TempNodeExistsFail, 1, 1, "", "", existingTempFail},
+		{TempNodeExistsVerify, 1, 1, "", "", existingTempKeep},
+		{TempNodeExistsVerify, 1, 1, "", "weight=10", existingTempFail},
+		{TempNodeExistsVerify, 1, 2, "", "", existingTempFail},
+		{TempNodeExistsVerify, 0, 0, "", "", existingTempFail},
+		{TempNodeExistsOverwrite, 1, 1, "", "", existingTempKeep},
+		{TempNodeExistsOverwrite, 1, 2, "", "", existingTempReplace},
+		{TempNodeExistsOverwrite, 1, 1, "", "weight=10", existingTempReplace},
+		// a persistent node is not owned by any session
+		{TempNodeExistsOverwrite, 1, 0, "", "", existingTempReplace},
+	}
+	for i, tc := range testCases {
+		action := existingTempNodeAction(tc.policy, tc.session, tc.owner, []byte(tc.data), []byte(tc.existing))
+		if action != tc.expected {
+			t.Errorf("#%d expect action %d, got %d", i, tc.expected, action)
+		}
+	}
+}
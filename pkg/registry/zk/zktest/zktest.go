@@ -0,0 +1,530 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package zktest provides an in-memory zookeeper for the tests of the code depending on zookeeper.Client.
+// The clients of a Server share the node tree, each client is a session owning its ephemeral nodes.
+package zktest
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	zookeeper "github.com/alipay/sofa-mosn/pkg/registry/zk"
+)
+
+// maxTreeDepth is the same as the depth limit of the zk client
+const maxTreeDepth = 32
+
+type node struct {
+	data     []byte
+	owner    *Client // the session of the ephemeral node, nil if persistent
+	children map[string]struct{}
+	seq      int32 // the counter of the sequential children
+}
+
+type watch struct {
+	path   string
+	ch     chan []string
+	last   []string
+	client *Client
+}
+
+type dataWatch struct {
+	path   string
+	ch     chan []byte
+	last   []byte
+	exists bool
+	sent   bool
+	client *Client
+}
+
+// Server is an in-memory zookeeper ensemble
+type Server struct {
+	mux         sync.Mutex
+	nodes       map[string]*node
+	watches     map[*watch]struct{}
+	dataWatches map[*dataWatch]struct{}
+}
+
+// NewServer creates a Server with the root node only
+func NewServer() *Server {
+	return &Server{
+		nodes:       map[string]*node{"/": {children: make(map[string]struct{})}},
+		watches:     make(map[*watch]struct{}),
+		dataWatches: make(map[*dataWatch]struct{}),
+	}
+}
+
+// NewClient creates a client with a new session
+func (s *Server) NewClient() *Client {
+	return &Client{server: s, done: make(chan struct{})}
+}
+
+// Get returns the data of zkPath and whether it exists
+func (s *Server) Get(zkPath string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	n, ok := s.nodes[zkPath]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), n.data...), true
+}
+
+func (s *Server) create(zkPath string, data []byte, owner *Client) error {
+	if _, ok := s.nodes[zkPath]; ok {
+		return zk.ErrNodeExists
+	}
+	parent, ok := s.nodes[path.Dir(zkPath)]
+	if !ok {
+		return zk.ErrNoNode
+	}
+	if parent.owner != nil {
+		return zk.ErrNoChildrenForEphemerals
+	}
+
+	parent.children[path.Base(zkPath)] = struct{}{}
+	s.nodes[zkPath] = &node{data: data, owner: owner, children: make(map[string]struct{})}
+	return nil
+}
+
+func (s *Server) delete(zkPath string) error {
+	if zkPath == "/" {
+		return zk.ErrBadArguments
+	}
+	n, ok := s.nodes[zkPath]
+	if !ok {
+		return zk.ErrNoNode
+	}
+	if len(n.children) > 0 {
+		return zk.ErrNotEmpty
+	}
+
+	delete(s.nodes[path.Dir(zkPath)].children, path.Base(zkPath))
+	delete(s.nodes, zkPath)
+	return nil
+}
+
+// children returns the sorted children names of zkPath, nil if zkPath is missing
+func (s *Server) children(zkPath string) []string {
+	n, ok := s.nodes[zkPath]
+	if !ok {
+		return nil
+	}
+
+	children := make([]string, 0, len(n.children))
+	for name := range n.children {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+	return children
+}
+
+// notify sends the children set and the data to the watches they changed for, it is called with the lock held
+func (s *Server) notify() {
+	for w := range s.watches {
+		children := s.children(w.path)
+		if children == nil {
+			children = []string{}
+		}
+		if w.last != nil && equal(w.last, children) {
+			continue
+		}
+		w.last = children
+		sendLatestChildren(w.ch, children)
+	}
+	for w := range s.dataWatches {
+		var data []byte
+		n, exists := s.nodes[w.path]
+		if exists {
+			data = n.data
+		}
+		if w.sent && w.exists == exists && string(w.last) == string(data) {
+			continue
+		}
+		w.last, w.exists, w.sent = data, exists, true
+		sendLatestData(w.ch, append([]byte(nil), data...))
+	}
+}
+
+func (s *Server) stopWatch(w *watch) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.watches[w]; ok {
+		delete(s.watches, w)
+		close(w.ch)
+	}
+}
+
+func (s *Server) stopDataWatch(w *dataWatch) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.dataWatches[w]; ok {
+		delete(s.dataWatches, w)
+		close(w.ch)
+	}
+}
+
+// expire deletes the ephemeral nodes of the client, it is called with the lock held
+func (s *Server) expire(c *Client) {
+	for zkPath, n := range s.nodes {
+		if n.owner == c {
+			s.delete(zkPath)
+		}
+	}
+}
+
+// Client is a session of the Server, it implements zookeeper.Client
+type Client struct {
+	server   *Server
+	readOnly bool
+	closed   bool
+	done     chan struct{}
+}
+
+var _ zookeeper.Client = (*Client)(nil)
+
+// SetReadOnly simulates the client connected to a read-only server, the writes fail with zookeeper.ErrReadOnly
+func (c *Client) SetReadOnly(readOnly bool) {
+	c.server.mux.Lock()
+	c.readOnly = readOnly
+	c.server.mux.Unlock()
+}
+
+// ExpireSession deletes the ephemeral nodes of the client as the ensemble does on the session expiration,
+// the client keeps working with a new session
+func (c *Client) ExpireSession() {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	c.server.expire(c)
+	c.server.notify()
+}
+
+// lock locks the server, it returns an error if the client can not run the operation
+func (c *Client) lock(write bool) error {
+	c.server.mux.Lock()
+	if c.closed {
+		c.server.mux.Unlock()
+		return zookeeper.ZK_CLIENT_CONN_NIL_ERR
+	}
+	if write && c.readOnly {
+		c.server.mux.Unlock()
+		return zookeeper.ErrReadOnly
+	}
+	return nil
+}
+
+func (c *Client) unlock() {
+	c.server.notify()
+	c.server.mux.Unlock()
+}
+
+func (c *Client) Create(basePath string) error {
+	nodes, err := pathNodes(basePath)
+	if err != nil {
+		return err
+	}
+	if err := c.lock(true); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	for _, zkPath := range nodes {
+		if err := c.server.create(zkPath, nil, nil); err != nil && err != zk.ErrNodeExists {
+			return jerrors.Annotatef(err, "zk.Create(path:%s)", basePath)
+		}
+	}
+	return nil
+}
+
+func (c *Client) Delete(basePath string) error {
+	if err := c.lock(true); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	return jerrors.Annotatef(c.server.delete(basePath), "Delete(basePath:%s)", basePath)
+}
+
+func (c *Client) DeleteTree(basePath string) error {
+	if err := c.lock(true); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	nodes, err := c.server.listTree(basePath)
+	if err != nil {
+		return err
+	}
+	for _, zkPath := range nodes {
+		if err := c.server.delete(zkPath); err != nil {
+			return jerrors.Annotatef(err, "DeleteTree(basePath:%s, node:%s)", basePath, zkPath)
+		}
+	}
+	return nil
+}
+
+func (c *Client) ListTree(basePath string) ([]string, error) {
+	if err := c.lock(false); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+
+	return c.server.listTree(basePath)
+}
+
+func (s *Server) listTree(basePath string) ([]string, error) {
+	if !strings.HasPrefix(basePath, "/") || path.Clean(basePath) == "/" {
+		return nil, jerrors.Errorf("zk path{%q} is not an absolute path or is the root", basePath)
+	}
+
+	var list func(zkPath string, depth int) ([]string, error)
+	list = func(zkPath string, depth int) ([]string, error) {
+		if depth <= 0 {
+			return nil, zookeeper.ErrTreeTooDeep
+		}
+		var nodes []string
+		for _, name := range s.children(zkPath) {
+			descendants, err := list(path.Join(zkPath, name), depth-1)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, descendants...)
+		}
+		return append(nodes, zkPath), nil
+	}
+
+	zkPath := path.Clean(basePath)
+	if _, ok := s.nodes[zkPath]; !ok {
+		return nil, nil
+	}
+	return list(zkPath, maxTreeDepth)
+}
+
+func (c *Client) GetChildren(zkPath string) ([]string, error) {
+	if err := c.lock(false); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+
+	children := c.server.children(zkPath)
+	if children == nil {
+		return nil, zookeeper.ErrNodeNotExist
+	}
+	return children, nil
+}
+
+func (c *Client) GetChildrenBatch(paths []string) (map[string]zookeeper.ChildrenResult, error) {
+	if err := c.lock(false); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+
+	results := make(map[string]zookeeper.ChildrenResult, len(paths))
+	for _, zkPath := range paths {
+		if children := c.server.children(zkPath); children != nil {
+			results[zkPath] = zookeeper.ChildrenResult{Children: children}
+		} else {
+			results[zkPath] = zookeeper.ChildrenResult{Err: zookeeper.ErrNodeNotExist}
+		}
+	}
+	return results, nil
+}
+
+func (c *Client) WatchChildrenDurable(zkPath string) (<-chan []string, func()) {
+	w := &watch{path: zkPath, ch: make(chan []string, 1), client: c}
+
+	c.server.mux.Lock()
+	if c.closed {
+		close(w.ch)
+	} else {
+		c.server.watches[w] = struct{}{}
+		c.server.notify()
+	}
+	c.server.mux.Unlock()
+
+	return w.ch, func() {
+		c.server.stopWatch(w)
+	}
+}
+
+func (c *Client) WatchDataDurable(zkPath string) (<-chan []byte, func()) {
+	w := &dataWatch{path: zkPath, ch: make(chan []byte, 1), client: c}
+
+	c.server.mux.Lock()
+	if c.closed {
+		close(w.ch)
+	} else {
+		c.server.dataWatches[w] = struct{}{}
+		c.server.notify()
+	}
+	c.server.mux.Unlock()
+
+	return w.ch, func() {
+		c.server.stopDataWatch(w)
+	}
+}
+
+func (c *Client) RegisterTemp(basePath string, node string) (string, error) {
+	if err := c.lock(true); err != nil {
+		return "", err
+	}
+	defer c.unlock()
+
+	zkPath := path.Join(basePath) + "/" + node
+	if err := c.server.create(zkPath, nil, c); err != nil {
+		return "", jerrors.Annotatef(err, "zk.Create(path:%s, zk.FlagEphemeral)", basePath)
+	}
+	return zkPath, nil
+}
+
+func (c *Client) RegisterTempSeq(basePath string, data []byte) (string, error) {
+	if err := c.lock(true); err != nil {
+		return "", err
+	}
+	defer c.unlock()
+
+	parent, ok := c.server.nodes[path.Join(basePath)]
+	if !ok {
+		return "", jerrors.Annotatef(zk.ErrNoNode, "zk.Create(path:%s, zk.FlagEphemeral|zk.FlagSequence)", basePath)
+	}
+	zkPath := fmt.Sprintf("%s/%010d", path.Join(basePath), parent.seq)
+	if err := c.server.create(zkPath, append([]byte(nil), data...), c); err != nil {
+		return "", jerrors.Annotatef(err, "zk.Create(path:%s, zk.FlagEphemeral|zk.FlagSequence)", basePath)
+	}
+	parent.seq++
+	return zkPath, nil
+}
+
+func (c *Client) UpdateTempData(zkPath string, data []byte) error {
+	if err := c.lock(true); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	n, ok := c.server.nodes[zkPath]
+	if !ok {
+		return zookeeper.ErrNodeNotExist
+	}
+	n.data = append([]byte(nil), data...)
+	return nil
+}
+
+// Done is closed once the client is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) IsReadOnly() bool {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	return c.readOnly
+}
+
+// Close deletes the ephemeral nodes of the client and stops its watches, the operations after fail
+// with zookeeper.ZK_CLIENT_CONN_NIL_ERR
+func (c *Client) Close() {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	c.server.expire(c)
+	for w := range c.server.watches {
+		if w.client == c {
+			delete(c.server.watches, w)
+			close(w.ch)
+		}
+	}
+	for w := range c.server.dataWatches {
+		if w.client == c {
+			delete(c.server.dataWatches, w)
+			close(w.ch)
+		}
+	}
+	c.server.notify()
+}
+
+// pathNodes returns every node from the root to the absolute basePath
+func pathNodes(basePath string) ([]string, error) {
+	if !strings.HasPrefix(basePath, "/") {
+		return nil, jerrors.Errorf("zk path{%q} is not an absolute path", basePath)
+	}
+
+	var nodes []string
+	for zkPath := path.Clean(basePath); zkPath != "/"; zkPath = path.Dir(zkPath) {
+		nodes = append([]string{zkPath}, nodes...)
+	}
+	return nodes, nil
+}
+
+// sendLatestChildren replaces the unread children set in ch
+func sendLatestChildren(ch chan []string, children []string) {
+	for {
+		select {
+		case ch <- children:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
+
+// sendLatestData replaces the unread data in ch
+func sendLatestData(ch chan []byte, data []byte) {
+	for {
+		select {
+		case ch <- data:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
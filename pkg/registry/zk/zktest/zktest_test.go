@@ -0,0 +1,243 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zktest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/go-zookeeper/zk"
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	zookeeper "github.com/alipay/sofa-mosn/pkg/registry/zk"
+)
+
+func receive(t *testing.T, ch <-chan []string) []string {
+	select {
+	case children, ok := <-ch:
+		if !ok {
+			t.Fatal("watch is closed")
+		}
+		return children
+	case <-time.After(time.Second):
+		t.Fatal("no children received")
+	}
+	return nil
+}
+
+func TestNodes(t *testing.T) {
+	var c zookeeper.Client = NewServer().NewClient()
+
+	if err := c.Create("/dubbo/svc/providers"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	// existing nodes are not an error
+	if err := c.Create("/dubbo/svc"); err != nil {
+		t.Fatalf("Create() existing = %v", err)
+	}
+	if _, err := c.RegisterTemp("/dubbo/svc/providers", "p1"); err != nil {
+		t.Fatalf("RegisterTemp() = %v", err)
+	}
+	if _, err := c.RegisterTemp("/dubbo/svc/providers", "p1"); jerrors.Cause(err) != zk.ErrNodeExists {
+		t.Errorf("expect zk.ErrNodeExists, got %v", err)
+	}
+	if _, err := c.RegisterTemp("/dubbo/svc/providers/p1", "child"); jerrors.Cause(err) != zk.ErrNoChildrenForEphemerals {
+		t.Errorf("expect zk.ErrNoChildrenForEphemerals, got %v", err)
+	}
+	seq0, _ := c.RegisterTempSeq("/dubbo/svc/providers", []byte("a"))
+	seq1, _ := c.RegisterTempSeq("/dubbo/svc/providers", []byte("b"))
+	if seq0 != "/dubbo/svc/providers/0000000000" || seq1 != "/dubbo/svc/providers/0000000001" {
+		t.Errorf("unexpected sequential nodes %s, %s", seq0, seq1)
+	}
+
+	children, err := c.GetChildren("/dubbo/svc/providers")
+	if err != nil || !reflect.DeepEqual(children, []string{"0000000000", "0000000001", "p1"}) {
+		t.Errorf("GetChildren() = %v, %v", children, err)
+	}
+	if _, err := c.GetChildren("/missing"); err != zookeeper.ErrNodeNotExist {
+		t.Errorf("expect ErrNodeNotExist, got %v", err)
+	}
+	batch, err := c.GetChildrenBatch([]string{"/dubbo/svc/providers", "/missing", "/dubbo"})
+	if err != nil || len(batch) != 3 ||
+		!reflect.DeepEqual(batch["/dubbo/svc/providers"].Children, children) ||
+		batch["/missing"].Err != zookeeper.ErrNodeNotExist ||
+		!reflect.DeepEqual(batch["/dubbo"].Children, []string{"svc"}) {
+		t.Errorf("GetChildrenBatch() = %v, %v", batch, err)
+	}
+	if err := c.UpdateTempData("/missing", nil); err != zookeeper.ErrNodeNotExist {
+		t.Errorf("expect ErrNodeNotExist, got %v", err)
+	}
+	if err := c.Delete("/dubbo/svc"); jerrors.Cause(err) != zk.ErrNotEmpty {
+		t.Errorf("expect zk.ErrNotEmpty, got %v", err)
+	}
+
+	nodes, err := c.ListTree("/dubbo/svc")
+	expected := []string{"/dubbo/svc/providers/0000000000", "/dubbo/svc/providers/0000000001",
+		"/dubbo/svc/providers/p1", "/dubbo/svc/providers", "/dubbo/svc"}
+	if err != nil || !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("ListTree() = %v, %v", nodes, err)
+	}
+	if err := c.DeleteTree("/dubbo/svc"); err != nil {
+		t.Fatalf("DeleteTree() = %v", err)
+	}
+	if children, _ := c.GetChildren("/dubbo"); len(children) != 0 {
+		t.Errorf("expect the tree deleted, got %v", children)
+	}
+}
+
+func TestEphemeral(t *testing.T) {
+	s := NewServer()
+	c1, c2 := s.NewClient(), s.NewClient()
+	c1.Create("/dubbo/svc/providers")
+	c1.RegisterTemp("/dubbo/svc/providers", "p1")
+	c2.RegisterTemp("/dubbo/svc/providers", "p2")
+
+	if err := c2.UpdateTempData("/dubbo/svc/providers/p2", []byte("weight=10")); err != nil {
+		t.Fatalf("UpdateTempData() = %v", err)
+	}
+	if data, _ := s.Get("/dubbo/svc/providers/p2"); string(data) != "weight=10" {
+		t.Errorf("unexpected data %q", data)
+	}
+
+	// the ephemeral nodes belong to the session only
+	c1.ExpireSession()
+	if children, _ := c2.GetChildren("/dubbo/svc/providers"); !reflect.DeepEqual(children, []string{"p2"}) {
+		t.Errorf("expect p1 deleted on the session expiration, got %v", children)
+	}
+	if err := c1.UpdateTempData("/dubbo/svc/providers/p1", nil); err != zookeeper.ErrNodeNotExist {
+		t.Errorf("expect ErrNodeNotExist, got %v", err)
+	}
+	// the client keeps working with a new session
+	if _, err := c1.RegisterTemp("/dubbo/svc/providers", "p1"); err != nil {
+		t.Errorf("RegisterTemp() after expiration = %v", err)
+	}
+
+	c2.Close()
+	if children, _ := c1.GetChildren("/dubbo/svc/providers"); !reflect.DeepEqual(children, []string{"p1"}) {
+		t.Errorf("expect p2 deleted on close, got %v", children)
+	}
+	if err := c2.Create("/dubbo"); err != zookeeper.ZK_CLIENT_CONN_NIL_ERR {
+		t.Errorf("expect ZK_CLIENT_CONN_NIL_ERR after close, got %v", err)
+	}
+
+	c1.SetReadOnly(true)
+	if _, err := c1.RegisterTemp("/dubbo/svc/providers", "p3"); err != zookeeper.ErrReadOnly {
+		t.Errorf("expect ErrReadOnly, got %v", err)
+	}
+	if _, err := c1.GetChildren("/dubbo/svc/providers"); err != nil {
+		t.Errorf("read should work while read-only, got %v", err)
+	}
+}
+
+func TestWatchChildrenDurable(t *testing.T) {
+	s := NewServer()
+	watcher, provider := s.NewClient(), s.NewClient()
+
+	// a missing path is watched as an empty set
+	ch, stop := watcher.WatchChildrenDurable("/dubbo/svc/providers")
+	if children := receive(t, ch); len(children) != 0 {
+		t.Fatalf("expect empty children, got %v", children)
+	}
+
+	provider.Create("/dubbo/svc/providers")
+	provider.RegisterTemp("/dubbo/svc/providers", "p1")
+	provider.RegisterTemp("/dubbo/svc/providers", "p2")
+	// only the latest set is kept for a slow receiver
+	if children := receive(t, ch); !reflect.DeepEqual(children, []string{"p1", "p2"}) {
+		t.Fatalf("unexpected children %v", children)
+	}
+
+	provider.Close()
+	if children := receive(t, ch); len(children) != 0 {
+		t.Fatalf("expect the ephemeral nodes gone with the provider, got %v", children)
+	}
+
+	stop()
+	stop()
+	if _, ok := <-ch; ok {
+		t.Error("expect the watch closed after stop")
+	}
+
+	// the watches stop with the client
+	ch, _ = watcher.WatchChildrenDurable("/dubbo/svc/providers")
+	receive(t, ch)
+	watcher.Close()
+	if _, ok := <-ch; ok {
+		t.Error("expect the watch closed after the client closed")
+	}
+}
+
+func receiveData(t *testing.T, ch <-chan []byte) []byte {
+	select {
+	case data, ok := <-ch:
+		if !ok {
+			t.Fatal("watch is closed")
+		}
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("no data received")
+	}
+	return nil
+}
+
+func TestWatchDataDurable(t *testing.T) {
+	s := NewServer()
+	watcher, provider := s.NewClient(), s.NewClient()
+
+	// a missing path is watched as nil data
+	ch, stop := watcher.WatchDataDurable("/dubbo/svc/providers/p1")
+	if data := receiveData(t, ch); data != nil {
+		t.Fatalf("expect nil data, got %q", data)
+	}
+
+	provider.Create("/dubbo/svc/providers")
+	provider.RegisterTemp("/dubbo/svc/providers", "p1")
+	provider.UpdateTempData("/dubbo/svc/providers/p1", []byte("weight=10"))
+	// only the latest data is kept for a slow receiver
+	if data := receiveData(t, ch); string(data) != "weight=10" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	// the unchanged data is not sent again
+	provider.Create("/dubbo/other")
+	select {
+	case data := <-ch:
+		t.Fatalf("expect no data sent, got %q", data)
+	default:
+	}
+
+	provider.Close()
+	if data := receiveData(t, ch); data != nil {
+		t.Fatalf("expect nil data once the ephemeral node is gone, got %q", data)
+	}
+
+	stop()
+	stop()
+	if _, ok := <-ch; ok {
+		t.Error("expect the watch closed after stop")
+	}
+
+	// the watches stop with the client
+	ch, _ = watcher.WatchDataDurable("/dubbo/svc/providers/p1")
+	receiveData(t, ch)
+	watcher.Close()
+	if _, ok := <-ch; ok {
+		t.Error("expect the watch closed after the client closed")
+	}
+}
@@ -43,13 +43,9 @@ func RegisterRouterRule(f RouterRuleFactory, order uint32) {
 }
 
 func DefaultSofaRouterRuleFactory(base *RouteRuleImplBase, headers []v2.HeaderMatcher) RouteBase {
-	for _, header := range headers {
-		if header.Name == types.SofaRouteMatchKey {
-			return &SofaRouteRuleImpl{
-				RouteRuleImplBase: base,
-				matchValue:        header.Value,
-			}
-		}
+	if rule := newSofaRouteRule(headers); rule != nil {
+		rule.RouteRuleImplBase = base
+		return rule
 	}
 	return nil
 }
@@ -18,17 +18,51 @@
 package router
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
+// headerVariables are the variables in the header value, e.g. "%UPSTREAM_HOST%", "%%" is a literal "%".
+// The upstream host is selected after the request headers are finalized, so it's only set in the response headers
+var headerVariables = map[string]func(headers types.HeaderMap, requestInfo types.RequestInfo) string{
+	"REQUEST_ID": func(headers types.HeaderMap, requestInfo types.RequestInfo) string {
+		if req, ok := headers.(requestIDHeader); ok {
+			return strconv.FormatUint(req.RequestID(), 10)
+		}
+		return ""
+	},
+	"UPSTREAM_HOST": func(headers types.HeaderMap, requestInfo types.RequestInfo) string {
+		if requestInfo != nil && requestInfo.UpstreamHost() != nil {
+			return requestInfo.UpstreamHost().AddressString()
+		}
+		return ""
+	},
+	"DOWNSTREAM_REMOTE_ADDRESS": func(headers types.HeaderMap, requestInfo types.RequestInfo) string {
+		if requestInfo != nil && requestInfo.DownstreamRemoteAddress() != nil {
+			return requestInfo.DownstreamRemoteAddress().String()
+		}
+		return ""
+	},
+	"DOWNSTREAM_LOCAL_ADDRESS": func(headers types.HeaderMap, requestInfo types.RequestInfo) string {
+		if requestInfo != nil && requestInfo.DownstreamLocalAddress() != nil {
+			return requestInfo.DownstreamLocalAddress().String()
+		}
+		return ""
+	},
+	"PROTOCOL": func(headers types.HeaderMap, requestInfo types.RequestInfo) string {
+		if requestInfo != nil {
+			return string(requestInfo.Protocol())
+		}
+		return ""
+	},
+}
+
 func getHeaderFormatter(value string, append bool) headerFormatter {
-	// TODO: variable headers would be support very soon
 	if strings.Index(value, "%") != -1 {
-		log.DefaultLogger.Warnf("variable headers not support yet, skip")
-		return nil
+		return getVariableHeaderFormatter(value, append)
 	}
 	return &plainHeaderFormatter{
 		isAppend:    append,
@@ -45,6 +79,68 @@ func (f *plainHeaderFormatter) append() bool {
 	return f.isAppend
 }
 
-func (f *plainHeaderFormatter) format(requestInfo types.RequestInfo) string {
+func (f *plainHeaderFormatter) format(headers types.HeaderMap, requestInfo types.RequestInfo) string {
 	return f.staticValue
 }
+
+// variableHeaderFormatter formats the value with the variables substituted
+type variableHeaderFormatter struct {
+	isAppend bool
+	segments []headerSegment
+}
+
+// headerSegment is either a literal or a variable
+type headerSegment struct {
+	literal  string
+	variable func(headers types.HeaderMap, requestInfo types.RequestInfo) string
+}
+
+// getVariableHeaderFormatter returns nil if the value has an unknown variable or an unclosed "%"
+func getVariableHeaderFormatter(value string, isAppend bool) headerFormatter {
+	parts := strings.Split(value, "%")
+	if len(parts)%2 == 0 {
+		log.DefaultLogger.Warnf("unclosed variable in header value %s, skip", value)
+		return nil
+	}
+
+	f := &variableHeaderFormatter{isAppend: isAppend}
+	literal := parts[0]
+	// the odd parts are the variables
+	for i := 1; i < len(parts); i += 2 {
+		name := parts[i]
+		if name == "" {
+			literal += "%" + parts[i+1]
+			continue
+		}
+		variable, ok := headerVariables[name]
+		if !ok {
+			log.DefaultLogger.Warnf("unknown variable %s in header value %s, skip", name, value)
+			return nil
+		}
+		if literal != "" {
+			f.segments = append(f.segments, headerSegment{literal: literal})
+		}
+		f.segments = append(f.segments, headerSegment{variable: variable})
+		literal = parts[i+1]
+	}
+	if literal != "" {
+		f.segments = append(f.segments, headerSegment{literal: literal})
+	}
+	return f
+}
+
+func (f *variableHeaderFormatter) append() bool {
+	return f.isAppend
+}
+
+func (f *variableHeaderFormatter) format(headers types.HeaderMap, requestInfo types.RequestInfo) string {
+	var b strings.Builder
+	for _, segment := range f.segments {
+		if segment.variable != nil {
+			b.WriteString(segment.variable(headers, requestInfo))
+		} else {
+			b.WriteString(segment.literal)
+		}
+	}
+	return b.String()
+}
@@ -104,9 +104,34 @@ func Test_plainHeaderFormatter_format(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := formatter.format(nil); !reflect.DeepEqual(got, tt.want) {
+			if got := formatter.format(nil, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("(f *plainHeaderFormatter) format(requestInfo types.RequestInfo) = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func Test_variableHeaderFormatter_format(t *testing.T) {
+	headers := &requestIDHeaders{id: 3}
+	for value, want := range map[string]string{
+		"id-%REQUEST_ID%":    "id-3",
+		"%REQUEST_ID%%%":     "3%",
+		"100%%":              "100%",
+		"%UPSTREAM_HOST%end": "end",
+	} {
+		formatter := getHeaderFormatter(value, false)
+		if formatter == nil {
+			t.Errorf("no formatter for %s", value)
+			continue
+		}
+		if got := formatter.format(headers, nil); got != want {
+			t.Errorf("format %s = %s, want %s", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"%REQUEST_ID", "%unknown%"} {
+		if formatter := getHeaderFormatter(value, false); formatter != nil {
+			t.Errorf("expect no formatter for %s", value)
+		}
+	}
+}
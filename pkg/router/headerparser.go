@@ -27,8 +27,15 @@ func (h *headerParser) evaluateHeaders(headers types.HeaderMap, requestInfo type
 	if h == nil {
 		return
 	}
+	for _, toRename := range h.headersToRename {
+		if v, ok := headers.Get(toRename.from.Get()); ok {
+			headers.Del(toRename.from.Get())
+			headers.Set(toRename.to.Get(), v)
+		}
+	}
+
 	for _, toAdd := range h.headersToAdd {
-		value := toAdd.headerFormatter.format(requestInfo)
+		value := toAdd.headerFormatter.format(headers, requestInfo)
 		if v, ok := headers.Get(toAdd.headerName.Get()); ok && len(v) > 0 && toAdd.headerFormatter.append() {
 			value = fmt.Sprintf("%s,%s", v, value)
 		}
@@ -30,6 +30,7 @@ import (
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/protocol"
 	httpmosn "github.com/alipay/sofa-mosn/pkg/protocol/http"
+	"github.com/alipay/sofa-mosn/pkg/stats"
 	"github.com/alipay/sofa-mosn/pkg/types"
 	multimap "github.com/jwangsadinata/go-multimap/slicemultimap"
 )
@@ -47,17 +48,42 @@ func NewRouteRuleImplBase(vHost *VirtualHostImpl, route *v2.Router) (*RouteRuleI
 		prefixRewrite:         route.Route.PrefixRewrite,
 		hostRewrite:           route.Route.HostRewrite,
 		autoHostRewrite:       route.Route.AutoHostRewrite,
-		requestHeadersParser:  getHeaderParser(route.Route.RequestHeadersToAdd, nil),
-		responseHeadersParser: getHeaderParser(route.Route.ResponseHeadersToAdd, route.Route.ResponseHeadersToRemove),
+		requestHeadersParser:  getRouteHeaderParser(route.Route.RequestHeadersToAdd, route.Route.RequestHeadersToRemove, route.Route.RequestHeadersToRename),
+		responseHeadersParser: getRouteHeaderParser(route.Route.ResponseHeadersToAdd, route.Route.ResponseHeadersToRemove, route.Route.ResponseHeadersToRename),
 		perFilterConfig:       route.PerFilterConfig,
 		policy:                &routerPolicy{},
 	}
 
 	routeRuleImplBase.weightedClusters, routeRuleImplBase.totalClusterWeight = getWeightedClusterEntry(route.Route.WeightedClusters)
+	for _, weightedCluster := range route.Route.WeightedClusters {
+		routeRuleImplBase.weightedClusterNames = append(routeRuleImplBase.weightedClusterNames, weightedCluster.Cluster.Name)
+	}
 	if route.Route.RetryPolicy != nil {
 		routeRuleImplBase.policy.retryOn = route.Route.RetryPolicy.RetryOn
 		routeRuleImplBase.policy.retryTimeout = route.Route.RetryPolicy.RetryTimeout
 		routeRuleImplBase.policy.numRetries = route.Route.RetryPolicy.NumRetries
+		routeRuleImplBase.policy.maxAttempts = route.Route.RetryPolicy.MaxAttempts
+		routeRuleImplBase.policy.retryOnStatus = route.Route.RetryPolicy.RetryOnStatus
+	}
+	if route.Route.HostExclusionWindow > 0 {
+		routeRuleImplBase.policy.hostExclusion = newHostExclusionPolicy(route.Route.HostExclusionWindow)
+	}
+	if dedup := route.Route.Deduplication; dedup != nil && dedup.TTLConfig.Duration > 0 && dedup.MaxEntries > 0 {
+		routeRuleImplBase.policy.deduplication = &deduplicationPolicyImpl{
+			ttl:        dedup.TTLConfig.Duration,
+			maxEntries: dedup.MaxEntries,
+		}
+	}
+	routeRuleImplBase.policy.requestBuffer = route.Route.RequestBufferPolicy
+	if mirror := route.Route.MirrorPolicy; mirror != nil && mirror.ClusterName != "" {
+		percent := mirror.Percent
+		if percent == 0 || percent > 100 {
+			percent = 100
+		}
+		routeRuleImplBase.policy.shadow = &shadowPolicyImpl{
+			cluster: mirror.ClusterName,
+			percent: percent,
+		}
 	}
 
 	// todo add header match to route base
@@ -79,6 +105,20 @@ func NewRouteRuleImplBase(vHost *VirtualHostImpl, route *v2.Router) (*RouteRuleI
 	return &routeRuleImplBase, nil
 }
 
+// NewClusterRoute returns the route to the cluster with the default policies, it is used
+// if the request is sent to a cluster without a matched route, e.g. the explicit cluster
+func NewClusterRoute(clusterName string) types.Route {
+	vHost := &VirtualHostImpl{
+		virtualHostName:   clusterName,
+		globalRouteConfig: &configImpl{},
+	}
+	route := &v2.Router{}
+	route.Route.ClusterName = clusterName
+	base, _ := NewRouteRuleImplBase(vHost, route)
+
+	return base
+}
+
 // Base implementation for all route entries.
 type RouteRuleImplBase struct {
 	caseSensitive               bool
@@ -106,6 +146,7 @@ type RouteRuleImplBase struct {
 	configHeaders         []*types.HeaderData //
 	configQueryParameters []types.QueryParameterMatcher
 	weightedClusters      map[string]weightedClusterEntry //key is the weighted cluster's name
+	weightedClusterNames  []string                        // in config order, so that the selection is stable
 	totalClusterWeight    uint32
 	hashPolicy            hashPolicyImpl
 
@@ -161,14 +202,22 @@ func (rri *RouteRuleImplBase) ClusterName() string {
 
 	// use randInstance to avoid global lock contention
 	rri.randMutex.Lock()
-	selectedValue := rri.randInstance.Intn(int(rri.totalClusterWeight))
+	selectedValue := rri.randInstance.Uint64()
 	rri.randMutex.Unlock()
 
-	for _, weightCluster := range rri.weightedClusters {
+	return rri.weightedClusterName(selectedValue)
+}
 
-		selectedValue = selectedValue - int(weightCluster.clusterWeight)
-		if selectedValue <= 0 {
-			return weightCluster.clusterName
+// weightedClusterName selects the weighted cluster by the value, the same value always selects the same cluster
+func (rri *RouteRuleImplBase) weightedClusterName(value uint64) string {
+	if rri.totalClusterWeight > 0 {
+		selectedValue := uint32(value % uint64(rri.totalClusterWeight))
+		for _, name := range rri.weightedClusterNames {
+			weight := rri.weightedClusters[name].clusterWeight
+			if selectedValue < weight {
+				return name
+			}
+			selectedValue -= weight
 		}
 	}
 
@@ -181,6 +230,13 @@ func (rri *RouteRuleImplBase) GlobalTimeout() time.Duration {
 	return rri.routerAction.Timeout
 }
 
+func (rri *RouteRuleImplBase) TimeoutOverride() (time.Duration, time.Duration) {
+	if override := rri.routerAction.TimeoutOverride; override != nil {
+		return override.TryTimeout, override.GlobalTimeout
+	}
+	return 0, 0
+}
+
 func (rri *RouteRuleImplBase) VirtualHost() types.VirtualHost {
 
 	return rri.vHost
@@ -294,22 +350,56 @@ func (rri *RouteRuleImplBase) FinalizeResponseHeaders(headers types.HeaderMap, r
 }
 
 func SofaRouterFactory(headers []v2.HeaderMatcher) RouteBase {
+	if rule := newSofaRouteRule(headers); rule != nil {
+		return rule
+	}
+
+	return nil
+}
+
+// newSofaRouteRule creates the sofa route rule matching the service header, and the method header if configured.
+// Returns nil if no service header matcher found
+func newSofaRouteRule(headers []v2.HeaderMatcher) *SofaRouteRuleImpl {
+	var rule *SofaRouteRuleImpl
+	var method string
+	var others []v2.HeaderMatcher
 	for _, header := range headers {
-		if header.Name == types.SofaRouteMatchKey {
-			return &SofaRouteRuleImpl{
-				matchName:  header.Name,
-				matchValue: header.Value,
+		switch header.Name {
+		case types.SofaRouteMatchKey:
+			if rule == nil {
+				rule = &SofaRouteRuleImpl{
+					matchName:  header.Name,
+					matchValue: header.Value,
+					matchAll:   header.Value == ".*",
+				}
 			}
+		case types.SofaRouteMethodKey:
+			method = header.Value
+		default:
+			others = append(others, header)
 		}
 	}
+	if rule != nil {
+		rule.methodValue = method
+		rule.headers = getRouterHeaders(others)
+	}
 
-	return nil
+	return rule
 }
 
+// SofaRouteRuleImpl matches the service of the sofa request, and the method if methodValue is not empty,
+// and the other headers configured, e.g. a canary header.
+// Routes are matched in order, so a method or header route should be configured before the route of its service,
+// the requests not matched fall through to the service route
 type SofaRouteRuleImpl struct {
 	*RouteRuleImplBase
-	matchName  string
-	matchValue string
+	matchName   string
+	matchValue  string
+	matchAll    bool
+	methodValue string
+	headers     []*types.HeaderData
+
+	clusterStats sync.Map // cluster name -> types.Metrics
 }
 
 func (srri *SofaRouteRuleImpl) PathMatchCriterion() types.PathMatchCriterion {
@@ -328,9 +418,19 @@ func (srri *SofaRouteRuleImpl) MatchType() types.PathMatchType {
 
 func (srri *SofaRouteRuleImpl) Match(headers types.HeaderMap, randomValue uint64) types.Route {
 	if value, ok := headers.Get(types.SofaRouteMatchKey); ok {
-		if value == srri.matchValue || srri.matchValue == ".*" {
+		if value == srri.matchValue || srri.matchAll {
+			if srri.methodValue != "" {
+				if method, _ := headers.Get(types.SofaRouteMethodKey); method != srri.methodValue {
+					log.DefaultLogger.Debugf("Sofa router matches failure, service name = %s, method = %s", value, method)
+					return nil
+				}
+			}
+			if len(srri.headers) > 0 && !ConfigUtilityInst.MatchHeaders(headers, srri.headers) {
+				log.DefaultLogger.Debugf("Sofa router matches failure, service name = %s, headers not matched", value)
+				return nil
+			}
 			log.DefaultLogger.Debugf("Sofa router matches success")
-			return srri
+			return srri.selectCluster(headers)
 		}
 
 		log.DefaultLogger.Warnf(" Sofa router matches failure, service name = %s", value)
@@ -345,8 +445,83 @@ func (srri *SofaRouteRuleImpl) RouteRule() types.RouteRule {
 	return srri
 }
 
+// requestIDHeader is the header map carrying the request id, e.g. the sofarpc command
+type requestIDHeader interface {
+	RequestID() uint64
+}
+
+// selectCluster returns the route of the request with the cluster selected.
+// The weighted cluster is selected by the hash of the request id if the headers carry one,
+// so that a request retried with the same id always goes to the same cluster
+func (srri *SofaRouteRuleImpl) selectCluster(headers types.HeaderMap) types.Route {
+	if srri.RouteRuleImplBase == nil {
+		return srri
+	}
+
+	var route types.Route = srri
+	clusterName := srri.clusterName
+	if len(srri.weightedClusters) > 0 {
+		if req, ok := headers.(requestIDHeader); ok {
+			clusterName = srri.weightedClusterName(hashRequestID(req.RequestID()))
+		} else {
+			clusterName = srri.ClusterName()
+		}
+		route = &sofaWeightedRoute{
+			SofaRouteRuleImpl: srri,
+			clusterName:       clusterName,
+		}
+	}
+	srri.routeClusterStats(clusterName).Counter(stats.RouterClusterSelected).Inc(1)
+
+	return route
+}
+
+func (srri *SofaRouteRuleImpl) routeClusterStats(clusterName string) types.Metrics {
+	if s, ok := srri.clusterStats.Load(clusterName); ok {
+		return s.(types.Metrics)
+	}
+	s, _ := srri.clusterStats.LoadOrStore(clusterName, stats.NewRouteClusterStats(srri.matchValue, clusterName))
+	return s.(types.Metrics)
+}
+
+// hashRequestID spreads the sequential request ids, murmur3 finalizer
+func hashRequestID(id uint64) uint64 {
+	id ^= id >> 33
+	id *= 0xff51afd7ed558ccd
+	id ^= id >> 33
+	id *= 0xc4ceb9fe1a85ec53
+	id ^= id >> 33
+	return id
+}
+
+// sofaWeightedRoute is the route of a request with the weighted cluster selected
+type sofaWeightedRoute struct {
+	*SofaRouteRuleImpl
+	clusterName string
+}
+
+func (r *sofaWeightedRoute) RouteRule() types.RouteRule {
+	return r
+}
+
+func (r *sofaWeightedRoute) ClusterName() string {
+	return r.clusterName
+}
+
+// FinalizeRequestHeaders applies the header operations of the route, the virtual host and the router config.
+// The sofarpc stream strips the proxy internal headers after that, so they never leave the MOSN hop
 func (srri *SofaRouteRuleImpl) FinalizeRequestHeaders(headers types.HeaderMap, requestInfo types.RequestInfo) {
+	if srri.RouteRuleImplBase == nil {
+		return
+	}
+	srri.finalizeRequestHeaders(headers, requestInfo)
+}
 
+func (srri *SofaRouteRuleImpl) FinalizeResponseHeaders(headers types.HeaderMap, requestInfo types.RequestInfo) {
+	if srri.RouteRuleImplBase == nil {
+		return
+	}
+	srri.RouteRuleImplBase.FinalizeResponseHeaders(headers, requestInfo)
 }
 
 type PathRouteRuleImpl struct {
@@ -19,6 +19,7 @@ package router
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
@@ -26,7 +27,7 @@ import (
 )
 
 type headerFormatter interface {
-	format(requestInfo types.RequestInfo) string
+	format(headers types.HeaderMap, requestInfo types.RequestInfo) string
 	append() bool
 }
 
@@ -35,7 +36,14 @@ type headerPair struct {
 	headerFormatter headerFormatter
 }
 
+type headerRename struct {
+	from *lowerCaseString
+	to   *lowerCaseString
+}
+
+// headerParser evaluates the header operations in order: rename, add, remove
 type headerParser struct {
+	headersToRename []*headerRename
 	headersToAdd    []*headerPair
 	headersToRemove []*lowerCaseString
 }
@@ -59,6 +67,7 @@ type RouteBase interface {
 type shadowPolicyImpl struct {
 	cluster    string
 	runtimeKey string
+	percent    uint32
 }
 
 func (spi *shadowPolicyImpl) ClusterName() string {
@@ -69,6 +78,10 @@ func (spi *shadowPolicyImpl) RuntimeKey() string {
 	return spi.runtimeKey
 }
 
+func (spi *shadowPolicyImpl) Percent() uint32 {
+	return spi.percent
+}
+
 type lowerCaseString struct {
 	str string
 }
@@ -108,9 +121,11 @@ func (rp *rateLimitPolicyImpl) GetApplicableRateLimit(stage string) []types.Rate
 }
 
 type retryPolicyImpl struct {
-	retryOn      bool
-	retryTimeout time.Duration
-	numRetries   uint32
+	retryOn       bool
+	retryTimeout  time.Duration
+	numRetries    uint32
+	maxAttempts   uint32
+	retryOnStatus []int
 }
 
 func (p *retryPolicyImpl) RetryOn() bool {
@@ -125,6 +140,14 @@ func (p *retryPolicyImpl) NumRetries() uint32 {
 	return p.numRetries
 }
 
+func (p *retryPolicyImpl) MaxAttempts() uint32 {
+	return p.maxAttempts
+}
+
+func (p *retryPolicyImpl) RetryOnStatus() []int {
+	return p.retryOnStatus
+}
+
 // todo implement CorsPolicy
 
 type runtimeData struct {
@@ -165,9 +188,15 @@ func (wc *weightedClusterEntry) GetClusterMetadataMatchCriteria() *MetadataMatch
 }
 
 type routerPolicy struct {
-	retryOn      bool
-	retryTimeout time.Duration
-	numRetries   uint32
+	retryOn       bool
+	retryTimeout  time.Duration
+	numRetries    uint32
+	maxAttempts   uint32
+	retryOnStatus []int
+	hostExclusion *hostExclusionPolicyImpl
+	deduplication *deduplicationPolicyImpl
+	shadow        *shadowPolicyImpl
+	requestBuffer *v2.RequestBufferPolicy
 }
 
 func (p *routerPolicy) RetryOn() bool {
@@ -182,12 +211,23 @@ func (p *routerPolicy) NumRetries() uint32 {
 	return p.numRetries
 }
 
+func (p *routerPolicy) MaxAttempts() uint32 {
+	return p.maxAttempts
+}
+
+func (p *routerPolicy) RetryOnStatus() []int {
+	return p.retryOnStatus
+}
+
 func (p *routerPolicy) RetryPolicy() types.RetryPolicy {
 	return p
 }
 
 func (p *routerPolicy) ShadowPolicy() types.ShadowPolicy {
-	return nil
+	if p.shadow == nil {
+		return nil
+	}
+	return p.shadow
 }
 
 func (p *routerPolicy) CorsPolicy() types.CorsPolicy {
@@ -198,6 +238,89 @@ func (p *routerPolicy) LoadBalancerPolicy() types.LoadBalancerPolicy {
 	return nil
 }
 
+func (p *routerPolicy) HostExclusionPolicy() types.HostExclusionPolicy {
+	if p.hostExclusion == nil {
+		return nil
+	}
+	return p.hostExclusion
+}
+
+func (p *routerPolicy) DeduplicationPolicy() types.DeduplicationPolicy {
+	if p.deduplication == nil {
+		return nil
+	}
+	return p.deduplication
+}
+
+func (p *routerPolicy) RequestBufferPolicy() *v2.RequestBufferPolicy {
+	return p.requestBuffer
+}
+
+type deduplicationPolicyImpl struct {
+	ttl        time.Duration
+	maxEntries int
+}
+
+func (p *deduplicationPolicyImpl) TTL() time.Duration {
+	return p.ttl
+}
+
+func (p *deduplicationPolicyImpl) MaxEntries() int {
+	return p.maxEntries
+}
+
+// hostExclusionPolicyImpl is a short local penalty box of the failed hosts on a route,
+// it is not an outlier ejection, the excluded hosts are still chosen if no other host is available
+type hostExclusionPolicyImpl struct {
+	window time.Duration
+	mux    sync.RWMutex
+	// host address -> exclusion expire time
+	hosts map[string]time.Time
+}
+
+func newHostExclusionPolicy(window time.Duration) *hostExclusionPolicyImpl {
+	return &hostExclusionPolicyImpl{
+		window: window,
+		hosts:  make(map[string]time.Time),
+	}
+}
+
+func (p *hostExclusionPolicyImpl) Exclude(host types.Host) {
+	if host == nil {
+		return
+	}
+
+	p.mux.Lock()
+	p.hosts[host.AddressString()] = time.Now().Add(p.window)
+	p.mux.Unlock()
+}
+
+func (p *hostExclusionPolicyImpl) IsExcluded(host types.Host) bool {
+	if host == nil {
+		return false
+	}
+	addr := host.AddressString()
+
+	p.mux.RLock()
+	expire, ok := p.hosts[addr]
+	p.mux.RUnlock()
+	if !ok {
+		return false
+	}
+	if time.Now().Before(expire) {
+		return true
+	}
+
+	// window expired, the host may be excluded again during the check
+	p.mux.Lock()
+	if expire, ok := p.hosts[addr]; ok && !time.Now().Before(expire) {
+		delete(p.hosts, addr)
+	}
+	p.mux.Unlock()
+
+	return false
+}
+
 // RouterRuleFactory creates a RouteBase
 type RouterRuleFactory func(base *RouteRuleImplBase, header []v2.HeaderMatcher) RouteBase
 
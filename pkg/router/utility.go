@@ -104,6 +104,27 @@ func getHeaderParser(headersToAdd []*v2.HeaderValueOption, headersToRemove []str
 	}
 }
 
+// getRouteHeaderParser is getHeaderParser with the headers to rename, which is only supported by the route
+func getRouteHeaderParser(headersToAdd []*v2.HeaderValueOption, headersToRemove []string, headersToRename []*v2.HeaderRename) *headerParser {
+	parser := getHeaderParser(headersToAdd, headersToRemove)
+	if len(headersToRename) == 0 {
+		return parser
+	}
+	if parser == nil {
+		parser = &headerParser{}
+	}
+	for _, rename := range headersToRename {
+		if rename == nil || rename.From == "" || rename.To == "" {
+			continue
+		}
+		from, to := &lowerCaseString{rename.From}, &lowerCaseString{rename.To}
+		from.Lower()
+		to.Lower()
+		parser.headersToRename = append(parser.headersToRename, &headerRename{from: from, to: to})
+	}
+	return parser
+}
+
 func getHeaderPair(headersToAdd []*v2.HeaderValueOption) []*headerPair {
 	if headersToAdd == nil {
 		return nil
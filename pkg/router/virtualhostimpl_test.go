@@ -18,11 +18,15 @@
 package router
 
 import (
+	"net"
 	"strings"
 	"testing"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/network"
 	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
 // Prefix > Path > Regex
@@ -195,3 +199,197 @@ func TestAllRouter(t *testing.T) {
 		}
 	}
 }
+
+// method route is matched before its service route, other methods fall through to the service route
+func TestSofaMethodRouter(t *testing.T) {
+	newRouter := func(cluster string, headers ...v2.HeaderMatcher) v2.Router {
+		r := v2.Router{}
+		r.Match = v2.RouterMatch{Headers: headers}
+		r.Route = v2.RouteAction{RouterActionConfig: v2.RouterActionConfig{ClusterName: cluster}}
+		return r
+	}
+	service := v2.HeaderMatcher{Name: types.SofaRouteMatchKey, Value: "com.alipay.test.Service"}
+	virtualHost, err := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "test",
+		Domains: []string{"*"},
+		Routers: []v2.Router{
+			newRouter("analytic", service, v2.HeaderMatcher{Name: types.SofaRouteMethodKey, Value: "report"}),
+			newRouter("default", service),
+		},
+	}, false)
+	if err != nil {
+		t.Fatalf("create virtual host failed: %v", err)
+	}
+
+	testCases := []struct {
+		service     string
+		method      string
+		clustername string
+	}{
+		{"com.alipay.test.Service", "report", "analytic"},
+		{"com.alipay.test.Service", "echo", "default"},
+		{"com.alipay.test.Service", "", "default"},
+		{"com.alipay.test.Other", "report", ""},
+	}
+	for i, tc := range testCases {
+		headers := protocol.CommonHeader(map[string]string{
+			types.SofaRouteMatchKey: tc.service,
+		})
+		if tc.method != "" {
+			headers.Set(types.SofaRouteMethodKey, tc.method)
+		}
+		rt := virtualHost.GetRouteFromEntries(headers, 1)
+		if tc.clustername == "" {
+			if rt != nil {
+				t.Errorf("#%d expect no route, got %s", i, rt.RouteRule().ClusterName())
+			}
+			continue
+		}
+		if rt == nil || rt.RouteRule().ClusterName() != tc.clustername {
+			t.Errorf("#%d expect cluster %s, got %v", i, tc.clustername, rt)
+		}
+	}
+}
+
+// requestIDHeaders is the sofa request headers with request id
+type requestIDHeaders struct {
+	protocol.CommonHeader
+	id uint64
+}
+
+func (h *requestIDHeaders) RequestID() uint64 {
+	return h.id
+}
+
+func TestSofaCanaryRouter(t *testing.T) {
+	service := v2.HeaderMatcher{Name: types.SofaRouteMatchKey, Value: "com.alipay.test.CanaryService"}
+	canaryRouter := v2.Router{}
+	canaryRouter.Match = v2.RouterMatch{Headers: []v2.HeaderMatcher{service, {Name: "canary", Value: "true"}}}
+	canaryRouter.Route = v2.RouteAction{RouterActionConfig: v2.RouterActionConfig{ClusterName: "canary"}}
+	weightedRouter := v2.Router{}
+	weightedRouter.Match = v2.RouterMatch{Headers: []v2.HeaderMatcher{service}}
+	weightedRouter.Route = v2.RouteAction{RouterActionConfig: v2.RouterActionConfig{
+		ClusterName: "stable",
+		WeightedClusters: []v2.WeightedCluster{
+			{Cluster: v2.ClusterWeight{ClusterWeightConfig: v2.ClusterWeightConfig{Name: "stable", Weight: 90}}},
+			{Cluster: v2.ClusterWeight{ClusterWeightConfig: v2.ClusterWeightConfig{Name: "canary", Weight: 10}}},
+		},
+	}}
+	virtualHost, err := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "test",
+		Domains: []string{"*"},
+		Routers: []v2.Router{canaryRouter, weightedRouter},
+	}, false)
+	if err != nil {
+		t.Fatalf("create virtual host failed: %v", err)
+	}
+	newHeaders := func(id uint64) *requestIDHeaders {
+		return &requestIDHeaders{
+			CommonHeader: protocol.CommonHeader{types.SofaRouteMatchKey: service.Value},
+			id:           id,
+		}
+	}
+
+	// header match first
+	headers := newHeaders(1)
+	headers.Set("canary", "true")
+	if rt := virtualHost.GetRouteFromEntries(headers, 1); rt == nil || rt.RouteRule().ClusterName() != "canary" {
+		t.Fatalf("request with canary header should be routed to canary, got %v", rt)
+	}
+
+	// weighted selection is stable by the request id
+	split := map[string]int{}
+	for id := uint64(1); id <= 1000; id++ {
+		rt := virtualHost.GetRouteFromEntries(newHeaders(id), 1)
+		if rt == nil {
+			t.Fatalf("no route for request %d", id)
+		}
+		clusterName := rt.RouteRule().ClusterName()
+		if retry := virtualHost.GetRouteFromEntries(newHeaders(id), 1); retry.RouteRule().ClusterName() != clusterName {
+			t.Fatalf("request %d is routed to %s, retried to %s", id, clusterName, retry.RouteRule().ClusterName())
+		}
+		split[clusterName]++
+	}
+	if split["canary"] < 50 || split["canary"] > 150 || split["stable"]+split["canary"] != 1000 {
+		t.Errorf("unexpected weighted split: %v", split)
+	}
+
+	// 1 header routed request, and each weighted request is routed twice
+	canary := stats.NewRouteClusterStats(service.Value, "canary").Counter(stats.RouterClusterSelected).Count()
+	stable := stats.NewRouteClusterStats(service.Value, "stable").Counter(stats.RouterClusterSelected).Count()
+	if canary != int64(split["canary"]*2+1) || stable != int64(split["stable"]*2) {
+		t.Errorf("unexpected split metrics, canary %d, stable %d, split %v", canary, stable, split)
+	}
+}
+
+func TestSofaRouteHeaderOperations(t *testing.T) {
+	FALSE := false
+	router := v2.Router{}
+	router.Match = v2.RouterMatch{Headers: []v2.HeaderMatcher{{Name: types.SofaRouteMatchKey, Value: ".*"}}}
+	router.Route = v2.RouteAction{RouterActionConfig: v2.RouterActionConfig{
+		ClusterName: "test",
+		RequestHeadersToAdd: []*v2.HeaderValueOption{
+			{Header: &v2.HeaderValue{Key: "downstream-service", Value: "mosn-%REQUEST_ID%-%DOWNSTREAM_REMOTE_ADDRESS%"}, Append: &FALSE},
+			// unknown variable is skipped
+			{Header: &v2.HeaderValue{Key: "unknown", Value: "%UNKNOWN%"}},
+		},
+		RequestHeadersToRemove: []string{"Internal"},
+		RequestHeadersToRename: []*v2.HeaderRename{{From: "old", To: "new"}},
+		ResponseHeadersToAdd: []*v2.HeaderValueOption{
+			{Header: &v2.HeaderValue{Key: "upstream", Value: "%UPSTREAM_HOST%"}, Append: &FALSE},
+		},
+	}}
+	virtualHost, err := NewVirtualHostImpl(&v2.VirtualHost{
+		Name:    "test",
+		Domains: []string{"*"},
+		Routers: []v2.Router{router},
+	}, false)
+	if err != nil {
+		t.Fatalf("create virtual host failed: %v", err)
+	}
+	virtualHost.globalRouteConfig = &configImpl{}
+
+	headers := &requestIDHeaders{
+		CommonHeader: protocol.CommonHeader{types.SofaRouteMatchKey: "service", "internal": "1", "old": "v"},
+		id:           7,
+	}
+	rt := virtualHost.GetRouteFromEntries(headers, 1)
+	if rt == nil {
+		t.Fatal("no route matched")
+	}
+	info := network.NewRequestInfo()
+	info.SetDownstreamRemoteAddress(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080})
+	rt.RouteRule().FinalizeRequestHeaders(headers, info)
+
+	if v, _ := headers.Get("downstream-service"); v != "mosn-7-127.0.0.1:8080" {
+		t.Errorf("unexpected added header: %s", v)
+	}
+	if _, ok := headers.Get("unknown"); ok {
+		t.Error("header with unknown variable should be skipped")
+	}
+	if _, ok := headers.Get("internal"); ok {
+		t.Error("header should be removed")
+	}
+	if v, ok := headers.Get("new"); !ok || v != "v" {
+		t.Errorf("header should be renamed, got %s", v)
+	}
+	if _, ok := headers.Get("old"); ok {
+		t.Error("renamed header should be removed")
+	}
+
+	response := protocol.CommonHeader{}
+	info.OnUpstreamHostSelected(&mockHostInfo{addr: "127.0.0.2:12200"})
+	rt.RouteRule().FinalizeResponseHeaders(response, info)
+	if v, _ := response.Get("upstream"); v != "127.0.0.2:12200" {
+		t.Errorf("unexpected upstream host header: %s", v)
+	}
+}
+
+type mockHostInfo struct {
+	types.HostInfo
+	addr string
+}
+
+func (h *mockHostInfo) AddressString() string {
+	return h.addr
+}
@@ -18,14 +18,23 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
 	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	_ "github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc/codec"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/stream"
+	_ "github.com/alipay/sofa-mosn/pkg/stream/sofarpc"
 	"github.com/alipay/sofa-mosn/pkg/types"
 	"github.com/alipay/sofa-mosn/pkg/upstream/cluster"
 )
@@ -274,3 +283,295 @@ func TestListenerAdapter_DeleteListener(t *testing.T) {
 		conn.Close()
 	}
 }
+
+// echoFilterFactory creates a filter replying the tag and the data received
+type echoFilterFactory struct {
+	tag string
+}
+
+func (f *echoFilterFactory) CreateFilterChain(context context.Context, clusterManager types.ClusterManager,
+	callbacks types.NetWorkFilterChainFactoryCallbacks) {
+	callbacks.AddReadFilter(&echoFilter{tag: f.tag})
+}
+
+type echoFilter struct {
+	tag string
+	cb  types.ReadFilterCallbacks
+}
+
+func (f *echoFilter) OnData(data types.IoBuffer) types.FilterStatus {
+	reply := data.String()
+	data.Drain(data.Len())
+	f.cb.Connection().Write(buffer.NewIoBufferString(f.tag + reply))
+	return types.Stop
+}
+
+func (f *echoFilter) OnNewConnection() types.FilterStatus {
+	return types.Continue
+}
+
+func (f *echoFilter) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {
+	f.cb = cb
+}
+
+func echo(t *testing.T, conn net.Conn, data string, expected string) {
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write([]byte(data)); err != nil {
+		t.Fatalf("write %s error: %v", data, err)
+	}
+	reply := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != expected {
+		t.Fatalf("expect reply %s, got %s, error: %v", expected, reply, err)
+	}
+}
+
+func TestListenerAdapter_ReplaceListener(t *testing.T) {
+	go runMockServer(t)
+	time.Sleep(1 * time.Second) // wait server start
+
+	adapter := GetListenerAdapterInstance()
+	handler := adapter.defaultConnHandler.(*connHandler)
+	newConfig := func(address string) *v2.Listener {
+		addr, _ := net.ResolveTCPAddr("tcp", address)
+		return &v2.Listener{
+			ListenerConfig: v2.ListenerConfig{
+				Name:       "listener3",
+				BindToPort: true,
+				LogPath:    "stdout",
+			},
+			Addr: addr,
+		}
+	}
+
+	oldAddress, newAddress := "127.0.0.1:8083", "127.0.0.1:8084"
+	if err := adapter.AddOrUpdateListener("", newConfig(oldAddress),
+		[]types.NetworkFilterChainFactory{&echoFilterFactory{tag: "v1:"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond) // wait listener start
+	established, err := net.Dial("tcp", oldAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer established.Close()
+	echo(t, established, "a", "v1:a")
+
+	// move the listener to the new address with the new filter chain
+	if err := adapter.AddOrUpdateListener("", newConfig(newAddress),
+		[]types.NetworkFilterChainFactory{&echoFilterFactory{tag: "v2:"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond) // wait listener start
+	if l := handler.FindListenerByName("listener3"); l == nil || l.Addr().String() != newAddress {
+		t.Fatalf("expect listener3 on %s, got %v", newAddress, l)
+	}
+
+	// the established connection keeps serving on the old filter chain
+	echo(t, established, "b", "v1:b")
+
+	// new connections use the new config
+	conn, err := net.Dial("tcp", newAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn, "c", "v2:c")
+	conn.Close()
+	if conn, err := net.Dial("tcp", oldAddress); err == nil {
+		conn.Close()
+		t.Errorf("the old address %s should not be accepted", oldAddress)
+	}
+
+	// the retired listener is dropped once its connections are closed
+	handler.retiredMux.Lock()
+	retired := len(handler.retiredListeners)
+	handler.retiredMux.Unlock()
+	if retired != 1 {
+		t.Fatalf("expect the old listener retired, got %d", retired)
+	}
+	established.Close()
+	for i := 0; i < 30 && retired != 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		handler.retiredMux.Lock()
+		retired = len(handler.retiredListeners)
+		handler.retiredMux.Unlock()
+	}
+	if retired != 0 {
+		t.Errorf("expect the retired listener dropped, got %d", retired)
+	}
+
+	// the listener is kept on its address if the new one can't be bound
+	busyAddress := "127.0.0.1:8085"
+	busy, err := net.Listen("tcp", busyAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	if err := adapter.AddOrUpdateListener("", newConfig(busyAddress),
+		[]types.NetworkFilterChainFactory{&echoFilterFactory{tag: "v3:"}}, nil); err == nil {
+		t.Fatalf("expect the error of binding the busy address %s", busyAddress)
+	}
+	if l := handler.FindListenerByName("listener3"); l == nil || l.Addr().String() != newAddress {
+		t.Fatalf("expect listener3 kept on %s, got %v", newAddress, l)
+	}
+	conn, err = net.Dial("tcp", newAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn, "d", "v2:d")
+	conn.Close()
+
+	adapter.DeleteListener("", "listener3")
+}
+
+// rpcFilterFactory creates a filter decoding the sofarpc frames with the stream connection, which
+// replies each request with a success response of its protocol
+type rpcFilterFactory struct{}
+
+func (f *rpcFilterFactory) CreateFilterChain(context context.Context, clusterManager types.ClusterManager,
+	callbacks types.NetWorkFilterChainFactoryCallbacks) {
+	callbacks.AddReadFilter(&rpcFilter{ctx: context})
+}
+
+type rpcFilter struct {
+	ctx  context.Context
+	conn types.StreamConnection
+}
+
+func (f *rpcFilter) OnData(data types.IoBuffer) types.FilterStatus {
+	f.conn.Dispatch(data)
+	return types.Stop
+}
+
+func (f *rpcFilter) OnNewConnection() types.FilterStatus {
+	return types.Continue
+}
+
+func (f *rpcFilter) InitializeReadFilterCallbacks(cb types.ReadFilterCallbacks) {
+	f.conn = stream.CreateServerStreamConnection(f.ctx, protocol.SofaRPC, cb.Connection(), f)
+}
+
+func (f *rpcFilter) OnGoAway() {}
+
+func (f *rpcFilter) NewStreamDetect(ctx context.Context, sender types.StreamSender, spanBuilder types.SpanBuilder) types.StreamReceiveListener {
+	return &rpcReplier{sender: sender}
+}
+
+type rpcReplier struct {
+	sender types.StreamSender
+}
+
+func (r *rpcReplier) OnReceiveHeaders(ctx context.Context, headers types.HeaderMap, endOfStream bool) {
+	var resp sofarpc.SofaRpcCmd
+	switch req := headers.(type) {
+	case *sofarpc.BoltRequestV2:
+		resp = &sofarpc.BoltResponseV2{
+			BoltResponse: sofarpc.BoltResponse{
+				Protocol: sofarpc.PROTOCOL_CODE_V2, CmdType: sofarpc.RESPONSE, CmdCode: sofarpc.RPC_RESPONSE,
+				Version: req.Version, ReqID: req.ReqID, Codec: req.Codec, ResponseStatus: sofarpc.RESPONSE_STATUS_SUCCESS,
+			},
+			Version1: req.Version1,
+		}
+	case *sofarpc.BoltRequest:
+		resp = &sofarpc.BoltResponse{
+			Protocol: sofarpc.PROTOCOL_CODE_V1, CmdType: sofarpc.RESPONSE, CmdCode: sofarpc.RPC_RESPONSE,
+			Version: req.Version, ReqID: req.ReqID, Codec: req.Codec, ResponseStatus: sofarpc.RESPONSE_STATUS_SUCCESS,
+		}
+	default:
+		return
+	}
+	r.sender.AppendHeaders(ctx, resp, true)
+}
+
+func (r *rpcReplier) OnReceiveData(ctx context.Context, data types.IoBuffer, endOfStream bool) {}
+
+func (r *rpcReplier) OnReceiveTrailers(ctx context.Context, trailers types.HeaderMap) {}
+
+func (r *rpcReplier) OnDecodeError(ctx context.Context, err error, headers types.HeaderMap) {}
+
+func TestListenerProtocolDetection(t *testing.T) {
+	go runMockServer(t)
+	time.Sleep(1 * time.Second) // wait server start
+
+	address := "127.0.0.1:8086"
+	addr, _ := net.ResolveTCPAddr("tcp", address)
+	lc := &v2.Listener{
+		ListenerConfig: v2.ListenerConfig{
+			Name:       "detect_listener",
+			BindToPort: true,
+			LogPath:    "stdout",
+			ProtocolDetection: &v2.DetectConfig{
+				Protocols: []string{"bolt", "boltv2"},
+				Timeout:   v2.DurationConfig{Duration: time.Second},
+			},
+		},
+		Addr: addr,
+	}
+	adapter := GetListenerAdapterInstance()
+	if err := adapter.AddOrUpdateListener("", lc, []types.NetworkFilterChainFactory{&rpcFilterFactory{}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer adapter.DeleteListener("", "detect_listener")
+	time.Sleep(500 * time.Millisecond) // wait listener start
+
+	ctx := buffer.NewBufferPoolContext(context.Background())
+	call := func(req sofarpc.SofaRpcCmd) sofarpc.SofaRpcCmd {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		frame, err := sofarpc.Engine().Encode(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(frame.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		buf := buffer.NewIoBuffer(128)
+		for {
+			if cmd, _ := sofarpc.Engine().Decode(ctx, buf); cmd != nil {
+				return cmd.(sofarpc.SofaRpcCmd)
+			}
+			if _, err := buf.ReadOnce(conn); err != nil {
+				t.Fatalf("read the response of %T failed: %v", req, err)
+			}
+		}
+	}
+
+	// the connections of both protocols share the port
+	boltReq := &sofarpc.BoltRequest{
+		Protocol: sofarpc.PROTOCOL_CODE_V1, CmdType: sofarpc.REQUEST, CmdCode: sofarpc.RPC_REQUEST,
+		Version: 1, ReqID: 1, Codec: sofarpc.HESSIAN2_SERIALIZE, Timeout: 3000,
+	}
+	if resp := call(boltReq); resp.ProtocolCode() != sofarpc.PROTOCOL_CODE_V1 || resp.RequestID() != 1 {
+		t.Errorf("expect the bolt response of request 1, got %+v", resp)
+	}
+	boltV2Req := &sofarpc.BoltRequestV2{
+		BoltRequest: sofarpc.BoltRequest{
+			Protocol: sofarpc.PROTOCOL_CODE_V2, CmdType: sofarpc.REQUEST, CmdCode: sofarpc.RPC_REQUEST,
+			Version: 1, ReqID: 2, Codec: sofarpc.HESSIAN2_SERIALIZE, Timeout: 3000,
+		},
+		Version1: sofarpc.PROTOCOL_VERSION_1,
+	}
+	if resp := call(boltV2Req); resp.ProtocolCode() != sofarpc.PROTOCOL_CODE_V2 || resp.RequestID() != 2 {
+		t.Errorf("expect the boltv2 response of request 2, got %+v", resp)
+	}
+
+	// the connection of an undetected protocol is closed
+	undetected := stats.NewListenerStats("detect_listener").Counter(stats.DownstreamProtocolUndetected)
+	undetectedBase := undetected.Count()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte{13, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	if _, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("expect the connection closed, got %v", err)
+	}
+	if undetected.Count()-undetectedBase != 1 {
+		t.Errorf("expect the connection counted as undetected, got %d", undetected.Count()-undetectedBase)
+	}
+}
@@ -47,6 +47,9 @@ type connHandler struct {
 	listeners      []*activeListener
 	clusterManager types.ClusterManager
 	logger         log.Logger
+	// the replaced or removed listeners still serving the established connections
+	retiredListeners []*activeListener
+	retiredMux       sync.Mutex
 }
 
 // NewHandler
@@ -109,8 +112,10 @@ func (ch *connHandler) GenerateListenerID() string {
 }
 
 // AddOrUpdateListener used to add or update listener
-// listener name is unique key to represent the listener
-// and listener with the same name must have the same configured address
+// listener name is unique key to represent the listener.
+// The listener is updated in place, new connections use the new config while the established connections
+// keep serving on the filter chains they were accepted with. If the configured address is changed,
+// the listener is replaced by a new one on the new address, see replaceListener
 func (ch *connHandler) AddOrUpdateListener(lc *v2.Listener, networkFiltersFactories []types.NetworkFilterChainFactory,
 	streamFiltersFactories []types.StreamFilterChainFactory) (types.ListenerEventListener, error) {
 
@@ -126,10 +131,10 @@ func (ch *connHandler) AddOrUpdateListener(lc *v2.Listener, networkFiltersFactor
 	if al = ch.findActiveListenerByName(listenerName); al != nil {
 		// listener already exist, update the listener
 
-		// a listener with the same name must have the same configured address
+		// a new listening socket is needed if the address is changed
 		if al.listener.Addr().String() != lc.Addr.String() ||
 			al.listener.Addr().Network() != lc.Addr.Network() {
-			return nil, fmt.Errorf("error updating listener, listen address and listen name doesn't match")
+			return ch.replaceListener(al, lc, networkFiltersFactories, streamFiltersFactories)
 		}
 
 		equalConfig := reflect.DeepEqual(al.listener.Config(), lc)
@@ -141,8 +146,22 @@ func (ch *connHandler) AddOrUpdateListener(lc *v2.Listener, networkFiltersFactor
 			return nil, nil
 		}
 
+		// the tls config is applied to the new connections
+		var tlsMng types.TLSContextManager
+		if old := al.listener.Config(); !equalConfig &&
+			(!reflect.DeepEqual(old.FilterChains, lc.FilterChains) || !reflect.DeepEqual(old.Inspector, lc.Inspector)) {
+			mgr, err := mtls.NewTLSServerContextManager(lc, al.listener, al.logger)
+			if err != nil {
+				return nil, fmt.Errorf("error updating listener, create tls context manager failed: %v", err)
+			}
+			tlsMng = mgr
+		}
+
 		// update some config, and as Address and Name doesn't change , so need't change *rawl
 		al.updatedLabel = true
+		if tlsMng != nil {
+			al.tlsMng = tlsMng
+		}
 		if !equalConfig {
 			al.disableConnIo = lc.DisableConnIo
 			al.listener.SetConfig(lc)
@@ -165,48 +184,130 @@ func (ch *connHandler) AddOrUpdateListener(lc *v2.Listener, networkFiltersFactor
 		}
 	} else {
 		// listener doesn't exist, add the listener
-		//TODO: connection level stop-chan usage confirm
-		listenerStopChan := make(chan struct{})
-		//use default listener path
-		if lc.LogPath == "" {
-			lc.LogPath = MosnLogBasePath + string(os.PathSeparator) + lc.Name + ".log"
+		var err error
+		if al, err = ch.createListener(lc, networkFiltersFactories, streamFiltersFactories); err != nil {
+			return al, err
 		}
+		ch.listeners = append(ch.listeners, al)
+	}
+	admin.SetListenerConfig(listenerName, *lc)
+	return al, nil
+}
 
-		logger, err := log.NewLogger(lc.LogPath, log.Level(lc.LogLevel))
-		if err != nil {
-			return nil, fmt.Errorf("initialize listener logger failed : %v", err.Error())
+// createListener creates an active listener, which is not started yet
+func (ch *connHandler) createListener(lc *v2.Listener, networkFiltersFactories []types.NetworkFilterChainFactory,
+	streamFiltersFactories []types.StreamFilterChainFactory) (*activeListener, error) {
+	//TODO: connection level stop-chan usage confirm
+	listenerStopChan := make(chan struct{})
+	//use default listener path
+	if lc.LogPath == "" {
+		lc.LogPath = MosnLogBasePath + string(os.PathSeparator) + lc.Name + ".log"
+	}
+
+	logger, err := log.NewLogger(lc.LogPath, log.Level(lc.LogLevel))
+	if err != nil {
+		return nil, fmt.Errorf("initialize listener logger failed : %v", err.Error())
+	}
+
+	//initialize access log
+	var als []types.AccessLog
+
+	for _, alConfig := range lc.AccessLogs {
+
+		//use default listener access log path
+		if alConfig.Path == "" {
+			alConfig.Path = MosnLogBasePath + string(os.PathSeparator) + lc.Name + "_access.log"
 		}
 
-		//initialize access log
-		var als []types.AccessLog
+		if al, err := log.NewAccessLog(alConfig.Path, nil, alConfig.Format); err == nil {
+			als = append(als, al)
+		} else {
+			return nil, fmt.Errorf("initialize listener access logger %s failed: %v", alConfig.Path, err.Error())
+		}
+	}
 
-		for _, alConfig := range lc.AccessLogs {
+	l := network.NewListener(lc, logger)
 
-			//use default listener access log path
-			if alConfig.Path == "" {
-				alConfig.Path = MosnLogBasePath + string(os.PathSeparator) + lc.Name + "_access.log"
-			}
+	al, err := newActiveListener(l, lc, logger, als, networkFiltersFactories, streamFiltersFactories, ch, listenerStopChan)
+	if err != nil {
+		return al, err
+	}
+	l.SetListenerCallbacks(al)
 
-			if al, err := log.NewAccessLog(alConfig.Path, nil, alConfig.Format); err == nil {
-				als = append(als, al)
-			} else {
-				return nil, fmt.Errorf("initialize listener access logger %s failed: %v", alConfig.Path, err.Error())
-			}
+	return al, nil
+}
+
+// replaceListener replaces the listener whose address is changed. The new address is bound first, so that
+// the old listener keeps working if it can't be bound. The new listener is started by the caller on the bound
+// socket, the old one stops accepting and is retired, its established connections are not affected
+func (ch *connHandler) replaceListener(old *activeListener, lc *v2.Listener,
+	networkFiltersFactories []types.NetworkFilterChainFactory,
+	streamFiltersFactories []types.StreamFilterChainFactory) (*activeListener, error) {
+	var rawl *net.TCPListener
+	if lc.BindToPort && lc.InheritListener == nil {
+		addr, ok := lc.Addr.(*net.TCPAddr)
+		if !ok {
+			return nil, fmt.Errorf("error replacing listener %s, unsupported address %s", lc.Name, lc.Addr)
 		}
+		var err error
+		if rawl, err = net.ListenTCP("tcp", addr); err != nil {
+			return nil, fmt.Errorf("error replacing listener %s, listen on %s failed: %v", lc.Name, lc.Addr, err)
+		}
+		// the listener starts on the bound socket, just like the inherited one
+		lc.InheritListener = rawl
+	}
 
-		l := network.NewListener(lc, logger)
+	al, err := ch.createListener(lc, networkFiltersFactories, streamFiltersFactories)
+	if err != nil {
+		if rawl != nil {
+			rawl.Close()
+			lc.InheritListener = nil
+		}
+		return nil, err
+	}
 
-		al, err = newActiveListener(l, lc, logger, als, networkFiltersFactories, streamFiltersFactories, ch, listenerStopChan)
-		if err != nil {
-			return al, err
+	for i, l := range ch.listeners {
+		if l == old {
+			ch.listeners[i] = al
 		}
-		l.SetListenerCallbacks(al)
-		ch.listeners = append(ch.listeners, al)
 	}
-	admin.SetListenerConfig(listenerName, *lc)
+	if err := old.listener.Close(nil); err != nil {
+		log.DefaultLogger.Infof("close the replaced listener %s on %s: %v", lc.Name, old.listener.Addr(), err)
+	}
+	ch.retireListener(old)
+	log.DefaultLogger.Infof("listener %s is moved from %s to %s", lc.Name, old.listener.Addr(), lc.Addr)
+
+	admin.SetListenerConfig(lc.Name, *lc)
 	return al, nil
 }
 
+// retireListener keeps the listener no longer working until its established connections are closed,
+// so that they can still be stopped by StopConnection
+func (ch *connHandler) retireListener(al *activeListener) {
+	al.connsMux.Lock()
+	defer al.connsMux.Unlock()
+
+	al.retired = true
+	if al.conns.Len() > 0 {
+		ch.retiredMux.Lock()
+		ch.retiredListeners = append(ch.retiredListeners, al)
+		ch.retiredMux.Unlock()
+	}
+}
+
+// removeRetiredListener drops the retired listener, called with the connsMux of al held
+func (ch *connHandler) removeRetiredListener(al *activeListener) {
+	ch.retiredMux.Lock()
+	defer ch.retiredMux.Unlock()
+
+	for i, l := range ch.retiredListeners {
+		if l == al {
+			ch.retiredListeners = append(ch.retiredListeners[:i], ch.retiredListeners[i+1:]...)
+			return
+		}
+	}
+}
+
 func (ch *connHandler) StartListener(lctx context.Context, listenerTag uint64) {
 	for _, l := range ch.listeners {
 		if l.listener.ListenerTag() == listenerTag {
@@ -247,6 +348,7 @@ func (ch *connHandler) RemoveListeners(name string) {
 	for i, l := range ch.listeners {
 		if l.listener.Name() == name {
 			ch.listeners = append(ch.listeners[:i], ch.listeners[i+1:]...)
+			ch.retireListener(l)
 		}
 	}
 }
@@ -327,6 +429,13 @@ func (ch *connHandler) StopConnection() {
 	for _, l := range ch.listeners {
 		close(l.stopChan)
 	}
+
+	ch.retiredMux.Lock()
+	for _, l := range ch.retiredListeners {
+		close(l.stopChan)
+	}
+	ch.retiredListeners = nil
+	ch.retiredMux.Unlock()
 }
 
 // ListenerEventListener
@@ -345,6 +454,7 @@ type activeListener struct {
 	logger                  log.Logger
 	accessLogs              []types.AccessLog
 	updatedLabel            bool
+	retired                 bool // replaced or removed, guarded by connsMux
 	tlsMng                  types.TLSContextManager
 }
 
@@ -422,6 +532,11 @@ func (al *activeListener) OnAccept(rawc net.Conn, handOffRestoredDestinationConn
 	ctx = context.WithValue(ctx, types.ContextKeyStreamFilterChainFactories, al.streamFiltersFactories)
 	ctx = context.WithValue(ctx, types.ContextKeyLogger, al.logger)
 	ctx = context.WithValue(ctx, types.ContextKeyAccessLogs, al.accessLogs)
+	if al.listener.Config().StreamingDecode {
+		ctx = context.WithValue(ctx, types.ContextKeyStreamingDecode, true)
+	}
+	// the protocol options of the listener, e.g. the limits and the hooks, are read by the stream connection
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &al.listener.Config().ListenerConfig)
 	if rawf != nil {
 		ctx = context.WithValue(ctx, types.ContextKeyConnectionFd, rawf)
 	}
@@ -438,8 +553,13 @@ func (al *activeListener) OnAccept(rawc net.Conn, handOffRestoredDestinationConn
 
 func (al *activeListener) OnNewConnection(ctx context.Context, conn types.Connection) {
 	//Register Proxy's Filter
+	// use the filter chain the connection is accepted with, the listener may be updated in the meantime
+	networkFiltersFactories := al.networkFiltersFactories
+	if ff, ok := ctx.Value(types.ContextKeyNetworkFilterChainFactories).([]types.NetworkFilterChainFactory); ok {
+		networkFiltersFactories = ff
+	}
 	filterManager := conn.FilterManager()
-	for _, nfcf := range al.networkFiltersFactories {
+	for _, nfcf := range networkFiltersFactories {
 		nfcf.CreateFilterChain(ctx, al.handler.clusterManager, filterManager)
 	}
 	filterManager.InitializeReadFilters()
@@ -454,6 +574,12 @@ func (al *activeListener) OnNewConnection(ctx context.Context, conn types.Connec
 
 	al.connsMux.Lock()
 	e := al.conns.PushBack(ac)
+	if al.retired && al.conns.Len() == 1 {
+		// accepted while the listener is retired
+		al.handler.retiredMux.Lock()
+		al.handler.retiredListeners = append(al.handler.retiredListeners, al)
+		al.handler.retiredMux.Unlock()
+	}
 	al.connsMux.Unlock()
 	ac.element = e
 
@@ -473,6 +599,9 @@ func (al *activeListener) OnClose() {}
 func (al *activeListener) removeConnection(ac *activeConnection) {
 	al.connsMux.Lock()
 	al.conns.Remove(ac.element)
+	if al.retired && al.conns.Len() == 0 {
+		al.handler.removeRetiredListener(al)
+	}
 	al.connsMux.Unlock()
 
 	atomic.AddInt64(&al.handler.numConnections, -1)
@@ -488,6 +617,13 @@ func (al *activeListener) newConnection(ctx context.Context, rawc net.Conn) {
 	newCtx := context.WithValue(ctx, types.ContextKeyConnectionID, conn.ID())
 
 	conn.SetBufferLimit(al.listener.PerConnBufferLimitBytes())
+	if config := al.listener.Config(); config != nil {
+		conn.SetReadBufferSize(config.ReadBufferSize)
+		conn.SetWriteBufferSize(config.WriteBufferSize)
+		if config.WriteBufferHighWatermark > 0 {
+			conn.SetWriteBufferWatermark(config.WriteBufferHighWatermark, config.WriteBufferLowWatermark)
+		}
+	}
 
 	al.OnNewConnection(newCtx, conn)
 }
@@ -0,0 +1,97 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"sync"
+)
+
+// reloadCoordinator coordinates the reload and the shutdown, so that the shutdown never
+// drains with a partially-applied reload:
+// a reload not committed yet is cancelled by the shutdown, a committed one is waited to complete
+type reloadCoordinator struct {
+	mutex     sync.Mutex
+	reloading bool
+	committed bool
+	shutdown  bool
+	cancel    chan struct{}
+	done      chan struct{}
+}
+
+var reloadState = &reloadCoordinator{}
+
+// begin starts a reload, returns false if another reload is in progress or shutting down.
+// the returned channel is closed if the reload is cancelled by the shutdown
+func (c *reloadCoordinator) begin() (<-chan struct{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.reloading || c.shutdown {
+		return nil, false
+	}
+	c.reloading = true
+	c.committed = false
+	c.cancel = make(chan struct{})
+	c.done = make(chan struct{})
+
+	return c.cancel, true
+}
+
+// commit marks the reload past the point of no return, returns false if it is already cancelled
+func (c *reloadCoordinator) commit() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.cancel:
+		return false
+	default:
+	}
+	c.committed = true
+
+	return true
+}
+
+// end finishes the reload, whether it is completed or cancelled
+func (c *reloadCoordinator) end() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.reloading {
+		c.reloading = false
+		close(c.done)
+	}
+}
+
+// beginShutdown rejects the following reloads, cancels the in-flight reload if not committed
+// and waits for it to finish
+func (c *reloadCoordinator) beginShutdown() {
+	c.mutex.Lock()
+	c.shutdown = true
+	if !c.reloading {
+		c.mutex.Unlock()
+		return
+	}
+	if !c.committed {
+		close(c.cancel)
+	}
+	done := c.done
+	c.mutex.Unlock()
+
+	<-done
+}
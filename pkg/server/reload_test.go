@@ -0,0 +1,98 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// mockReload runs as reload does, the config is applied only if the reload is committed
+func mockReload(c *reloadCoordinator, cancel <-chan struct{}, started, committed chan struct{}, applied *bool) {
+	defer c.end()
+	close(started)
+
+	select {
+	case <-cancel:
+	case <-time.After(200 * time.Millisecond):
+	}
+	if !c.commit() {
+		return
+	}
+	close(committed)
+	time.Sleep(50 * time.Millisecond)
+	*applied = true
+}
+
+func TestShutdownCancelsReload(t *testing.T) {
+	c := &reloadCoordinator{}
+	cancel, ok := c.begin()
+	if !ok {
+		t.Fatal("begin reload failed")
+	}
+	if _, ok := c.begin(); ok {
+		t.Fatal("concurrent reload should be rejected")
+	}
+
+	applied := false
+	started := make(chan struct{})
+	go mockReload(c, cancel, started, make(chan struct{}), &applied)
+	<-started
+
+	start := time.Now()
+	c.beginShutdown()
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("shutdown should cancel the reload, waited %v", elapsed)
+	}
+	if applied {
+		t.Error("cancelled reload should not be applied")
+	}
+	if _, ok := c.begin(); ok {
+		t.Error("reload should be rejected after shutdown")
+	}
+}
+
+func TestShutdownWaitsCommittedReload(t *testing.T) {
+	c := &reloadCoordinator{}
+	cancel, _ := c.begin()
+
+	applied := false
+	started, committed := make(chan struct{}), make(chan struct{})
+	go mockReload(c, cancel, started, committed, &applied)
+	<-started
+
+	// shutdown arrives after the reload is committed
+	<-committed
+	c.beginShutdown()
+	if !applied {
+		t.Error("shutdown should wait for the committed reload to complete")
+	}
+
+	// no reload in progress
+	c = &reloadCoordinator{}
+	done := make(chan struct{})
+	go func() {
+		c.beginShutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown without reload should not block")
+	}
+}
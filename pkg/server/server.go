@@ -64,6 +64,9 @@ func NewServer(config *Config, cmFilter types.ClusterManagerFilter, clMng types.
 		if config.GracefulTimeout != 0 {
 			GracefulTimeout = config.GracefulTimeout
 		}
+		if config.ShutdownGracePeriod > 0 {
+			ShutdownGracePeriod = config.ShutdownGracePeriod
+		}
 
 		//processor num setting
 		if config.Processor > 0 {
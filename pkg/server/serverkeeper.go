@@ -26,6 +26,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/admin"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/stats"
 	"github.com/alipay/sofa-mosn/pkg/types"
@@ -75,6 +76,8 @@ func catchSignalsCrossPlatform() {
 				}
 				os.Exit(0)
 			case syscall.SIGTERM:
+				// wait for or cancel the in-flight reload before draining
+				reloadState.beginShutdown()
 				// stop to quit
 				exitCode := executeShutdownCallbacks("SIGTERM")
 				for _, f := range onProcessExit {
@@ -87,10 +90,8 @@ func catchSignalsCrossPlatform() {
 				// reopen
 				log.Reopen()
 			case syscall.SIGHUP:
-				// stop stoppable before reload
-				stopStoppable()
-				// reload
-				reconfigure()
+				// reload in a new goroutine, so that a SIGTERM during the reload can be handled
+				go reload()
 			case syscall.SIGUSR2:
 				// ignore
 			}
@@ -119,6 +120,7 @@ func catchSignalsPosix() {
 			}
 
 			go func() {
+				reloadState.beginShutdown()
 				os.Exit(executeShutdownCallbacks("SIGINT"))
 			}()
 		}
@@ -127,10 +129,12 @@ func catchSignalsPosix() {
 
 func executeShutdownCallbacks(signame string) (exitCode int) {
 	shutdownCallbacksOnce.Do(func() {
-		var errs []error
+		errs := orderedShutdown(ShutdownGracePeriod)
 
 		for _, cb := range shutdownCallbacks {
-			errs = append(errs, cb())
+			if err := cb(); err != nil {
+				errs = append(errs, err)
+			}
 		}
 
 		if len(errs) > 0 {
@@ -148,7 +152,20 @@ func OnProcessShutDown(cb func() error) {
 	shutdownCallbacks = append(shutdownCallbacks, cb)
 }
 
-func reconfigure() {
+func reload() {
+	cancel, ok := reloadState.begin()
+	if !ok {
+		log.DefaultLogger.Errorf("SIGHUP received: reload is in progress or shutting down, ignore")
+		return
+	}
+	defer reloadState.end()
+
+	// stop stoppable before reload
+	stopStoppable()
+	reconfigure(cancel)
+}
+
+func reconfigure(cancel <-chan struct{}) {
 	// Get socket file descriptor to pass it to fork
 	listenerFD := ListListenerFD()
 	if len(listenerFD) == 0 {
@@ -156,6 +173,13 @@ func reconfigure() {
 		return
 	}
 
+	select {
+	case <-cancel:
+		log.DefaultLogger.Infof("reload is cancelled by shutdown before fork")
+		return
+	default:
+	}
+
 	// Set a flag for the new process start process
 	os.Setenv(types.GracefulRestart, "true")
 	os.Setenv(types.InheritFd, strconv.Itoa(len(listenerFD)))
@@ -174,12 +198,25 @@ func reconfigure() {
 
 	log.DefaultLogger.Infof("SIGHUP received: fork-exec to %d", fork)
 
-	// Wait for new mosn start
-	time.Sleep(3 * time.Second)
+	// Wait for new mosn start, the new mosn is stopped if shutdown arrives in the meantime
+	select {
+	case <-cancel:
+	case <-time.After(3 * time.Second):
+	}
+	if !reloadState.commit() {
+		log.DefaultLogger.Infof("reload is cancelled by shutdown, stop the new mosn %d", fork)
+		syscall.Kill(fork, syscall.SIGTERM)
+		os.Unsetenv(types.GracefulRestart)
+		os.Unsetenv(types.InheritFd)
+		return
+	}
 
 	// Stop accepting requests
 	StopAccept()
 
+	// Reject new requests on the existing connections, so that clients reconnect to the new mosn
+	admin.Drain()
+
 	// Wait for all connections to be finished
 	WaitConnectionsDone(GracefulTimeout)
 	// Transfer metrcis data, non-block
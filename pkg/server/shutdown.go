@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/admin"
+	"github.com/alipay/sofa-mosn/pkg/log"
+)
+
+// ShutdownStage is a step of the ordered shutdown, the stages are run in the declared order.
+// The downstream listeners stop accepting and the connections are drained between
+// ShutdownDeregister and ShutdownCloseUpstream
+type ShutdownStage int
+
+const (
+	// ShutdownDeregister deregisters the instance from the registry, so that no new traffic is directed here
+	ShutdownDeregister ShutdownStage = iota
+	// ShutdownCloseUpstream closes the upstream connections once the in-flight streams finish
+	ShutdownCloseUpstream
+	// ShutdownCloseRegistry closes the registry client, e.g. the zookeeper client
+	ShutdownCloseRegistry
+)
+
+// ShutdownGracePeriod bounds the wait for the in-flight streams of the drained connections on shutdown
+var ShutdownGracePeriod = 30 * time.Second
+
+var (
+	shutdownStagesMux sync.Mutex
+	shutdownStages    = make(map[ShutdownStage][]func() error)
+)
+
+// OnShutdownStage registers the callback run at the stage of the ordered shutdown on SIGTERM or SIGINT,
+// the callbacks of a stage are run in the registered order
+func OnShutdownStage(stage ShutdownStage, cb func() error) {
+	shutdownStagesMux.Lock()
+	defer shutdownStagesMux.Unlock()
+
+	shutdownStages[stage] = append(shutdownStages[stage], cb)
+}
+
+func runShutdownStage(stage ShutdownStage) (errs []error) {
+	shutdownStagesMux.Lock()
+	cbs := shutdownStages[stage]
+	shutdownStagesMux.Unlock()
+
+	for _, cb := range cbs {
+		if err := cb(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// orderedShutdown deregisters the instance, stops accepting and drains the downstream connections,
+// waits for the in-flight streams up to the grace period, then closes the upstream connections
+// and the registry client, so that no in-flight request loses its upstream
+func orderedShutdown(gracePeriod time.Duration) []error {
+	errs := runShutdownStage(ShutdownDeregister)
+
+	StopAccept()
+	admin.Drain()
+	if !waitConnectionsDrained(gracePeriod) {
+		log.DefaultLogger.Warnf("shutdown: downstream connections are not drained in %v", gracePeriod)
+	}
+
+	errs = append(errs, runShutdownStage(ShutdownCloseUpstream)...)
+	errs = append(errs, runShutdownStage(ShutdownCloseRegistry)...)
+	return errs
+}
+
+// waitConnectionsDrained waits for the downstream connections closed, a drained connection is closed
+// once its in-flight streams finish. It returns false if some are left after the timeout
+func waitConnectionsDrained(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		var num uint64
+		for _, server := range servers {
+			num += server.handler.NumConnections()
+		}
+		if num == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
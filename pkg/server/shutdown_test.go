@@ -0,0 +1,59 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/admin"
+)
+
+func TestOrderedShutdown(t *testing.T) {
+	var steps []string
+	step := func(name string, err error) func() error {
+		return func() error {
+			steps = append(steps, name)
+			return err
+		}
+	}
+	defer func(stages map[ShutdownStage][]func() error) {
+		shutdownStages = stages
+	}(shutdownStages)
+	shutdownStages = make(map[ShutdownStage][]func() error)
+
+	// registered out of order
+	OnShutdownStage(ShutdownCloseRegistry, step("close registry", nil))
+	OnShutdownStage(ShutdownCloseUpstream, step("close upstream", errors.New("close upstream failed")))
+	OnShutdownStage(ShutdownDeregister, step("deregister", nil))
+	OnShutdownStage(ShutdownDeregister, step("deregister again", nil))
+	admin.AddDrainer(func() {
+		steps = append(steps, "drain")
+	})
+
+	errs := orderedShutdown(time.Second)
+	expected := []string{"deregister", "deregister again", "drain", "close upstream", "close registry"}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("expect shutdown steps %v, got %v", expected, steps)
+	}
+	if len(errs) != 1 || errs[0].Error() != "close upstream failed" {
+		t.Errorf("expect the error of the failed step, got %v", errs)
+	}
+}
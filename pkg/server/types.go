@@ -44,6 +44,8 @@ type Config struct {
 	GracefulTimeout time.Duration
 	Processor       int
 	UseNetpollMode  bool
+	// bounds the wait for the in-flight streams on shutdown, zero means 30s
+	ShutdownGracePeriod time.Duration
 }
 
 type Server interface {
@@ -39,6 +39,19 @@ const (
 	DownstreamRequestActive      = "downstream_request_active"
 	DownstreamRequestReset       = "downstream_request_reset"
 	DownstreamRequestTime        = "downstream_request_time"
+
+	// concurrent streams of a single connection, sofarpc only
+	DownstreamConnectionStreams          = "downstream_connection_streams"
+	DownstreamConnectionStreamOverflow   = "downstream_connection_stream_overflow"
+	DownstreamConnectionIdleTimeout      = "downstream_connection_idle_timeout"
+	DownstreamConnectionFrameRateLimited = "downstream_connection_frame_rate_limited"
+	DownstreamLifecycleEventsDropped     = "downstream_lifecycle_events_dropped"
+	DownstreamProtocolFallback           = "downstream_protocol_fallback"   // connections not detected in the fallback protocol
+	DownstreamProtocolUndetected         = "downstream_protocol_undetected" // connections closed for no protocol detected
+
+	// flow control of the downstream write buffer
+	DownstreamFlowControlPausedReading  = "downstream_flow_control_paused_reading_total"
+	DownstreamFlowControlResumedReading = "downstream_flow_control_resumed_reading_total"
 )
 
 // NewProxyStats returns a stats with namespace prefix proxy
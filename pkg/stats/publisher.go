@@ -0,0 +1,184 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/log"
+)
+
+// DefaultPublishInterval is the default interval of publishing the cluster stats to the registry
+const DefaultPublishInterval = 30 * time.Second
+
+// registryPublisher writes the stats to the registry, nil if no registry client registered
+var registryPublisher func(path string, data []byte) error
+
+// SetRegistryPublisher sets the write of the cluster stats into the registry (zk, etcd, etc.), it should
+// create or update the ephemeral node path with the data. It should be called during initialization
+func SetRegistryPublisher(f func(path string, data []byte) error) {
+	registryPublisher = f
+}
+
+// ClusterStatsData is the published stats of a cluster
+type ClusterStatsData struct {
+	QPS       float64       `json:"qps"`
+	ErrorRate float64       `json:"error_rate"`
+	Metrics   NamespaceData `json:"metrics"`
+}
+
+const clusterNamespacePrefix = "cluster."
+
+// Publisher publishes per-cluster stats to the registry periodically.
+// Publishing is best-effort: a slow or failed registry write never blocks the caller,
+// ticks arriving while the previous write is still running are skipped
+type Publisher struct {
+	publisher func(path string, data []byte) error
+	path      string
+	interval  time.Duration
+
+	publishing int32
+	stopOnce   sync.Once
+	stopChan   chan struct{}
+
+	// request total and error total of last publish, used to calculate qps and error rate
+	last     map[string][2]int64
+	lastTime time.Time
+}
+
+// NewPublisher creates a publisher writes stats into the ephemeral node path every interval by publisher
+func NewPublisher(publisher func(path string, data []byte) error, path string, interval time.Duration) *Publisher {
+	if interval <= 0 {
+		interval = DefaultPublishInterval
+	}
+
+	return &Publisher{
+		publisher: publisher,
+		path:      path,
+		interval:  interval,
+		stopChan:  make(chan struct{}),
+		last:      make(map[string][2]int64),
+	}
+}
+
+// NewRegistryPublisher creates a publisher by the registry publisher set by SetRegistryPublisher,
+// nil if it is not set or path is empty
+func NewRegistryPublisher(path string, interval time.Duration) *Publisher {
+	if registryPublisher == nil || path == "" {
+		return nil
+	}
+
+	return NewPublisher(registryPublisher, path, interval)
+}
+
+// Start starts the publish loop in a new goroutine
+func (p *Publisher) Start() {
+	p.lastTime = time.Now()
+	p.snapshot(p.lastTime)
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stopChan:
+				return
+			case now := <-ticker.C:
+				p.publish(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the publish loop
+func (p *Publisher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+}
+
+func (p *Publisher) publish(now time.Time) {
+	// previous write is still running, skip
+	if !atomic.CompareAndSwapInt32(&p.publishing, 0, 1) {
+		log.DefaultLogger.Warnf("stats publish to %s is still running, skip", p.path)
+		return
+	}
+
+	data, err := json.Marshal(p.snapshot(now))
+	if err != nil {
+		atomic.StoreInt32(&p.publishing, 0)
+		log.DefaultLogger.Errorf("marshal cluster stats failed: %v", err)
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.DefaultLogger.Errorf("panic %v in stats publish", r)
+			}
+			atomic.StoreInt32(&p.publishing, 0)
+		}()
+
+		if err := p.publisher(p.path, data); err != nil {
+			log.DefaultLogger.Warnf("publish cluster stats to %s failed: %v", p.path, err)
+		}
+	}()
+}
+
+// snapshot collects the cluster stats, qps and error rate are calculated since the last snapshot
+func (p *Publisher) snapshot(now time.Time) map[string]ClusterStatsData {
+	seconds := now.Sub(p.lastTime).Seconds()
+	p.lastTime = now
+
+	res := make(map[string]ClusterStatsData)
+	for namespace, data := range GetMetricsData(UpstreamType) {
+		// host stats are ignored
+		if !strings.HasPrefix(namespace, clusterNamespacePrefix) || strings.Contains(namespace, ".host.") {
+			continue
+		}
+		cluster := strings.TrimPrefix(namespace, clusterNamespacePrefix)
+
+		total := parseCount(data[UpstreamRequestTotal])
+		errors := parseCount(data[UpstreamRequestLocalReset]) + parseCount(data[UpstreamRequestRemoteReset]) +
+			parseCount(data[UpstreamRequestTimeout])
+
+		stat := ClusterStatsData{
+			Metrics: data,
+		}
+		if last, ok := p.last[cluster]; ok && seconds > 0 {
+			if reqs := total - last[0]; reqs > 0 {
+				stat.QPS = float64(reqs) / seconds
+				stat.ErrorRate = float64(errors-last[1]) / float64(reqs)
+			}
+		}
+		p.last[cluster] = [2]int64{total, errors}
+		res[cluster] = stat
+	}
+
+	return res
+}
+
+func parseCount(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
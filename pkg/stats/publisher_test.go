@@ -0,0 +1,147 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type publishedData struct {
+	path string
+	data []byte
+}
+
+type mockStatsRegistry struct {
+	published chan publishedData
+}
+
+func (r *mockStatsRegistry) PublishEphemeral(path string, data []byte) error {
+	r.published <- publishedData{path, data}
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	testClear()
+	NewClusterStats("c1").Counter(UpstreamRequestTotal).Inc(1)
+	NewHostStats("c1", "127.0.0.1:8080").Counter(UpstreamRequestTotal).Inc(1)
+
+	registry := &mockStatsRegistry{published: make(chan publishedData, 4)}
+	interval := 100 * time.Millisecond
+	SetRegistryPublisher(registry.PublishEphemeral)
+	defer SetRegistryPublisher(nil)
+	p := NewRegistryPublisher("/mosn/stats/host1", interval)
+	p.Start()
+	defer p.Stop()
+
+	// 10 requests with 2 errors during the first interval
+	NewClusterStats("c1").Counter(UpstreamRequestTotal).Inc(10)
+	NewClusterStats("c1").Counter(UpstreamRequestTimeout).Inc(2)
+
+	start := time.Now()
+	select {
+	case published := <-registry.published:
+		if elapsed := time.Since(start); elapsed < interval/2 {
+			t.Errorf("published too early: %v", elapsed)
+		}
+		if published.path != "/mosn/stats/host1" {
+			t.Errorf("unexpected publish path: %s", published.path)
+		}
+
+		res := map[string]ClusterStatsData{}
+		if err := json.Unmarshal(published.data, &res); err != nil {
+			t.Fatalf("unmarshal published data failed: %v", err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("expect only cluster stats, got %v", res)
+		}
+		stat, ok := res["c1"]
+		if !ok {
+			t.Fatalf("no stats of cluster c1: %v", res)
+		}
+		if stat.QPS <= 0 || stat.ErrorRate != 0.2 {
+			t.Errorf("unexpected qps %f, error rate %f", stat.QPS, stat.ErrorRate)
+		}
+		if stat.Metrics[UpstreamRequestTotal] != "11" {
+			t.Errorf("unexpected metrics: %v", stat.Metrics)
+		}
+	case <-time.After(3 * interval):
+		t.Fatal("no stats published")
+	}
+
+	// keep publishing on interval
+	select {
+	case <-registry.published:
+	case <-time.After(3 * interval):
+		t.Fatal("no stats published on the second interval")
+	}
+}
+
+type blockingStatsRegistry struct {
+	calls int32
+	block chan struct{}
+}
+
+func (r *blockingStatsRegistry) PublishEphemeral(path string, data []byte) error {
+	atomic.AddInt32(&r.calls, 1)
+	<-r.block
+	return nil
+}
+
+func TestPublisherNonBlocking(t *testing.T) {
+	testClear()
+	registry := &blockingStatsRegistry{block: make(chan struct{})}
+	p := NewPublisher(registry.PublishEphemeral, "/mosn/stats/host1", time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		p.publish(time.Now())
+		p.publish(time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by the registry")
+	}
+
+	close(registry.block)
+	time.Sleep(10 * time.Millisecond)
+	if calls := atomic.LoadInt32(&registry.calls); calls != 1 {
+		t.Errorf("expect the second publish skipped, got %d calls", calls)
+	}
+}
+
+func TestNewRegistryPublisher(t *testing.T) {
+	if p := NewRegistryPublisher("/mosn/stats/host1", time.Second); p != nil {
+		t.Error("expect no publisher without the registry publisher")
+	}
+
+	registry := &mockStatsRegistry{published: make(chan publishedData, 1)}
+	SetRegistryPublisher(registry.PublishEphemeral)
+	defer SetRegistryPublisher(nil)
+	if p := NewRegistryPublisher("", time.Second); p != nil {
+		t.Error("expect no publisher without the path")
+	}
+	p := NewRegistryPublisher("/mosn/stats/host1", 0)
+	if p == nil || p.interval != DefaultPublishInterval {
+		t.Fatalf("expect a publisher with the default interval, got %+v", p)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"fmt"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// RouterType represents router metrics type
+const RouterType = "router"
+
+// metrics key in route's cluster
+const (
+	RouterClusterSelected = "router_cluster_selected"
+)
+
+// NewRouteClusterStats returns a stats that namespace contains route and the cluster selected by the route,
+// used to validate how the traffic of a route is split into clusters
+func NewRouteClusterStats(routeName string, clusterName string) types.Metrics {
+	namespace := fmt.Sprintf("route.%s.cluster.%s", routeName, clusterName)
+	return NewStats(RouterType, namespace)
+}
@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// RuntimeType represents process runtime metrics type
+const RuntimeType = "runtime"
+
+// metrics key in runtime
+const (
+	RuntimeGoroutineCount = "goroutine_count"
+	RuntimeOpenFDCount    = "open_fd_count"
+	RuntimeHeapAlloc      = "heap_alloc"
+)
+
+// DefaultRuntimeSampleInterval is the default interval of runtime metrics sampling
+const DefaultRuntimeSampleInterval = 15 * time.Second
+
+// fdDir lists the open file descriptors of current process, linux only
+const fdDir = "/proc/self/fd"
+
+// NewRuntimeStats returns a stats with namespace process
+func NewRuntimeStats() types.Metrics {
+	return NewStats(RuntimeType, "process")
+}
+
+// RuntimeSampler samples goroutine count, open fd count and heap size periodically for leak detection.
+// runtime.ReadMemStats stops the world, so the interval should not be too small
+type RuntimeSampler struct {
+	stats    types.Metrics
+	interval time.Duration
+
+	stopOnce sync.Once
+	stopChan chan struct{}
+}
+
+// NewRuntimeSampler creates a sampler updates the runtime gauges every interval
+func NewRuntimeSampler(interval time.Duration) *RuntimeSampler {
+	if interval <= 0 {
+		interval = DefaultRuntimeSampleInterval
+	}
+
+	return &RuntimeSampler{
+		stats:    NewRuntimeStats(),
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start samples once and starts the sample loop in a new goroutine
+func (s *RuntimeSampler) Start() {
+	s.sample()
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopChan:
+				return
+			case <-ticker.C:
+				s.sample()
+			}
+		}
+	}()
+}
+
+// Stop stops the sample loop
+func (s *RuntimeSampler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+}
+
+func (s *RuntimeSampler) sample() {
+	s.stats.Gauge(RuntimeGoroutineCount).Update(int64(runtime.NumGoroutine()))
+
+	// not supported on non-linux platform, keep it as 0
+	if fds, err := ioutil.ReadDir(fdDir); err == nil {
+		s.stats.Gauge(RuntimeOpenFDCount).Update(int64(len(fds)))
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s.stats.Gauge(RuntimeHeapAlloc).Update(int64(m.HeapAlloc))
+}
@@ -0,0 +1,58 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRuntimeSampler(t *testing.T) {
+	testClear()
+	s := NewRuntimeSampler(time.Hour)
+	s.Start()
+	defer s.Stop()
+
+	data := GetMetricsData(RuntimeType)["process"]
+	if data == nil {
+		t.Fatal("no runtime metrics")
+	}
+	value := func(key string) int64 {
+		v, err := strconv.ParseInt(data[key], 10, 64)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", key, err)
+		}
+		return v
+	}
+
+	if v := value(RuntimeGoroutineCount); v < 1 || v > int64(runtime.NumGoroutine())+100 {
+		t.Errorf("unexpected goroutine count %d", v)
+	}
+	if v := value(RuntimeHeapAlloc); v <= 0 {
+		t.Errorf("unexpected heap alloc %d", v)
+	}
+	if _, err := os.Stat(fdDir); err == nil {
+		// stdin, stdout and stderr at least
+		if v := value(RuntimeOpenFDCount); v < 3 {
+			t.Errorf("unexpected open fd count %d", v)
+		}
+	}
+}
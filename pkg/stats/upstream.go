@@ -32,12 +32,15 @@ const (
 	UpstreamConnectionClose                        = "upstream_connection_close"
 	UpstreamConnectionActive                       = "upstream_connection_active"
 	UpstreamConnectionConFail                      = "upstream_connection_con_fail"
+	UpstreamConnectionConTimeout                   = "upstream_connection_con_timeout"
 	UpstreamConnectionRetry                        = "upstream_connection_retry"
 	UpstreamConnectionLocalClose                   = "upstream_connection_local_close"
 	UpstreamConnectionRemoteClose                  = "upstream_connection_remote_close"
 	UpstreamConnectionLocalCloseWithActiveRequest  = "upstream_connection_local_close_with_active_request"
 	UpstreamConnectionRemoteCloseWithActiveRequest = "upstream_connection_remote_close_with_active_request"
 	UpstreamConnectionCloseNotify                  = "upstream_connection_close_notify"
+	UpstreamConnectionIdle                         = "upstream_connection_idle"
+	UpstreamConnectionRecycle                      = "upstream_connection_recycle"
 	UpstreamRequestTotal                           = "upstream_request_request_total"
 	UpstreamRequestActive                          = "upstream_request_request_active"
 	UpstreamRequestLocalReset                      = "upstream_request_request_local_reset"
@@ -59,6 +62,23 @@ const (
 	UpstreamBytesReadBuffered    = "upstream_connection_bytes_read_buffered"
 	UpstreamBytesWriteTotal      = "upstream_connection_bytes_write"
 	UpstreamBytesWriteBuffered   = "upstream_connection_bytes_write_buffered"
+	UpstreamSeedHostsActive      = "upstream_seed_hosts_active" // 1 if the cluster is running on the seed hosts
+	UpstreamSeedHostsFallback    = "upstream_seed_hosts_fallback"
+	UpstreamHostsEmpty           = "upstream_hosts_empty" // 1 if the discovery found no hosts for the cluster
+	UpstreamHostsEmptyTotal      = "upstream_hosts_empty_total"
+	UpstreamRequestLocalZone     = "upstream_request_local_zone" // hosts chosen by the locality load balancer
+	UpstreamRequestCrossZone     = "upstream_request_cross_zone"
+)
+
+// key of the outlier detection in cluster
+const (
+	UpstreamOutlierEjectedActive           = "upstream_outlier_ejected_active" // hosts ejected now
+	UpstreamOutlierEjectionsTotal          = "upstream_outlier_ejections_total"
+	UpstreamOutlierEjections5xx            = "upstream_outlier_ejections_consecutive_5xx"
+	UpstreamOutlierEjectionsTimeout        = "upstream_outlier_ejections_consecutive_timeout"
+	UpstreamOutlierEjectionsConnectFailure = "upstream_outlier_ejections_connect_failure"
+	UpstreamOutlierEjectionsManual         = "upstream_outlier_ejections_manual"
+	UpstreamOutlierEjectionsSuppressed     = "upstream_outlier_ejections_suppressed" // by the manual include
 )
 
 // NewHostStats returns a stats that namespace contains cluster and host address
@@ -72,7 +72,7 @@ func (p *connPool) NewStream(ctx context.Context, receiver types.StreamReceiveLi
 	c, reason := p.getAvailableClient(ctx)
 
 	if c == nil {
-		listener.OnFailure(reason, nil)
+		listener.OnFailure(reason, p.host)
 		return
 	}
 
@@ -156,8 +156,8 @@ func (p *connPool) onConnectionEvent(client *activeClient, event types.Connectio
 			}
 		}
 	} else if event == types.ConnectTimeout {
-		p.host.HostStats().UpstreamRequestTimeout.Inc(1)
-		p.host.ClusterInfo().Stats().UpstreamRequestTimeout.Inc(1)
+		p.host.HostStats().UpstreamConnectionConTimeout.Inc(1)
+		p.host.ClusterInfo().Stats().UpstreamConnectionConTimeout.Inc(1)
 		client.client.Close()
 	} else if event == types.ConnectFailed {
 		p.host.HostStats().UpstreamConnectionConFail.Inc(1)
@@ -66,7 +66,7 @@ func (p *connPool) NewStream(ctx context.Context,
 
 	activeClient := p.activeClient
 	if activeClient == nil {
-		listener.OnFailure(types.ConnectionFailure, nil)
+		listener.OnFailure(types.ConnectionFailure, p.host)
 		return
 	}
 
@@ -110,8 +110,8 @@ func (p *connPool) onConnectionEvent(client *activeClient, event types.Connectio
 		}
 		p.activeClient = nil
 	} else if event == types.ConnectTimeout {
-		p.host.HostStats().UpstreamRequestTimeout.Inc(1)
-		p.host.ClusterInfo().Stats().UpstreamRequestTimeout.Inc(1)
+		p.host.HostStats().UpstreamConnectionConTimeout.Inc(1)
+		p.host.ClusterInfo().Stats().UpstreamConnectionConTimeout.Inc(1)
 		client.client.Close()
 		p.activeClient = nil
 	} else if event == types.ConnectFailed {
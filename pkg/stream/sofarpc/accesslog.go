@@ -0,0 +1,217 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// access log format variables
+const (
+	AccessLogStartTime      = "%start_time%"
+	AccessLogRequestID      = "%request_id%"
+	AccessLogService        = "%service%"
+	AccessLogMethod         = "%method%"
+	AccessLogUpstreamHost   = "%upstream_host%"
+	AccessLogStatusCode     = "%status_code%"     // internal status code, see types.SuccessCode
+	AccessLogResponseStatus = "%response_status%" // response status on the wire
+	AccessLogDuration       = "%duration%"
+
+	DefaultAccessLogFormat = "%start_time% %request_id% %service% %method% %upstream_host% %status_code% %response_status% %duration%"
+)
+
+// accessLogEmpty is written for the values not available, e.g. the upstream host of a hijacked request
+const accessLogEmpty = "-"
+
+var accessLogGetters = map[string]func(s *stream) string{
+	AccessLogStartTime: func(s *stream) string {
+		return s.access.startTime.Format("2006-01-02 15:04:05.999")
+	},
+	AccessLogRequestID: func(s *stream) string {
+		return strconv.FormatUint(s.id, 10)
+	},
+	AccessLogService: func(s *stream) string {
+		return s.access.service
+	},
+	AccessLogMethod: func(s *stream) string {
+		return s.access.method
+	},
+	AccessLogUpstreamHost: func(s *stream) string {
+		return s.access.upstreamHost
+	},
+	AccessLogStatusCode: func(s *stream) string {
+		return s.access.statusCode
+	},
+	AccessLogResponseStatus: func(s *stream) string {
+		if resp, ok := s.sendCmd.(rpc.RespStatus); ok {
+			return strconv.FormatUint(uint64(resp.RespStatus()), 10)
+		}
+		return ""
+	},
+	AccessLogDuration: func(s *stream) string {
+		return time.Since(s.access.startTime).String()
+	},
+}
+
+// accessLogs are the access logs of the listeners by the listener name, built by the first connection
+var accessLogs = struct {
+	sync.Mutex
+	logs map[string]*accessLog
+}{logs: make(map[string]*accessLog)}
+
+// getAccessLog returns the access log of the sofarpc server streams of the listener, one line is written for
+// each stream on completion. The format is a template with the variables like AccessLogService,
+// DefaultAccessLogFormat is used if empty. The log is rebuilt if the config of the listener is updated
+func getAccessLog(listenerName string, config *v2.AccessLog) (*accessLog, error) {
+	accessLogs.Lock()
+	defer accessLogs.Unlock()
+
+	if l, ok := accessLogs.logs[listenerName]; ok && l.config == config {
+		return l, nil
+	}
+
+	logger, err := log.GetLoggerInstance(config.Path, 0)
+	if err != nil {
+		return nil, err
+	}
+	format := config.Format
+	if format == "" {
+		format = DefaultAccessLogFormat
+	}
+	l := &accessLog{
+		config:     config,
+		logger:     logger,
+		formatters: parseAccessLogFormat(format),
+	}
+	accessLogs.logs[listenerName] = l
+	return l, nil
+}
+
+type accessLog struct {
+	config     *v2.AccessLog
+	logger     log.Logger
+	formatters []func(s *stream) string
+}
+
+func (l *accessLog) log(s *stream) {
+	var b strings.Builder
+	for _, f := range l.formatters {
+		if v := f(s); v != "" {
+			b.WriteString(v)
+		} else {
+			b.WriteString(accessLogEmpty)
+		}
+	}
+	l.logger.Println(b.String())
+}
+
+// parseAccessLogFormat splits the format into the literals and the variables
+func parseAccessLogFormat(format string) []func(s *stream) string {
+	var formatters []func(s *stream) string
+	literal := func(text string) {
+		formatters = append(formatters, func(s *stream) string {
+			return text
+		})
+	}
+
+	for len(format) > 0 {
+		start := strings.IndexByte(format, '%')
+		end := -1
+		if start >= 0 {
+			end = strings.IndexByte(format[start+1:], '%')
+		}
+		if end < 0 {
+			literal(format)
+			break
+		}
+		end += start + 2
+
+		if getter, ok := accessLogGetters[format[start:end]]; ok {
+			if start > 0 {
+				literal(format[:start])
+			}
+			formatters = append(formatters, getter)
+			format = format[end:]
+		} else {
+			// not a variable, the closing '%' may start the next one
+			literal(format[:end-1])
+			format = format[end-1:]
+		}
+	}
+
+	return formatters
+}
+
+// accessLogInfo is the request data of the server stream recorded for the access log
+type accessLogInfo struct {
+	startTime    time.Time
+	service      string
+	method       string
+	upstreamHost string
+	statusCode   string
+}
+
+// onRequest records the request of the server stream, also for the status of the lifecycle hooks
+func (s *stream) onRequest(cmd sofarpc.SofaRpcCmd) {
+	if s.sc.accessLog == nil && s.sc.hooks == nil {
+		return
+	}
+
+	s.access = accessLogInfo{startTime: time.Now()}
+	if cmd.Header() != nil {
+		s.access.service, _ = cmd.Get(models.SERVICE_KEY)
+		s.access.method, _ = cmd.Get(models.TARGET_METHOD)
+	}
+}
+
+// onResponse records the result of the server stream, the request info is set in the context by the proxy
+func (s *stream) onResponse(ctx context.Context, cmd sofarpc.SofaRpcCmd) {
+	if s.sc.accessLog == nil && s.sc.hooks == nil {
+		return
+	}
+
+	info, _ := ctx.Value(types.ContextKeyRequestInfo).(types.RequestInfo)
+	if info != nil && info.UpstreamHost() != nil {
+		s.access.upstreamHost = info.UpstreamHost().AddressString()
+	}
+
+	// hijacked by the proxy
+	if status, ok := cmd.Get(types.HeaderStatus); ok && cmd.CommandType() != sofarpc.RESPONSE {
+		s.access.statusCode = status
+	} else if info != nil {
+		s.access.statusCode = strconv.FormatUint(uint64(info.ResponseCode()), 10)
+	}
+}
+
+// logAccess writes the access log once the server stream is done, including the reset ones
+func (s *stream) logAccess() {
+	if l := s.sc.accessLog; l != nil && !s.access.startTime.IsZero() {
+		l.log(s)
+	}
+}
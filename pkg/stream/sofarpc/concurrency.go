@@ -0,0 +1,96 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// concurrencyStats is the listener level stats of the server connection concurrency
+type concurrencyStats struct {
+	streams  metrics.Histogram // active streams of the connection, sampled on new stream
+	overflow metrics.Counter
+}
+
+func newConcurrencyStats(listenerName string) *concurrencyStats {
+	s := stats.NewListenerStats(listenerName)
+	return &concurrencyStats{
+		streams:  s.Histogram(stats.DownstreamConnectionStreams),
+		overflow: s.Counter(stats.DownstreamConnectionStreamOverflow),
+	}
+}
+
+// maxConcurrentStreams returns the max concurrent server streams of a single downstream connection configured
+// by the listener, requests exceeding the limit are rejected with RESPONSE_STATUS_SERVER_THREADPOOL_BUSY until
+// the in-flight streams complete. Zero means no limit
+func maxConcurrentStreams(config *v2.ListenerConfig) int32 {
+	max := config.MaxConcurrentStreams
+	if max > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(max)
+}
+
+// acquireServerStream increases the active server streams, returns false if the limit is exceeded
+func (conn *streamConnection) acquireServerStream() bool {
+	active := atomic.AddInt32(&conn.activeServerStreams, 1)
+	if conn.maxConcurrentStreams > 0 && active > conn.maxConcurrentStreams {
+		atomic.AddInt32(&conn.activeServerStreams, -1)
+		if conn.concurrencyStats != nil {
+			conn.concurrencyStats.overflow.Inc(1)
+		}
+		return false
+	}
+
+	if conn.concurrencyStats != nil {
+		conn.concurrencyStats.streams.Update(int64(active))
+	}
+	atomic.AddInt64(&activeServerStreams, 1)
+	return true
+}
+
+// releaseServerStream decreases the active server streams, returns the active streams left
+func (conn *streamConnection) releaseServerStream() int32 {
+	// the counter is cleared on connection close
+	if atomic.LoadInt32(&conn.closed) == 1 {
+		return 0
+	}
+	active := atomic.AddInt32(&conn.activeServerStreams, -1)
+	// negative if cleared by the close in the meantime, which has taken the stream off already
+	if active >= 0 {
+		atomic.AddInt64(&activeServerStreams, -1)
+	}
+	return active
+}
+
+// rejectOverflow answers the request exceeding the concurrency limit without passing it to the proxy
+func (conn *streamConnection) rejectOverflow(s *stream, cmd sofarpc.SofaRpcCmd) {
+	conn.logger.Debugf("connection concurrency exceeds %d, reject stream %d", conn.maxConcurrentStreams, s.id)
+
+	if cmd.CommandType() != sofarpc.REQUEST_ONEWAY {
+		s.sendCmd = conn.hijackReasons.response(cmd, types.ConnectionOverflowCode)
+		s.endStream()
+	}
+}
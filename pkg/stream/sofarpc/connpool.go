@@ -21,7 +21,9 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/protocol"
 	"github.com/alipay/sofa-mosn/pkg/proxy"
 	str "github.com/alipay/sofa-mosn/pkg/stream"
@@ -37,6 +39,8 @@ func init() {
 // types.ConnectionPool
 // activeClient used as connected client
 // host is the upstream
+// The pool is chosen after the host is chosen by the load balancer for each request,
+// so the requests after recycling a connection are balanced again
 type connPool struct {
 	activeClient *activeClient
 	host         types.Host
@@ -58,19 +62,30 @@ func (p *connPool) Protocol() types.Protocol {
 func (p *connPool) NewStream(ctx context.Context,
 	responseDecoder types.StreamReceiveListener, listener types.PoolEventListener) {
 	p.mux.Lock()
-	if p.activeClient == nil {
+	recycled := p.recycleExpired()
+	// the host failing to connect is not connected again until the backoff elapses
+	if p.activeClient == nil && !p.host.ContainHealthFlag(types.CONNECT_BACKOFF) {
 		p.activeClient = newActiveClient(ctx, p)
 	}
-
+	activeClient := p.activeClient
+	if activeClient != nil {
+		// counted under the lock, so that the idle timeout never closes a client chosen here
+		activeClient.onStreamStart()
+	}
 	p.mux.Unlock()
 
-	activeClient := p.activeClient
+	if recycled != nil {
+		recycled.drain()
+	}
+
 	if activeClient == nil {
-		listener.OnFailure(types.ConnectionFailure, nil)
+		// the host is reported, so that the retry excludes it and the outlier detector counts the failure
+		listener.OnFailure(types.ConnectionFailure, p.host)
 		return
 	}
 
 	if !p.host.ClusterInfo().ResourceManager().Requests().CanCreate() {
+		activeClient.onStreamEnd()
 		listener.OnFailure(types.Overflow, nil)
 		p.host.HostStats().UpstreamRequestPendingOverflow.Inc(1)
 		p.host.ClusterInfo().Stats().UpstreamRequestPendingOverflow.Inc(1)
@@ -90,15 +105,61 @@ func (p *connPool) NewStream(ctx context.Context,
 	return
 }
 
-func (p *connPool) Close() {
+// types.PreconnectPool
+// Preconnect establishes the multiplexed connection, it is idle until the first request
+func (p *connPool) Preconnect() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
 	if p.activeClient != nil {
-		p.activeClient.client.Close()
+		return
+	}
+	if p.activeClient = newActiveClient(context.Background(), p); p.activeClient != nil {
+		p.activeClient.setIdle(true)
+	}
+}
+
+func (p *connPool) Close() {
+	p.mux.Lock()
+	activeClient := p.activeClient
+	p.mux.Unlock()
+
+	if activeClient != nil {
+		activeClient.client.Close()
+	}
+}
+
+// recycleExpired removes the active client exceeding the max lifetime from the pool and returns it,
+// which should be drained out of the lock. It is called with the lock held
+func (p *connPool) recycleExpired() *activeClient {
+	ac := p.activeClient
+	if ac == nil || !ac.expired() {
+		return nil
+	}
+	p.activeClient = nil
+	p.host.HostStats().UpstreamConnectionRecycle.Inc(1)
+	p.host.ClusterInfo().Stats().UpstreamConnectionRecycle.Inc(1)
+	return ac
+}
+
+// onIdleTimeout closes the client if it is still idle in the pool
+func (p *connPool) onIdleTimeout(ac *activeClient) {
+	p.mux.Lock()
+	idle := p.activeClient == ac && atomic.LoadInt32(&ac.activeStreams) == 0
+	if idle {
+		p.activeClient = nil
+	}
+	p.mux.Unlock()
+
+	if idle {
+		ac.client.Close()
 	}
 }
 
 func (p *connPool) onConnectionEvent(client *activeClient, event types.ConnectionEvent) {
 	// event.ConnectFailure() contains types.ConnectTimeout and types.ConnectTimeout
 	if event.IsClose() {
+		client.onClose()
 		if client.closeWithActiveReq {
 			if event == types.LocalClose {
 				p.host.HostStats().UpstreamConnectionLocalCloseWithActiveRequest.Inc(1)
@@ -108,10 +169,13 @@ func (p *connPool) onConnectionEvent(client *activeClient, event types.Connectio
 				p.host.ClusterInfo().Stats().UpstreamConnectionRemoteCloseWithActiveRequest.Inc(1)
 			}
 		}
-		p.activeClient = nil
+		// the recycled client is closed after a new one takes its place
+		if p.activeClient == client {
+			p.activeClient = nil
+		}
 	} else if event == types.ConnectTimeout {
-		p.host.HostStats().UpstreamRequestTimeout.Inc(1)
-		p.host.ClusterInfo().Stats().UpstreamRequestTimeout.Inc(1)
+		p.host.HostStats().UpstreamConnectionConTimeout.Inc(1)
+		p.host.ClusterInfo().Stats().UpstreamConnectionConTimeout.Inc(1)
 		client.client.Close()
 		p.activeClient = nil
 	} else if event == types.ConnectFailed {
@@ -125,6 +189,7 @@ func (p *connPool) onStreamDestroy(client *activeClient) {
 	p.host.HostStats().UpstreamRequestActive.Dec(1)
 	p.host.ClusterInfo().Stats().UpstreamRequestActive.Dec(1)
 	p.host.ClusterInfo().ResourceManager().Requests().Decrease()
+	client.onStreamEnd()
 }
 
 func (p *connPool) onStreamReset(client *activeClient, reason types.StreamResetReason) {
@@ -154,15 +219,37 @@ type activeClient struct {
 	host               types.CreateConnectionData
 	closeWithActiveReq bool
 	totalStream        uint64
+
+	config        v2.ConnPoolConfig
+	createTime    time.Time
+	activeStreams int32
+	draining      int32 // 1 if recycled, it is closed once the streams drained
+
+	mux       sync.Mutex // guards the idle state
+	connected bool
+	idle      bool
+	closed    bool
+	idleTimer *time.Timer
 }
 
 func newActiveClient(ctx context.Context, pool *connPool) *activeClient {
 	ac := &activeClient{
-		pool: pool,
+		pool:       pool,
+		config:     pool.host.ClusterInfo().ConnPoolConfig(),
+		createTime: time.Now(),
 	}
 
 	data := pool.host.CreateConnection(ctx)
 	connCtx := context.WithValue(context.Background(), types.ContextKeyConnectionID, data.Connection.ID())
+	if compress := pool.host.ClusterInfo().FrameCompress(); compress != "" {
+		connCtx = context.WithValue(connCtx, types.ContextKeyFrameCompress, compress)
+	}
+	if interval := pool.host.ClusterInfo().HeartbeatInterval(); interval > 0 {
+		connCtx = context.WithValue(connCtx, types.ContextKeyHeartbeatInterval, interval)
+	}
+	if limit := pool.host.ClusterInfo().MaxResponsePayload(); limit > 0 {
+		connCtx = context.WithValue(connCtx, types.ContextKeyMaxResponsePayload, limit)
+	}
 	codecClient := pool.createStreamClient(connCtx, data)
 	codecClient.AddConnectionEventListener(ac)
 	codecClient.SetStreamConnectionEventListener(ac)
@@ -173,6 +260,9 @@ func newActiveClient(ctx context.Context, pool *connPool) *activeClient {
 	if err := ac.host.Connection.Connect(true); err != nil {
 		return nil
 	}
+	ac.mux.Lock()
+	ac.connected = true
+	ac.mux.Unlock()
 	pool.host.HostStats().UpstreamConnectionTotal.Inc(1)
 	pool.host.HostStats().UpstreamConnectionActive.Inc(1)
 	pool.host.ClusterInfo().Stats().UpstreamConnectionTotal.Inc(1)
@@ -189,6 +279,94 @@ func newActiveClient(ctx context.Context, pool *connPool) *activeClient {
 	return ac
 }
 
+// expired returns true if the client exceeds the max lifetime
+func (ac *activeClient) expired() bool {
+	lifetime := ac.config.MaxLifetime.Duration
+	return lifetime > 0 && time.Since(ac.createTime) >= lifetime
+}
+
+func (ac *activeClient) onStreamStart() {
+	if atomic.AddInt32(&ac.activeStreams, 1) == 1 {
+		ac.setIdle(false)
+	}
+}
+
+func (ac *activeClient) onStreamEnd() {
+	if atomic.AddInt32(&ac.activeStreams, -1) != 0 {
+		return
+	}
+	if atomic.LoadInt32(&ac.draining) == 1 {
+		ac.client.Close()
+		return
+	}
+	// the lifetime is also checked here, so that an idle client exceeding it is not kept until the next request
+	ac.pool.mux.Lock()
+	recycled := ac.pool.activeClient == ac && ac.pool.recycleExpired() != nil
+	ac.pool.mux.Unlock()
+	if recycled {
+		ac.drain()
+		return
+	}
+	ac.setIdle(true)
+}
+
+// drain closes the recycled client once the streams finished
+func (ac *activeClient) drain() {
+	atomic.StoreInt32(&ac.draining, 1)
+	if atomic.LoadInt32(&ac.activeStreams) == 0 {
+		ac.client.Close()
+	}
+}
+
+// setIdle updates the idle count and arms the idle timer if max idle time configured
+func (ac *activeClient) setIdle(idle bool) {
+	ac.mux.Lock()
+	defer ac.mux.Unlock()
+
+	if ac.idle == idle || ac.closed {
+		return
+	}
+	ac.idle = idle
+	if idle {
+		ac.pool.host.HostStats().UpstreamConnectionIdle.Inc(1)
+		ac.pool.host.ClusterInfo().Stats().UpstreamConnectionIdle.Inc(1)
+		if maxIdle := ac.config.MaxIdleTime.Duration; maxIdle > 0 {
+			ac.idleTimer = time.AfterFunc(maxIdle, func() {
+				ac.pool.onIdleTimeout(ac)
+			})
+		}
+		return
+	}
+	ac.pool.host.HostStats().UpstreamConnectionIdle.Dec(1)
+	ac.pool.host.ClusterInfo().Stats().UpstreamConnectionIdle.Dec(1)
+	if ac.idleTimer != nil {
+		ac.idleTimer.Stop()
+		ac.idleTimer = nil
+	}
+}
+
+func (ac *activeClient) onClose() {
+	ac.mux.Lock()
+	defer ac.mux.Unlock()
+
+	if ac.closed {
+		return
+	}
+	ac.closed = true
+	if ac.connected {
+		ac.pool.host.HostStats().UpstreamConnectionActive.Dec(1)
+		ac.pool.host.ClusterInfo().Stats().UpstreamConnectionActive.Dec(1)
+	}
+	if ac.idle {
+		ac.pool.host.HostStats().UpstreamConnectionIdle.Dec(1)
+		ac.pool.host.ClusterInfo().Stats().UpstreamConnectionIdle.Dec(1)
+	}
+	if ac.idleTimer != nil {
+		ac.idleTimer.Stop()
+		ac.idleTimer = nil
+	}
+}
+
 func (ac *activeClient) OnEvent(event types.ConnectionEvent) {
 	ac.pool.onConnectionEvent(ac, event)
 }
@@ -0,0 +1,239 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	str "github.com/alipay/sofa-mosn/pkg/stream"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	"github.com/rcrowley/go-metrics"
+)
+
+type mockPoolClusterInfo struct {
+	types.ClusterInfo
+	config v2.ConnPoolConfig
+	stats  types.ClusterStats
+}
+
+func (ci *mockPoolClusterInfo) ConnPoolConfig() v2.ConnPoolConfig {
+	return ci.config
+}
+
+func (ci *mockPoolClusterInfo) Stats() types.ClusterStats {
+	return ci.stats
+}
+
+type mockPoolHost struct {
+	types.Host
+	info  *mockPoolClusterInfo
+	stats types.HostStats
+	flags types.HealthFlag
+}
+
+func (h *mockPoolHost) ContainHealthFlag(flag types.HealthFlag) bool {
+	return h.flags&flag != 0
+}
+
+func (h *mockPoolHost) ClusterInfo() types.ClusterInfo {
+	return h.info
+}
+
+func (h *mockPoolHost) HostStats() types.HostStats {
+	return h.stats
+}
+
+// mockPoolClient notifies the pool on close like the connection does
+type mockPoolClient struct {
+	str.Client
+	ac     *activeClient
+	closed int32
+}
+
+func (c *mockPoolClient) Close() {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.ac.OnEvent(types.LocalClose)
+	}
+}
+
+func newMockPool(config v2.ConnPoolConfig) (*connPool, *mockPoolHost) {
+	host := &mockPoolHost{
+		info: &mockPoolClusterInfo{
+			config: config,
+			stats: types.ClusterStats{
+				UpstreamConnectionActive:     metrics.NewCounter(),
+				UpstreamConnectionIdle:       metrics.NewCounter(),
+				UpstreamConnectionRecycle:    metrics.NewCounter(),
+				UpstreamConnectionConTimeout: metrics.NewCounter(),
+				UpstreamRequestTimeout:       metrics.NewCounter(),
+			},
+		},
+		stats: types.HostStats{
+			UpstreamConnectionActive:     metrics.NewCounter(),
+			UpstreamConnectionIdle:       metrics.NewCounter(),
+			UpstreamConnectionRecycle:    metrics.NewCounter(),
+			UpstreamConnectionConTimeout: metrics.NewCounter(),
+			UpstreamRequestTimeout:       metrics.NewCounter(),
+		},
+	}
+	return NewConnPool(host).(*connPool), host
+}
+
+// newMockActiveClient makes a connected client in the pool
+func newMockActiveClient(p *connPool) (*activeClient, *mockPoolClient) {
+	ac := &activeClient{
+		pool:       p,
+		config:     p.host.ClusterInfo().ConnPoolConfig(),
+		createTime: time.Now(),
+		connected:  true,
+	}
+	client := &mockPoolClient{ac: ac}
+	ac.client = client
+	p.host.HostStats().UpstreamConnectionActive.Inc(1)
+	p.activeClient = ac
+	return ac, client
+}
+
+func TestConnPoolMaxIdleTime(t *testing.T) {
+	p, host := newMockPool(v2.ConnPoolConfig{
+		MaxIdleTime: v2.DurationConfig{Duration: 50 * time.Millisecond},
+	})
+	ac, client := newMockActiveClient(p)
+
+	ac.onStreamStart()
+	ac.onStreamEnd()
+	if host.stats.UpstreamConnectionIdle.Count() != 1 {
+		t.Errorf("expect 1 idle connection, got %d", host.stats.UpstreamConnectionIdle.Count())
+	}
+	// a new stream stops the idle timer
+	ac.onStreamStart()
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&client.closed) == 1 || host.stats.UpstreamConnectionIdle.Count() != 0 {
+		t.Fatal("busy connection should not be closed")
+	}
+
+	ac.onStreamEnd()
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&client.closed) != 1 {
+		t.Fatal("idle connection should be closed")
+	}
+	if p.activeClient != nil {
+		t.Error("closed connection should be removed from the pool")
+	}
+	if host.stats.UpstreamConnectionIdle.Count() != 0 || host.stats.UpstreamConnectionActive.Count() != 0 {
+		t.Errorf("unexpected stats, idle %d, active %d", host.stats.UpstreamConnectionIdle.Count(),
+			host.stats.UpstreamConnectionActive.Count())
+	}
+}
+
+func TestConnPoolMaxLifetime(t *testing.T) {
+	lifetime := time.Minute
+	p, host := newMockPool(v2.ConnPoolConfig{
+		MaxLifetime: v2.DurationConfig{Duration: lifetime},
+	})
+	ac, client := newMockActiveClient(p)
+	ac.onStreamStart()
+
+	p.mux.Lock()
+	if p.recycleExpired() != nil {
+		t.Error("connection should not be recycled before the lifetime")
+	}
+	ac.createTime = time.Now().Add(-lifetime)
+	recycled := p.recycleExpired()
+	p.mux.Unlock()
+	if recycled != ac || p.activeClient != nil {
+		t.Fatal("expired connection should be recycled")
+	}
+	if host.stats.UpstreamConnectionRecycle.Count() != 1 || host.info.stats.UpstreamConnectionRecycle.Count() != 1 {
+		t.Errorf("unexpected recycle count %d", host.stats.UpstreamConnectionRecycle.Count())
+	}
+
+	// a new connection takes place, the recycled one is closed after the stream drained
+	newAC, newClient := newMockActiveClient(p)
+	recycled.drain()
+	if atomic.LoadInt32(&client.closed) == 1 {
+		t.Fatal("recycled connection should be closed after the streams drained")
+	}
+	ac.onStreamEnd()
+	if atomic.LoadInt32(&client.closed) != 1 {
+		t.Fatal("recycled connection should be closed")
+	}
+	if p.activeClient != newAC || atomic.LoadInt32(&newClient.closed) == 1 {
+		t.Error("closing the recycled connection should not affect the new one")
+	}
+	if host.stats.UpstreamConnectionIdle.Count() != 0 {
+		t.Errorf("recycled connection should not be idle, got %d", host.stats.UpstreamConnectionIdle.Count())
+	}
+
+	// the idle connection exceeding the lifetime is recycled when the last stream ends
+	newAC.onStreamStart()
+	newAC.createTime = time.Now().Add(-lifetime)
+	newAC.onStreamEnd()
+	if atomic.LoadInt32(&newClient.closed) != 1 || p.activeClient != nil {
+		t.Error("expired idle connection should be recycled")
+	}
+	if host.stats.UpstreamConnectionRecycle.Count() != 2 || host.stats.UpstreamConnectionActive.Count() != 0 {
+		t.Errorf("unexpected stats, recycle %d, active %d", host.stats.UpstreamConnectionRecycle.Count(),
+			host.stats.UpstreamConnectionActive.Count())
+	}
+}
+
+func TestConnPoolConnectTimeout(t *testing.T) {
+	p, host := newMockPool(v2.ConnPoolConfig{})
+	ac, client := newMockActiveClient(p)
+
+	p.onConnectionEvent(ac, types.ConnectTimeout)
+	if atomic.LoadInt32(&client.closed) != 1 || p.activeClient != nil {
+		t.Fatal("timed out connection should be closed and removed from the pool")
+	}
+	// counted as a connection failure, not a request timeout
+	if host.stats.UpstreamConnectionConTimeout.Count() != 1 || host.info.stats.UpstreamConnectionConTimeout.Count() != 1 {
+		t.Errorf("expect 1 connect timeout, got host %d, cluster %d", host.stats.UpstreamConnectionConTimeout.Count(),
+			host.info.stats.UpstreamConnectionConTimeout.Count())
+	}
+	if host.stats.UpstreamRequestTimeout.Count() != 0 {
+		t.Errorf("expect no request timeout, got %d", host.stats.UpstreamRequestTimeout.Count())
+	}
+}
+
+type mockPoolEventListener struct {
+	reason types.PoolFailureReason
+	host   types.Host
+}
+
+func (l *mockPoolEventListener) OnFailure(reason types.PoolFailureReason, host types.Host) {
+	l.reason, l.host = reason, host
+}
+
+func (l *mockPoolEventListener) OnReady(sender types.StreamSender, host types.Host) {}
+
+func TestConnPoolConnectBackoff(t *testing.T) {
+	p, host := newMockPool(v2.ConnPoolConfig{})
+	host.flags = types.CONNECT_BACKOFF
+
+	// the mock host panics if connected
+	listener := &mockPoolEventListener{}
+	p.NewStream(context.Background(), nil, listener)
+	if listener.reason != types.ConnectionFailure || listener.host != host || p.activeClient != nil {
+		t.Errorf("expect the host in backoff failed without connecting, got %v", listener.reason)
+	}
+}
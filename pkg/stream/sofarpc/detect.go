@@ -0,0 +1,168 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sofarpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// defaultDetectTimeout bounds the wait for the first bytes of a connection if not configured
+const defaultDetectTimeout = 3 * time.Second
+
+// protocolDetection sticks the server connection to the protocol told by its first bytes, so that the
+// clients of the protocols share the listener port. The frames of any other protocol close the connection
+type protocolDetection struct {
+	conn        *streamConnection
+	codes       []byte
+	fallback    byte
+	hasFallback bool
+
+	fallbacks  metrics.Counter
+	undetected metrics.Counter
+
+	mutex    sync.Mutex
+	timer    *time.Timer
+	detected bool
+	closed   bool
+	code     byte
+}
+
+// newProtocolDetection returns nil if none of the configured protocols can be detected
+func newProtocolDetection(conn *streamConnection, config *v2.DetectConfig, listenerName string) *protocolDetection {
+	d := &protocolDetection{conn: conn}
+	for _, name := range config.Protocols {
+		code, ok := sofarpc.ProtocolCodeByName(name)
+		if !ok {
+			conn.logger.Errorf("unknown protocol %s to detect, ignored", name)
+			continue
+		}
+		d.codes = append(d.codes, code)
+	}
+	if len(d.codes) == 0 {
+		conn.logger.Errorf("no protocol to detect, protocol detection is disabled")
+		return nil
+	}
+	if config.Fallback != "" {
+		if d.fallback, d.hasFallback = sofarpc.ProtocolCodeByName(config.Fallback); !d.hasFallback {
+			conn.logger.Errorf("unknown fallback protocol %s, the connection not detected is closed", config.Fallback)
+		}
+	}
+	if listenerName != "" {
+		s := stats.NewListenerStats(listenerName)
+		d.fallbacks = s.Counter(stats.DownstreamProtocolFallback)
+		d.undetected = s.Counter(stats.DownstreamProtocolUndetected)
+	}
+
+	timeout := config.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultDetectTimeout
+	}
+	// the timer may fire before it is assigned
+	d.mutex.Lock()
+	d.timer = time.AfterFunc(timeout, d.onTimeout)
+	d.mutex.Unlock()
+
+	return d
+}
+
+// detect returns true once the protocol of the connection is told, false if the bytes are too few
+// to tell or the connection is closed
+func (d *protocolDetection) detect(buf types.IoBuffer) bool {
+	d.mutex.Lock()
+	if d.detected || d.closed {
+		d.mutex.Unlock()
+		return d.detected
+	}
+	code, ok, more := sofarpc.DetectProtocol(buf.Bytes(), d.codes)
+	if more {
+		d.mutex.Unlock()
+		return false
+	}
+	d.timer.Stop()
+	if ok {
+		d.stick(code)
+		d.mutex.Unlock()
+		return true
+	}
+	closing := d.giveUp("no protocol matches the first bytes")
+	d.mutex.Unlock()
+
+	// the close event stops the detection under the lock
+	if closing {
+		d.conn.conn.Close(types.NoFlush, types.LocalClose)
+	}
+	return !closing
+}
+
+// onTimeout gives up the connection sending too few bytes to tell the protocol in the timeout
+func (d *protocolDetection) onTimeout() {
+	d.mutex.Lock()
+	closing := !d.detected && !d.closed && d.giveUp("no protocol detected in the timeout")
+	d.mutex.Unlock()
+
+	if closing {
+		d.conn.conn.Close(types.NoFlush, types.LocalClose)
+	}
+}
+
+// giveUp sticks the connection to the fallback protocol, returns true if the connection should be closed
+// without a fallback
+func (d *protocolDetection) giveUp(reason string) bool {
+	if d.hasFallback {
+		d.conn.logger.Infof("%s, connection %d falls back to protocol %s", reason, d.conn.conn.ID(), sofarpc.ProtocolName(d.fallback))
+		if d.fallbacks != nil {
+			d.fallbacks.Inc(1)
+		}
+		d.stick(d.fallback)
+		return false
+	}
+
+	d.conn.logger.Errorf("%s, close connection %d", reason, d.conn.conn.ID())
+	if d.undetected != nil {
+		d.undetected.Inc(1)
+	}
+	d.closed = true
+	return true
+}
+
+func (d *protocolDetection) stick(code byte) {
+	d.code = code
+	d.detected = true
+	d.conn.logger.Debugf("connection %d is detected as protocol %s", d.conn.conn.ID(), sofarpc.ProtocolName(code))
+}
+
+// accept returns true if the frame of the protocol code belongs to the connection,
+// the compressed frames are of the protocol negotiated already
+func (d *protocolDetection) accept(code byte) bool {
+	return code == d.code || code == sofarpc.PROTOCOL_CODE_COMPRESS
+}
+
+// stop stops the timer of the connection closed before the protocol is told
+func (d *protocolDetection) stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.closed = true
+	d.timer.Stop()
+}
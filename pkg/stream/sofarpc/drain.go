@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// HeaderConnection is set to ConnectionClose on the responses rejected by a draining connection,
+// the clients should stop sending on the connection, it is closed once the in-flight requests finish
+const (
+	HeaderConnection string = "connection"
+	ConnectionClose  string = "close"
+)
+
+// connDrainer tracks the server stream connections to drain
+type connDrainer struct {
+	draining int32
+	mutex    sync.Mutex
+	conns    map[*streamConnection]struct{}
+}
+
+var drainer = &connDrainer{
+	conns: make(map[*streamConnection]struct{}),
+}
+
+// StartDrain puts the sofarpc server connections into drain mode. New requests are rejected with
+// RESPONSE_STATUS_SERVER_THREADPOOL_BUSY so that the clients retry on another connection, the in-flight
+// requests are completed, and the connection is closed once there is no active stream.
+// The connections created after StartDrain are draining too. It is registered by the mosn starter
+// as a drainer of admin.Drain
+func StartDrain() {
+	atomic.StoreInt32(&drainer.draining, 1)
+
+	drainer.mutex.Lock()
+	conns := make([]*streamConnection, 0, len(drainer.conns))
+	for conn := range drainer.conns {
+		conns = append(conns, conn)
+	}
+	drainer.mutex.Unlock()
+
+	for _, conn := range conns {
+		conn.closeIfDrained()
+	}
+}
+
+// IsDraining returns true if StartDrain is called
+func IsDraining() bool {
+	return atomic.LoadInt32(&drainer.draining) == 1
+}
+
+func (d *connDrainer) add(conn *streamConnection) {
+	d.mutex.Lock()
+	d.conns[conn] = struct{}{}
+	d.mutex.Unlock()
+}
+
+func (d *connDrainer) remove(conn *streamConnection) {
+	d.mutex.Lock()
+	delete(d.conns, conn)
+	d.mutex.Unlock()
+}
+
+// rejectDraining answers the request received on a draining connection without passing it to the proxy
+func (conn *streamConnection) rejectDraining(s *stream, cmd sofarpc.SofaRpcCmd) {
+	conn.logger.Debugf("connection is draining, reject stream %d", s.id)
+
+	if cmd.CommandType() != sofarpc.REQUEST_ONEWAY {
+		s.sendCmd = conn.hijackReasons.response(cmd, types.DrainingCode)
+		setConnectionClose(s.sendCmd)
+		s.endStream()
+	}
+
+	conn.closeIfDrained()
+}
+
+// setConnectionClose sets the close hint on the response, the protocols without header are left unchanged
+func setConnectionClose(resp sofarpc.SofaRpcCmd) {
+	var bolt *sofarpc.BoltResponse
+	switch r := resp.(type) {
+	case *sofarpc.BoltResponse:
+		bolt = r
+	case *sofarpc.BoltResponseV2:
+		bolt = &r.BoltResponse
+	default:
+		return
+	}
+	if bolt.ResponseHeader == nil {
+		bolt.ResponseHeader = make(map[string]string, 1)
+	}
+	bolt.ResponseHeader[HeaderConnection] = ConnectionClose
+}
+
+// closeIfDrained closes the draining connection without active server stream
+func (conn *streamConnection) closeIfDrained() {
+	if IsDraining() && atomic.LoadInt32(&conn.activeServerStreams) == 0 {
+		conn.logger.Infof("connection is drained, close it")
+		conn.conn.Close(types.FlushWrite, types.LocalClose)
+	}
+}
+
+// serverStreamDone is called once the server stream is ended or reset
+func (s *stream) serverStreamDone() {
+	if atomic.CompareAndSwapInt32(&s.active, 1, 0) {
+		if s.cancel != nil {
+			s.cancel()
+			s.cancel = nil
+		}
+		s.logAccess()
+		s.onStreamEnd()
+		if s.sc.releaseServerStream() == 0 {
+			s.sc.closeIfDrained()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const defaultFrameRatePause = time.Second
+
+// tokenBucket starts full, so that the frames pipelined on a new connection are allowed up to the burst.
+// It is used by the dispatching goroutine of the connection only and not locked
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// frameRateLimiter is the frame rate limit of a server connection
+type frameRateLimiter struct {
+	conn       *streamConnection
+	frames     *tokenBucket
+	heartbeats *tokenBucket // nil counts the heartbeats in frames
+	close      bool
+	pause      time.Duration
+	paused     int32
+	limited    metrics.Counter
+}
+
+func newFrameRateLimiter(conn *streamConnection, limit *v2.FrameRate, listenerName string) *frameRateLimiter {
+	l := &frameRateLimiter{
+		conn:   conn,
+		frames: newTokenBucket(limit.FramesPerSecond, limit.Burst),
+		close:  limit.Close,
+		pause:  limit.Pause.Duration,
+	}
+	if limit.HeartbeatsPerSecond > 0 {
+		burst := limit.HeartbeatsPerSecond
+		if limit.Burst > 0 {
+			burst = limit.Burst * limit.HeartbeatsPerSecond / limit.FramesPerSecond
+		}
+		l.heartbeats = newTokenBucket(limit.HeartbeatsPerSecond, burst)
+	}
+	if l.pause <= 0 {
+		l.pause = defaultFrameRatePause
+	}
+	if listenerName != "" {
+		l.limited = stats.NewListenerStats(listenerName).Counter(stats.DownstreamConnectionFrameRateLimited)
+	}
+	return l
+}
+
+// allow counts the decoded frame, it returns false if the connection is closed for exceeding the limit
+func (l *frameRateLimiter) allow(model interface{}) bool {
+	bucket := l.frames
+	if cmd, ok := model.(sofarpc.SofaRpcCmd); ok && l.heartbeats != nil && isHeartbeat(cmd) {
+		bucket = l.heartbeats
+	}
+	if bucket.take(time.Now()) {
+		return true
+	}
+
+	if l.close {
+		l.conn.logger.Errorf("frame rate limit exceeded, close the connection")
+		if l.limited != nil {
+			l.limited.Inc(1)
+		}
+		l.conn.conn.Close(types.NoFlush, types.LocalClose)
+		return false
+	}
+
+	if atomic.CompareAndSwapInt32(&l.paused, 0, 1) {
+		l.conn.logger.Warnf("frame rate limit exceeded, stop reading the connection for %v", l.pause)
+		if l.limited != nil {
+			l.limited.Inc(1)
+		}
+		l.conn.conn.SetReadDisable(true)
+		time.AfterFunc(l.pause, func() {
+			atomic.StoreInt32(&l.paused, 0)
+			// the connection may be closed during the pause
+			if atomic.LoadInt32(&l.conn.closed) == 0 {
+				l.conn.conn.SetReadDisable(false)
+			}
+		})
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// isHeartbeat returns true if the command is a heartbeat request or response
+func isHeartbeat(cmd sofarpc.SofaRpcCmd) bool {
+	return cmd.CommandCode() == sofarpc.HEARTBEAT
+}
+
+// replyHeartbeat answers the heartbeat request received on the server connection locally,
+// heartbeats are never forwarded to the upstream and not counted as requests
+func (conn *streamConnection) replyHeartbeat(cmd sofarpc.SofaRpcCmd) {
+	ack := sofarpc.NewHeartbeatAck(cmd.ProtocolCode())
+	if ack == nil {
+		conn.logger.Errorf("no heartbeat builder for protocol code %d", cmd.ProtocolCode())
+		return
+	}
+	ack.SetRequestID(cmd.RequestID())
+
+	buf, err := conn.codecEngine.Encode(conn.ctx, ack)
+	if err != nil {
+		conn.logger.Errorf("encode heartbeat ack error:%s", err.Error())
+		return
+	}
+
+	conn.logger.Debugf("reply heartbeat, id = %d", cmd.RequestID())
+	conn.conn.Write(buf)
+}
+
+// keepalive sends heartbeats on the idle client connection, so that the connection
+// is not reaped by the intermediate devices
+type keepalive struct {
+	conn     *streamConnection
+	interval time.Duration
+
+	lastActive   int64  // unix nano of the last read or write
+	protocolCode uint32 // sub protocol of the last request, heartbeat is not sent before the first request
+
+	mutex   sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+func newKeepalive(conn *streamConnection, interval time.Duration) *keepalive {
+	ka := &keepalive{
+		conn:       conn,
+		interval:   interval,
+		lastActive: time.Now().UnixNano(),
+	}
+	// the timer may fire before it is assigned
+	ka.mutex.Lock()
+	ka.timer = time.AfterFunc(interval, ka.onTimeout)
+	ka.mutex.Unlock()
+
+	return ka
+}
+
+// active records the connection activity, the heartbeat is delayed by the activity
+func (ka *keepalive) active(protocolCode byte) {
+	atomic.StoreInt64(&ka.lastActive, time.Now().UnixNano())
+	if protocolCode != 0 {
+		atomic.StoreUint32(&ka.protocolCode, uint32(protocolCode))
+	}
+}
+
+func (ka *keepalive) onTimeout() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&ka.lastActive)))
+	next := ka.interval - idle
+	if next <= 0 {
+		ka.sendHeartbeat()
+		next = ka.interval
+	}
+
+	ka.mutex.Lock()
+	if !ka.stopped {
+		ka.timer.Reset(next)
+	}
+	ka.mutex.Unlock()
+}
+
+func (ka *keepalive) sendHeartbeat() {
+	protocolCode := byte(atomic.LoadUint32(&ka.protocolCode))
+	if protocolCode == 0 {
+		return
+	}
+
+	hb := sofarpc.NewHeartbeat(protocolCode)
+	if hb == nil {
+		return
+	}
+	// no stream is registered, the heartbeat response is dropped on receive
+	hb.SetRequestID(atomic.AddUint64(&ka.conn.currStreamID, 1))
+
+	buf, err := ka.conn.codecEngine.Encode(ka.conn.ctx, hb)
+	if err != nil {
+		ka.conn.logger.Errorf("encode heartbeat error:%s", err.Error())
+		return
+	}
+
+	ka.conn.logger.Debugf("send heartbeat on idle connection, id = %d", hb.RequestID())
+	atomic.StoreInt64(&ka.lastActive, time.Now().UnixNano())
+	ka.conn.write(nil, buf)
+}
+
+func (ka *keepalive) stop() {
+	ka.mutex.Lock()
+	ka.stopped = true
+	ka.timer.Stop()
+	ka.mutex.Unlock()
+}
+
+// stopKeepalive stops the heartbeats once the client connection is closed
+func (conn *streamConnection) stopKeepalive(event types.ConnectionEvent) {
+	if conn.keepalive != nil && (event.IsClose() || event.ConnectFailure()) {
+		conn.keepalive.stop()
+	}
+}
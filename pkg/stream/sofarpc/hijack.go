@@ -0,0 +1,68 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// defaultHijackReasons is the human-readable reason carried in the hijack response body, indexed by status code
+var defaultHijackReasons = hijackReasons{
+	types.RouterUnavailableCode:   "mosn: no route matched the request",
+	types.RateLimitedCode:         "mosn: request is rate limited, retry later",
+	types.NoHealthUpstreamCode:    "mosn: no healthy upstream host",
+	types.UpstreamOverFlowCode:    "mosn: upstream overflow",
+	types.TimeoutExceptionCode:    "mosn: upstream response timeout",
+	types.TryTimeoutExceptionCode: "mosn: upstream try timeout",
+	types.CodecExceptionCode:      "mosn: codec exception",
+	types.DeserialExceptionCode:   "mosn: deserialize exception",
+	types.DrainingCode:            "mosn: connection is draining, retry on another connection",
+	types.ConnectionOverflowCode:  "mosn: too many concurrent requests on the connection",
+	types.ServiceLimitedCode:      "mosn: service rate limit exceeded",
+}
+
+// hijackReasons are the reasons of the hijack responses of a listener by the status code
+type hijackReasons map[int]string
+
+// newHijackReasons returns the default reasons overridden by the listener config,
+// an empty reason means the response has no body
+func newHijackReasons(overrides map[int]string) hijackReasons {
+	if len(overrides) == 0 {
+		return defaultHijackReasons
+	}
+
+	reasons := make(hijackReasons, len(defaultHijackReasons)+len(overrides))
+	for code, reason := range defaultHijackReasons {
+		reasons[code] = reason
+	}
+	for code, reason := range overrides {
+		if reason == "" {
+			delete(reasons, code)
+		} else {
+			reasons[code] = reason
+		}
+	}
+	return reasons
+}
+
+// response builds the response of the request with the status code in the codec of the request, the reason
+// is carried as the error that a SofaRPC client decodes, clients can also ignore it by the status
+func (r hijackReasons) response(request sofarpc.SofaRpcCmd, code int) sofarpc.SofaRpcCmd {
+	return sofarpc.NewErrorResponse(request, sofarpc.MappingFromHttpStatus(code), r[code])
+}
@@ -0,0 +1,107 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// idleTimer closes the server connection receiving no frame in the timeout,
+// heartbeats are frames too, so a client keeping the connection alive is never closed
+type idleTimer struct {
+	conn    *streamConnection
+	timeout time.Duration
+
+	lastActive int64 // unix nano of the last frame received
+	closed     metrics.Counter
+
+	mutex   sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+func newIdleTimer(conn *streamConnection, timeout time.Duration, listenerName string) *idleTimer {
+	it := &idleTimer{
+		conn:       conn,
+		timeout:    timeout,
+		lastActive: time.Now().UnixNano(),
+	}
+	if listenerName != "" {
+		it.closed = stats.NewListenerStats(listenerName).Counter(stats.DownstreamConnectionIdleTimeout)
+	}
+	// the timer may fire before it is assigned
+	it.mutex.Lock()
+	it.timer = time.AfterFunc(timeout, it.onTimeout)
+	it.mutex.Unlock()
+
+	return it
+}
+
+// active records a frame received, the close is delayed by the frame
+func (it *idleTimer) active() {
+	atomic.StoreInt64(&it.lastActive, time.Now().UnixNano())
+}
+
+func (it *idleTimer) onTimeout() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&it.lastActive)))
+	next := it.timeout - idle
+	// the connection is not idle while the requests are in flight
+	if next <= 0 && atomic.LoadInt32(&it.conn.activeServerStreams) > 0 {
+		next = it.timeout
+	}
+	if next <= 0 {
+		it.closeConnection(idle)
+		return
+	}
+
+	it.mutex.Lock()
+	if !it.stopped {
+		it.timer.Reset(next)
+	}
+	it.mutex.Unlock()
+}
+
+func (it *idleTimer) closeConnection(idle time.Duration) {
+	it.mutex.Lock()
+	if it.stopped {
+		it.mutex.Unlock()
+		return
+	}
+	it.stopped = true
+	it.mutex.Unlock()
+
+	it.conn.logger.Infof("close the connection idle for %v", idle)
+	if it.closed != nil {
+		it.closed.Inc(1)
+	}
+	// the pending responses are flushed before close
+	it.conn.conn.Close(types.FlushWrite, types.LocalClose)
+}
+
+func (it *idleTimer) stop() {
+	it.mutex.Lock()
+	it.stopped = true
+	it.timer.Stop()
+	it.mutex.Unlock()
+}
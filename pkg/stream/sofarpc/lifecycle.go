@@ -0,0 +1,217 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// lifecycleEventQueueSize bounds the events waiting for the hooks, the events beyond are dropped
+const lifecycleEventQueueSize = 4096
+
+// ConnectionInfo is the downstream connection passed to the lifecycle hooks
+type ConnectionInfo struct {
+	ID         uint64
+	RemoteAddr net.Addr
+	Listener   string
+}
+
+// StreamInfo is the server stream passed to the lifecycle hooks, it is shared by the hooks and should
+// not be modified
+type StreamInfo struct {
+	Connection ConnectionInfo
+	ID         uint64
+	Headers    map[string]string // the decoded request headers
+	StartTime  time.Time
+}
+
+// LifecycleHook is notified of the lifecycle of the downstream connections and the server streams, e.g. to
+// audit or to count custom metrics. The hooks are called in order in a separate goroutine, so a slow hook
+// never blocks the connections, but it delays the events of all the hooks and the events exceeding the
+// queue are dropped
+type LifecycleHook interface {
+	OnConnectionAccept(conn ConnectionInfo)
+
+	OnConnectionClose(conn ConnectionInfo, event types.ConnectionEvent)
+
+	OnStreamStart(stream *StreamInfo)
+
+	// OnStreamEnd is called with the internal status code, see types.SuccessCode,
+	// zero if the stream is reset without a response
+	OnStreamEnd(stream *StreamInfo, status int, duration time.Duration)
+}
+
+// LifecycleHookCreator creates the hook by the config of the listener's lifecycle_hooks
+type LifecycleHookCreator func(config map[string]interface{}) (LifecycleHook, error)
+
+var lifecycleHookCreators = make(map[string]LifecycleHookCreator)
+
+// RegisterLifecycleHook registers the creator of the hook type, the listeners enable the hooks by the type
+// in lifecycle_hooks. It should be called during initialization
+func RegisterLifecycleHook(typ string, creator LifecycleHookCreator) {
+	lifecycleHookCreators[typ] = creator
+}
+
+// lifecycleHooks are the hooks of a listener
+type lifecycleHooks struct {
+	configs  []v2.Filter
+	listener string
+	hooks    []LifecycleHook
+	dropped  metrics.Counter
+}
+
+var (
+	lifecycleHooksMux        sync.Mutex
+	lifecycleHooksByListener = make(map[string]*lifecycleHooks)
+
+	lifecycleEvents     = make(chan lifecycleEvent, lifecycleEventQueueSize)
+	lifecycleWorkerOnce sync.Once
+)
+
+type lifecycleEvent struct {
+	hooks *lifecycleHooks
+	call  func(hook LifecycleHook)
+}
+
+// getLifecycleHooks returns the hooks of the listener, which are created once and again if the config
+// is changed by the reload. Nil if no hook configured
+func getLifecycleHooks(listener string, configs []v2.Filter) *lifecycleHooks {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	lifecycleHooksMux.Lock()
+	defer lifecycleHooksMux.Unlock()
+
+	if h, ok := lifecycleHooksByListener[listener]; ok && reflect.DeepEqual(h.configs, configs) {
+		return h
+	}
+
+	h := &lifecycleHooks{
+		configs:  configs,
+		listener: listener,
+		dropped:  stats.NewListenerStats(listener).Counter(stats.DownstreamLifecycleEventsDropped),
+	}
+	for _, config := range configs {
+		creator, ok := lifecycleHookCreators[config.Type]
+		if !ok {
+			log.DefaultLogger.Errorf("listener %s: unknown lifecycle hook %s", listener, config.Type)
+			continue
+		}
+		hook, err := creator(config.Config)
+		if err != nil {
+			log.DefaultLogger.Errorf("listener %s: create lifecycle hook %s failed: %v", listener, config.Type, err)
+			continue
+		}
+		h.hooks = append(h.hooks, hook)
+	}
+	lifecycleHooksByListener[listener] = h
+
+	if len(h.hooks) == 0 {
+		return nil
+	}
+	lifecycleWorkerOnce.Do(func() {
+		go runLifecycleHooks()
+	})
+	return h
+}
+
+// post queues the event without blocking, it is dropped if the queue is full
+func (h *lifecycleHooks) post(call func(hook LifecycleHook)) {
+	select {
+	case lifecycleEvents <- lifecycleEvent{hooks: h, call: call}:
+	default:
+		h.dropped.Inc(1)
+	}
+}
+
+func runLifecycleHooks() {
+	for event := range lifecycleEvents {
+		for _, hook := range event.hooks.hooks {
+			callLifecycleHook(event.hooks.listener, hook, event.call)
+		}
+	}
+}
+
+// callLifecycleHook recovers the panic of the hook, so a broken hook never stops the others
+func callLifecycleHook(listener string, hook LifecycleHook, call func(hook LifecycleHook)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Errorf("listener %s: lifecycle hook %T panic: %v", listener, hook, r)
+		}
+	}()
+	call(hook)
+}
+
+func (conn *streamConnection) onConnectionAccept() {
+	info := conn.hookConn
+	conn.hooks.post(func(hook LifecycleHook) {
+		hook.OnConnectionAccept(info)
+	})
+}
+
+func (conn *streamConnection) onConnectionClose(event types.ConnectionEvent) {
+	info := conn.hookConn
+	conn.hooks.post(func(hook LifecycleHook) {
+		hook.OnConnectionClose(info, event)
+	})
+}
+
+// onStreamStart copies the decoded headers, the cmd is modified by the proxy
+func (s *stream) onStreamStart(cmd sofarpc.SofaRpcCmd) {
+	info := &StreamInfo{
+		Connection: s.sc.hookConn,
+		ID:         s.id,
+		Headers:    make(map[string]string),
+		StartTime:  time.Now(),
+	}
+	if cmd.Header() != nil {
+		cmd.Range(func(key, value string) bool {
+			info.Headers[key] = value
+			return true
+		})
+	}
+	s.hookStream = info
+	s.sc.hooks.post(func(hook LifecycleHook) {
+		hook.OnStreamStart(info)
+	})
+}
+
+func (s *stream) onStreamEnd() {
+	info := s.hookStream
+	if info == nil {
+		return
+	}
+	s.hookStream = nil
+	status, _ := strconv.Atoi(s.access.statusCode)
+	duration := time.Since(info.StartTime)
+	s.sc.hooks.post(func(hook LifecycleHook) {
+		hook.OnStreamEnd(info, status, duration)
+	})
+}
@@ -0,0 +1,131 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// activeServerStreams is the active server streams of all the connections, the load the qos classes are shed by
+var activeServerStreams int64
+
+type qosClass struct {
+	name      string
+	maxActive int64
+	admitted  metrics.Counter
+	rejected  metrics.Counter
+}
+
+type qosPolicy struct {
+	config       *v2.QoSConfig
+	header       string
+	classes      map[string]*qosClass // by the header value
+	defaultClass *qosClass
+}
+
+// qosPolicies are the policies of the listeners by the listener name, built by the first connection
+var qosPolicies = struct {
+	sync.Mutex
+	policies map[string]*qosPolicy
+}{policies: make(map[string]*qosPolicy)}
+
+// getQoSPolicy returns the request priority classes of the listener. Under overload, a class with a lower MaxActive
+// is rejected with the hijack response of types.RateLimitedCode first, which is RESPONSE_STATUS_SERVER_THREADPOOL_BUSY
+// in sofarpc, while the classes with a higher one are still admitted. The admitted and rejected requests are counted
+// per class. The policy is rebuilt if the config of the listener is updated
+func getQoSPolicy(listenerName string, config *v2.QoSConfig) *qosPolicy {
+	qosPolicies.Lock()
+	defer qosPolicies.Unlock()
+
+	if policy, ok := qosPolicies.policies[listenerName]; ok && policy.config == config {
+		return policy
+	}
+	policy := newQoSPolicy(config)
+	qosPolicies.policies[listenerName] = policy
+	return policy
+}
+
+func newQoSPolicy(config *v2.QoSConfig) *qosPolicy {
+	policy := &qosPolicy{
+		config:  config,
+		header:  config.Header,
+		classes: make(map[string]*qosClass),
+	}
+	for _, c := range config.Classes {
+		s := stats.NewQoSClassStats(c.Name)
+		class := &qosClass{
+			name:      c.Name,
+			maxActive: c.MaxActive,
+			admitted:  s.Counter(stats.QoSAdmitted),
+			rejected:  s.Counter(stats.QoSRejected),
+		}
+		for _, value := range c.Values {
+			policy.classes[value] = class
+		}
+		if c.Name == config.DefaultClass {
+			policy.defaultClass = class
+		}
+	}
+	return policy
+}
+
+func (p *qosPolicy) classify(cmd sofarpc.SofaRpcCmd) *qosClass {
+	if cmd.Header() != nil {
+		if value, ok := cmd.Get(p.header); ok {
+			if class, ok := p.classes[value]; ok {
+				return class
+			}
+		}
+	}
+	return p.defaultClass
+}
+
+// admitQoS returns false if the class of the request is shed, the request is counted in the active streams
+func (conn *streamConnection) admitQoS(cmd sofarpc.SofaRpcCmd) bool {
+	if conn.qos == nil {
+		return true
+	}
+	class := conn.qos.classify(cmd)
+	if class == nil {
+		return true
+	}
+
+	if class.maxActive > 0 && atomic.LoadInt64(&activeServerStreams) > class.maxActive {
+		class.rejected.Inc(1)
+		return false
+	}
+	class.admitted.Inc(1)
+	return true
+}
+
+// rejectQoS answers the request of the shed class without passing it to the proxy
+func (conn *streamConnection) rejectQoS(s *stream, cmd sofarpc.SofaRpcCmd) {
+	conn.logger.Debugf("instance is overloaded, reject stream %d by qos", s.id)
+
+	if cmd.CommandType() != sofarpc.REQUEST_ONEWAY {
+		s.sendCmd = conn.hijackReasons.response(cmd, types.RateLimitedCode)
+		s.endStream()
+	}
+}
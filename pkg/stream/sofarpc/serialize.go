@@ -0,0 +1,47 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// mismatchCodec returns true if the response from the upstream is not in the serialization of the request,
+// which the client can't decode. The content of the response is dropped then
+func (s *stream) mismatchCodec(resp sofarpc.SofaRpcCmd) bool {
+	codec, ok := sofarpc.SerializeCodec(resp)
+	if !ok || codec == s.codec || resp.CommandCode() == sofarpc.HEARTBEAT {
+		return false
+	}
+	s.sc.logger.Errorf("serialization type %d of the response mismatches %d of the request, id = %d",
+		codec, s.codec, s.id)
+	s.codecMismatch = true
+	return true
+}
+
+// codecExceptionResp builds the codec exception response in the serialization of the request
+func (s *stream) codecExceptionResp(resp sofarpc.SofaRpcCmd) sofarpc.SofaRpcCmd {
+	exception := sofarpc.NewResponse(resp.ProtocolCode(), sofarpc.MappingFromHttpStatus(types.CodecExceptionCode))
+	if exception == nil {
+		return resp
+	}
+	sofarpc.SetSerializeCodec(exception, s.codec)
+	sofarpc.SetErrorContent(exception, s.sc.hijackReasons[types.CodecExceptionCode])
+	return exception
+}
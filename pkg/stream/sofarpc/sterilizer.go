@@ -0,0 +1,93 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"strconv"
+
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// Sterilizer converts the headers between the sofarpc stream and the proxy
+type Sterilizer interface {
+	// Encode is called on the server stream with a request command appended by the proxy,
+	// which indicates a hijack by types.HeaderStatus, it returns the response to send
+	Encode(request sofarpc.SofaRpcCmd) (sofarpc.SofaRpcCmd, error)
+
+	// Decode is called with the decoded command before it is passed to the proxy
+	Decode(cmd sofarpc.SofaRpcCmd) sofarpc.SofaRpcCmd
+}
+
+// sterilizer replaces the default one of the new stream connections if it's not nil
+var sterilizer Sterilizer
+
+// SetSterilizer replaces the sterilizer used by the new stream connections, nil restores the default one
+func SetSterilizer(s Sterilizer) {
+	sterilizer = s
+}
+
+// defaultSterilizer maps the hijack status to the sofarpc response status and carries the hijack reason
+// configured on the listener
+type defaultSterilizer struct {
+	reasons hijackReasons
+}
+
+func (d *defaultSterilizer) Encode(request sofarpc.SofaRpcCmd) (sofarpc.SofaRpcCmd, error) {
+	if status, ok := request.Get(types.HeaderStatus); ok {
+		request.Del(types.HeaderStatus)
+		statusCode, _ := strconv.Atoi(status)
+
+		hijackResp := d.reasons.response(request, statusCode)
+		if hijackResp != nil {
+			return hijackResp, nil
+		}
+		return nil, ErrNotResponseBuilder
+	}
+
+	return nil, types.ErrNoStatusCodeForHijack
+}
+
+// Decode keeps the decoded command as is
+func (d *defaultSterilizer) Decode(cmd sofarpc.SofaRpcCmd) sofarpc.SofaRpcCmd {
+	return cmd
+}
+
+// internalHeaders are set by the stream for the proxy, e.g. for routing, or negotiated on the MOSN hop
+var internalHeaders = []string{sofarpc.HeaderProtocolVersion, sofarpc.HeaderStreamingContent, sofarpc.HeaderFrameCompress}
+
+// stripInternalHeaders removes the internal headers from the request sent to the upstream. It runs after
+// the header operations of the route applied by the proxy, so the internal headers never leave the MOSN hop,
+// the frame compression offer of the upstream hop is set afterwards
+func stripInternalHeaders(cmd sofarpc.SofaRpcCmd) {
+	if cmd.Header() == nil {
+		return
+	}
+	for _, key := range internalHeaders {
+		cmd.Del(key)
+	}
+}
+
+// stripNegotiationHeaders removes the negotiation headers from the response sent to the downstream,
+// e.g. added by the header operations of the route, so that only the ack of the stream itself is sent
+func stripNegotiationHeaders(cmd sofarpc.SofaRpcCmd) {
+	if cmd == nil || cmd.Header() == nil {
+		return
+	}
+	cmd.Del(sofarpc.HeaderFrameCompress)
+}
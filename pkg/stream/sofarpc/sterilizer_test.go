@@ -0,0 +1,127 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestDefaultSterilizerEncode(t *testing.T) {
+	testCases := []struct {
+		code   int
+		status int16
+	}{
+		{types.RouterUnavailableCode, sofarpc.RESPONSE_STATUS_NO_PROCESSOR},
+		{types.RateLimitedCode, sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY},
+		{types.NoHealthUpstreamCode, sofarpc.RESPONSE_STATUS_CONNECTION_CLOSED},
+		{types.UpstreamOverFlowCode, sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY},
+		{types.CodecExceptionCode, sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION},
+		{types.DeserialExceptionCode, sofarpc.RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION},
+		{types.TimeoutExceptionCode, sofarpc.RESPONSE_STATUS_TIMEOUT},
+		{types.UnknownCode, sofarpc.RESPONSE_STATUS_UNKNOWN},
+	}
+
+	s := &defaultSterilizer{}
+	for i, tc := range testCases {
+		req := &sofarpc.BoltRequest{
+			Protocol:      sofarpc.PROTOCOL_CODE_V1,
+			CmdType:       sofarpc.REQUEST,
+			RequestHeader: map[string]string{types.HeaderStatus: strconv.Itoa(tc.code)},
+		}
+		cmd, err := s.Encode(req)
+		if err != nil {
+			t.Fatalf("#%d encode failed: %v", i, err)
+		}
+		if resp := cmd.(*sofarpc.BoltResponse); resp.ResponseStatus != tc.status {
+			t.Errorf("#%d expect status %d, got %d", i, tc.status, resp.ResponseStatus)
+		}
+		if _, ok := req.Get(types.HeaderStatus); ok {
+			t.Errorf("#%d status header should be stripped", i)
+		}
+	}
+
+	// no status, not a hijack
+	req := &sofarpc.BoltRequest{Protocol: sofarpc.PROTOCOL_CODE_V1, RequestHeader: map[string]string{}}
+	if _, err := s.Encode(req); err != types.ErrNoStatusCodeForHijack {
+		t.Errorf("expect ErrNoStatusCodeForHijack, got %v", err)
+	}
+	// unknown protocol
+	req = &sofarpc.BoltRequest{Protocol: 0xff, RequestHeader: map[string]string{types.HeaderStatus: "404"}}
+	if _, err := s.Encode(req); err != ErrNotResponseBuilder {
+		t.Errorf("expect ErrNotResponseBuilder, got %v", err)
+	}
+}
+
+type headerStripSterilizer struct {
+	defaultSterilizer
+}
+
+func (s *headerStripSterilizer) Decode(cmd sofarpc.SofaRpcCmd) sofarpc.SofaRpcCmd {
+	cmd.Del("internal")
+	return cmd
+}
+
+func TestSetSterilizer(t *testing.T) {
+	SetSterilizer(&headerStripSterilizer{})
+	defer SetSterilizer(nil)
+
+	sc := newStreamConnection(context.Background(), nil, nil, nil).(*streamConnection)
+	req := &sofarpc.BoltRequest{RequestHeader: map[string]string{"internal": "1", "service": "test"}}
+	sc.sterilizer.Decode(req)
+	if _, ok := req.Get("internal"); ok {
+		t.Error("custom sterilizer should strip the header")
+	}
+	if _, ok := req.Get("service"); !ok {
+		t.Error("other headers should be kept")
+	}
+
+	SetSterilizer(nil)
+	sc = newStreamConnection(context.Background(), nil, nil, nil).(*streamConnection)
+	if d, ok := sc.sterilizer.(*defaultSterilizer); !ok || d.reasons == nil {
+		t.Error("nil should restore the default sterilizer with the reasons of the connection")
+	}
+}
+
+func TestStripInternalHeaders(t *testing.T) {
+	req := &sofarpc.BoltRequest{RequestHeader: map[string]string{
+		sofarpc.HeaderFrameCompress:    "gzip",
+		sofarpc.HeaderStreamingContent: "1",
+		"service":                      "test",
+	}}
+	stripInternalHeaders(req)
+	for _, key := range []string{sofarpc.HeaderFrameCompress, sofarpc.HeaderStreamingContent} {
+		if _, ok := req.Get(key); ok {
+			t.Errorf("internal header %s should be stripped", key)
+		}
+	}
+	if _, ok := req.Get("service"); !ok {
+		t.Error("other headers should be kept")
+	}
+
+	resp := &sofarpc.BoltResponse{ResponseHeader: map[string]string{sofarpc.HeaderFrameCompress: "gzip"}}
+	stripNegotiationHeaders(resp)
+	if _, ok := resp.Get(sofarpc.HeaderFrameCompress); ok {
+		t.Error("negotiation header should be stripped from the response")
+	}
+	stripNegotiationHeaders(nil)
+}
@@ -22,9 +22,10 @@ import (
 	"sync"
 
 	"errors"
-	"strconv"
 	"sync/atomic"
+	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/buffer"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/protocol"
@@ -49,8 +50,12 @@ var (
 	ErrNotResponseBuilder = errors.New("no response builder")
 )
 
+// LogModule is the log module of the sofarpc streams, its level can be changed by the admin api
+const LogModule = "stream"
+
 func init() {
 	str.Register(protocol.SofaRPC, &streamConnFactory{})
+	log.ModuleLogger(LogModule)
 }
 
 type streamConnFactory struct{}
@@ -90,9 +95,51 @@ type streamConnection struct {
 	streamConnectionEventListener       types.StreamConnectionEventListener
 	serverStreamConnectionEventListener types.ServerStreamConnectionEventListener
 
+	compressOffer sofarpc.FrameCompressor // client conn, algorithm offered to upstream
+	compressor    sofarpc.FrameCompressor // negotiated algorithm, nil means plain frames
+
+	sterilizer         Sterilizer
+	hijackReasons      hijackReasons // see ListenerConfig.HijackReasons
+	gracefulCodecReset bool          // server conn, see ListenerConfig.GracefulCodecReset
+
+	activeServerStreams  int32 // server conn, see StartDrain
+	maxConcurrentStreams int32 // server conn, see ListenerConfig.MaxConcurrentStreams
+	concurrencyStats     *concurrencyStats
+	qos                  *qosPolicy // server conn, nil if no request priority class configured
+	accessLog            *accessLog // server conn, nil means the access log is disabled
+	closed               int32
+
+	keepalive *keepalive // client conn, nil means no heartbeat on idle
+	idle      *idleTimer // server conn, nil means never closed on idle
+
+	frameLimiter *frameRateLimiter // server conn, see ListenerConfig.FrameRateLimit
+	worker       *requestWorker    // server conn, nil means the requests are processed by the read goroutine
+
+	detection *protocolDetection // server conn, nil means the frames of any protocol are decoded
+
+	hooks    *lifecycleHooks // server conn, nil if no lifecycle hook configured
+	hookConn ConnectionInfo
+
+	streamingDecode    bool             // server conn, see ContextKeyStreamingDecode
+	streamingThreshold int              // server conn, min content length to stream, see ListenerConfig.StreamingDecodeThreshold
+	content            streamingContent // server conn, the content of the streamed request
+	partialFrame       int              // bytes of the frame not fully read yet, see abandonPartialFrame
+
+	writeMux      sync.Mutex
+	contentWriter *stream            // client conn, the stream writing its content in pieces
+	pendingWrites [][]types.IoBuffer // client conn, the frames written after the content
+
 	logger 			log.Logger
 }
 
+// listenerConfigOf returns the config of the listener accepting the connection, empty for the client connection
+func listenerConfigOf(ctx context.Context) *v2.ListenerConfig {
+	if config, ok := ctx.Value(types.ContextKeyListenerConfig).(*v2.ListenerConfig); ok && config != nil {
+		return config
+	}
+	return &v2.ListenerConfig{}
+}
+
 func newStreamConnection(ctx context.Context, connection types.Connection, clientCallbacks types.StreamConnectionEventListener,
 	serverCallbacks types.ServerStreamConnectionEventListener) types.ClientStreamConnection {
 
@@ -105,7 +152,31 @@ func newStreamConnection(ctx context.Context, connection types.Connection, clien
 
 		contextManager: contextManager{base: ctx},
 
-		logger: log.ByContext(ctx),
+		sterilizer: sterilizer,
+
+		logger: log.ModuleByContext(ctx, LogModule),
+	}
+
+	listenerConfig := listenerConfigOf(ctx)
+	sc.hijackReasons = newHijackReasons(listenerConfig.HijackReasons)
+	if sc.sterilizer == nil {
+		sc.sterilizer = &defaultSterilizer{reasons: sc.hijackReasons}
+	}
+
+	if name, ok := ctx.Value(types.ContextKeyFrameCompress).(string); ok {
+		if sc.compressOffer = sofarpc.GetFrameCompressor(name); sc.compressOffer == nil {
+			sc.logger.Errorf("unknown frame compressor %s, use plain frames", name)
+		}
+	}
+
+	// the frames of the server conn are captured by the codec with the context
+	if config := listenerConfig.FrameCapture; config != nil && serverCallbacks != nil {
+		listenerName, _ := ctx.Value(types.ContextKeyListenerName).(string)
+		if capture, err := sofarpc.GetFrameCapture(listenerName, config); err == nil {
+			sc.contextManager.base = sofarpc.WithFrameCapture(sc.contextManager.base, capture)
+		} else {
+			sc.logger.Errorf("frame capture of listener %s failed: %v", listenerName, err)
+		}
 	}
 
 	// init first context
@@ -113,6 +184,62 @@ func newStreamConnection(ctx context.Context, connection types.Connection, clien
 
 	if sc.streamConnectionEventListener != nil {
 		sc.streams = make(map[uint64]*stream, 32)
+
+		if interval, ok := ctx.Value(types.ContextKeyHeartbeatInterval).(time.Duration); ok && interval > 0 {
+			sc.keepalive = newKeepalive(sc, interval)
+			connection.AddConnectionEventListener(sc)
+		}
+	}
+
+	if sc.serverStreamConnectionEventListener != nil {
+		sc.maxConcurrentStreams = maxConcurrentStreams(listenerConfig)
+		listenerName, _ := ctx.Value(types.ContextKeyListenerName).(string)
+		if listenerName != "" {
+			sc.concurrencyStats = newConcurrencyStats(listenerName)
+		}
+
+		if config := listenerConfig.QoS; config != nil && config.Header != "" {
+			sc.qos = getQoSPolicy(listenerName, config)
+		}
+		if config := listenerConfig.StreamAccessLog; config != nil && config.Path != "" {
+			var err error
+			if sc.accessLog, err = getAccessLog(listenerName, config); err != nil {
+				sc.logger.Errorf("sofarpc access log %s of listener %s failed: %v", config.Path, listenerName, err)
+			}
+		}
+
+		if streaming, ok := ctx.Value(types.ContextKeyStreamingDecode).(bool); ok {
+			sc.streamingDecode = streaming
+		}
+		sc.streamingThreshold = defaultStreamingDecodeThreshold
+		if threshold := listenerConfig.StreamingDecodeThreshold; threshold > 0 {
+			sc.streamingThreshold = int(threshold)
+		}
+		// a codec error of a single frame only resets the affected stream, so that the sibling streams
+		// survive. Errors without a frame boundary or request id always close the connection
+		sc.gracefulCodecReset = listenerConfig.GracefulCodecReset
+
+		if timeout := listenerConfig.IdleTimeout.Duration; timeout > 0 {
+			sc.idle = newIdleTimer(sc, timeout, listenerName)
+		}
+		if limit := listenerConfig.FrameRateLimit; limit != nil && limit.FramesPerSecond > 0 {
+			sc.frameLimiter = newFrameRateLimiter(sc, limit, listenerName)
+		}
+		if config := listenerConfig.ProtocolDetection; config != nil {
+			sc.detection = newProtocolDetection(sc, config, listenerName)
+		}
+		if config := listenerConfig.RequestWorkers; config != nil && config.Workers > 0 {
+			sc.worker = getRequestWorkerPool(listenerName, config).worker(connection.ID())
+		}
+		if configs := listenerConfig.LifecycleHooks; len(configs) > 0 {
+			if sc.hooks = getLifecycleHooks(listenerName, configs); sc.hooks != nil {
+				sc.hookConn = ConnectionInfo{ID: connection.ID(), RemoteAddr: connection.RemoteAddr(), Listener: listenerName}
+				sc.onConnectionAccept()
+			}
+		}
+
+		drainer.add(sc)
+		connection.AddConnectionEventListener(sc)
 	}
 
 	return sc
@@ -120,11 +247,57 @@ func newStreamConnection(ctx context.Context, connection types.Connection, clien
 
 // types.StreamConnection
 func (conn *streamConnection) Dispatch(buf types.IoBuffer) {
+	// the protocol of the connection is detected by its first bytes
+	if conn.detection != nil && !conn.detection.detect(buf) {
+		return
+	}
+
 	for {
+		// the content of the streamed request comes first
+		if conn.content.remaining > 0 {
+			if conn.idle != nil {
+				conn.idle.active()
+			}
+			if !conn.dispatchContent(buf) {
+				break
+			}
+			continue
+		}
+
 		// 1. pre alloc stream-level ctx with bufferCtx
 		ctx := conn.contextManager.curr
 
+		// a frame of another protocol than the one detected is a codec error
+		if conn.detection != nil && buf.Len() > 0 && !conn.detection.accept(buf.Bytes()[0]) {
+			conn.handleError(ctx, nil, rpc.ErrUnrecognizedCode)
+			break
+		}
+
+		// compressed frame is only accepted after the compression is negotiated on the connection
+		if buf.Len() > 0 && buf.Bytes()[0] == sofarpc.PROTOCOL_CODE_COMPRESS && conn.getCompressor() == nil {
+			conn.handleError(ctx, nil, rpc.ErrUnrecognizedCode)
+			break
+		}
+
 		// 2. decode process
+		if conn.streamingDecode {
+			if cmd, err := conn.decodeStreamingHeader(ctx, buf); cmd != nil {
+				if conn.idle != nil {
+					conn.idle.active()
+				}
+				if conn.frameLimiter != nil && !conn.frameLimiter.allow(cmd) {
+					break
+				}
+				conn.handleStreamingRequest(ctx, cmd, err)
+				if err != nil && !(conn.gracefulCodecReset && isStreamLevelError(cmd, err)) {
+					break
+				}
+
+				conn.contextManager.next()
+				continue
+			}
+		}
+
 		// TODO: maybe pass sub protocol type
 		cmd, err := conn.codecEngine.Decode(ctx, buf)
 		// No enough data
@@ -132,14 +305,25 @@ func (conn *streamConnection) Dispatch(buf types.IoBuffer) {
 			break
 		}
 
+		if conn.keepalive != nil {
+			conn.keepalive.active(0)
+		}
+		if conn.idle != nil {
+			conn.idle.active()
+		}
+		if conn.frameLimiter != nil && cmd != nil && !conn.frameLimiter.allow(cmd) {
+			break
+		}
+
 		// Do handle staff. Error would also be passed to this function.
 		conn.handleCommand(ctx, cmd, err)
-		if err != nil {
+		if err != nil && !(conn.gracefulCodecReset && isStreamLevelError(cmd, err)) {
 			break
 		}
 
 		conn.contextManager.next()
 	}
+	conn.partialFrame = buf.Len()
 }
 
 func (conn *streamConnection) Protocol() types.Protocol {
@@ -166,6 +350,31 @@ func (conn *streamConnection) Reset(reason types.StreamResetReason) {
 	}
 }
 
+// OnEvent removes the closed server connection from the drainer, and stops the heartbeats of the client connection
+// and the idle timer and the protocol detection of the server connection, the frame being read is abandoned
+func (conn *streamConnection) OnEvent(event types.ConnectionEvent) {
+	if event.IsClose() {
+		drainer.remove(conn)
+
+		// the in-flight streams are never ended on a closed connection
+		atomic.StoreInt32(&conn.closed, 1)
+		if active := atomic.SwapInt32(&conn.activeServerStreams, 0); active > 0 {
+			atomic.AddInt64(&activeServerStreams, -int64(active))
+		}
+		if conn.idle != nil {
+			conn.idle.stop()
+		}
+		if conn.detection != nil {
+			conn.detection.stop()
+		}
+		conn.abandonPartialFrame(event)
+		if conn.hooks != nil {
+			conn.onConnectionClose(event)
+		}
+	}
+	conn.stopKeepalive(event)
+}
+
 func (conn *streamConnection) NewStream(ctx context.Context, receiver types.StreamReceiveListener) types.StreamSender {
 	buffers := sofaBuffersByContext(ctx)
 	stream := &buffers.client
@@ -177,6 +386,7 @@ func (conn *streamConnection) NewStream(ctx context.Context, receiver types.Stre
 	stream.direction = ClientStream
 	stream.sc = conn
 	stream.receiver = receiver
+	stream.oneway = false
 
 	conn.mutex.Lock()
 	conn.streams[stream.id] = stream
@@ -199,26 +409,46 @@ func (conn *streamConnection) handleCommand(ctx context.Context, model interface
 		conn.handleError(ctx, model, ErrNotSofarpcCmd)
 		return
 	}
+	cmd = conn.sterilizer.Decode(cmd)
 
 	switch cmd.CommandType() {
 	case sofarpc.REQUEST, sofarpc.REQUEST_ONEWAY:
+		if isHeartbeat(cmd) {
+			if cmd.CommandType() == sofarpc.REQUEST {
+				conn.replyHeartbeat(cmd)
+			}
+			return
+		}
+		if conn.worker != nil {
+			conn.offerRequest(ctx, cmd)
+			return
+		}
 		stream = conn.onNewStreamDetect(ctx, cmd, conn.codecEngine)
 	case sofarpc.RESPONSE:
 		stream = conn.onStreamRecv(ctx, cmd)
+		if stream == nil && isHeartbeat(cmd) {
+			conn.logger.Debugf("heartbeat ack recv, id = %d", cmd.RequestID())
+			return
+		}
 	}
 
-	// header, data notify
 	if stream != nil {
-		header := cmd.Header()
-		data := cmd.Data()
+		conn.negotiateCompress(stream, cmd)
+		conn.notifyStream(stream, cmd)
+	}
+}
 
-		if header != nil {
-			stream.receiver.OnReceiveHeaders(stream.ctx, cmd, data == nil)
-		}
+// notifyStream passes the header and data of the cmd to the receiver of the stream
+func (conn *streamConnection) notifyStream(stream *stream, cmd sofarpc.SofaRpcCmd) {
+	header := cmd.Header()
+	data := cmd.Data()
 
-		if data != nil {
-			stream.receiver.OnReceiveData(stream.ctx, data, true)
-		}
+	if header != nil {
+		stream.receiver.OnReceiveHeaders(stream.ctx, cmd, data == nil)
+	}
+
+	if data != nil {
+		stream.receiver.OnReceiveData(stream.ctx, data, true)
 	}
 }
 
@@ -250,9 +480,30 @@ func (conn *streamConnection) handleError(ctx context.Context, cmd interface{},
 		}
 		// if no request id found, no reason to send response, so close connection
 		conn.conn.Close(types.NoFlush, types.LocalClose)
+	case sofarpc.ErrPayloadTooLarge, sofarpc.ErrUnknownProtocolVersion:
+		conn.logger.Errorf("error occurs while proceeding codec logic: %s, close the connection", err.Error())
+		// the oversized or unknown version frame is not consumed, so the connection is closed after the exception response
+		if cmd, ok := cmd.(sofarpc.SofaRpcCmd); ok && cmd.RequestID() > 0 && cmd.CommandType() != sofarpc.RESPONSE {
+			if stream := conn.onNewStreamDetect(ctx, cmd, conn.codecEngine); stream != nil {
+				stream.receiver.OnDecodeError(stream.ctx, types.ErrCodecException, cmd)
+			}
+			conn.conn.Close(types.FlushWrite, types.LocalClose)
+			return
+		}
+		conn.conn.Close(types.NoFlush, types.LocalClose)
 	}
 }
 
+// isStreamLevelError returns true if the error only affects the stream of the cmd,
+// the broken frame is consumed by the codec and the connection is kept by handleError
+func isStreamLevelError(model interface{}, err error) bool {
+	if err != types.ErrCodecException && err != types.ErrDeserializeException {
+		return false
+	}
+	cmd, ok := model.(sofarpc.SofaRpcCmd)
+	return ok && cmd.RequestID() > 0
+}
+
 func (conn *streamConnection) onNewStreamDetect(ctx context.Context, cmd sofarpc.SofaRpcCmd, spanBuilder types.SpanBuilder) *stream {
 	buffers := sofaBuffersByContext(ctx)
 	stream := &buffers.server
@@ -263,6 +514,36 @@ func (conn *streamConnection) onNewStreamDetect(ctx context.Context, cmd sofarpc
 	stream.ctx = context.WithValue(ctx, types.ContextSubProtocol, cmd.ProtocolCode())
 	stream.direction = ServerStream
 	stream.sc = conn
+	stream.version, _ = sofarpc.ProtocolVersion(cmd)
+	stream.oneway = cmd.CommandType() == sofarpc.REQUEST_ONEWAY
+	stream.hookStream = nil
+	stream.codec, _ = sofarpc.SerializeCodec(cmd)
+	stream.codecMismatch = false
+
+	if IsDraining() {
+		conn.rejectDraining(stream, cmd)
+		return nil
+	}
+	if !conn.acquireServerStream() {
+		conn.rejectOverflow(stream, cmd)
+		return nil
+	}
+	if !conn.admitQoS(cmd) {
+		conn.releaseServerStream()
+		conn.rejectQoS(stream, cmd)
+		return nil
+	}
+	// the upstream request should not outlive the client, the proxy bounds the upstream by the deadline
+	if timeout, ok := sofarpc.RequestTimeout(cmd); ok {
+		stream.ctx, stream.cancel = context.WithTimeout(stream.ctx, timeout)
+	}
+	stream.active = 1
+	stream.onRequest(cmd)
+	sofarpc.SetVersionHeader(cmd)
+
+	if conn.hooks != nil {
+		stream.onStreamStart(cmd)
+	}
 
 	conn.logger.Debugf("new stream detect, id = %d", stream.id)
 
@@ -270,6 +551,47 @@ func (conn *streamConnection) onNewStreamDetect(ctx context.Context, cmd sofarpc
 	return stream
 }
 
+// negotiateCompress handles the frame compression negotiation header, the header is always removed
+// so that it never passes through to the application
+func (conn *streamConnection) negotiateCompress(s *stream, cmd sofarpc.SofaRpcCmd) {
+	if cmd.Header() == nil {
+		return
+	}
+
+	name, ok := cmd.Get(sofarpc.HeaderFrameCompress)
+	if !ok {
+		return
+	}
+	cmd.Del(sofarpc.HeaderFrameCompress)
+
+	switch s.direction {
+	case ServerStream:
+		// accept the offer if supported, otherwise keep silent and the peer stays on plain frames
+		if compressor := sofarpc.GetFrameCompressor(name); compressor != nil {
+			s.compressAck = name
+		}
+	case ClientStream:
+		// the server echoes the offer back, switch to compressed frames
+		if conn.compressOffer != nil && conn.compressOffer.Name() == name {
+			conn.setCompressor(conn.compressOffer)
+			conn.logger.Debugf("frame compression %s negotiated", name)
+		}
+	}
+}
+
+func (conn *streamConnection) setCompressor(compressor sofarpc.FrameCompressor) {
+	conn.mutex.Lock()
+	conn.compressor = compressor
+	conn.mutex.Unlock()
+}
+
+func (conn *streamConnection) getCompressor() sofarpc.FrameCompressor {
+	conn.mutex.RLock()
+	defer conn.mutex.RUnlock()
+
+	return conn.compressor
+}
+
 func (conn *streamConnection) onStreamRecv(ctx context.Context, cmd sofarpc.SofaRpcCmd) *stream {
 	requestID := cmd.RequestID()
 
@@ -303,6 +625,16 @@ type stream struct {
 	receiver	types.StreamReceiveListener
 	sendCmd 	sofarpc.SofaRpcCmd
 	sendBuf 	types.IoBuffer
+	compressAck	string // server stream, accepted frame compression to echo back
+	version		byte   // server stream, protocol version of the request, 0 if the protocol has no version
+	streaming	bool   // client stream, the content is streamed, see beginContent
+	active		int32  // server stream, 1 until ended or reset
+	access		accessLogInfo // server stream, recorded if the access log is enabled
+	cancel		context.CancelFunc // server stream, releases the deadline of the request timeout
+	oneway		bool   // the request expects no response, see onewaySent
+	hookStream	*StreamInfo // server stream, nil if no lifecycle hook configured
+	codec		byte   // server stream, serialization type of the request
+	codecMismatch	bool   // server stream, the response is replaced by the codec exception, see mismatchCodec
 }
 
 // ~~ types.Stream
@@ -310,6 +642,19 @@ func (s *stream) ID() uint64 {
 	return s.id
 }
 
+func (s *stream) ResetStream(reason types.StreamResetReason) {
+	if s.direction == ClientStream {
+		s.sc.abortContent(s)
+	}
+	s.BaseStream.ResetStream(reason)
+	s.serverStreamDone()
+}
+
+func (s *stream) DestroyStream() {
+	s.BaseStream.DestroyStream()
+	s.serverStreamDone()
+}
+
 func (s *stream) ReadDisable(disable bool) {
 	s.sc.conn.SetReadDisable(disable)
 }
@@ -332,45 +677,94 @@ func (s *stream) AppendHeaders(ctx context.Context, headers types.HeaderMap, end
 	case ClientStream:
 		// use origin request from downstream
 		s.sendCmd = cmd
+		s.oneway = cmd.CommandType() == sofarpc.REQUEST_ONEWAY
+		_, s.streaming = cmd.Get(sofarpc.HeaderStreamingContent)
+		injectTraceContext(ctx, cmd)
+		stripInternalHeaders(cmd)
+
+		// keep offering until the upstream accepts it
+		if s.sc.compressOffer != nil && s.sc.getCompressor() == nil && cmd.Header() != nil {
+			cmd.Set(sofarpc.HeaderFrameCompress, s.sc.compressOffer.Name())
+		}
 	case ServerStream:
+		s.onResponse(ctx, cmd)
+
+		// the client of the one-way request is not listening, the stream is just released
+		if s.oneway {
+			if cmd.CommandType() == sofarpc.RESPONSE {
+				s.sc.logger.Debugf("drop the response of one-way request, id = %d", s.id)
+			} else {
+				status, _ := cmd.Get(types.HeaderStatus)
+				s.sc.logger.Warnf("one-way request failed, id = %d, status = %s", s.id, status)
+			}
+			s.sendCmd = nil
+			if endStream {
+				s.endStream()
+			}
+			return nil
+		}
+
 		switch cmd.CommandType() {
 		case sofarpc.RESPONSE:
 			// use origin response from upstream
 			s.sendCmd = cmd
+			if s.mismatchCodec(cmd) {
+				s.sendCmd = s.codecExceptionResp(cmd)
+			}
 		case sofarpc.REQUEST, sofarpc.REQUEST_ONEWAY:
 			// the command type is request, indicates the invocation is under hijack scene
 			s.sendCmd, err = s.buildHijackResp(cmd)
 		}
+
+		// respond in the version of the request
+		if s.sendCmd != nil {
+			sofarpc.SetProtocolVersion(s.sendCmd, s.version)
+		}
+		stripNegotiationHeaders(s.sendCmd)
+
+		// ack the frame compression offer, compressed frames start from the next response
+		if s.compressAck != "" {
+			if s.sendCmd != nil && s.sendCmd.Header() != nil {
+				s.sendCmd.Set(sofarpc.HeaderFrameCompress, s.compressAck)
+			} else {
+				// no header to carry the ack, try again on the next request
+				s.compressAck = ""
+			}
+		}
 	}
 
 	s.sc.logger.Debugf("AppendHeaders,request id = %d, direction = %d", s.ID, s.direction)
 
 	if endStream {
 		s.endStream()
+	} else if s.streaming {
+		s.beginContent()
 	}
 
 	return err
 }
 
 func (s *stream) buildHijackResp(request sofarpc.SofaRpcCmd) (sofarpc.SofaRpcCmd, error) {
-	if status, ok := request.Get(types.HeaderStatus); ok {
-		request.Del(types.HeaderStatus)
-		statusCode, _ := strconv.Atoi(status)
-
-		hijackResp := sofarpc.NewResponse(request.ProtocolCode(), sofarpc.MappingFromHttpStatus(statusCode))
-		if hijackResp != nil {
-			return hijackResp, nil
-		}
-		return nil, ErrNotResponseBuilder
-	}
-
-	return nil, types.ErrNoStatusCodeForHijack
+	return s.sc.sterilizer.Encode(request)
 }
 
 func (s *stream) AppendData(context context.Context, data types.IoBuffer, endStream bool) error {
-	if s.sendCmd != nil {
-		// TODO: may affect buffer reuse
-		s.sendCmd.SetData(data)
+	if s.streaming {
+		s.writeContent(data, endStream)
+		return nil
+	}
+
+	if s.sendCmd != nil && !s.codecMismatch {
+		if !endStream || s.sendBuf != nil {
+			// the content comes in pieces, buffer up the whole frame
+			s.bufferContent(data)
+			if endStream {
+				s.sendCmd.SetData(s.sendBuf)
+			}
+		} else {
+			// TODO: may affect buffer reuse
+			s.sendCmd.SetData(data)
+		}
 	}
 
 	log.DefaultLogger.Infof("AppendData,request id = %d, direction = %d", s.ID, s.direction)
@@ -410,14 +804,53 @@ func (s *stream) endStream() {
 			return
 		}
 
-		if dataBuf := s.sendCmd.Data(); dataBuf != nil {
-			s.sc.conn.Write(buf, dataBuf)
+		if s.direction == ClientStream && s.sc.keepalive != nil {
+			s.sc.keepalive.active(s.sendCmd.ProtocolCode())
+		}
+
+		compressor := s.sc.getCompressor()
+		if s.compressAck != "" {
+			// the ack itself must be readable by the peer
+			s.sc.setCompressor(sofarpc.GetFrameCompressor(s.compressAck))
+			s.compressAck = ""
+			compressor = nil
+		}
+
+		if compressor != nil {
+			frame, err := sofarpc.EncodeCompressedFrame(compressor, buf, s.sendCmd.Data())
+			if err != nil {
+				s.sc.logger.Errorf("compress frame with %s error:%s", compressor.Name(), err.Error())
+				s.ResetStream(types.StreamLocalReset)
+				return
+			}
+			s.sc.write(s, frame)
+		} else if dataBuf := s.sendCmd.Data(); dataBuf != nil {
+			s.sc.write(s, buf, dataBuf)
 		} else {
-			s.sc.conn.Write(buf)
+			s.sc.write(s, buf)
+		}
+
+		if s.direction == ClientStream && s.oneway {
+			s.onewaySent()
 		}
 	}
 }
 
+// onewaySent releases the client stream of the one-way request once it is written, no response is waited for.
+// The receiver is ended by an empty success response, which is dropped by the one-way server stream
+func (s *stream) onewaySent() {
+	s.sc.mutex.Lock()
+	delete(s.sc.streams, s.id)
+	s.sc.mutex.Unlock()
+
+	resp := sofarpc.NewResponseForRequest(s.sendCmd, sofarpc.RESPONSE_STATUS_SUCCESS, nil)
+	if resp == nil {
+		return
+	}
+	resp.SetRequestID(s.id)
+	s.receiver.OnReceiveHeaders(s.ctx, resp, true)
+}
+
 func (s *stream) GetStream() types.Stream {
 	return s
 }
@@ -0,0 +1,1745 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/network"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	_ "github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc/codec"
+	"github.com/alipay/sofa-mosn/pkg/protocol/serialize"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
+	"github.com/alipay/sofa-mosn/pkg/trace"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type mockConnection struct {
+	types.Connection
+	written      types.IoBuffer
+	closed       bool
+	readDisabled int32
+}
+
+func (c *mockConnection) Write(bufs ...types.IoBuffer) error {
+	for _, buf := range bufs {
+		c.written.Write(buf.Bytes())
+	}
+	return nil
+}
+
+func (c *mockConnection) Close(ccType types.ConnectionCloseType, eventType types.ConnectionEvent) error {
+	c.closed = true
+	return nil
+}
+
+func (c *mockConnection) AddConnectionEventListener(listener types.ConnectionEventListener) {}
+
+func (c *mockConnection) ID() uint64 {
+	return 1
+}
+
+func (c *mockConnection) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12200}
+}
+
+func (c *mockConnection) SetReadDisable(disable bool) {
+	if disable {
+		atomic.AddInt32(&c.readDisabled, 1)
+	} else {
+		atomic.AddInt32(&c.readDisabled, -1)
+	}
+}
+
+// mockServerListener hijacks decode errors as the proxy does
+type mockServerListener struct {
+	sender   types.StreamSender
+	decoded  error
+	received []uint64
+}
+
+func (l *mockServerListener) OnGoAway() {}
+
+func (l *mockServerListener) NewStreamDetect(ctx context.Context, sender types.StreamSender, spanBuilder types.SpanBuilder) types.StreamReceiveListener {
+	l.sender = sender
+	return l
+}
+
+func (l *mockServerListener) OnReceiveHeaders(ctx context.Context, headers types.HeaderMap, endOfStream bool) {
+	if cmd, ok := headers.(sofarpc.SofaRpcCmd); ok {
+		l.received = append(l.received, cmd.RequestID())
+	}
+}
+
+func (l *mockServerListener) OnReceiveData(ctx context.Context, data types.IoBuffer, endOfStream bool) {
+}
+
+func (l *mockServerListener) OnReceiveTrailers(ctx context.Context, trailers types.HeaderMap) {}
+
+func (l *mockServerListener) OnDecodeError(ctx context.Context, err error, headers types.HeaderMap) {
+	l.decoded = err
+	code := types.UnknownCode
+	switch err {
+	case types.ErrDeserializeException:
+		code = types.DeserialExceptionCode
+	case types.ErrCodecException:
+		code = types.CodecExceptionCode
+	}
+	headers.Set(types.HeaderStatus, strconv.Itoa(code))
+	l.sender.AppendHeaders(ctx, headers, true)
+}
+
+func TestDeserializeErrorResponse(t *testing.T) {
+	ctx := buffer.NewBufferPoolContext(context.Background())
+	req := &sofarpc.BoltRequest{
+		Protocol:  sofarpc.PROTOCOL_CODE_V1,
+		CmdType:   sofarpc.REQUEST,
+		CmdCode:   sofarpc.RPC_REQUEST,
+		Version:   1,
+		ReqID:     7,
+		Codec:     sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:   3000,
+		HeaderLen: 5,
+		// key length exceeds the header map
+		HeaderMap: []byte{0, 0, 0, 100, 'a'},
+	}
+	frame, err := sofarpc.Engine().Encode(ctx, req)
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(context.Background(), conn, nil, listener)
+	sc.Dispatch(frame)
+
+	if listener.decoded != types.ErrDeserializeException {
+		t.Fatalf("expect deserialize exception, got %v", listener.decoded)
+	}
+	if conn.closed {
+		t.Fatal("connection should not be closed on deserialize exception")
+	}
+
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	resp, ok := cmd.(*sofarpc.BoltResponse)
+	if !ok {
+		t.Fatalf("expect bolt response, got %T", cmd)
+	}
+	if resp.ReqID != req.ReqID {
+		t.Errorf("expect request id %d, got %d", req.ReqID, resp.ReqID)
+	}
+	if resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION {
+		t.Errorf("expect status %d, got %d", sofarpc.RESPONSE_STATUS_SERVER_DESERIAL_EXCEPTION, resp.ResponseStatus)
+	}
+}
+
+func TestHijackResponseWithReason(t *testing.T) {
+	// the reasons are overridden by the listener config
+	reasons := map[int]string{types.RouterUnavailableCode: "no route", types.NoHealthUpstreamCode: ""}
+	listenerCtx := context.WithValue(context.Background(), types.ContextKeyListenerConfig, &v2.ListenerConfig{HijackReasons: reasons})
+
+	ctx := buffer.NewBufferPoolContext(context.Background())
+	req := &sofarpc.BoltRequest{
+		Protocol: sofarpc.PROTOCOL_CODE_V1,
+		CmdType:  sofarpc.REQUEST,
+		CmdCode:  sofarpc.RPC_REQUEST,
+		Version:  1,
+		ReqID:    9,
+		Codec:    sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:  3000,
+	}
+	req.RequestHeader = map[string]string{types.HeaderStatus: strconv.Itoa(types.RouterUnavailableCode)}
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc := newStreamConnection(listenerCtx, conn, nil, &mockServerListener{})
+	s := sc.(*streamConnection).onNewStreamDetect(ctx, req, nil)
+	s.AppendHeaders(ctx, req, true)
+
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	resp := cmd.(*sofarpc.BoltResponse)
+	if resp.ResponseStatus != sofarpc.RESPONSE_STATUS_NO_PROCESSOR {
+		t.Errorf("expect status %d, got %d", sofarpc.RESPONSE_STATUS_NO_PROCESSOR, resp.ResponseStatus)
+	}
+	// the content is a SofaResponse with the error message, as the SofaRPC server responds
+	expected := serialize.EncodeHessian2Object(sofarpc.SofaResponseClass,
+		[]string{"isError", "errorMsg"}, []interface{}{true, "no route"})
+	if resp.Content == nil || string(resp.Content.Bytes()) != string(expected) {
+		t.Errorf("unexpected response body: %v", resp.Content)
+	}
+	if class, _ := serialize.Instance.Serialize(sofarpc.SofaResponseClass); string(resp.ClassName) != string(class) {
+		t.Errorf("expect response class %s, got %s", sofarpc.SofaResponseClass, resp.ClassName)
+	}
+	if conn.written.Len() != 0 {
+		t.Errorf("response frame is not fully consumed, %d bytes left", conn.written.Len())
+	}
+
+	// an empty reason means no body
+	req.RequestHeader = map[string]string{types.HeaderStatus: strconv.Itoa(types.NoHealthUpstreamCode)}
+	s = sc.(*streamConnection).onNewStreamDetect(ctx, req, nil)
+	s.AppendHeaders(ctx, req, true)
+	cmd, _ = sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ContentLen != 0 || len(resp.ClassName) != 0 {
+		t.Errorf("expect no body, got %d bytes of class %s", resp.ContentLen, resp.ClassName)
+	}
+
+	// other connections keep the default reasons
+	if reason := newStreamConnection(context.Background(), nil, nil, nil).(*streamConnection).
+		hijackReasons[types.RouterUnavailableCode]; reason != defaultHijackReasons[types.RouterUnavailableCode] {
+		t.Errorf("expect the default reason, got %s", reason)
+	}
+}
+
+func TestSerializeType(t *testing.T) {
+	newRequest := func(id uint32, codec byte) *sofarpc.BoltRequest {
+		req := newContentRequest(id, "")
+		req.Codec = codec
+		return req
+	}
+	decodeResponse := func(conn *mockConnection) *sofarpc.BoltResponse {
+		cmd, _ := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+		resp, ok := cmd.(*sofarpc.BoltResponse)
+		if !ok {
+			t.Fatalf("expect bolt response, got %T", cmd)
+		}
+		return resp
+	}
+	codecReason := defaultHijackReasons[types.CodecExceptionCode]
+
+	// the hijack response is in the serialization of the request
+	ctx := buffer.NewBufferPoolContext(context.Background())
+	req := newRequest(1, sofarpc.PROTOBUF_SERIALIZE)
+	req.RequestHeader[types.HeaderStatus] = strconv.Itoa(types.RouterUnavailableCode)
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc := newStreamConnection(context.Background(), conn, nil, &mockServerListener{})
+	s := sc.(*streamConnection).onNewStreamDetect(ctx, req, nil)
+	s.AppendHeaders(ctx, req, true)
+	resp := decodeResponse(conn)
+	if resp.Codec != sofarpc.PROTOBUF_SERIALIZE || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_NO_PROCESSOR {
+		t.Errorf("expect protobuf response of no processor, got codec %d, status %d", resp.Codec, resp.ResponseStatus)
+	}
+	// the protobuf content is the error message marked by the header
+	if resp.Content == nil || string(resp.Content.Bytes()) != defaultHijackReasons[types.RouterUnavailableCode] {
+		t.Errorf("unexpected response body: %v", resp.Content)
+	}
+	if resp.ResponseHeader[sofarpc.HeaderResponseError] != "true" {
+		t.Errorf("expect the error header, got %v", resp.ResponseHeader)
+	}
+
+	// the response in another serialization is replaced by the codec exception, the content is dropped
+	ctx = buffer.NewBufferPoolContext(context.Background())
+	s = sc.(*streamConnection).onNewStreamDetect(ctx, newRequest(2, sofarpc.PROTOBUF_SERIALIZE), nil)
+	upstream := sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS)
+	s.AppendHeaders(ctx, upstream, false)
+	s.AppendData(ctx, buffer.NewIoBufferString("hessian content"), true)
+	resp = decodeResponse(conn)
+	if resp.ReqID != 2 || resp.Codec != sofarpc.PROTOBUF_SERIALIZE || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION {
+		t.Errorf("expect protobuf codec exception of stream 2, got stream %d, codec %d, status %d",
+			resp.ReqID, resp.Codec, resp.ResponseStatus)
+	}
+	if resp.Content == nil || string(resp.Content.Bytes()) != codecReason {
+		t.Errorf("unexpected response body: %v", resp.Content)
+	}
+
+	// the unknown serialization is a codec exception of the stream
+	frame, _ := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), newRequest(3, 99))
+	listener := &mockServerListener{}
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc = newStreamConnection(context.Background(), conn, nil, listener)
+	sc.Dispatch(frame)
+	if listener.decoded != types.ErrCodecException || conn.closed {
+		t.Fatalf("expect codec exception with the connection kept, got %v, closed %v", listener.decoded, conn.closed)
+	}
+	resp = decodeResponse(conn)
+	if resp.ReqID != 3 || resp.Codec != 99 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION {
+		t.Errorf("expect codec exception of stream 3, got stream %d, codec %d, status %d",
+			resp.ReqID, resp.Codec, resp.ResponseStatus)
+	}
+	if resp.ContentLen != 0 {
+		t.Errorf("expect no body in the unknown serialization, got %d bytes", resp.ContentLen)
+	}
+}
+
+func TestOnewayRequest(t *testing.T) {
+	req := &sofarpc.BoltRequest{
+		Protocol: sofarpc.PROTOCOL_CODE_V1,
+		CmdType:  sofarpc.REQUEST_ONEWAY,
+		CmdCode:  sofarpc.RPC_REQUEST,
+		Version:  1,
+		ReqID:    11,
+		Codec:    sofarpc.HESSIAN2_SERIALIZE,
+	}
+	frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+
+	// the failed one-way request is released without any response
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(context.Background(), conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	sc.Dispatch(frame)
+	if !reflect.DeepEqual(listener.received, []uint64{11}) {
+		t.Fatalf("expect the one-way request passed, got %v", listener.received)
+	}
+	hijack := &sofarpc.BoltRequest{
+		Protocol:      sofarpc.PROTOCOL_CODE_V1,
+		CmdType:       sofarpc.REQUEST_ONEWAY,
+		CmdCode:       sofarpc.RPC_REQUEST,
+		RequestHeader: map[string]string{types.HeaderStatus: strconv.Itoa(types.NoHealthUpstreamCode)},
+	}
+	listener.sender.AppendHeaders(context.Background(), hijack, true)
+	if conn.written.Len() != 0 {
+		t.Errorf("expect no response written for the one-way request, got %d bytes", conn.written.Len())
+	}
+	if active := atomic.LoadInt32(&sc.activeServerStreams); active != 0 {
+		t.Errorf("expect the one-way stream released, %d active", active)
+	}
+
+	// the upstream stream is not kept for a response, the receiver is ended once the request is written
+	upConn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	client := newStreamConnection(context.Background(), upConn, &mockServerListener{}, nil).(*streamConnection)
+	receiver := &mockServerListener{}
+	sender := client.NewStream(buffer.NewBufferPoolContext(context.Background()), receiver)
+	req.ReqID = 0
+	sender.AppendHeaders(context.Background(), req, true)
+	if upConn.written.Len() == 0 {
+		t.Fatal("expect the one-way request written upstream")
+	}
+	if len(client.streams) != 0 {
+		t.Errorf("expect no stream waiting for the response, got %d", len(client.streams))
+	}
+	if len(receiver.received) != 1 {
+		t.Errorf("expect the receiver ended, got %v", receiver.received)
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	newFrame := func(id uint32, version byte) types.IoBuffer {
+		req := &sofarpc.BoltRequestV2{
+			BoltRequest: sofarpc.BoltRequest{
+				Protocol: sofarpc.PROTOCOL_CODE_V2,
+				CmdType:  sofarpc.REQUEST,
+				CmdCode:  sofarpc.RPC_REQUEST,
+				Version:  1,
+				ReqID:    id,
+				Codec:    sofarpc.HESSIAN2_SERIALIZE,
+				Timeout:  3000,
+			},
+			Version1: version,
+		}
+		frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+		if err != nil {
+			t.Fatalf("encode request failed: %v", err)
+		}
+		return frame
+	}
+	decodeResponse := func(conn *mockConnection) *sofarpc.BoltResponseV2 {
+		cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+		if err != nil {
+			t.Fatalf("decode response failed: %v", err)
+		}
+		return cmd.(*sofarpc.BoltResponseV2)
+	}
+
+	// the version is exposed to the router and the response is in the same version
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &versionListener{}
+	newStreamConnection(context.Background(), conn, nil, listener).Dispatch(newFrame(3, sofarpc.PROTOCOL_VERSION_1))
+	if listener.version != "1" {
+		t.Errorf("expect version header 1, got %s", listener.version)
+	}
+	if resp := decodeResponse(conn); resp.ReqID != 3 || resp.Version1 != sofarpc.PROTOCOL_VERSION_1 {
+		t.Errorf("expect response of stream 3 in version 1, got %d in version %d", resp.ReqID, resp.Version1)
+	}
+
+	// unknown version is rejected, not misparsed
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	errListener := &mockServerListener{}
+	newStreamConnection(context.Background(), conn, nil, errListener).Dispatch(newFrame(5, 9))
+	if errListener.decoded != types.ErrCodecException || errListener.received != nil {
+		t.Errorf("expect codec exception, got %v", errListener.decoded)
+	}
+	if !conn.closed {
+		t.Error("connection should be closed after the unknown version request")
+	}
+	resp := decodeResponse(conn)
+	if resp.ReqID != 5 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION {
+		t.Errorf("expect codec exception response of stream 5, got %d, status %d", resp.ReqID, resp.ResponseStatus)
+	}
+	if !sofarpc.IsVersionSupported(sofarpc.PROTOCOL_CODE_V2, resp.Version1) {
+		t.Errorf("response in unknown version %d", resp.Version1)
+	}
+}
+
+// versionListener records the version header and hijacks the request
+type versionListener struct {
+	mockServerListener
+	version string
+}
+
+func (l *versionListener) NewStreamDetect(ctx context.Context, sender types.StreamSender, spanBuilder types.SpanBuilder) types.StreamReceiveListener {
+	l.sender = sender
+	return l
+}
+
+func (l *versionListener) OnReceiveHeaders(ctx context.Context, headers types.HeaderMap, endOfStream bool) {
+	l.version, _ = headers.Get(sofarpc.HeaderProtocolVersion)
+	headers.Set(types.HeaderStatus, strconv.Itoa(types.RouterUnavailableCode))
+	l.sender.AppendHeaders(ctx, headers, true)
+}
+
+func TestGracefulCodecReset(t *testing.T) {
+	newFrames := func() types.IoBuffer {
+		ctx := buffer.NewBufferPoolContext(context.Background())
+		frames := buffer.NewIoBuffer(256)
+		for _, req := range []*sofarpc.BoltRequest{
+			{
+				Protocol:  sofarpc.PROTOCOL_CODE_V1,
+				CmdType:   sofarpc.REQUEST,
+				CmdCode:   sofarpc.RPC_REQUEST,
+				Version:   1,
+				ReqID:     7,
+				Codec:     sofarpc.HESSIAN2_SERIALIZE,
+				Timeout:   3000,
+				HeaderLen: 5,
+				// key length exceeds the header map
+				HeaderMap: []byte{0, 0, 0, 100, 'a'},
+			},
+			{
+				Protocol: sofarpc.PROTOCOL_CODE_V1,
+				CmdType:  sofarpc.REQUEST,
+				CmdCode:  sofarpc.RPC_REQUEST,
+				Version:  1,
+				ReqID:    8,
+				Codec:    sofarpc.HESSIAN2_SERIALIZE,
+				Timeout:  3000,
+			},
+		} {
+			frame, err := sofarpc.Engine().Encode(ctx, req)
+			if err != nil {
+				t.Fatalf("encode request failed: %v", err)
+			}
+			frames.Write(frame.Bytes())
+		}
+		return frames
+	}
+
+	testCases := []struct {
+		graceful bool
+		received []uint64
+	}{
+		{false, nil},
+		{true, []uint64{8}},
+	}
+
+	for _, tc := range testCases {
+		ctx := context.WithValue(context.Background(), types.ContextKeyListenerConfig, &v2.ListenerConfig{GracefulCodecReset: tc.graceful})
+		conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+		listener := &mockServerListener{}
+		sc := newStreamConnection(ctx, conn, nil, listener)
+		sc.Dispatch(newFrames())
+
+		if listener.decoded != types.ErrDeserializeException {
+			t.Errorf("graceful %v: expect deserialize exception, got %v", tc.graceful, listener.decoded)
+		}
+		if conn.closed {
+			t.Errorf("graceful %v: connection should not be closed", tc.graceful)
+		}
+		if !reflect.DeepEqual(listener.received, tc.received) {
+			t.Errorf("graceful %v: expect received streams %v, got %v", tc.graceful, tc.received, listener.received)
+		}
+
+		// the broken stream is reset with the codec exception response
+		cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+		if err != nil {
+			t.Fatalf("decode response failed: %v", err)
+		}
+		if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 7 {
+			t.Errorf("graceful %v: expect response of stream 7, got %d", tc.graceful, resp.ReqID)
+		}
+	}
+}
+
+func TestPayloadSizeLimit(t *testing.T) {
+	// frame header claims the content length
+	newFrame := func(cmdType byte, lenOffset int, contentLen uint32) types.IoBuffer {
+		frame := newRequestFrame(t, 13)
+		bytes := frame.Bytes()
+		bytes[1] = cmdType
+		binary.BigEndian.PutUint32(bytes[lenOffset:], contentLen)
+		return frame
+	}
+
+	// the absurd length is rejected by the default limit
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	newStreamConnection(context.Background(), conn, nil, listener).Dispatch(newFrame(sofarpc.REQUEST, 18, 0xfffffff0))
+	if listener.decoded != types.ErrCodecException || !conn.closed {
+		t.Fatalf("expect the absurd length rejected by default, got %v", listener.decoded)
+	}
+
+	// under the limit of the listener, wait for the whole frame
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerConfig, &v2.ListenerConfig{MaxRequestPayload: 1024})
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener = &mockServerListener{}
+	newStreamConnection(ctx, conn, nil, listener).Dispatch(newFrame(sofarpc.REQUEST, 18, 512))
+	if listener.decoded != nil || listener.received != nil || conn.closed {
+		t.Fatal("the frame under the limit should be waited for")
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener = &mockServerListener{}
+	newStreamConnection(ctx, conn, nil, listener).Dispatch(newFrame(sofarpc.REQUEST, 18, 2048))
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("unexpected allocation of %d bytes", alloc)
+	}
+
+	if listener.decoded != types.ErrCodecException {
+		t.Errorf("expect codec exception, got %v", listener.decoded)
+	}
+	if !conn.closed {
+		t.Error("connection should be closed after the oversized request")
+	}
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 13 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_CODEC_EXCEPTION {
+		t.Errorf("expect codec exception response of stream 13, got %d, status %d", resp.ReqID, resp.ResponseStatus)
+	}
+
+	// oversized response closes the connection, the limit is of the cluster
+	ctx = context.WithValue(context.Background(), types.ContextKeyMaxResponsePayload, uint64(1024))
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	newStreamConnection(ctx, conn, nil, nil).Dispatch(newFrame(sofarpc.RESPONSE, 16, 2048))
+	if !conn.closed {
+		t.Error("connection should be closed after the oversized response")
+	}
+	if conn.written.Len() != 0 {
+		t.Error("nothing should be written for the oversized response")
+	}
+}
+
+type mockHostInfo struct {
+	types.HostInfo
+	addr string
+}
+
+func (h *mockHostInfo) AddressString() string {
+	return h.addr
+}
+
+func TestAccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sofarpc_access_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "access.log")
+	listenerCtx := context.WithValue(context.Background(), types.ContextKeyListenerName, "access_log_test")
+	listenerCtx = context.WithValue(listenerCtx, types.ContextKeyListenerConfig, &v2.ListenerConfig{StreamAccessLog: &v2.AccessLog{
+		Path:   output,
+		Format: "%request_id% %service%.%method% %upstream_host% %status_code% %response_status% %unknown%",
+	}})
+
+	newRequest := func(id uint32) *sofarpc.BoltRequest {
+		return &sofarpc.BoltRequest{
+			Protocol: sofarpc.PROTOCOL_CODE_V1,
+			CmdType:  sofarpc.REQUEST,
+			CmdCode:  sofarpc.RPC_REQUEST,
+			Version:  1,
+			ReqID:    id,
+			Codec:    sofarpc.HESSIAN2_SERIALIZE,
+			Timeout:  3000,
+			RequestHeader: map[string]string{
+				models.SERVICE_KEY:   "com.alipay.test.TestService:1.0",
+				models.TARGET_METHOD: "sayHello",
+			},
+		}
+	}
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(listenerCtx, conn, nil, listener)
+	defer drainer.remove(sc.(*streamConnection))
+	dispatch := func(id uint32) {
+		frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), newRequest(id))
+		if err != nil {
+			t.Fatalf("encode request failed: %v", err)
+		}
+		sc.Dispatch(frame)
+	}
+
+	// responded by the upstream
+	dispatch(1)
+	info := network.NewRequestInfo()
+	info.OnUpstreamHostSelected(&mockHostInfo{addr: "127.0.0.1:12200"})
+	info.SetResponseCode(uint32(types.SuccessCode))
+	ctx := context.WithValue(context.Background(), types.ContextKeyRequestInfo, info)
+	listener.sender.AppendHeaders(ctx, sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS), true)
+
+	// hijacked on timeout
+	dispatch(2)
+	req := newRequest(2)
+	req.Set(types.HeaderStatus, strconv.Itoa(types.TimeoutExceptionCode))
+	listener.sender.AppendHeaders(context.Background(), req, true)
+
+	// reset without response
+	dispatch(3)
+	listener.sender.GetStream().ResetStream(types.StreamConnectionTermination)
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatalf("read access log failed: %v", err)
+	}
+	expected := []string{
+		"1 com.alipay.test.TestService:1.0.sayHello 127.0.0.1:12200 200 0 %unknown%",
+		"2 com.alipay.test.TestService:1.0.sayHello - " + strconv.Itoa(types.TimeoutExceptionCode) + " " +
+			strconv.Itoa(int(sofarpc.RESPONSE_STATUS_TIMEOUT)) + " %unknown%",
+		"3 com.alipay.test.TestService:1.0.sayHello - - - %unknown%",
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expect %d lines, got access log:\n%s", len(expected), data)
+	}
+	for i, line := range lines {
+		// prefixed with the log time
+		if !strings.HasSuffix(line, " "+expected[i]) {
+			t.Errorf("expect %s, got %s", expected[i], line)
+		}
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	s := &stream{id: 5, access: accessLogInfo{service: "svc"}}
+	for format, expected := range map[string]string{
+		"%request_id%":             "5",
+		"id=%request_id%,%service": "id=5,%service",
+		"%%request_id%%":           "%5%",
+		"%foo%service%":            "%foosvc",
+		"100%":                     "100%",
+	} {
+		l := &accessLog{formatters: parseAccessLogFormat(format)}
+		var b strings.Builder
+		for _, f := range l.formatters {
+			b.WriteString(f(s))
+		}
+		if b.String() != expected {
+			t.Errorf("format %s: expect %s, got %s", format, expected, b.String())
+		}
+	}
+}
+
+func TestTimeoutResponseStatus(t *testing.T) {
+	for _, code := range []int{types.TimeoutExceptionCode, types.TryTimeoutExceptionCode} {
+		ctx := buffer.NewBufferPoolContext(context.Background())
+		req := &sofarpc.BoltRequest{
+			Protocol: sofarpc.PROTOCOL_CODE_V1,
+			CmdType:  sofarpc.REQUEST,
+			CmdCode:  sofarpc.RPC_REQUEST,
+			Version:  1,
+			ReqID:    11,
+			Codec:    sofarpc.HESSIAN2_SERIALIZE,
+			Timeout:  3000,
+		}
+		// the proxy hijacks the timeout with the status header
+		req.RequestHeader = map[string]string{types.HeaderStatus: strconv.Itoa(code)}
+
+		conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+		sc := newStreamConnection(context.Background(), conn, nil, &mockServerListener{})
+		s := sc.(*streamConnection).onNewStreamDetect(ctx, req, nil)
+		s.AppendHeaders(ctx, req, true)
+
+		cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+		if err != nil {
+			t.Fatalf("decode response failed: %v", err)
+		}
+		resp := cmd.(*sofarpc.BoltResponse)
+		if resp.ResponseStatus != sofarpc.RESPONSE_STATUS_TIMEOUT {
+			t.Errorf("code %d: expect status %d, got %d", code, sofarpc.RESPONSE_STATUS_TIMEOUT, resp.ResponseStatus)
+		}
+		expected := serialize.EncodeHessian2Object(sofarpc.SofaResponseClass,
+			[]string{"isError", "errorMsg"}, []interface{}{true, defaultHijackReasons[code]})
+		if resp.Content == nil || string(resp.Content.Bytes()) != string(expected) {
+			t.Errorf("code %d: unexpected response body: %v", code, resp.Content)
+		}
+	}
+}
+
+func newRequestFrame(t *testing.T, id uint32) types.IoBuffer {
+	req := &sofarpc.BoltRequest{
+		Protocol: sofarpc.PROTOCOL_CODE_V1,
+		CmdType:  sofarpc.REQUEST,
+		CmdCode:  sofarpc.RPC_REQUEST,
+		Version:  1,
+		ReqID:    id,
+		Codec:    sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:  3000,
+	}
+	frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+	return frame
+}
+
+func TestDrain(t *testing.T) {
+	defer func() {
+		drainer = &connDrainer{conns: make(map[*streamConnection]struct{})}
+	}()
+
+	busyConn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(context.Background(), busyConn, nil, listener)
+	sc.Dispatch(newRequestFrame(t, 1))
+
+	idleConn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	newStreamConnection(context.Background(), idleConn, nil, &mockServerListener{})
+
+	StartDrain()
+	if !idleConn.closed {
+		t.Error("idle connection should be closed on drain")
+	}
+	if busyConn.closed {
+		t.Fatal("connection with in-flight stream should not be closed")
+	}
+
+	// new request is rejected on the draining connection
+	sc.Dispatch(newRequestFrame(t, 2))
+	if !reflect.DeepEqual(listener.received, []uint64{1}) {
+		t.Errorf("expect only stream 1 passed to the proxy, got %v", listener.received)
+	}
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), busyConn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 2 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect busy response of stream 2, got stream %d status %d", resp.ReqID, resp.ResponseStatus)
+	} else if hint := resp.ResponseHeader[HeaderConnection]; hint != ConnectionClose {
+		t.Errorf("expect connection close hint on the rejected response, got %q", hint)
+	}
+	if busyConn.closed {
+		t.Fatal("connection with in-flight stream should not be closed")
+	}
+
+	// the in-flight stream completes, then the connection is closed
+	resp := sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS)
+	listener.sender.AppendHeaders(context.Background(), resp, true)
+	cmd, err = sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), busyConn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 1 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SUCCESS {
+		t.Errorf("expect success response of stream 1, got stream %d status %d", resp.ReqID, resp.ResponseStatus)
+	}
+	if !busyConn.closed {
+		t.Error("drained connection should be closed")
+	}
+}
+
+func TestHeartbeatReply(t *testing.T) {
+	hb := sofarpc.NewHeartbeat(sofarpc.PROTOCOL_CODE_V1)
+	hb.SetRequestID(11)
+	frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), hb)
+	if err != nil {
+		t.Fatalf("encode heartbeat failed: %v", err)
+	}
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(context.Background(), conn, nil, listener)
+	sc.Dispatch(frame)
+
+	if listener.sender != nil || len(listener.received) != 0 {
+		t.Fatal("heartbeat should not be passed to the proxy")
+	}
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode heartbeat ack failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 11 || resp.CmdCode != sofarpc.HEARTBEAT {
+		t.Errorf("expect heartbeat ack of 11, got id %d cmd code %d", resp.ReqID, resp.CmdCode)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	interval := 20 * time.Millisecond
+	ctx := context.WithValue(context.Background(), types.ContextKeyHeartbeatInterval, interval)
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc := newStreamConnection(ctx, conn, &mockServerListener{}, nil).(*streamConnection)
+	if sc.keepalive == nil {
+		t.Fatal("keepalive should be enabled by the heartbeat interval")
+	}
+
+	// no heartbeat before the first request
+	time.Sleep(3 * interval)
+	if conn.written.Len() != 0 {
+		t.Fatal("heartbeat sent before the first request")
+	}
+
+	sc.keepalive.active(sofarpc.PROTOCOL_CODE_V1)
+	time.Sleep(3 * interval / 2)
+	sc.OnEvent(types.RemoteClose)
+
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil || cmd == nil {
+		t.Fatalf("decode heartbeat failed: %v", err)
+	}
+	if req := cmd.(*sofarpc.BoltRequest); req.CmdType != sofarpc.REQUEST || req.CmdCode != sofarpc.HEARTBEAT {
+		t.Errorf("expect heartbeat request, got cmd type %d cmd code %d", req.CmdType, req.CmdCode)
+	}
+
+	// no heartbeat after the connection is closed
+	written := conn.written.Len()
+	time.Sleep(3 * interval)
+	if conn.written.Len() != written {
+		t.Error("heartbeat sent after the connection is closed")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "idle_test")
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{IdleTimeout: v2.DurationConfig{Duration: timeout}})
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	// stats of the listener are kept globally, counts from the delta
+	closedBase := sc.idle.closed.Count()
+
+	// the heartbeats keep the connection alive
+	for i := 0; i < 5; i++ {
+		hb := sofarpc.NewHeartbeat(sofarpc.PROTOCOL_CODE_V1)
+		hb.SetRequestID(uint64(i))
+		frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), hb)
+		if err != nil {
+			t.Fatalf("encode heartbeat failed: %v", err)
+		}
+		sc.Dispatch(frame)
+		time.Sleep(timeout / 2)
+	}
+	if conn.closed {
+		t.Fatal("connection receiving heartbeats should not be closed")
+	}
+
+	// the connection is not idle while the request is in flight
+	sc.Dispatch(newRequestFrame(t, 1))
+	time.Sleep(3 * timeout)
+	if conn.closed {
+		t.Fatal("connection with the request in flight should not be closed")
+	}
+
+	resp := sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS)
+	listener.sender.AppendHeaders(context.Background(), resp, true)
+	time.Sleep(3 * timeout)
+	if !conn.closed {
+		t.Fatal("idle connection should be closed")
+	}
+	if closed := sc.idle.closed.Count() - closedBase; closed != 1 {
+		t.Errorf("expect 1 idle close, got %d", closed)
+	}
+	sc.OnEvent(types.LocalClose)
+
+	// disabled by default
+	sc = newStreamConnection(context.Background(), conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	if sc.idle != nil {
+		t.Error("idle timeout should be disabled by default")
+	}
+}
+
+func newHeartbeatFrame(t *testing.T, id uint64) types.IoBuffer {
+	hb := sofarpc.NewHeartbeat(sofarpc.PROTOCOL_CODE_V1)
+	hb.SetRequestID(id)
+	frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), hb)
+	if err != nil {
+		t.Fatalf("encode heartbeat failed: %v", err)
+	}
+	return frame
+}
+
+func TestFrameRateLimit(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "frame_rate_test")
+	limitCtx := context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{FrameRateLimit: &v2.FrameRate{
+		FramesPerSecond: 10, Burst: 2, HeartbeatsPerSecond: 5, Pause: v2.DurationConfig{Duration: 50 * time.Millisecond},
+	}})
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(limitCtx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	// stats of the listener are kept globally, counts from the delta
+	limitedBase := sc.frameLimiter.limited.Count()
+
+	// the heartbeats are limited in their own bucket, the burst is 1 by the ratio
+	buf := buffer.NewIoBuffer(1024)
+	buf.Write(newHeartbeatFrame(t, 1).Bytes())
+	buf.Write(newHeartbeatFrame(t, 2).Bytes())
+	sc.Dispatch(buf)
+	if atomic.LoadInt32(&conn.readDisabled) != 1 {
+		t.Fatal("expect the read stopped by the heartbeats exceeding the limit")
+	}
+	// the frames read already are handled
+	if buf.Len() != 0 {
+		t.Errorf("expect the frames read handled, %d bytes left", buf.Len())
+	}
+
+	// the requests have the whole burst
+	buf.Write(newRequestFrame(t, 3).Bytes())
+	buf.Write(newRequestFrame(t, 4).Bytes())
+	sc.Dispatch(buf)
+	if !reflect.DeepEqual(listener.received, []uint64{3, 4}) {
+		t.Fatalf("expect the requests within the burst passed, got %v", listener.received)
+	}
+	if limited := sc.frameLimiter.limited.Count() - limitedBase; limited != 1 {
+		t.Errorf("expect 1 limited, got %d", limited)
+	}
+
+	// the read is resumed after the pause
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&conn.readDisabled) != 0 {
+		t.Error("expect the read resumed after the pause")
+	}
+
+	// the read is not resumed on the connection closed during the pause
+	buf.Write(newHeartbeatFrame(t, 7).Bytes())
+	buf.Write(newHeartbeatFrame(t, 8).Bytes())
+	sc.Dispatch(buf)
+	sc.OnEvent(types.RemoteClose)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&conn.readDisabled) != 1 {
+		t.Error("expect the read of the closed connection not resumed")
+	}
+
+	// the connection exceeding the limit is closed if configured
+	limitCtx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{FrameRateLimit: &v2.FrameRate{FramesPerSecond: 1, Close: true}})
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener = &mockServerListener{}
+	sc = newStreamConnection(limitCtx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	buf.Write(newRequestFrame(t, 5).Bytes())
+	buf.Write(newRequestFrame(t, 6).Bytes())
+	sc.Dispatch(buf)
+	if !conn.closed || !reflect.DeepEqual(listener.received, []uint64{5}) {
+		t.Errorf("expect the connection closed before stream 6, closed %v, got %v", conn.closed, listener.received)
+	}
+}
+
+// recordHook records the lifecycle events
+type recordHook struct {
+	events chan string
+}
+
+func (h *recordHook) OnConnectionAccept(conn ConnectionInfo) {
+	h.events <- fmt.Sprintf("accept %d %s %s", conn.ID, conn.RemoteAddr, conn.Listener)
+}
+
+func (h *recordHook) OnConnectionClose(conn ConnectionInfo, event types.ConnectionEvent) {
+	h.events <- fmt.Sprintf("close %d %s", conn.ID, event)
+}
+
+func (h *recordHook) OnStreamStart(stream *StreamInfo) {
+	h.events <- fmt.Sprintf("start %d service=%s", stream.ID, stream.Headers["service"])
+}
+
+func (h *recordHook) OnStreamEnd(stream *StreamInfo, status int, duration time.Duration) {
+	h.events <- fmt.Sprintf("end %d %d", stream.ID, status)
+}
+
+// panicHook is broken on all the events
+type panicHook struct{}
+
+func (h *panicHook) OnConnectionAccept(conn ConnectionInfo) {
+	panic("broken hook")
+}
+
+func (h *panicHook) OnConnectionClose(conn ConnectionInfo, event types.ConnectionEvent) {
+	panic("broken hook")
+}
+
+func (h *panicHook) OnStreamStart(stream *StreamInfo) {
+	panic("broken hook")
+}
+
+func (h *panicHook) OnStreamEnd(stream *StreamInfo, status int, duration time.Duration) {
+	panic("broken hook")
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	hook := &recordHook{events: make(chan string, 8)}
+	RegisterLifecycleHook("record", func(config map[string]interface{}) (LifecycleHook, error) {
+		if config["name"] != "audit" {
+			return nil, errors.New("unexpected config")
+		}
+		return hook, nil
+	})
+	RegisterLifecycleHook("panic", func(config map[string]interface{}) (LifecycleHook, error) {
+		return &panicHook{}, nil
+	})
+	configs := []v2.Filter{
+		{Type: "panic"},
+		{Type: "unknown"},
+		{Type: "record", Config: map[string]interface{}{"name": "audit"}},
+	}
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "hook_test")
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{LifecycleHooks: configs})
+	expect := func(expected string) {
+		select {
+		case event := <-hook.events:
+			if event != expected {
+				t.Fatalf("expect event %q, got %q", expected, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expect event %q", expected)
+		}
+	}
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	// the broken hook doesn't stop the others
+	expect("accept 1 127.0.0.1:12200 hook_test")
+
+	frame, _ := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), newContentRequest(5, "hello"))
+	sc.Dispatch(buffer.NewIoBufferBytes(append(frame.Bytes(), "hello"...)))
+	expect("start 5 service=test")
+	hijack := newContentRequest(5, "")
+	hijack.RequestHeader[types.HeaderStatus] = strconv.Itoa(types.NoHealthUpstreamCode)
+	listener.sender.AppendHeaders(context.Background(), hijack, true)
+	expect("end 5 502")
+
+	sc.OnEvent(types.RemoteClose)
+	expect("close 1 RemoteClose")
+
+	// the hooks are created once for the listener
+	if h := getLifecycleHooks("hook_test", configs); h != sc.hooks {
+		t.Error("expect the hooks of the listener reused")
+	}
+	if newStreamConnection(context.Background(), conn, nil, listener).(*streamConnection).hooks != nil {
+		t.Error("expect no hooks without the config")
+	}
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "concurrency_test")
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{MaxConcurrentStreams: 1})
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	// stats of the listener are kept globally, counts from the delta
+	overflowBase := sc.concurrencyStats.overflow.Count()
+
+	sc.Dispatch(newRequestFrame(t, 1))
+	sc.Dispatch(newRequestFrame(t, 2))
+	if !reflect.DeepEqual(listener.received, []uint64{1}) {
+		t.Fatalf("expect only stream 1 passed to the proxy, got %v", listener.received)
+	}
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 2 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect busy response of stream 2, got stream %d status %d", resp.ReqID, resp.ResponseStatus)
+	}
+	if overflow := sc.concurrencyStats.overflow.Count() - overflowBase; overflow != 1 {
+		t.Errorf("expect 1 overflow, got %d", overflow)
+	}
+
+	// accepted again once the in-flight stream completes
+	resp := sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS)
+	listener.sender.AppendHeaders(context.Background(), resp, true)
+	sc.Dispatch(newRequestFrame(t, 3))
+	if !reflect.DeepEqual(listener.received, []uint64{1, 3}) {
+		t.Errorf("expect stream 3 passed to the proxy, got %v", listener.received)
+	}
+	if max := sc.concurrencyStats.streams.Max(); max != 1 {
+		t.Errorf("expect max concurrency 1, got %d", max)
+	}
+
+	// the in-flight stream is dropped with the connection
+	sc.OnEvent(types.RemoteClose)
+	listener.sender.GetStream().ResetStream(types.StreamConnectionTermination)
+	if active := atomic.LoadInt32(&sc.activeServerStreams); active != 0 {
+		t.Errorf("expect no active stream after close, got %d", active)
+	}
+}
+
+func newPriorityRequestFrame(t *testing.T, id uint32, priority string) types.IoBuffer {
+	req := &sofarpc.BoltRequest{
+		Protocol:      sofarpc.PROTOCOL_CODE_V1,
+		CmdType:       sofarpc.REQUEST,
+		CmdCode:       sofarpc.RPC_REQUEST,
+		Version:       1,
+		ReqID:         id,
+		Codec:         sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:       3000,
+		RequestHeader: map[string]string{"priority": priority},
+	}
+	frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+	return frame
+}
+
+// workerListener blocks the worker in OnReceiveHeaders until the gate is opened
+type workerListener struct {
+	mockServerListener
+	gate     chan struct{}
+	received chan string
+}
+
+func (l *workerListener) NewStreamDetect(ctx context.Context, sender types.StreamSender, spanBuilder types.SpanBuilder) types.StreamReceiveListener {
+	return l
+}
+
+func (l *workerListener) OnReceiveHeaders(ctx context.Context, headers types.HeaderMap, endOfStream bool) {
+	<-l.gate
+	l.received <- fmt.Sprintf("headers %d", headers.(sofarpc.SofaRpcCmd).RequestID())
+}
+
+func (l *workerListener) OnReceiveData(ctx context.Context, data types.IoBuffer, endOfStream bool) {
+	l.received <- "data " + data.String()
+}
+
+func TestRequestWorkerPool(t *testing.T) {
+	config := &v2.WorkerPool{Workers: 1, QueueSize: 1}
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "worker_pool_test")
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{RequestWorkers: config})
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &workerListener{gate: make(chan struct{}, 8), received: make(chan string, 8)}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	pool := sc.worker.pool
+	// the connections of the listener share the pool, other listeners have their own
+	if getRequestWorkerPool("worker_pool_test", config) != pool {
+		t.Error("expect the pool shared by the listener")
+	}
+	if getRequestWorkerPool("worker_pool_test2", config) == pool {
+		t.Error("expect another pool of the other listener")
+	}
+	plain := newStreamConnection(context.Background(), conn, nil, listener).(*streamConnection)
+	drainer.remove(plain)
+	if plain.worker != nil {
+		t.Error("expect no worker without the config")
+	}
+	expect := func(expected string) {
+		select {
+		case event := <-listener.received:
+			if event != expected {
+				t.Fatalf("expect %q, got %q", expected, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expect %q", expected)
+		}
+	}
+	waitQueued := func(queued int64) {
+		for i := 0; i < 100 && atomic.LoadInt64(&pool.queued) != queued; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if depth := pool.queueDepth.Value(); depth != queued {
+			t.Fatalf("expect queue depth %d, got %d", queued, depth)
+		}
+	}
+
+	// stream 1 occupies the worker, stream 2 is queued
+	sc.Dispatch(newRequestFrame(t, 1))
+	waitQueued(0)
+	frame, _ := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), newContentRequest(2, "hello"))
+	data := append(frame.Bytes(), "hello"...)
+	sc.Dispatch(buffer.NewIoBufferBytes(data))
+	// the read buffer is reused once drained
+	copy(data[len(data)-5:], "xxxxx")
+	waitQueued(1)
+
+	// the queue is full
+	rejectedBase := pool.rejected.Count()
+	sc.Dispatch(newRequestFrame(t, 3))
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 3 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect busy response of stream 3, got stream %d status %d", resp.ReqID, resp.ResponseStatus)
+	}
+	if rejected := pool.rejected.Count() - rejectedBase; rejected != 1 {
+		t.Errorf("expect 1 rejected, got %d", rejected)
+	}
+
+	// the requests of the connection are processed in order
+	listener.gate <- struct{}{}
+	listener.gate <- struct{}{}
+	expect("headers 1")
+	expect("data ")
+	expect("headers 2")
+	expect("data hello")
+	waitQueued(0)
+}
+
+func TestQoS(t *testing.T) {
+	// the streams left by the other tests count in the load
+	base := atomic.LoadInt64(&activeServerStreams)
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "qos_test")
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{QoS: &v2.QoSConfig{
+		Header:       "priority",
+		DefaultClass: "batch",
+		Classes: []v2.QoSClass{
+			{Name: "critical", Values: []string{"high"}},
+			{Name: "batch", Values: []string{"low"}, MaxActive: base + 1},
+		},
+	}})
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	critical, batch := sc.qos.classes["high"], sc.qos.classes["low"]
+	criticalAdmitted, batchAdmitted, batchRejected := critical.admitted.Count(), batch.admitted.Count(), batch.rejected.Count()
+
+	// the connections without the config are never shed
+	plain := newStreamConnection(context.Background(), conn, nil, listener).(*streamConnection)
+	drainer.remove(plain)
+	if plain.qos != nil {
+		t.Error("expect no qos without the config")
+	}
+
+	sc.Dispatch(newPriorityRequestFrame(t, 1, "low"))
+	sc.Dispatch(newPriorityRequestFrame(t, 2, "high"))
+	// over the threshold of batch, the unknown priority is batch
+	sc.Dispatch(newPriorityRequestFrame(t, 3, "unknown"))
+	sc.Dispatch(newPriorityRequestFrame(t, 4, "high"))
+	if !reflect.DeepEqual(listener.received, []uint64{1, 2, 4}) {
+		t.Fatalf("expect stream 3 shed, got %v", listener.received)
+	}
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp := cmd.(*sofarpc.BoltResponse); resp.ReqID != 3 || resp.ResponseStatus != sofarpc.RESPONSE_STATUS_SERVER_THREADPOOL_BUSY {
+		t.Errorf("expect busy response of stream 3, got stream %d status %d", resp.ReqID, resp.ResponseStatus)
+	}
+	if n := critical.admitted.Count() - criticalAdmitted; n != 2 {
+		t.Errorf("expect 2 critical admitted, got %d", n)
+	}
+	if n := batch.admitted.Count() - batchAdmitted; n != 1 {
+		t.Errorf("expect 1 batch admitted, got %d", n)
+	}
+	if n := batch.rejected.Count() - batchRejected; n != 1 {
+		t.Errorf("expect 1 batch rejected, got %d", n)
+	}
+
+	// the load is off with the connection
+	sc.OnEvent(types.RemoteClose)
+	if active := atomic.LoadInt64(&activeServerStreams); active != base {
+		t.Errorf("expect active streams %d after close, got %d", base, active)
+	}
+}
+
+// mockSpan injects the trace id only
+type mockSpan struct {
+	types.Span
+	traceID string
+}
+
+func (s *mockSpan) InjectContext(requestHeaders map[string]string) {
+	requestHeaders[models.TRACER_ID_KEY] = s.traceID
+}
+
+func TestInjectTraceContext(t *testing.T) {
+	trace.EnableTracing()
+	defer trace.DisableTracing()
+
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc := newStreamConnection(context.Background(), conn, &mockServerListener{}, nil)
+	sender := sc.NewStream(buffer.NewBufferPoolContext(context.Background()), &mockServerListener{})
+
+	req := &sofarpc.BoltRequest{
+		Protocol:      sofarpc.PROTOCOL_CODE_V1,
+		CmdType:       sofarpc.REQUEST,
+		CmdCode:       sofarpc.RPC_REQUEST,
+		RequestHeader: map[string]string{},
+	}
+	ctx := context.WithValue(context.Background(), trace.ActiveSpanKey, &mockSpan{traceID: "trace-1"})
+	sender.AppendHeaders(ctx, req, false)
+	if traceID, _ := req.Get(models.TRACER_ID_KEY); traceID != "trace-1" {
+		t.Errorf("expect trace id injected into the upstream request, got %s", traceID)
+	}
+}
+
+// contentListener records the streamed content
+type contentListener struct {
+	mockServerListener
+	headersEnd bool
+	streamed   string
+	content    []byte
+	ends       []bool
+}
+
+func (l *contentListener) NewStreamDetect(ctx context.Context, sender types.StreamSender, spanBuilder types.SpanBuilder) types.StreamReceiveListener {
+	l.sender = sender
+	return l
+}
+
+func (l *contentListener) OnReceiveHeaders(ctx context.Context, headers types.HeaderMap, endOfStream bool) {
+	l.mockServerListener.OnReceiveHeaders(ctx, headers, endOfStream)
+	l.headersEnd = endOfStream
+	l.streamed, _ = headers.Get(sofarpc.HeaderStreamingContent)
+}
+
+func (l *contentListener) OnReceiveData(ctx context.Context, data types.IoBuffer, endOfStream bool) {
+	l.content = append(l.content, data.Bytes()...)
+	l.ends = append(l.ends, endOfStream)
+}
+
+func newContentRequest(id uint32, content string) *sofarpc.BoltRequest {
+	return &sofarpc.BoltRequest{
+		Protocol:      sofarpc.PROTOCOL_CODE_V1,
+		CmdType:       sofarpc.REQUEST,
+		CmdCode:       sofarpc.RPC_REQUEST,
+		Version:       1,
+		ReqID:         id,
+		Codec:         sofarpc.HESSIAN2_SERIALIZE,
+		Timeout:       3000,
+		RequestHeader: map[string]string{"service": "test"},
+		ContentLen:    len(content),
+		Content:       buffer.NewIoBufferString(content),
+	}
+}
+
+func TestStreamingDecode(t *testing.T) {
+	content := strings.Repeat("0123456789", 4)
+	frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), newContentRequest(1, content))
+	if err != nil {
+		t.Fatalf("encode request failed: %v", err)
+	}
+	data := append(frame.Bytes(), content...)
+	headerLen := len(data) - len(content)
+
+	ctx := context.WithValue(context.Background(), types.ContextKeyStreamingDecode, true)
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{StreamingDecodeThreshold: 16})
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &contentListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener)
+
+	// the header and a piece of the content
+	buf := buffer.NewIoBufferBytes(append([]byte{}, data[:headerLen+10]...))
+	sc.Dispatch(buf)
+	if !reflect.DeepEqual(listener.received, []uint64{1}) || listener.headersEnd || listener.streamed != "40" {
+		t.Fatalf("expect the header of stream 1 before the content, got %v, end %v, streamed %q",
+			listener.received, listener.headersEnd, listener.streamed)
+	}
+	if string(listener.content) != content[:10] || buf.Len() != 0 {
+		t.Fatalf("expect the piece of the content passed through, got %q", listener.content)
+	}
+
+	// the rest of the content and a small request decoded as a whole
+	buf.Write(data[headerLen+10:])
+	buf.Write(newRequestFrame(t, 2).Bytes())
+	sc.Dispatch(buf)
+	// the last one is the data of stream 2
+	if string(listener.content) != content || !reflect.DeepEqual(listener.ends, []bool{false, true, true}) {
+		t.Errorf("unexpected content %q, ends %v", listener.content, listener.ends)
+	}
+	if !reflect.DeepEqual(listener.received, []uint64{1, 2}) || buf.Len() != 0 {
+		t.Errorf("expect stream 2 decoded after the content, got %v", listener.received)
+	}
+}
+
+func TestAbandonPartialFrame(t *testing.T) {
+	// the peer closes in the middle of the streamed content
+	content := strings.Repeat("0123456789", 4)
+	frame, _ := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), newContentRequest(1, content))
+	data := append(frame.Bytes(), content[:10]...)
+	ctx := context.WithValue(context.Background(), types.ContextKeyStreamingDecode, true)
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{StreamingDecodeThreshold: 16})
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc := newStreamConnection(ctx, conn, nil, &contentListener{}).(*streamConnection)
+	defer drainer.remove(sc)
+	sc.Dispatch(buffer.NewIoBufferBytes(data))
+	s := sc.content.stream
+	if s == nil || atomic.LoadInt32(&s.active) != 1 {
+		t.Fatal("expect the stream of the streamed request active")
+	}
+	sc.OnEvent(types.RemoteClose)
+	if sc.content.remaining != 0 || atomic.LoadInt32(&s.active) != 0 {
+		t.Errorf("expect the streamed request abandoned, %d bytes remaining, active %d", sc.content.remaining, s.active)
+	}
+
+	// the peer closes in the middle of the frame header
+	request := newRequestFrame(t, 2).Bytes()
+	listener := &mockServerListener{}
+	sc = newStreamConnection(context.Background(), conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+	sc.Dispatch(buffer.NewIoBufferBytes(request[:10]))
+	if sc.partialFrame != 10 || listener.received != nil {
+		t.Fatalf("expect 10 bytes of the partial frame, got %d", sc.partialFrame)
+	}
+	sc.OnEvent(types.RemoteClose)
+	if sc.partialFrame != 0 || listener.decoded != nil || conn.written.Len() != 0 {
+		t.Errorf("expect the partial frame abandoned quietly, got %d bytes, error %v", sc.partialFrame, listener.decoded)
+	}
+}
+
+func TestStreamingContentWrite(t *testing.T) {
+	content := strings.Repeat("0123456789", 4)
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc := newStreamConnection(context.Background(), conn, &mockServerListener{}, nil)
+
+	streamed := newContentRequest(0, content)
+	streamed.Content = nil
+	streamed.Set(sofarpc.HeaderStreamingContent, strconv.Itoa(len(content)))
+	s1 := sc.NewStream(buffer.NewBufferPoolContext(context.Background()), &mockServerListener{})
+	s1.AppendHeaders(context.Background(), streamed, false)
+
+	// the frame of another stream is written after the content
+	s2 := sc.NewStream(buffer.NewBufferPoolContext(context.Background()), &mockServerListener{})
+	s2.AppendHeaders(context.Background(), newContentRequest(0, "small"), true)
+
+	s1.AppendData(context.Background(), buffer.NewIoBufferString(content[:10]), false)
+	s1.AppendData(context.Background(), buffer.NewIoBufferString(content[10:]), true)
+
+	for _, expected := range []struct {
+		id      uint32
+		content string
+	}{{1, content}, {2, "small"}} {
+		cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+		if err != nil || cmd == nil {
+			t.Fatalf("decode request failed: %v", err)
+		}
+		req := cmd.(*sofarpc.BoltRequest)
+		if req.ReqID != expected.id || req.Content.String() != expected.content {
+			t.Errorf("expect stream %d content %q, got stream %d content %q", expected.id, expected.content, req.ReqID, req.Content.String())
+		}
+		if _, ok := req.RequestHeader[sofarpc.HeaderStreamingContent]; ok {
+			t.Error("streaming header should be removed")
+		}
+	}
+
+	// reset in the middle of the content breaks the frame
+	streamed = newContentRequest(0, content)
+	streamed.Content = nil
+	streamed.Set(sofarpc.HeaderStreamingContent, strconv.Itoa(len(content)))
+	s3 := sc.NewStream(buffer.NewBufferPoolContext(context.Background()), &mockServerListener{})
+	s3.AppendHeaders(context.Background(), streamed, false)
+	s3.AppendData(context.Background(), buffer.NewIoBufferString(content[:10]), false)
+	s3.GetStream().ResetStream(types.StreamLocalReset)
+	if !conn.closed {
+		t.Error("connection should be closed on reset in the middle of the content")
+	}
+}
+
+func TestNegotiateCompress(t *testing.T) {
+	// the server accepts a supported offer only, the peer stays on plain frames otherwise
+	server := newStreamConnection(context.Background(), nil, nil, nil).(*streamConnection)
+	for _, tc := range []struct {
+		offer string
+		ack   string
+	}{
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"unknown", ""},
+	} {
+		s := &stream{direction: ServerStream}
+		req := &sofarpc.BoltRequest{RequestHeader: map[string]string{sofarpc.HeaderFrameCompress: tc.offer}}
+		server.negotiateCompress(s, req)
+		if s.compressAck != tc.ack {
+			t.Errorf("offer %s: expect ack %q, got %q", tc.offer, tc.ack, s.compressAck)
+		}
+		if _, ok := req.Get(sofarpc.HeaderFrameCompress); ok {
+			t.Errorf("offer %s: the negotiation header should not pass to the proxy", tc.offer)
+		}
+	}
+
+	// the client switches to compressed frames on the echo of its offer
+	ctx := context.WithValue(context.Background(), types.ContextKeyFrameCompress, "deflate")
+	client := newStreamConnection(ctx, nil, nil, nil).(*streamConnection)
+	s := &stream{direction: ClientStream}
+	client.negotiateCompress(s, &sofarpc.BoltResponse{ResponseHeader: map[string]string{}})
+	if client.getCompressor() != nil {
+		t.Fatal("expect plain frames without the echo")
+	}
+	client.negotiateCompress(s, &sofarpc.BoltResponse{ResponseHeader: map[string]string{sofarpc.HeaderFrameCompress: "gzip"}})
+	if client.getCompressor() != nil {
+		t.Fatal("expect plain frames on the echo of another algorithm")
+	}
+	client.negotiateCompress(s, &sofarpc.BoltResponse{ResponseHeader: map[string]string{sofarpc.HeaderFrameCompress: "deflate"}})
+	if c := client.getCompressor(); c == nil || c.Name() != "deflate" {
+		t.Errorf("expect deflate negotiated, got %v", c)
+	}
+}
+
+func TestCompressedFrame(t *testing.T) {
+	encode := func(req *sofarpc.BoltRequest) types.IoBuffer {
+		frame, err := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+		if err != nil {
+			t.Fatalf("encode request failed: %v", err)
+		}
+		if data := req.Data(); data != nil {
+			frame.Write(data.Bytes())
+		}
+		return frame
+	}
+	compress := func(frame types.IoBuffer) types.IoBuffer {
+		compressed, err := sofarpc.EncodeCompressedFrame(sofarpc.GetFrameCompressor("gzip"), frame)
+		if err != nil {
+			t.Fatalf("compress frame failed: %v", err)
+		}
+		return compressed
+	}
+
+	// compressed frame without the negotiation closes the connection
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	newStreamConnection(context.Background(), conn, nil, listener).Dispatch(compress(newRequestFrame(t, 1)))
+	if !conn.closed || listener.received != nil {
+		t.Fatal("compressed frame should not be accepted before the negotiation")
+	}
+
+	// the server acks the offer in plain frame, then accepts compressed frames
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerConfig, &v2.ListenerConfig{MaxRequestPayload: 1024})
+	ctx = context.WithValue(ctx, types.ContextKeyMaxResponsePayload, uint64(1024))
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener = &mockServerListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	offer := newContentRequest(1, "")
+	offer.Set(sofarpc.HeaderFrameCompress, "gzip")
+	sc.Dispatch(encode(offer))
+	if sc.getCompressor() != nil {
+		t.Fatal("compressed frames should start after the ack")
+	}
+	listener.sender.AppendHeaders(context.Background(), &sofarpc.BoltResponse{
+		Protocol:       sofarpc.PROTOCOL_CODE_V1,
+		CmdType:        sofarpc.RESPONSE,
+		CmdCode:        sofarpc.RPC_RESPONSE,
+		Version:        1,
+		ReqID:          1,
+		Codec:          sofarpc.HESSIAN2_SERIALIZE,
+		ResponseStatus: sofarpc.RESPONSE_STATUS_SUCCESS,
+		ResponseHeader: map[string]string{},
+	}, true)
+	cmd, err := sofarpc.Engine().Decode(buffer.NewBufferPoolContext(context.Background()), conn.written)
+	if err != nil {
+		t.Fatalf("decode the ack failed: %v", err)
+	}
+	if ack, _ := cmd.(sofarpc.SofaRpcCmd).Get(sofarpc.HeaderFrameCompress); ack != "gzip" {
+		t.Fatalf("expect the ack of gzip, got %q", ack)
+	}
+	if c := sc.getCompressor(); c == nil || c.Name() != "gzip" {
+		t.Fatalf("expect gzip negotiated, got %v", c)
+	}
+	sc.Dispatch(compress(newRequestFrame(t, 2)))
+	if conn.closed || len(listener.received) != 2 || listener.received[1] != 2 {
+		t.Fatalf("expect the compressed request accepted, got %v", listener.received)
+	}
+
+	// the frame inflating over the limit is rejected
+	sc.Dispatch(compress(encode(newContentRequest(3, strings.Repeat("0", 1<<20)))))
+	if !conn.closed || len(listener.received) != 2 {
+		t.Error("the decompression bomb should close the connection")
+	}
+
+	// the compressed length over the limit is rejected before waiting for the frame
+	conn = &mockConnection{written: buffer.NewIoBuffer(128)}
+	sc = newStreamConnection(ctx, conn, nil, &mockServerListener{}).(*streamConnection)
+	sc.setCompressor(sofarpc.GetFrameCompressor("gzip"))
+	frame := compress(newRequestFrame(t, 4))
+	binary.BigEndian.PutUint32(frame.Bytes()[2:], 0xfffffff0)
+	sc.Dispatch(frame)
+	if !conn.closed {
+		t.Error("the oversized compressed frame should close the connection")
+	}
+}
+
+// deadlineListener records the context of the server stream
+type deadlineListener struct {
+	mockServerListener
+	ctx context.Context
+}
+
+func (l *deadlineListener) NewStreamDetect(ctx context.Context, sender types.StreamSender, spanBuilder types.SpanBuilder) types.StreamReceiveListener {
+	l.ctx = ctx
+	return l.mockServerListener.NewStreamDetect(ctx, sender, spanBuilder)
+}
+
+func TestRequestDeadline(t *testing.T) {
+	for _, timeout := range []int{0, 3000} {
+		ctx := buffer.NewBufferPoolContext(context.Background())
+		req := &sofarpc.BoltRequest{
+			Protocol: sofarpc.PROTOCOL_CODE_V1,
+			CmdType:  sofarpc.REQUEST,
+			CmdCode:  sofarpc.RPC_REQUEST,
+			Version:  1,
+			ReqID:    12,
+			Codec:    sofarpc.HESSIAN2_SERIALIZE,
+			Timeout:  timeout,
+		}
+		req.RequestHeader = map[string]string{}
+
+		listener := &deadlineListener{}
+		sc := newStreamConnection(context.Background(), &mockConnection{written: buffer.NewIoBuffer(128)}, nil, listener)
+		start := time.Now()
+		s := sc.(*streamConnection).onNewStreamDetect(ctx, req, nil)
+
+		deadline, ok := listener.ctx.Deadline()
+		if timeout == 0 {
+			if ok {
+				t.Errorf("expect no deadline without the request timeout, got %v", deadline)
+			}
+			continue
+		}
+		if !ok || deadline.Before(start.Add(3*time.Second)) || deadline.After(time.Now().Add(3*time.Second)) {
+			t.Fatalf("expect the deadline of the request timeout, got %v, %v", deadline, ok)
+		}
+
+		// the deadline is released with the stream
+		s.AppendHeaders(ctx, sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS), true)
+		if err := listener.ctx.Err(); err != context.Canceled {
+			t.Errorf("expect the context canceled after the stream ended, got %v", err)
+		}
+	}
+}
+
+func TestProtocolDetection(t *testing.T) {
+	newConn := func(config *v2.DetectConfig) (*streamConnection, *mockConnection, *mockServerListener) {
+		ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "detect_test")
+		ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{ProtocolDetection: config})
+		conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+		listener := &mockServerListener{}
+		sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+		drainer.remove(sc)
+		return sc, conn, listener
+	}
+	config := &v2.DetectConfig{Protocols: []string{"bolt"}}
+
+	// the connection sticks to the protocol of the first bytes, a byte is too few to tell
+	sc, conn, listener := newConn(config)
+	frame := newRequestFrame(t, 1)
+	buf := buffer.NewIoBufferBytes(frame.Bytes()[:1])
+	sc.Dispatch(buf)
+	if sc.detection.detected || listener.received != nil {
+		t.Fatal("expect the protocol not detected by a byte")
+	}
+	buf.Write(frame.Bytes()[1:])
+	sc.Dispatch(buf)
+	if sc.detection.code != sofarpc.PROTOCOL_CODE_V1 || !reflect.DeepEqual(listener.received, []uint64{1}) {
+		t.Fatalf("expect the bolt request received, got %v", listener.received)
+	}
+	req := &sofarpc.BoltRequestV2{
+		BoltRequest: sofarpc.BoltRequest{
+			Protocol: sofarpc.PROTOCOL_CODE_V2,
+			CmdType:  sofarpc.REQUEST,
+			CmdCode:  sofarpc.RPC_REQUEST,
+			Version:  1,
+			ReqID:    2,
+			Codec:    sofarpc.HESSIAN2_SERIALIZE,
+		},
+		Version1: sofarpc.PROTOCOL_VERSION_1,
+	}
+	v2Frame, _ := sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+	sc.Dispatch(v2Frame)
+	if !conn.closed || len(listener.received) != 1 {
+		t.Error("expect the connection closed on the frame of another protocol")
+	}
+	sc.OnEvent(types.LocalClose)
+
+	// the boltv2 frames are told by the version
+	sc, _, listener = newConn(&v2.DetectConfig{Protocols: []string{"bolt", "boltv2"}})
+	v2Frame, _ = sofarpc.Engine().Encode(buffer.NewBufferPoolContext(context.Background()), req)
+	sc.Dispatch(v2Frame)
+	if sc.detection.code != sofarpc.PROTOCOL_CODE_V2 || !reflect.DeepEqual(listener.received, []uint64{2}) {
+		t.Errorf("expect the boltv2 request received, got %v", listener.received)
+	}
+	sc.OnEvent(types.LocalClose)
+
+	// no protocol matches without a fallback
+	sc, conn, _ = newConn(config)
+	undetectedBase := sc.detection.undetected.Count()
+	sc.Dispatch(buffer.NewIoBufferBytes([]byte{sofarpc.PROTOCOL_CODE_V1, 0x7f}))
+	if !conn.closed || sc.detection.undetected.Count()-undetectedBase != 1 {
+		t.Error("expect the connection closed if no protocol matches")
+	}
+	sc.OnEvent(types.LocalClose)
+
+	// too few bytes in the timeout fall back to the default protocol
+	sc, conn, listener = newConn(&v2.DetectConfig{
+		Protocols: []string{"bolt", "boltv2"},
+		Timeout:   v2.DurationConfig{Duration: 50 * time.Millisecond},
+		Fallback:  "bolt",
+	})
+	fallbackBase := sc.detection.fallbacks.Count()
+	buf = buffer.NewIoBufferBytes(frame.Bytes()[:1])
+	sc.Dispatch(buf)
+	time.Sleep(100 * time.Millisecond)
+	buf.Write(frame.Bytes()[1:])
+	sc.Dispatch(buf)
+	if conn.closed || !reflect.DeepEqual(listener.received, []uint64{1}) || sc.detection.fallbacks.Count()-fallbackBase != 1 {
+		t.Errorf("expect the request received in the fallback protocol, got %v", listener.received)
+	}
+	sc.OnEvent(types.LocalClose)
+
+	// disabled without a known protocol, tr has no codec
+	sc, _, _ = newConn(&v2.DetectConfig{Protocols: []string{"dubbo", "tr"}})
+	if sc.detection != nil {
+		t.Error("expect the detection disabled without a known protocol")
+	}
+}
+
+func TestFrameCaptureConfig(t *testing.T) {
+	ctx := context.WithValue(context.Background(), types.ContextKeyListenerName, "stream_capture_test")
+	ctx = context.WithValue(ctx, types.ContextKeyListenerConfig, &v2.ListenerConfig{FrameCapture: &v2.FrameCapture{SampleRate: 1, Sink: sofarpc.CaptureSinkRing}})
+	conn := &mockConnection{written: buffer.NewIoBuffer(128)}
+	listener := &mockServerListener{}
+	sc := newStreamConnection(ctx, conn, nil, listener).(*streamConnection)
+	defer drainer.remove(sc)
+
+	// the request and the response of the server stream are captured
+	sc.Dispatch(newRequestFrame(t, 1))
+	listener.sender.AppendHeaders(context.Background(), sofarpc.NewResponse(sofarpc.PROTOCOL_CODE_V1, sofarpc.RESPONSE_STATUS_SUCCESS), true)
+	captures := sofarpc.RingCaptures()["stream_capture_test"]
+	if len(captures) != 2 || captures[0].Direction != sofarpc.CaptureRequest || captures[1].Direction != sofarpc.CaptureResponse {
+		t.Fatalf("expect the request and the response captured, got %v", captures)
+	}
+}
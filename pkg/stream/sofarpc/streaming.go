@@ -0,0 +1,221 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/alipay/sofa-mosn/pkg/buffer"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// defaultStreamingDecodeThreshold is the min content length to stream if the listener doesn't configure it,
+// the smaller frames are decoded as a whole
+const defaultStreamingDecodeThreshold = 64 * 1024
+
+// streamingContent is the content of the streamed request being received by the server conn.
+// The content is discarded if the stream is not created or ended before the content
+type streamingContent struct {
+	stream    *stream
+	id        uint64 // the stream may be recycled on end, check the id before dispatch
+	remaining int
+}
+
+// decodeStreamingHeader decodes the request header ahead of the content if the protocol supports it,
+// nil cmd means the frame should be decoded as a whole
+func (conn *streamConnection) decodeStreamingHeader(ctx context.Context, buf types.IoBuffer) (sofarpc.SofaRpcCmd, error) {
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+	decoder := sofarpc.GetStreamingDecoder(buf.Bytes()[0])
+	if decoder == nil {
+		return nil, nil
+	}
+
+	cmd, contentLen, err := decoder.DecodeHeader(ctx, buf, conn.streamingThreshold)
+	if cmd != nil {
+		conn.content = streamingContent{remaining: contentLen}
+	}
+	return cmd, err
+}
+
+func (conn *streamConnection) handleStreamingRequest(ctx context.Context, cmd sofarpc.SofaRpcCmd, err error) {
+	if err != nil {
+		conn.handleError(ctx, cmd, err)
+		return
+	}
+
+	cmd = conn.sterilizer.Decode(cmd)
+	stream := conn.onNewStreamDetect(ctx, cmd, conn.codecEngine)
+	if stream == nil {
+		return
+	}
+	conn.negotiateCompress(stream, cmd)
+
+	cmd.Set(sofarpc.HeaderStreamingContent, strconv.Itoa(conn.content.remaining))
+	conn.content.stream = stream
+	conn.content.id = stream.id
+
+	conn.logger.Debugf("stream the request content, id = %d, length = %d", stream.id, conn.content.remaining)
+	stream.receiver.OnReceiveHeaders(stream.ctx, cmd, false)
+}
+
+// dispatchContent passes the received piece of the content to the stream, returns false if no data
+func (conn *streamConnection) dispatchContent(buf types.IoBuffer) bool {
+	n := buf.Len()
+	if n == 0 {
+		return false
+	}
+	if n > conn.content.remaining {
+		n = conn.content.remaining
+	}
+	conn.content.remaining -= n
+	endStream := conn.content.remaining == 0
+
+	if s := conn.content.stream; s != nil && s.id == conn.content.id && atomic.LoadInt32(&s.active) == 1 {
+		s.receiver.OnReceiveData(s.ctx, buffer.NewIoBufferBytes(buf.Bytes()[:n]), endStream)
+	}
+	buf.Drain(n)
+
+	if endStream {
+		conn.content = streamingContent{}
+	}
+	return true
+}
+
+// abandonPartialFrame drops the frame being read on the connection close. The stream of the request with
+// the content streamed is done, since the content never completes. A peer closing in the middle of a frame
+// is a normal disconnect, e.g. of the mobile clients, so it is not reported as a codec exception
+func (conn *streamConnection) abandonPartialFrame(event types.ConnectionEvent) {
+	if conn.content.remaining > 0 {
+		if s := conn.content.stream; s != nil && s.id == conn.content.id {
+			conn.logger.Debugf("connection closed by %s, abandon the content of stream %d, %d bytes remaining",
+				event, s.id, conn.content.remaining)
+			s.serverStreamDone()
+		}
+		conn.content = streamingContent{}
+	}
+	if conn.partialFrame > 0 {
+		conn.logger.Debugf("connection closed by %s, abandon %d bytes of the partial frame", event, conn.partialFrame)
+		conn.partialFrame = 0
+	}
+}
+
+// write writes the frames of the stream, they are queued while another stream is writing its content
+func (conn *streamConnection) write(s *stream, buffers ...types.IoBuffer) {
+	conn.writeMux.Lock()
+	defer conn.writeMux.Unlock()
+
+	if conn.contentWriter != nil && conn.contentWriter != s {
+		conn.pendingWrites = append(conn.pendingWrites, buffers)
+		return
+	}
+	conn.conn.Write(buffers...)
+}
+
+func (conn *streamConnection) acquireContentWriter(s *stream) bool {
+	conn.writeMux.Lock()
+	defer conn.writeMux.Unlock()
+
+	if conn.contentWriter != nil {
+		return false
+	}
+	conn.contentWriter = s
+	return true
+}
+
+// releaseContentWriter flushes the frames queued while the stream writing its content
+func (conn *streamConnection) releaseContentWriter(s *stream) {
+	conn.writeMux.Lock()
+	defer conn.writeMux.Unlock()
+
+	if conn.contentWriter != s {
+		return
+	}
+	conn.contentWriter = nil
+	for _, buffers := range conn.pendingWrites {
+		conn.conn.Write(buffers...)
+	}
+	conn.pendingWrites = nil
+}
+
+// abortContent closes the connection if the stream is reset in the middle of its content,
+// the frame on the connection is broken
+func (conn *streamConnection) abortContent(s *stream) {
+	conn.writeMux.Lock()
+	if conn.contentWriter != s {
+		conn.writeMux.Unlock()
+		return
+	}
+	conn.contentWriter = nil
+	conn.pendingWrites = nil
+	conn.writeMux.Unlock()
+
+	s.streaming = false
+	conn.logger.Errorf("stream %d reset while writing the content, close the connection", s.id)
+	conn.conn.Close(types.NoFlush, types.LocalClose)
+}
+
+// beginContent writes the request header ahead of the content, the content is written through by AppendData.
+// The content is buffered up to the whole frame instead if the frame is compressed, or another stream is
+// writing its content on the connection
+func (s *stream) beginContent() {
+	s.streaming = false
+	if s.sc.getCompressor() != nil || !s.sc.acquireContentWriter(s) {
+		return
+	}
+
+	s.sendCmd.SetRequestID(s.id)
+	buf, err := s.sc.codecEngine.Encode(s.ctx, s.sendCmd)
+	if err != nil {
+		s.sc.logger.Errorf("encode error:%s", err.Error())
+		s.sc.releaseContentWriter(s)
+		s.ResetStream(types.StreamLocalReset)
+		return
+	}
+
+	if s.sc.keepalive != nil {
+		s.sc.keepalive.active(s.sendCmd.ProtocolCode())
+	}
+	s.streaming = true
+	s.sc.conn.Write(buf)
+}
+
+func (s *stream) writeContent(data types.IoBuffer, endStream bool) {
+	if data != nil && data.Len() > 0 {
+		s.sc.conn.Write(data)
+	}
+
+	if endStream {
+		s.streaming = false
+		s.sc.releaseContentWriter(s)
+	}
+}
+
+func (s *stream) bufferContent(data types.IoBuffer) {
+	if data == nil {
+		return
+	}
+	if s.sendBuf == nil {
+		s.sendBuf = buffer.NewIoBuffer(data.Len())
+	}
+	s.sendBuf.Write(data.Bytes())
+}
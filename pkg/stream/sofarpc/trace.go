@@ -0,0 +1,44 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/trace"
+)
+
+// injectTraceContext sets the trace context of the active span into the request sent to the upstream,
+// the header keys are decided by the tracer, see trace.SetTracer
+func injectTraceContext(ctx context.Context, cmd sofarpc.SofaRpcCmd) {
+	if !trace.IsTracingEnabled() || cmd.Header() == nil || isHeartbeat(cmd) {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	headers := make(map[string]string, 2)
+	span.InjectContext(headers)
+	for key, value := range headers {
+		cmd.Set(key, value)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sofarpc
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// requestWorkerPools are the worker pools of the listeners, the connections of a listener share its pool
+var requestWorkerPools = struct {
+	sync.Mutex
+	pools map[string]*requestWorkerPool
+}{pools: make(map[string]*requestWorkerPool)}
+
+// getRequestWorkerPool returns the worker pool of the listener, it is created by the first connection. The decoded
+// requests are passed to a bounded pool of workers instead of the read goroutine of the connection. The requests
+// of a connection are always processed by the same worker in order, a request finding the queue of its worker full
+// is rejected with RESPONSE_STATUS_SERVER_THREADPOOL_BUSY. The requests with the content streamed are not pooled.
+// A pool of another config replaces the one of the listener, the connections accepted already keep the old one
+func getRequestWorkerPool(listenerName string, config *v2.WorkerPool) *requestWorkerPool {
+	requestWorkerPools.Lock()
+	defer requestWorkerPools.Unlock()
+
+	if pool, ok := requestWorkerPools.pools[listenerName]; ok && pool.config == *config {
+		return pool
+	}
+	pool := newRequestWorkerPool(listenerName, *config)
+	requestWorkerPools.pools[listenerName] = pool
+	return pool
+}
+
+type requestWorkerPool struct {
+	config     v2.WorkerPool
+	workers    []*requestWorker
+	queued     int64
+	queueDepth metrics.Gauge
+	rejected   metrics.Counter
+}
+
+// requestWorker processes the requests of the connections assigned to it in FIFO order
+type requestWorker struct {
+	pool   *requestWorkerPool
+	jobs   chan func()
+	queued int32
+}
+
+func newRequestWorkerPool(listenerName string, config v2.WorkerPool) *requestWorkerPool {
+	capacity := config.QueueSize / config.Workers
+	if capacity <= 0 {
+		capacity = 1
+	}
+	s := stats.NewWorkerPoolStats(listenerName)
+	pool := &requestWorkerPool{
+		config:     config,
+		workers:    make([]*requestWorker, config.Workers),
+		queueDepth: s.Gauge(stats.WorkerPoolQueueDepth),
+		rejected:   s.Counter(stats.WorkerPoolRejected),
+	}
+	for i := range pool.workers {
+		w := &requestWorker{
+			pool: pool,
+			jobs: make(chan func(), capacity),
+		}
+		pool.workers[i] = w
+		go w.run()
+	}
+	return pool
+}
+
+// worker returns the worker of the connection
+func (p *requestWorkerPool) worker(connID uint64) *requestWorker {
+	return p.workers[connID%uint64(len(p.workers))]
+}
+
+func (p *requestWorkerPool) updateQueued(delta int64) {
+	p.queueDepth.Update(atomic.AddInt64(&p.queued, delta))
+}
+
+// reserve takes a slot in the queue, returns false if the queue is full
+func (w *requestWorker) reserve() bool {
+	if atomic.AddInt32(&w.queued, 1) > int32(cap(w.jobs)) {
+		atomic.AddInt32(&w.queued, -1)
+		w.pool.rejected.Inc(1)
+		return false
+	}
+	w.pool.updateQueued(1)
+	return true
+}
+
+// release gives back the reserved slot not used by offer
+func (w *requestWorker) release() {
+	atomic.AddInt32(&w.queued, -1)
+	w.pool.updateQueued(-1)
+}
+
+// offer queues the job in the reserved slot, it never blocks
+func (w *requestWorker) offer(job func()) {
+	w.jobs <- job
+}
+
+func (w *requestWorker) run() {
+	for job := range w.jobs {
+		w.release()
+		w.call(job)
+	}
+}
+
+func (w *requestWorker) call(job func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.DefaultLogger.Errorf("sofarpc request worker panic %v", p)
+			debug.PrintStack()
+		}
+	}()
+	job()
+}
+
+// offerRequest passes the request to the worker of the connection, the request is rejected if the queue is full
+func (conn *streamConnection) offerRequest(ctx context.Context, cmd sofarpc.SofaRpcCmd) {
+	if !conn.worker.reserve() {
+		conn.rejectBusy(ctx, cmd)
+		return
+	}
+	stream := conn.onNewStreamDetect(ctx, cmd, conn.codecEngine)
+	if stream == nil {
+		conn.worker.release()
+		return
+	}
+	conn.negotiateCompress(stream, cmd)
+
+	// the content refers to the read buffer, which is reused once the frame is drained
+	if data := cmd.Data(); data != nil {
+		cmd.SetData(data.Clone())
+	}
+	id := stream.id
+	conn.worker.offer(func() {
+		// the stream may be reset by the connection close while queued, and recycled then
+		if stream.id == id && atomic.LoadInt32(&stream.active) == 1 {
+			conn.notifyStream(stream, cmd)
+		}
+	})
+}
+
+// rejectBusy answers the request finding the queue of the worker full without creating the stream
+func (conn *streamConnection) rejectBusy(ctx context.Context, cmd sofarpc.SofaRpcCmd) {
+	conn.logger.Debugf("request worker queue is full, reject stream %d", cmd.RequestID())
+
+	if cmd.CommandType() != sofarpc.REQUEST_ONEWAY {
+		s := &stream{
+			id:        cmd.RequestID(),
+			ctx:       ctx,
+			direction: ServerStream,
+			sc:        conn,
+		}
+		s.sendCmd = conn.hijackReasons.response(cmd, types.RateLimitedCode)
+		s.endStream()
+	}
+}
@@ -71,7 +71,7 @@ func (p *connPool) NewStream(context context.Context, responseDecoder types.Stre
 	p.mux.Unlock()
 
 	if p.primaryClient == nil {
-		listener.OnFailure(types.ConnectionFailure, nil)
+		listener.OnFailure(types.ConnectionFailure, p.host)
 		return
 	}
 
@@ -127,8 +127,8 @@ func (p *connPool) onConnectionEvent(client *activeClient, event types.Connectio
 			p.primaryClient = nil
 		}
 	} else if event == types.ConnectTimeout {
-		p.host.HostStats().UpstreamRequestTimeout.Inc(1)
-		p.host.ClusterInfo().Stats().UpstreamRequestTimeout.Inc(1)
+		p.host.HostStats().UpstreamConnectionConTimeout.Inc(1)
+		p.host.ClusterInfo().Stats().UpstreamConnectionConTimeout.Inc(1)
 		client.client.Close()
 	} else if event == types.ConnectFailed {
 		p.host.HostStats().UpstreamConnectionConFail.Inc(1)
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
 	"github.com/alipay/sofa-mosn/pkg/types"
 	"github.com/json-iterator/go"
 )
@@ -79,7 +80,14 @@ func (s *SofaTracerSpan) FinishSpan() {
 	}
 }
 
+// InjectContext sets the trace id and span id into the request headers sent to the upstream,
+// so that the trace is continued by the next hop
 func (s *SofaTracerSpan) InjectContext(requestHeaders map[string]string) {
+	if s.traceId == "" {
+		return
+	}
+	requestHeaders[models.TRACER_ID_KEY] = s.traceId
+	requestHeaders[models.RPC_ID_KEY] = s.spanId
 }
 
 func (s *SofaTracerSpan) SpawnChild(operationName string, startTime time.Time) types.Span {
@@ -185,7 +193,7 @@ func (tracer *SofaTracer) printSpan(span *SofaTracerSpan) {
 	statusCode, _ := strconv.Atoi(span.tags[RESULT_STATUS])
 	if statusCode == types.SuccessCode {
 		printData["result.code"] = "00"
-	} else if statusCode == types.TimeoutExceptionCode {
+	} else if statusCode == types.TimeoutExceptionCode || statusCode == types.TryTimeoutExceptionCode {
 		printData["result.code"] = "03"
 	} else if statusCode == types.RouterUnavailableCode || statusCode == types.NoHealthUpstreamCode {
 		printData["result.code"] = "04"
@@ -20,6 +20,8 @@ package trace
 import (
 	"testing"
 	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/protocol/sofarpc/models"
 )
 
 func init() {
@@ -52,3 +54,21 @@ func TestSofaTracerPrintEgressSpan(t *testing.T) {
 	span.tags[SPAN_TYPE] = "egress"
 	SofaTracerInstance.printSpan(span)
 }
+
+func TestSofaTracerInjectContext(t *testing.T) {
+	span := &SofaTracerSpan{
+		tags: map[string]string{},
+	}
+	headers := map[string]string{}
+	span.InjectContext(headers)
+	if len(headers) != 0 {
+		t.Errorf("span without trace id should not be injected, got %v", headers)
+	}
+
+	span.SetTag(TRACE_ID, "0a0fe8ce1536833972218100126394")
+	span.SetTag(SPAN_ID, "0.1")
+	span.InjectContext(headers)
+	if headers[models.TRACER_ID_KEY] != "0a0fe8ce1536833972218100126394" || headers[models.RPC_ID_KEY] != "0.1" {
+		t.Errorf("unexpected injected headers: %v", headers)
+	}
+}
@@ -32,5 +32,6 @@ const (
 	APP_NAME               string = "appName"
 	SPAN_TYPE              string = "spanType"
 	BAGGAGE_DATA           string = "baggageData"
+	REQUEST_ID             string = "requestId"
 	REQUEST_URL string = "requestURL"
 )
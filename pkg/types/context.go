@@ -39,6 +39,12 @@ const (
 	ContextKeyConnectionFd                ContextKey = "ConnectionFd"
 	ContextSubProtocol                    ContextKey = "ContextSubProtocol"
 	ContextKeyTraceSpanKey                ContextKey = "TraceSpanKey"
+	ContextKeyFrameCompress               ContextKey = "FrameCompress"
+	ContextKeyHeartbeatInterval           ContextKey = "HeartbeatInterval"
+	ContextKeyRequestInfo                 ContextKey = "RequestInfo"
+	ContextKeyStreamingDecode             ContextKey = "StreamingDecode"
+	ContextKeyListenerConfig              ContextKey = "ListenerConfig"
+	ContextKeyMaxResponsePayload          ContextKey = "MaxResponsePayload"
 )
 
 // GlobalProxyName represents proxy name for metrics
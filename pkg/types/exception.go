@@ -33,6 +33,9 @@ const (
 	HeaderStremEnd      = "x-mosn-endstream"
 	HeaderRPCService    = "x-mosn-rpc-service"
 	HeaderRPCMethod     = "x-mosn-rpc-method"
+	HeaderCluster       = "x-mosn-cluster"       // only honored from proxy's trusted sources
+	HeaderShadow        = "x-mosn-shadow"        // marks the mirrored request, the backend should avoid side effects
+	HeaderUpstreamHost  = "x-mosn-upstream-host" // pins the request to the host, only honored if the proxy allows host override
 )
 
 // Error messages
@@ -60,8 +63,18 @@ const (
 	DeserialExceptionCode int = 3
 	SuccessCode           int = 200
 	RouterUnavailableCode int = 404
-	NoHealthUpstreamCode  int = 502
-	UpstreamOverFlowCode  int = 503
-	TimeoutExceptionCode  int = 504
-	LimitExceededCode     int = 509
+	// RateLimitedCode rejects the request throttled by the proxy, the client should back off and retry later
+	RateLimitedCode      int = 429
+	NoHealthUpstreamCode int = 502
+	UpstreamOverFlowCode int = 503
+	TimeoutExceptionCode int = 504
+	LimitExceededCode    int = 509
+	// TryTimeoutExceptionCode is a single try timeout, TimeoutExceptionCode is the global timeout
+	TryTimeoutExceptionCode int = 524
+	// DrainingCode rejects the request on a draining connection, the client should retry on another connection
+	DrainingCode int = 525
+	// ConnectionOverflowCode rejects the request exceeding the concurrent streams limit of the connection
+	ConnectionOverflowCode int = 526
+	// ServiceLimitedCode rejects the request exceeding the rate limit of the service
+	ServiceLimitedCode int = 527
 )
@@ -26,8 +26,11 @@ type LoadBalancerType string
 
 // The load balancer's types
 const (
-	RoundRobin LoadBalancerType = "RoundRobin"
-	Random     LoadBalancerType = "Random"
+	RoundRobin         LoadBalancerType = "RoundRobin"
+	Random             LoadBalancerType = "Random"
+	WeightedRoundRobin LoadBalancerType = "WeightedRoundRobin"
+	ConsistentHash     LoadBalancerType = "ConsistentHash"
+	WeightedRandom     LoadBalancerType = "WeightedRandom"
 )
 
 // LoadBalancer is a upstream load balancer.
@@ -37,6 +40,14 @@ type LoadBalancer interface {
 	ChooseHost(context LoadBalancerContext) Host
 }
 
+// HostSelector is the policy of a load balancer to choose a host from the candidates.
+// The hosts are the healthy hosts of all priorities, never empty, and the metadata of a host is
+// available by Host.Metadata. The context may be nil
+type HostSelector interface {
+	// SelectHost returns the chosen host, nil if none of the hosts is suitable
+	SelectHost(context LoadBalancerContext, hosts []Host) Host
+}
+
 // LoadBalancerContext contains the information for choose a host
 type LoadBalancerContext interface {
 	// ComputeHashKey computes an optional hash key to use during load balancing
@@ -52,6 +63,19 @@ type LoadBalancerContext interface {
 	DownstreamHeaders() HeaderMap
 }
 
+// HostExclusionContext is an optional extension of LoadBalancerContext,
+// the hosts excluded by the context are chosen only if no other host can be found
+type HostExclusionContext interface {
+	IsHostExcluded(host Host) bool
+}
+
+// HostOverrideContext is an optional extension of LoadBalancerContext,
+// the host named by the context bypasses the load balancer if it is a healthy host of the cluster
+type HostOverrideContext interface {
+	// OverrideHost returns the address or the hostname of the host, empty means no override
+	OverrideHost() string
+}
+
 // SubSetLoadBalancer is a subset of LoadBalancer
 type SubSetLoadBalancer interface {
 	LoadBalancer
@@ -20,6 +20,7 @@ package types
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/mtls/crypto/tls"
@@ -269,6 +270,18 @@ type Connection interface {
 	// BufferLimit returns the buffer limit.
 	BufferLimit() uint32
 
+	// SetReadBufferSize sets the initial capacity of the read buffer and the socket receive buffer,
+	// a larger buffer reduces the reads of large frames. Zero keeps the default.
+	SetReadBufferSize(size uint32)
+
+	// SetWriteBufferSize sets the socket send buffer, zero keeps the default.
+	SetWriteBufferSize(size uint32)
+
+	// SetWriteBufferWatermark sets the watermarks of the bytes pending write. WriteBufferAboveHighWatermark
+	// is raised when the pending bytes exceed the high watermark, and WriteBufferBelowLowWatermark when they
+	// drain to the low watermark. Zero high watermark disables the events, zero low watermark means half of the high.
+	SetWriteBufferWatermark(high, low uint32)
+
 	// SetLocalAddress sets a local address
 	SetLocalAddress(localAddress net.Addr, restored bool)
 
@@ -308,6 +321,10 @@ type ClientConnection interface {
 
 	// connect to server in a async way
 	Connect(ioEnabled bool) error
+
+	// SetConnectTimeout bounds establishing the connection, a timeout raises the ConnectTimeout event.
+	// Zero means no limit, it should be called before Connect
+	SetConnectTimeout(timeout time.Duration)
 }
 
 // ConnectionEvent type
@@ -323,6 +340,11 @@ const (
 	Connected       ConnectionEvent = "ConnectedFlag"
 	ConnectTimeout  ConnectionEvent = "ConnectTimeout"
 	ConnectFailed   ConnectionEvent = "ConnectFailed"
+
+	// WriteBufferAboveHighWatermark is raised when the bytes pending write exceed the high watermark
+	WriteBufferAboveHighWatermark ConnectionEvent = "WriteBufferAboveHighWatermark"
+	// WriteBufferBelowLowWatermark is raised when the bytes pending write drain to the low watermark
+	WriteBufferBelowLowWatermark ConnectionEvent = "WriteBufferBelowLowWatermark"
 )
 
 // IsClose represents whether the event is triggered by connection close
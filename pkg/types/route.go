@@ -35,6 +35,7 @@ const (
 	GlobalTimeout                  = 60 * time.Second
 	DefaultRouteTimeout            = 15 * time.Second
 	SofaRouteMatchKey              = "service"
+	SofaRouteMethodKey             = "sofa_head_method_name"
 	RouterMetadataKey              = "filter_metadata"
 	RouterMetadataKeyLb            = "mosn.lb"
 	SofaRouterType      RouterType = "sofa"
@@ -97,6 +98,10 @@ type RouteRule interface {
 	// GlobalTimeout returns the global timeout
 	GlobalTimeout() time.Duration
 
+	// TimeoutOverride returns the route level try timeout and global timeout that take precedence over
+	// the request headers, 0 means not overridden
+	TimeoutOverride() (tryTimeout time.Duration, globalTimeout time.Duration)
+
 	// VirtualHost returns the route's virtual host
 	VirtualHost() VirtualHost
 
@@ -140,6 +145,13 @@ type Policy interface {
 	CorsPolicy() CorsPolicy
 
 	LoadBalancerPolicy() LoadBalancerPolicy
+
+	HostExclusionPolicy() HostExclusionPolicy
+
+	DeduplicationPolicy() DeduplicationPolicy
+
+	// RequestBufferPolicy returns the request buffer policy overriding the cluster's, nil means not overridden
+	RequestBufferPolicy() *v2.RequestBufferPolicy
 }
 
 // CorsPolicy is a type of Policy
@@ -166,6 +178,26 @@ type LoadBalancerPolicy interface {
 
 type AddCookieCallback func(key string, ttl int)
 
+// HostExclusionPolicy is a type of Policy, hosts failed on the route are
+// deprioritized for the following requests on the route during a short window
+type HostExclusionPolicy interface {
+	// Exclude puts the host into the exclusion window
+	Exclude(host Host)
+
+	// IsExcluded returns true if the host is still in the exclusion window
+	IsExcluded(host Host) bool
+}
+
+// DeduplicationPolicy is a type of Policy, the upstream response is cached by the request id on the
+// downstream connection, a duplicated request during the TTL is answered with the cached response
+type DeduplicationPolicy interface {
+	// TTL is the duration a response is cached
+	TTL() time.Duration
+
+	// MaxEntries is the max cached responses on a downstream connection, the least recently used is evicted
+	MaxEntries() int
+}
+
 // HashPolicy is a type of Policy
 type HashPolicy interface {
 	GenerateHash(downstreamAddress string, headers map[string]string, addCookieCb AddCookieCallback)
@@ -224,6 +256,12 @@ type RetryPolicy interface {
 	TryTimeout() time.Duration
 
 	NumRetries() uint32
+
+	// MaxAttempts returns the cap of upstream attempts, the first request and the retries, 0 means no cap
+	MaxAttempts() uint32
+
+	// RetryOnStatus returns the retryable status codes, empty means the default policy
+	RetryOnStatus() []int
 }
 
 type DoRetryCallback func()
@@ -239,6 +277,9 @@ type ShadowPolicy interface {
 	ClusterName() string
 
 	RuntimeKey() string
+
+	// Percent is the percentage of requests mirrored to the shadow cluster, in [1, 100]
+	Percent() uint32
 }
 
 type VirtualServer interface {
@@ -373,6 +373,12 @@ type ConnectionPool interface {
 	Close()
 }
 
+// PreconnectPool is implemented by the connection pools support warming up
+type PreconnectPool interface {
+	// Preconnect establishes the connection of the pool if there is none, it blocks until connected
+	Preconnect()
+}
+
 type PoolEventListener interface {
 	OnFailure(reason PoolFailureReason, host Host)
 
@@ -21,6 +21,7 @@ import (
 	"context"
 	"net"
 	"sort"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	metrics "github.com/rcrowley/go-metrics"
@@ -156,6 +157,12 @@ const (
 	FAILED_ACTIVE_HC HealthFlag = 0x1
 	// The host is currently considered an outlier and has been ejected.
 	FAILED_OUTLIER_CHECK HealthFlag = 0x02
+	// The host signals it's shutting down in the response and has been drained.
+	DRAINED_BY_RESPONSE HealthFlag = 0x04
+	// The host is disabled in the registry, e.g. enabled=false in the data of the dubbo provider node.
+	DISABLED_BY_REGISTRY HealthFlag = 0x08
+	// The host failed to connect and the next connect is delayed.
+	CONNECT_BACKOFF HealthFlag = 0x10
 )
 
 // Host is an upstream host
@@ -177,6 +184,11 @@ type Host interface {
 
 	SetWeight(weight uint32)
 
+	// AddTime returns the time the host added by the discovery, zero means added with the cluster
+	AddTime() time.Time
+
+	SetAddTime(t time.Time)
+
 	Used() bool
 
 	SetUsed(used bool)
@@ -212,11 +224,14 @@ type HostStats struct {
 	UpstreamConnectionClose                        metrics.Counter
 	UpstreamConnectionActive                       metrics.Counter
 	UpstreamConnectionConFail                      metrics.Counter
+	UpstreamConnectionConTimeout                   metrics.Counter
 	UpstreamConnectionLocalClose                   metrics.Counter
 	UpstreamConnectionRemoteClose                  metrics.Counter
 	UpstreamConnectionLocalCloseWithActiveRequest  metrics.Counter
 	UpstreamConnectionRemoteCloseWithActiveRequest metrics.Counter
 	UpstreamConnectionCloseNotify                  metrics.Counter
+	UpstreamConnectionIdle                         metrics.Counter
+	UpstreamConnectionRecycle                      metrics.Counter
 	UpstreamRequestTotal                           metrics.Counter
 	UpstreamRequestActive                          metrics.Counter
 	UpstreamRequestLocalReset                      metrics.Counter
@@ -236,7 +251,8 @@ type ClusterInfo interface {
 
 	SourceAddress() net.Addr
 
-	ConnectTimeout() int
+	// ConnectTimeout bounds establishing a connection to the host, zero means no limit
+	ConnectTimeout() time.Duration
 
 	ConnBufferLimitBytes() uint32
 
@@ -262,6 +278,47 @@ type ClusterInfo interface {
 	LbSubsetInfo() LBSubsetInfo
 
 	LBInstance() LoadBalancer
+
+	// frame compression algorithm offered to upstream, empty means disabled
+	FrameCompress() string
+
+	// interval of the heartbeats sent on idle upstream connections, zero means disabled
+	HeartbeatInterval() time.Duration
+
+	// max bytes of the sofarpc response payload from upstream, zero means the default
+	MaxResponsePayload() uint64
+
+	// request body buffering policy, overrides the route default
+	RequestBufferPolicy() v2.RequestBufferPolicy
+
+	// weight ramp of the hosts added by the discovery
+	SlowStart() v2.SlowStartConfig
+
+	// idle and lifetime limit of the upstream connections
+	ConnPoolConfig() v2.ConnPoolConfig
+
+	// passive health checker of the cluster, nil means disabled
+	OutlierDetector() OutlierDetector
+
+	// drains the hosts shutting down by the responses, nil means disabled
+	HostDrainer() HostDrainer
+}
+
+// OutlierDetector ejects the hosts failed consecutively from the load balancer for a while
+type OutlierDetector interface {
+	// PutResult records the result of a request to the host, success is false on an error response
+	PutResult(host Host, success bool)
+
+	// PutTimeout records a timeout or a reset of a request to the host, an error as the error response
+	// but the ejection is counted apart in the stats
+	PutTimeout(host Host)
+}
+
+// HostDrainer stops routing new requests to the host signaling it's shutting down in the response
+type HostDrainer interface {
+	// OnResponse drains the host if the response status code, in the proxy's error codes, or the
+	// headers signal the shutdown
+	OnResponse(host Host, code int, headers HeaderMap)
 }
 
 // ResourceManager manages different types of Resource
@@ -293,12 +350,15 @@ type ClusterStats struct {
 	UpstreamConnectionClose                        metrics.Counter
 	UpstreamConnectionActive                       metrics.Counter
 	UpstreamConnectionConFail                      metrics.Counter
+	UpstreamConnectionConTimeout                   metrics.Counter
 	UpstreamConnectionRetry                        metrics.Counter
 	UpstreamConnectionLocalClose                   metrics.Counter
 	UpstreamConnectionRemoteClose                  metrics.Counter
 	UpstreamConnectionLocalCloseWithActiveRequest  metrics.Counter
 	UpstreamConnectionRemoteCloseWithActiveRequest metrics.Counter
 	UpstreamConnectionCloseNotify                  metrics.Counter
+	UpstreamConnectionIdle                         metrics.Counter
+	UpstreamConnectionRecycle                      metrics.Counter
 	UpstreamBytesReadTotal                         metrics.Counter
 	UpstreamBytesWriteTotal                        metrics.Counter
 	UpstreamRequestTotal                           metrics.Counter
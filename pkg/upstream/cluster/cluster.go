@@ -20,6 +20,7 @@ package cluster
 import (
 	"net"
 	"sync"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
@@ -75,6 +76,14 @@ func newCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaAPI bool,
 			connBufferLimitBytes: clusterConfig.ConnBufferLimitBytes,
 			stats:                newClusterStats(clusterConfig.Name),
 			lbSubsetInfo:         NewLBSubsetInfo(&clusterConfig.LBSubSetConfig), // new subset load balancer info
+			frameCompress:        clusterConfig.FrameCompress,
+			connectTimeout:       clusterConfig.ConnectTimeout.Duration,
+			heartbeatInterval:    clusterConfig.HeartbeatInterval.Duration,
+			maxResponsePayload:   clusterConfig.MaxResponsePayload,
+			requestBufferPolicy:  clusterConfig.RequestBufferPolicy,
+			slowStart:            clusterConfig.SlowStart,
+			zoneKey:              clusterConfig.LocalityLB.ZoneKey,
+			connPoolConfig:       clusterConfig.ConnPool,
 		},
 		initHelper: initHelper,
 	}
@@ -85,24 +94,60 @@ func newCluster(clusterConfig v2.Cluster, sourceAddr net.Addr, addedViaAPI bool,
 
 	case v2.LB_ROUNDROBIN:
 		cluster.info.lbType = types.RoundRobin
+
+	case v2.LB_WRR:
+		cluster.info.lbType = types.WeightedRoundRobin
+
+	case v2.LB_CONSISTENT_HASH:
+		cluster.info.lbType = types.ConsistentHash
+
+	case v2.LB_WEIGHTED_RANDOM:
+		cluster.info.lbType = types.WeightedRandom
+	}
+
+	if clusterConfig.HostSelector != "" {
+		if isHostSelectorRegistered(clusterConfig.HostSelector) {
+			cluster.info.lbType = types.LoadBalancerType(clusterConfig.HostSelector)
+		} else {
+			log.DefaultLogger.Errorf("cluster %s: unknown host selector %s, use the lb type %s",
+				clusterConfig.Name, clusterConfig.HostSelector, clusterConfig.LbType)
+		}
 	}
 
-	// TODO: init more props: maxrequestsperconn, connecttimeout, connectionbuflimit
+	// TODO: init more props: maxrequestsperconn, connectionbuflimit
 
 	cluster.info.resourceManager = NewResourceManager(clusterConfig.CirBreThresholds)
+	cluster.info.outlierDetector = newOutlierDetector(&cluster, clusterConfig.OutlierDetection)
+	cluster.info.hostDrainer = newHostDrainer(&cluster, clusterConfig.HostDrain)
+	cluster.info.reresolver = newHostReresolver(&cluster, clusterConfig.Reresolve)
+	cluster.info.connectBackoff = newConnectBackoff(&cluster, clusterConfig.ConnectBackoff)
+	cluster.info.liveWeight = newLiveWeightWatcher(&cluster, clusterConfig.LiveWeight)
 
 	cluster.prioritySet.GetOrCreateHostSet(0)
 	cluster.prioritySet.AddMemberUpdateCb(func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
 		// TODO: update cluster stats
 	})
 
+	// newLB creates the load balancer of the lb type for the cluster hosts or a subset of them
+	newLB := func(prioritySet types.PrioritySet) types.LoadBalancer {
+		if cluster.Info().LbType() == types.ConsistentHash {
+			return newConsistentHashLoadBalancer(prioritySet, clusterConfig.ConsistentHash)
+		}
+		return NewLoadBalancer(cluster.Info().LbType(), prioritySet)
+	}
+
 	var lb types.LoadBalancer
 
 	if cluster.Info().LbSubsetInfo().IsEnabled() {
 		// use subset loadbalancer
-		lb = NewSubsetLoadBalancer(cluster.Info().LbType(), cluster.PrioritySet(), cluster.Info().Stats(),
+		lb = newSubsetLoadBalancer(newLB, cluster.PrioritySet(), cluster.Info().Stats(),
 			cluster.Info().LbSubsetInfo())
 
+	} else if cluster.Info().LbType() == types.ConsistentHash {
+		lb = newLB(cluster.PrioritySet())
+	} else if clusterConfig.LocalityLB.ZoneKey != "" && localZone != "" {
+		lb = newLocalityLoadBalancer(cluster.Info().LbType(), cluster.PrioritySet(), clusterConfig.Name,
+			clusterConfig.LocalityLB)
 	} else {
 		// use common loadbalancer
 		lb = NewLoadBalancer(cluster.Info().LbType(), cluster.PrioritySet())
@@ -190,7 +235,7 @@ type clusterInfo struct {
 	lbType               types.LoadBalancerType // if use subset lb , lbType is used as inner LB algorithm for choosing subset's host
 	lbInstance           types.LoadBalancer     // load balancer used for this cluster
 	sourceAddr           net.Addr
-	connectTimeout       int
+	connectTimeout       time.Duration
 	connBufferLimitBytes uint32
 	features             int
 	maxRequestsPerConn   uint32
@@ -200,6 +245,18 @@ type clusterInfo struct {
 	healthCheckProtocol  string
 	tlsMng               types.TLSContextManager
 	lbSubsetInfo         types.LBSubsetInfo
+	frameCompress        string
+	heartbeatInterval    time.Duration
+	maxResponsePayload   uint64
+	requestBufferPolicy  v2.RequestBufferPolicy
+	slowStart            v2.SlowStartConfig
+	connPoolConfig       v2.ConnPoolConfig
+	outlierDetector      *outlierDetector
+	hostDrainer          *hostDrainer
+	reresolver           *hostReresolver
+	connectBackoff       *connectBackoff
+	liveWeight           *liveWeightWatcher
+	zoneKey              string // host metadata key of the zone, see v2.LocalityLBConfig
 }
 
 func NewClusterInfo() types.ClusterInfo {
@@ -222,7 +279,7 @@ func (ci *clusterInfo) SourceAddress() net.Addr {
 	return ci.sourceAddr
 }
 
-func (ci *clusterInfo) ConnectTimeout() int {
+func (ci *clusterInfo) ConnectTimeout() time.Duration {
 	return ci.connectTimeout
 }
 
@@ -274,6 +331,44 @@ func (ci *clusterInfo) LBInstance() types.LoadBalancer {
 	return ci.lbInstance
 }
 
+func (ci *clusterInfo) FrameCompress() string {
+	return ci.frameCompress
+}
+
+func (ci *clusterInfo) HeartbeatInterval() time.Duration {
+	return ci.heartbeatInterval
+}
+
+func (ci *clusterInfo) MaxResponsePayload() uint64 {
+	return ci.maxResponsePayload
+}
+
+func (ci *clusterInfo) RequestBufferPolicy() v2.RequestBufferPolicy {
+	return ci.requestBufferPolicy
+}
+
+func (ci *clusterInfo) SlowStart() v2.SlowStartConfig {
+	return ci.slowStart
+}
+
+func (ci *clusterInfo) ConnPoolConfig() v2.ConnPoolConfig {
+	return ci.connPoolConfig
+}
+
+func (ci *clusterInfo) OutlierDetector() types.OutlierDetector {
+	if ci.outlierDetector == nil {
+		return nil
+	}
+	return ci.outlierDetector
+}
+
+func (ci *clusterInfo) HostDrainer() types.HostDrainer {
+	if ci.hostDrainer == nil {
+		return nil
+	}
+	return ci.hostDrainer
+}
+
 type prioritySet struct {
 	hostSets        []types.HostSet // Note: index is the priority
 	updateCallbacks []types.MemberUpdateCallback
@@ -376,10 +471,12 @@ func addHealthyHost(hostSets []types.HostSet, host types.Host) {
 		}
 
 		if found {
-			newHealthHost := hostSet.HealthyHosts()
-			newHealthHost = append(newHealthHost, host)
-			newHealthyHostPerLocality := hostSet.HealthHostsPerLocality()
-			newHealthyHostPerLocality[len(newHealthyHostPerLocality)-1] = append(newHealthyHostPerLocality[len(newHealthyHostPerLocality)-1], host)
+			// build new slices, the healthy hosts may share the underlying array with the hosts
+			newHealthHost := append(append([]types.Host{}, hostSet.HealthyHosts()...), host)
+			newHealthyHostPerLocality := append([][]types.Host{}, hostSet.HealthHostsPerLocality()...)
+			if last := len(newHealthyHostPerLocality) - 1; last >= 0 {
+				newHealthyHostPerLocality[last] = append(append([]types.Host{}, newHealthyHostPerLocality[last]...), host)
+			}
 
 			hostSet.UpdateHosts(hostSet.Hosts(), newHealthHost, hostSet.HostsPerLocality(),
 				newHealthyHostPerLocality, nil, nil)
@@ -402,25 +499,23 @@ func delHealthHost(hostSets []types.HostSet, host types.Host) {
 		}
 
 		if found {
-			newHealthHost := hostSet.HealthyHosts()
-			newHealthyHostPerLocality := hostSet.HealthHostsPerLocality()
-
-			for i, hh := range newHealthHost {
-				if host.Hostname() == hh.Hostname() {
-					//remove
-					newHealthHost = append(newHealthHost[:i], newHealthHost[i+1:]...)
-					break
+			// build new slices, the healthy hosts may share the underlying array with the hosts
+			var newHealthHost []types.Host
+			for _, hh := range hostSet.HealthyHosts() {
+				if host.AddressString() != hh.AddressString() {
+					newHealthHost = append(newHealthHost, hh)
 				}
 			}
 
-			for i := range newHealthyHostPerLocality {
-				for j := range newHealthyHostPerLocality[i] {
-
-					if host.Hostname() == newHealthyHostPerLocality[i][j].Hostname() {
-						newHealthyHostPerLocality[i] = append(newHealthyHostPerLocality[i][:j], newHealthyHostPerLocality[i][j+1:]...)
-						break
+			var newHealthyHostPerLocality [][]types.Host
+			for _, locality := range hostSet.HealthHostsPerLocality() {
+				var newLocality []types.Host
+				for _, hh := range locality {
+					if host.AddressString() != hh.AddressString() {
+						newLocality = append(newLocality, hh)
 					}
 				}
+				newHealthyHostPerLocality = append(newHealthyHostPerLocality, newLocality)
 			}
 
 			hostSet.UpdateHosts(hostSet.Hosts(), newHealthHost, hostSet.HostsPerLocality(),
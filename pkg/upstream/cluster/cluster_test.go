@@ -49,3 +49,59 @@ func TestPrioritySet_GetHostInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestAddHealthyHostWithoutLocality(t *testing.T) {
+	ps := prioritySet{}
+	hs := ps.GetOrCreateHostSet(0)
+	info := &clusterInfo{
+		name: "test",
+	}
+	var hosts []types.Host
+	for _, addr := range []string{"127.0.0.1:8080", "127.0.0.2:8080", "127.0.0.3:8080"} {
+		hosts = append(hosts, NewHost(v2.Host{HostConfig: v2.HostConfig{Address: addr}}, info))
+	}
+	// the healthy hosts share the underlying array with the hosts, no localities
+	hs.UpdateHosts(hosts, hosts[:1], nil, nil, nil, nil)
+	addrs := []string{"127.0.0.1:8080", "127.0.0.2:8080", "127.0.0.3:8080"}
+
+	// the un-ejected host is added back
+	addHealthyHost(ps.hostSets, hosts[2])
+
+	if len(hs.Hosts()) != len(addrs) {
+		t.Fatalf("hosts should be unchanged, got %d hosts", len(hs.Hosts()))
+	}
+	for i, h := range hs.Hosts() {
+		if h.AddressString() != addrs[i] {
+			t.Errorf("hosts should be unchanged, #%d is %s, expect %s", i, h.AddressString(), addrs[i])
+		}
+	}
+	if healthy := hs.HealthyHosts(); len(healthy) != 2 || healthy[1] != hosts[2] {
+		t.Errorf("unexpected healthy hosts: %v", healthy)
+	}
+	if len(hs.HealthHostsPerLocality()) != 0 {
+		t.Errorf("unexpected healthy hosts per locality: %v", hs.HealthHostsPerLocality())
+	}
+}
+
+func TestDelHealthHostWithoutHostname(t *testing.T) {
+	ps := prioritySet{}
+	hs := ps.GetOrCreateHostSet(0)
+	info := &clusterInfo{
+		name: "test",
+	}
+	var hosts []types.Host
+	for _, addr := range []string{"127.0.0.1:8080", "127.0.0.2:8080", "127.0.0.3:8080"} {
+		hosts = append(hosts, NewHost(v2.Host{HostConfig: v2.HostConfig{Address: addr}}, info))
+	}
+	hs.UpdateHosts(hosts, hosts, nil, [][]types.Host{hosts}, nil, nil)
+
+	// the discovered hosts have no hostname, only the host deleted is unhealthy
+	delHealthHost(ps.hostSets, hosts[1])
+
+	if healthy := hs.HealthyHosts(); len(healthy) != 2 || healthy[0] != hosts[0] || healthy[1] != hosts[2] {
+		t.Errorf("unexpected healthy hosts: %v", healthy)
+	}
+	if locality := hs.HealthHostsPerLocality(); len(locality) != 1 || len(locality[0]) != 2 {
+		t.Errorf("unexpected healthy hosts per locality: %v", locality)
+	}
+}
@@ -24,12 +24,14 @@ import (
 	"net"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/admin"
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/proxy"
 	"github.com/alipay/sofa-mosn/pkg/rcu"
+	"github.com/alipay/sofa-mosn/pkg/stats"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
@@ -74,6 +76,8 @@ func NewClusterManager(sourceAddr net.Addr, clusters []v2.Cluster,
 
 	//init clusterMngInstance when run app
 	initClusterMngAdapterInstance(clusterMangerInstance)
+	admin.SetHostsStatus(clusterMangerInstance.hostsStatus)
+	admin.SetOutlierOverride(SetOutlierOverride)
 
 	//Add cluster to cm
 	//Register upstream update type
@@ -130,6 +134,15 @@ type primaryCluster struct {
 	configUsed  *v2.Cluster // used for update
 	configLock  *rcu.Value
 	updateLock  sync.Mutex
+	onSeeds     bool                 // running on the seed hosts, guarded by updateLock
+	discovered  discoveredHostsState // guarded by updateLock
+
+	preconnector *preconnector // nil if preconnect disabled, guarded by updateLock
+
+	// discovered hosts waiting for the debounce window, guarded by pendingLock
+	pendingLock  sync.Mutex
+	pendingHosts []v2.Host
+	pendingTimer *time.Timer // nil if no update is pending
 }
 
 func NewPrimaryCluster(cluster types.Cluster, config *v2.Cluster, addedViaAPI bool) *primaryCluster {
@@ -158,6 +171,21 @@ func (pc *primaryCluster) UpdateCluster(cluster types.Cluster, config *v2.Cluste
 func (pc *primaryCluster) UpdateHosts(hosts []types.Host) error {
 	pc.updateLock.Lock()
 	defer pc.updateLock.Unlock()
+	return pc.updateHosts(hosts)
+}
+
+// setPreconnector replaces the preconnector of the cluster, the previous one is stopped
+func (pc *primaryCluster) setPreconnector(p *preconnector) {
+	pc.updateLock.Lock()
+	defer pc.updateLock.Unlock()
+	if pc.preconnector != nil {
+		pc.preconnector.stop()
+	}
+	pc.preconnector = p
+}
+
+// updateHosts is called with the updateLock held
+func (pc *primaryCluster) updateHosts(hosts []types.Host) error {
 	if c, ok := pc.cluster.(*simpleInMemCluster); ok {
 		c.UpdateHosts(hosts)
 	}
@@ -174,6 +202,127 @@ func (pc *primaryCluster) UpdateHosts(hosts []types.Host) error {
 	return nil
 }
 
+// updateHostConfigs updates the hosts, the seed hosts are used if hostConfigs is empty and seeds configured.
+// It returns the host configs in use
+func (pc *primaryCluster) updateHostConfigs(hostConfigs []v2.Host) ([]v2.Host, error) {
+	pc.updateLock.Lock()
+	emptyChanged := pc.discovered.update(len(hostConfigs))
+	empty, name := pc.discovered.empty, pc.configUsed.Name
+	hostConfigs, err := pc.updateHostConfigsLocked(hostConfigs)
+	pc.updateLock.Unlock()
+
+	if emptyChanged {
+		notifyEmptyHosts(name, empty)
+	}
+	return hostConfigs, err
+}
+
+// updateHostConfigsLocked is called with the updateLock held
+func (pc *primaryCluster) updateHostConfigsLocked(hostConfigs []v2.Host) ([]v2.Host, error) {
+	onSeeds := len(hostConfigs) == 0 && len(pc.configUsed.SeedHosts) > 0
+	if onSeeds {
+		hostConfigs = pc.configUsed.SeedHosts
+	}
+	var hosts []types.Host
+	for _, hc := range hostConfigs {
+		hosts = append(hosts, NewHost(hc, pc.cluster.Info()))
+	}
+	if err := pc.updateHosts(hosts); err != nil {
+		return nil, err
+	}
+
+	name := pc.configUsed.Name
+	if onSeeds != pc.onSeeds {
+		s := stats.NewClusterStats(name)
+		if onSeeds {
+			log.DefaultLogger.Warnf("no hosts discovered for cluster %s, fall back to %d seed hosts", name, len(hostConfigs))
+			s.Gauge(stats.UpstreamSeedHostsActive).Update(1)
+			s.Counter(stats.UpstreamSeedHostsFallback).Inc(1)
+		} else {
+			log.DefaultLogger.Infof("hosts discovered for cluster %s, seed hosts replaced", name)
+			s.Gauge(stats.UpstreamSeedHostsActive).Update(0)
+		}
+		pc.onSeeds = onSeeds
+	}
+	return hostConfigs, nil
+}
+
+// applyDiscoveredHosts updates the hosts discovered. If the discovery debounce is set, the updates within
+// the window are coalesced, only the latest hosts are applied once the window elapses, so the host set is
+// rebuilt once and only the hosts actually added or removed since the last applied update are changed
+func (pc *primaryCluster) applyDiscoveredHosts(hostConfigs []v2.Host) error {
+	pc.updateLock.Lock()
+	window := pc.configUsed.DiscoveryDebounce.Duration
+	pc.updateLock.Unlock()
+
+	if window <= 0 {
+		return pc.applyHostConfigs(hostConfigs)
+	}
+
+	pc.pendingLock.Lock()
+	defer pc.pendingLock.Unlock()
+	pc.pendingHosts = hostConfigs
+	if pc.pendingTimer == nil {
+		pc.pendingTimer = time.AfterFunc(window, pc.flushPendingHosts)
+	}
+	return nil
+}
+
+// flushPendingHosts applies the latest hosts discovered in the debounce window
+func (pc *primaryCluster) flushPendingHosts() {
+	pc.pendingLock.Lock()
+	if pc.pendingTimer == nil {
+		// stopped
+		pc.pendingLock.Unlock()
+		return
+	}
+	hostConfigs := pc.pendingHosts
+	pc.pendingHosts = nil
+	pc.pendingTimer = nil
+	pc.pendingLock.Unlock()
+
+	if err := pc.applyHostConfigs(hostConfigs); err != nil {
+		log.DefaultLogger.Errorf("apply the debounced hosts failed: %v", err)
+	}
+}
+
+// removePendingHost removes the host from the pending update, so it won't be added back by the update
+// discovered before the removal
+func (pc *primaryCluster) removePendingHost(address string) {
+	pc.pendingLock.Lock()
+	defer pc.pendingLock.Unlock()
+	if pc.pendingTimer == nil {
+		return
+	}
+	var hostConfigs []v2.Host
+	for _, hc := range pc.pendingHosts {
+		if hc.Address != address {
+			hostConfigs = append(hostConfigs, hc)
+		}
+	}
+	pc.pendingHosts = hostConfigs
+}
+
+// stopPendingHosts drops the pending update
+func (pc *primaryCluster) stopPendingHosts() {
+	pc.pendingLock.Lock()
+	defer pc.pendingLock.Unlock()
+	if pc.pendingTimer != nil {
+		pc.pendingTimer.Stop()
+		pc.pendingTimer = nil
+		pc.pendingHosts = nil
+	}
+}
+
+func (pc *primaryCluster) applyHostConfigs(hostConfigs []v2.Host) error {
+	hostConfigs, err := pc.updateHostConfigs(hostConfigs)
+	if err != nil {
+		return fmt.Errorf("UpdateClusterHosts failed, cluster's hostset %s can't be update", pc.cluster.Info().Name())
+	}
+	admin.SetHosts(pc.cluster.Info().Name(), hostConfigs)
+	return nil
+}
+
 func deepCopyCluster(cluster *v2.Cluster) *v2.Cluster {
 	if cluster == nil {
 		return nil
@@ -222,9 +371,16 @@ func (cm *clusterManager) updateCluster(clusterConf v2.Cluster, pcluster *primar
 
 	if concretedCluster, ok := pcluster.cluster.(*simpleInMemCluster); ok {
 		hosts := concretedCluster.hosts
+		registry := pcluster.configUsed.Registry
 		cluster := NewCluster(clusterConf, cm.sourceAddr, addedViaAPI)
+		preconnector := cm.preconnectHostsAdded(cluster, clusterConf)
+		// the hosts of the old registry are kept until the new one updates them
 		cluster.(*simpleInMemCluster).UpdateHosts(hosts)
 		pcluster.UpdateCluster(cluster, &clusterConf, addedViaAPI)
+		pcluster.setPreconnector(preconnector)
+		if registry != clusterConf.Registry {
+			notifyRegistrySwitch(clusterConf.Name, registry, clusterConf.Registry)
+		}
 
 		return true
 	}
@@ -245,11 +401,29 @@ func (cm *clusterManager) loadCluster(clusterConfig v2.Cluster, addedViaAPI bool
 		})
 	})
 
-	cm.primaryClusters.Store(clusterConfig.Name, NewPrimaryCluster(cluster, &clusterConfig, addedViaAPI))
+	pc := NewPrimaryCluster(cluster, &clusterConfig, addedViaAPI)
+	pc.setPreconnector(cm.preconnectHostsAdded(cluster, clusterConfig))
+	cm.primaryClusters.Store(clusterConfig.Name, pc)
+
+	// starts with the seed hosts until the discovery succeeds
+	if len(clusterConfig.Hosts) == 0 && len(clusterConfig.SeedHosts) > 0 {
+		pc.applyHostConfigs(nil)
+	}
 
 	return true
 }
 
+// preconnectHostsAdded warms up the connection pools of the hosts added to the cluster if configured
+func (cm *clusterManager) preconnectHostsAdded(cluster types.Cluster, clusterConfig v2.Cluster) *preconnector {
+	p := newPreconnector(cm, clusterConfig.Name, clusterConfig.ConnPool.Preconnect)
+	if p != nil {
+		cluster.PrioritySet().AddMemberUpdateCb(func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+			p.add(hostsAdded)
+		})
+	}
+	return p
+}
+
 func (cm *clusterManager) PutClusterSnapshot(snapshot types.ClusterSnapshot) {
 	if snapshot == nil {
 		return
@@ -287,6 +461,8 @@ func (cm *clusterManager) RemovePrimaryCluster(clusterName string) error {
 			return fmt.Errorf("Remove Primary Cluster Failed, Cluster Name = %s not addedViaAPI", clusterName)
 		}
 		cm.primaryClusters.Delete(clusterName)
+		v.(*primaryCluster).setPreconnector(nil)
+		v.(*primaryCluster).stopPendingHosts()
 		log.DefaultLogger.Debugf("Remove Primary Cluster, Cluster Name = %s", clusterName)
 		return nil
 	}
@@ -298,16 +474,7 @@ func (cm *clusterManager) SetInitializedCb(cb func()) {}
 
 func (cm *clusterManager) UpdateClusterHosts(clusterName string, priority uint32, hostConfigs []v2.Host) error {
 	if v, ok := cm.primaryClusters.Load(clusterName); ok {
-		pc := v.(*primaryCluster)
-		var hosts []types.Host
-		for _, hc := range hostConfigs {
-			hosts = append(hosts, NewHost(hc, pc.cluster.Info()))
-		}
-		if err := pc.UpdateHosts(hosts); err != nil {
-			return fmt.Errorf("UpdateClusterHosts failed, cluster's hostset %s can't be update", clusterName)
-		}
-		admin.SetHosts(clusterName, hostConfigs)
-		return nil
+		return v.(*primaryCluster).applyDiscoveredHosts(hostConfigs)
 	}
 
 	return fmt.Errorf("UpdateClusterHosts failed, cluster %s not found", clusterName)
@@ -321,6 +488,7 @@ func (cm *clusterManager) RemoveClusterHost(clusterName string, hostAddress stri
 	if v, ok := cm.primaryClusters.Load(clusterName); ok {
 		pc := v.(*primaryCluster)
 		pcc := pc.cluster
+		pc.removePendingHost(hostAddress)
 
 		found := false
 		if concretedCluster, ok := pcc.(*simpleInMemCluster); ok {
@@ -357,7 +525,7 @@ func (cm *clusterManager) TCPConnForCluster(lbCtx types.LoadBalancerContext, sna
 		return types.CreateConnectionData{}
 	}
 
-	host := clusterSnapshot.loadbalancer.ChooseHost(lbCtx)
+	host := chooseHost(clusterSnapshot.loadbalancer, lbCtx)
 
 	if host != nil {
 		return host.CreateConnection(nil)
@@ -377,32 +545,58 @@ func (cm *clusterManager) ConnPoolForCluster(balancerContext types.LoadBalancerC
 		return nil
 	}
 
-	host := clusterSnapshot.loadbalancer.ChooseHost(balancerContext)
+	host := overrideHost(clusterSnapshot.prioritySet, balancerContext)
+	if host == nil {
+		host = chooseHost(clusterSnapshot.loadbalancer, balancerContext)
+	}
 
 	if host != nil {
-		addr := host.AddressString()
-		log.DefaultLogger.Debugf(" clusterSnapshot.loadbalancer.ChooseHost result is %s, cluster name = %s", addr, snapshot.ClusterInfo().Name())
-
-		value, _ := cm.protocolConnPool.Load(protocol)
+		log.DefaultLogger.Debugf(" clusterSnapshot.loadbalancer.ChooseHost result is %s, cluster name = %s", host.AddressString(), snapshot.ClusterInfo().Name())
 
-		connectionPool := value.(*sync.Map)
-		if connPool, ok := connectionPool.Load(addr); ok {
-			return connPool.(types.ConnectionPool)
+		if connPool := cm.getConnPool(host, protocol); connPool != nil {
+			return connPool
 		}
-		if factory, ok := proxy.ConnNewPoolFactories[protocol]; ok {
-			newPool := factory(host) //call NewBasicRoute
+	}
 
-			connectionPool.Store(addr, newPool)
+	log.DefaultLogger.Errorf("clusterSnapshot.loadbalancer.ChooseHost is nil, cluster name = %s", snapshot.ClusterInfo().Name())
+	return nil
+}
 
-			return newPool
-		}
+// getConnPool returns the connection pool of the host, a new one is created if not exists
+func (cm *clusterManager) getConnPool(host types.Host, protocol types.Protocol) types.ConnectionPool {
+	value, ok := cm.protocolConnPool.Load(protocol)
+	if !ok {
+		return nil
+	}
+
+	addr := host.AddressString()
+	connectionPool := value.(*sync.Map)
+	if connPool, ok := connectionPool.Load(addr); ok {
+		return connPool.(types.ConnectionPool)
+	}
+	if factory, ok := proxy.ConnNewPoolFactories[protocol]; ok {
+		newPool := factory(host) //call NewBasicRoute
+
+		// the pool may be created by the preconnect at the same time
+		connPool, _ := connectionPool.LoadOrStore(addr, newPool)
+
+		return connPool.(types.ConnectionPool)
 	}
 
-	log.DefaultLogger.Errorf("clusterSnapshot.loadbalancer.ChooseHost is nil, cluster name = %s", snapshot.ClusterInfo().Name())
 	return nil
 }
 
+// Shutdown closes the connection pools of all the upstream hosts, it is called on shutdown
+// once the in-flight streams of the downstream connections finish
 func (cm *clusterManager) Shutdown() error {
+	cm.protocolConnPool.Range(func(protocol, pools interface{}) bool {
+		pools.(*sync.Map).Range(func(addr, pool interface{}) bool {
+			pool.(types.ConnectionPool).Close()
+			pools.(*sync.Map).Delete(addr)
+			return true
+		})
+		return true
+	})
 	return nil
 }
 
@@ -426,3 +620,47 @@ func (cm *clusterManager) Destory() {
 		clusterMangerInstance = nil
 	}
 }
+
+// overrideHost returns the healthy host named by the context, nil means the load balancer should choose
+func overrideHost(prioritySet types.PrioritySet, lbCtx types.LoadBalancerContext) types.Host {
+	override, ok := lbCtx.(types.HostOverrideContext)
+	if !ok || prioritySet == nil {
+		return nil
+	}
+	name := override.OverrideHost()
+	if name == "" {
+		return nil
+	}
+
+	for _, hostSet := range prioritySet.HostSetsByPriority() {
+		for _, host := range hostSet.HealthyHosts() {
+			if host.AddressString() == name || host.Hostname() == name {
+				return host
+			}
+		}
+	}
+
+	log.DefaultLogger.Debugf("override host %s is not a healthy host, use the load balancer", name)
+	return nil
+}
+
+// maxExcludedHostRetries is the max times to choose again if the chosen host is excluded by the context
+const maxExcludedHostRetries = 3
+
+// chooseHost chooses a host from the load balancer, the hosts excluded by the context
+// are deprioritized: an excluded host is returned only if no other host is chosen in retries
+func chooseHost(lb types.LoadBalancer, lbCtx types.LoadBalancerContext) types.Host {
+	host := lb.ChooseHost(lbCtx)
+	exclusion, ok := lbCtx.(types.HostExclusionContext)
+	if !ok || host == nil || !exclusion.IsHostExcluded(host) {
+		return host
+	}
+
+	for i := 0; i < maxExcludedHostRetries; i++ {
+		if h := lb.ChooseHost(lbCtx); h != nil && !exclusion.IsHostExcluded(h) {
+			return h
+		}
+	}
+
+	return host
+}
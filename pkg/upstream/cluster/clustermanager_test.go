@@ -18,9 +18,14 @@
 package cluster
 
 import (
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/router"
+	"github.com/alipay/sofa-mosn/pkg/stats"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
@@ -39,3 +44,374 @@ func TestPrimaryCluster(t *testing.T) {
 		t.Error("update hosts failed")
 	}
 }
+
+func TestSeedHostsFallback(t *testing.T) {
+	config := v2.Cluster{
+		Name:        "seed_test",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		SeedHosts: []v2.Host{
+			newHostV2("127.0.0.1:8080", "seed1", 0, nil),
+			newHostV2("127.0.0.2:8080", "seed2", 0, nil),
+		},
+	}
+	pc := NewPrimaryCluster(newSimpleInMemCluster(config, nil, true), &config, true)
+	s := stats.NewClusterStats(config.Name)
+	fallbackBase := s.Counter(stats.UpstreamSeedHostsFallback).Count()
+
+	check := func(expected []string, onSeeds int64) {
+		hosts := pc.cluster.PrioritySet().HostSetsByPriority()[0].Hosts()
+		if len(hosts) != len(expected) {
+			t.Fatalf("expect %d hosts, got %d", len(expected), len(hosts))
+		}
+		for i, h := range hosts {
+			if h.AddressString() != expected[i] {
+				t.Errorf("expect host %s, got %s", expected[i], h.AddressString())
+			}
+		}
+		if v := s.Gauge(stats.UpstreamSeedHostsActive).Value(); v != onSeeds {
+			t.Errorf("expect seed hosts active %d, got %d", onSeeds, v)
+		}
+	}
+
+	// no hosts discovered
+	if _, err := pc.updateHostConfigs(nil); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	check([]string{"127.0.0.1:8080", "127.0.0.2:8080"}, 1)
+
+	// discovered hosts replace the seeds
+	if _, err := pc.updateHostConfigs([]v2.Host{newHostV2("127.0.0.3:8080", "dynamic", 0, nil)}); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	check([]string{"127.0.0.3:8080"}, 0)
+
+	// all hosts removed
+	if _, err := pc.updateHostConfigs(nil); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	check([]string{"127.0.0.1:8080", "127.0.0.2:8080"}, 1)
+
+	if fallback := s.Counter(stats.UpstreamSeedHostsFallback).Count() - fallbackBase; fallback != 2 {
+		t.Errorf("expect fallback 2 times, got %d", fallback)
+	}
+}
+
+func TestDiscoveryDebounce(t *testing.T) {
+	config := v2.Cluster{
+		Name:              "debounce_test",
+		ClusterType:       v2.SIMPLE_CLUSTER,
+		DiscoveryDebounce: v2.DurationConfig{Duration: 50 * time.Millisecond},
+	}
+	pc := NewPrimaryCluster(newSimpleInMemCluster(config, nil, true), &config, true)
+	hostsConfig := func(addrs ...string) []v2.Host {
+		var hosts []v2.Host
+		for _, addr := range addrs {
+			hosts = append(hosts, newHostV2(addr, addr, 0, nil))
+		}
+		return hosts
+	}
+	if _, err := pc.updateHostConfigs(hostsConfig("127.0.0.1:8080", "127.0.0.2:8080")); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	kept := pc.cluster.PrioritySet().HostSetsByPriority()[0].Hosts()[1]
+
+	updates := 0
+	var added, removed []types.Host
+	pc.cluster.PrioritySet().AddMemberUpdateCb(func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+		updates++
+		added, removed = hostsAdded, hostsRemoved
+	})
+
+	// the flapping host 127.0.0.3 is added and removed in the window
+	for _, hosts := range [][]v2.Host{
+		hostsConfig("127.0.0.1:8080", "127.0.0.2:8080", "127.0.0.3:8080"),
+		hostsConfig("127.0.0.2:8080"),
+		hostsConfig("127.0.0.2:8080", "127.0.0.4:8080", "127.0.0.5:8080"),
+	} {
+		if err := pc.applyDiscoveredHosts(hosts); err != nil {
+			t.Fatalf("apply discovered hosts failed: %v", err)
+		}
+	}
+	// removed by the api in the window
+	pc.removePendingHost("127.0.0.5:8080")
+	if updates != 0 {
+		t.Fatalf("hosts updated in the debounce window")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if updates != 1 {
+		t.Fatalf("expect hosts updated once, got %d", updates)
+	}
+	if len(added) != 1 || added[0].AddressString() != "127.0.0.4:8080" {
+		t.Errorf("unexpected hosts added: %v", added)
+	}
+	if len(removed) != 1 || removed[0].AddressString() != "127.0.0.1:8080" {
+		t.Errorf("unexpected hosts removed: %v", removed)
+	}
+	hosts := pc.cluster.PrioritySet().HostSetsByPriority()[0].Hosts()
+	if len(hosts) != 2 || hosts[0] != kept {
+		t.Errorf("unchanged host should be kept, got %v", hosts)
+	}
+
+	// pending update is dropped once stopped
+	pc.applyDiscoveredHosts(nil)
+	pc.stopPendingHosts()
+	time.Sleep(100 * time.Millisecond)
+	if updates != 1 {
+		t.Errorf("stopped pending update applied")
+	}
+}
+
+// exclusionContextMock excludes hosts by the route's host exclusion policy as the proxy does
+type exclusionContextMock struct {
+	ContextImplMock
+	route types.RouteRule
+}
+
+func (ci *exclusionContextMock) IsHostExcluded(host types.Host) bool {
+	return ci.route.Policy().HostExclusionPolicy().IsExcluded(host)
+}
+
+func TestChooseHostWithExclusion(t *testing.T) {
+	newRoute := func() types.RouteRule {
+		route, err := router.NewRouteRuleImplBase(nil, &v2.Router{
+			RouterConfig: v2.RouterConfig{
+				Route: v2.RouteAction{
+					RouterActionConfig:  v2.RouterActionConfig{ClusterName: "test"},
+					HostExclusionWindow: 100 * time.Millisecond,
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create route failed: %v", err)
+		}
+		return route
+	}
+	failedRoute, otherRoute := newRoute(), newRoute()
+
+	host1 := NewHost(newHostV2("127.0.0.1", "test", 0, nil), nil)
+	host2 := NewHost(newHostV2("127.0.0.2", "test", 0, nil), nil)
+	hosts := []types.Host{host1, host2}
+	lb := &roundRobinLoadBalancer{
+		loadbalancer: loadbalancer{
+			prioritySet: &prioritySet{
+				hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+			},
+		},
+	}
+
+	// host1 fails once on the route
+	failedRoute.Policy().HostExclusionPolicy().Exclude(host1)
+
+	failedCtx := &exclusionContextMock{route: failedRoute}
+	for i := 0; i < 4; i++ {
+		if host := chooseHost(lb, failedCtx); host != host2 {
+			t.Fatalf("#%d expect the failed host deprioritized, got %s", i, host.AddressString())
+		}
+	}
+
+	// other routes are not affected
+	otherCtx := &exclusionContextMock{route: otherRoute}
+	chosen := map[types.Host]bool{}
+	for i := 0; i < 2; i++ {
+		chosen[chooseHost(lb, otherCtx)] = true
+	}
+	if !chosen[host1] {
+		t.Error("the failed host should not be excluded on other routes")
+	}
+
+	// the failed host is still chosen if it's the only one
+	single := &roundRobinLoadBalancer{
+		loadbalancer: loadbalancer{
+			prioritySet: &prioritySet{
+				hostSets: []types.HostSet{&hostSet{hosts: hosts[:1], healthyHosts: hosts[:1]}},
+			},
+		},
+	}
+	if host := chooseHost(single, failedCtx); host != host1 {
+		t.Error("the excluded host should be chosen if no other host available")
+	}
+
+	// the exclusion is temporary
+	time.Sleep(150 * time.Millisecond)
+	chosen = map[types.Host]bool{}
+	for i := 0; i < 2; i++ {
+		chosen[chooseHost(lb, failedCtx)] = true
+	}
+	if !chosen[host1] {
+		t.Error("the failed host should be chosen after the exclusion window")
+	}
+}
+
+type overrideContextMock struct {
+	ContextImplMock
+	host string
+}
+
+func (ci *overrideContextMock) OverrideHost() string {
+	return ci.host
+}
+
+func TestOverrideHost(t *testing.T) {
+	host1 := NewHost(newHostV2("127.0.0.1:12200", "host1", 1, nil), nil)
+	host2 := NewHost(newHostV2("127.0.0.2:12200", "host2", 1, nil), nil)
+	unhealthy := NewHost(newHostV2("127.0.0.3:12200", "host3", 1, nil), nil)
+	ps := &prioritySet{
+		hostSets: []types.HostSet{
+			&hostSet{hosts: []types.Host{host1, unhealthy}, healthyHosts: []types.Host{host1}},
+			&hostSet{hosts: []types.Host{host2}, healthyHosts: []types.Host{host2}},
+		},
+	}
+
+	testCases := []struct {
+		ctx      types.LoadBalancerContext
+		expected types.Host
+	}{
+		{&overrideContextMock{host: "127.0.0.2:12200"}, host2},
+		{&overrideContextMock{host: "host1"}, host1},
+		{&overrideContextMock{host: "127.0.0.3:12200"}, nil},
+		{&overrideContextMock{host: "127.0.0.4:12200"}, nil},
+		{&overrideContextMock{}, nil},
+		{&ContextImplMock{}, nil},
+		{nil, nil},
+	}
+	for i, tc := range testCases {
+		if host := overrideHost(ps, tc.ctx); host != tc.expected {
+			t.Errorf("#%d expect host %v, got %v", i, tc.expected, host)
+		}
+	}
+}
+
+type closedPoolMock struct {
+	preconnectPoolMock
+	closed bool
+}
+
+func (p *closedPoolMock) Close() {
+	p.closed = true
+}
+
+func TestClusterManagerShutdown(t *testing.T) {
+	cm := &clusterManager{}
+	pools := &sync.Map{}
+	cm.protocolConnPool.Store(types.Protocol("shutdown"), pools)
+	p1, p2 := &closedPoolMock{}, &closedPoolMock{}
+	pools.Store("127.0.0.1:8080", p1)
+	pools.Store("127.0.0.2:8080", p2)
+
+	if err := cm.Shutdown(); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if !p1.closed || !p2.closed {
+		t.Error("expect all the connection pools closed")
+	}
+	pools.Range(func(addr, pool interface{}) bool {
+		t.Errorf("expect the closed pool of %s removed", addr)
+		return true
+	})
+}
+
+func TestEmptyHostsCallback(t *testing.T) {
+	config := v2.Cluster{
+		Name:        "empty_test",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		SeedHosts:   []v2.Host{newHostV2("127.0.0.1:8080", "seed", 0, nil)},
+	}
+	var events []bool
+	AddEmptyHostsCallback(func(clusterName string, empty bool) {
+		if clusterName == config.Name {
+			events = append(events, empty)
+		}
+	})
+	pc := NewPrimaryCluster(newSimpleInMemCluster(config, nil, true), &config, true)
+	s := stats.NewClusterStats(config.Name)
+	emptyBase := s.Counter(stats.UpstreamHostsEmptyTotal).Count()
+	update := func(hosts ...v2.Host) {
+		if _, err := pc.updateHostConfigs(hosts); err != nil {
+			t.Fatalf("update hosts failed: %v", err)
+		}
+	}
+
+	// not loaded yet is not empty
+	if len(events) != 0 || s.Gauge(stats.UpstreamHostsEmpty).Value() != 0 {
+		t.Fatal("expect the cluster not reported empty before the discovery")
+	}
+
+	// loaded and found nothing, the seed hosts don't hide it
+	update()
+	update()
+	if !reflect.DeepEqual(events, []bool{true}) || s.Gauge(stats.UpstreamHostsEmpty).Value() != 1 {
+		t.Fatalf("expect the cluster reported empty once, got %v", events)
+	}
+
+	update(newHostV2("127.0.0.2:8080", "h1", 0, nil))
+	update(newHostV2("127.0.0.3:8080", "h2", 0, nil))
+	update()
+	if !reflect.DeepEqual(events, []bool{true, false, true}) {
+		t.Errorf("expect the transitions reported, got %v", events)
+	}
+	if empty := s.Counter(stats.UpstreamHostsEmptyTotal).Count() - emptyBase; empty != 2 {
+		t.Errorf("expect empty 2 times, got %d", empty)
+	}
+
+	// the hosts found at first are not a transition
+	events = nil
+	config.Name = "empty_test_loaded"
+	pc = NewPrimaryCluster(newSimpleInMemCluster(config, nil, true), &config, true)
+	update(newHostV2("127.0.0.2:8080", "h1", 0, nil))
+	if len(events) != 0 {
+		t.Errorf("expect no event for the hosts found at first, got %v", events)
+	}
+}
+
+func TestClusterRegistrySwitch(t *testing.T) {
+	old := clusterMangerInstance
+	defer func() { clusterMangerInstance = old }()
+	cm := &clusterManager{}
+	clusterMangerInstance = cm
+
+	var switches []string
+	AddRegistrySwitchCallback(func(clusterName string, from string, to string) {
+		if clusterName == "registry_test" {
+			switches = append(switches, from+"->"+to)
+		}
+	})
+
+	config := v2.Cluster{
+		Name:        "registry_test",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		Registry:    "blue",
+	}
+	if !cm.AddOrUpdatePrimaryCluster(config) {
+		t.Fatal("add cluster failed")
+	}
+	if err := cm.UpdateClusterHosts(config.Name, 0, []v2.Host{newHostV2("127.0.0.1:8080", "blue", 0, nil)}); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	if registry, ok := ClusterRegistry(config.Name); !ok || registry != "blue" {
+		t.Fatalf("expect the cluster resolved to blue, got %q, %v", registry, ok)
+	}
+	if _, ok := ClusterRegistry("missing"); ok {
+		t.Error("expect the missing cluster not resolved")
+	}
+
+	// an update keeping the registry is not a switch
+	config.LbType = v2.LB_ROUNDROBIN
+	cm.AddOrUpdatePrimaryCluster(config)
+	config.Registry = "green"
+	cm.AddOrUpdatePrimaryCluster(config)
+	if !reflect.DeepEqual(switches, []string{"blue->green"}) {
+		t.Fatalf("expect the switch to green notified once, got %v", switches)
+	}
+	if registry, _ := ClusterRegistry(config.Name); registry != "green" {
+		t.Errorf("expect the cluster resolved to green, got %q", registry)
+	}
+
+	// the hosts of blue serve until green updates them
+	v, _ := cm.primaryClusters.Load(config.Name)
+	hosts := v.(*primaryCluster).cluster.PrioritySet().HostSetsByPriority()[0].Hosts()
+	if len(hosts) != 1 || hosts[0].AddressString() != "127.0.0.1:8080" {
+		t.Errorf("expect the hosts of the old registry kept, got %v", hosts)
+	}
+}
@@ -19,6 +19,7 @@ package cluster
 
 import (
 	"net"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
@@ -32,6 +33,7 @@ type dynamicClusterBase struct {
 func (dc *dynamicClusterBase) updateDynamicHostList(newHosts []types.Host, currentHosts []types.Host) (
 	changed bool, finalHosts []types.Host, hostsAdded []types.Host, hostsRemoved []types.Host) {
 	hostAddrs := make(map[string]bool)
+	now := time.Now()
 
 	// N^2 loop, works for small and steady hosts
 	for _, nh := range newHosts {
@@ -47,7 +49,7 @@ func (dc *dynamicClusterBase) updateDynamicHostList(newHosts []types.Host, curre
 			curNh := currentHosts[i]
 
 			if nh.AddressString() == curNh.AddressString() {
-				curNh.SetWeight(nh.Weight())
+				curNh.SetWeight(dc.hostWeight(nh))
 				finalHosts = append(finalHosts, curNh)
 				currentHosts = append(currentHosts[:i], currentHosts[i+1:]...)
 				found = true
@@ -57,6 +59,8 @@ func (dc *dynamicClusterBase) updateDynamicHostList(newHosts []types.Host, curre
 		}
 
 		if !found {
+			// the weight of the new host ramps up from now if slow start enabled
+			nh.SetAddTime(now)
 			finalHosts = append(finalHosts, nh)
 			hostsAdded = append(hostsAdded, nh)
 		}
@@ -75,6 +79,16 @@ func (dc *dynamicClusterBase) updateDynamicHostList(newHosts []types.Host, curre
 	return changed, finalHosts, hostsAdded, hostsRemoved
 }
 
+// hostWeight returns the weight of the kept host, the live weight advertised by the host comes first
+func (dc *dynamicClusterBase) hostWeight(nh types.Host) uint32 {
+	if lw := dc.info.liveWeight; lw != nil {
+		if weight, ok := lw.weightOf(nh.AddressString()); ok {
+			return weight
+		}
+	}
+	return nh.Weight()
+}
+
 // SimpleCluster
 type simpleInMemCluster struct {
 	dynamicClusterBase
@@ -105,10 +119,10 @@ func (sc *simpleInMemCluster) UpdateHosts(newHosts []types.Host) {
 
 	if changed {
 		sc.hosts = finalHosts
-		// todo: need to consider how to update healthyHost
+		// the kept hosts ejected or drained stay out of the healthy hosts
 		// Note: currently, we only use priority 0
 		sc.prioritySet.GetOrCreateHostSet(0).UpdateHosts(sc.hosts,
-			sc.hosts, nil, nil, hostsAdded, hostsRemoved)
+			getHealthHost(sc.hosts), nil, nil, hostsAdded, hostsRemoved)
 
 		if sc.healthChecker != nil {
 			sc.healthChecker.OnClusterMemberUpdate(hostsAdded, hostsRemoved)
@@ -0,0 +1,202 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const defaultMaxConnectBackoff = 30 * time.Second
+
+// connectBackoff marks the host failing to connect CONNECT_BACKOFF and removes it from the healthy hosts
+// until the backoff elapses, the conn pools don't connect the host in backoff either. The backoff is doubled
+// on each failure in a row up to the max, and reset by a successful connect
+type connectBackoff struct {
+	cluster *cluster
+	base    time.Duration
+	max     time.Duration
+
+	mux   sync.Mutex
+	hosts map[string]*connectBackoffState
+}
+
+type connectBackoffState struct {
+	failures uint32
+	until    time.Time
+	timer    *time.Timer // nil if the host is not in backoff
+}
+
+// ConnectBackoffStatus is the connect backoff of a host in the host status
+type ConnectBackoffStatus struct {
+	Failures uint32 `json:"failures"` // connect failures in a row
+	Backoff  string `json:"backoff"`  // the whole delay of the last failure
+	Until    string `json:"until,omitempty"`
+}
+
+func newConnectBackoff(c *cluster, config v2.ConnectBackoffConfig) *connectBackoff {
+	if config.BaseInterval.Duration <= 0 {
+		return nil
+	}
+
+	b := &connectBackoff{
+		cluster: c,
+		base:    config.BaseInterval.Duration,
+		max:     config.MaxInterval.Duration,
+		hosts:   make(map[string]*connectBackoffState),
+	}
+	if b.max <= 0 {
+		b.max = defaultMaxConnectBackoff
+	}
+	if b.max < b.base {
+		b.max = b.base
+	}
+	c.prioritySet.AddMemberUpdateCb(b.onHostsUpdated)
+
+	return b
+}
+
+func (b *connectBackoff) onConnectResult(host types.Host, success bool) {
+	addr := host.AddressString()
+
+	b.mux.Lock()
+	state, ok := b.hosts[addr]
+	if success {
+		if !ok {
+			b.mux.Unlock()
+			return
+		}
+		delete(b.hosts, addr)
+		inBackoff := state.timer != nil
+		if inBackoff {
+			state.timer.Stop()
+		}
+		b.mux.Unlock()
+
+		// connected by the health checker or the conn pool created before the backoff
+		if inBackoff {
+			b.clear(host, "connected")
+		}
+		return
+	}
+
+	if !ok {
+		state = &connectBackoffState{}
+		b.hosts[addr] = state
+	}
+	if state.timer != nil {
+		// a connect started before the backoff
+		b.mux.Unlock()
+		return
+	}
+	state.failures++
+	backoff := b.backoff(state.failures)
+	state.until = time.Now().Add(backoff)
+	var timer *time.Timer
+	timer = time.AfterFunc(backoff, func() {
+		b.expire(host, timer)
+	})
+	state.timer = timer
+	failures := state.failures
+	b.mux.Unlock()
+
+	log.DefaultLogger.Warnf("host %s in cluster %s failed to connect %d times in a row, back off for %s",
+		addr, b.cluster.info.name, failures, backoff)
+
+	// the healthy hosts update notifies onHostsUpdated, so it is out of the lock
+	host.SetHealthFlag(types.CONNECT_BACKOFF)
+	b.cluster.refreshHealthHosts(host)
+}
+
+// expire lets the host connect again, the failures are kept so that the next failure backs off longer
+func (b *connectBackoff) expire(host types.Host, timer *time.Timer) {
+	b.mux.Lock()
+	state, ok := b.hosts[host.AddressString()]
+	// reset or removed by the discovery
+	if !ok || state.timer != timer {
+		b.mux.Unlock()
+		return
+	}
+	state.timer = nil
+	b.mux.Unlock()
+
+	b.clear(host, "backoff elapsed")
+}
+
+func (b *connectBackoff) clear(host types.Host, reason string) {
+	log.DefaultLogger.Infof("host %s in cluster %s is reintroduced, %s", host.AddressString(), b.cluster.info.name, reason)
+
+	host.ClearHealthFlag(types.CONNECT_BACKOFF)
+	if host.Health() {
+		b.cluster.refreshHealthHosts(host)
+	}
+}
+
+func (b *connectBackoff) backoff(failures uint32) time.Duration {
+	backoff := b.base
+	for i := uint32(1); i < failures && backoff < b.max; i++ {
+		backoff *= 2
+	}
+	if backoff > b.max {
+		backoff = b.max
+	}
+
+	return backoff
+}
+
+// status returns the backoff of the host, nil if the host never failed or is reset
+func (b *connectBackoff) status(addr string) *ConnectBackoffStatus {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	state, ok := b.hosts[addr]
+	if !ok {
+		return nil
+	}
+	s := &ConnectBackoffStatus{
+		Failures: state.failures,
+		Backoff:  b.backoff(state.failures).String(),
+	}
+	if state.timer != nil {
+		s.Until = state.until.Format(time.RFC3339Nano)
+	}
+	return s
+}
+
+// onHostsUpdated forgets the hosts removed by the discovery
+func (b *connectBackoff) onHostsUpdated(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	if len(hostsRemoved) == 0 {
+		return
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	for _, host := range hostsRemoved {
+		if state, ok := b.hosts[host.AddressString()]; ok {
+			if state.timer != nil {
+				state.timer.Stop()
+			}
+			delete(b.hosts, host.AddressString())
+		}
+	}
+}
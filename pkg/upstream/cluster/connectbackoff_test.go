@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestConnectBackoff(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "connect_backoff",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		ConnectBackoff: v2.ConnectBackoffConfig{
+			BaseInterval: v2.DurationConfig{Duration: 20 * time.Millisecond},
+			MaxInterval:  v2.DurationConfig{Duration: 50 * time.Millisecond},
+		},
+	}, nil, false)
+	addr := closedAddress(t)
+	hosts := []types.Host{
+		NewHost(newHostV2(addr, addr, 1, nil), c.info),
+		NewHost(newHostV2("127.0.0.1:10001", "h2", 1, nil), c.info),
+	}
+	c.UpdateHosts(hosts)
+	healthy := func() int {
+		return len(c.PrioritySet().HostSetsByPriority()[0].HealthyHosts())
+	}
+	b := c.info.connectBackoff
+
+	hosts[0].CreateConnection(nil).Connection.Connect(false)
+	if healthy() != 1 || !hosts[0].ContainHealthFlag(types.CONNECT_BACKOFF) {
+		t.Fatalf("expect the host out of the lb in backoff, got %d healthy hosts", healthy())
+	}
+	if s := b.status(addr); s == nil || s.Failures != 1 || s.Backoff != "20ms" || s.Until == "" {
+		t.Fatalf("unexpected backoff status %+v", s)
+	}
+	// a connect started before the backoff is not counted
+	b.onConnectResult(hosts[0], false)
+	if s := b.status(addr); s.Failures != 1 {
+		t.Errorf("expect the failure in backoff not counted, got %d", s.Failures)
+	}
+
+	// the backoff is doubled on the failures in a row up to the max
+	for _, expected := range []string{"40ms", "50ms", "50ms"} {
+		for i := 0; i < 20 && hosts[0].ContainHealthFlag(types.CONNECT_BACKOFF); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if healthy() != 2 {
+			t.Fatal("expect the host reintroduced after the backoff")
+		}
+		b.onConnectResult(hosts[0], false)
+		if s := b.status(addr); s.Backoff != expected {
+			t.Fatalf("expect backoff %s, got %s", expected, s.Backoff)
+		}
+	}
+
+	// a successful connect resets the backoff
+	b.onConnectResult(hosts[0], true)
+	if healthy() != 2 || b.status(addr) != nil {
+		t.Fatalf("expect the backoff reset, got %d healthy hosts", healthy())
+	}
+	b.onConnectResult(hosts[0], false)
+	if s := b.status(addr); s.Failures != 1 || s.Backoff != "20ms" {
+		t.Errorf("expect the backoff from the base, got %+v", s)
+	}
+
+	// the hosts removed by the discovery are forgotten
+	c.UpdateHosts(hosts[1:])
+	if b.status(addr) != nil {
+		t.Error("expect the removed host forgotten")
+	}
+}
+
+func TestConnectBackoffDisabled(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "no_connect_backoff",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+	}, nil, false)
+	if c.info.connectBackoff != nil {
+		t.Error("connect backoff should be disabled")
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const (
+	defaultHashLoadFactor   = 1.25
+	defaultHashVirtualNodes = 160
+)
+
+// HashFunction hashes a key onto the consistent hash ring.
+//
+// The ring is built by hashing "<host address>#<i>" for i in [0, VirtualNodes) of each healthy host, where
+// the host address is "ip:port". A request is placed by hashing the value of the HeaderKey header, and goes
+// to the first ring point whose hash is not less than the key hash, wrapping around to the first point.
+// A backend building its ring with the same hash function and virtual nodes agrees on the placement,
+// as long as no host is loaded over the bound.
+type HashFunction func(key string) uint64
+
+// Hash functions registered by default
+const (
+	DefaultHashFunction = "default" // fnv-1a 64 bits mixed by the murmur3 finalizer
+	FNV1a64HashFunction = "fnv1a64" // plain fnv-1a 64 bits
+)
+
+var hashFunctions = map[string]HashFunction{
+	DefaultHashFunction: hashKey,
+	FNV1a64HashFunction: fnv1a64,
+}
+
+// RegisterHashFunction registers a hash function named by ConsistentHashConfig.HashFunction, a registered name is
+// overridden. It should be called during initialization
+func RegisterHashFunction(name string, f HashFunction) {
+	hashFunctions[name] = f
+}
+
+// consistentHashLoadBalancer chooses the host by the hash of a request header on a ring of the healthy hosts.
+// Each host owns VirtualNodes points on the ring, so removing a host only remaps the keys of its points.
+// The load is bounded: a host whose active requests exceed LoadFactor times the average is skipped,
+// and the key goes to the next host on the ring.
+// Requests without the header are balanced by round robin
+type consistentHashLoadBalancer struct {
+	loadbalancer
+	headerKey    string
+	loadFactor   float64
+	virtualNodes int
+	hash         HashFunction
+	fallback     types.LoadBalancer
+
+	mutex sync.RWMutex
+	ring  []hashRingPoint
+	hosts []types.Host
+}
+
+type hashRingPoint struct {
+	hash uint64
+	host types.Host
+}
+
+func newConsistentHashLoadBalancer(prioritySet types.PrioritySet, config v2.ConsistentHashConfig) types.LoadBalancer {
+	lb := &consistentHashLoadBalancer{
+		loadbalancer: loadbalancer{
+			prioritySet: prioritySet,
+		},
+		headerKey:    config.HeaderKey,
+		loadFactor:   config.LoadFactor,
+		virtualNodes: config.VirtualNodes,
+		fallback:     NewLoadBalancer(types.RoundRobin, prioritySet),
+	}
+	if lb.loadFactor <= 1 {
+		lb.loadFactor = defaultHashLoadFactor
+	}
+	if lb.virtualNodes <= 0 {
+		lb.virtualNodes = defaultHashVirtualNodes
+	}
+	if config.HashFunction != "" {
+		lb.hash = hashFunctions[config.HashFunction]
+		if lb.hash == nil {
+			log.DefaultLogger.Errorf("unknown consistent hash function %s, use the default", config.HashFunction)
+		}
+	}
+	if lb.hash == nil {
+		lb.hash = hashKey
+	}
+
+	prioritySet.AddMemberUpdateCb(
+		func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+			lb.UpdateHost(priority, hostsAdded, hostsRemoved)
+		},
+	)
+	lb.buildRing()
+
+	return lb
+}
+
+// UpdateHost rebuilds the ring with the healthy hosts of the priority set
+func (l *consistentHashLoadBalancer) UpdateHost(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	l.buildRing()
+}
+
+func (l *consistentHashLoadBalancer) buildRing() {
+	var hosts []types.Host
+	for _, hostSet := range l.prioritySet.HostSetsByPriority() {
+		hosts = append(hosts, hostSet.HealthyHosts()...)
+	}
+
+	ring := make([]hashRingPoint, 0, len(hosts)*l.virtualNodes)
+	for _, host := range hosts {
+		for i := 0; i < l.virtualNodes; i++ {
+			ring = append(ring, hashRingPoint{
+				hash: l.hash(host.AddressString() + "#" + strconv.Itoa(i)),
+				host: host,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	l.mutex.Lock()
+	l.ring = ring
+	l.hosts = hosts
+	l.mutex.Unlock()
+}
+
+func (l *consistentHashLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	if context == nil || context.DownstreamHeaders() == nil || l.headerKey == "" {
+		return l.fallback.ChooseHost(context)
+	}
+	value, ok := context.DownstreamHeaders().Get(l.headerKey)
+	if !ok {
+		return l.fallback.ChooseHost(context)
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if len(l.ring) == 0 {
+		return nil
+	}
+
+	// the capacity of each host includes the request being balanced
+	var total int64
+	for _, host := range l.hosts {
+		total += host.HostStats().UpstreamRequestActive.Count()
+	}
+	capacity := int64(math.Ceil(l.loadFactor * float64(total+1) / float64(len(l.hosts))))
+
+	hash := l.hash(value)
+	start := sort.Search(len(l.ring), func(i int) bool {
+		return l.ring[i].hash >= hash
+	})
+	for i := 0; i < len(l.ring); i++ {
+		host := l.ring[(start+i)%len(l.ring)].host
+		if host.HostStats().UpstreamRequestActive.Count() < capacity {
+			return host
+		}
+	}
+
+	// unreachable in theory, at least one host is under the average
+	return l.ring[start%len(l.ring)].host
+}
+
+func fnv1a64(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func hashKey(key string) uint64 {
+	v := fnv1a64(key)
+
+	// fnv spreads short keys with a common prefix poorly, mix it with the murmur3 finalizer
+	v ^= v >> 33
+	v *= 0xff51afd7ed558ccd
+	v ^= v >> 33
+	v *= 0xc4ceb9fe1a85ec53
+	v ^= v >> 33
+	return v
+}
@@ -0,0 +1,177 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type headerContextMock struct {
+	ContextImplMock
+	headers types.HeaderMap
+}
+
+func (ci *headerContextMock) DownstreamHeaders() types.HeaderMap {
+	return ci.headers
+}
+
+func TestConsistentHashLoadBalancer(t *testing.T) {
+	var hosts []types.Host
+	for i := 1; i <= 4; i++ {
+		addr := "10.0.1." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), nil))
+	}
+	hs := &hostSet{hosts: hosts, healthyHosts: hosts}
+	ps := &prioritySet{hostSets: []types.HostSet{hs}}
+	lb := newConsistentHashLoadBalancer(ps, v2.ConsistentHashConfig{HeaderKey: "uid"})
+
+	choose := func(key string) types.Host {
+		return lb.ChooseHost(&headerContextMock{headers: protocol.CommonHeader{"uid": key}})
+	}
+
+	before := make(map[string]types.Host)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = choose(key)
+		if choose(key) != before[key] {
+			t.Fatalf("key %s is not sticky", key)
+		}
+	}
+
+	// remove a host by discovery, only its keys remap
+	removed := hosts[1]
+	remains := []types.Host{hosts[0], hosts[2], hosts[3]}
+	hs.UpdateHosts(remains, remains, nil, nil, nil, []types.Host{removed})
+	lb.(*consistentHashLoadBalancer).UpdateHost(0, nil, []types.Host{removed})
+
+	moved := 0
+	for key, host := range before {
+		got := choose(key)
+		if got == removed {
+			t.Fatalf("key %s is still on the removed host", key)
+		}
+		if host != removed && got != host {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Errorf("expect only keys of the removed host remapped, %d other keys moved", moved)
+	}
+
+	// no header, round robin
+	seen := make(map[types.Host]bool)
+	for i := 0; i < 3; i++ {
+		seen[lb.ChooseHost(&headerContextMock{headers: protocol.CommonHeader{}})] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expect round robin without header, got %d hosts", len(seen))
+	}
+	if lb.ChooseHost(nil) == nil {
+		t.Error("expect a host without context")
+	}
+}
+
+func TestConsistentHashLoadBalancerBoundedLoad(t *testing.T) {
+	var hosts []types.Host
+	for i := 1; i <= 2; i++ {
+		addr := "10.0.2." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), nil))
+	}
+	ps := &prioritySet{hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}}}
+	lb := newConsistentHashLoadBalancer(ps, v2.ConsistentHashConfig{HeaderKey: "uid"})
+	ctx := &headerContextMock{headers: protocol.CommonHeader{"uid": "hot"}}
+
+	hot := lb.ChooseHost(ctx)
+	// the hot host is loaded over the bound: ceil(1.25 * (4 + 1) / 2) = 4
+	hot.HostStats().UpstreamRequestActive.Inc(4)
+	defer hot.HostStats().UpstreamRequestActive.Dec(4)
+
+	if got := lb.ChooseHost(ctx); got == hot {
+		t.Errorf("expect the key moved off the overloaded host %s", hot.AddressString())
+	}
+}
+
+func TestConsistentHashLoadBalancerHashFunction(t *testing.T) {
+	calls := 0
+	RegisterHashFunction("test-counting", func(key string) uint64 {
+		calls++
+		return hashKey(key)
+	})
+
+	var hosts []types.Host
+	for i := 1; i <= 4; i++ {
+		addr := "10.0.3." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), nil))
+	}
+	hs := &hostSet{hosts: hosts[:3], healthyHosts: hosts[:3]}
+	ps := &prioritySet{hostSets: []types.HostSet{hs}}
+	lb := newConsistentHashLoadBalancer(ps, v2.ConsistentHashConfig{
+		HeaderKey:    "uid",
+		VirtualNodes: 16,
+		HashFunction: "test-counting",
+	})
+	if calls != 3*16 {
+		t.Fatalf("expect the ring built by the hash function, got %d calls", calls)
+	}
+
+	choose := func(key string) types.Host {
+		return lb.ChooseHost(&headerContextMock{headers: protocol.CommonHeader{"uid": key}})
+	}
+	before := make(map[string]types.Host)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = choose(key)
+	}
+
+	// add a host, keys only move to the new host
+	added := hosts[3]
+	hs.UpdateHosts(hosts, hosts, nil, nil, []types.Host{added}, nil)
+	lb.(*consistentHashLoadBalancer).UpdateHost(0, []types.Host{added}, nil)
+	movedToAdded := 0
+	for key, host := range before {
+		got := choose(key)
+		if got == added {
+			movedToAdded++
+		} else if got != host {
+			t.Fatalf("key %s moved from %s to %s", key, host.AddressString(), got.AddressString())
+		}
+	}
+	if movedToAdded == 0 {
+		t.Error("expect some keys moved to the added host")
+	}
+
+	// remove the added host, keys go back to the origin hosts
+	hs.UpdateHosts(hosts[:3], hosts[:3], nil, nil, nil, []types.Host{added})
+	lb.(*consistentHashLoadBalancer).UpdateHost(0, nil, []types.Host{added})
+	for key, host := range before {
+		if got := choose(key); got != host {
+			t.Fatalf("key %s is not back to %s, got %s", key, host.AddressString(), got.AddressString())
+		}
+	}
+
+	// unknown hash function uses the default
+	lb = newConsistentHashLoadBalancer(ps, v2.ConsistentHashConfig{HeaderKey: "uid", HashFunction: "unknown"})
+	if lb.(*consistentHashLoadBalancer).hash == nil {
+		t.Error("expect the default hash function")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+)
+
+// EmptyHostsCallback is called when the hosts discovered for the cluster become empty, e.g. getChildren
+// of the providers path returns no children as all the backends are gone, with empty true, and when hosts
+// are discovered again with empty false. It's never called before the first discovery of the cluster, so
+// a cluster not loaded yet is not reported as empty
+type EmptyHostsCallback func(clusterName string, empty bool)
+
+var (
+	emptyHostsMux       sync.RWMutex
+	emptyHostsCallbacks []EmptyHostsCallback
+)
+
+// AddEmptyHostsCallback registers the callback of the empty discovered hosts, e.g. to alert or to engage
+// a fallback. The callbacks are called in order, out of the lock of the cluster update.
+// It should be called during initialization
+func AddEmptyHostsCallback(cb EmptyHostsCallback) {
+	emptyHostsMux.Lock()
+	defer emptyHostsMux.Unlock()
+
+	emptyHostsCallbacks = append(emptyHostsCallbacks, cb)
+}
+
+// discoveredHostsState tracks whether the discovered hosts of a cluster are empty, guarded by the updateLock
+type discoveredHostsState struct {
+	loaded bool
+	empty  bool
+}
+
+// update records the hosts discovered, it returns true if the cluster becomes empty or non-empty
+func (s *discoveredHostsState) update(num int) bool {
+	empty := num == 0
+	changed := s.empty != empty || (!s.loaded && empty)
+	s.loaded, s.empty = true, empty
+	return changed
+}
+
+// notifyEmptyHosts updates the empty stats and calls the callbacks, it is called out of the updateLock
+func notifyEmptyHosts(clusterName string, empty bool) {
+	s := stats.NewClusterStats(clusterName)
+	if empty {
+		log.DefaultLogger.Errorf("no hosts discovered for cluster %s", clusterName)
+		s.Gauge(stats.UpstreamHostsEmpty).Update(1)
+		s.Counter(stats.UpstreamHostsEmptyTotal).Inc(1)
+	} else {
+		log.DefaultLogger.Infof("hosts discovered for the empty cluster %s", clusterName)
+		s.Gauge(stats.UpstreamHostsEmpty).Update(0)
+	}
+
+	emptyHostsMux.RLock()
+	cbs := emptyHostsCallbacks
+	emptyHostsMux.RUnlock()
+	for _, cb := range cbs {
+		cb(clusterName, empty)
+	}
+}
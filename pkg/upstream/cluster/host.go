@@ -21,6 +21,8 @@ import (
 	"context"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
@@ -97,8 +99,10 @@ type host struct {
 	hostInfo
 	weight uint32
 	used   bool
+	// unix nano of the time added by the discovery
+	addTime int64
 
-	healthFlags uint64
+	healthFlags uint64 // read by the admin api, accessed atomically
 }
 
 // NewHost used to create types.Host
@@ -120,6 +124,11 @@ func (h *host) CreateConnection(context context.Context) types.CreateConnectionD
 
 	clientConn := network.NewClientConnection(h.clusterInfo.SourceAddress(), tlsMng, h.address, nil, logger)
 	clientConn.SetBufferLimit(h.clusterInfo.ConnBufferLimitBytes())
+	clientConn.SetConnectTimeout(connectTimeout(context, h.clusterInfo.ConnectTimeout()))
+	if ci, ok := h.clusterInfo.(*clusterInfo); ok && (ci.reresolver != nil || ci.connectBackoff != nil) {
+		clientConn.AddConnectionEventListener(&connectResultListener{host: h, reresolver: ci.reresolver,
+			backoff: ci.connectBackoff})
+	}
 
 	return types.CreateConnectionData{
 		Connection: clientConn,
@@ -127,34 +136,76 @@ func (h *host) CreateConnection(context context.Context) types.CreateConnectionD
 	}
 }
 
+// connectTimeout bounds the connect timeout of the cluster by the deadline of the request that dials,
+// an expired deadline fails the dial at once
+func connectTimeout(context context.Context, timeout time.Duration) time.Duration {
+	if context == nil {
+		return timeout
+	}
+	deadline, ok := context.Deadline()
+	if !ok {
+		return timeout
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return time.Nanosecond
+	}
+	if timeout <= 0 || remaining < timeout {
+		return remaining
+	}
+	return timeout
+}
+
 // health:0, unhealth:1
 // set h.healthFlags = 0
 // ^1 = 0
 func (h *host) ClearHealthFlag(flag types.HealthFlag) {
-	h.healthFlags &= ^uint64(flag)
+	for {
+		flags := atomic.LoadUint64(&h.healthFlags)
+		if atomic.CompareAndSwapUint64(&h.healthFlags, flags, flags&^uint64(flag)) {
+			return
+		}
+	}
 }
 
 // return 1, if h.healthFlags = 1
 func (h *host) ContainHealthFlag(flag types.HealthFlag) bool {
-	return h.healthFlags&uint64(flag) > 0
+	return atomic.LoadUint64(&h.healthFlags)&uint64(flag) > 0
 }
 
 // set h.healthFlags = 1
 func (h *host) SetHealthFlag(flag types.HealthFlag) {
-	h.healthFlags |= uint64(flag)
+	for {
+		flags := atomic.LoadUint64(&h.healthFlags)
+		if atomic.CompareAndSwapUint64(&h.healthFlags, flags, flags|uint64(flag)) {
+			return
+		}
+	}
 }
 
 // return 1 when h.healthFlags == 0
 func (h *host) Health() bool {
-	return h.healthFlags == 0
+	return atomic.LoadUint64(&h.healthFlags) == 0
 }
 
+// Weight may be updated by the discovery while the load balancer is reading it
 func (h *host) Weight() uint32 {
-	return h.weight
+	return atomic.LoadUint32(&h.weight)
 }
 
 func (h *host) SetWeight(weight uint32) {
-	h.weight = weight
+	atomic.StoreUint32(&h.weight, weight)
+}
+
+func (h *host) AddTime() time.Time {
+	if t := atomic.LoadInt64(&h.addTime); t != 0 {
+		return time.Unix(0, t)
+	}
+	return time.Time{}
+}
+
+func (h *host) SetAddTime(t time.Time) {
+	atomic.StoreInt64(&h.addTime, t.UnixNano())
 }
 
 func (h *host) Used() bool {
@@ -21,6 +21,7 @@ import (
 	"context"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/mtls"
@@ -76,3 +77,29 @@ func TestHostDisableTLS(t *testing.T) {
 		conn.Close(types.NoFlush, types.LocalClose)
 	}
 }
+
+func TestConnectTimeoutByDeadline(t *testing.T) {
+	if timeout := connectTimeout(nil, time.Second); timeout != time.Second {
+		t.Errorf("expect the cluster connect timeout without context, got %v", timeout)
+	}
+	if timeout := connectTimeout(context.Background(), time.Second); timeout != time.Second {
+		t.Errorf("expect the cluster connect timeout without deadline, got %v", timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for _, clusterTimeout := range []time.Duration{0, time.Second} {
+		if timeout := connectTimeout(ctx, clusterTimeout); timeout <= 0 || timeout > 100*time.Millisecond {
+			t.Errorf("expect the connect timeout bounded by the deadline, got %v", timeout)
+		}
+	}
+	if timeout := connectTimeout(ctx, 10*time.Millisecond); timeout != 10*time.Millisecond {
+		t.Errorf("expect the shorter cluster connect timeout, got %v", timeout)
+	}
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if timeout := connectTimeout(expired, time.Second); timeout != time.Nanosecond {
+		t.Errorf("expect the dial failed at once after the deadline, got %v", timeout)
+	}
+}
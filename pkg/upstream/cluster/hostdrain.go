@@ -0,0 +1,137 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const defaultHostDrainCooldown = 30 * time.Second
+
+// hostDrainer marks the host signaling it's shutting down DRAINED_BY_RESPONSE and removes it from the healthy
+// hosts until the cooldown elapses, the drained host removed by the discovery is forgotten so that it is a
+// fresh host once added again
+type hostDrainer struct {
+	cluster  *cluster
+	statuses map[int]bool
+	header   string
+	cooldown time.Duration
+
+	mux     sync.Mutex
+	drained map[string]*time.Timer
+}
+
+func newHostDrainer(c *cluster, config v2.HostDrainConfig) *hostDrainer {
+	if len(config.Statuses) == 0 && config.Header == "" {
+		return nil
+	}
+
+	d := &hostDrainer{
+		cluster:  c,
+		statuses: make(map[int]bool, len(config.Statuses)),
+		header:   config.Header,
+		cooldown: config.Cooldown.Duration,
+		drained:  make(map[string]*time.Timer),
+	}
+	for _, status := range config.Statuses {
+		d.statuses[status] = true
+	}
+	if d.cooldown <= 0 {
+		d.cooldown = defaultHostDrainCooldown
+	}
+	c.prioritySet.AddMemberUpdateCb(d.onHostsUpdated)
+
+	return d
+}
+
+func (d *hostDrainer) OnResponse(host types.Host, code int, headers types.HeaderMap) {
+	if host == nil || !d.shouldDrain(code, headers) {
+		return
+	}
+
+	addr := host.AddressString()
+	d.mux.Lock()
+	if _, ok := d.drained[addr]; ok {
+		d.mux.Unlock()
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d.cooldown, func() {
+		d.undrain(host, timer)
+	})
+	d.drained[addr] = timer
+	d.mux.Unlock()
+
+	log.DefaultLogger.Infof("drain host %s in cluster %s for %s, the host is shutting down",
+		addr, d.cluster.info.name, d.cooldown)
+
+	// the healthy hosts update notifies onHostsUpdated, so it is out of the lock
+	host.SetHealthFlag(types.DRAINED_BY_RESPONSE)
+	d.cluster.refreshHealthHosts(host)
+}
+
+func (d *hostDrainer) shouldDrain(code int, headers types.HeaderMap) bool {
+	if d.statuses[code] {
+		return true
+	}
+	if d.header != "" && headers != nil {
+		_, ok := headers.Get(d.header)
+		return ok
+	}
+	return false
+}
+
+func (d *hostDrainer) undrain(host types.Host, timer *time.Timer) {
+	d.mux.Lock()
+	// removed by the discovery
+	if d.drained[host.AddressString()] != timer {
+		d.mux.Unlock()
+		return
+	}
+	delete(d.drained, host.AddressString())
+	d.mux.Unlock()
+
+	log.DefaultLogger.Infof("drained host %s in cluster %s is reintroduced", host.AddressString(), d.cluster.info.name)
+
+	host.ClearHealthFlag(types.DRAINED_BY_RESPONSE)
+	if host.Health() {
+		d.cluster.refreshHealthHosts(host)
+	}
+}
+
+// onHostsUpdated forgets the drained hosts removed by the discovery
+func (d *hostDrainer) onHostsUpdated(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	if len(hostsRemoved) == 0 {
+		return
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	for _, host := range hostsRemoved {
+		if timer, ok := d.drained[host.AddressString()]; ok {
+			timer.Stop()
+			delete(d.drained, host.AddressString())
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestHostDrainer(t *testing.T) {
+	cooldown := 50 * time.Millisecond
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "drain",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		HostDrain: v2.HostDrainConfig{
+			Statuses: []int{http.StatusServiceUnavailable},
+			Header:   "x-server-shutdown",
+			Cooldown: v2.DurationConfig{Duration: cooldown},
+		},
+	}, nil, false)
+	var hosts []types.Host
+	for i := 1; i <= 3; i++ {
+		addr := "10.0.4." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), c.info))
+	}
+	c.UpdateHosts(hosts)
+
+	drainer := c.Info().HostDrainer()
+	if drainer == nil {
+		t.Fatal("host drainer should be enabled")
+	}
+	healthy := func() int {
+		return len(c.PrioritySet().HostSetsByPriority()[0].HealthyHosts())
+	}
+
+	drainer.OnResponse(hosts[0], http.StatusOK, protocol.CommonHeader{})
+	drainer.OnResponse(hosts[0], http.StatusInternalServerError, protocol.CommonHeader{})
+	if healthy() != 3 {
+		t.Fatalf("expect no host drained, got %d healthy hosts", healthy())
+	}
+
+	drainer.OnResponse(hosts[0], http.StatusServiceUnavailable, protocol.CommonHeader{})
+	drainer.OnResponse(hosts[1], http.StatusOK, protocol.CommonHeader{"x-server-shutdown": "true"})
+	if healthy() != 1 || !hosts[0].ContainHealthFlag(types.DRAINED_BY_RESPONSE) ||
+		!hosts[1].ContainHealthFlag(types.DRAINED_BY_RESPONSE) {
+		t.Fatalf("expect 2 hosts drained, got %d healthy hosts", healthy())
+	}
+
+	// the drained host is kept out of the healthy hosts on the discovery update
+	c.UpdateHosts(hosts[:2])
+	if healthy() != 0 {
+		t.Fatalf("expect drained hosts not healthy, got %d healthy hosts", healthy())
+	}
+
+	// the drained host removed by the discovery is a fresh host once added again
+	c.UpdateHosts(hosts[:1])
+	added := NewHost(newHostV2(hosts[1].AddressString(), hosts[1].Hostname(), 1, nil), c.info)
+	c.UpdateHosts([]types.Host{hosts[0], added})
+	if healthy() != 1 || added.ContainHealthFlag(types.DRAINED_BY_RESPONSE) {
+		t.Fatalf("expect the added host healthy, got %d healthy hosts", healthy())
+	}
+
+	time.Sleep(cooldown + 30*time.Millisecond)
+	if healthy() != 2 || hosts[0].ContainHealthFlag(types.DRAINED_BY_RESPONSE) {
+		t.Fatalf("expect drained host reintroduced after the cooldown, got %d healthy hosts", healthy())
+	}
+}
+
+func TestHostDrainerDisabled(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "no_drain",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+	}, nil, false)
+	if c.Info().HostDrainer() != nil {
+		t.Error("host drainer should be disabled")
+	}
+}
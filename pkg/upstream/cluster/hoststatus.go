@@ -0,0 +1,133 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sort"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// names of the health flags in the host status
+var healthFlagNames = []struct {
+	flag types.HealthFlag
+	name string
+}{
+	{types.FAILED_ACTIVE_HC, "failed_active_health_check"},
+	{types.FAILED_OUTLIER_CHECK, "failed_outlier_check"},
+	{types.DRAINED_BY_RESPONSE, "drained_by_response"},
+	{types.DISABLED_BY_REGISTRY, "disabled_by_registry"},
+	{types.CONNECT_BACKOFF, "connect_backoff"},
+}
+
+// HostStatus is the state of an upstream host served by the admin api
+type HostStatus struct {
+	Address           string   `json:"address"`
+	Hostname          string   `json:"hostname,omitempty"`
+	Priority          uint32   `json:"priority"`
+	Weight            uint32   `json:"weight"`
+	Zone              string   `json:"zone,omitempty"`
+	Healthy           bool     `json:"healthy"`
+	HealthFlags       []string `json:"health_flags,omitempty"`
+	Ejected           bool     `json:"ejected"` // ejected by the outlier detector
+	ActiveConnections int64    `json:"active_connections"`
+
+	ConnectBackoff *ConnectBackoffStatus `json:"connect_backoff,omitempty"` // nil if the host connects well
+	Outlier        *OutlierStatus        `json:"outlier,omitempty"`         // nil if the host never failed
+}
+
+// ClusterHostsStatus is the host set of a cluster
+type ClusterHostsStatus struct {
+	Cluster string       `json:"cluster"`
+	Hosts   []HostStatus `json:"hosts"`
+}
+
+// hostsStatus returns the host sets of the cluster, all clusters sorted by name if the name is empty.
+// Returns false if the cluster is not found
+func (cm *clusterManager) hostsStatus(clusterName string) (interface{}, bool) {
+	if clusterName != "" {
+		v, ok := cm.primaryClusters.Load(clusterName)
+		if !ok {
+			return nil, false
+		}
+		return v.(*primaryCluster).hostsStatus(), true
+	}
+
+	var clusters []ClusterHostsStatus
+	cm.primaryClusters.Range(func(k, v interface{}) bool {
+		clusters = append(clusters, v.(*primaryCluster).hostsStatus())
+		return true
+	})
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Cluster < clusters[j].Cluster
+	})
+	return clusters, true
+}
+
+// hostsStatus reads the host sets under the update lock, so the snapshot is never in the middle of a
+// discovery update
+func (pc *primaryCluster) hostsStatus() ClusterHostsStatus {
+	pc.updateLock.Lock()
+	defer pc.updateLock.Unlock()
+
+	info := pc.cluster.Info()
+	var zoneKey string
+	var backoff *connectBackoff
+	var detector *outlierDetector
+	if ci, ok := info.(*clusterInfo); ok {
+		zoneKey = ci.zoneKey
+		backoff = ci.connectBackoff
+		detector = ci.outlierDetector
+	}
+
+	status := ClusterHostsStatus{
+		Cluster: info.Name(),
+		Hosts:   []HostStatus{},
+	}
+	for _, hostSet := range pc.cluster.PrioritySet().HostSetsByPriority() {
+		for _, host := range hostSet.Hosts() {
+			hs := HostStatus{
+				Address:  host.AddressString(),
+				Hostname: host.Hostname(),
+				Priority: hostSet.Priority(),
+				Weight:   host.Weight(),
+				Healthy:  host.Health(),
+				Ejected:  host.ContainHealthFlag(types.FAILED_OUTLIER_CHECK),
+			}
+			if zoneKey != "" {
+				hs.Zone = host.OriginMetaData()[zoneKey]
+			}
+			for _, f := range healthFlagNames {
+				if host.ContainHealthFlag(f.flag) {
+					hs.HealthFlags = append(hs.HealthFlags, f.name)
+				}
+			}
+			if backoff != nil {
+				hs.ConnectBackoff = backoff.status(host.AddressString())
+			}
+			if detector != nil {
+				hs.Outlier = detector.status(host.AddressString())
+			}
+			if active := host.HostStats().UpstreamConnectionActive; active != nil {
+				hs.ActiveConnections = active.Count()
+			}
+			status.Hosts = append(status.Hosts, hs)
+		}
+	}
+	return status
+}
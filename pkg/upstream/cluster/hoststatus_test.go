@@ -0,0 +1,112 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestHostsStatus(t *testing.T) {
+	cm := &clusterManager{}
+	newPrimary := func(config v2.Cluster) *primaryCluster {
+		pc := NewPrimaryCluster(newSimpleInMemCluster(config, nil, true), &config, true)
+		cm.primaryClusters.Store(config.Name, pc)
+		return pc
+	}
+	zoned := newPrimary(v2.Cluster{
+		Name:        "status_zoned",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LocalityLB:  v2.LocalityLBConfig{ZoneKey: "zone"},
+	})
+	newPrimary(v2.Cluster{
+		Name:        "status_empty",
+		ClusterType: v2.SIMPLE_CLUSTER,
+	})
+
+	if _, err := zoned.updateHostConfigs([]v2.Host{
+		newHostV2("127.0.0.1:12200", "h1", 10, v2.Metadata{"zone": "gz"}),
+		newHostV2("127.0.0.2:12200", "h2", 20, v2.Metadata{"zone": "sh"}),
+	}); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	hosts := zoned.cluster.PrioritySet().HostSetsByPriority()[0].Hosts()
+	hosts[1].SetHealthFlag(types.FAILED_OUTLIER_CHECK)
+	hosts[1].HostStats().UpstreamConnectionActive.Inc(2)
+	defer hosts[1].HostStats().UpstreamConnectionActive.Dec(2)
+
+	if _, ok := cm.hostsStatus("missing"); ok {
+		t.Error("expect unknown cluster not found")
+	}
+	v, ok := cm.hostsStatus("status_zoned")
+	if !ok {
+		t.Fatal("expect the cluster found")
+	}
+	status := v.(ClusterHostsStatus)
+	if status.Cluster != "status_zoned" || len(status.Hosts) != 2 {
+		t.Fatalf("unexpected cluster status %+v", status)
+	}
+	if h := status.Hosts[0]; h.Address != "127.0.0.1:12200" || h.Hostname != "h1" || h.Weight != 10 ||
+		h.Zone != "gz" || !h.Healthy || h.Ejected || len(h.HealthFlags) != 0 {
+		t.Errorf("unexpected healthy host status %+v", h)
+	}
+	if h := status.Hosts[1]; h.Healthy || !h.Ejected || h.Zone != "sh" || h.ActiveConnections != 2 ||
+		len(h.HealthFlags) != 1 || h.HealthFlags[0] != "failed_outlier_check" {
+		t.Errorf("unexpected ejected host status %+v", h)
+	}
+
+	v, _ = cm.hostsStatus("")
+	all := v.([]ClusterHostsStatus)
+	if len(all) != 2 || all[0].Cluster != "status_empty" || all[1].Cluster != "status_zoned" || len(all[0].Hosts) != 0 {
+		t.Errorf("expect all the clusters sorted by name, got %+v", all)
+	}
+}
+
+func TestHostsStatusWithDiscoveryUpdates(t *testing.T) {
+	cm := &clusterManager{}
+	config := v2.Cluster{
+		Name:        "status_concurrent",
+		ClusterType: v2.SIMPLE_CLUSTER,
+	}
+	pc := NewPrimaryCluster(newSimpleInMemCluster(config, nil, true), &config, true)
+	cm.primaryClusters.Store(config.Name, pc)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			hosts := []v2.Host{newHostV2("127.0.0.1:12200", "h1", 1, nil)}
+			if i%2 == 0 {
+				hosts = append(hosts, newHostV2("127.0.0.2:12200", "h2", 1, nil))
+			}
+			pc.updateHostConfigs(hosts)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		v, _ := cm.hostsStatus(config.Name)
+		// a snapshot is taken between the updates
+		if n := len(v.(ClusterHostsStatus).Hosts); n != 0 && n != 1 && n != 2 {
+			t.Fatalf("unexpected hosts %d", n)
+		}
+	}
+	wg.Wait()
+}
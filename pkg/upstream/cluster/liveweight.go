@@ -0,0 +1,237 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const defaultLiveWeightField = "weight"
+
+// bounds of the live weight, the same as the configured host weight
+const (
+	minLiveWeight = uint32(1)
+	maxLiveWeight = uint32(128)
+)
+
+var (
+	hostDataWatcherMux sync.RWMutex
+	// hostDataWatcher watches the data of the host's registration node, nil if no discovery registered
+	hostDataWatcher func(clusterName string, host types.Host) (data <-chan []byte, stop func())
+)
+
+// SetHostDataWatcher sets the watch of the data of the host's registration node, e.g. WatchDataDurable of the
+// zk ephemeral node, the current data should be sent on every change and the channel closed on stop.
+// It should be called during initialization by the discovery
+func SetHostDataWatcher(f func(clusterName string, host types.Host) (data <-chan []byte, stop func())) {
+	hostDataWatcherMux.Lock()
+	defer hostDataWatcherMux.Unlock()
+
+	hostDataWatcher = f
+}
+
+// liveWeightWatcher watches the registration node data of each host and sets the host weight in place, the
+// weighted load balancers pick up the change without the host removed and added again. The host disabled in
+// the data is marked DISABLED_BY_REGISTRY and removed from the healthy hosts until enabled again
+type liveWeightWatcher struct {
+	cluster *cluster
+	field   string
+
+	mux     sync.Mutex
+	watches map[string]func() // stop of the watch by host address
+	weights map[string]uint32 // the latest live weight by host address
+}
+
+func newLiveWeightWatcher(c *cluster, config v2.LiveWeightConfig) *liveWeightWatcher {
+	if !config.Enabled {
+		return nil
+	}
+
+	w := &liveWeightWatcher{
+		cluster: c,
+		field:   config.Field,
+		watches: make(map[string]func()),
+		weights: make(map[string]uint32),
+	}
+	if w.field == "" {
+		w.field = defaultLiveWeightField
+	}
+	c.prioritySet.AddMemberUpdateCb(w.onHostsUpdated)
+
+	return w
+}
+
+// onHostsUpdated watches the hosts added by the discovery and stops the watches of the removed ones
+func (w *liveWeightWatcher) onHostsUpdated(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	for _, host := range hostsRemoved {
+		if stop, ok := w.watches[host.AddressString()]; ok {
+			delete(w.watches, host.AddressString())
+			delete(w.weights, host.AddressString())
+			stop()
+		}
+	}
+
+	hostDataWatcherMux.RLock()
+	f := hostDataWatcher
+	hostDataWatcherMux.RUnlock()
+	if f == nil {
+		if len(hostsAdded) > 0 {
+			log.DefaultLogger.Warnf("live weight of cluster %s is enabled, no discovery to watch the hosts",
+				w.cluster.info.name)
+		}
+		return
+	}
+	for _, host := range hostsAdded {
+		addr := host.AddressString()
+		if _, ok := w.watches[addr]; ok {
+			continue
+		}
+		data, stop := f(w.cluster.info.name, host)
+		w.watches[addr] = stop
+		go w.watch(host, data)
+	}
+}
+
+func (w *liveWeightWatcher) watch(host types.Host, data <-chan []byte) {
+	for d := range data {
+		// the host keeps the last weight and flag without them in the data,
+		// e.g. the node is gone before the host is removed
+		if weight, ok := w.parseWeight(d); ok {
+			w.setWeight(host, weight)
+		}
+		if enabled, ok := w.parseEnabled(d); ok {
+			w.setEnabled(host, enabled)
+		}
+	}
+}
+
+func (w *liveWeightWatcher) setWeight(host types.Host, weight uint32) {
+	addr := host.AddressString()
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	// a stale update of the removed host
+	if _, ok := w.watches[addr]; !ok {
+		return
+	}
+	w.weights[addr] = weight
+	if weight != host.Weight() {
+		log.DefaultLogger.Infof("update the weight of host %s in cluster %s from %d to %d",
+			addr, w.cluster.info.name, host.Weight(), weight)
+		host.SetWeight(weight)
+	}
+}
+
+func (w *liveWeightWatcher) setEnabled(host types.Host, enabled bool) {
+	addr := host.AddressString()
+
+	w.mux.Lock()
+	_, watched := w.watches[addr]
+	w.mux.Unlock()
+	// a stale update of the removed host
+	if !watched || enabled != host.ContainHealthFlag(types.DISABLED_BY_REGISTRY) {
+		return
+	}
+
+	// the healthy hosts update notifies onHostsUpdated, so it is out of the lock
+	if enabled {
+		log.DefaultLogger.Infof("host %s in cluster %s is enabled in the registry", addr, w.cluster.info.name)
+		host.ClearHealthFlag(types.DISABLED_BY_REGISTRY)
+		if host.Health() {
+			w.cluster.refreshHealthHosts(host)
+		}
+		return
+	}
+	log.DefaultLogger.Infof("host %s in cluster %s is disabled in the registry", addr, w.cluster.info.name)
+	host.SetHealthFlag(types.DISABLED_BY_REGISTRY)
+	w.cluster.refreshHealthHosts(host)
+}
+
+// weightOf returns the live weight of the host, it takes precedence over the weight from the discovery
+func (w *liveWeightWatcher) weightOf(addr string) (uint32, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	weight, ok := w.weights[addr]
+	return weight, ok
+}
+
+// parseWeight returns the weight in the node data, false if the data has no valid weight
+func (w *liveWeightWatcher) parseWeight(data []byte) (uint32, bool) {
+	if len(data) == 0 {
+		return 0, false
+	}
+	params, err := url.ParseQuery(string(data))
+	if err != nil {
+		log.DefaultLogger.Warnf("cluster %s: invalid host node data %q: %v", w.cluster.info.name, data, err)
+		return 0, false
+	}
+	value := params.Get(w.field)
+	if value == "" {
+		return 0, false
+	}
+	weight, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		log.DefaultLogger.Warnf("cluster %s: invalid host weight %s=%q", w.cluster.info.name, w.field, value)
+		return 0, false
+	}
+
+	switch {
+	case uint32(weight) < minLiveWeight:
+		return minLiveWeight, true
+	case weight > uint64(maxLiveWeight):
+		return maxLiveWeight, true
+	}
+	return uint32(weight), true
+}
+
+// parseEnabled returns the dubbo enabled flag in the node data, the same as the provider url a static provider,
+// i.e. dynamic=false, is disabled unless enabled explicitly. It returns false if the data has no valid flag
+func (w *liveWeightWatcher) parseEnabled(data []byte) (bool, bool) {
+	if len(data) == 0 {
+		return false, false
+	}
+	params, err := url.ParseQuery(string(data))
+	if err != nil {
+		// warned by parseWeight
+		return false, false
+	}
+	for _, key := range []string{"enabled", "dynamic"} {
+		value := params.Get(key)
+		if value == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.DefaultLogger.Warnf("cluster %s: invalid host flag %s=%q", w.cluster.info.name, key, value)
+			return false, false
+		}
+		return enabled, true
+	}
+	return false, false
+}
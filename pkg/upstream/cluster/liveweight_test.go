@@ -0,0 +1,198 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// fakeDataWatcher keeps the data channel of each watched host
+type fakeDataWatcher struct {
+	mux     sync.Mutex
+	watches map[string]chan []byte
+}
+
+func (f *fakeDataWatcher) watch(clusterName string, host types.Host) (<-chan []byte, func()) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	ch := make(chan []byte, 1)
+	f.watches[host.AddressString()] = ch
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mux.Lock()
+			defer f.mux.Unlock()
+			delete(f.watches, host.AddressString())
+			close(ch)
+		})
+	}
+}
+
+func (f *fakeDataWatcher) send(addr string, data string) bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	ch, ok := f.watches[addr]
+	if ok {
+		ch <- []byte(data)
+	}
+	return ok
+}
+
+func waitWeight(t *testing.T, host types.Host, weight uint32) {
+	for i := 0; i < 100 && host.Weight() != weight; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if host.Weight() != weight {
+		t.Fatalf("expect weight %d of host %s, got %d", weight, host.AddressString(), host.Weight())
+	}
+}
+
+func TestLiveWeight(t *testing.T) {
+	watcher := &fakeDataWatcher{watches: make(map[string]chan []byte)}
+	SetHostDataWatcher(watcher.watch)
+	defer SetHostDataWatcher(nil)
+
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "live_weight",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_WRR,
+		LiveWeight:  v2.LiveWeightConfig{Enabled: true},
+	}, nil, false)
+	hosts := []types.Host{
+		NewHost(newHostV2("127.0.0.1:10001", "h1", 10, nil), c.info),
+		NewHost(newHostV2("127.0.0.1:10002", "h2", 10, nil), c.info),
+	}
+	c.UpdateHosts(hosts)
+
+	watcher.send("127.0.0.1:10001", "weight=50&warmup=0")
+	waitWeight(t, hosts[0], 50)
+	// out of bounds weights are clamped
+	watcher.send("127.0.0.1:10002", "weight=1000")
+	waitWeight(t, hosts[1], 128)
+	watcher.send("127.0.0.1:10002", "weight=0")
+	waitWeight(t, hosts[1], 1)
+
+	// the invalid data and the gone node keep the last weight
+	watcher.send("127.0.0.1:10001", "weight=abc")
+	watcher.send("127.0.0.1:10001", "")
+	watcher.send("127.0.0.1:10001", "weight=60")
+	waitWeight(t, hosts[0], 60)
+
+	// the live weight is not reset by the discovery update of the kept host
+	c.UpdateHosts([]types.Host{
+		NewHost(newHostV2("127.0.0.1:10001", "h1", 10, nil), c.info),
+		NewHost(newHostV2("127.0.0.1:10003", "h3", 10, nil), c.info),
+	})
+	if hosts[0].Weight() != 60 {
+		t.Errorf("expect the live weight kept, got %d", hosts[0].Weight())
+	}
+	// the watch of the removed host stops
+	if watcher.send("127.0.0.1:10002", "weight=20") {
+		t.Error("expect the watch of the removed host stopped")
+	}
+	if !watcher.send("127.0.0.1:10003", "weight=20") {
+		t.Error("expect the added host watched")
+	}
+}
+
+func waitHealth(t *testing.T, c *simpleInMemCluster, host types.Host, healthy bool) {
+	contains := func() bool {
+		for _, h := range c.prioritySet.hostSets[0].HealthyHosts() {
+			if h == host {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < 100 && contains() != healthy; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if contains() != healthy {
+		t.Fatalf("expect host %s healthy %v", host.AddressString(), healthy)
+	}
+}
+
+func TestLiveWeightEnabled(t *testing.T) {
+	watcher := &fakeDataWatcher{watches: make(map[string]chan []byte)}
+	SetHostDataWatcher(watcher.watch)
+	defer SetHostDataWatcher(nil)
+
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "live_enabled",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_WRR,
+		LiveWeight:  v2.LiveWeightConfig{Enabled: true},
+	}, nil, false)
+	hosts := []types.Host{
+		NewHost(newHostV2("127.0.0.1:10001", "h1", 10, nil), c.info),
+		NewHost(newHostV2("127.0.0.1:10002", "h2", 10, nil), c.info),
+	}
+	c.UpdateHosts(hosts)
+
+	watcher.send("127.0.0.1:10001", "weight=20&enabled=false")
+	waitHealth(t, c, hosts[0], false)
+	waitWeight(t, hosts[0], 20)
+	if !hosts[0].ContainHealthFlag(types.DISABLED_BY_REGISTRY) {
+		t.Error("expect the host marked disabled by the registry")
+	}
+	// the data without the flag keeps the host disabled
+	watcher.send("127.0.0.1:10001", "weight=30")
+	waitWeight(t, hosts[0], 30)
+	if !hosts[0].ContainHealthFlag(types.DISABLED_BY_REGISTRY) {
+		t.Error("expect the host kept disabled")
+	}
+	watcher.send("127.0.0.1:10001", "enabled=true")
+	waitHealth(t, c, hosts[0], true)
+
+	// a static provider is disabled unless enabled explicitly
+	watcher.send("127.0.0.1:10002", "dynamic=false")
+	waitHealth(t, c, hosts[1], false)
+	watcher.send("127.0.0.1:10002", "dynamic=false&enabled=true")
+	waitHealth(t, c, hosts[1], true)
+}
+
+func TestLiveWeightField(t *testing.T) {
+	w := &liveWeightWatcher{cluster: &cluster{info: &clusterInfo{name: "field"}}, field: "capacity"}
+	if weight, ok := w.parseWeight([]byte("weight=10&capacity=30")); !ok || weight != 30 {
+		t.Errorf("expect the weight parsed from the configured field, got %d, %v", weight, ok)
+	}
+	if _, ok := w.parseWeight([]byte("weight=10")); ok {
+		t.Error("expect no weight without the field")
+	}
+	if _, ok := w.parseWeight([]byte("capacity=%zz")); ok {
+		t.Error("expect no weight from the malformed data")
+	}
+}
+
+func TestLiveWeightDisabled(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "no_live_weight",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+	}, nil, false)
+	if c.info.liveWeight != nil {
+		t.Error("live weight should be disabled")
+	}
+}
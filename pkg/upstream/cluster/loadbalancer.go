@@ -23,17 +23,49 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/alipay/sofa-mosn/pkg/log"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
+// HostSelectorCreator creates the HostSelector of a cluster, the priority set contains the hosts
+// of the cluster, or of a subset, for the selector keeping states of the hosts
+type HostSelectorCreator func(prioritySet types.PrioritySet) types.HostSelector
+
+var hostSelectors = map[types.LoadBalancerType]HostSelectorCreator{}
+
+// RegisterHostSelector registers a custom HostSelector named by Cluster.HostSelector, a registered name is
+// overridden, and the names of the builtin lb types are not allowed. It should be called during initialization
+func RegisterHostSelector(name string, creator HostSelectorCreator) {
+	switch lbType := types.LoadBalancerType(name); lbType {
+	case types.RoundRobin, types.Random, types.WeightedRoundRobin, types.ConsistentHash, types.WeightedRandom:
+		log.DefaultLogger.Errorf("host selector %s conflicts with the builtin lb type, ignored", name)
+	default:
+		hostSelectors[lbType] = creator
+	}
+}
+
+func isHostSelectorRegistered(name string) bool {
+	_, ok := hostSelectors[types.LoadBalancerType(name)]
+	return ok
+}
+
 // NewLoadBalancer
 // Note: Random is the default lb
 // Round Robin is realized as Weighted Round Robin
+// Weighted Random is an option for the large host sets, stateless between the choices
+// The name of a registered host selector is also a lb type
 func NewLoadBalancer(lbType types.LoadBalancerType, prioritySet types.PrioritySet) types.LoadBalancer {
 	switch lbType {
-	case types.RoundRobin:
+	case types.RoundRobin, types.WeightedRoundRobin:
 		return newSmoothWeightedRRLoadBalancer(prioritySet)
+	case types.Random:
+		return newRandomLoadbalancer(prioritySet)
+	case types.WeightedRandom:
+		return newWeightedRandomLoadBalancer(prioritySet)
 	default:
+		if creator, ok := hostSelectors[lbType]; ok {
+			return newHostSelectorLoadBalancer(prioritySet, creator(prioritySet))
+		}
 		return newRandomLoadbalancer(prioritySet)
 	}
 }
@@ -42,6 +74,48 @@ type loadbalancer struct {
 	prioritySet types.PrioritySet
 }
 
+// healthyHosts returns the healthy hosts of all priorities
+func (l *loadbalancer) healthyHosts() []types.Host {
+	hostSets := l.prioritySet.HostSetsByPriority()
+	if len(hostSets) == 1 {
+		return hostSets[0].HealthyHosts()
+	}
+
+	var hosts []types.Host
+	for _, hostSet := range hostSets {
+		hosts = append(hosts, hostSet.HealthyHosts()...)
+	}
+	return hosts
+}
+
+// chooseHost chooses a host of the healthy hosts by the selector
+func (l *loadbalancer) chooseHost(selector types.HostSelector, context types.LoadBalancerContext) types.Host {
+	hosts := l.healthyHosts()
+	if len(hosts) == 0 {
+		return nil
+	}
+	return selector.SelectHost(context, hosts)
+}
+
+// hostSelectorLoadBalancer chooses the host by a custom HostSelector
+type hostSelectorLoadBalancer struct {
+	loadbalancer
+	selector types.HostSelector
+}
+
+func newHostSelectorLoadBalancer(prioritySet types.PrioritySet, selector types.HostSelector) types.LoadBalancer {
+	return &hostSelectorLoadBalancer{
+		loadbalancer: loadbalancer{
+			prioritySet: prioritySet,
+		},
+		selector: selector,
+	}
+}
+
+func (l *hostSelectorLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	return l.chooseHost(l.selector, context)
+}
+
 type randomLoadBalancer struct {
 	loadbalancer
 	randInstance *rand.Rand
@@ -57,6 +131,7 @@ func newRandomLoadbalancer(prioritySet types.PrioritySet) types.LoadBalancer {
 	}
 }
 
+// ChooseHost chooses a priority at random, then a healthy host of the priority
 func (l *randomLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
 	hostSets := l.prioritySet.HostSetsByPriority()
 	if len(hostSets) == 0 {
@@ -64,17 +139,20 @@ func (l *randomLoadBalancer) ChooseHost(context types.LoadBalancerContext) types
 	}
 
 	l.randMutex.Lock()
-	defer l.randMutex.Unlock()
 	idx := l.randInstance.Intn(len(hostSets))
-	hostset := hostSets[idx]
-	hosts := hostset.HealthyHosts()
-	//logger := log.ByContext(context)
+	l.randMutex.Unlock()
+	hosts := hostSets[idx].HealthyHosts()
 
 	if len(hosts) == 0 {
-		//	logger.Debugf("Choose host failed, no health host found")
 		return nil
 	}
 
+	return l.SelectHost(context, hosts)
+}
+
+func (l *randomLoadBalancer) SelectHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	l.randMutex.Lock()
+	defer l.randMutex.Unlock()
 	hostIdx := l.randInstance.Intn(len(hosts))
 
 	return hosts[hostIdx]
@@ -98,6 +176,7 @@ func newRoundRobinLoadBalancer(prioritySet types.PrioritySet) types.LoadBalancer
 	}
 }
 
+// ChooseHost walks the healthy hosts of a priority in turn, then moves to the next priority
 func (l *roundRobinLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
 	var selectedHostSet []types.Host
 
@@ -117,15 +196,15 @@ func (l *roundRobinLoadBalancer) ChooseHost(context types.LoadBalancerContext) t
 	}
 
 	if len(selectedHostSet) == 0 {
-		//logger := log.ByContext(context)
-		//logger.Debugf("Choose host in RoundRobin failed, no health host found")
 		return nil
 	}
 
-	selectedHost := selectedHostSet[l.rrIndex%uint32(len(selectedHostSet))]
-	atomic.AddUint32(&l.rrIndex, 1)
+	return l.SelectHost(context, selectedHostSet)
+}
 
-	return selectedHost
+func (l *roundRobinLoadBalancer) SelectHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	idx := atomic.AddUint32(&l.rrIndex, 1) - 1
+	return hosts[idx%uint32(len(hosts))]
 }
 
 /*
@@ -165,6 +244,7 @@ current_weight's:
 
 type smoothWeightedRRLoadBalancer struct {
 	loadbalancer
+	mutex         sync.Mutex
 	hostsWeighted map[string]*hostSmoothWeighted
 }
 
@@ -191,12 +271,14 @@ func newSmoothWeightedRRLoadBalancer(prioritySet types.PrioritySet) types.LoadBa
 	hostSets := prioritySet.HostSetsByPriority()
 
 	// iterate over all hosts to init host with Weighted
+	now := time.Now()
 	for _, hostSet := range hostSets {
 		for _, host := range hostSet.HealthyHosts() {
+			weight := slowStartWeight(host, now)
 			smoothWRRLoadBalancer.hostsWeighted[host.AddressString()] = &hostSmoothWeighted{
 
-				weight:          int(host.Weight()),
-				effectiveWeight: int(host.Weight()),
+				weight:          weight,
+				effectiveWeight: weight,
 			}
 		}
 	}
@@ -205,13 +287,18 @@ func newSmoothWeightedRRLoadBalancer(prioritySet types.PrioritySet) types.LoadBa
 }
 
 func (l *smoothWeightedRRLoadBalancer) UpdateHost(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
 	// add host to hostWeighted
+	now := time.Now()
 	for _, hostAdded := range hostsAdded {
 		if _, ok := l.hostsWeighted[hostAdded.AddressString()]; !ok {
 			// insert new health-host
+			weight := slowStartWeight(hostAdded, now)
 			l.hostsWeighted[hostAdded.AddressString()] = &hostSmoothWeighted{
-				weight:          int(hostAdded.Weight()),
-				effectiveWeight: int(hostAdded.Weight()),
+				weight:          weight,
+				effectiveWeight: weight,
 			}
 		}
 	}
@@ -223,38 +310,50 @@ func (l *smoothWeightedRRLoadBalancer) UpdateHost(priority uint32, hostsAdded []
 	}
 }
 
+func (l *smoothWeightedRRLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	return l.chooseHost(l, context)
+}
+
 // smooth weighted round robin
 // O(n), traverse over all hosts
 // Insert new health host if not existed
-func (l *smoothWeightedRRLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+// The weight updated in place by the discovery takes effect on the next choice, without rebuilding the state,
+// so does the weight ramped up in the slow start window
+func (l *smoothWeightedRRLoadBalancer) SelectHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
 	totalWeight := 0
 	var selectedHostWeighted *hostSmoothWeighted
 	var selectedHost types.Host
 
-	hostSets := l.prioritySet.HostSetsByPriority()
-	for _, hosts := range hostSets {
-		for _, host := range hosts.HealthyHosts() {
-
-			if _, ok := l.hostsWeighted[host.AddressString()]; !ok {
-				// insert new health-host in case UpdateHost not timely
-				l.hostsWeighted[host.AddressString()] = &hostSmoothWeighted{
-					weight:          int(host.Weight()),
-					effectiveWeight: int(host.Weight()),
-				}
-			}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 
-			hostW, _ := l.hostsWeighted[host.AddressString()]
-			hostW.currentWeight += hostW.effectiveWeight
-			totalWeight += hostW.effectiveWeight
+	now := time.Now()
+	for _, host := range hosts {
+		weight := slowStartWeight(host, now)
 
-			if hostW.effectiveWeight < hostW.weight {
-				hostW.effectiveWeight++
+		if _, ok := l.hostsWeighted[host.AddressString()]; !ok {
+			// insert new health-host in case UpdateHost not timely
+			l.hostsWeighted[host.AddressString()] = &hostSmoothWeighted{
+				weight:          weight,
+				effectiveWeight: weight,
 			}
+		}
 
-			if selectedHostWeighted == nil || hostW.currentWeight > selectedHostWeighted.currentWeight {
-				selectedHostWeighted = hostW
-				selectedHost = host
-			}
+		hostW, _ := l.hostsWeighted[host.AddressString()]
+		if weight != hostW.weight {
+			hostW.weight = weight
+			hostW.effectiveWeight = weight
+		}
+		hostW.currentWeight += hostW.effectiveWeight
+		totalWeight += hostW.effectiveWeight
+
+		if hostW.effectiveWeight < hostW.weight {
+			hostW.effectiveWeight++
+		}
+
+		if selectedHostWeighted == nil || hostW.currentWeight > selectedHostWeighted.currentWeight {
+			selectedHostWeighted = hostW
+			selectedHost = host
 		}
 	}
 
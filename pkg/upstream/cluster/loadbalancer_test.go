@@ -129,6 +129,50 @@ func Test_roundRobinLoadBalancer_ChooseHost(t *testing.T) {
 	}
 }
 
+// the round robin walks the priorities in turn, a priority without healthy hosts chooses nothing
+func Test_roundRobinLoadBalancer_EmptyPriority(t *testing.T) {
+	host1 := NewHost(newHostV2("127.0.0.1", "test", 0, nil), nil)
+	host2 := NewHost(newHostV2("127.0.0.2", "test2", 0, nil), nil)
+	host3 := NewHost(newHostV2("127.0.0.3", "test", 0, nil), nil)
+
+	prioritySet := &prioritySet{
+		hostSets: []types.HostSet{
+			&hostSet{hosts: []types.Host{host1, host2}, healthyHosts: []types.Host{host1, host2}},
+			&hostSet{},
+			&hostSet{hosts: []types.Host{host3}, healthyHosts: []types.Host{host3}},
+		},
+	}
+	l := newRoundRobinLoadBalancer(prioritySet)
+
+	want := []types.Host{host1, host2, nil, host3, host1, host2, nil, host3}
+	for i := 0; i < len(want); i++ {
+		if got := l.ChooseHost(nil); got != want[i] {
+			t.Errorf("case %d: got %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+// the random load balancer chooses a priority first, a priority without healthy hosts chooses nothing
+func Test_randomLoadBalancer_ChooseHost(t *testing.T) {
+	host1 := NewHost(newHostV2("127.0.0.1", "test", 0, nil), nil)
+
+	prioritySet := &prioritySet{
+		hostSets: []types.HostSet{
+			&hostSet{hosts: []types.Host{host1}, healthyHosts: []types.Host{host1}},
+			&hostSet{},
+		},
+	}
+	l := newRandomLoadbalancer(prioritySet)
+
+	chosen := map[types.Host]int{}
+	for i := 0; i < 200; i++ {
+		chosen[l.ChooseHost(nil)]++
+	}
+	if chosen[host1] == 0 || chosen[nil] == 0 || len(chosen) != 2 {
+		t.Errorf("expect both priorities chosen, got %v", chosen)
+	}
+}
+
 func TestSmoothWeightedRRLoadBalancer_ChooseHost(t *testing.T) {
 	type testCase struct {
 		lb types.LoadBalancer
@@ -236,6 +280,56 @@ func TestSmoothWeightedRRLoadBalancer_ChooseHost(t *testing.T) {
 	}
 }
 
+func TestWeightedRoundRobinLoadBalancer(t *testing.T) {
+	host1 := NewHost(newHostV2("127.0.0.1", "a", 3, nil), nil)
+	host2 := NewHost(newHostV2("127.0.0.2", "b", 2, nil), nil)
+	host3 := NewHost(newHostV2("127.0.0.3", "c", 1, nil), nil)
+	hosts := []types.Host{host1, host2, host3}
+	ps := &prioritySet{
+		hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}},
+	}
+	lb := NewLoadBalancer(types.WeightedRoundRobin, ps)
+
+	distribute := func(picks int) map[string]float64 {
+		res := make(map[string]float64)
+		for i := 0; i < picks; i++ {
+			host := lb.ChooseHost(nil)
+			if host == nil {
+				t.Fatal("no host chosen")
+			}
+			res[host.Hostname()] += 1.0 / float64(picks)
+		}
+		return res
+	}
+	check := func(got map[string]float64, want map[string]float64) {
+		for name, ratio := range want {
+			if math.Abs(got[name]-ratio) > 0.01 {
+				t.Errorf("host %s expect ratio %f, got %f", name, ratio, got[name])
+			}
+		}
+	}
+
+	check(distribute(10000), map[string]float64{"a": 3.0 / 6.0, "b": 2.0 / 6.0, "c": 1.0 / 6.0})
+
+	// smooth, the heavy host is never chosen more than twice in a row with 3:2:1
+	last, repeat := "", 0
+	for i := 0; i < 60; i++ {
+		name := lb.ChooseHost(nil).Hostname()
+		if name == last {
+			repeat++
+		} else {
+			last, repeat = name, 1
+		}
+		if repeat > 2 {
+			t.Fatalf("host %s is chosen %d times in a row", name, repeat)
+		}
+	}
+
+	// weight pushed by the discovery takes effect without a new load balancer
+	host3.SetWeight(3)
+	check(distribute(8000), map[string]float64{"a": 3.0 / 8.0, "b": 2.0 / 8.0, "c": 3.0 / 8.0})
+}
+
 func TestSmoothWeightedRRLoadBalancer_UpdateHost(t *testing.T) {
 
 	host1 := NewHost(newHostV2("127.0.0.1", "a", 8, nil), nil)
@@ -511,3 +605,101 @@ func Benchmark_RouteAndLB(b *testing.B) {
 		mockedClusterMng.PutClusterSnapshot(clusterSnapshot)
 	}
 }
+
+// zoneLoadSelector is an example of the custom host selector: it prefers the hosts of the zone
+// in the request header, and chooses the least loaded one
+type zoneLoadSelector struct{}
+
+func (s *zoneLoadSelector) SelectHost(context types.LoadBalancerContext, hosts []types.Host) types.Host {
+	candidates := hosts
+	if context != nil && context.DownstreamHeaders() != nil {
+		if zone, ok := context.DownstreamHeaders().Get("x-zone"); ok {
+			var zoneHosts []types.Host
+			for _, host := range hosts {
+				if host.Metadata()["zone"] == types.GenerateHashedValue(zone) {
+					zoneHosts = append(zoneHosts, host)
+				}
+			}
+			if len(zoneHosts) > 0 {
+				candidates = zoneHosts
+			}
+		}
+	}
+
+	var selected types.Host
+	for _, host := range candidates {
+		if selected == nil ||
+			host.HostStats().UpstreamRequestActive.Count() < selected.HostStats().UpstreamRequestActive.Count() {
+			selected = host
+		}
+	}
+	return selected
+}
+
+func TestHostSelector(t *testing.T) {
+	RegisterHostSelector("zone_load", func(prioritySet types.PrioritySet) types.HostSelector {
+		return &zoneLoadSelector{}
+	})
+
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:         "selector",
+		ClusterType:  v2.SIMPLE_CLUSTER,
+		LbType:       v2.LB_RANDOM,
+		HostSelector: "zone_load",
+	}, nil, false)
+	if c.info.LbType() != "zone_load" {
+		t.Fatalf("expect the host selector lb type, got %s", c.info.LbType())
+	}
+	host1 := NewHost(newHostV2("10.0.6.1:12200", "a", 1, v2.Metadata{"zone": "zone1"}), c.info)
+	host2 := NewHost(newHostV2("10.0.6.2:12200", "b", 1, v2.Metadata{"zone": "zone1"}), c.info)
+	host3 := NewHost(newHostV2("10.0.6.3:12200", "c", 1, v2.Metadata{"zone": "zone2"}), c.info)
+	c.UpdateHosts([]types.Host{host1, host2, host3})
+
+	lb := c.info.LBInstance()
+	host1.HostStats().UpstreamRequestActive.Inc(2)
+	defer host1.HostStats().UpstreamRequestActive.Dec(2)
+	host3.HostStats().UpstreamRequestActive.Inc(1)
+	defer host3.HostStats().UpstreamRequestActive.Dec(1)
+
+	if host := lb.ChooseHost(&headerContextMock{headers: protocol.CommonHeader{"x-zone": "zone1"}}); host != host2 {
+		t.Errorf("expect the least loaded host of zone1, got %v", host)
+	}
+	if host := lb.ChooseHost(&headerContextMock{headers: protocol.CommonHeader{"x-zone": "zone2"}}); host != host3 {
+		t.Errorf("expect the host of zone2, got %v", host)
+	}
+	if host := lb.ChooseHost(nil); host != host2 {
+		t.Errorf("expect the least loaded host, got %v", host)
+	}
+
+	// an unknown selector falls back to the lb type
+	unknown := newSimpleInMemCluster(v2.Cluster{
+		Name:         "unknown_selector",
+		ClusterType:  v2.SIMPLE_CLUSTER,
+		LbType:       v2.LB_ROUNDROBIN,
+		HostSelector: "unknown",
+	}, nil, false)
+	if unknown.info.LbType() != types.RoundRobin {
+		t.Errorf("expect the lb type used, got %s", unknown.info.LbType())
+	}
+}
+
+func TestBuiltinHostSelectors(t *testing.T) {
+	hosts := []types.Host{
+		NewHost(newHostV2("127.0.0.1", "a", 1, nil), nil),
+		NewHost(newHostV2("127.0.0.2", "b", 1, nil), nil),
+	}
+	ps := &prioritySet{}
+	for _, selector := range []types.HostSelector{
+		newRandomLoadbalancer(ps).(types.HostSelector),
+		newRoundRobinLoadBalancer(ps).(types.HostSelector),
+		newSmoothWeightedRRLoadBalancer(ps).(types.HostSelector),
+	} {
+		chosen := map[types.Host]bool{}
+		for i := 0; i < 100; i++ {
+			chosen[selector.SelectHost(nil, hosts)] = true
+		}
+		if len(chosen) != len(hosts) {
+			t.Errorf("%T: expect all hosts chosen, got %v", selector, chosen)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultLocalPercent      = 100
+	defaultMinHealthyPercent = 70
+)
+
+var localZone string
+
+// SetLocalZone sets the zone of the local MOSN preferred by the locality load balancer.
+// It should be called during initialization
+func SetLocalZone(zone string) {
+	localZone = zone
+}
+
+// localityLoadBalancer splits the hosts by zone into the local and remote priority sets, each balanced by
+// the load balancer of the cluster's type. LocalPercent of the requests go to the local zone, scaled down in
+// proportion if the healthy percent of the local hosts is below MinHealthyPercent, the rest and the requests
+// finding no local host spill to the remote zones
+type localityLoadBalancer struct {
+	prioritySet       types.PrioritySet
+	zoneKey           string
+	zone              types.HashedValue
+	localPercent      uint32
+	minHealthyPercent uint32
+
+	local    *prioritySet
+	remote   *prioritySet
+	localLB  types.LoadBalancer
+	remoteLB types.LoadBalancer
+
+	localZoneRequests metrics.Counter
+	crossZoneRequests metrics.Counter
+
+	randMutex    sync.Mutex
+	randInstance *rand.Rand
+}
+
+func newLocalityLoadBalancer(lbType types.LoadBalancerType, ps types.PrioritySet, clusterName string,
+	config v2.LocalityLBConfig) types.LoadBalancer {
+	lb := &localityLoadBalancer{
+		prioritySet:       ps,
+		zoneKey:           config.ZoneKey,
+		zone:              types.GenerateHashedValue(localZone),
+		localPercent:      config.LocalPercent,
+		minHealthyPercent: config.MinHealthyPercent,
+		local:             &prioritySet{},
+		remote:            &prioritySet{},
+		randInstance:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if lb.localPercent == 0 || lb.localPercent > 100 {
+		lb.localPercent = defaultLocalPercent
+	}
+	if lb.minHealthyPercent == 0 || lb.minHealthyPercent > 100 {
+		lb.minHealthyPercent = defaultMinHealthyPercent
+	}
+	s := stats.NewClusterStats(clusterName)
+	lb.localZoneRequests = s.Counter(stats.UpstreamRequestLocalZone)
+	lb.crossZoneRequests = s.Counter(stats.UpstreamRequestCrossZone)
+
+	lb.update(nil, nil)
+	lb.localLB = NewLoadBalancer(lbType, lb.local)
+	lb.remoteLB = NewLoadBalancer(lbType, lb.remote)
+	// the healthy hosts refresh notifies the callbacks too
+	ps.AddMemberUpdateCb(func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+		lb.update(hostsAdded, hostsRemoved)
+	})
+
+	return lb
+}
+
+func (lb *localityLoadBalancer) isLocal(host types.Host) bool {
+	return host.Metadata()[lb.zoneKey] == lb.zone
+}
+
+// split returns the local hosts and the remote hosts
+func (lb *localityLoadBalancer) split(hosts []types.Host) (local []types.Host, remote []types.Host) {
+	for _, host := range hosts {
+		if lb.isLocal(host) {
+			local = append(local, host)
+		} else {
+			remote = append(remote, host)
+		}
+	}
+	return local, remote
+}
+
+func (lb *localityLoadBalancer) update(hostsAdded []types.Host, hostsRemoved []types.Host) {
+	localAdded, remoteAdded := lb.split(hostsAdded)
+	localRemoved, remoteRemoved := lb.split(hostsRemoved)
+
+	for i, hostSet := range lb.prioritySet.HostSetsByPriority() {
+		priority := uint32(i)
+		localHosts, remoteHosts := lb.split(hostSet.Hosts())
+		localHealthy, remoteHealthy := lb.split(hostSet.HealthyHosts())
+
+		lb.local.GetOrCreateHostSet(priority).UpdateHosts(localHosts, localHealthy, nil, nil, localAdded, localRemoved)
+		lb.remote.GetOrCreateHostSet(priority).UpdateHosts(remoteHosts, remoteHealthy, nil, nil, remoteAdded, remoteRemoved)
+		// the added and removed hosts are notified once
+		localAdded, localRemoved, remoteAdded, remoteRemoved = nil, nil, nil, nil
+	}
+}
+
+// localRequestPercent returns the percent of the requests routed to the local zone by the local hosts health
+func (lb *localityLoadBalancer) localRequestPercent() uint32 {
+	var total, healthy uint32
+	for _, hostSet := range lb.local.HostSetsByPriority() {
+		total += uint32(len(hostSet.Hosts()))
+		healthy += uint32(len(hostSet.HealthyHosts()))
+	}
+	if healthy == 0 {
+		return 0
+	}
+
+	healthyPercent := healthy * 100 / total
+	if healthyPercent >= lb.minHealthyPercent {
+		return lb.localPercent
+	}
+	return lb.localPercent * healthyPercent / lb.minHealthyPercent
+}
+
+func (lb *localityLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	lb.randMutex.Lock()
+	roll := uint32(lb.randInstance.Intn(100))
+	lb.randMutex.Unlock()
+
+	if roll < lb.localRequestPercent() {
+		if host := lb.localLB.ChooseHost(context); host != nil {
+			lb.localZoneRequests.Inc(1)
+			return host
+		}
+	}
+	if host := lb.remoteLB.ChooseHost(context); host != nil {
+		lb.crossZoneRequests.Inc(1)
+		return host
+	}
+	// no remote host
+	if host := lb.localLB.ChooseHost(context); host != nil {
+		lb.localZoneRequests.Inc(1)
+		return host
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestLocalityLoadBalancer(t *testing.T) {
+	SetLocalZone("zone1")
+	defer SetLocalZone("")
+
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "locality",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_ROUNDROBIN,
+		LocalityLB:  v2.LocalityLBConfig{ZoneKey: "zone"},
+	}, nil, false)
+	if _, ok := c.info.lbInstance.(*localityLoadBalancer); !ok {
+		t.Fatalf("expect locality load balancer, got %T", c.info.lbInstance)
+	}
+	var localHosts []types.Host
+	var hosts []types.Host
+	for i := 1; i <= 6; i++ {
+		addr := "10.0.5." + strconv.Itoa(i) + ":12200"
+		zone := "zone1"
+		if i > 4 {
+			zone = "zone2"
+		}
+		host := NewHost(newHostV2(addr, addr, 1, v2.Metadata{"zone": zone}), c.info)
+		if zone == "zone1" {
+			localHosts = append(localHosts, host)
+		}
+		hosts = append(hosts, host)
+	}
+	c.UpdateHosts(hosts)
+
+	s := stats.NewClusterStats("locality")
+	choose := func(n int) (local int64, cross int64) {
+		localBefore := s.Counter(stats.UpstreamRequestLocalZone).Count()
+		crossBefore := s.Counter(stats.UpstreamRequestCrossZone).Count()
+		for i := 0; i < n; i++ {
+			host := c.info.lbInstance.ChooseHost(nil)
+			if host == nil {
+				t.Fatal("no host chosen")
+			}
+			if isLocal := host.Metadata()["zone"] == types.GenerateHashedValue("zone1"); isLocal != (host.AddressString() <= "10.0.5.4:12200") {
+				t.Fatalf("unexpected zone of host %s", host.AddressString())
+			}
+		}
+		return s.Counter(stats.UpstreamRequestLocalZone).Count() - localBefore,
+			s.Counter(stats.UpstreamRequestCrossZone).Count() - crossBefore
+	}
+	setHealth := func(host types.Host, healthy bool) {
+		if healthy {
+			host.ClearHealthFlag(types.FAILED_ACTIVE_HC)
+		} else {
+			host.SetHealthFlag(types.FAILED_ACTIVE_HC)
+		}
+		c.refreshHealthHosts(host)
+	}
+
+	if local, cross := choose(100); local != 100 || cross != 0 {
+		t.Errorf("expect all requests in local zone, got local %d, cross %d", local, cross)
+	}
+
+	// 50% local hosts healthy, below the min healthy percent 70, about 71% in local zone
+	setHealth(localHosts[0], false)
+	setHealth(localHosts[1], false)
+	if local, cross := choose(1000); local < 500 || cross < 150 {
+		t.Errorf("expect spilled to remote zone, got local %d, cross %d", local, cross)
+	}
+
+	// failover to remote zone
+	setHealth(localHosts[2], false)
+	setHealth(localHosts[3], false)
+	if local, cross := choose(100); local != 0 || cross != 100 {
+		t.Errorf("expect all requests in remote zone, got local %d, cross %d", local, cross)
+	}
+
+	for _, host := range localHosts {
+		setHealth(host, true)
+	}
+	if local, cross := choose(100); local != 100 || cross != 0 {
+		t.Errorf("expect back to local zone, got local %d, cross %d", local, cross)
+	}
+}
+
+func TestLocalityLoadBalancerDisabled(t *testing.T) {
+	// no local zone
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "no_locality",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		LocalityLB:  v2.LocalityLBConfig{ZoneKey: "zone"},
+	}, nil, false)
+	if _, ok := c.info.lbInstance.(*localityLoadBalancer); ok {
+		t.Error("locality load balancer should be disabled without local zone")
+	}
+}
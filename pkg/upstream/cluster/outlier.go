@@ -0,0 +1,376 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const (
+	defaultBaseEjectionTime   = 30 * time.Second
+	defaultMaxEjectionTime    = 300 * time.Second
+	defaultMaxEjectionPercent = 10
+)
+
+// outlierDetector counts the consecutive errors of each host, a host reaching the threshold is marked
+// FAILED_OUTLIER_CHECK and removed from the healthy hosts until the ejection time elapses
+type outlierDetector struct {
+	cluster            *cluster
+	consecutiveErrors  uint32
+	baseEjectionTime   time.Duration
+	maxEjectionTime    time.Duration
+	maxEjectionPercent uint32
+
+	mux     sync.Mutex
+	hosts   map[string]*outlierHostState
+	ejected int
+}
+
+type outlierHostState struct {
+	consecutiveErrors uint32
+	ejected           bool
+	// ejections in a row, the ejection time is doubled on each
+	ejections   uint32
+	unejectTime time.Time
+	reason      ejectReason // of the last ejection
+	// bumped on each ejection, so the timer of an ejection ended early doesn't uneject the host
+	generation uint64
+
+	// manual override by the admin api until the time
+	override      outlierOverride
+	overrideUntil time.Time
+}
+
+// ejectReason is why the host is ejected, counted apart in the cluster stats
+type ejectReason struct {
+	name   string
+	metric string
+}
+
+var (
+	ejectBy5xx            = ejectReason{"consecutive_5xx", stats.UpstreamOutlierEjections5xx}
+	ejectByTimeout        = ejectReason{"consecutive_timeout", stats.UpstreamOutlierEjectionsTimeout}
+	ejectByConnectFailure = ejectReason{"connect_failure", stats.UpstreamOutlierEjectionsConnectFailure}
+	ejectByManual         = ejectReason{"manual", stats.UpstreamOutlierEjectionsManual}
+)
+
+type outlierOverride int
+
+const (
+	overrideNone outlierOverride = iota
+	// the host is never ejected automatically and its errors are not counted
+	overrideInclude
+	// the host is ejected regardless of its errors
+	overrideEject
+)
+
+var outlierOverrideNames = map[outlierOverride]string{
+	overrideInclude: "include",
+	overrideEject:   "eject",
+}
+
+// OutlierStatus is the outlier detection of a host in the host status
+type OutlierStatus struct {
+	ConsecutiveErrors uint32 `json:"consecutive_errors"`
+	Ejections         uint32 `json:"ejections"`              // ejections in a row
+	EjectReason       string `json:"eject_reason,omitempty"` // of the last ejection
+	Override          string `json:"override,omitempty"`     // include or eject by the admin api
+	OverrideUntil     string `json:"override_until,omitempty"`
+}
+
+func newOutlierDetector(c *cluster, config v2.OutlierDetection) *outlierDetector {
+	if config.Consecutive5xx == 0 {
+		return nil
+	}
+
+	d := &outlierDetector{
+		cluster:            c,
+		consecutiveErrors:  config.Consecutive5xx,
+		baseEjectionTime:   config.BaseEjectionTime,
+		maxEjectionTime:    config.MaxEjectionTime,
+		maxEjectionPercent: config.MaxEjectionPercent,
+		hosts:              make(map[string]*outlierHostState),
+	}
+	if d.baseEjectionTime <= 0 {
+		d.baseEjectionTime = defaultBaseEjectionTime
+	}
+	if d.maxEjectionTime < d.baseEjectionTime {
+		d.maxEjectionTime = defaultMaxEjectionTime
+		if d.maxEjectionTime < d.baseEjectionTime {
+			d.maxEjectionTime = d.baseEjectionTime
+		}
+	}
+	if d.maxEjectionPercent == 0 || d.maxEjectionPercent > 100 {
+		d.maxEjectionPercent = defaultMaxEjectionPercent
+	}
+
+	return d
+}
+
+func (d *outlierDetector) PutResult(host types.Host, success bool) {
+	d.putResult(host, success, ejectBy5xx)
+}
+
+func (d *outlierDetector) PutTimeout(host types.Host) {
+	d.putResult(host, false, ejectByTimeout)
+}
+
+// putResult counts the errors of the host, the host is ejected for the reason of the error reaching
+// the threshold
+func (d *outlierDetector) putResult(host types.Host, success bool, reason ejectReason) {
+	if host == nil {
+		return
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	state, ok := d.hosts[host.AddressString()]
+	if !ok {
+		if success {
+			return
+		}
+		state = &outlierHostState{}
+		d.hosts[host.AddressString()] = state
+	}
+	if success {
+		state.consecutiveErrors = 0
+		return
+	}
+
+	state.consecutiveErrors++
+	if state.ejected || state.consecutiveErrors < d.consecutiveErrors {
+		return
+	}
+	if d.suppressed(host, state) {
+		state.consecutiveErrors = 0
+		return
+	}
+	if !d.canEject() {
+		log.DefaultLogger.Warnf("outlier host %s in cluster %s is not ejected, max ejection percent %d reached",
+			host.AddressString(), d.cluster.info.name, d.maxEjectionPercent)
+		return
+	}
+	d.eject(host, state, reason)
+}
+
+// ejectHost ejects the host regardless of its consecutive errors, e.g. the host can't be connected anymore
+func (d *outlierDetector) ejectHost(host types.Host) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	state, ok := d.hosts[host.AddressString()]
+	if !ok {
+		state = &outlierHostState{}
+		d.hosts[host.AddressString()] = state
+	}
+	if state.ejected || d.suppressed(host, state) {
+		return
+	}
+	if !d.canEject() {
+		log.DefaultLogger.Warnf("outlier host %s in cluster %s is not ejected, max ejection percent %d reached",
+			host.AddressString(), d.cluster.info.name, d.maxEjectionPercent)
+		return
+	}
+	d.eject(host, state, ejectByConnectFailure)
+}
+
+// suppressed returns true if the host is included manually, the ejection is counted as suppressed
+func (d *outlierDetector) suppressed(host types.Host, state *outlierHostState) bool {
+	if state.override != overrideInclude {
+		return false
+	}
+	if !time.Now().Before(state.overrideUntil) {
+		state.override = overrideNone
+		return false
+	}
+	log.DefaultLogger.Infof("outlier host %s in cluster %s is not ejected, included manually until %s",
+		host.AddressString(), d.cluster.info.name, state.overrideUntil.Format(time.RFC3339))
+	d.stats().Counter(stats.UpstreamOutlierEjectionsSuppressed).Inc(1)
+	return true
+}
+
+// canEject returns true if one more host can be ejected under the max ejection percent
+func (d *outlierDetector) canEject() bool {
+	total := 0
+	for _, hostSet := range d.cluster.prioritySet.HostSetsByPriority() {
+		total += len(hostSet.Hosts())
+	}
+
+	return uint32((d.ejected+1)*100) <= d.maxEjectionPercent*uint32(total)
+}
+
+func (d *outlierDetector) eject(host types.Host, state *outlierHostState, reason ejectReason) {
+	// the backoff is reset if the host keeps working longer than the last ejection time
+	if state.ejections > 0 && time.Since(state.unejectTime) > d.ejectionTime(state.ejections) {
+		state.ejections = 0
+	}
+	state.ejections++
+	d.ejectFor(host, state, reason, d.ejectionTime(state.ejections))
+}
+
+// ejectFor ejects the host for the ejection time, or restarts the ejection time if the host is ejected
+func (d *outlierDetector) ejectFor(host types.Host, state *outlierHostState, reason ejectReason, ejectionTime time.Duration) {
+	if !state.ejected {
+		state.ejected = true
+		d.ejected++
+		host.SetHealthFlag(types.FAILED_OUTLIER_CHECK)
+		if !host.ContainHealthFlag(types.FAILED_ACTIVE_HC) {
+			d.cluster.refreshHealthHosts(host)
+		}
+	}
+	state.reason = reason
+	state.generation++
+	generation := state.generation
+
+	log.DefaultLogger.Infof("eject outlier host %s in cluster %s for %s, reason %s",
+		host.AddressString(), d.cluster.info.name, ejectionTime, reason.name)
+	s := d.stats()
+	s.Counter(stats.UpstreamOutlierEjectionsTotal).Inc(1)
+	s.Counter(reason.metric).Inc(1)
+	s.Gauge(stats.UpstreamOutlierEjectedActive).Update(int64(d.ejected))
+
+	time.AfterFunc(ejectionTime, func() {
+		d.mux.Lock()
+		defer d.mux.Unlock()
+		if state.ejected && state.generation == generation {
+			d.uneject(host, state)
+		}
+	})
+}
+
+// uneject reintroduces the ejected host, it should be called with the lock held
+func (d *outlierDetector) uneject(host types.Host, state *outlierHostState) {
+	state.ejected = false
+	state.consecutiveErrors = 0
+	state.unejectTime = time.Now()
+	if state.override == overrideEject {
+		state.override = overrideNone
+	}
+	d.ejected--
+	d.stats().Gauge(stats.UpstreamOutlierEjectedActive).Update(int64(d.ejected))
+
+	log.DefaultLogger.Infof("outlier host %s in cluster %s is reintroduced", host.AddressString(), d.cluster.info.name)
+
+	host.ClearHealthFlag(types.FAILED_OUTLIER_CHECK)
+	if host.Health() {
+		d.cluster.refreshHealthHosts(host)
+	}
+}
+
+func (d *outlierDetector) ejectionTime(ejections uint32) time.Duration {
+	ejectionTime := d.baseEjectionTime
+	for i := uint32(1); i < ejections && ejectionTime < d.maxEjectionTime; i++ {
+		ejectionTime *= 2
+	}
+	if ejectionTime > d.maxEjectionTime {
+		ejectionTime = d.maxEjectionTime
+	}
+
+	return ejectionTime
+}
+
+// override forces the host ejected or included for the window regardless of its errors, the max ejection
+// percent is not checked for the manual ejection. An included host is reintroduced at once and never
+// ejected automatically in the window
+func (d *outlierDetector) override(host types.Host, eject bool, window time.Duration) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	state, ok := d.hosts[host.AddressString()]
+	if !ok {
+		state = &outlierHostState{}
+		d.hosts[host.AddressString()] = state
+	}
+	state.consecutiveErrors = 0
+	state.overrideUntil = time.Now().Add(window)
+	if eject {
+		state.override = overrideEject
+		d.ejectFor(host, state, ejectByManual, window)
+		return
+	}
+
+	state.override = overrideInclude
+	log.DefaultLogger.Infof("outlier host %s in cluster %s is included manually for %s",
+		host.AddressString(), d.cluster.info.name, window)
+	if state.ejected {
+		d.uneject(host, state)
+	}
+}
+
+// status returns the outlier detection of the host, nil if the host never failed
+func (d *outlierDetector) status(addr string) *OutlierStatus {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	state, ok := d.hosts[addr]
+	if !ok {
+		return nil
+	}
+	s := &OutlierStatus{
+		ConsecutiveErrors: state.consecutiveErrors,
+		Ejections:         state.ejections,
+		EjectReason:       state.reason.name,
+	}
+	if state.override != overrideNone && time.Now().Before(state.overrideUntil) {
+		s.Override = outlierOverrideNames[state.override]
+		s.OverrideUntil = state.overrideUntil.Format(time.RFC3339Nano)
+	}
+	return s
+}
+
+func (d *outlierDetector) stats() types.Metrics {
+	return stats.NewClusterStats(d.cluster.info.name)
+}
+
+// SetOutlierOverride forces the host of the cluster ejected or included for the window, overriding the
+// automatic outlier detection, see outlierDetector.override
+func SetOutlierOverride(clusterName string, addr string, eject bool, window time.Duration) error {
+	if clusterMangerInstance == nil {
+		return errors.New("no cluster manager")
+	}
+	v, ok := clusterMangerInstance.primaryClusters.Load(clusterName)
+	if !ok {
+		return fmt.Errorf("unknown cluster %s", clusterName)
+	}
+	pc := v.(*primaryCluster)
+	pc.updateLock.Lock()
+	defer pc.updateLock.Unlock()
+
+	ci, ok := pc.cluster.Info().(*clusterInfo)
+	if !ok || ci.outlierDetector == nil {
+		return fmt.Errorf("outlier detection of cluster %s is disabled", clusterName)
+	}
+	for _, hostSet := range pc.cluster.PrioritySet().HostSetsByPriority() {
+		for _, host := range hostSet.Hosts() {
+			if host.AddressString() == addr {
+				ci.outlierDetector.override(host, eject, window)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unknown host %s in cluster %s", addr, clusterName)
+}
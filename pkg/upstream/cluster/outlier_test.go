@@ -0,0 +1,199 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/stats"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	base := 50 * time.Millisecond
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "outlier",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		OutlierDetection: v2.OutlierDetection{
+			Consecutive5xx:     3,
+			BaseEjectionTime:   base,
+			MaxEjectionTime:    3 * base,
+			MaxEjectionPercent: 50,
+		},
+	}, nil, false)
+	var hosts []types.Host
+	for i := 1; i <= 4; i++ {
+		addr := "10.0.3." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), c.info))
+	}
+	c.UpdateHosts(hosts)
+
+	detector := c.Info().OutlierDetector()
+	if detector == nil {
+		t.Fatal("outlier detector should be enabled")
+	}
+	healthy := func() int {
+		return len(c.PrioritySet().HostSetsByPriority()[0].HealthyHosts())
+	}
+	fail := func(host types.Host, times int) {
+		for i := 0; i < times; i++ {
+			detector.PutResult(host, false)
+		}
+	}
+
+	// success resets the consecutive errors
+	fail(hosts[0], 2)
+	detector.PutResult(hosts[0], true)
+	fail(hosts[0], 2)
+	if healthy() != 4 {
+		t.Fatalf("expect no host ejected, got %d healthy hosts", healthy())
+	}
+
+	fail(hosts[0], 1)
+	if healthy() != 3 || !hosts[0].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Fatalf("expect host %s ejected", hosts[0].AddressString())
+	}
+
+	// at most 50% of the hosts are ejected
+	fail(hosts[1], 3)
+	fail(hosts[2], 3)
+	if healthy() != 2 || hosts[2].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Fatalf("expect only 2 hosts ejected, got %d healthy hosts", healthy())
+	}
+
+	time.Sleep(base + 30*time.Millisecond)
+	if healthy() != 4 || hosts[0].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Fatalf("expect ejected hosts reintroduced, got %d healthy hosts", healthy())
+	}
+
+	// ejected again in a row, the ejection time is doubled
+	fail(hosts[0], 3)
+	time.Sleep(base + 30*time.Millisecond)
+	if !hosts[0].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Error("expect the ejection time doubled")
+	}
+	time.Sleep(base)
+	if hosts[0].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) || healthy() != 4 {
+		t.Error("expect host reintroduced after the doubled ejection time")
+	}
+}
+
+func TestOutlierEjectionTime(t *testing.T) {
+	d := newOutlierDetector(&cluster{}, v2.OutlierDetection{
+		Consecutive5xx:   1,
+		BaseEjectionTime: time.Second,
+		MaxEjectionTime:  5 * time.Second,
+	})
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := d.ejectionTime(uint32(i + 1)); got != want {
+			t.Errorf("ejection %d: expect %s, got %s", i+1, want, got)
+		}
+	}
+
+	if newOutlierDetector(&cluster{}, v2.OutlierDetection{}) != nil {
+		t.Error("outlier detector should be disabled without consecutive errors threshold")
+	}
+}
+
+func TestOutlierOverride(t *testing.T) {
+	base := 50 * time.Millisecond
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "outlier_override",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		OutlierDetection: v2.OutlierDetection{
+			Consecutive5xx:     2,
+			BaseEjectionTime:   base,
+			MaxEjectionPercent: 50,
+		},
+	}, nil, false)
+	var hosts []types.Host
+	for i := 1; i <= 4; i++ {
+		addr := "10.0.4." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), c.info))
+	}
+	c.UpdateHosts(hosts)
+	d := c.info.outlierDetector
+	s := stats.NewClusterStats("outlier_override")
+	for _, key := range []string{stats.UpstreamOutlierEjectionsTotal, stats.UpstreamOutlierEjections5xx,
+		stats.UpstreamOutlierEjectionsTimeout, stats.UpstreamOutlierEjectionsManual, stats.UpstreamOutlierEjectionsSuppressed} {
+		s.Counter(key).Clear()
+	}
+	ejected := func(host types.Host) bool {
+		return host.ContainHealthFlag(types.FAILED_OUTLIER_CHECK)
+	}
+
+	// the ejections are counted by the reason
+	d.PutTimeout(hosts[0])
+	d.PutTimeout(hosts[0])
+	d.PutResult(hosts[1], false)
+	d.PutResult(hosts[1], false)
+	if !ejected(hosts[0]) || !ejected(hosts[1]) {
+		t.Fatal("expect hosts ejected")
+	}
+	if st := d.status(hosts[0].AddressString()); st == nil || st.EjectReason != "consecutive_timeout" {
+		t.Errorf("expect ejected by timeouts, got %+v", st)
+	}
+	if s.Counter(stats.UpstreamOutlierEjectionsTimeout).Count() != 1 || s.Counter(stats.UpstreamOutlierEjections5xx).Count() != 1 ||
+		s.Counter(stats.UpstreamOutlierEjectionsTotal).Count() != 2 || s.Gauge(stats.UpstreamOutlierEjectedActive).Value() != 2 {
+		t.Error("unexpected ejection stats")
+	}
+
+	// the included host is reintroduced at once, and its errors don't eject it in the window
+	d.override(hosts[0], false, 3*base)
+	if ejected(hosts[0]) || s.Gauge(stats.UpstreamOutlierEjectedActive).Value() != 1 {
+		t.Fatal("expect the included host reintroduced")
+	}
+	d.PutResult(hosts[0], false)
+	d.PutResult(hosts[0], false)
+	d.ejectHost(hosts[0])
+	if ejected(hosts[0]) || s.Counter(stats.UpstreamOutlierEjectionsSuppressed).Count() != 2 {
+		t.Fatal("expect the ejection of the included host suppressed")
+	}
+	if st := d.status(hosts[0].AddressString()); st.Override != "include" {
+		t.Errorf("expect the override in status, got %+v", st)
+	}
+
+	// the manual ejection ignores the max ejection percent, and restarts the ejection time
+	d.override(hosts[2], true, 3*base)
+	d.override(hosts[1], true, 3*base)
+	if !ejected(hosts[2]) || s.Counter(stats.UpstreamOutlierEjectionsManual).Count() != 2 ||
+		s.Gauge(stats.UpstreamOutlierEjectedActive).Value() != 2 {
+		t.Fatal("expect hosts ejected manually")
+	}
+	// the timer of the automatic ejection of hosts[1] is stale
+	time.Sleep(base + 30*time.Millisecond)
+	if !ejected(hosts[1]) {
+		t.Error("expect the manual ejection outlasts the automatic one")
+	}
+
+	// both overrides end with the window
+	time.Sleep(2 * base)
+	if ejected(hosts[1]) || ejected(hosts[2]) || s.Gauge(stats.UpstreamOutlierEjectedActive).Value() != 0 {
+		t.Fatal("expect the manually ejected hosts reintroduced after the window")
+	}
+	d.PutResult(hosts[0], false)
+	d.PutResult(hosts[0], false)
+	if !ejected(hosts[0]) {
+		t.Error("expect the host ejected automatically after the window")
+	}
+}
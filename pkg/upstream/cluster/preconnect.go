@@ -0,0 +1,118 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const (
+	defaultPreconnectRate = 10
+	preconnectQueueSize   = 1024
+)
+
+// preconnector warms up the connection pools of the hosts added to a cluster in the background.
+// The hosts are connected one by one at the configured rate, so that a lot of hosts added at once
+// never cause a connection storm
+type preconnector struct {
+	cm       *clusterManager
+	cluster  string
+	protocol types.Protocol
+	interval time.Duration
+
+	queue    chan types.Host
+	stopOnce sync.Once
+	stopChan chan struct{}
+}
+
+// newPreconnector returns nil if the preconnect is disabled
+func newPreconnector(cm *clusterManager, cluster string, config v2.PreconnectConfig) *preconnector {
+	if config.Protocol == "" {
+		return nil
+	}
+	rate := config.Rate
+	if rate == 0 {
+		rate = defaultPreconnectRate
+	}
+
+	p := &preconnector{
+		cm:       cm,
+		cluster:  cluster,
+		protocol: types.Protocol(config.Protocol),
+		interval: time.Second / time.Duration(rate),
+		queue:    make(chan types.Host, preconnectQueueSize),
+		stopChan: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// add queues the hosts to preconnect, the hosts exceeding the queue size are connected by the first request
+func (p *preconnector) add(hosts []types.Host) {
+	for _, host := range hosts {
+		select {
+		case p.queue <- host:
+		default:
+			log.DefaultLogger.Warnf("preconnect queue of cluster %s is full, skip host %s", p.cluster, host.AddressString())
+		}
+	}
+}
+
+func (p *preconnector) stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+}
+
+func (p *preconnector) run() {
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case host := <-p.queue:
+			p.preconnect(host)
+		}
+
+		select {
+		case <-p.stopChan:
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+func (p *preconnector) preconnect(host types.Host) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Errorf("panic %v in preconnect host %s", r, host.AddressString())
+		}
+	}()
+
+	pool, ok := p.cm.getConnPool(host, p.protocol).(types.PreconnectPool)
+	if !ok {
+		log.DefaultLogger.Warnf("connection pool of %s doesn't support preconnect, cluster %s", p.protocol, p.cluster)
+		return
+	}
+	pool.Preconnect()
+	log.DefaultLogger.Debugf("preconnect host %s of cluster %s", host.AddressString(), p.cluster)
+}
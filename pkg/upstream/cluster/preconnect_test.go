@@ -0,0 +1,111 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/proxy"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+type preconnectPoolMock struct {
+	host      types.Host
+	connected chan string
+}
+
+func (p *preconnectPoolMock) Protocol() types.Protocol {
+	return "preconnect"
+}
+
+func (p *preconnectPoolMock) NewStream(ctx context.Context, receiver types.StreamReceiveListener, listener types.PoolEventListener) {
+}
+
+func (p *preconnectPoolMock) Close() {}
+
+func (p *preconnectPoolMock) Preconnect() {
+	p.connected <- p.host.AddressString()
+}
+
+func TestPreconnectHostsAdded(t *testing.T) {
+	var protocol types.Protocol = "preconnect"
+	connected := make(chan string, 8)
+	proxy.RegisterNewPoolFactory(protocol, func(host types.Host) types.ConnectionPool {
+		return &preconnectPoolMock{host: host, connected: connected}
+	})
+	cm := &clusterManager{}
+	cm.protocolConnPool.Store(protocol, &sync.Map{})
+
+	config := v2.Cluster{
+		Name:        "preconnect_test",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		ConnPool: v2.ConnPoolConfig{
+			Preconnect: v2.PreconnectConfig{Protocol: string(protocol), Rate: 20},
+		},
+	}
+	if !cm.loadCluster(config, true) {
+		t.Fatal("load cluster failed")
+	}
+	defer cm.RemovePrimaryCluster(config.Name)
+
+	hosts := []v2.Host{
+		newHostV2("127.0.0.1:8080", "h1", 0, nil),
+		newHostV2("127.0.0.2:8080", "h2", 0, nil),
+		newHostV2("127.0.0.3:8080", "h3", 0, nil),
+	}
+	start := time.Now()
+	if err := cm.UpdateClusterHosts(config.Name, 0, hosts); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	for i, h := range hosts {
+		select {
+		case addr := <-connected:
+			if addr != h.Address {
+				t.Errorf("expect host %s preconnected, got %s", h.Address, addr)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("host %s is not preconnected", h.Address)
+		}
+		// 20 hosts per second
+		if elapsed := time.Since(start); elapsed < time.Duration(i)*40*time.Millisecond {
+			t.Errorf("host %s preconnected too early: %v", h.Address, elapsed)
+		}
+	}
+
+	// only the new host is preconnected
+	if err := cm.UpdateClusterHosts(config.Name, 0, append(hosts, newHostV2("127.0.0.4:8080", "h4", 0, nil))); err != nil {
+		t.Fatalf("update hosts failed: %v", err)
+	}
+	select {
+	case addr := <-connected:
+		if addr != "127.0.0.4:8080" {
+			t.Errorf("expect the new host preconnected, got %s", addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the new host is not preconnected")
+	}
+	select {
+	case addr := <-connected:
+		t.Errorf("unexpected preconnect of %s", addr)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
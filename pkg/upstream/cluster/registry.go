@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+)
+
+// RegistrySwitchCallback is called when the config reload moves the cluster to another registry, see
+// v2.Cluster.Registry. The discovery should stop watching the cluster in the old registry and watch it in
+// the new one, the hosts discovered from the old registry and their connections are kept until the new
+// registry updates the hosts by ClusterManager.UpdateClusterHosts, so no traffic is dropped on the switch
+type RegistrySwitchCallback func(clusterName string, from string, to string)
+
+var (
+	registrySwitchMux       sync.RWMutex
+	registrySwitchCallbacks []RegistrySwitchCallback
+)
+
+// AddRegistrySwitchCallback registers the callback of the registry switch of the clusters, called in order
+// out of the lock of the cluster update. It should be called during initialization by the discovery
+func AddRegistrySwitchCallback(cb RegistrySwitchCallback) {
+	registrySwitchMux.Lock()
+	defer registrySwitchMux.Unlock()
+
+	registrySwitchCallbacks = append(registrySwitchCallbacks, cb)
+}
+
+// ClusterRegistry resolves the cluster to the registry the hosts are discovered from, e.g. the blue or the
+// green zk namespace of the same interface, so that the clusters selected by the routes of each namespace
+// are watched on the right registry. Empty means the default registry, false if the cluster doesn't exist
+func ClusterRegistry(clusterName string) (string, bool) {
+	if clusterMangerInstance == nil {
+		return "", false
+	}
+	v, ok := clusterMangerInstance.primaryClusters.Load(clusterName)
+	if !ok {
+		return "", false
+	}
+	return v.(*primaryCluster).configLock.Load().(*v2.Cluster).Registry, true
+}
+
+func notifyRegistrySwitch(clusterName string, from string, to string) {
+	log.DefaultLogger.Infof("cluster %s is switched from registry %q to %q", clusterName, from, to)
+
+	registrySwitchMux.RLock()
+	cbs := registrySwitchCallbacks
+	registrySwitchMux.RUnlock()
+	for _, cb := range cbs {
+		cb(clusterName, from, to)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const defaultReresolveInterval = 10 * time.Second
+
+var (
+	discoveryRefresherMux sync.RWMutex
+	// discoveryRefresher reads the hosts of the cluster from the registry again, nil if no discovery registered
+	discoveryRefresher func(clusterName string)
+)
+
+// SetDiscoveryRefresher sets the callback forcing a fresh read of the cluster's hosts from the registry,
+// e.g. getChildren of the providers path, the result should be updated by ClusterManager.UpdateClusterHosts.
+// It should be called during initialization by the discovery
+func SetDiscoveryRefresher(f func(clusterName string)) {
+	discoveryRefresherMux.Lock()
+	defer discoveryRefresherMux.Unlock()
+
+	discoveryRefresher = f
+}
+
+// hostReresolver counts the consecutive connect failures of each host, a host reaching the threshold is
+// ejected by the outlier detector and a rate limited discovery read is forced, so the stale address is
+// replaced without waiting for the registry watch
+type hostReresolver struct {
+	cluster     *cluster
+	failures    uint32
+	minInterval time.Duration
+
+	mux         sync.Mutex
+	hosts       map[string]uint32
+	lastRefresh time.Time
+}
+
+func newHostReresolver(c *cluster, config v2.ReresolveConfig) *hostReresolver {
+	if config.ConnectFailures == 0 {
+		return nil
+	}
+
+	r := &hostReresolver{
+		cluster:     c,
+		failures:    config.ConnectFailures,
+		minInterval: config.MinInterval.Duration,
+		hosts:       make(map[string]uint32),
+	}
+	if r.minInterval <= 0 {
+		r.minInterval = defaultReresolveInterval
+	}
+	c.prioritySet.AddMemberUpdateCb(r.onHostsUpdated)
+
+	return r
+}
+
+func (r *hostReresolver) onConnectResult(host types.Host, success bool) {
+	addr := host.AddressString()
+
+	r.mux.Lock()
+	if success {
+		delete(r.hosts, addr)
+		r.mux.Unlock()
+		return
+	}
+	r.hosts[addr]++
+	if r.hosts[addr] < r.failures {
+		r.mux.Unlock()
+		return
+	}
+	refresh := time.Since(r.lastRefresh) >= r.minInterval
+	if refresh {
+		// counted again from zero after the read, a host kept by the discovery may trigger another one
+		delete(r.hosts, addr)
+		r.lastRefresh = time.Now()
+	}
+	r.mux.Unlock()
+
+	if d := r.cluster.info.outlierDetector; d != nil {
+		d.ejectHost(host)
+	}
+	if !refresh {
+		return
+	}
+
+	name := r.cluster.info.name
+	discoveryRefresherMux.RLock()
+	f := discoveryRefresher
+	discoveryRefresherMux.RUnlock()
+	if f == nil {
+		log.DefaultLogger.Warnf("host %s in cluster %s failed to connect %d times, no discovery to refresh",
+			addr, name, r.failures)
+		return
+	}
+	log.DefaultLogger.Infof("host %s in cluster %s failed to connect %d times, refresh the discovery",
+		addr, name, r.failures)
+	go f(name)
+}
+
+// onHostsUpdated forgets the hosts removed by the discovery
+func (r *hostReresolver) onHostsUpdated(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	if len(hostsRemoved) == 0 {
+		return
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for _, host := range hostsRemoved {
+		delete(r.hosts, host.AddressString())
+	}
+}
+
+// connectResultListener reports the connect result of the upstream connection to the reresolver
+// and the connect backoff, either may be nil
+type connectResultListener struct {
+	host       types.Host
+	reresolver *hostReresolver
+	backoff    *connectBackoff
+}
+
+func (l *connectResultListener) OnEvent(event types.ConnectionEvent) {
+	switch event {
+	case types.Connected:
+		l.onConnectResult(true)
+	case types.ConnectFailed, types.ConnectTimeout:
+		l.onConnectResult(false)
+	}
+}
+
+func (l *connectResultListener) onConnectResult(success bool) {
+	if l.backoff != nil {
+		l.backoff.onConnectResult(l.host, success)
+	}
+	if l.reresolver != nil {
+		l.reresolver.onConnectResult(l.host, success)
+	}
+}
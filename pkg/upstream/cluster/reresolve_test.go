@@ -0,0 +1,122 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// closedAddress returns an address refusing the connections
+func closedAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestHostReresolver(t *testing.T) {
+	refreshed := make(chan string, 4)
+	SetDiscoveryRefresher(func(clusterName string) {
+		refreshed <- clusterName
+	})
+	defer SetDiscoveryRefresher(nil)
+
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "reresolve",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+		OutlierDetection: v2.OutlierDetection{
+			Consecutive5xx:     10,
+			MaxEjectionPercent: 100,
+		},
+		Reresolve: v2.ReresolveConfig{
+			ConnectFailures: 2,
+			MinInterval:     v2.DurationConfig{Duration: time.Hour},
+		},
+	}, nil, false)
+	var hosts []types.Host
+	for i := 0; i < 3; i++ {
+		addr := closedAddress(t)
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, nil), c.info))
+	}
+	c.UpdateHosts(hosts)
+	healthy := func() int {
+		return len(c.PrioritySet().HostSetsByPriority()[0].HealthyHosts())
+	}
+	connect := func(host types.Host) {
+		host.CreateConnection(nil).Connection.Connect(false)
+	}
+
+	// a success in between resets the count
+	connect(hosts[0])
+	c.info.reresolver.onConnectResult(hosts[0], true)
+	connect(hosts[0])
+	if healthy() != 3 || len(refreshed) != 0 {
+		t.Fatalf("expect no host ejected before the consecutive failures, got %d healthy hosts", healthy())
+	}
+
+	connect(hosts[0])
+	select {
+	case name := <-refreshed:
+		if name != "reresolve" {
+			t.Errorf("expect the cluster refreshed, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect the discovery refreshed")
+	}
+	if healthy() != 2 || !hosts[0].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Fatalf("expect the host ejected at once, got %d healthy hosts", healthy())
+	}
+
+	// the refresh is rate limited, the host is still ejected
+	connect(hosts[1])
+	connect(hosts[1])
+	if healthy() != 1 || !hosts[1].ContainHealthFlag(types.FAILED_OUTLIER_CHECK) {
+		t.Fatalf("expect the host ejected at once, got %d healthy hosts", healthy())
+	}
+	select {
+	case <-refreshed:
+		t.Error("expect the refresh rate limited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the hosts removed by the discovery are forgotten
+	c.UpdateHosts(hosts[2:])
+	if len(c.info.reresolver.hosts) != 0 {
+		t.Errorf("expect the removed hosts forgotten, got %v", c.info.reresolver.hosts)
+	}
+}
+
+func TestHostReresolverDisabled(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "no_reresolve",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+	}, nil, false)
+	if c.info.reresolver != nil {
+		t.Error("reresolver should be disabled")
+	}
+}
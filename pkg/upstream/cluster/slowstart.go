@@ -0,0 +1,62 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+const (
+	defaultSlowStartMinWeightPercent = 10
+	// weightScale keeps the precision of the ramped weight for the hosts with small weights
+	weightScale = 100
+)
+
+// slowStartWeight returns the weight of the host multiplied by weightScale.
+// The weight of a host added by the discovery ramps up linearly from the min percent to 100%
+// during the slow start window of the cluster
+func slowStartWeight(host types.Host, now time.Time) int {
+	weight := int(host.Weight()) * weightScale
+	info := host.ClusterInfo()
+	addTime := host.AddTime()
+	if info == nil || addTime.IsZero() || weight == 0 {
+		return weight
+	}
+
+	cfg := info.SlowStart()
+	window := cfg.Window.Duration
+	elapsed := now.Sub(addTime)
+	if window <= 0 || elapsed >= window {
+		return weight
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	minPercent := cfg.MinWeightPercent
+	if minPercent == 0 || minPercent > 100 {
+		minPercent = defaultSlowStartMinWeightPercent
+	}
+	percent := float64(minPercent) + float64(100-minPercent)*float64(elapsed)/float64(window)
+	if ramped := int(float64(weight) * percent / 100); ramped > 0 {
+		return ramped
+	}
+	return 1
+}
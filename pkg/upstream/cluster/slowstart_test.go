@@ -0,0 +1,122 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func newSlowStartConfig() v2.SlowStartConfig {
+	return v2.SlowStartConfig{
+		Window:           v2.DurationConfig{Duration: 30 * time.Second},
+		MinWeightPercent: 10,
+	}
+}
+
+func TestSlowStartWeight(t *testing.T) {
+	info := &clusterInfo{
+		name:      "slow_start",
+		slowStart: newSlowStartConfig(),
+	}
+	now := time.Now()
+	testCases := []struct {
+		elapsed time.Duration
+		weight  int
+	}{
+		{0, 20},
+		{3 * time.Second, 38},
+		{15 * time.Second, 110},
+		{27 * time.Second, 182},
+		{30 * time.Second, 200},
+		{time.Minute, 200},
+	}
+	for i, tc := range testCases {
+		host := NewHost(newHostV2("127.0.0.1:8080", "a", 2, nil), info)
+		host.SetAddTime(now.Add(-tc.elapsed))
+		if weight := slowStartWeight(host, now); weight != tc.weight {
+			t.Errorf("#%d expect weight %d after %v, got %d", i, tc.weight, tc.elapsed, weight)
+		}
+	}
+
+	// hosts added with the cluster and clusters without slow start have full weight
+	host := NewHost(newHostV2("127.0.0.1:8080", "a", 2, nil), info)
+	if weight := slowStartWeight(host, now); weight != 200 {
+		t.Errorf("host without add time should have full weight, got %d", weight)
+	}
+	host = NewHost(newHostV2("127.0.0.1:8080", "a", 2, nil), &clusterInfo{name: "no_slow_start"})
+	host.SetAddTime(now)
+	if weight := slowStartWeight(host, now); weight != 200 {
+		t.Errorf("slow start disabled should have full weight, got %d", weight)
+	}
+}
+
+func TestSlowStartLoadBalancer(t *testing.T) {
+	cluster := newSimpleInMemCluster(v2.Cluster{
+		Name:      "slow_start",
+		LbType:    v2.LB_WRR,
+		SlowStart: newSlowStartConfig(),
+	}, nil, false)
+	info := cluster.Info()
+	lb := info.LBInstance()
+
+	hostA := NewHost(newHostV2("127.0.0.1:8080", "a", 1, nil), info)
+	hostB := NewHost(newHostV2("127.0.0.2:8080", "b", 1, nil), info)
+	cluster.UpdateHosts([]types.Host{hostA, hostB})
+	if hostA.AddTime().IsZero() || hostB.AddTime().IsZero() {
+		t.Fatal("add time should be set by the update")
+	}
+	// hostA is warmed up
+	hostA.SetAddTime(time.Now().Add(-time.Minute))
+
+	count := func() int {
+		chosen := 0
+		for i := 0; i < 1100; i++ {
+			if lb.ChooseHost(nil) == hostB {
+				chosen++
+			}
+		}
+		return chosen
+	}
+	// hostB gets 10% weight of hostA
+	if chosen := count(); chosen < 95 || chosen > 105 {
+		t.Errorf("expect about 100 requests to the new host, got %d", chosen)
+	}
+
+	// removed and added again, ramps up from the start
+	cluster.UpdateHosts([]types.Host{hostA})
+	hostB.SetAddTime(time.Now().Add(-time.Minute))
+	newHostB := NewHost(newHostV2("127.0.0.2:8080", "b", 1, nil), info)
+	cluster.UpdateHosts([]types.Host{hostA, newHostB})
+	if time.Since(newHostB.AddTime()) > time.Second {
+		t.Fatal("add time of the host added again should be reset")
+	}
+	hostB = newHostB
+	if chosen := count(); chosen < 95 || chosen > 105 {
+		t.Errorf("expect about 100 requests to the host added again, got %d", chosen)
+	}
+
+	// participates fully after the window
+	hostB.SetAddTime(time.Now().Add(-time.Minute))
+	if chosen := count(); chosen < 545 || chosen > 555 {
+		t.Errorf("expect about 550 requests after slow start, got %d", chosen)
+	}
+}
@@ -13,11 +13,14 @@ func newHostStats(clustername string, addr string) types.HostStats {
 		UpstreamConnectionClose:                        s.Counter(stats.UpstreamConnectionClose),
 		UpstreamConnectionActive:                       s.Counter(stats.UpstreamConnectionActive),
 		UpstreamConnectionConFail:                      s.Counter(stats.UpstreamConnectionConFail),
+		UpstreamConnectionConTimeout:                   s.Counter(stats.UpstreamConnectionConTimeout),
 		UpstreamConnectionLocalClose:                   s.Counter(stats.UpstreamConnectionLocalClose),
 		UpstreamConnectionRemoteClose:                  s.Counter(stats.UpstreamConnectionRemoteClose),
 		UpstreamConnectionLocalCloseWithActiveRequest:  s.Counter(stats.UpstreamConnectionLocalCloseWithActiveRequest),
 		UpstreamConnectionRemoteCloseWithActiveRequest: s.Counter(stats.UpstreamConnectionRemoteCloseWithActiveRequest),
 		UpstreamConnectionCloseNotify:                  s.Counter(stats.UpstreamConnectionCloseNotify),
+		UpstreamConnectionIdle:                         s.Counter(stats.UpstreamConnectionIdle),
+		UpstreamConnectionRecycle:                      s.Counter(stats.UpstreamConnectionRecycle),
 		UpstreamRequestTotal:                           s.Counter(stats.UpstreamRequestTotal),
 		UpstreamRequestActive:                          s.Counter(stats.UpstreamRequestActive),
 		UpstreamRequestLocalReset:                      s.Counter(stats.UpstreamRequestLocalReset),
@@ -35,12 +38,15 @@ func newClusterStats(clustername string) types.ClusterStats {
 		UpstreamConnectionClose:                        s.Counter(stats.UpstreamConnectionClose),
 		UpstreamConnectionActive:                       s.Counter(stats.UpstreamConnectionActive),
 		UpstreamConnectionConFail:                      s.Counter(stats.UpstreamConnectionConFail),
+		UpstreamConnectionConTimeout:                   s.Counter(stats.UpstreamConnectionConTimeout),
 		UpstreamConnectionRetry:                        s.Counter(stats.UpstreamConnectionRetry),
 		UpstreamConnectionLocalClose:                   s.Counter(stats.UpstreamConnectionLocalClose),
 		UpstreamConnectionRemoteClose:                  s.Counter(stats.UpstreamConnectionRemoteClose),
 		UpstreamConnectionLocalCloseWithActiveRequest:  s.Counter(stats.UpstreamConnectionLocalCloseWithActiveRequest),
 		UpstreamConnectionRemoteCloseWithActiveRequest: s.Counter(stats.UpstreamConnectionRemoteCloseWithActiveRequest),
 		UpstreamConnectionCloseNotify:                  s.Counter(stats.UpstreamConnectionCloseNotify),
+		UpstreamConnectionIdle:                         s.Counter(stats.UpstreamConnectionIdle),
+		UpstreamConnectionRecycle:                      s.Counter(stats.UpstreamConnectionRecycle),
 		UpstreamBytesReadTotal:                         s.Counter(stats.UpstreamBytesReadTotal),
 		UpstreamBytesWriteTotal:                        s.Counter(stats.UpstreamBytesWriteTotal),
 		UpstreamRequestTotal:                           s.Counter(stats.UpstreamRequestTotal),
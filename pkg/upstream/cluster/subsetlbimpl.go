@@ -26,7 +26,7 @@ import (
 )
 
 type subSetLoadBalancer struct {
-	lbType                types.LoadBalancerType // inner LB algorithm for choosing subset's host
+	newLB                 func(types.PrioritySet) types.LoadBalancer // inner LB for choosing subset's host
 	runtime               types.Loader
 	stats                 types.ClusterStats
 	random                rand.Rand
@@ -40,9 +40,18 @@ type subSetLoadBalancer struct {
 
 func NewSubsetLoadBalancer(lbType types.LoadBalancerType, prioritySet types.PrioritySet, stats types.ClusterStats,
 	subsets types.LBSubsetInfo) types.SubSetLoadBalancer {
+	return newSubsetLoadBalancer(func(ps types.PrioritySet) types.LoadBalancer {
+		return NewLoadBalancer(lbType, ps)
+	}, prioritySet, stats, subsets)
+}
+
+// newSubsetLoadBalancer creates the subset load balancer whose subsets choose hosts
+// with the load balancer created by newLB, such as the consistent hash one
+func newSubsetLoadBalancer(newLB func(types.PrioritySet) types.LoadBalancer, prioritySet types.PrioritySet,
+	stats types.ClusterStats, subsets types.LBSubsetInfo) types.SubSetLoadBalancer {
 
 	ssb := &subSetLoadBalancer{
-		lbType:                lbType,
+		newLB:                 newLB,
 		fallBackPolicy:        subsets.FallbackPolicy(),
 		defaultSubSetMetadata: GenerateDftSubsetKeys(subsets.DefaultSubset()), //ordered subset metadata pair, value为md5 hash值
 		subSetKeys:            subsets.SubsetKeys(),
@@ -495,7 +504,7 @@ func NewPrioritySubsetImpl(subsetLB *subSetLoadBalancer, predicate types.HostPre
 		psi.Update(i, subsetLB.originalPrioritySet.HostSetsByPriority()[i].Hosts(), []types.Host{})
 	}
 
-	psi.loadbalancer = NewLoadBalancer(subsetLB.lbType, psi.prioritySubset)
+	psi.loadbalancer = subsetLB.newLB(psi.prioritySubset)
 
 	return psi
 }
@@ -20,10 +20,12 @@ package cluster
 import (
 	"net"
 	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol"
 	"github.com/alipay/sofa-mosn/pkg/router"
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
@@ -74,10 +76,12 @@ var SubsetSelectors = [][]string{
 var SubsetLbExample = subSetLoadBalancer{
 	fallBackPolicy:        2,
 	stats:                 newClusterStats("testcluster"),
-	lbType:                types.RoundRobin,
 	originalPrioritySet:   &prioritySetExample,
 	defaultSubSetMetadata: InitDefaultSubsetMetadata(),
 	subSetKeys:            GenerateSubsetKeys(SubsetSelectors),
+	newLB: func(prioritySet types.PrioritySet) types.LoadBalancer {
+		return NewLoadBalancer(types.RoundRobin, prioritySet)
+	},
 }
 
 func TestSubSetLoadBalancer_GetHostsNumber(t *testing.T) {
@@ -887,3 +891,92 @@ func (ci *ContextImplMock) DownstreamConnection() net.Conn {
 func (ci *ContextImplMock) DownstreamHeaders() types.HeaderMap {
 	return nil
 }
+
+func zoneMatchCriteria(zone string) *router.MetadataMatchCriteriaImpl {
+	return &router.MetadataMatchCriteriaImpl{
+		MatchCriteriaArray: []types.MetadataMatchCriterion{
+			&router.MetadataMatchCriterionImpl{
+				Name:  "zone",
+				Value: types.GenerateHashedValue(zone),
+			},
+		},
+	}
+}
+
+func TestSubsetConsistentHash(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "subset_hash",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_CONSISTENT_HASH,
+		LBSubSetConfig: v2.LBSubsetConfig{
+			FallBackPolicy:  uint8(types.AnyEndPoint),
+			SubsetSelectors: [][]string{{"zone"}},
+		},
+		ConsistentHash: v2.ConsistentHashConfig{HeaderKey: "uid"},
+	}, nil, false)
+
+	var hosts []types.Host
+	for i := 1; i <= 4; i++ {
+		addr := "10.0.7." + strconv.Itoa(i) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, 1, v2.Metadata{"zone": "zone1"}), c.info))
+	}
+	other := NewHost(newHostV2("10.0.7.5:12200", "other", 1, v2.Metadata{"zone": "zone2"}), c.info)
+	c.UpdateHosts(append(hosts, other))
+
+	lb := c.info.LBInstance().(*subSetLoadBalancer)
+	entry := lb.FindSubset(zoneMatchCriteria("zone1").MetadataMatchCriteria())
+	if entry == nil {
+		t.Fatal("expect the subset of zone1")
+	}
+	if _, ok := entry.PrioritySubset().LB().(*consistentHashLoadBalancer); !ok {
+		t.Fatalf("expect the consistent hash lb in the subset, got %T", entry.PrioritySubset().LB())
+	}
+
+	for i := 0; i < 100; i++ {
+		ctx := &headerContextMock{
+			ContextImplMock: ContextImplMock{mmc: zoneMatchCriteria("zone1")},
+			headers:         protocol.CommonHeader{"uid": strconv.Itoa(i)},
+		}
+		host := lb.ChooseHost(ctx)
+		if host == nil || host == other {
+			t.Fatalf("key %d: expect a host of zone1, got %v", i, host)
+		}
+		for j := 0; j < 3; j++ {
+			if got := lb.ChooseHost(ctx); got != host {
+				t.Fatalf("key %d is not sticky in the subset", i)
+			}
+		}
+	}
+}
+
+func TestSubsetHostSelector(t *testing.T) {
+	RegisterHostSelector("zone_load", func(prioritySet types.PrioritySet) types.HostSelector {
+		return &zoneLoadSelector{}
+	})
+
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:         "subset_selector",
+		ClusterType:  v2.SIMPLE_CLUSTER,
+		LbType:       v2.LB_RANDOM,
+		HostSelector: "zone_load",
+		LBSubSetConfig: v2.LBSubsetConfig{
+			FallBackPolicy:  uint8(types.AnyEndPoint),
+			SubsetSelectors: [][]string{{"zone"}},
+		},
+	}, nil, false)
+	host1 := NewHost(newHostV2("10.0.8.1:12200", "a", 1, v2.Metadata{"zone": "zone1"}), c.info)
+	host2 := NewHost(newHostV2("10.0.8.2:12200", "b", 1, v2.Metadata{"zone": "zone1"}), c.info)
+	host3 := NewHost(newHostV2("10.0.8.3:12200", "c", 1, v2.Metadata{"zone": "zone2"}), c.info)
+	c.UpdateHosts([]types.Host{host1, host2, host3})
+
+	host1.HostStats().UpstreamRequestActive.Inc(1)
+	defer host1.HostStats().UpstreamRequestActive.Dec(1)
+
+	lb := c.info.LBInstance()
+	ctx := &ContextImplMock{mmc: zoneMatchCriteria("zone1")}
+	for i := 0; i < 20; i++ {
+		if host := lb.ChooseHost(ctx); host != host2 {
+			t.Fatalf("expect the least loaded host of the subset, got %v", host)
+		}
+	}
+}
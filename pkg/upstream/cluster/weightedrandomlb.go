@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+// weightRefreshInterval bounds the time a weight updated in place by the discovery, or ramped up
+// in the slow start window, takes effect on the weighted random load balancer
+var weightRefreshInterval = time.Second
+
+// weightedRandomLoadBalancer chooses a host with the probability proportional to its weight.
+// No state is kept between the choices: a random number in [0, total weight) is searched in the
+// cumulative weights of the healthy hosts, which is O(log n) per choice and fits a large host set.
+// The cumulative weights are rebuilt when the host set changes, and refreshed every
+// weightRefreshInterval for the weights changed in place.
+// The hosts are chosen evenly if all of the weights are zero
+type weightedRandomLoadBalancer struct {
+	loadbalancer
+	randInstance *rand.Rand
+	randMutex    sync.Mutex
+
+	mutex      sync.RWMutex
+	table      weightTable
+	refreshing int32
+}
+
+type weightTable struct {
+	hosts []types.Host
+	// cumulative[i] is the total weight of hosts[0] to hosts[i]
+	cumulative []int
+	builtAt    time.Time
+}
+
+func newWeightedRandomLoadBalancer(prioritySet types.PrioritySet) types.LoadBalancer {
+	lb := &weightedRandomLoadBalancer{
+		loadbalancer: loadbalancer{
+			prioritySet: prioritySet,
+		},
+		randInstance: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	prioritySet.AddMemberUpdateCb(
+		func(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+			lb.UpdateHost(priority, hostsAdded, hostsRemoved)
+		},
+	)
+	lb.buildTable()
+
+	return lb
+}
+
+// UpdateHost rebuilds the cumulative weights with the healthy hosts of the priority set
+func (l *weightedRandomLoadBalancer) UpdateHost(priority uint32, hostsAdded []types.Host, hostsRemoved []types.Host) {
+	l.buildTable()
+}
+
+func (l *weightedRandomLoadBalancer) buildTable() {
+	hosts := l.healthyHosts()
+	now := time.Now()
+	cumulative := make([]int, len(hosts))
+	total := 0
+	for i, host := range hosts {
+		total += slowStartWeight(host, now)
+		cumulative[i] = total
+	}
+
+	l.mutex.Lock()
+	l.table = weightTable{
+		hosts:      hosts,
+		cumulative: cumulative,
+		builtAt:    now,
+	}
+	l.mutex.Unlock()
+}
+
+func (l *weightedRandomLoadBalancer) ChooseHost(context types.LoadBalancerContext) types.Host {
+	l.mutex.RLock()
+	table := l.table
+	l.mutex.RUnlock()
+
+	// a single caller refreshes the stale weights, the others go on with the current ones
+	if time.Since(table.builtAt) >= weightRefreshInterval && atomic.CompareAndSwapInt32(&l.refreshing, 0, 1) {
+		l.buildTable()
+		atomic.StoreInt32(&l.refreshing, 0)
+
+		l.mutex.RLock()
+		table = l.table
+		l.mutex.RUnlock()
+	}
+
+	if len(table.hosts) == 0 {
+		return nil
+	}
+
+	total := table.cumulative[len(table.cumulative)-1]
+	if total == 0 {
+		return table.hosts[l.intn(len(table.hosts))]
+	}
+
+	r := l.intn(total)
+	idx := sort.Search(len(table.cumulative), func(i int) bool {
+		return table.cumulative[i] > r
+	})
+	return table.hosts[idx]
+}
+
+func (l *weightedRandomLoadBalancer) intn(n int) int {
+	l.randMutex.Lock()
+	defer l.randMutex.Unlock()
+	return l.randInstance.Intn(n)
+}
@@ -0,0 +1,115 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alipay/sofa-mosn/pkg/api/v2"
+	"github.com/alipay/sofa-mosn/pkg/types"
+)
+
+func TestWeightedRandomLoadBalancer(t *testing.T) {
+	host1 := NewHost(newHostV2("127.0.0.1", "a", 3, nil), nil)
+	host2 := NewHost(newHostV2("127.0.0.2", "b", 2, nil), nil)
+	host3 := NewHost(newHostV2("127.0.0.3", "c", 1, nil), nil)
+	hosts := []types.Host{host1, host2, host3}
+	ps := &prioritySet{}
+	hs := ps.GetOrCreateHostSet(0)
+	hs.UpdateHosts(hosts, hosts, nil, nil, hosts, nil)
+	lb := NewLoadBalancer(types.WeightedRandom, ps)
+
+	distribute := func(picks int) map[string]float64 {
+		res := make(map[string]float64)
+		for i := 0; i < picks; i++ {
+			host := lb.ChooseHost(nil)
+			if host == nil {
+				t.Fatal("no host chosen")
+			}
+			res[host.Hostname()] += 1.0 / float64(picks)
+		}
+		return res
+	}
+	check := func(got map[string]float64, want map[string]float64) {
+		for name, ratio := range want {
+			if math.Abs(got[name]-ratio) > 0.02 {
+				t.Errorf("host %s expect ratio %f, got %f", name, ratio, got[name])
+			}
+		}
+	}
+
+	check(distribute(30000), map[string]float64{"a": 3.0 / 6.0, "b": 2.0 / 6.0, "c": 1.0 / 6.0})
+
+	// the host set changed
+	host4 := NewHost(newHostV2("127.0.0.4", "d", 2, nil), nil)
+	hosts = []types.Host{host1, host3, host4}
+	hs.UpdateHosts(hosts, hosts, nil, nil, []types.Host{host4}, []types.Host{host2})
+	check(distribute(30000), map[string]float64{"a": 3.0 / 6.0, "b": 0, "c": 1.0 / 6.0, "d": 2.0 / 6.0})
+
+	// the weight updated in place is refreshed
+	defer func(interval time.Duration) {
+		weightRefreshInterval = interval
+	}(weightRefreshInterval)
+	weightRefreshInterval = 0
+	host1.SetWeight(0)
+	check(distribute(30000), map[string]float64{"a": 0, "c": 1.0 / 3.0, "d": 2.0 / 3.0})
+
+	// all of the weights are zero
+	host3.SetWeight(0)
+	host4.SetWeight(0)
+	check(distribute(30000), map[string]float64{"a": 1.0 / 3.0, "c": 1.0 / 3.0, "d": 1.0 / 3.0})
+
+	hs.UpdateHosts(nil, nil, nil, nil, nil, hosts)
+	if host := lb.ChooseHost(nil); host != nil {
+		t.Errorf("expect no host chosen, got %v", host)
+	}
+}
+
+func TestWeightedRandomLbType(t *testing.T) {
+	c := newSimpleInMemCluster(v2.Cluster{
+		Name:        "weighted_random",
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_WEIGHTED_RANDOM,
+	}, nil, false)
+	if c.info.LbType() != types.WeightedRandom {
+		t.Fatalf("expect the weighted random lb type, got %s", c.info.LbType())
+	}
+	host := NewHost(newHostV2("10.0.7.1:12200", "a", 1, nil), c.info)
+	c.UpdateHosts([]types.Host{host})
+	if chosen := c.info.LBInstance().ChooseHost(nil); chosen != host {
+		t.Errorf("expect the host chosen, got %v", chosen)
+	}
+}
+
+func BenchmarkWeightedRandomLoadBalancer(b *testing.B) {
+	var hosts []types.Host
+	for i := 0; i < 5000; i++ {
+		addr := "10.1." + strconv.Itoa(i/250) + "." + strconv.Itoa(i%250) + ":12200"
+		hosts = append(hosts, NewHost(newHostV2(addr, addr, uint32(i%10+1), nil), nil))
+	}
+	ps := &prioritySet{hostSets: []types.HostSet{&hostSet{hosts: hosts, healthyHosts: hosts}}}
+	lb := NewLoadBalancer(types.WeightedRandom, ps)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lb.ChooseHost(nil)
+	}
+}
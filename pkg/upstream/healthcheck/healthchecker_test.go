@@ -23,6 +23,8 @@ import (
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
+	"github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc"
+	_ "github.com/alipay/sofa-mosn/pkg/protocol/rpc/sofarpc/codec"
 	"github.com/alipay/sofa-mosn/pkg/types"
 	"github.com/alipay/sofa-mosn/pkg/upstream/cluster"
 )
@@ -321,3 +323,33 @@ func mockEnv(mode int) types.Cluster {
 
 	return c
 }
+
+func TestSofaRPCCheckRequest(t *testing.T) {
+	config := v2.HealthCheck{Timeout: 500 * time.Millisecond}
+	// heartbeat by default
+	if cmd := newSofaRPCHealthChecker(config).newCheckRequest(); cmd.CommandCode() != sofarpc.HEARTBEAT {
+		t.Errorf("expect the heartbeat, got cmd code %d", cmd.CommandCode())
+	}
+
+	config.CheckService = "com.alipay.test.PingService:1.0"
+	config.CheckMethod = "ping"
+	for _, protocolCode := range []byte{sofarpc.PROTOCOL_CODE_V1, sofarpc.PROTOCOL_CODE_V2} {
+		config.ProtocolCode = protocolCode
+		cmd := newSofaRPCHealthChecker(config).newCheckRequest()
+		if cmd == nil {
+			t.Fatalf("protocol %d: no request created", protocolCode)
+		}
+		if cmd.CommandType() != sofarpc.REQUEST || cmd.CommandCode() != sofarpc.RPC_REQUEST {
+			t.Errorf("protocol %d: expect a rpc request, got cmd type %d, code %d", protocolCode, cmd.CommandType(), cmd.CommandCode())
+		}
+		if service, _ := cmd.Get(types.SofaRouteMatchKey); service != config.CheckService {
+			t.Errorf("protocol %d: unexpected service %s", protocolCode, service)
+		}
+		if method, _ := cmd.Get(types.SofaRouteMethodKey); method != config.CheckMethod {
+			t.Errorf("protocol %d: unexpected method %s", protocolCode, method)
+		}
+		if timeout, ok := sofarpc.RequestTimeout(cmd); !ok || timeout != config.Timeout {
+			t.Errorf("protocol %d: expect timeout %v, got %v", protocolCode, config.Timeout, timeout)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package healthcheck
 
 import (
 	"context"
+	"time"
 
 	"github.com/alipay/sofa-mosn/pkg/api/v2"
 	"github.com/alipay/sofa-mosn/pkg/log"
@@ -29,10 +30,16 @@ import (
 	"github.com/alipay/sofa-mosn/pkg/types"
 )
 
+// sofaRequestClass is the request class of the sofarpc's invocations
+const sofaRequestClass = "com.alipay.sofa.rpc.core.request.SofaRequest"
+
 type sofarpcHealthChecker struct {
 	healthChecker
 	//TODO set 'protocolCode' after service subscribe finished
 	protocolCode byte
+	// the service and method pinged instead of the heartbeat if configured
+	checkService string
+	checkMethod  string
 }
 
 func newSofaRPCHealthChecker(config v2.HealthCheck) *sofarpcHealthChecker {
@@ -40,6 +47,9 @@ func newSofaRPCHealthChecker(config v2.HealthCheck) *sofarpcHealthChecker {
 
 	shc := &sofarpcHealthChecker{
 		healthChecker: *hc,
+		protocolCode:  config.ProtocolCode,
+		checkService:  config.CheckService,
+		checkMethod:   config.CheckMethod,
 	}
 
 	// use bolt v1 as default sofa health check protocol
@@ -89,6 +99,38 @@ func (c *sofarpcHealthChecker) newSession(host types.Host) types.HealthCheckSess
 	return shcs
 }
 
+// newCheckRequest creates the heartbeat of the protocol, or the request of the check service if configured.
+// The heartbeat is answered by the remoting layer of the backend, while the request goes through the
+// application, which detects the backend sick but still connected. The request is built on the heartbeat,
+// so it is encoded by the heartbeat's protocol
+func (c *sofarpcHealthChecker) newCheckRequest() sofarpc.SofaRpcCmd {
+	cmd := sofarpc.NewHeartbeat(c.protocolCode)
+	if cmd == nil || c.checkService == "" {
+		return cmd
+	}
+
+	var request *sofarpc.BoltRequest
+	switch r := cmd.(type) {
+	case *sofarpc.BoltRequest:
+		request = r
+	case *sofarpc.BoltRequestV2:
+		request = &r.BoltRequest
+	default:
+		return cmd
+	}
+	request.CmdCode = sofarpc.RPC_REQUEST
+	request.RequestClass = sofaRequestClass
+	request.RequestHeader = map[string]string{
+		types.SofaRouteMatchKey:  c.checkService,
+		types.SofaRouteMethodKey: c.checkMethod,
+	}
+	if timeout := c.getTimeoutDuration(); timeout > 0 {
+		request.Timeout = int(timeout / time.Millisecond)
+	}
+
+	return cmd
+}
+
 func (c *sofarpcHealthChecker) createStreamClient(data types.CreateConnectionData) stream.Client {
 	return stream.NewStreamClient(context.Background(), protocol.SofaRPC, data.Connection, data.HostInfo)
 }
@@ -159,8 +201,8 @@ func (s *sofarpcHealthCheckSession) onInterval() {
 	s.requestSender = s.client.NewStream(context.Background(), s)
 	s.requestSender.GetStream().AddEventListener(s)
 
-	//create protocol specified heartbeat packet
-	hbPacket := sofarpc.NewHeartbeat(s.healthChecker.protocolCode)
+	//create protocol specified heartbeat packet, or the request of the check service
+	hbPacket := s.healthChecker.newCheckRequest()
 	if hbPacket != nil {
 		s.requestSender.AppendHeaders(context.Background(), hbPacket, true)
 		log.DefaultLogger.Debugf("SofaRpc HealthCheck Sending Heart Beat to %s", s.host.AddressString())